@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+)
+
+// Path of the zone's access log, reading it isn't logged because it doesn't contain data of the zone
+const ZoneAccessLogPath = "/zones/:zone_id/access_log"
+
+// ZoneAccess is one read or export of a zone, written for zones of tenants with access_log enabled
+type ZoneAccess struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at" sql:"index"`
+
+	ZoneId         uint   `json:"zone_id" sql:"index"`
+	KeyScope       string `json:"key_scope"`       // customer (DNSAPI_API_TOKEN), admin (DNSAPI_ADMIN_TOKEN) or export (DNSAPI_EXPORT_TOKEN)
+	KeyFingerprint string `json:"key_fingerprint"` // Start of SHA-256 of the token, tells apart tokens before and after rotation
+	Path           string `json:"path"`            // Route of the request, ex. /zones/:zone_id/render
+	RemoteIP       string `json:"remote_ip"`
+}
+
+// Fingerprint of the token, the token itself is never stored
+func keyFingerprint(token string) string {
+	if token == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// Returns the access described by the request, the zone is filled by LogZoneAccess
+func requestAccess(c echo.Context) ZoneAccess {
+	scope, _ := c.Get("key_scope").(string)
+	token := strings.Replace(c.Request().Header.Get("Authorization"), "Token ", "", -1)
+
+	return ZoneAccess{
+		KeyScope:       scope,
+		KeyFingerprint: keyFingerprint(token),
+		Path:           c.Path(),
+		RemoteIP:       c.RealIP(),
+	}
+}
+
+// LogZoneAccess writes the access of the zones into the log, zones of tenants without access_log are skipped.
+// Failure is only logged, the data was already read.
+func LogZoneAccess(zoneIds []uint, access ZoneAccess) {
+	var zones []Zone
+
+	if len(zoneIds) == 0 {
+		return
+	}
+
+	db := GetDatabaseConnection()
+	tenants := db.Table("tenants").Select("id").Where("access_log = ?", true).SubQuery()
+	err := db.Select("id").Where("id IN (?) AND tenant_id IN ?", zoneIds, tenants).Find(&zones).Error
+	if err != nil {
+		log.Errorf("zone access log: " + err.Error())
+		return
+	}
+
+	now := time.Now()
+	for _, zone := range zones {
+		entry := access
+		entry.ZoneId = zone.ID
+		entry.CreatedAt = now
+		err = db.Create(&entry).Error
+		if err != nil {
+			log.Errorf("zone access log: " + err.Error())
+			return
+		}
+	}
+}
+
+// GetZoneAccessLog returns accesses of the zone since given time, the newest first
+func GetZoneAccessLog(zoneId uint, since time.Time) ([]ZoneAccess, error) {
+	var zone Zone
+	entries := []ZoneAccess{}
+
+	db := GetReadDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Where("zone_id = ? AND created_at >= ?", zoneId, since).Order("id desc").Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// PruneZoneAccessLog removes entries older than DNSAPI_ACCESS_LOG_RETENTION days
+func PruneZoneAccessLog(now time.Time) error {
+	if config.AccessLogRetention <= 0 {
+		return nil
+	}
+
+	db := GetDatabaseConnection()
+	limit := now.AddDate(0, 0, -config.AccessLogRetention)
+	return db.Where("created_at < ?", limit).Delete(&ZoneAccess{}).Error
+}
+
+// RunAccessLogPruneScheduler prunes the zone access log every hour, it's supposed to run as goroutine
+func RunAccessLogPruneScheduler() {
+	ticker := time.NewTicker(time.Hour)
+
+	for now := range ticker.C {
+		err := PruneZoneAccessLog(now)
+		if err != nil {
+			log.Errorf("zone access log pruning: " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZoneAccessLog(t *testing.T) {
+	config.APIToken = "access-token"
+	config.AccessLogRetention = 30
+	defer func() {
+		config.APIToken = ""
+		config.AccessLogRetention = 0
+	}()
+
+	tenant, errs := NewTenant(Tenant{Name: "Compliance", AccessLog: true})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteTenant(tenant.ID)
+
+	logged, errs := NewTenantZone(tenant.ID, "BT-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(logged)
+	other, errs := NewZone("other.BT-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(other)
+
+	e := echo.New()
+	e.Use(TokenMiddleware)
+	e.Use(ZoneAccessMiddleware)
+	e.GET("/zones/:zone_id/render", func(c echo.Context) error {
+		return c.String(http.StatusOK, "zone")
+	})
+	e.GET("/zones/:zone_id/missing", func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusNotFound, RECORD_NOT_FOUND_MESSAGE)
+	})
+	e.GET(ZoneAccessLogPath, GetZoneAccessLogHandler)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(echo.GET, path, nil)
+		request.Header.Set("Authorization", "Token access-token")
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		return recorder
+	}
+	assert.Equal(t, http.StatusOK, get("/zones/"+strconv.Itoa(int(logged.ID))+"/render").Code)
+	assert.Equal(t, http.StatusOK, get("/zones/"+strconv.Itoa(int(other.ID))+"/render").Code)
+	assert.Equal(t, http.StatusNotFound, get("/zones/"+strconv.Itoa(int(logged.ID))+"/missing").Code)
+	assert.Equal(t, http.StatusOK, get("/zones/"+strconv.Itoa(int(logged.ID))+"/access_log").Code)
+
+	entries, err := GetZoneAccessLog(logged.ID, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "customer", entries[0].KeyScope)
+		assert.Equal(t, keyFingerprint("access-token"), entries[0].KeyFingerprint)
+		assert.Len(t, entries[0].KeyFingerprint, 16)
+		assert.Equal(t, "/zones/:zone_id/render", entries[0].Path)
+	}
+	entries, err = GetZoneAccessLog(other.ID, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 0, "Tenant without access log")
+
+	assert.NoError(t, PruneZoneAccessLog(time.Now().AddDate(0, 0, 31)))
+	entries, err = GetZoneAccessLog(logged.ID, time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 0, "Entries after the retention")
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Timeout of one registration call to acme-dns
+const AcmeDNSTimeout = 10 * time.Second
+
+// Label of names where ACME clients put their DNS-01 challenges
+const AcmeChallengeLabel = "_acme-challenge"
+
+// AcmeDelegation is one _acme-challenge name delegated by CNAME to the validation zone. Credentials are returned
+// only by acme-dns registration, TXT records of the built-in validation zone are set through its RRset.
+type AcmeDelegation struct {
+	Name             string `json:"name"`   // Name of the CNAME record in the zone, ex. _acme-challenge.www
+	Target           string `json:"target"` // FQDN where the challenge is looked up
+	Username         string `json:"username,omitempty"`
+	Password         string `json:"password,omitempty"`
+	Subdomain        string `json:"subdomain,omitempty"`
+	ValidationZoneId uint   `json:"validation_zone_id,omitempty"`
+}
+
+// AcmeZoneResult is the result of delegation of one zone in bulk
+type AcmeZoneResult struct {
+	ZoneId      uint             `json:"zone_id"`
+	Domain      string           `json:"domain"`
+	Delegations []AcmeDelegation `json:"delegations"`
+	Error       string           `json:"error,omitempty"`
+}
+
+// Name of the challenge record for a name in the zone, @ is the apex
+func acmeChallengeName(name string) string {
+	if name == "" || name == "@" {
+		return AcmeChallengeLabel
+	}
+	if strings.HasPrefix(name, AcmeChallengeLabel+".") || name == AcmeChallengeLabel {
+		return name
+	}
+	return AcmeChallengeLabel + "." + name
+}
+
+// Registers a new account in acme-dns at DNSAPI_ACME_DNS_URL
+func registerAcmeDNS() (*AcmeDelegation, error) {
+	var registration struct {
+		Username   string `json:"username"`
+		Password   string `json:"password"`
+		FullDomain string `json:"fulldomain"`
+		Subdomain  string `json:"subdomain"`
+	}
+
+	client := http.Client{Timeout: AcmeDNSTimeout}
+	resp, err := client.Post(strings.TrimRight(config.AcmeDNSURL, "/")+"/register", "application/json", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "acme-dns registration")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, errors.New("acme-dns registration: unexpected status code " + strconv.Itoa(resp.StatusCode))
+	}
+	err = json.NewDecoder(resp.Body).Decode(&registration)
+	if err != nil {
+		return nil, errors.Wrap(err, "acme-dns registration")
+	}
+	if registration.FullDomain == "" {
+		return nil, errors.New("acme-dns registration: response without fulldomain")
+	}
+
+	return &AcmeDelegation{
+		Target:    strings.TrimSuffix(registration.FullDomain, ".") + ".",
+		Username:  registration.Username,
+		Password:  registration.Password,
+		Subdomain: registration.Subdomain,
+	}, nil
+}
+
+// Delegation into the built-in validation zone DNSAPI_ACME_ZONE, the label is derived from the challenge FQDN
+// so repeated delegations keep the same target
+func builtinAcmeDelegation(fqdn string) (*AcmeDelegation, error) {
+	var validationZone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("domain = ?", config.AcmeZone).Find(&validationZone).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "validation zone "+config.AcmeZone)
+	}
+
+	label := fmt.Sprintf("%x", sha256.Sum256([]byte(strings.ToLower(fqdn))))[:32]
+
+	return &AcmeDelegation{
+		Target:           label + "." + config.AcmeZone + ".",
+		Subdomain:        label,
+		ValidationZoneId: validationZone.ID,
+	}, nil
+}
+
+// DelegateAcmeChallenge points _acme-challenge names of given names (@ for the apex if empty) to acme-dns
+// at DNSAPI_ACME_DNS_URL, or to the built-in validation zone DNSAPI_ACME_ZONE, by CNAME records and commits
+// the zone. Other records with the challenge names are removed because they can't coexist with CNAME.
+func DelegateAcmeChallenge(zoneId uint, names []string) ([]AcmeDelegation, []error) {
+	var zone Zone
+
+	if config.AcmeDNSURL == "" && config.AcmeZone == "" {
+		return nil, []error{errors.New("ACME delegation is not configured, set DNSAPI_ACME_DNS_URL or DNSAPI_ACME_ZONE")}
+	}
+	if len(names) == 0 {
+		names = []string{"@"}
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+	if config.AcmeDNSURL == "" && zone.Domain == config.AcmeZone {
+		return nil, []error{errors.New("validation zone can't be delegated to itself")}
+	}
+
+	delegations := []AcmeDelegation{}
+	challengeNames := make(map[string]bool)
+	for _, name := range names {
+		challengeName := acmeChallengeName(normalizeName(name, zone.Domain))
+		if challengeNames[challengeName] {
+			continue
+		}
+		challengeNames[challengeName] = true
+
+		var delegation *AcmeDelegation
+		if config.AcmeDNSURL != "" {
+			delegation, err = registerAcmeDNS()
+		} else {
+			delegation, err = builtinAcmeDelegation(challengeName + "." + zone.Domain)
+		}
+		if err != nil {
+			return nil, []error{err}
+		}
+		delegation.Name = challengeName
+		delegations = append(delegations, *delegation)
+	}
+
+	var records []Record
+	for _, record := range zone.Records {
+		if !challengeNames[record.Name] {
+			records = append(records, record)
+		}
+	}
+	for _, delegation := range delegations {
+		record := Record{ZoneId: zone.ID, Name: delegation.Name, TTL: zone.TypeTTL("CNAME"), Type: "CNAME", Value: delegation.Target}
+		record.Normalize(zone.Domain)
+		records = append(records, record)
+	}
+
+	_, errs := ReplaceRecords(zone.ID, records)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	err = Commit(zone.ID)
+	if err != nil && err != ErrCommitQueued && err != ErrSerialBatched {
+		return delegations, []error{err}
+	}
+
+	return delegations, nil
+}
+
+// DelegateAcmeChallengeZones delegates the names in all given zones, failure of one zone doesn't stop the others
+func DelegateAcmeChallengeZones(zoneIds []uint, names []string) []AcmeZoneResult {
+	results := []AcmeZoneResult{}
+
+	db := GetDatabaseConnection()
+	for _, zoneId := range zoneIds {
+		var zone Zone
+
+		result := AcmeZoneResult{ZoneId: zoneId, Delegations: []AcmeDelegation{}}
+		err := db.Where("id = ?", zoneId).Find(&zone).Error
+		if err != nil {
+			result.Error = err.Error()
+			results = append(results, result)
+			continue
+		}
+		result.Domain = zone.Domain
+
+		delegations, errs := DelegateAcmeChallenge(zoneId, names)
+		if delegations != nil {
+			result.Delegations = delegations
+		}
+		var messages []string
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		result.Error = strings.Join(messages, "\n")
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// Delegates apex _acme-challenge names of zones given by ID or domain and prints the delegations
+func acmeCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: dnsapi acme <zone ID or domain>...")
+	}
+
+	db := GetDatabaseConnection()
+	var zoneIds []uint
+	for _, arg := range args {
+		var zone Zone
+
+		id, err := strconv.Atoi(arg)
+		if err == nil {
+			err = db.Where("id = ?", id).Find(&zone).Error
+		} else {
+			err = db.Where("domain = ?", strings.TrimSuffix(arg, ".")).Find(&zone).Error
+		}
+		if err != nil {
+			return errors.Wrap(err, arg)
+		}
+		zoneIds = append(zoneIds, zone.ID)
+	}
+
+	SetNameServerIPs()
+
+	results := DelegateAcmeChallengeZones(zoneIds, nil)
+
+	report, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(append(report, '\n'))
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return errors.New(strconv.Itoa(failed) + " of " + strconv.Itoa(len(results)) + " zones failed")
+	}
+	return nil
+}
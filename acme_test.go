@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDelegateAcmeChallenge(t *testing.T) {
+	config.SkipDeploy = true
+	config.TTL = 300
+	defer func() {
+		config.SkipDeploy = false
+		config.TTL = 0
+		config.AcmeZone = ""
+		config.AcmeDNSURL = ""
+	}()
+
+	validationZone, errs := NewZone("ai-validation."+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(validationZone)
+
+	zone, errs := NewZone("AI-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	_, errs = NewRecord(zone.ID, "_acme-challenge", 300, "TXT", 0, "old-challenge")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	if _, errs := DelegateAcmeChallenge(zone.ID, nil); len(errs) != 1 {
+		t.Error("Delegation without configuration passed")
+	}
+
+	config.AcmeZone = validationZone.Domain
+	delegations, errs := DelegateAcmeChallenge(zone.ID, []string{"@", "www", "www." + zone.Domain + "."})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(delegations) != 2 || delegations[0].Name != "_acme-challenge" || delegations[1].Name != "_acme-challenge.www" {
+		t.Fatal("Unexpected delegations", delegations)
+	}
+	if delegations[0].ValidationZoneId != validationZone.ID || delegations[0].Target != delegations[0].Subdomain+"."+validationZone.Domain+"." {
+		t.Error("Unexpected target", delegations[0])
+	}
+
+	again, errs := DelegateAcmeChallenge(zone.ID, nil)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if again[0].Target != delegations[0].Target {
+		t.Error("Target of repeated delegation changed")
+	}
+
+	records, err := GetRRSets(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Type != "CNAME" || records[1].Type != "CNAME" {
+		t.Error("Unexpected records", records)
+	}
+
+	if _, errs := DelegateAcmeChallenge(validationZone.ID, nil); len(errs) != 1 {
+		t.Error("Validation zone was delegated to itself")
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/register" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"username":"user","password":"secret","fulldomain":"d420c923.auth.example.org","subdomain":"d420c923"}`))
+	}))
+	defer server.Close()
+
+	config.AcmeDNSURL = server.URL + "/"
+	results := DelegateAcmeChallengeZones([]uint{zone.ID, 0}, []string{"www"})
+	if len(results) != 2 || results[0].Error != "" || results[1].Error == "" {
+		t.Fatal("Unexpected results", results)
+	}
+	delegation := results[0].Delegations[0]
+	if delegation.Target != "d420c923.auth.example.org." || delegation.Username != "user" || delegation.Password != "secret" {
+		t.Error("Unexpected acme-dns delegation", delegation)
+	}
+
+	set, err := GetRRSet(zone.ID, "_acme-challenge.www", "CNAME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Records[0].Value != "d420c923.auth.example.org." {
+		t.Error("Record wasn't updated", set)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Resolved addresses of ALIAS records separated by comma
+func (r *Record) ResolvedAddresses() []string {
+	return splitList(r.Resolved)
+}
+
+// Looks up addresses of the ALIAS target via the resolver used for assertions, they are sorted so changes
+// can be compared
+func resolveAliasTarget(fqdn string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), AssertionTimeout)
+	defer cancel()
+
+	addrs, err := assertionResolver().LookupIPAddr(ctx, fqdn+".")
+	if err != nil {
+		return nil, err
+	}
+
+	var addresses []string
+	for _, addr := range addrs {
+		addresses = append(addresses, addr.IP.String())
+	}
+	sort.Strings(addresses)
+
+	return addresses, nil
+}
+
+// Resolves targets of the zone's ALIAS records and saves their addresses. When the lookup fails the last
+// addresses are kept, an ALIAS which was never resolved fails. Returns true if any addresses changed.
+func resolveZoneAliases(zone *Zone) (bool, error) {
+	changed := false
+
+	db := GetDatabaseConnection()
+	for i, record := range zone.Records {
+		if record.Type != "ALIAS" {
+			continue
+		}
+
+		addresses, err := resolveAliasTarget(fqdnInZone(record.Value, zone.Domain))
+		if err == nil && len(addresses) == 0 {
+			err = errors.New("no addresses")
+		}
+		if err != nil {
+			if record.Resolved == "" {
+				return changed, errors.Wrap(err, "ALIAS "+record.Name+": target "+record.Value+" can't be resolved")
+			}
+			log.Errorf("ALIAS " + record.Name + " of " + zone.Domain + " keeps the last addresses: " + err.Error())
+			continue
+		}
+
+		now := time.Now().UTC()
+		resolved := strings.Join(addresses, ",")
+		if resolved != record.Resolved {
+			changed = true
+		}
+		err = db.Model(&Record{}).Where("id = ?", record.ID).
+			Updates(map[string]interface{}{"resolved": resolved, "resolved_at": &now}).Error
+		if err != nil {
+			return changed, err
+		}
+		zone.Records[i].Resolved = resolved
+		zone.Records[i].ResolvedAt = &now
+	}
+
+	return changed, nil
+}
+
+// Replaces ALIAS records by A and AAAA records with their resolved addresses, so the zone file stays valid
+func flattenAliases(records []Record) []Record {
+	var flattened []Record
+
+	for _, record := range records {
+		if record.Type != "ALIAS" {
+			flattened = append(flattened, record)
+			continue
+		}
+
+		comment := record.Comment
+		for _, address := range record.ResolvedAddresses() {
+			recordType := "A"
+			if ip := net.ParseIP(address); ip != nil && ip.To4() == nil {
+				recordType = "AAAA"
+			}
+			flattened = append(flattened, Record{
+				ID:      record.ID,
+				ZoneId:  record.ZoneId,
+				Name:    record.Name,
+				TTL:     record.TTL,
+				Type:    recordType,
+				Value:   address,
+				Comment: comment,
+			})
+			comment = ""
+		}
+	}
+
+	return flattened
+}
+
+// RefreshAliases resolves ALIAS records of all zones again and commits zones whose addresses changed
+func RefreshAliases() error {
+	var zoneIds []uint
+
+	db := GetDatabaseConnection()
+	err := db.Model(&Record{}).Where("type = ?", "ALIAS").Pluck("DISTINCT zone_id", &zoneIds).Error
+	if err != nil {
+		return err
+	}
+
+	for _, zoneId := range zoneIds {
+		var zone Zone
+		err = activeZones(db).Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+		if err != nil {
+			continue
+		}
+
+		changed, err := resolveZoneAliases(&zone)
+		if err != nil {
+			log.Errorf("refresh of ALIAS records of " + zone.Domain + ": " + err.Error())
+		}
+		if !changed {
+			continue
+		}
+
+		Audit("zone.aliases_changed", &zone, "")
+		err = Commit(zone.ID)
+		if err != nil && err != ErrCommitQueued && err != ErrSerialBatched {
+			log.Errorf("commit of " + zone.Domain + " after refresh of ALIAS records: " + err.Error())
+		}
+	}
+
+	return nil
+}
+
+// RunAliasScheduler refreshes ALIAS records every config.AliasInterval seconds, it's supposed to run as goroutine
+func RunAliasScheduler() {
+	ticker := time.NewTicker(time.Duration(config.AliasInterval) * time.Second)
+
+	for range ticker.C {
+		err := RefreshAliases()
+		if err != nil {
+			log.Errorf("ALIAS records: " + err.Error())
+		}
+	}
+}
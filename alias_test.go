@@ -0,0 +1,125 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// Resolver answering A and AAAA queries from the map, other names don't exist
+func startAliasResolver(t *testing.T, addresses map[string][]string, mutex *sync.Mutex) (string, func()) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, request *dns.Msg) {
+			mutex.Lock()
+			defer mutex.Unlock()
+
+			response := new(dns.Msg)
+			response.SetReply(request)
+			question := request.Question[0]
+			known, ok := addresses[question.Name]
+			if !ok {
+				response.Rcode = dns.RcodeNameError
+			}
+			for _, address := range known {
+				isIPv6 := strings.Contains(address, ":")
+				if (question.Qtype == dns.TypeA && !isIPv6) || (question.Qtype == dns.TypeAAAA && isIPv6) {
+					rr, err := dns.NewRR(question.Name + " 60 IN " + map[bool]string{false: "A", true: "AAAA"}[isIPv6] + " " + address)
+					if err != nil {
+						panic(err)
+					}
+					response.Answer = append(response.Answer, rr)
+				}
+			}
+			w.WriteMsg(response)
+		}),
+	}
+	go server.ActivateAndServe()
+
+	return conn.LocalAddr().String(), func() { server.Shutdown() }
+}
+
+func TestAliasRecord(t *testing.T) {
+	var mutex sync.Mutex
+	addresses := map[string][]string{"cdn.example.net.": {"192.0.2.20", "2001:db8::20"}}
+	address, stop := startAliasResolver(t, addresses, &mutex)
+	defer stop()
+
+	config.TTL = 300
+	config.SkipDeploy = true
+	config.AssertionResolver = address
+	defer func() {
+		config.TTL = 0
+		config.SkipDeploy = false
+		config.AssertionResolver = ""
+	}()
+
+	zone, errs := NewZone("BG-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	_, errs = NewRecord(zone.ID, "@", 300, "ALIAS", 0, "192.0.2.1")
+	assert.Len(t, errs, 1)
+	alias, errs := NewRecord(zone.ID, "@", 300, "ANAME", 0, "CDN.example.net.")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "ALIAS", alias.Type)
+	assert.Equal(t, "cdn.example.net.", alias.Value)
+	_, errs = NewRecord(zone.ID, "@", 300, "A", 0, "192.0.2.1")
+	assert.Len(t, errs, 1)
+
+	err := Commit(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, err := GetStore().GetZone(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "192.0.2.20,2001:db8::20", committed.Records[0].Resolved)
+	rendered := committed.Render()
+	assert.Regexp(t, `\n@ +A +192\.0\.2\.20\n`, rendered)
+	assert.Regexp(t, `\n@ +AAAA +2001:db8::20\n`, rendered)
+	assert.NotContains(t, rendered, "ALIAS")
+
+	// Changed addresses commit the zone, failed lookups keep the last ones
+	mutex.Lock()
+	addresses["cdn.example.net."] = []string{"192.0.2.21"}
+	mutex.Unlock()
+	serial := committed.Serial
+	err = RefreshAliases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	committed, _ = GetStore().GetZone(zone.ID)
+	assert.Equal(t, "192.0.2.21", committed.Records[0].Resolved)
+	assert.NotEqual(t, serial, committed.Serial)
+
+	mutex.Lock()
+	delete(addresses, "cdn.example.net.")
+	mutex.Unlock()
+	err = Commit(zone.ID)
+	assert.NoError(t, err)
+	committed, _ = GetStore().GetZone(zone.ID)
+	assert.Equal(t, "192.0.2.21", committed.Records[0].Resolved)
+
+	// Target which was never resolved fails the commit
+	_, errs = UpdateRecord(alias.ID, "@", 300, 0, "missing.example.net.")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	err = Commit(zone.ID)
+	assert.Error(t, err)
+}
@@ -0,0 +1,566 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Rules of high-risk changes
+const (
+	AnomalyNSChange     = "ns_change"     // NS records are added, changed or removed
+	AnomalyMXChange     = "mx_change"     // MX records are added, changed or removed
+	AnomalyApexOutside  = "apex_outside"  // Apex A/AAAA points outside of DNSAPI_KNOWN_RANGES
+	AnomalyMassDeletion = "mass_deletion" // DNSAPI_MASS_DELETION_THRESHOLD or more records of the zone were deleted during the last hour
+)
+
+// What happens with changes matching the rule
+const (
+	AnomalyActionFlag    = "flag"    // Change is done, webhook and email are sent
+	AnomalyActionApprove = "approve" // Change waits for approval by the admin token
+)
+
+var anomalyRules = []string{AnomalyNSChange, AnomalyMXChange, AnomalyApexOutside, AnomalyMassDeletion}
+
+// Operations with records which can wait for approval
+const (
+	ChangeOperationCreate    = "create"
+	ChangeOperationUpdate    = "update"
+	ChangeOperationDelete    = "delete"
+	ChangeOperationImport    = "import"
+	ChangeOperationRRSet     = "rrset"
+	ChangeOperationApply     = "apply"
+	ChangeOperationBulk      = "bulk_delete"
+	ChangeOperationTemplate  = "template"
+	ChangeOperationMigration = "migration"
+	ChangeOperationWWWSync   = "www_sync"
+	ChangeOperationVariables = "variables"
+)
+
+// States of change requests
+const (
+	ChangeStatePending  = "pending"
+	ChangeStateApproved = "approved"
+	ChangeStateRejected = "rejected"
+)
+
+// RecordChange describes records removed and added by one operation, changed record is in both
+type RecordChange struct {
+	ZoneId    uint     `json:"zone_id"`
+	Operation string   `json:"operation"`
+	Removed   []Record `json:"removed"`
+	Added     []Record `json:"added"`
+
+	anomalies []Anomaly // Flagged rules reported once the change is done
+	at        time.Time
+}
+
+// Anomaly is a rule matched by the change
+type Anomaly struct {
+	Rule    string `json:"rule"`
+	Action  string `json:"action"`
+	Message string `json:"message"`
+}
+
+// ChangeRequest is a change held until it's approved by the admin token
+type ChangeRequest struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ZoneId    uint   `json:"zone_id" sql:"index"`
+	Operation string `json:"operation"`
+	RecordId  uint   `json:"record_id"` // Updated or deleted record
+	Payload   string `json:"payload"`   // JSON of the record for create and update, zone file for import, JSON of the RRset
+	Anomalies string `json:"anomalies"` // JSON list of matched rules
+	State     string `json:"state" sql:"index"`
+}
+
+// ValidateAnomalyRules checks rules in rule:action format
+func ValidateAnomalyRules(rules []string) error {
+	for _, rule := range rules {
+		parts := strings.Split(rule, ":")
+		known := false
+		for _, name := range anomalyRules {
+			known = known || name == parts[0]
+		}
+		if len(parts) != 2 || !known || (parts[1] != AnomalyActionFlag && parts[1] != AnomalyActionApprove) {
+			return errors.New(rule + " has to be one of " + strings.Join(anomalyRules, ", ") + " followed by :" + AnomalyActionFlag + " or :" + AnomalyActionApprove)
+		}
+	}
+	return nil
+}
+
+// Returns action of the rule, empty if the rule is not enabled
+func anomalyAction(rule string) string {
+	for _, configured := range config.AnomalyRules {
+		parts := strings.Split(configured, ":")
+		if len(parts) == 2 && parts[0] == rule {
+			return parts[1]
+		}
+	}
+	return ""
+}
+
+// Deletions are remembered for an hour to find mass deletions made by many requests
+var recentDeletions = make(map[uint][]time.Time)
+var recentDeletionsLock sync.Mutex
+
+// Returns number of records of the zone deleted during the last hour
+func countRecentDeletions(zoneId uint, now time.Time) int {
+	recentDeletionsLock.Lock()
+	defer recentDeletionsLock.Unlock()
+
+	var recent []time.Time
+	for _, deletedAt := range recentDeletions[zoneId] {
+		if now.Sub(deletedAt) < time.Hour {
+			recent = append(recent, deletedAt)
+		}
+	}
+	recentDeletions[zoneId] = recent
+
+	return len(recent)
+}
+
+// Remembers deletions of the change
+func recordDeletions(change *RecordChange, now time.Time) {
+	deleted := len(change.Removed) - len(change.Added)
+	if deleted <= 0 {
+		return
+	}
+
+	recentDeletionsLock.Lock()
+	defer recentDeletionsLock.Unlock()
+
+	for i := 0; i < deleted; i++ {
+		recentDeletions[change.ZoneId] = append(recentDeletions[change.ZoneId], now)
+	}
+}
+
+// Returns true if the address is inside one of DNSAPI_KNOWN_RANGES
+func inKnownRanges(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return true
+	}
+	for _, cidr := range config.KnownRanges {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// DetectAnomalies returns enabled rules matched by the change
+func DetectAnomalies(change *RecordChange, now time.Time) []Anomaly {
+	var anomalies []Anomaly
+
+	add := func(rule string, message string) {
+		if action := anomalyAction(rule); action != "" {
+			anomalies = append(anomalies, Anomaly{Rule: rule, Action: action, Message: message})
+		}
+	}
+
+	var changedTypes = make(map[string]bool)
+	for _, record := range append(append([]Record{}, change.Removed...), change.Added...) {
+		changedTypes[record.Type] = true
+	}
+	if changedTypes["NS"] {
+		add(AnomalyNSChange, "NS records are changed")
+	}
+	if changedTypes["MX"] {
+		add(AnomalyMXChange, "MX records are changed")
+	}
+
+	if len(config.KnownRanges) > 0 {
+		for _, record := range change.Added {
+			if record.Name == "@" && (record.Type == "A" || record.Type == "AAAA") && !inKnownRanges(record.Value) {
+				add(AnomalyApexOutside, "apex "+record.Type+" points to "+record.Value+" outside of known ranges")
+			}
+		}
+	}
+
+	deleted := len(change.Removed) - len(change.Added)
+	if deleted > 0 && config.MassDeletionThreshold > 0 {
+		total := countRecentDeletions(change.ZoneId, now) + deleted
+		if total >= config.MassDeletionThreshold {
+			add(AnomalyMassDeletion, strconv.Itoa(total)+" records deleted during the last hour")
+		}
+	}
+
+	return anomalies
+}
+
+// Returns true if one of the anomalies requires approval
+func requiresApproval(anomalies []Anomaly) bool {
+	for _, anomaly := range anomalies {
+		if anomaly.Action == AnomalyActionApprove {
+			return true
+		}
+	}
+	return false
+}
+
+// Sends webhook and email about anomalies of the change
+func notifyAnomalies(event string, zoneId uint, anomalies []Anomaly, data interface{}) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		log.Errorf("zone of the anomaly: " + err.Error())
+		return
+	}
+
+	var messages []string
+	for _, anomaly := range anomalies {
+		messages = append(messages, anomaly.Rule+": "+anomaly.Message)
+	}
+
+	Audit(event, &zone, strings.Join(messages, "; "))
+	SendWebhook(event, map[string]interface{}{"zone_id": zone.ID, "domain": zone.Domain, "anomalies": anomalies, "change": data})
+
+	if config.AnomalyEmail != "" {
+		go func() {
+			err := SendEmail(config.AnomalyEmail, "Suspicious change of "+zone.Domain,
+				"Change of zone "+zone.Domain+" matched these rules:\n\n"+strings.Join(messages, "\n")+"\n")
+			if err != nil {
+				log.Errorf("anomaly email: " + err.Error())
+			}
+		}()
+	}
+}
+
+// ReviewChange checks the change before it's done. Change requiring approval is saved and returned as
+// change request, the caller must not do it then. Otherwise the caller does the change and calls ChangeDone.
+// Records rewritten by the www/apex sync after the change are reviewed with it, ErrReservedName is returned
+// if they are reserved. Variables don't change records themselves, so the sync rewrites nothing after them.
+func ReviewChange(change *RecordChange, recordId uint, payload string) (*ChangeRequest, error) {
+	if change == nil {
+		return nil, nil
+	}
+
+	if change.Operation != ChangeOperationWWWSync && change.Operation != ChangeOperationVariables {
+		err := addWWWSync(change)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	change.at = time.Now()
+	anomalies := DetectAnomalies(change, change.at)
+
+	if !requiresApproval(anomalies) {
+		change.anomalies = anomalies
+		return nil, nil
+	}
+
+	anomaliesJSON, err := json.Marshal(anomalies)
+	if err != nil {
+		return nil, err
+	}
+
+	request := ChangeRequest{
+		ZoneId:    change.ZoneId,
+		Operation: change.Operation,
+		RecordId:  recordId,
+		Payload:   payload,
+		Anomalies: string(anomaliesJSON),
+		State:     ChangeStatePending,
+	}
+
+	db := GetDatabaseConnection()
+	err = db.Create(&request).Error
+	if err != nil {
+		return nil, err
+	}
+
+	notifyAnomalies("change.approval_required", change.ZoneId, anomalies, request)
+
+	return &request, nil
+}
+
+// ChangeDone remembers deletions of the reviewed change and reports its flagged rules
+func ChangeDone(change *RecordChange) {
+	if change == nil {
+		return
+	}
+
+	recordDeletions(change, change.at)
+	if len(change.anomalies) > 0 {
+		notifyAnomalies("change.flagged", change.ZoneId, change.anomalies, change)
+	}
+}
+
+// Record or RRset saved in change requests
+func changePayload(body interface{}) string {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		panic(err)
+	}
+	return string(payload)
+}
+
+// GetChangeRequests returns change requests in the state, all of them if the state is empty
+func GetChangeRequests(state string) ([]ChangeRequest, error) {
+	var requests = []ChangeRequest{}
+
+	db := GetDatabaseConnection()
+	query := db.Order("id")
+	if state != "" {
+		query = query.Where("state = ?", state)
+	}
+	err := query.Find(&requests).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// Finds change request which waits for approval
+func pendingChangeRequest(changeId uint) (*ChangeRequest, error) {
+	var request ChangeRequest
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", changeId).Find(&request).Error
+	if err != nil {
+		return nil, err
+	}
+	if request.State != ChangeStatePending {
+		return nil, errors.New("change is already " + request.State)
+	}
+
+	return &request, nil
+}
+
+// ApproveChange does the held change
+func ApproveChange(changeId uint) (*ChangeRequest, []error) {
+	request, err := pendingChangeRequest(changeId)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var record Record
+	if request.Operation == ChangeOperationCreate || request.Operation == ChangeOperationUpdate {
+		err = json.Unmarshal([]byte(request.Payload), &record)
+		if err != nil {
+			return nil, []error{err}
+		}
+	}
+
+	var errs []error
+	switch request.Operation {
+	case ChangeOperationCreate:
+		_, errs = NewRecord(request.ZoneId, record.Name, record.TTL, record.Type, record.Prio, record.Value)
+	case ChangeOperationUpdate:
+		_, errs = UpdateRecord(request.RecordId, record.Name, record.TTL, record.Prio, record.Value)
+	case ChangeOperationDelete:
+		err = DeleteRecord(request.RecordId)
+		if err != nil {
+			errs = []error{err}
+		}
+	case ChangeOperationImport:
+		_, errs = ImportZoneFile(request.ZoneId, request.Payload)
+	case ChangeOperationRRSet:
+		var set RRSet
+		err = json.Unmarshal([]byte(request.Payload), &set)
+		if err != nil {
+			return nil, []error{err}
+		}
+		_, errs = ReplaceRRSet(request.ZoneId, set)
+	case ChangeOperationApply:
+		var apply ApplyRequest
+		err = json.Unmarshal([]byte(request.Payload), &apply)
+		if err != nil {
+			return nil, []error{err}
+		}
+		_, errs = ApplyZoneRecords(request.ZoneId, apply.Owner, apply.Records, false)
+	case ChangeOperationBulk:
+		var recordIds []uint
+		err = json.Unmarshal([]byte(request.Payload), &recordIds)
+		if err != nil {
+			return nil, []error{err}
+		}
+		_, err = DeleteRecords(request.ZoneId, recordIds)
+		if err != nil {
+			errs = []error{err}
+		}
+	case ChangeOperationTemplate:
+		var templateId uint
+		err = json.Unmarshal([]byte(request.Payload), &templateId)
+		if err != nil {
+			return nil, []error{err}
+		}
+		_, errs = ApplyTemplate(request.ZoneId, templateId)
+	case ChangeOperationMigration:
+		var migration RecordMigrationRequest
+		err = json.Unmarshal([]byte(request.Payload), &migration)
+		if err != nil {
+			return nil, []error{err}
+		}
+		_, errs = StartRecordMigration(request.RecordId, migration.TTL, migration.Prio, migration.Value, migration.LoweredTTL)
+	case ChangeOperationWWWSync:
+		var rule string
+		err = json.Unmarshal([]byte(request.Payload), &rule)
+		if err != nil {
+			return nil, []error{err}
+		}
+		_, errs = SetZoneWWWSync(request.ZoneId, rule)
+	case ChangeOperationVariables:
+		var variables string
+		err = json.Unmarshal([]byte(request.Payload), &variables)
+		if err != nil {
+			return nil, []error{err}
+		}
+		_, errs = SetZoneVariables(request.ZoneId, variables)
+	case ChangeOperationSOATimers:
+		errs = applySOAProposal(request)
+	default:
+		errs = []error{errors.New("unknown operation " + request.Operation)}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	return setChangeRequestState(request, ChangeStateApproved)
+}
+
+// RejectChange drops the held change
+func RejectChange(changeId uint) (*ChangeRequest, []error) {
+	request, err := pendingChangeRequest(changeId)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return setChangeRequestState(request, ChangeStateRejected)
+}
+
+func setChangeRequestState(request *ChangeRequest, state string) (*ChangeRequest, []error) {
+	db := GetDatabaseConnection()
+	err := db.Model(request).Update("state", state).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	zone := Zone{ID: request.ZoneId}
+	Audit("change."+state, &zone, request.Operation+" (change "+strconv.Itoa(int(request.ID))+")")
+
+	return request, nil
+}
+
+// Describes changes of the zone file import, records which stay as they are aren't included. Nil is returned
+// if the zone doesn't exist or the content can't be parsed and the import itself reports it.
+func importChange(zoneId uint, content string) *RecordChange {
+	zone := reservedNamesZone(zoneId)
+	if zone == nil {
+		return nil
+	}
+
+	records, err := ParseImport(content, zone)
+	if err != nil {
+		return nil
+	}
+
+	return replaceChange(ChangeOperationImport, zone, records)
+}
+
+// Describes records added by the template, nil is returned if the zone or the template doesn't exist and
+// applying the template reports it
+func templateChange(zoneId uint, templateId uint) *RecordChange {
+	var template Template
+
+	zone := reservedNamesZone(zoneId)
+	if zone == nil {
+		return nil
+	}
+	err := GetDatabaseConnection().Where("id = ?", templateId).Preload("Records").Find(&template).Error
+	if err != nil {
+		return nil
+	}
+
+	return &RecordChange{ZoneId: zone.ID, Operation: ChangeOperationTemplate, Added: templateRecords(zone, &template)}
+}
+
+// Describes replacement of all records of the zone by given records, records have to be normalized
+func replaceChange(operation string, zone *Zone, records []Record) *RecordChange {
+	change := RecordChange{ZoneId: zone.ID, Operation: operation}
+
+	existing := make(map[string]int)
+	for _, record := range zone.Records {
+		existing[recordKey(&record)]++
+	}
+	for _, record := range records {
+		if existing[recordKey(&record)] > 0 {
+			existing[recordKey(&record)]--
+			continue
+		}
+		change.Added = append(change.Added, record)
+	}
+	for _, record := range zone.Records {
+		if existing[recordKey(&record)] > 0 {
+			existing[recordKey(&record)]--
+			change.Removed = append(change.Removed, record)
+		}
+	}
+
+	return &change
+}
+
+// Describes the final change of the record migration, it's reviewed when the migration is started. Nil is
+// returned if the record doesn't exist and the migration reports it.
+func migrationChange(recordId uint, migration *RecordMigrationRequest) *RecordChange {
+	var record Record
+
+	err := GetDatabaseConnection().Where("id = ?", recordId).Find(&record).Error
+	if err != nil {
+		return nil
+	}
+
+	return recordChange(ChangeOperationMigration, 0, recordId, &Record{Name: record.Name, TTL: migration.TTL, Prio: migration.Prio, Value: migration.Value})
+}
+
+// Describes change of one record, nil is returned if the record doesn't exist and the operation reports it
+func recordChange(operation string, zoneId uint, recordId uint, updated *Record) *RecordChange {
+	change := RecordChange{ZoneId: zoneId, Operation: operation}
+
+	if recordId != 0 {
+		var record Record
+
+		db := GetDatabaseConnection()
+		err := db.Where("id = ?", recordId).Find(&record).Error
+		if err != nil {
+			return nil
+		}
+		change.ZoneId = record.ZoneId
+		change.Removed = []Record{record}
+
+		// Type of the record can't be changed
+		if updated != nil {
+			updated.Type = record.Type
+		}
+	}
+
+	if updated != nil {
+		var zone Zone
+
+		db := GetDatabaseConnection()
+		err := db.Where("id = ?", change.ZoneId).Find(&zone).Error
+		if err != nil {
+			return nil
+		}
+
+		record := *updated
+		record.Normalize(zone.Domain)
+		change.Added = []Record{record}
+	}
+
+	return &change
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+func TestDetectAnomalies(t *testing.T) {
+	config.AnomalyRules = []string{"ns_change:approve", "mx_change:flag", "apex_outside:approve", "mass_deletion:flag"}
+	config.KnownRanges = []string{"10.0.0.0/8"}
+	config.MassDeletionThreshold = 3
+	defer func() {
+		config.AnomalyRules = nil
+		config.KnownRanges = nil
+		config.MassDeletionThreshold = 10
+	}()
+
+	if err := ValidateAnomalyRules([]string{"mx_change:ignore"}); err == nil {
+		t.Error("Unknown action passed")
+	}
+	if err := ValidateAnomalyRules([]string{"txt_change:flag"}); err == nil {
+		t.Error("Unknown rule passed")
+	}
+	if err := ValidateAnomalyRules(config.AnomalyRules); err != nil {
+		t.Error(err)
+	}
+
+	now := time.Now()
+
+	anomalies := DetectAnomalies(&RecordChange{ZoneId: 1, Added: []Record{{Name: "@", Type: "MX", Prio: 10, Value: "mail"}}}, now)
+	if len(anomalies) != 1 || anomalies[0].Rule != AnomalyMXChange || requiresApproval(anomalies) {
+		t.Error("Unexpected anomalies of MX change", anomalies)
+	}
+
+	anomalies = DetectAnomalies(&RecordChange{ZoneId: 1, Added: []Record{{Name: "@", Type: "A", Value: "10.1.2.3"}, {Name: "www", Type: "A", Value: "1.2.3.4"}}}, now)
+	if len(anomalies) != 0 {
+		t.Error("Unexpected anomalies of known apex", anomalies)
+	}
+	anomalies = DetectAnomalies(&RecordChange{ZoneId: 1, Added: []Record{{Name: "@", Type: "A", Value: "1.2.3.4"}}}, now)
+	if len(anomalies) != 1 || anomalies[0].Rule != AnomalyApexOutside || !requiresApproval(anomalies) {
+		t.Error("Unexpected anomalies of apex outside of known ranges", anomalies)
+	}
+
+	// Deletions are summed over an hour
+	deletion := &RecordChange{ZoneId: 1, Removed: []Record{{Name: "www", Type: "A", Value: "1.2.3.4"}, {Name: "ftp", Type: "A", Value: "1.2.3.4"}}}
+	if anomalies := DetectAnomalies(deletion, now); len(anomalies) != 0 {
+		t.Error("Unexpected anomalies of two deletions", anomalies)
+	}
+	recordDeletions(deletion, now.Add(-2*time.Hour))
+	if anomalies := DetectAnomalies(deletion, now); len(anomalies) != 0 {
+		t.Error("Old deletions are counted", anomalies)
+	}
+	recordDeletions(deletion, now)
+	if anomalies := DetectAnomalies(deletion, now); len(anomalies) != 1 || anomalies[0].Rule != AnomalyMassDeletion {
+		t.Error("Unexpected anomalies of mass deletion", anomalies)
+	}
+}
+
+func TestChangeApproval(t *testing.T) {
+	config.AnomalyRules = []string{"mx_change:approve"}
+	defer func() { config.AnomalyRules = nil }()
+
+	zone, errs := NewZone("AC-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	mxRecords := func() int {
+		var count int
+		err := GetDatabaseConnection().Model(&Record{}).Where("zone_id = ? AND type = ?", zone.ID, "MX").Count(&count).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	// Admin's changes are not held
+	for i, admin := range []bool{false, true} {
+		e := echo.New()
+		body := `{"name": "@", "type": "MX", "ttl": 300, "prio": ` + strconv.Itoa(10+i) + `, "value": "mail.example.com."}`
+		request := httptest.NewRequest(echo.POST, "/", strings.NewReader(body))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+		context.SetParamNames("zone_id")
+		context.SetParamValues(strconv.Itoa(int(zone.ID)))
+		context.Set("admin", admin)
+
+		err := NewRecordHandler(context)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !admin && (recorder.Code != http.StatusAccepted || mxRecords() != 0) {
+			t.Error("MX change wasn't held", recorder.Code, recorder.Body.String())
+		}
+		if admin && (recorder.Code != http.StatusCreated || mxRecords() != 1) {
+			t.Error("Admin's MX change was held", recorder.Code, recorder.Body.String())
+		}
+	}
+
+	requests, err := GetChangeRequests(ChangeStatePending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var held []ChangeRequest
+	for _, request := range requests {
+		if request.ZoneId == zone.ID {
+			held = append(held, request)
+		}
+	}
+	if len(held) != 1 || held[0].Operation != ChangeOperationCreate || !strings.Contains(held[0].Anomalies, AnomalyMXChange) {
+		t.Fatal("Unexpected change requests", held)
+	}
+
+	request, errs := ApproveChange(held[0].ID)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if request.State != ChangeStateApproved || mxRecords() != 2 {
+		t.Error("Approved change wasn't done", request, mxRecords())
+	}
+
+	if _, errs := RejectChange(held[0].ID); len(errs) == 0 {
+		t.Error("Approved change was rejected")
+	}
+}
+
+func TestTemplateChangeApproval(t *testing.T) {
+	config.AnomalyRules = []string{"mx_change:approve"}
+	defer func() { config.AnomalyRules = nil }()
+
+	zone, errs := NewZone("CG-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	template, errs := NewTemplate("CG mail", []TemplateRecord{{Name: "@", Type: "MX", TTL: 300, Prio: 10, Value: "mail.example.com."}})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteTemplate(template.ID)
+
+	e := echo.New()
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(httptest.NewRequest(echo.PUT, "/", nil), recorder)
+	context.SetParamNames("zone_id", "template_id")
+	context.SetParamValues(strconv.Itoa(int(zone.ID)), strconv.Itoa(int(template.ID)))
+	context.Set("admin", false)
+
+	err := ApplyTemplateHandler(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusAccepted {
+		t.Fatal("MX record of the template wasn't held", recorder.Code, recorder.Body.String())
+	}
+
+	var held ChangeRequest
+	err = GetDatabaseConnection().Where("zone_id = ? AND state = ?", zone.ID, ChangeStatePending).Find(&held).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if held.Operation != ChangeOperationTemplate {
+		t.Fatal("Unexpected change request", held)
+	}
+	if _, errs := ApproveChange(held.ID); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	approved, err := GetStore().GetZone(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(approved.Records) != 1 || approved.Records[0].Type != "MX" {
+		t.Error("Approved template wasn't applied", approved.Records)
+	}
+}
+
+func TestMigrationChangeApproval(t *testing.T) {
+	config.AnomalyRules = []string{"mx_change:approve"}
+	config.SkipDeploy = true
+	defer func() {
+		config.AnomalyRules = nil
+		config.SkipDeploy = false
+	}()
+
+	zone, errs := NewZone("CH-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	record, errs := NewRecord(zone.ID, "@", 3600, "MX", 10, "mail.example.com.")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	e := echo.New()
+	body := `{"ttl": 3600, "prio": 10, "value": "mail.example.net."}`
+	request := httptest.NewRequest(echo.POST, "/", strings.NewReader(body))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+	context.SetParamNames("zone_id", "record_id")
+	context.SetParamValues(strconv.Itoa(int(zone.ID)), strconv.Itoa(int(record.ID)))
+	context.Set("admin", false)
+
+	err := StartRecordMigrationHandler(context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusAccepted {
+		t.Fatal("Migration of MX record wasn't held", recorder.Code, recorder.Body.String())
+	}
+
+	db := GetDatabaseConnection()
+	var migrations int
+	db.Model(&RecordMigration{}).Where("record_id = ?", record.ID).Count(&migrations)
+	if migrations != 0 {
+		t.Error("Held migration was started")
+	}
+
+	var held ChangeRequest
+	err = db.Where("zone_id = ? AND state = ?", zone.ID, ChangeStatePending).Find(&held).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if held.Operation != ChangeOperationMigration || held.RecordId != record.ID {
+		t.Fatal("Unexpected change request", held)
+	}
+	if _, errs := ApproveChange(held.ID); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	db.Model(&RecordMigration{}).Where("record_id = ? AND value = ?", record.ID, "mail.example.net.").Count(&migrations)
+	if migrations != 1 {
+		t.Error("Approved migration wasn't started", migrations)
+	}
+}
+
+func TestWWWSyncChangeApproval(t *testing.T) {
+	config.AnomalyRules = []string{"apex_outside:approve"}
+	config.KnownRanges = []string{"10.0.0.0/8"}
+	config.SkipDeploy = true
+	defer func() {
+		config.AnomalyRules = nil
+		config.KnownRanges = nil
+		config.SkipDeploy = false
+	}()
+
+	zone, errs := NewZone("CI-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	www, errs := NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	e := echo.New()
+	call := func(handler echo.HandlerFunc, body string, names []string, values []string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(echo.PUT, "/", strings.NewReader(body))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+		context.SetParamNames(names...)
+		context.SetParamValues(values...)
+		context.Set("admin", false)
+		if err := handler(context); err != nil {
+			if httpErr, ok := err.(*echo.HTTPError); ok {
+				recorder.Code = httpErr.Code
+			} else {
+				t.Fatal(err)
+			}
+		}
+		return recorder
+	}
+	zoneId := strconv.Itoa(int(zone.ID))
+
+	// The rule would copy www outside of known ranges to the apex
+	recorder := call(SetZoneWWWSyncHandler, `{"www_sync": "www"}`, []string{"zone_id"}, []string{zoneId})
+	if recorder.Code != http.StatusAccepted {
+		t.Fatal("Rule rewriting the apex wasn't held", recorder.Code, recorder.Body.String())
+	}
+
+	var held ChangeRequest
+	db := GetDatabaseConnection()
+	if err := db.Where("zone_id = ? AND state = ?", zone.ID, ChangeStatePending).Find(&held).Error; err != nil {
+		t.Fatal(err)
+	}
+	if held.Operation != ChangeOperationWWWSync {
+		t.Fatal("Unexpected change request", held)
+	}
+	if _, errs := ApproveChange(held.ID); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	updated, _ := GetStore().GetZone(zone.ID)
+	if updated.WWWSync != WWWSyncWWW || len(updated.Records) != 2 {
+		t.Fatal("Approved rule wasn't set", updated.WWWSync, updated.Records)
+	}
+
+	// Change of www is reviewed with the apex it's synced to
+	recorder = call(UpdateRecordHandler, `{"name": "www", "ttl": 300, "value": "192.0.2.2"}`, []string{"zone_id", "record_id"}, []string{zoneId, strconv.Itoa(int(www.ID))})
+	if recorder.Code != http.StatusAccepted {
+		t.Error("Change of www synced to the apex wasn't held", recorder.Code, recorder.Body.String())
+	}
+
+	// Synced reserved apex can't be rewritten with the API token
+	if _, errs := SetZoneReservedNames(zone.ID, []string{"@"}); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	recorder = call(UpdateRecordHandler, `{"name": "www", "ttl": 300, "value": "10.0.0.2"}`, []string{"zone_id", "record_id"}, []string{zoneId, strconv.Itoa(int(www.ID))})
+	if recorder.Code != http.StatusForbidden {
+		t.Error("Reserved apex was rewritten by the sync", recorder.Code, recorder.Body.String())
+	}
+	if recorder = call(SetZoneWWWSyncHandler, `{"www_sync": ""}`, []string{"zone_id"}, []string{zoneId}); recorder.Code != http.StatusOK {
+		t.Error("Rule which doesn't rewrite records wasn't turned off", recorder.Code)
+	}
+	if recorder = call(SetZoneWWWSyncHandler, `{"www_sync": "www"}`, []string{"zone_id"}, []string{zoneId}); recorder.Code != http.StatusOK {
+		t.Error("Rule which doesn't change the apex wasn't set", recorder.Code, recorder.Body.String())
+	}
+	if _, errs := SetZoneWWWSync(zone.ID, ""); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if _, errs := UpdateRecord(www.ID, "www", 300, 0, "10.0.0.3"); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if recorder = call(SetZoneWWWSyncHandler, `{"www_sync": "www"}`, []string{"zone_id"}, []string{zoneId}); recorder.Code != http.StatusForbidden {
+		t.Error("Rule rewriting the reserved apex was set", recorder.Code, recorder.Body.String())
+	}
+}
+
+func TestVariablesChangeApproval(t *testing.T) {
+	config.AnomalyRules = []string{"apex_outside:approve"}
+	config.KnownRanges = []string{"10.0.0.0/8"}
+	config.SkipDeploy = true
+	defer func() {
+		config.AnomalyRules = nil
+		config.KnownRanges = nil
+		config.SkipDeploy = false
+	}()
+
+	zone, errs := NewZone("CJ-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	if _, errs := SetZoneVariables(zone.ID, "office=10.0.0.1"); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if _, errs := NewRecord(zone.ID, "@", 300, "A", 0, "{{office}}"); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	e := echo.New()
+	call := func(body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(echo.PUT, "/", strings.NewReader(body))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+		context.SetParamNames("zone_id")
+		context.SetParamValues(strconv.Itoa(int(zone.ID)))
+		context.Set("admin", false)
+		if err := SetZoneVariablesHandler(context); err != nil {
+			if httpErr, ok := err.(*echo.HTTPError); ok {
+				recorder.Code = httpErr.Code
+			} else {
+				t.Fatal(err)
+			}
+		}
+		return recorder
+	}
+
+	// The variable would render the apex outside of known ranges
+	recorder := call(`{"variables": "office=192.0.2.1"}`)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatal("Variables moving the apex weren't held", recorder.Code, recorder.Body.String())
+	}
+
+	var held ChangeRequest
+	db := GetDatabaseConnection()
+	if err := db.Where("zone_id = ? AND state = ?", zone.ID, ChangeStatePending).Find(&held).Error; err != nil {
+		t.Fatal(err)
+	}
+	if held.Operation != ChangeOperationVariables {
+		t.Fatal("Unexpected change request", held)
+	}
+	if _, errs := ApproveChange(held.ID); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	updated, _ := GetStore().GetZone(zone.ID)
+	if updated.Variables != "office=192.0.2.1" {
+		t.Fatal("Approved variables weren't set", updated.Variables)
+	}
+
+	// Rendered values of the reserved apex can't be changed with the API token
+	if _, errs := SetZoneReservedNames(zone.ID, []string{"@"}); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if recorder = call(`{"variables": "office=10.0.0.5"}`); recorder.Code != http.StatusForbidden {
+		t.Error("Reserved apex was changed by the variables", recorder.Code, recorder.Body.String())
+	}
+	if recorder = call(`{"variables": "office=192.0.2.1,cdn=shop.cdn.example.net."}`); recorder.Code != http.StatusOK {
+		t.Error("Variables which don't change the apex weren't set", recorder.Code, recorder.Body.String())
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Value of LOC records in anonymized zones, the position of the customer's servers isn't kept
+const AnonymizedLOCValue = "0 0 0.000 N 0 0 0.000 E 0.00m"
+
+// Anonymizer replaces customer-identifying data of zones with generic data of the same structure, so real
+// zones can be attached to bug reports. One value is always replaced by the same one, records pointing at
+// each other still do. The key is random for every anonymizer, hashes can't be reversed by guessing.
+type Anonymizer struct {
+	key []byte
+}
+
+// NewAnonymizer returns anonymizer with a new random key
+func NewAnonymizer() (*Anonymizer, error) {
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	if err != nil {
+		return nil, err
+	}
+	return &Anonymizer{key: key}, nil
+}
+
+func (a *Anonymizer) digest(value string) []byte {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// Hex digest of the value cut to the length
+func (a *Anonymizer) hash(value string, length int) string {
+	return hex.EncodeToString(a.digest(value))[:length]
+}
+
+// Underscored labels (_dmarc, _sip._tcp) and the wildcard say what the record is for, they are kept
+func (a *Anonymizer) label(label string) string {
+	if label == "" || label == "*" || label == "@" || strings.HasPrefix(label, "_") {
+		return label
+	}
+	return "h" + a.hash(strings.ToLower(label), 9)
+}
+
+// Name replaces labels of the relative or fully qualified name, the top level domain of fully qualified
+// names is kept. Relative names map to the same labels as the zone's part of fully qualified ones.
+func (a *Anonymizer) Name(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return a.Domain(strings.TrimSuffix(name, ".")) + "."
+	}
+
+	labels := strings.Split(name, ".")
+	for i := range labels {
+		labels[i] = a.label(labels[i])
+	}
+	return strings.Join(labels, ".")
+}
+
+// Domain replaces labels of the domain except the top level domain
+func (a *Anonymizer) Domain(domain string) string {
+	labels := strings.Split(domain, ".")
+	for i := 0; i < len(labels)-1; i++ {
+		labels[i] = a.label(labels[i])
+	}
+	return strings.Join(labels, ".")
+}
+
+// Email masks the mailbox and replaces the domain
+func (a *Anonymizer) Email(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return a.text(email)
+	}
+	return "user-" + a.hash(strings.ToLower(email[:at]), 8) + "@" + a.Domain(email[at+1:])
+}
+
+// IP replaces the address with one of 198.18.0.0/15 (RFC 2544) or 2001:db8::/32 (RFC 3849), values which
+// aren't addresses are returned as they are
+func (a *Anonymizer) IP(value string) string {
+	parsed := net.ParseIP(strings.TrimSpace(value))
+	if parsed == nil {
+		return value
+	}
+
+	digest := a.digest(parsed.String())
+	if parsed.To4() != nil {
+		return net.IPv4(198, 18+digest[0]&1, digest[1], digest[2]).String()
+	}
+	address := net.IP(append([]byte{0x20, 0x01, 0x0d, 0xb8}, digest[:12]...))
+	return address.String()
+}
+
+// Comma separated addresses
+func (a *Anonymizer) ips(value string) string {
+	if value == "" {
+		return ""
+	}
+	parts := strings.Split(value, ",")
+	for i := range parts {
+		parts[i] = a.IP(parts[i])
+	}
+	return strings.Join(parts, ",")
+}
+
+// Free text is replaced by text of the same length, limits of the original still apply. TXT values are
+// free text too except DMARC and SPF records whose structure is kept.
+func (a *Anonymizer) text(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	var replaced string
+	for len(replaced) < len(value) {
+		replaced += hex.EncodeToString(a.digest(value + strconv.Itoa(len(replaced))))
+	}
+	return replaced[:len(value)]
+}
+
+// Targets of records, the apex and . for no target are kept
+func (a *Anonymizer) target(value string) string {
+	if value == "@" || value == "." {
+		return value
+	}
+	return a.Name(value)
+}
+
+// Only the scheme of URIs is kept
+func (a *Anonymizer) uri(value string) string {
+	parsed, err := url.Parse(value)
+	if err != nil || parsed.Scheme == "" {
+		return a.text(value)
+	}
+	if parsed.Host == "" {
+		return parsed.Scheme + ":" + a.hash(value, 10)
+	}
+	return parsed.Scheme + "://" + a.Domain(parsed.Hostname()) + "/"
+}
+
+// Reporting addresses of DMARC records are replaced, the policy is kept
+func (a *Anonymizer) dmarc(value string) string {
+	tags, err := parseDMARCTags(value)
+	if err != nil {
+		return a.text(value)
+	}
+
+	var parts []string
+	for _, tag := range tags {
+		if tag.Name == "rua" || tag.Name == "ruf" {
+			uris := strings.Split(tag.Value, ",")
+			for i, uri := range uris {
+				uri = strings.TrimSpace(uri)
+				size := ""
+				if limit := strings.LastIndex(uri, "!"); limit >= 0 {
+					uri, size = uri[:limit], uri[limit:]
+				}
+				if strings.HasPrefix(uri, "mailto:") {
+					uris[i] = "mailto:" + a.Email(strings.TrimPrefix(uri, "mailto:")) + size
+				} else {
+					uris[i] = a.uri(uri) + size
+				}
+			}
+			tag.Value = strings.Join(uris, ",")
+		}
+		parts = append(parts, tag.Name+"="+tag.Value)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Addresses and domains of SPF mechanisms are replaced, the mechanisms and qualifiers are kept
+func (a *Anonymizer) spf(value string) string {
+	terms := strings.Fields(value)
+	for i, term := range terms {
+		separator := strings.IndexAny(term, ":=")
+		if i == 0 || separator < 0 {
+			continue
+		}
+		mechanism, argument := term[:separator+1], term[separator+1:]
+		cidr := ""
+		if slash := strings.Index(argument, "/"); slash >= 0 {
+			argument, cidr = argument[:slash], argument[slash:]
+		}
+		if net.ParseIP(argument) != nil {
+			terms[i] = mechanism + a.IP(argument) + cidr
+		} else {
+			terms[i] = mechanism + a.Domain(argument) + cidr
+		}
+	}
+	return strings.Join(terms, " ")
+}
+
+// Record returns the record with anonymized name, value, comment and owner. Values referring to variables
+// are kept, the variables themselves are anonymized with the zone.
+func (a *Anonymizer) Record(record Record) Record {
+	record.Name = a.Name(record.Name)
+	record.Comment = a.text(record.Comment)
+	if record.Owner != "" {
+		record.Owner = "owner-" + a.hash(record.Owner, 8)
+	}
+	record.Resolved = a.ips(record.Resolved)
+	if hasVariables(record.Value) {
+		return record
+	}
+
+	switch strings.ToUpper(record.Type) {
+	case "A", "AAAA":
+		record.Value = a.IP(record.Value)
+	case "CNAME", "NS", "MX", "ALIAS", "PTR":
+		record.Value = a.target(record.Value)
+	case "SRV":
+		fields := strings.Fields(record.Value)
+		if len(fields) > 0 {
+			fields[len(fields)-1] = a.target(fields[len(fields)-1])
+		}
+		record.Value = strings.Join(fields, " ")
+	case "URI":
+		fields := strings.Fields(record.Value)
+		if len(fields) > 0 {
+			fields[len(fields)-1] = "\"" + a.uri(strings.Trim(fields[len(fields)-1], "\"")) + "\""
+		}
+		record.Value = strings.Join(fields, " ")
+	case "NAPTR":
+		fields, ok := naptrFields(record.Value)
+		if !ok {
+			record.Value = a.text(record.Value)
+			break
+		}
+		// The pattern is kept, the replacement of the regexp keeps its scheme, ex. sip:
+		if fields[4] != "" {
+			delimiter := fields[4][:1]
+			parts := strings.Split(fields[4], delimiter)
+			if len(parts) == 4 {
+				replacement := parts[2]
+				if colon := strings.Index(replacement, ":"); colon >= 0 {
+					parts[2] = replacement[:colon+1] + a.hash(replacement, 10)
+				} else {
+					parts[2] = a.hash(replacement, 10)
+				}
+				fields[4] = strings.Join(parts, delimiter)
+			}
+		}
+		record.Value = fields[0] + " " + fields[1] + " \"" + fields[2] + "\" \"" + fields[3] + "\" \"" +
+			fields[4] + "\" " + a.target(fields[5])
+	case "TXT":
+		if isDMARCName(record.Name) {
+			record.Value = a.dmarc(record.Value)
+		} else if strings.HasPrefix(strings.ToLower(record.Value), "v=spf1 ") {
+			record.Value = a.spf(record.Value)
+		} else {
+			record.Value = a.text(record.Value)
+		}
+	case "LOC":
+		record.Value = AnonymizedLOCValue
+	default:
+		record.Value = a.text(record.Value)
+	}
+
+	return record
+}
+
+// Zone returns copy of the zone with anonymized domain, records, emails, addresses, secrets and texts.
+// Types, TTLs, priorities, settings and states are kept.
+func (a *Anonymizer) Zone(zone Zone) Zone {
+	zone.Domain = a.Domain(zone.Domain)
+	zone.AbuseEmail = a.Email(zone.AbuseEmail)
+	zone.Notes = a.text(zone.Notes)
+	zone.DeployError = a.text(zone.DeployError)
+	zone.StandbyError = a.text(zone.StandbyError)
+	zone.RegistrationError = a.text(zone.RegistrationError)
+	zone.TransferIPs = a.ips(zone.TransferIPs)
+	zone.MonitorID = a.text(zone.MonitorID)
+	if zone.MonitorURL != "" {
+		zone.MonitorURL = a.uri(zone.MonitorURL)
+	}
+	if zone.TSIGSecret != "" {
+		zone.TSIGSecret = base64.StdEncoding.EncodeToString(a.digest(zone.TSIGSecret))
+	}
+
+	if zone.Tags != "" {
+		tags := strings.Split(zone.Tags, ",")
+		for i, tag := range tags {
+			tags[i] = "tag-" + a.hash(strings.TrimSpace(tag), 8)
+		}
+		zone.Tags = strings.Join(tags, ",")
+	}
+	if zone.ReservedNames != "" {
+		names := strings.Split(zone.ReservedNames, ",")
+		for i, name := range names {
+			names[i] = a.Name(strings.TrimSpace(name))
+		}
+		zone.ReservedNames = strings.Join(names, ",")
+	}
+	if zone.Variables != "" {
+		pairs := strings.Split(zone.Variables, ",")
+		for i, pair := range pairs {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			value := strings.TrimSpace(parts[1])
+			if net.ParseIP(value) != nil {
+				value = a.IP(value)
+			} else {
+				value = a.target(value)
+			}
+			pairs[i] = parts[0] + "=" + value
+		}
+		zone.Variables = strings.Join(pairs, ",")
+	}
+
+	records := make([]Record, len(zone.Records))
+	for i, record := range zone.Records {
+		records[i] = a.Record(record)
+	}
+	zone.Records = records
+
+	return zone
+}
+
+func anonymizeCommand(args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: dnsapi anonymize [file]")
+	}
+
+	anonymizer, err := NewAnonymizer()
+	if err != nil {
+		return err
+	}
+
+	output := os.Stdout
+	if len(args) == 1 {
+		output, err = os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer output.Close()
+	}
+
+	return StreamZones(output, "", 0, anonymizer, func(zones []Zone) {})
+}
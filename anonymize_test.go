@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnonymizer_Zone(t *testing.T) {
+	anonymizer, err := NewAnonymizer()
+	assert.NoError(t, err)
+
+	zone := Zone{
+		Domain:      "shop.example.com",
+		AbuseEmail:  "john.doe@example.com",
+		Tags:        "acme,vip",
+		Notes:       "Customer John Doe",
+		TransferIPs: "203.0.113.10",
+		TSIGSecret:  "c2VjcmV0",
+		Variables:   "cdn=shop.cdn.example.net.,origin=203.0.113.1",
+		Records: []Record{
+			{Name: "@", TTL: 300, Type: "A", Value: "203.0.113.1"},
+			{Name: "www", TTL: 300, Type: "A", Value: "203.0.113.1", Comment: "Web of John"},
+			{Name: "www", TTL: 300, Type: "AAAA", Value: "2001:db8:1::1"},
+			{Name: "blog", TTL: 600, Type: "CNAME", Value: "www.shop.example.com."},
+			{Name: "cdn", TTL: 600, Type: "CNAME", Value: "{{cdn}}"},
+			{Name: "@", TTL: 300, Type: "MX", Prio: 10, Value: "mail"},
+			{Name: "_dmarc", TTL: 300, Type: "TXT", Value: "v=DMARC1; p=none; rua=mailto:john@example.com!10m"},
+			{Name: "@", TTL: 300, Type: "TXT", Value: "v=spf1 ip4:203.0.113.0/24 include:_spf.example.com -all"},
+			{Name: "@", TTL: 300, Type: "TXT", Value: "site-verification=john-doe"},
+			{Name: "_sip._tcp", TTL: 300, Type: "SRV", Prio: 10, Value: "10 5 5060 sip.shop.example.com."},
+			{Name: "_http._tcp", TTL: 300, Type: "URI", Prio: 10, Value: "10 1 \"https://www.example.com/john\""},
+			{Name: "@", TTL: 300, Type: "NAPTR", Value: "100 10 \"U\" \"E2U+sip\" \"!^.*$!sip:john@example.com!\" ."},
+			{Name: "office", TTL: 300, Type: "LOC", Value: "50 5 N 14 25 E 200m"},
+		},
+	}
+
+	anonymized := anonymizer.Zone(zone)
+	data, err := json.Marshal(anonymized)
+	assert.NoError(t, err)
+	for _, identifying := range []string{"shop", "example", "john", "John", "203.0.113", "2001:db8:1::", "acme", "c2VjcmV0"} {
+		assert.NotContains(t, string(data), identifying)
+	}
+
+	domain := anonymized.Domain
+	assert.True(t, strings.HasSuffix(domain, ".com"), domain)
+	assert.Len(t, strings.Split(domain, "."), 3)
+	assert.Equal(t, domain, anonymizer.Domain("Shop.Example.com"), "Same domain, same hash")
+	assert.Equal(t, "user-", anonymized.AbuseEmail[:5])
+	assert.True(t, strings.HasSuffix(anonymized.AbuseEmail, "@"+anonymizer.Domain("example.com")))
+	assert.Len(t, strings.Split(anonymized.Tags, ","), 2)
+	assert.Len(t, anonymized.Notes, len(zone.Notes))
+	assert.NoError(t, ValidateVariables(anonymized.Variables))
+
+	records := anonymized.Records
+	if !assert.Len(t, records, len(zone.Records)) {
+		return
+	}
+	for i, record := range records {
+		if !hasVariables(record.Value) {
+			assert.NoError(t, record.Validate(), record.Render())
+		}
+		assert.Equal(t, zone.Records[i].Type, record.Type)
+		assert.Equal(t, zone.Records[i].TTL, record.TTL)
+		assert.Equal(t, zone.Records[i].Prio, record.Prio)
+	}
+
+	assert.Equal(t, "@", records[0].Name)
+	assert.Equal(t, records[0].Value, records[1].Value, "Same address, same replacement")
+	assert.True(t, (&net.IPNet{IP: net.IPv4(198, 18, 0, 0), Mask: net.CIDRMask(15, 32)}).Contains(net.ParseIP(records[0].Value)))
+	assert.True(t, strings.HasPrefix(records[2].Value, "2001:db8:"), records[2].Value)
+	assert.Len(t, records[1].Comment, len(zone.Records[1].Comment))
+	assert.Equal(t, records[1].Name+"."+domain+".", records[3].Value, "Target in the zone")
+	assert.Equal(t, "{{cdn}}", records[4].Value)
+	assert.Equal(t, "_dmarc", records[6].Name)
+	assert.Equal(t, "v=DMARC1; p=none; rua=mailto:"+anonymizer.Email("john@example.com")+"!10m", records[6].Value)
+	assert.Equal(t, "v=spf1 ip4:"+anonymizer.IP("203.0.113.0")+"/24 include:_spf."+anonymizer.Domain("example.com")+" -all", records[7].Value)
+	assert.Len(t, records[8].Value, len(zone.Records[8].Value))
+	assert.Equal(t, "_sip._tcp", records[9].Name)
+	assert.True(t, strings.HasPrefix(records[9].Value, "10 5 5060 "))
+	assert.Contains(t, records[10].Value, "\"https://")
+	assert.Contains(t, records[11].Value, "!^.*$!sip:")
+	assert.Equal(t, AnonymizedLOCValue, records[12].Value)
+
+	other, err := NewAnonymizer()
+	assert.NoError(t, err)
+	assert.NotEqual(t, domain, other.Domain(zone.Domain), "Random key")
+}
+
+func TestStreamZones_anonymize(t *testing.T) {
+	config.TTL = 300
+	defer func() { config.TTL = 0 }()
+
+	zone, errs := NewZone("BV-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	anonymizer, err := NewAnonymizer()
+	assert.NoError(t, err)
+	var output bytes.Buffer
+	// The zone is the first one after the previous ID
+	assert.NoError(t, StreamZones(&output, strconv.Itoa(int(zone.ID)-1), 1, anonymizer, func(zones []Zone) {}))
+
+	var line MirrorLine
+	assert.NoError(t, json.Unmarshal(output.Bytes(), &line))
+	assert.Equal(t, zone.ID, line.Zone.ID)
+	assert.Equal(t, anonymizer.Domain(zone.Domain), line.Zone.Domain)
+	assert.NotContains(t, output.String(), "ohphiuhi")
+	assert.NotContains(t, output.String(), "192.0.2.1")
+	if assert.Len(t, line.Zone.Records, 1) {
+		assert.Equal(t, 300, line.Zone.Records[0].TTL)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Longest owner label of records
+const MaxOwnerLength = 64
+
+// ApplyRequest is the desired state of all records of one owner
+type ApplyRequest struct {
+	Owner   string   `json:"owner"`
+	Records []Record `json:"records"`
+}
+
+// ApplyResult are changes done (or planned in dry run) to converge records of the owner to the desired state
+type ApplyResult struct {
+	Owner     string   `json:"owner"`
+	DryRun    bool     `json:"dry_run"`
+	Created   []Record `json:"created"`
+	Deleted   []Record `json:"deleted"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// PlanApply computes minimal changes making records of the owner equal to the desired records. Records
+// of other owners and manual records (without owner) are kept. RRsets containing records that aren't the
+// owner's can't be taken over. Returns the zone and all its records after the changes.
+func PlanApply(zoneId uint, owner string, desired []Record) (*Zone, []Record, *ApplyResult, []error) {
+	var zone Zone
+
+	owner = strings.TrimSpace(owner)
+	if owner == "" || len(owner) > MaxOwnerLength {
+		return nil, nil, nil, []error{errors.New("owner has to be 1 to 64 characters long")}
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, nil, nil, []error{err}
+	}
+
+	result := &ApplyResult{Owner: owner, Created: []Record{}, Deleted: []Record{}}
+	var records []Record
+	owned := make(map[string][]Record)
+	foreign := make(map[string]bool)
+	for _, record := range zone.Records {
+		if record.Owner == owner {
+			owned[recordKey(&record)] = append(owned[recordKey(&record)], record)
+			continue
+		}
+		foreign[record.Name+" "+record.Type] = true
+		records = append(records, record)
+	}
+
+	var errs []error
+	for _, record := range desired {
+		if record.TTL == 0 {
+			record.TTL = zone.TypeTTL(record.Type)
+		}
+		record.ID = 0
+		record.ZoneId = zone.ID
+		record.Owner = owner
+		record.Normalize(zone.Domain)
+
+		if foreign[record.Name+" "+record.Type] {
+			errs = append(errs, errors.New(record.Type+" "+record.Name+": RRset has records which aren't owned by "+owner))
+			continue
+		}
+
+		key := recordKey(&record)
+		if len(owned[key]) > 0 {
+			records = append(records, owned[key][0])
+			owned[key] = owned[key][1:]
+			result.Unchanged++
+			continue
+		}
+		records = append(records, record)
+		result.Created = append(result.Created, record)
+	}
+	if len(errs) > 0 {
+		return nil, nil, nil, errs
+	}
+
+	for _, record := range zone.Records {
+		key := recordKey(&record)
+		if record.Owner == owner && len(owned[key]) > 0 && owned[key][0].ID == record.ID {
+			result.Deleted = append(result.Deleted, record)
+			owned[key] = owned[key][1:]
+		}
+	}
+
+	return &zone, records, result, nil
+}
+
+// ApplyZoneRecords converges records of the owner to the desired records in one transaction, see PlanApply.
+// Nothing is changed in dry run, the zone is only validated with the changes.
+func ApplyZoneRecords(zoneId uint, owner string, desired []Record, dryRun bool) (*ApplyResult, []error) {
+	zone, records, result, errs := PlanApply(zoneId, owner, desired)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	result.DryRun = dryRun
+
+	if dryRun {
+		zone.Records = records
+		errs = zone.Validate()
+		if len(errs) > 0 {
+			return nil, errs
+		}
+		return result, nil
+	}
+	if len(result.Created) == 0 && len(result.Deleted) == 0 {
+		return result, nil
+	}
+
+	_, errs = ReplaceRecords(zoneId, records)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	var names []string
+	for _, record := range append(result.Created, result.Deleted...) {
+		names = append(names, record.Name)
+	}
+	syncWWWAfterChange(zoneId, names...)
+
+	return result, nil
+}
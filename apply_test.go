@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyZoneRecords(t *testing.T) {
+	config.TTL = 300
+	defer func() { config.TTL = 0 }()
+
+	zone, errs := NewZone("AT-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	manual, errs := NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	desired := []Record{
+		{Name: "app", Type: "A", Value: "192.0.2.10"},
+		{Name: "app", Type: "A", Value: "192.0.2.11"},
+		{Name: "api." + zone.Domain + ".", TTL: 600, Type: "CNAME", Value: "app"},
+	}
+	result, errs := ApplyZoneRecords(zone.ID, "external-dns", desired, false)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Len(t, result.Created, 3)
+	assert.Len(t, result.Deleted, 0)
+	assert.Equal(t, "api", result.Created[2].Name)
+	assert.Equal(t, 300, result.Created[0].TTL)
+
+	var records []Record
+	GetDatabaseConnection().Where("zone_id = ? AND owner = ?", zone.ID, "external-dns").Find(&records)
+	assert.Len(t, records, 3)
+	kept := records[0]
+
+	// Only the difference is changed, records which stay keep their IDs
+	desired = []Record{{Name: "app", Type: "A", Value: "192.0.2.10"}}
+	result, errs = ApplyZoneRecords(zone.ID, "external-dns", desired, true)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.True(t, result.DryRun)
+	assert.Len(t, result.Deleted, 2)
+	GetDatabaseConnection().Where("zone_id = ? AND owner = ?", zone.ID, "external-dns").Find(&records)
+	assert.Len(t, records, 3)
+
+	result, errs = ApplyZoneRecords(zone.ID, "external-dns", desired, false)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, 1, result.Unchanged)
+	assert.Len(t, result.Created, 0)
+	assert.Len(t, result.Deleted, 2)
+
+	GetDatabaseConnection().Where("zone_id = ?", zone.ID).Order("id").Find(&records)
+	assert.Len(t, records, 2)
+	assert.Equal(t, manual.ID, records[0].ID)
+	assert.Equal(t, kept.ID, records[1].ID)
+
+	// Manual records and records of other owners can't be taken over
+	_, errs = ApplyZoneRecords(zone.ID, "external-dns", []Record{{Name: "www", Type: "A", Value: "192.0.2.2"}}, false)
+	assert.Len(t, errs, 1)
+	_, errs = ApplyZoneRecords(zone.ID, "other", []Record{{Name: "app", Type: "A", Value: "192.0.2.12"}}, false)
+	assert.Len(t, errs, 1)
+	_, errs = ApplyZoneRecords(zone.ID, "", desired, false)
+	assert.Len(t, errs, 1)
+
+	// Empty desired state removes all records of the owner
+	result, errs = ApplyZoneRecords(zone.ID, "external-dns", nil, false)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Len(t, result.Deleted, 1)
+	GetDatabaseConnection().Where("zone_id = ?", zone.ID).Find(&records)
+	assert.Len(t, records, 1)
+}
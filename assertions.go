@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	// Every answer has to be one of expected values
+	AssertionModeOneOf = "one_of"
+	// Answers have to include all expected values
+	AssertionModeIncludes = "includes"
+
+	// Timeout of one assertion's DNS query
+	AssertionTimeout = 5 * time.Second
+)
+
+// Assertion is user defined expectation about live DNS data of a zone, ex. "www must resolve to one of these IPs"
+type Assertion struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ZoneId uint `json:"zone_id" sql:"index"`
+
+	Name     string `json:"name"`     // Name relative to the zone, @ for apex
+	Type     string `json:"type"`     // A, AAAA, CNAME, MX, NS, TXT
+	Expected string `json:"expected"` // Expected values separated by comma
+	Mode     string `json:"mode"`     // one_of or includes
+
+	// Result of the last check
+	CheckedAt *time.Time `json:"checked_at"`
+	Failing   bool       `json:"failing"`
+	Message   string     `json:"message"`
+}
+
+// Validates the assertion
+func (a *Assertion) Validate() error {
+	if a.Name == "" {
+		return errors.New("name of the assertion can't be empty, use @ for apex")
+	}
+	if a.Type != "A" && a.Type != "AAAA" && a.Type != "CNAME" && a.Type != "MX" && a.Type != "NS" && a.Type != "TXT" {
+		return errors.New("assertions support only A, AAAA, CNAME, MX, NS and TXT types")
+	}
+	if a.Mode != AssertionModeOneOf && a.Mode != AssertionModeIncludes {
+		return errors.New("mode of the assertion has to be " + AssertionModeOneOf + " or " + AssertionModeIncludes)
+	}
+	if len(a.ExpectedValues()) == 0 {
+		return errors.New("assertion needs at least one expected value")
+	}
+
+	return nil
+}
+
+// Returns normalized expected values
+func (a *Assertion) ExpectedValues() []string {
+	var values []string
+
+	for _, value := range strings.Split(a.Expected, ",") {
+		value = normalizeAssertionValue(a.Type, value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// Returns FQDN which is queried
+func (a *Assertion) FQDN(zone *Zone) string {
+	if a.Name == "@" {
+		return zone.Domain + "."
+	}
+	if strings.HasSuffix(a.Name, ".") {
+		return a.Name
+	}
+	return a.Name + "." + zone.Domain + "."
+}
+
+// Labels used in metrics
+func (a *Assertion) metricLabels(zone *Zone) map[string]string {
+	return map[string]string{
+		"zone": zone.Domain,
+		"name": a.Name,
+		"type": a.Type,
+	}
+}
+
+// Hostnames are compared without the trailing dot and in lower case
+func normalizeAssertionValue(recordType string, value string) string {
+	value = strings.TrimSpace(value)
+	if recordType == "TXT" {
+		return value
+	}
+	if recordType == "A" || recordType == "AAAA" {
+		ip := net.ParseIP(value)
+		if ip != nil {
+			return ip.String()
+		}
+	}
+	return strings.ToLower(strings.TrimSuffix(value, "."))
+}
+
+// Compares answers from DNS with expected values, returns empty string if they match otherwise the reason why not
+func evaluateAssertion(mode string, expected []string, answers []string) string {
+	if len(answers) == 0 {
+		return "no answer"
+	}
+
+	isIn := func(value string, values []string) bool {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+
+	var missing []string
+	if mode == AssertionModeOneOf {
+		for _, answer := range answers {
+			if !isIn(answer, expected) {
+				missing = append(missing, answer)
+			}
+		}
+		if len(missing) > 0 {
+			return "unexpected values: " + strings.Join(missing, ", ")
+		}
+	} else {
+		for _, value := range expected {
+			if !isIn(value, answers) {
+				missing = append(missing, value)
+			}
+		}
+		if len(missing) > 0 {
+			return "missing values: " + strings.Join(missing, ", ")
+		}
+	}
+
+	return ""
+}
+
+// Returns resolver used for the checks
+func assertionResolver() *net.Resolver {
+	if config.AssertionResolver == "" {
+		return net.DefaultResolver
+	}
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, config.AssertionResolver)
+		},
+	}
+}
+
+// Asks DNS for normalized values of the name and type
+func lookupAssertion(fqdn string, recordType string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), AssertionTimeout)
+	defer cancel()
+
+	resolver := assertionResolver()
+	var answers []string
+
+	switch recordType {
+	case "A", "AAAA":
+		addrs, err := resolver.LookupIPAddr(ctx, fqdn)
+		if err != nil {
+			return nil, err
+		}
+		for _, addr := range addrs {
+			isV4 := addr.IP.To4() != nil
+			if (recordType == "A") == isV4 {
+				answers = append(answers, addr.IP.String())
+			}
+		}
+	case "CNAME":
+		cname, err := resolver.LookupCNAME(ctx, fqdn)
+		if err != nil {
+			return nil, err
+		}
+		// LookupCNAME returns the name itself when there is no CNAME
+		if !strings.EqualFold(cname, fqdn) {
+			answers = append(answers, cname)
+		}
+	case "MX":
+		mxs, err := resolver.LookupMX(ctx, fqdn)
+		if err != nil {
+			return nil, err
+		}
+		for _, mx := range mxs {
+			answers = append(answers, mx.Host)
+		}
+	case "NS":
+		nss, err := resolver.LookupNS(ctx, fqdn)
+		if err != nil {
+			return nil, err
+		}
+		for _, ns := range nss {
+			answers = append(answers, ns.Host)
+		}
+	case "TXT":
+		txts, err := resolver.LookupTXT(ctx, fqdn)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, txts...)
+	}
+
+	for i := range answers {
+		answers[i] = normalizeAssertionValue(recordType, answers[i])
+	}
+	sort.Strings(answers)
+
+	return answers, nil
+}
+
+// Check verifies the assertion against live DNS and updates its status
+func (a *Assertion) Check(zone *Zone) {
+	message := ""
+
+	answers, err := lookupAssertion(a.FQDN(zone), a.Type)
+	if err != nil {
+		message = err.Error()
+	} else {
+		message = evaluateAssertion(a.Mode, a.ExpectedValues(), answers)
+	}
+
+	now := time.Now().UTC()
+	a.CheckedAt = &now
+	a.Failing = message != ""
+	a.Message = message
+}
+
+// Create a new assertion
+func NewAssertion(zoneId uint, name string, recordType string, expected []string, mode string) (*Assertion, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	assertion := Assertion{
+		ZoneId:   zone.ID,
+		Name:     name,
+		Type:     strings.ToUpper(recordType),
+		Expected: strings.Join(expected, ","),
+		Mode:     mode,
+	}
+	if assertion.Mode == "" {
+		assertion.Mode = AssertionModeOneOf
+	}
+
+	err = assertion.Validate()
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Create(&assertion).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &assertion, nil
+}
+
+// Delete existing assertion
+func DeleteAssertion(zoneId uint, assertionId uint) error {
+	var assertion Assertion
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("zone_id = ? AND id = ?", zoneId, assertionId).Find(&assertion).Error
+	if err != nil {
+		return err
+	}
+
+	err = db.Where("id = ?", assertion.ZoneId).Find(&zone).Error
+	if err == nil {
+		MetricsDelete("dnsapi_assertion_failing", assertion.metricLabels(&zone))
+	}
+
+	return db.Where("id = ?", assertionId).Delete(&Assertion{}).Error
+}
+
+// CheckAssertions verifies all assertions, saves results, updates metrics and notifies about changes via webhook
+func CheckAssertions() error {
+	var assertions []Assertion
+
+	db := GetDatabaseConnection()
+	err := db.Find(&assertions).Error
+	if err != nil {
+		return err
+	}
+
+	zones := make(map[uint]*Zone)
+
+	for _, assertion := range assertions {
+		zone, ok := zones[assertion.ZoneId]
+		if !ok {
+			zone = &Zone{}
+			err = db.Where("id = ?", assertion.ZoneId).Find(zone).Error
+			if gorm.IsRecordNotFoundError(err) {
+				// Assertions of a missing zone don't stop the others
+				log.Warnf("assertion " + strconv.Itoa(int(assertion.ID)) + ": zone " + strconv.Itoa(int(assertion.ZoneId)) + " doesn't exist")
+				zone = nil
+			} else if err != nil {
+				return err
+			}
+			zones[assertion.ZoneId] = zone
+		}
+		if zone == nil {
+			continue
+		}
+
+		wasFailing := assertion.Failing
+		assertion.Check(zone)
+
+		err = db.Model(&assertion).Updates(map[string]interface{}{
+			"checked_at": assertion.CheckedAt,
+			"failing":    assertion.Failing,
+			"message":    assertion.Message,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		labels := assertion.metricLabels(zone)
+		MetricsCounterAdd("dnsapi_assertion_checks_total", "Number of performed assertion checks", nil, 1)
+		if assertion.Failing {
+			MetricsCounterAdd("dnsapi_assertion_failures_total", "Number of failed assertion checks", nil, 1)
+			MetricsGaugeSet("dnsapi_assertion_failing", "1 if the last check of the assertion failed", labels, 1)
+		} else {
+			MetricsGaugeSet("dnsapi_assertion_failing", "1 if the last check of the assertion failed", labels, 0)
+		}
+
+		if assertion.Failing && !wasFailing {
+			SendWebhook("assertion.failed", assertion)
+		} else if !assertion.Failing && wasFailing {
+			SendWebhook("assertion.recovered", assertion)
+		}
+	}
+
+	return nil
+}
+
+// RunAssertionsScheduler checks assertions every config.AssertionInterval seconds, it's supposed to run as goroutine
+func RunAssertionsScheduler() {
+	ticker := time.NewTicker(time.Duration(config.AssertionInterval) * time.Second)
+
+	for range ticker.C {
+		err := CheckAssertions()
+		if err != nil {
+			log.Errorf("assertions: " + err.Error())
+		}
+	}
+}
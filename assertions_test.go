@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAssertion_Validate(t *testing.T) {
+	assertion := Assertion{Name: "www", Type: "A", Expected: "1.2.3.4, 1.2.3.5", Mode: AssertionModeOneOf}
+	if err := assertion.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	assertion = Assertion{Name: "www", Type: "SRV", Expected: "1.2.3.4", Mode: AssertionModeOneOf}
+	if err := assertion.Validate(); err == nil {
+		t.Error("unsupported type accepted")
+	}
+
+	assertion = Assertion{Name: "www", Type: "A", Expected: " , ", Mode: AssertionModeOneOf}
+	if err := assertion.Validate(); err == nil {
+		t.Error("assertion without expected values accepted")
+	}
+}
+
+func TestEvaluateAssertion(t *testing.T) {
+	assertion := Assertion{Name: "@", Type: "MX", Expected: "Mail.Rosti.cz.", Mode: AssertionModeIncludes}
+
+	if message := evaluateAssertion(assertion.Mode, assertion.ExpectedValues(), []string{"mail.rosti.cz", "mail2.rosti.cz"}); message != "" {
+		t.Error(message)
+	}
+	if message := evaluateAssertion(assertion.Mode, assertion.ExpectedValues(), []string{"mail2.rosti.cz"}); message != "missing values: mail.rosti.cz" {
+		t.Error("Got", message)
+	}
+	if message := evaluateAssertion(AssertionModeOneOf, []string{"1.2.3.4"}, []string{"1.2.3.4", "5.6.7.8"}); message != "unexpected values: 5.6.7.8" {
+		t.Error("Got", message)
+	}
+	if message := evaluateAssertion(AssertionModeOneOf, []string{"1.2.3.4"}, nil); message != "no answer" {
+		t.Error("Got", message)
+	}
+}
+
+func TestNewAssertion(t *testing.T) {
+	zone, errs := NewZone("I-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	assertion, errs := NewAssertion(zone.ID, "www", "a", []string{"1.2.3.4"}, "")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if assertion.Type != "A" || assertion.Mode != AssertionModeOneOf {
+		t.Error("Assertion is not normalized", assertion)
+	}
+	if assertion.FQDN(zone) != "www.i-"+TEST_DOMAIN+"." {
+		t.Error("Wrong FQDN", assertion.FQDN(zone))
+	}
+
+	// Assertion of another zone isn't found
+	if err := DeleteAssertion(zone.ID+1000, assertion.ID); err == nil {
+		t.Error("Assertion was deleted through another zone")
+	}
+
+	err := DeleteAssertion(zone.ID, assertion.ID)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRenderMetrics(t *testing.T) {
+	MetricsGaugeSet("dnsapi_test", "Test gauge", map[string]string{"zone": "b"}, 2)
+	MetricsGaugeSet("dnsapi_test", "Test gauge", map[string]string{"zone": "a\""}, 1)
+	MetricsGaugeSet("dnsapi_test_other", "Another gauge", nil, 3)
+
+	output := RenderMetrics()
+	expected := `# HELP dnsapi_test Test gauge
+# TYPE dnsapi_test gauge
+dnsapi_test{zone="a\""} 1
+dnsapi_test{zone="b"} 2
+# HELP dnsapi_test_other Another gauge
+# TYPE dnsapi_test_other gauge
+dnsapi_test_other 3
+`
+	if !strings.Contains(output, expected) {
+		t.Error("Unexpected output", output)
+	}
+}
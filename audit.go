@@ -0,0 +1,275 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// AuditEntry is one record in the audit log of operations with zones
+type AuditEntry struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at" sql:"index"`
+
+	Action  string `json:"action" sql:"index"` // ex. zone.decommissioned
+	ZoneId  uint   `json:"zone_id" sql:"index"`
+	Domain  string `json:"domain"`
+	Message string `json:"message"`
+
+	// Chain of entries, changed or removed entry breaks hashes of all entries after it
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"` // SHA-256 of PrevHash and the entry, see AuditEntry.ComputeHash
+}
+
+// AuditBatch is a signature of the chain up to the last entry of the batch made by DNSAPI_AUDIT_SIGNING_KEY.
+// Entries removed from the end of the log are detected by batches pointing to them.
+type AuditBatch struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+
+	FirstEntryId uint   `json:"first_entry_id"`
+	LastEntryId  uint   `json:"last_entry_id"`
+	Hash         string `json:"hash"`      // Hash of the last entry
+	Signature    string `json:"signature"` // Base64 encoded Ed25519 signature of AuditBatch.SignedData
+}
+
+// AuditVerification is the result of the audit log verification, invalid entry or batch is the first broken one
+type AuditVerification struct {
+	Valid          bool   `json:"valid"`
+	Entries        int    `json:"entries"`
+	Batches        int    `json:"batches"`
+	InvalidEntryId uint   `json:"invalid_entry_id,omitempty"`
+	InvalidBatchId uint   `json:"invalid_batch_id,omitempty"`
+	Message        string `json:"message,omitempty"`
+	PublicKey      string `json:"public_key,omitempty"` // Base64 encoded Ed25519 key verifying the batches
+}
+
+// Entries are chained one by one
+var auditMutex sync.Mutex
+
+// ComputeHash returns hex encoded SHA-256 of the previous hash and fields of the entry except its ID.
+// Time is included in whole seconds because the database may not keep more.
+func (e *AuditEntry) ComputeHash() string {
+	data := e.PrevHash + "\n" +
+		strconv.FormatInt(e.CreatedAt.Unix(), 10) + "\n" +
+		e.Action + "\n" +
+		strconv.Itoa(int(e.ZoneId)) + "\n" +
+		e.Domain + "\n" +
+		e.Message
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// SignedData is what the signature of the batch covers
+func (b *AuditBatch) SignedData() []byte {
+	return []byte("dnsapi audit batch " + strconv.Itoa(int(b.FirstEntryId)) + "-" + strconv.Itoa(int(b.LastEntryId)) + " " + b.Hash)
+}
+
+// Returns Ed25519 key from the base64 encoded seed (32 bytes) or private key (64 bytes), nil if it's empty
+func parseAuditSigningKey(encoded string) (ed25519.PrivateKey, error) {
+	if encoded == "" {
+		return nil, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New("key has to be base64 encoded")
+	}
+	switch len(key) {
+	case ed25519.SeedSize:
+		return ed25519.NewKeyFromSeed(key), nil
+	case ed25519.PrivateKeySize:
+		return ed25519.PrivateKey(key), nil
+	}
+	return nil, errors.New("key has to be Ed25519 seed (32 bytes) or private key (64 bytes)")
+}
+
+// Audit writes a new entry into the audit log. Failure is only logged, the audited operation is already done.
+func Audit(action string, zone *Zone, message string) {
+	entry := AuditEntry{
+		Action:  action,
+		Message: message,
+	}
+	if zone != nil {
+		entry.ZoneId = zone.ID
+		entry.Domain = zone.Domain
+	}
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	db := GetDatabaseConnection()
+	var last AuditEntry
+	err := db.Order("id desc").Limit(1).Find(&last).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		log.Errorf("audit log entry " + action + ": " + err.Error())
+		return
+	}
+	entry.PrevHash = last.Hash
+	entry.CreatedAt = time.Now().Truncate(time.Second)
+	entry.Hash = entry.ComputeHash()
+
+	err = db.Create(&entry).Error
+	if err != nil {
+		log.Errorf("audit log entry " + action + ": " + err.Error())
+		return
+	}
+
+	err = signAuditBatch(false)
+	if err != nil {
+		log.Errorf("audit log batch: " + err.Error())
+	}
+}
+
+// Signs entries after the last batch if there are DNSAPI_AUDIT_BATCH_SIZE of them or at least one if forced.
+// Nothing is signed without DNSAPI_AUDIT_SIGNING_KEY.
+func signAuditBatch(force bool) error {
+	key, err := parseAuditSigningKey(config.AuditSigningKey)
+	if err != nil || key == nil {
+		return err
+	}
+
+	db := GetDatabaseConnection()
+	var previous AuditBatch
+	err = db.Order("id desc").Limit(1).Find(&previous).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	var entries []AuditEntry
+	err = db.Where("id > ?", previous.LastEntryId).Order("id").Find(&entries).Error
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 || (!force && len(entries) < config.AuditBatchSize) {
+		return nil
+	}
+
+	batch := AuditBatch{
+		FirstEntryId: entries[0].ID,
+		LastEntryId:  entries[len(entries)-1].ID,
+		Hash:         entries[len(entries)-1].Hash,
+	}
+	batch.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, batch.SignedData()))
+
+	return db.Create(&batch).Error
+}
+
+// SignAuditLog signs entries which aren't in any batch yet, ex. before the log is handed over as evidence
+func SignAuditLog() error {
+	if config.AuditSigningKey == "" {
+		return errors.New("DNSAPI_AUDIT_SIGNING_KEY is not set")
+	}
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	return signAuditBatch(true)
+}
+
+// VerifyAuditLog recomputes the hash chain of all entries and checks signatures of all batches
+func VerifyAuditLog() (*AuditVerification, error) {
+	var entries []AuditEntry
+	var batches []AuditBatch
+
+	db := GetReadDatabaseConnection()
+	err := db.Order("id").Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	err = db.Order("id").Find(&batches).Error
+	if err != nil {
+		return nil, err
+	}
+
+	verification := &AuditVerification{Valid: true, Entries: len(entries), Batches: len(batches)}
+	key, err := parseAuditSigningKey(config.AuditSigningKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "DNSAPI_AUDIT_SIGNING_KEY")
+	}
+	if key != nil {
+		verification.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	}
+
+	hashes := make(map[uint]string)
+	previousHash := ""
+	for _, entry := range entries {
+		if entry.PrevHash != previousHash {
+			verification.Valid = false
+			verification.InvalidEntryId = entry.ID
+			verification.Message = "entry doesn't follow the previous entry, an entry before it was removed or changed"
+			return verification, nil
+		}
+		if entry.ComputeHash() != entry.Hash {
+			verification.Valid = false
+			verification.InvalidEntryId = entry.ID
+			verification.Message = "entry was changed after it was written"
+			return verification, nil
+		}
+		hashes[entry.ID] = entry.Hash
+		previousHash = entry.Hash
+	}
+
+	for _, batch := range batches {
+		message := ""
+		if hashes[batch.LastEntryId] != batch.Hash {
+			message = "last entry of the batch was removed or changed"
+		} else if key == nil {
+			message = "signatures can't be checked without DNSAPI_AUDIT_SIGNING_KEY"
+		} else if signature, err := base64.StdEncoding.DecodeString(batch.Signature); err != nil ||
+			!ed25519.Verify(key.Public().(ed25519.PublicKey), batch.SignedData(), signature) {
+			message = "signature of the batch doesn't match"
+		}
+		if message != "" {
+			verification.Valid = false
+			verification.InvalidBatchId = batch.ID
+			verification.Message = message
+			return verification, nil
+		}
+	}
+
+	return verification, nil
+}
+
+// ChainAuditLog hashes entries written before entries were chained. It's done only while the log has no
+// hashes at all, unchained entries later in the log are reported by the verification.
+func ChainAuditLog() error {
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+
+	db := GetDatabaseConnection()
+	var chained int
+	err := db.Model(&AuditEntry{}).Where("hash <> ''").Count(&chained).Error
+	if err != nil || chained > 0 {
+		return err
+	}
+
+	var entries []AuditEntry
+	err = db.Order("id").Find(&entries).Error
+	if err != nil {
+		return err
+	}
+
+	previousHash := ""
+	for _, entry := range entries {
+		entry.PrevHash = previousHash
+		entry.Hash = entry.ComputeHash()
+		err = db.Model(&AuditEntry{}).Where("id = ?", entry.ID).Updates(map[string]interface{}{
+			"prev_hash": entry.PrevHash,
+			"hash":      entry.Hash,
+		}).Error
+		if err != nil {
+			return err
+		}
+		previousHash = entry.Hash
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyAuditLog(t *testing.T) {
+	seed := make([]byte, ed25519.SeedSize)
+	config.AuditSigningKey = base64.StdEncoding.EncodeToString(seed)
+	config.AuditBatchSize = 3
+	defer func() {
+		config.AuditSigningKey = ""
+		config.AuditBatchSize = 0
+	}()
+
+	db := GetDatabaseConnection()
+	zone := &Zone{ID: 1, Domain: "au-" + TEST_DOMAIN}
+	for i := 0; i < 4; i++ {
+		Audit("test.audit", zone, "entry")
+	}
+
+	var entries []AuditEntry
+	db.Where("action = ?", "test.audit").Order("id").Find(&entries)
+	assert.Len(t, entries, 4)
+	assert.Equal(t, entries[0].Hash, entries[1].PrevHash)
+	assert.Equal(t, entries[1].ComputeHash(), entries[1].Hash)
+
+	// Earlier entries of other tests are in the first batch too
+	var batch AuditBatch
+	db.Order("id desc").First(&batch)
+	assert.True(t, batch.LastEntryId >= entries[0].ID && batch.LastEntryId <= entries[3].ID)
+
+	verification, err := VerifyAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, verification.Valid, verification.Message)
+	assert.NotEmpty(t, verification.PublicKey)
+
+	// Entries after the last batch are signed on request
+	err = SignAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Order("id desc").First(&batch)
+	assert.Equal(t, entries[3].ID, batch.LastEntryId)
+
+	// Changed message breaks the chain
+	db.Model(&AuditEntry{}).Where("id = ?", entries[1].ID).Update("message", "changed")
+	verification, err = VerifyAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, verification.Valid)
+	assert.Equal(t, entries[1].ID, verification.InvalidEntryId)
+	db.Model(&AuditEntry{}).Where("id = ?", entries[1].ID).Update("message", "entry")
+
+	// Batch signed by another key
+	config.AuditSigningKey = base64.StdEncoding.EncodeToString(append(seed[1:], 1))
+	verification, err = VerifyAuditLog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, verification.Valid)
+	assert.NotZero(t, verification.InvalidBatchId)
+	assert.Equal(t, "signature of the batch doesn't match", verification.Message)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// How long we wait for zone transfer from another server
+const TransferTimeout = 30 * time.Second
+
+// Converts resource record into our record, false is returned for types we don't manage.
+// SOA and NS records of the apex are ours and they are skipped too.
+func recordFromRR(rr dns.RR, domain string) (Record, bool) {
+	header := rr.Header()
+	record := Record{
+		Name: header.Name,
+		TTL:  int(header.Ttl),
+		Type: dns.TypeToString[header.Rrtype],
+	}
+
+	switch value := rr.(type) {
+	case *dns.A:
+		record.Value = value.A.String()
+	case *dns.AAAA:
+		record.Value = value.AAAA.String()
+	case *dns.CNAME:
+		record.Value = value.Target
+	case *dns.MX:
+		record.Prio = int(value.Preference)
+		record.Value = value.Mx
+	case *dns.TXT:
+		record.Value = strings.Join(value.Txt, "")
+	case *dns.SRV:
+		record.Value = strconv.Itoa(int(value.Priority)) + " " + strconv.Itoa(int(value.Weight)) + " " +
+			strconv.Itoa(int(value.Port)) + " " + value.Target
+	case *dns.NS:
+		if strings.EqualFold(dns.Fqdn(header.Name), dns.Fqdn(domain)) {
+			return record, false
+		}
+		record.Value = value.Ns
+	case *dns.PTR:
+		record.Value = value.Ptr
+	case *dns.NAPTR:
+		record.Value = strconv.Itoa(int(value.Order)) + " " + strconv.Itoa(int(value.Preference)) + " \"" + value.Flags +
+			"\" \"" + value.Service + "\" \"" + value.Regexp + "\" " + value.Replacement
+	case *dns.LOC:
+		record.Value = strings.TrimSpace(strings.TrimPrefix(value.String(), value.Hdr.String()))
+	case *dns.URI:
+		record.Value = strconv.Itoa(int(value.Priority)) + " " + strconv.Itoa(int(value.Weight)) + " \"" + value.Target + "\""
+	default:
+		return record, false
+	}
+
+	record.Normalize(domain)
+	return record, true
+}
+
+// TransferZone downloads records of the domain from the server (ip or ip:port) by AXFR. Records of types
+// we don't manage are returned as skipped in presentation format.
+func TransferZone(domain string, server string) ([]Record, []string, error) {
+	return transferZone(domain, server, func() {})
+}
+
+// Transfers the zone like TransferZone, onRecord is called after every transferred record
+func transferZone(domain string, server string, onRecord func()) ([]Record, []string, error) {
+	var records []Record
+	var skipped []string
+
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	message := new(dns.Msg)
+	message.SetAxfr(dns.Fqdn(domain))
+
+	transfer := &dns.Transfer{
+		DialTimeout:  TransferTimeout,
+		ReadTimeout:  TransferTimeout,
+		WriteTimeout: TransferTimeout,
+	}
+	envelopes, err := transfer.In(message, server)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "zone transfer from "+server)
+	}
+
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, nil, errors.Wrap(envelope.Error, "zone transfer from "+server)
+		}
+
+		for _, rr := range envelope.RR {
+			record, ok := recordFromRR(rr, domain)
+			if !ok {
+				// Both SOAs at the beginning and at the end of the transfer
+				if rr.Header().Rrtype == dns.TypeSOA {
+					continue
+				}
+				if rr.Header().Rrtype == dns.TypeNS && strings.EqualFold(rr.Header().Name, dns.Fqdn(domain)) {
+					continue
+				}
+				skipped = append(skipped, rr.String())
+				continue
+			}
+			records = append(records, record)
+			onRecord()
+		}
+	}
+
+	return records, skipped, nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+// BindOptions are settings of zone's stanza in Bind's config. Name servers have their defaults,
+// non-empty options of the zone override them.
+type BindOptions struct {
+	KeyDirectory     string `json:"key_directory" yaml:"key_directory,omitempty"`         // Directory with DNSSEC keys
+	JournalDirectory string `json:"journal_directory" yaml:"journal_directory,omitempty"` // Directory of the zone's journal file
+	MaxJournalSize   string `json:"max_journal_size" yaml:"max_journal_size,omitempty"`   // ex. 10M, unlimited or default
+	LogChannel       string `json:"log_channel" yaml:"log_channel,omitempty"`             // Logging channel of the zone, only for custom templates
+}
+
+var bindDirectoryRegexp = regexp.MustCompile(`^/[A-Za-z0-9._/-]*$`)
+var journalSizeRegexp = regexp.MustCompile(`^([0-9]+[kKmMgG]?|unlimited|default)$`)
+var logChannelRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Validates the options, they are rendered into Bind's config so only safe characters are allowed
+func (o BindOptions) Validate() []error {
+	var errorsMsgs []error
+
+	if o.KeyDirectory != "" && !bindDirectoryRegexp.MatchString(o.KeyDirectory) {
+		errorsMsgs = append(errorsMsgs, errors.New(o.KeyDirectory+" is not a valid absolute path of key directory"))
+	}
+	if o.JournalDirectory != "" && !bindDirectoryRegexp.MatchString(o.JournalDirectory) {
+		errorsMsgs = append(errorsMsgs, errors.New(o.JournalDirectory+" is not a valid absolute path of journal directory"))
+	}
+	if o.MaxJournalSize != "" && !journalSizeRegexp.MatchString(o.MaxJournalSize) {
+		errorsMsgs = append(errorsMsgs, errors.New(o.MaxJournalSize+" is not a valid journal size, use ex. 10M, unlimited or default"))
+	}
+	if o.LogChannel != "" && !logChannelRegexp.MatchString(o.LogChannel) {
+		errorsMsgs = append(errorsMsgs, errors.New(o.LogChannel+" is not a valid name of log channel"))
+	}
+
+	return errorsMsgs
+}
+
+// Returns the options with empty fields taken from the defaults
+func (o BindOptions) withDefaults(defaults BindOptions) BindOptions {
+	if o.KeyDirectory == "" {
+		o.KeyDirectory = defaults.KeyDirectory
+	}
+	if o.JournalDirectory == "" {
+		o.JournalDirectory = defaults.JournalDirectory
+	}
+	if o.MaxJournalSize == "" {
+		o.MaxJournalSize = defaults.MaxJournalSize
+	}
+	if o.LogChannel == "" {
+		o.LogChannel = defaults.LogChannel
+	}
+	return o
+}
+
+// Options of the zone's stanza on given server, the server's defaults are used if it's in the inventory
+func (z *Zone) bindOptionsOn(server string) BindOptions {
+	if server == "" {
+		return z.BindOptions
+	}
+	nameServer := nameServerByAddress(server)
+	if nameServer == nil {
+		return z.BindOptions
+	}
+	return z.BindOptions.withDefaults(nameServer.BindOptions)
+}
+
+// Path of the zone's journal when the journal directory is set
+func (z *Zone) journalPath(options BindOptions) string {
+	if options.JournalDirectory == "" {
+		return ""
+	}
+	return strings.TrimSuffix(options.JournalDirectory, "/") + "/" + z.Domain + ".zone.jnl"
+}
+
+// Parsed custom stanza templates by their path
+var stanzaTemplates = struct {
+	sync.Mutex
+	parsed map[string]*template.Template
+}{parsed: make(map[string]*template.Template)}
+
+// Returns the template from the file, or the built-in one if the path is empty
+func stanzaTemplate(path string, builtin string) (*template.Template, error) {
+	if path == "" {
+		return template.New("").Parse(builtin)
+	}
+
+	stanzaTemplates.Lock()
+	defer stanzaTemplates.Unlock()
+
+	if tmpl, ok := stanzaTemplates.parsed[path]; ok {
+		return tmpl, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(path).Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+	stanzaTemplates.parsed[path] = tmpl
+
+	return tmpl, nil
+}
+
+// Renders the stanza with the template, panics like built-in templates if it can't be rendered
+func renderStanza(path string, builtin string, data interface{}) string {
+	tmpl, err := stanzaTemplate(path, builtin)
+	if err != nil {
+		panic(err)
+	}
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		panic(err)
+	}
+
+	return buf.String()
+}
+
+// ValidateStanzaTemplate checks the custom template can be read and parsed
+func ValidateStanzaTemplate(path string) error {
+	if path == "" {
+		return nil
+	}
+	_, err := stanzaTemplate(path, "")
+	return err
+}
+
+// SetZoneBindOptions sets options of the zone's stanza, the zone is marked as pending deploy
+func SetZoneBindOptions(zoneId uint, options BindOptions) (*Zone, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	errs := options.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	err = db.Model(&Zone{}).Where("id = ?", zone.ID).Updates(map[string]interface{}{
+		"key_directory":     options.KeyDirectory,
+		"journal_directory": options.JournalDirectory,
+		"max_journal_size":  options.MaxJournalSize,
+		"log_channel":       options.LogChannel,
+	}).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return nil, []error{err}
+	}
+	Audit("zone.bind_options_changed", &zone, "key directory \""+options.KeyDirectory+"\", journal directory \""+
+		options.JournalDirectory+"\", max journal size \""+options.MaxJournalSize+"\", log channel \""+options.LogChannel+"\"")
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
+
+// SetNameServerBindOptions sets default options of stanzas on the name server, it's applied by the next deploy of zones
+func SetNameServerBindOptions(nameServerId uint, options BindOptions) (*NameServer, []error) {
+	var nameServer NameServer
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", nameServerId).Find(&nameServer).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	nameServer.BindOptions = options
+	errs := nameServer.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	err = db.Model(&nameServer).Updates(map[string]interface{}{
+		"key_directory":     options.KeyDirectory,
+		"journal_directory": options.JournalDirectory,
+		"max_journal_size":  options.MaxJournalSize,
+		"log_channel":       options.LogChannel,
+	}).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &nameServer, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetZoneBindOptions(t *testing.T) {
+	zone, errs := NewZone("BI-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	_, errs = SetZoneBindOptions(zone.ID, BindOptions{KeyDirectory: "keys\"; };", MaxJournalSize: "big"})
+	assert.Len(t, errs, 2)
+
+	zone, errs = SetZoneBindOptions(zone.ID, BindOptions{KeyDirectory: "/var/lib/bind/keys", MaxJournalSize: "10M"})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, DeployStatePending, zone.DeployState)
+	assert.Contains(t, zone.RenderPrimary(), "key-directory \"/var/lib/bind/keys\";")
+	assert.Contains(t, zone.RenderPrimary(), "max-journal-size 10M;")
+	assert.Contains(t, zone.RenderSecondary(), "max-journal-size 10M;")
+	assert.NotContains(t, zone.RenderSecondary(), "journal \"")
+
+	// Defaults of the name server, zone's own options win
+	nameServer, errs := NewNameServer(NameServer{Hostname: "bi-ns.rosti.cz", IP: "10.0.9.1", Role: NameServerRoleSecondary})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteNameServer(nameServer.ID)
+	_, errs = SetNameServerBindOptions(nameServer.ID, BindOptions{JournalDirectory: "/var/cache/bind/journal/", MaxJournalSize: "unlimited", LogChannel: "zones"})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	stanza := zone.RenderSecondaryOn("10.0.9.1")
+	assert.Contains(t, stanza, "journal \"/var/cache/bind/journal/bi-"+TEST_DOMAIN+".zone.jnl\";")
+	assert.Contains(t, stanza, "max-journal-size 10M;")
+	_, errs = SetNameServerBindOptions(nameServer.ID, BindOptions{LogChannel: "zones log"})
+	assert.Len(t, errs, 1)
+
+	// Custom template gets the log channel
+	file, err := ioutil.TempFile("", "stanza")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(`zone "{{ .Domain }}" { type slave; masters { {{ .Masters }}; }; }; // log: {{ .LogChannel }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+	assert.NoError(t, ValidateStanzaTemplate(file.Name()))
+	assert.Error(t, ValidateStanzaTemplate(file.Name()+".missing"))
+
+	config.SecondaryStanza = file.Name()
+	defer func() {
+		config.SecondaryStanza = ""
+	}()
+	assert.Contains(t, zone.RenderSecondaryOn("bi-ns.rosti.cz"), "// log: zones")
+}
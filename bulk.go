@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Statuses of manifest rows
+const (
+	BulkStatusCreated = "created" // Zone is created and committed
+	BulkStatusWarning = "warning" // Zone is created but its commit failed or was queued
+	BulkStatusFailed  = "failed"  // Zone wasn't created
+)
+
+// ManifestRow describes one zone of the bulk creation
+type ManifestRow struct {
+	Domain   string   `json:"domain"`
+	Template string   `json:"template"` // ID or name of the template applied on the zone, optional
+	IP       string   `json:"ip"`       // Address of the apex A or AAAA record, optional
+	Tags     []string `json:"tags"`
+}
+
+// BulkRowResult is result of one manifest row
+type BulkRowResult struct {
+	Row     int      `json:"row"` // Starts at 1, header of CSV is not counted
+	Domain  string   `json:"domain"`
+	Status  string   `json:"status"`
+	ZoneId  uint     `json:"zone_id"` // 0 if the zone wasn't created
+	Message string   `json:"message"`
+	Errors  []string `json:"errors"`
+}
+
+// BulkResult is report of the bulk creation
+type BulkResult struct {
+	Created int             `json:"created"`
+	Failed  int             `json:"failed"`
+	Rows    []BulkRowResult `json:"rows"`
+}
+
+// ParseManifest reads JSON list of rows or CSV with domain,template,ip,tags columns, tags are separated
+// by spaces or semicolons. Header of the CSV is optional, empty lines and lines starting with # are skipped.
+func ParseManifest(content string) ([]ManifestRow, error) {
+	var rows []ManifestRow
+
+	if strings.HasPrefix(strings.TrimSpace(content), "[") {
+		err := json.Unmarshal([]byte(content), &rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "manifest")
+		}
+		return rows, nil
+	}
+
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	lines, err := reader.ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "manifest")
+	}
+
+	for i, fields := range lines {
+		if i == 0 && strings.ToLower(strings.TrimSpace(fields[0])) == "domain" {
+			continue
+		}
+		if len(fields) > 4 {
+			return nil, errors.New("manifest line " + strconv.Itoa(i+1) + " has more than 4 columns")
+		}
+		for len(fields) < 4 {
+			fields = append(fields, "")
+		}
+
+		tags := strings.FieldsFunc(fields[3], func(r rune) bool { return r == ' ' || r == ';' })
+		rows = append(rows, ManifestRow{
+			Domain:   strings.TrimSpace(fields[0]),
+			Template: strings.TrimSpace(fields[1]),
+			IP:       strings.TrimSpace(fields[2]),
+			Tags:     tags,
+		})
+	}
+
+	return rows, nil
+}
+
+// Finds the template by its ID or name
+func findTemplate(reference string) (uint, error) {
+	var template Template
+
+	db := GetDatabaseConnection()
+	query := db.Where("name = ?", reference)
+	if id, err := strconv.Atoi(reference); err == nil {
+		query = db.Where("id = ?", id)
+	}
+
+	err := query.First(&template).Error
+	if err == gorm.ErrRecordNotFound {
+		return 0, errors.New("template " + reference + " not found")
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return template.ID, nil
+}
+
+// Creates one zone of the manifest, the zone is removed again if it can't be filled
+func createManifestZone(tenantId uint, row ManifestRow) (*Zone, []error) {
+	var templateId uint
+	var err error
+
+	if row.Template != "" {
+		templateId, err = findTemplate(row.Template)
+		if err != nil {
+			return nil, []error{err}
+		}
+	}
+
+	recordType := "A"
+	if row.IP != "" {
+		ip := net.ParseIP(row.IP)
+		if ip == nil {
+			return nil, []error{errors.New(row.IP + " is not a valid IP address")}
+		}
+		if ip.To4() == nil {
+			recordType = "AAAA"
+		}
+	}
+
+	zone, errs := NewTenantZone(tenantId, row.Domain, row.Tags, "")
+	if len(errs) > 0 {
+		if zone != nil && zone.ID != 0 {
+			purgeZone(zone)
+		}
+		return nil, errs
+	}
+	created := zone
+
+	if templateId != 0 {
+		zone, errs = ApplyTemplate(zone.ID, templateId)
+		if len(errs) > 0 {
+			purgeZone(created)
+			return nil, errs
+		}
+	}
+
+	if row.IP != "" {
+		_, errs = NewRecord(zone.ID, "@", 0, recordType, 0, row.IP)
+		if len(errs) > 0 {
+			purgeZone(created)
+			return nil, errs
+		}
+	}
+
+	return zone, nil
+}
+
+// CreateZonesFromManifest creates and commits zones of the manifest. Rows are independent, failure of one row
+// doesn't stop the others and a failed row leaves nothing behind so the manifest can be run again.
+func CreateZonesFromManifest(tenantId uint, rows []ManifestRow) *BulkResult {
+	result := BulkResult{
+		Rows: []BulkRowResult{},
+	}
+
+	for i, row := range rows {
+		rowResult := BulkRowResult{
+			Row:    i + 1,
+			Domain: row.Domain,
+			Status: BulkStatusCreated,
+			Errors: []string{},
+		}
+
+		zone, errs := createManifestZone(tenantId, row)
+		if len(errs) > 0 {
+			rowResult.Status = BulkStatusFailed
+			for _, err := range errs {
+				rowResult.Errors = append(rowResult.Errors, err.Error())
+			}
+			result.Failed++
+			result.Rows = append(result.Rows, rowResult)
+			continue
+		}
+		rowResult.ZoneId = zone.ID
+		result.Created++
+
+		err := Commit(zone.ID)
+		if err != nil {
+			rowResult.Status = BulkStatusWarning
+			rowResult.Message = err.Error()
+		}
+
+		result.Rows = append(result.Rows, rowResult)
+	}
+
+	return &result
+}
+
+// Creates zones from the manifest file and prints the report
+func bulkCommand(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return errors.New("usage: dnsapi bulk <manifest file> [tenant id]")
+	}
+
+	var tenantId int
+	if len(args) == 2 {
+		var err error
+		tenantId, err = strconv.Atoi(args[1])
+		if err != nil {
+			return errors.New("tenant id has to be a number")
+		}
+	}
+
+	content, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	rows, err := ParseManifest(string(content))
+	if err != nil {
+		return err
+	}
+
+	SetNameServerIPs()
+
+	result := CreateZonesFromManifest(uint(tenantId), rows)
+
+	report, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.Stdout.Write(append(report, '\n'))
+
+	if result.Failed > 0 {
+		return errors.New(strconv.Itoa(result.Failed) + " of " + strconv.Itoa(len(rows)) + " zones failed")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	rows, err := ParseManifest("domain,template,ip,tags\n# parked\nexample.com,parking,1.2.3.4,parked;batch1\nexample.net\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Domain != "example.com" || rows[0].Template != "parking" || rows[0].IP != "1.2.3.4" ||
+		len(rows[0].Tags) != 2 || rows[0].Tags[1] != "batch1" || rows[1].Domain != "example.net" || rows[1].IP != "" {
+		t.Error("Unexpected CSV rows", rows)
+	}
+
+	rows, err = ParseManifest(`[{"domain": "example.com", "template": "1", "tags": ["parked"]}]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Template != "1" || rows[0].Tags[0] != "parked" {
+		t.Error("Unexpected JSON rows", rows)
+	}
+
+	if _, err := ParseManifest("example.com,parking,1.2.3.4,parked,extra"); err == nil {
+		t.Error("Row with too many columns passed")
+	}
+}
+
+func TestCreateZonesFromManifest(t *testing.T) {
+	config.SkipDeploy = true
+	config.TTL = 300
+	defer func() {
+		config.SkipDeploy = false
+		config.TTL = 0
+	}()
+
+	template, errs := NewTemplate("AE-parking", []TemplateRecord{{Name: "www", Type: "CNAME", Value: "@"}})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteTemplate(template.ID)
+
+	rows, err := ParseManifest("ae-1." + TEST_DOMAIN + ",AE-parking,1.2.3.4,parked\n" +
+		"ae-2." + TEST_DOMAIN + "," + strconv.Itoa(int(template.ID)) + ",2001:db8::1,\n" +
+		"ae-3." + TEST_DOMAIN + ",AE-parking,not-an-ip,\n" +
+		"ae-4." + TEST_DOMAIN + ",AE-missing,,\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := CreateZonesFromManifest(0, rows)
+	for _, row := range result.Rows {
+		if row.ZoneId != 0 {
+			defer purgeZone(&Zone{ID: row.ZoneId})
+		}
+	}
+
+	if result.Created != 2 || result.Failed != 2 || len(result.Rows) != 4 {
+		t.Fatal("Unexpected result", result)
+	}
+	if result.Rows[0].Status != BulkStatusCreated || result.Rows[1].Status != BulkStatusCreated ||
+		result.Rows[2].Status != BulkStatusFailed || result.Rows[3].Status != BulkStatusFailed {
+		t.Error("Unexpected statuses", result.Rows)
+	}
+
+	var zone Zone
+	err = GetDatabaseConnection().Where("id = ?", result.Rows[1].ZoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zone.Records) != 2 || zone.DeployState != DeployStateDeployed {
+		t.Error("Zone wasn't created from the template", zone)
+	}
+	for _, record := range zone.Records {
+		if record.Type != "CNAME" && (record.Name != "@" || record.Type != "AAAA") {
+			t.Error("Unexpected record", record)
+		}
+	}
+
+	var count int
+	err = GetDatabaseConnection().Model(&Zone{}).Where("domain = ?", "ae-3."+TEST_DOMAIN).Count(&count).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Error("Failed row left the zone behind")
+	}
+
+	// The manifest can be run again, existing zones fail
+	result = CreateZonesFromManifest(0, rows[:1])
+	if result.Failed != 1 {
+		t.Error("Existing zone was created again", result)
+	}
+}
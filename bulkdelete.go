@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// How long the confirmation token of a bulk delete preview is valid
+const BulkDeletePreviewTTL = 10 * time.Minute
+
+var (
+	ErrBulkDeleteNoFilter = errors.New("type or name_prefix has to be set")
+	ErrBulkDeleteToken    = errors.New("confirmation token is unknown or expired, preview the deletion again")
+	ErrBulkDeleteChanged  = errors.New("records matching the filter changed since the preview, preview the deletion again")
+)
+
+// BulkDeleteFilter selects records of the zone deleted together, empty fields don't filter
+type BulkDeleteFilter struct {
+	Type       string `json:"type"`
+	NamePrefix string `json:"name_prefix"` // Relative name starts with it, ex. _acme-challenge
+}
+
+func (f *BulkDeleteFilter) matches(record *Record) bool {
+	if f.Type != "" && !strings.EqualFold(f.Type, record.Type) {
+		return false
+	}
+	return strings.HasPrefix(record.Name, strings.ToLower(f.NamePrefix))
+}
+
+// BulkDeletePreview lists records which would be deleted, the deletion is done with its confirmation token
+type BulkDeletePreview struct {
+	ZoneId       uint             `json:"zone_id"`
+	Filter       BulkDeleteFilter `json:"filter"`
+	Records      []Record         `json:"records"`
+	Skipped      []Record         `json:"skipped"` // Matching records with reserved names, left alone without the admin token
+	ConfirmToken string           `json:"confirm_token"`
+	ExpiresAt    time.Time        `json:"expires_at"`
+}
+
+// Record IDs in stable order
+func (p *BulkDeletePreview) RecordIds() []uint {
+	ids := []uint{}
+	for _, record := range p.Records {
+		ids = append(ids, record.ID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Previews waiting for confirmation by their tokens, they live only in this process
+var bulkDeletePreviews = struct {
+	sync.Mutex
+	byToken map[string]*BulkDeletePreview
+}{byToken: make(map[string]*BulkDeletePreview)}
+
+// Finds records of the zone matching the filter, records with reserved names are skipped if skipReserved is set
+func matchBulkDelete(zoneId uint, filter BulkDeleteFilter, skipReserved bool) (*BulkDeletePreview, error) {
+	var zone Zone
+
+	if filter.Type == "" && filter.NamePrefix == "" {
+		return nil, ErrBulkDeleteNoFilter
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	preview := BulkDeletePreview{ZoneId: zone.ID, Filter: filter, Records: []Record{}, Skipped: []Record{}}
+	for _, record := range zone.SortedRecords() {
+		if !filter.matches(&record) {
+			continue
+		}
+		if skipReserved && zone.IsReservedName(record.Name) {
+			preview.Skipped = append(preview.Skipped, record)
+			continue
+		}
+		preview.Records = append(preview.Records, record)
+	}
+
+	return &preview, nil
+}
+
+// PreviewBulkDelete returns records of the zone matching the filter without deleting them. Its confirmation
+// token is valid for BulkDeletePreviewTTL and only for the same filter.
+func PreviewBulkDelete(zoneId uint, filter BulkDeleteFilter, skipReserved bool) (*BulkDeletePreview, error) {
+	preview, err := matchBulkDelete(zoneId, filter, skipReserved)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenBytes := make([]byte, 16)
+	_, err = rand.Read(tokenBytes)
+	if err != nil {
+		return nil, err
+	}
+	preview.ConfirmToken = hex.EncodeToString(tokenBytes)
+	preview.ExpiresAt = time.Now().UTC().Add(BulkDeletePreviewTTL)
+
+	bulkDeletePreviews.Lock()
+	defer bulkDeletePreviews.Unlock()
+	for token, previous := range bulkDeletePreviews.byToken {
+		if time.Now().After(previous.ExpiresAt) {
+			delete(bulkDeletePreviews.byToken, token)
+		}
+	}
+	bulkDeletePreviews.byToken[preview.ConfirmToken] = preview
+
+	return preview, nil
+}
+
+// ConfirmBulkDelete checks the token and returns the preview if the same records still match, the token
+// can't be used again. The caller deletes the records by DeleteRecords.
+func ConfirmBulkDelete(zoneId uint, filter BulkDeleteFilter, token string, skipReserved bool) (*BulkDeletePreview, error) {
+	bulkDeletePreviews.Lock()
+	preview, ok := bulkDeletePreviews.byToken[token]
+	delete(bulkDeletePreviews.byToken, token)
+	bulkDeletePreviews.Unlock()
+
+	if !ok || time.Now().After(preview.ExpiresAt) || preview.ZoneId != zoneId ||
+		!strings.EqualFold(preview.Filter.Type, filter.Type) || !strings.EqualFold(preview.Filter.NamePrefix, filter.NamePrefix) {
+		return nil, ErrBulkDeleteToken
+	}
+
+	current, err := matchBulkDelete(zoneId, filter, skipReserved)
+	if err != nil {
+		return nil, err
+	}
+	previewed, matching := preview.RecordIds(), current.RecordIds()
+	if len(previewed) != len(matching) {
+		return nil, ErrBulkDeleteChanged
+	}
+	for i := range previewed {
+		if previewed[i] != matching[i] {
+			return nil, ErrBulkDeleteChanged
+		}
+	}
+
+	return preview, nil
+}
+
+// DeleteRecords deletes records of the zone in one transaction, returns IDs of deleted records.
+// The zone has to be committed to deploy the change.
+func DeleteRecords(zoneId uint, recordIds []uint) ([]uint, error) {
+	var zone Zone
+	var records []Record
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(recordIds) == 0 {
+		return []uint{}, nil
+	}
+
+	err = db.Where("zone_id = ? AND id IN (?)", zoneId, recordIds).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	tx := db.Begin()
+	err = tx.Where("zone_id = ? AND id IN (?)", zoneId, recordIds).Delete(&Record{}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := []uint{}
+	names := []string{}
+	for _, record := range records {
+		deleted = append(deleted, record.ID)
+		names = append(names, record.Name)
+	}
+	syncWWWAfterChange(zone.ID, names...)
+	Audit("records.bulk_deleted", &zone, strconv.Itoa(len(deleted))+" records")
+
+	return deleted, nil
+}
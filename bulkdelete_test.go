@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkDelete(t *testing.T) {
+	zone, errs := NewZone("BH-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	for _, name := range []string{"_acme-challenge", "_acme-challenge.www", "_acme-challenge.shop"} {
+		_, errs = NewRecord(zone.ID, name, 300, "TXT", 0, "token-"+name)
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+	}
+	_, errs = NewRecord(zone.ID, "@", 300, "TXT", 0, "v=spf1 -all")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	GetDatabaseConnection().Model(&Zone{}).Where("id = ?", zone.ID).Update("reserved_names", "_acme-challenge")
+
+	filter := BulkDeleteFilter{Type: "txt", NamePrefix: "_acme-challenge"}
+	_, err := PreviewBulkDelete(zone.ID, BulkDeleteFilter{}, false)
+	assert.Equal(t, ErrBulkDeleteNoFilter, err)
+
+	preview, err := PreviewBulkDelete(zone.ID, filter, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, preview.Records, 2)
+	if assert.Len(t, preview.Skipped, 1) {
+		assert.Equal(t, "_acme-challenge", preview.Skipped[0].Name)
+	}
+	assert.NotEmpty(t, preview.ConfirmToken)
+
+	// Token belongs to the filter and can be used once
+	_, err = ConfirmBulkDelete(zone.ID, BulkDeleteFilter{Type: "TXT"}, preview.ConfirmToken, true)
+	assert.Equal(t, ErrBulkDeleteToken, err)
+	preview, err = PreviewBulkDelete(zone.ID, filter, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmed, err := ConfirmBulkDelete(zone.ID, filter, preview.ConfirmToken, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ConfirmBulkDelete(zone.ID, filter, preview.ConfirmToken, true)
+	assert.Equal(t, ErrBulkDeleteToken, err)
+
+	deleted, err := DeleteRecords(zone.ID, confirmed.RecordIds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, deleted, 2)
+	records, _ := GetStore().ListRecords(zone.ID)
+	assert.Len(t, records, 2)
+
+	// Records changed after the preview refuse the deletion
+	preview, err = PreviewBulkDelete(zone.ID, filter, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errs = NewRecord(zone.ID, "_acme-challenge.mail", 300, "TXT", 0, "token")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, err = ConfirmBulkDelete(zone.ID, filter, preview.ConfirmToken, false)
+	assert.Equal(t, ErrBulkDeleteChanged, err)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Timeout of one flush request of a resolver API
+const CacheFlushTimeout = 10 * time.Second
+
+// How long the flush waits for the commit to be deployed
+const CacheFlushDeployTimeout = 5 * time.Minute
+
+var flushableName = regexp.MustCompile(`^[a-z0-9_\-]+(\.[a-z0-9_\-]+)*$`)
+
+// Body of the flush request sent to resolver APIs
+type CacheFlushRequest struct {
+	Zone  string   `json:"zone"`
+	Names []string `json:"names"`
+}
+
+// Fully qualified names whose records differ between two record sets, sorted
+func changedNames(previous []Record, current []Record, domain string) []string {
+	rendered := func(records []Record) map[string][]string {
+		byName := make(map[string][]string)
+		for _, record := range records {
+			byName[record.Name] = append(byName[record.Name], strconv.Itoa(record.TTL)+" "+record.Type+" "+record.RenderData())
+		}
+		for name := range byName {
+			sort.Strings(byName[name])
+		}
+		return byName
+	}
+	before := rendered(previous)
+	after := rendered(current)
+
+	var names []string
+	for name, data := range after {
+		if strings.Join(data, "\n") != strings.Join(before[name], "\n") {
+			names = append(names, fqdnInZone(name, domain))
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			names = append(names, fqdnInZone(name, domain))
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Names changed by the last commit of the zone, all names of the zone for its first commit
+func lastCommitChanges(zone *Zone) ([]string, error) {
+	var versions []ZoneVersion
+
+	db := GetDatabaseConnection()
+	err := db.Where("zone_id = ?", zone.ID).Order("created_at desc, id desc").Limit(2).Find(&versions).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, errors.New("zone wasn't committed yet")
+	}
+
+	var previous, current []Record
+	err = json.Unmarshal([]byte(versions[0].Records), &current)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) > 1 {
+		err = json.Unmarshal([]byte(versions[1].Records), &previous)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return changedNames(previous, current, zone.Domain), nil
+}
+
+// FlushCaches finds names changed by the last commit of the zone and flushes them from caches
+// of DNSAPI_FLUSH_RESOLVERS in background once the commit is deployed. Returns the flushed names.
+func FlushCaches(zoneId uint) ([]string, error) {
+	var zone Zone
+
+	if len(config.FlushResolvers) == 0 {
+		return nil, errors.New("no resolvers to flush, set DNSAPI_FLUSH_RESOLVERS")
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := lastCommitChanges(&zone)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return names, nil
+	}
+
+	go func(zone Zone, names []string) {
+		// Resolvers would cache the old data again before the name servers have the new one
+		if !waitForDeployment(zone.ID, CacheFlushDeployTimeout) {
+			log.Errorf("cache flush of " + zone.Domain + ": the commit wasn't deployed in time")
+			return
+		}
+		time.Sleep(10 * time.Second)
+
+		for _, err := range flushResolvers(zone.Domain, names) {
+			log.Errorf("cache flush of " + zone.Domain + ": " + err.Error())
+		}
+	}(zone, names)
+
+	return names, nil
+}
+
+// Waits until the zone is deployed, false if it failed or didn't finish in time
+func waitForDeployment(zoneId uint, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		var zone Zone
+		err := GetDatabaseConnection().Where("id = ?", zoneId).Find(&zone).Error
+		if err != nil {
+			return false
+		}
+		switch zone.DeployState {
+		case DeployStateDeployed:
+			return true
+		case DeployStateFailed, DeployStateFrozen, DeployStateQueued:
+			return false
+		}
+		time.Sleep(time.Second)
+	}
+	return false
+}
+
+// Flushes the names from all resolvers, one failing resolver doesn't stop the others
+func flushResolvers(domain string, names []string) []error {
+	var errs []error
+
+	for _, resolver := range config.FlushResolvers {
+		err := flushResolver(resolver, domain, names)
+		if err != nil {
+			MetricsCounterAdd("dnsapi_cache_flush_failures_total", "Number of failed cache flushes", map[string]string{"resolver": resolver}, 1)
+			errs = append(errs, errors.Wrap(err, resolver))
+		}
+	}
+
+	return errs
+}
+
+// Resolver is URL of its API receiving CacheFlushRequest or host where rndc flushname is run via SSH
+func flushResolver(resolver string, domain string, names []string) error {
+	if strings.HasPrefix(resolver, "http://") || strings.HasPrefix(resolver, "https://") {
+		body, err := json.Marshal(CacheFlushRequest{Zone: domain, Names: names})
+		if err != nil {
+			return err
+		}
+
+		client := http.Client{Timeout: CacheFlushTimeout}
+		resp, err := client.Post(resolver, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			return errors.New("unexpected status code " + strconv.Itoa(resp.StatusCode))
+		}
+		return nil
+	}
+
+	// Names are a part of the shell command, wildcards can't be flushed by name
+	var commands []string
+	for _, name := range names {
+		if flushableName.MatchString(name) {
+			commands = append(commands, "rndc flushname "+name)
+		}
+	}
+	if len(commands) == 0 {
+		return nil
+	}
+	_, err := SendCommandViaSSH(resolver, strings.Join(commands, " && "))
+	return err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChangedNames(t *testing.T) {
+	previous := []Record{
+		{Name: "@", TTL: 300, Type: "A", Value: "192.0.2.1"},
+		{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"},
+		{Name: "old", TTL: 300, Type: "A", Value: "192.0.2.1"},
+		{Name: "mail", TTL: 300, Type: "A", Value: "192.0.2.3"},
+	}
+	current := []Record{
+		{Name: "@", TTL: 300, Type: "A", Value: "192.0.2.1"},
+		{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.2"},
+		{Name: "new", TTL: 300, Type: "A", Value: "192.0.2.1"},
+		{Name: "mail", TTL: 600, Type: "A", Value: "192.0.2.3"},
+	}
+
+	assert.Equal(t, []string{"mail.example.com", "new.example.com", "old.example.com", "www.example.com"},
+		changedNames(previous, current, "example.com"))
+	assert.Len(t, changedNames(current, current, "example.com"), 0)
+}
+
+func TestFlushResolvers(t *testing.T) {
+	var received CacheFlushRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	config.FlushResolvers = []string{failing.URL, server.URL}
+	defer func() {
+		config.FlushResolvers = nil
+	}()
+
+	errs := flushResolvers("example.com", []string{"www.example.com"})
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "example.com", received.Zone)
+	assert.Equal(t, []string{"www.example.com"}, received.Names)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+)
+
+// How long check-config waits for one connection
+const ConfigCheckTimeout = 5 * time.Second
+
+// States of configuration checks
+const (
+	ConfigCheckPassed  = "ok"
+	ConfigCheckFailed  = "failed"
+	ConfigCheckSkipped = "skipped"
+)
+
+// ConfigCheck is one check of the configuration, target is what was checked (server, file, template)
+type ConfigCheck struct {
+	Name    string `json:"name"`
+	Target  string `json:"target"`
+	State   string `json:"state"`
+	Message string `json:"message,omitempty"`
+}
+
+// ConfigReport are results of all configuration checks
+type ConfigReport struct {
+	Checks []ConfigCheck `json:"checks"`
+	Failed int           `json:"failed"`
+}
+
+func (r *ConfigReport) add(name string, target string, err error) {
+	check := ConfigCheck{Name: name, Target: target, State: ConfigCheckPassed}
+	if err != nil {
+		check.State = ConfigCheckFailed
+		check.Message = err.Error()
+		r.Failed++
+	}
+	r.Checks = append(r.Checks, check)
+}
+
+func (r *ConfigReport) skip(name string, target string, reason string) {
+	r.Checks = append(r.Checks, ConfigCheck{Name: name, Target: target, State: ConfigCheckSkipped, Message: reason})
+}
+
+// Render formats the report as aligned text lines
+func (r *ConfigReport) Render() string {
+	var output string
+	for _, check := range r.Checks {
+		line := fmt.Sprintf("%-8s %-12s %s", check.State, check.Name, check.Target)
+		if check.Message != "" {
+			line += ": " + check.Message
+		}
+		output += strings.TrimRight(line, " ") + "\n"
+	}
+	if r.Failed > 0 {
+		output += "\n" + strconv.Itoa(r.Failed) + " checks failed\n"
+	}
+	return output
+}
+
+// CheckConfig validates the configuration and everything it points to: the database, the SSH key, name servers,
+// the standby server and templates. Name servers aren't contacted in skip deploy mode.
+func CheckConfig() *ConfigReport {
+	report := &ConfigReport{Checks: []ConfigCheck{}}
+
+	report.add("environment", "DNSAPI_*", config.Validate())
+
+	databaseErr := checkDatabase(config.DatabasePath)
+	report.add("database", config.DatabasePath, databaseErr)
+	for _, path := range config.DatabaseReplicas {
+		report.add("database", path+" (replica)", checkReplica(path))
+	}
+
+	servers := configNameServers(databaseErr == nil)
+	if config.SkipDeploy {
+		report.skip("ssh_key", config.SSHKey, "DNSAPI_SKIP_DEPLOY is set")
+		for _, server := range servers {
+			report.skip("name_server", server, "DNSAPI_SKIP_DEPLOY is set")
+		}
+	} else {
+		signer, err := checkSSHKey(config.SSHKey)
+		report.add("ssh_key", config.SSHKey, err)
+		for _, server := range servers {
+			report.add("name_server", server+" (dns)", checkTCP(net.JoinHostPort(server, "53")))
+			if signer == nil {
+				report.skip("name_server", server+" (ssh)", "SSH key can't be used")
+				continue
+			}
+			report.add("name_server", server+" (ssh)", checkSSHLogin(server))
+		}
+	}
+	if config.StandbyServer != "" {
+		report.add("standby", config.StandbyServer, checkTCP(config.StandbyServer))
+	}
+
+	if databaseErr != nil {
+		report.skip("template", "", "database is not available")
+		return report
+	}
+	report.add("template", "bind config", checkBindTemplates())
+	var templates []Template
+	err := GetDatabaseConnection().Preload("Records").Order("id").Find(&templates).Error
+	report.add("template", "stored templates", err)
+	for _, template := range templates {
+		var err error
+		if errs := template.Validate(); len(errs) > 0 {
+			err = errs[0]
+		}
+		report.add("template", template.Name, err)
+	}
+	if config.ParkingTemplate != "" {
+		_, err := findTemplate(config.ParkingTemplate)
+		report.add("template", config.ParkingTemplate+" (DNSAPI_PARKING_TEMPLATE)", err)
+	}
+
+	return report
+}
+
+// Primary and secondary name servers from the configuration and the inventory if the database works, each once
+func configNameServers(inventory bool) []string {
+	var servers []string
+	seen := make(map[string]bool)
+	add := func(server string) {
+		if server != "" && !seen[server] {
+			seen[server] = true
+			servers = append(servers, server)
+		}
+	}
+
+	add(config.PrimaryNameServer)
+	for _, server := range config.NameServers {
+		add(server)
+	}
+
+	var nameServers []NameServer
+	if inventory {
+		GetDatabaseConnection().Order("id").Find(&nameServers)
+	}
+	for _, nameServer := range nameServers {
+		add(nameServer.Address())
+	}
+
+	return servers
+}
+
+func checkDatabase(path string) error {
+	db, err := gorm.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.DB().Ping()
+}
+
+func checkReplica(path string) error {
+	db, err := openReplica(path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.DB().Ping()
+}
+
+// Returns the signer of the key, it has to be readable and without passphrase
+func checkSSHKey(path string) (ssh.Signer, error) {
+	if path == "" {
+		return nil, errors.New("DNSAPI_SSH_KEY is not set")
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(content)
+	if err != nil {
+		return nil, errors.Wrap(err, "key can't be used")
+	}
+	return signer, nil
+}
+
+func checkSSHLogin(server string) error {
+	client, err := sshClient(server)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	return errors.Wrap(session.Run("true"), "commands can't be run")
+}
+
+func checkTCP(address string) error {
+	connection, err := net.DialTimeout("tcp", address, ConfigCheckTimeout)
+	if err != nil {
+		return err
+	}
+	return connection.Close()
+}
+
+// Renders configs of an example zone, templates panic when they can't be parsed or executed
+func checkBindTemplates() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	zone := Zone{Domain: "example.com", DNSSEC: true, TransferIPs: "192.0.2.1"}
+	zone.RenderPrimary()
+	zone.RenderSecondary()
+	return nil
+}
+
+func checkConfigCommand(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: dnsapi check-config")
+	}
+
+	report := CheckConfig()
+	fmt.Print(report.Render())
+	if report.Failed > 0 {
+		return errors.New("configuration is not valid")
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSSHKey(t *testing.T) {
+	file, err := ioutil.TempFile("", "dnsapi_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	_, err = checkSSHKey("")
+	assert.Error(t, err)
+	_, err = checkSSHKey(file.Name() + ".missing")
+	assert.Error(t, err)
+
+	ioutil.WriteFile(file.Name(), []byte("not a key"), 0600)
+	_, err = checkSSHKey(file.Name())
+	assert.Contains(t, err.Error(), "key can't be used")
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(file.Name(), pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	signer, err := checkSSHKey(file.Name())
+	assert.Nil(t, err)
+	assert.NotNil(t, signer)
+}
+
+func TestCheckTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	assert.Nil(t, checkTCP(address))
+
+	listener.Close()
+	assert.Error(t, checkTCP(address))
+}
+
+func TestCheckConfig(t *testing.T) {
+	config.SkipDeploy = true
+	config.ParkingTemplate = "au-missing-template"
+	defer func() {
+		config.SkipDeploy = false
+		config.ParkingTemplate = ""
+	}()
+
+	report := CheckConfig()
+	states := make(map[string]string)
+	for _, check := range report.Checks {
+		states[check.Name+" "+check.Target] = check.State
+	}
+	assert.Equal(t, ConfigCheckPassed, states["database "+config.DatabasePath])
+	assert.Equal(t, ConfigCheckSkipped, states["ssh_key "+config.SSHKey])
+	assert.Equal(t, ConfigCheckSkipped, states["name_server ns1.rosti.cz"])
+	assert.Equal(t, ConfigCheckSkipped, states["name_server ns2.rosti.cz"])
+	assert.Equal(t, ConfigCheckPassed, states["template bind config"])
+	assert.Equal(t, ConfigCheckFailed, states["template au-missing-template (DNSAPI_PARKING_TEMPLATE)"])
+	assert.Contains(t, report.Render(), "checks failed")
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+)
+
+// Help text printed for unknown commands
+const CommandsUsage = `Usage: dnsapi [command]
+
+Without command the API server is started.
+
+Commands:
+    seed                  populates the database with zones for development
+    resync <name server>  deploys all zones and config to one name server (ID, hostname or IP)
+    provision <hostname> <IP> [pool]
+                          bootstraps a fresh host as a new secondary and registers it
+    bulk <manifest> [tenant id]
+                          creates zones listed in CSV or JSON manifest and prints the report
+    acme <zone>...        delegates _acme-challenge of zones (ID or domain) and prints the credentials
+    inventory export [file] | inventory import <file>
+                          exports or imports name servers, templates, tenants and settings as YAML
+    anonymize [file]      writes all zones with anonymized customer data in the format of /export/all,
+                          for bug reports and development
+    doctor [--fix]        reports inconsistent data, ex. records of missing zones or invalid serials,
+                          and repairs issues which are safe to repair with --fix
+    check-config          checks configuration, database, SSH key, name servers and templates,
+                          exits with non-zero status if any check fails
+`
+
+// RunCommand runs command given on the command line. Returns error if the command doesn't exist or fails.
+func RunCommand(name string, args []string) error {
+	switch name {
+	case "seed":
+		return Seed()
+	case "resync":
+		return resyncCommand(args)
+	case "provision":
+		return provisionCommand(args)
+	case "bulk":
+		return bulkCommand(args)
+	case "acme":
+		return acmeCommand(args)
+	case "inventory":
+		return inventoryCommand(args)
+	case "anonymize":
+		return anonymizeCommand(args)
+	case "doctor":
+		return doctorCommand(args)
+	}
+
+	return errors.New("unknown command " + name + "\n\n" + CommandsUsage)
+}
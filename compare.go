@@ -0,0 +1,88 @@
+package main
+
+import (
+	"strconv"
+)
+
+// RecordPair is the same record in two zones
+type RecordPair struct {
+	A Record `json:"a"`
+	B Record `json:"b"`
+}
+
+// ZoneComparison is difference between record sets of two zones. Names and targets inside the zones are
+// relative to their apexes so a zone can be compared with its copy under another domain.
+type ZoneComparison struct {
+	ZoneA     uint         `json:"zone_a"`
+	ZoneB     uint         `json:"zone_b"`
+	Identical bool         `json:"identical"`
+	OnlyInA   []Record     `json:"only_in_a"`
+	OnlyInB   []Record     `json:"only_in_b"`
+	TTLDiffer []RecordPair `json:"ttl_differ"` // Same records with different TTL
+}
+
+// Record without TTL, records of both zones are paired by it
+func comparisonKey(record *Record, domain string) string {
+	record.Normalize(domain)
+	return record.Name + " " + record.Type + " " + strconv.Itoa(record.Prio) + " " + record.Value
+}
+
+// CompareZones diffs record sets of two zones
+func CompareZones(zoneIdA uint, zoneIdB uint) (*ZoneComparison, error) {
+	var zoneA, zoneB Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneIdA).Preload("Records").Find(&zoneA).Error
+	if err != nil {
+		return nil, err
+	}
+	err = db.Where("id = ?", zoneIdB).Preload("Records").Find(&zoneB).Error
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := ZoneComparison{
+		ZoneA:     zoneA.ID,
+		ZoneB:     zoneB.ID,
+		OnlyInA:   []Record{},
+		OnlyInB:   []Record{},
+		TTLDiffer: []RecordPair{},
+	}
+
+	recordsB := make(map[string][]Record)
+	for _, record := range zoneB.SortedRecords() {
+		key := comparisonKey(&record, zoneB.Domain)
+		recordsB[key] = append(recordsB[key], record)
+	}
+
+	for _, record := range zoneA.SortedRecords() {
+		key := comparisonKey(&record, zoneA.Domain)
+		if len(recordsB[key]) == 0 {
+			comparison.OnlyInA = append(comparison.OnlyInA, record)
+			continue
+		}
+
+		other := recordsB[key][0]
+		recordsB[key] = recordsB[key][1:]
+		if other.TTL != record.TTL {
+			comparison.TTLDiffer = append(comparison.TTLDiffer, RecordPair{A: record, B: other})
+		}
+	}
+
+	unpaired := make(map[uint]bool)
+	for _, records := range recordsB {
+		for _, record := range records {
+			unpaired[record.ID] = true
+		}
+	}
+	for _, record := range zoneB.SortedRecords() {
+		if unpaired[record.ID] {
+			record.Normalize(zoneB.Domain)
+			comparison.OnlyInB = append(comparison.OnlyInB, record)
+		}
+	}
+
+	comparison.Identical = len(comparison.OnlyInA) == 0 && len(comparison.OnlyInB) == 0 && len(comparison.TTLDiffer) == 0
+
+	return &comparison, nil
+}
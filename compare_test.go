@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCompareZones(t *testing.T) {
+	source, errs := NewZone("Z-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(source)
+	clone, errs := NewZone("Z-clone-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(clone)
+
+	for _, zone := range []*Zone{source, clone} {
+		for _, record := range []Record{
+			{Name: "@", TTL: 300, Type: "A", Value: "1.2.3.4"},
+			{Name: "www." + zone.Domain + ".", TTL: 300, Type: "CNAME", Value: "@"},
+			{Name: "@", TTL: 300, Type: "MX", Prio: 10, Value: "mail." + zone.Domain + "."},
+			{Name: "mail", TTL: 300, Type: "A", Value: "1.2.3.5"},
+		} {
+			_, errs = NewRecord(zone.ID, record.Name, record.TTL, record.Type, record.Prio, record.Value)
+			if len(errs) != 0 {
+				t.Fatal(errs)
+			}
+		}
+	}
+
+	comparison, err := CompareZones(source.ID, clone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !comparison.Identical {
+		t.Error("Clone under another domain differs", comparison)
+	}
+
+	_, errs = NewRecord(source.ID, "ftp", 300, "A", 0, "1.2.3.6")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(clone.ID, "@", 300, "AAAA", 0, "2001:db8::1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	record, errs := NewRecord(clone.ID, "ttl", 300, "A", 0, "1.2.3.7")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(source.ID, "ttl", 600, "A", 0, "1.2.3.7")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	comparison, err = CompareZones(source.ID, clone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comparison.Identical || len(comparison.OnlyInA) != 1 || comparison.OnlyInA[0].Name != "ftp" ||
+		len(comparison.OnlyInB) != 1 || comparison.OnlyInB[0].Type != "AAAA" ||
+		len(comparison.TTLDiffer) != 1 || comparison.TTLDiffer[0].B.ID != record.ID {
+		t.Error("Unexpected differences", comparison)
+	}
+
+	_, err = CompareZones(source.ID, 0)
+	if err == nil {
+		t.Error("Comparison with not existing zone passed")
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo"
+)
+
+// LastModified returns when the zone or one of its records was changed the last time, records have to be preloaded.
+// Deleted records are reflected by the zone's UpdatedAt which is touched by every change of records.
+func (z *Zone) LastModified() time.Time {
+	modified := z.UpdatedAt
+	for _, record := range z.Records {
+		if record.UpdatedAt.After(modified) {
+			modified = record.UpdatedAt
+		}
+	}
+	return modified.UTC().Truncate(time.Second)
+}
+
+// Strong ETag of the response body
+func contentETag(content string) string {
+	return fmt.Sprintf("\"%x\"", sha256.Sum256([]byte(content)))
+}
+
+// Sets Last-Modified and ETag headers and returns true if the client already has the content according
+// to If-None-Match or If-Modified-Since headers. If-None-Match takes precedence as the content depends
+// also on the configuration, not only on the modification time.
+func notModified(c echo.Context, modified time.Time, etag string) bool {
+	header := c.Response().Header()
+	header.Set(echo.HeaderLastModified, modified.UTC().Format(http.TimeFormat))
+	header.Set("ETag", etag)
+
+	if match := c.Request().Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := c.Request().Header.Get(echo.HeaderIfModifiedSince); since != "" {
+		sinceTime, err := http.ParseTime(since)
+		if err == nil && !modified.UTC().Truncate(time.Second).After(sinceTime) {
+			return true
+		}
+	}
+
+	return false
+}
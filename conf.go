@@ -1,8 +1,14 @@
 package main
 
 import (
-	"github.com/pkg/errors"
+	"encoding/base64"
+	"net"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/labstack/gommon/bytes"
+	"github.com/pkg/errors"
 )
 
 const (
@@ -14,6 +20,9 @@ const (
 	SecondaryBindConfigPath = "/etc/bind/named.conf.rosti"
 
 	RECORD_NOT_FOUND_MESSAGE = "record not found"
+
+	// Database path for in-memory database which is lost when the process exits
+	MemoryDatabasePath = ":memory:"
 )
 
 // Configuration struct. All input form the maintainer is available through this struct.
@@ -29,11 +38,89 @@ type Config struct {
 	TimeToExpire           int      `default:"604800" split_words:"true"`      // Time to expire when the domain is not available on master
 	MinimalTTL             int      `default:"30" split_words:"true"`          // Minimal TTL
 	TTL                    int      `default:"3600"`                           // Default TTL
-	DatabasePath           string   `default:"gorm.sqlite" split_words:"true"` // Path to the database
+	TypeTTLs               []string `split_words:"true"`                       // Default TTLs of new records by type, ex. A:300,AAAA:300,MX:3600,TXT:3600; other types get DNSAPI_TTL
+	DatabasePath           string   `default:"gorm.sqlite" split_words:"true"` // Path to the database, :memory: for ephemeral database
+	DatabaseReplicas       []string `split_words:"true"`                       // Read replicas of the database used by list, render and export queries
+	SkipDeploy             bool     `default:"false" split_words:"true"`       // Don't touch name servers at all, only validate and render
 	SSHKey                 string   `split_words:"yes"`                        // SSH key used for set Bind's config files (path to file)
 	SSHUser                string   `default:"root" split_words:"yes"`         // SSH user used for saving config files
 	APIToken               string   `default:"" split_words:"yes"`             // Token to access the API
+	AdminToken             string   `default:"" split_words:"yes"`             // Token to access the API including /admin/ endpoints, they are disabled if empty
+	ExportToken            string   `split_words:"yes"`                        // Token allowing only the read-only mirror GET /export/all
 	Port                   uint16   `default:"1323"`                           // Port where the API listens
+	AssertionInterval      int      `default:"300" split_words:"true"`         // How often are assertions checked (seconds), 0 disables the checks
+	AssertionResolver      string   `split_words:"true"`                       // DNS server (ip:port) used for assertions, system resolver if empty
+	WebhookURL             string   `split_words:"true"`                       // URL where events are sent as JSON
+	MonitorInterval        int      `default:"60" split_words:"true"`          // How often are status URLs of zones checked (seconds), 0 disables the checks
+	AliasInterval          int      `default:"300" split_words:"true"`         // How often are ALIAS records resolved again (seconds), zones with changed addresses are committed; 0 disables it
+	MonitoringPauseURL     string   `split_words:"true"`                       // URL told to pause and resume alerting of zones with monitor ID during planned changes
+	MonitorAllowedRanges   []string `split_words:"true"`                       // Internal IP ranges in CIDR notation where status URLs set by the API token may point
+	PrimaryStanza          string   `split_words:"true"`                       // Path to Go template of primary's zone stanza, built-in stanza if empty
+	SecondaryStanza        string   `split_words:"true"`                       // Path to Go template of secondaries' zone stanza, built-in stanza if empty
+	RenderOrder            string   `default:"name" split_words:"true"`        // Order of records in zone files, name (apex first, then type) or type (then name)
+	RenderTypeOrder        []string `split_words:"true"`                       // Types rendered first in this order with render order type, ex. NS,MX,A,AAAA,CNAME,TXT
+	RenderGroups           bool     `default:"false" split_words:"true"`       // Empty line between groups (names or types) and owner name written once per name
+	DeployRetries          int      `default:"3" split_words:"true"`           // How many times is failed deployment to a name server retried
+	DeployRetryDelay       int      `default:"1000" split_words:"true"`        // Delay before the first retry (ms), doubled for every next retry
+	DeployProbeInterval    int      `default:"60" split_words:"true"`          // How often are degraded name servers checked (seconds)
+	FlushResolvers         []string `split_words:"true"`                       // Resolvers flushed by commits with ?flush=true, SSH hosts (rndc flushname) or API URLs
+	MaxParallelDeploys     int      `default:"4" split_words:"true"`           // Zones deployed to the primary at once, more commits wait in queue; 0 for no limit
+	PublicURL              string   `split_words:"true"`                       // URL where the API is accessible from outside, used in links
+	SMTPServer             string   `split_words:"true"`                       // SMTP server (host:port) for sending emails
+	SMTPUser               string   `split_words:"true"`                       // SMTP user, no authentication if empty
+	SMTPPassword           string   `split_words:"true"`                       // SMTP password
+	SMTPFrom               string   `split_words:"true"`                       // Sender of emails
+	DecommissionNotify     bool     `default:"false" split_words:"true"`       // Send final NOTIFY before deleted zone is removed from name servers
+	AutoDelegate           bool     `default:"false" split_words:"true"`       // Add NS records (and glue) of new zones into their parent zones hosted here, removed with the zones
+	DeployMode             string   `default:"monolithic" split_words:"true"`  // monolithic or fragments (zones added by rndc addzone)
+	DeployWindows          string   `split_words:"true"`                       // Global deployment windows, ex. 06:00-22:00 in local time
+	LintStrict             bool     `default:"false" split_words:"true"`       // Refuse commits of zones with lint errors
+	DecommissionedRanges   []string `split_words:"true"`                       // Retired IP ranges in CIDR notation, used by the orphaned records report
+	ReservedNames          []string `split_words:"true"`                       // Names reserved in all zones, ex. @,mail,ns1; they can be changed only with the admin token
+	AnomalyRules           []string `split_words:"true"`                       // Rules of suspicious changes with action, ex. ns_change:approve,mx_change:flag
+	KnownRanges            []string `split_words:"true"`                       // IP ranges in CIDR notation where apex A/AAAA records may point, used by apex_outside rule
+	MassDeletionThreshold  int      `default:"10" split_words:"true"`          // Records of one zone deleted during an hour which are a mass deletion
+	AnomalyEmail           string   `split_words:"true"`                       // Where suspicious changes are reported, webhook only if empty
+	LegacySunset           string   `split_words:"true"`                       // Date (2006-01-02) when unversioned routes will be removed, sent in Sunset header
+	CORSOrigins            []string `split_words:"true"`                       // Origins of browser clients allowed by CORS, ex. https://admin.example.com; CORS is disabled if empty
+	CORSMethods            []string `split_words:"true"`                       // Methods allowed by CORS, GET, HEAD, PUT, PATCH, POST and DELETE if empty
+	CORSHeaders            []string `split_words:"true"`                       // Request headers allowed by CORS, headers requested by the browser if empty
+	CORSMaxAge             int      `default:"600" split_words:"true"`         // How long browsers cache preflight responses (seconds)
+	HSTSMaxAge             int      `default:"0" split_words:"true"`           // Strict-Transport-Security max-age, 0 doesn't send the header
+	MaxBodySize            string   `default:"2M" split_words:"true"`          // Maximal size of request bodies, ex. 512K or 2M
+	MaxTXTLength           int      `default:"4096" split_words:"true"`        // Maximal length of TXT values
+	ParkingTemplate        string   `split_words:"true"`                       // Template (ID or name) of parked zones
+	ParkingIP              string   `split_words:"true"`                       // Parking server, apex and wildcard records of parked zones point to it if there is no template
+	AcmeDNSURL             string   `split_words:"true"`                       // acme-dns API where _acme-challenge names are delegated, ex. https://auth.example.com
+	AcmeZone               string   `split_words:"true"`                       // Built-in validation zone managed by this API, used if AcmeDNSURL is empty
+	RPZZone                string   `split_words:"true"`                       // Zone where blocklists are synced, ex. rpz.example.net
+	RPZFeeds               []string `split_words:"true"`                       // URLs of blocklists in hosts or RPZ format
+	RPZInterval            int      `default:"3600" split_words:"true"`        // How often are blocklists synced (seconds), 0 disables the sync
+	RPZMaxEntries          int      `default:"100000" split_words:"true"`      // Maximal number of blocked names in the RPZ zone
+	SerialSoftLimit        int      `default:"80" split_words:"true"`          // Serial bumps of a zone a day after which the limit action applies, 0 only at 99
+	SerialLimitAction      string   `default:"batch" split_words:"true"`       // batch (queue commits) or reject
+	SerialBatchInterval    int      `default:"900" split_words:"true"`         // Minimal time between serial bumps above the soft limit (seconds)
+	SerialCheck            bool     `default:"true" split_words:"true"`        // New serials have to be newer than serials the name servers serve
+	SerialFormat           string   `default:"date" split_words:"true"`        // date (YYYYMMDDnn) or unixtime (seconds since epoch)
+	PoolTTLBounds          []string `split_words:"true"`                       // Record TTLs allowed in zones of name server pools, ex. free:300-86400
+	StandbyServer          string   `split_words:"true"`                       // RFC 2136 server (host:port) mirroring zones with standby enabled
+	StandbyTSIGName        string   `split_words:"true"`                       // Name of the TSIG key of the standby's updates, unsigned if empty
+	StandbyTSIGSecret      string   `split_words:"true"`                       // Base64 encoded secret of the TSIG key
+	StandbyTSIGAlgorithm   string   `default:"hmac-sha256" split_words:"true"` // TSIG algorithm, ex. hmac-sha512
+
+	// Tamper evidence of the audit log
+	AuditSigningKey string `split_words:"true"`               // Base64 encoded Ed25519 seed or private key signing batches of audit log entries
+	AuditBatchSize  int    `default:"100" split_words:"true"` // Entries signed together
+
+	// Zone access log of tenants with access_log enabled
+	AccessLogRetention int `default:"90" split_words:"true"` // Days the entries are kept, 0 keeps them forever
+
+	// Expiry monitoring of registrations of zones' domains
+	RDAPInterval      int    `default:"86400" split_words:"true"`                               // How often are registrations looked up (seconds), 0 disables the lookups
+	RDAPBootstrapURL  string `default:"https://data.iana.org/rdap/dns.json" split_words:"true"` // RDAP servers of top level domains (RFC 9224)
+	ExpiryWarningDays int    `default:"30" split_words:"true"`                                  // Registrations expiring within these days are reported
+
+	SOAAdvisorInterval int `default:"0" split_words:"true"` // How often are SOA refresh and retry proposed for approval (seconds), 0 disables the proposals
 }
 
 // Validates data inside the config struct
@@ -44,14 +131,119 @@ func (c *Config) Validate() error {
 	if len(c.NameServers) < 2 {
 		return errors.New("DNSAPI_NAME_SERVERS has to be defined and contains at least two servers")
 	}
-	if c.AbuseEmail == "" || !strings.Contains(c.AbuseEmail, "@") || !strings.Contains(c.AbuseEmail, ".") {
+	if !validEmail(c.AbuseEmail) {
 		return errors.New("DNSAPI_ABUSE_EMAIL has to be defined and contains a valid email address")
 	}
+	for _, cidr := range c.DecommissionedRanges {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return errors.New("DNSAPI_DECOMMISSIONED_RANGES: " + cidr + " is not a valid CIDR range")
+		}
+	}
+	for _, cidr := range c.KnownRanges {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return errors.New("DNSAPI_KNOWN_RANGES: " + cidr + " is not a valid CIDR range")
+		}
+	}
+	for _, cidr := range c.MonitorAllowedRanges {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			return errors.New("DNSAPI_MONITOR_ALLOWED_RANGES: " + cidr + " is not a valid CIDR range")
+		}
+	}
+	if c.LegacySunset != "" {
+		if _, err := time.Parse("2006-01-02", c.LegacySunset); err != nil {
+			return errors.New("DNSAPI_LEGACY_SUNSET has to be a date in YYYY-MM-DD format")
+		}
+	}
+	if _, err := bytes.Parse(c.MaxBodySize); c.MaxBodySize != "" && err != nil {
+		return errors.New("DNSAPI_MAX_BODY_SIZE has to be a size like 512K or 2M")
+	}
+	for _, feed := range c.RPZFeeds {
+		if !strings.HasPrefix(feed, "http://") && !strings.HasPrefix(feed, "https://") {
+			return errors.New("DNSAPI_RPZ_FEEDS: " + feed + " is not a HTTP(S) URL")
+		}
+	}
+	if c.ParkingIP != "" && net.ParseIP(c.ParkingIP) == nil {
+		return errors.New("DNSAPI_PARKING_IP has to be a valid IP address")
+	}
+	if c.SerialSoftLimit < 0 || c.SerialSoftLimit > MaxDailySerialBumps {
+		return errors.New("DNSAPI_SERIAL_SOFT_LIMIT has to be number between 0 and " + strconv.Itoa(MaxDailySerialBumps))
+	}
+	if err := ValidateSerialLimitAction(c.SerialLimitAction); err != nil {
+		return errors.Wrap(err, "DNSAPI_SERIAL_LIMIT_ACTION")
+	}
+	if err := ValidateSerialFormat(c.SerialFormat); err != nil {
+		return errors.Wrap(err, "DNSAPI_SERIAL_FORMAT")
+	}
+	if err := ValidateAnomalyRules(c.AnomalyRules); err != nil {
+		return errors.Wrap(err, "DNSAPI_ANOMALY_RULES")
+	}
+	if err := ValidateDeployWindows(c.DeployWindows); err != nil {
+		return errors.Wrap(err, "DNSAPI_DEPLOY_WINDOWS")
+	}
+	if err := ValidatePoolTTLBounds(c.PoolTTLBounds); err != nil {
+		return errors.Wrap(err, "DNSAPI_POOL_TTL_BOUNDS")
+	}
+	if c.StandbyTSIGName != "" {
+		if _, err := base64.StdEncoding.DecodeString(c.StandbyTSIGSecret); err != nil || c.StandbyTSIGSecret == "" {
+			return errors.New("DNSAPI_STANDBY_TSIG_SECRET has to be base64 encoded secret")
+		}
+		validAlgorithm := false
+		for _, algorithm := range TSIGAlgorithms {
+			if c.StandbyTSIGAlgorithm == algorithm {
+				validAlgorithm = true
+			}
+		}
+		if !validAlgorithm {
+			return errors.New("DNSAPI_STANDBY_TSIG_ALGORITHM has to be one of " + strings.Join(TSIGAlgorithms, ", "))
+		}
+	}
+	if _, err := parseAuditSigningKey(c.AuditSigningKey); err != nil {
+		return errors.Wrap(err, "DNSAPI_AUDIT_SIGNING_KEY")
+	}
+	if c.AuditSigningKey != "" && c.AuditBatchSize < 1 {
+		return errors.New("DNSAPI_AUDIT_BATCH_SIZE has to be at least 1")
+	}
+	if c.AccessLogRetention < 0 {
+		return errors.New("DNSAPI_ACCESS_LOG_RETENTION has to be 0 (forever) or more days")
+	}
+	if c.RDAPInterval < 0 {
+		return errors.New("DNSAPI_RDAP_INTERVAL has to be 0 (disabled) or more seconds")
+	}
+	if c.RDAPInterval > 0 && !strings.HasPrefix(c.RDAPBootstrapURL, "http://") && !strings.HasPrefix(c.RDAPBootstrapURL, "https://") {
+		return errors.New("DNSAPI_RDAP_BOOTSTRAP_URL has to be http or https URL")
+	}
+	if c.ExpiryWarningDays < 0 {
+		return errors.New("DNSAPI_EXPIRY_WARNING_DAYS can't be negative")
+	}
+	if c.SOAAdvisorInterval < 0 {
+		return errors.New("DNSAPI_SOA_ADVISOR_INTERVAL has to be 0 (disabled) or more seconds")
+	}
+	if err := ValidateTypeTTLs(c.TypeTTLs); err != nil {
+		return errors.Wrap(err, "DNSAPI_TYPE_TTLS")
+	}
+	if c.MonitoringPauseURL != "" && !strings.HasPrefix(c.MonitoringPauseURL, "http://") && !strings.HasPrefix(c.MonitoringPauseURL, "https://") {
+		return errors.New("DNSAPI_MONITORING_PAUSE_URL has to be http or https URL")
+	}
+	if err := ValidateStanzaTemplate(c.PrimaryStanza); err != nil {
+		return errors.Wrap(err, "DNSAPI_PRIMARY_STANZA")
+	}
+	if err := ValidateStanzaTemplate(c.SecondaryStanza); err != nil {
+		return errors.Wrap(err, "DNSAPI_SECONDARY_STANZA")
+	}
+	if err := ValidateRenderOrder(c.RenderOrder, c.RenderTypeOrder); err != nil {
+		return errors.Wrap(err, "DNSAPI_RENDER_ORDER")
+	}
+	if c.MaxParallelDeploys < 0 {
+		return errors.New("DNSAPI_MAX_PARALLEL_DEPLOYS has to be 0 (no limit) or more")
+	}
+	if c.DeployMode != DeployModeMonolithic && c.DeployMode != DeployModeFragments {
+		return errors.New("DNSAPI_DEPLOY_MODE has to be " + DeployModeMonolithic + " or " + DeployModeFragments)
+	}
 
 	return nil
 }
 
 // Reformat the email so it can be used in zone files
 func (c *Config) RenderEmail() string {
-	return strings.Replace(c.AbuseEmail, "@", ".", -1)
+	return renderRName(c.AbuseEmail)
 }
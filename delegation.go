@@ -0,0 +1,171 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Owner of records delegating a child zone from its parent is this prefix and ID of the child
+const DelegationOwnerPrefix = "delegation:"
+
+func delegationOwner(child *Zone) string {
+	return DelegationOwnerPrefix + strconv.Itoa(int(child.ID))
+}
+
+// The most specific zone hosted here which contains the child, only zones of the same tenant can be parents
+func parentZone(child *Zone) (*Zone, error) {
+	var parent Zone
+
+	var suffixes []string
+	labels := strings.Split(child.Domain, ".")
+	for i := 1; i < len(labels)-1; i++ {
+		suffixes = append(suffixes, strings.Join(labels[i:], "."))
+	}
+	if len(suffixes) == 0 {
+		return nil, nil
+	}
+
+	db := GetDatabaseConnection()
+	err := activeZones(db).Where("domain IN (?)", suffixes).Order("length(domain) DESC").First(&parent).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if parent.TenantId != child.TenantId {
+		return nil, nil
+	}
+
+	return &parent, nil
+}
+
+// Addresses of the name server from the inventory, the glue of name servers inside the child zone
+func glueAddresses(nameServer string) []string {
+	var nameServers []NameServer
+
+	db := GetDatabaseConnection()
+	err := db.Where("hostname = ?", strings.TrimSuffix(nameServer, ".")).Find(&nameServers).Error
+	if err != nil {
+		panic(err)
+	}
+
+	var addresses []string
+	for _, server := range nameServers {
+		if net.ParseIP(server.IP) != nil {
+			addresses = append(addresses, net.ParseIP(server.IP).String())
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// NS records of the child's name servers in the parent zone and A/AAAA glue of name servers inside the child
+func delegationRecords(child *Zone, parent *Zone) ([]Record, error) {
+	var records []Record
+
+	name := strings.TrimSuffix(child.Domain, "."+parent.Domain)
+	for _, nameServer := range child.ApexNameServers() {
+		nameServer = strings.ToLower(strings.TrimSuffix(nameServer, "."))
+		records = append(records, Record{Name: name, Type: "NS", Value: nameServer + "."})
+
+		if nameServer != child.Domain && !strings.HasSuffix(nameServer, "."+child.Domain) {
+			continue
+		}
+		addresses := glueAddresses(nameServer)
+		if len(addresses) == 0 {
+			return nil, errors.New("name server " + nameServer + " is inside " + child.Domain + ", its address for glue has to be in the name server inventory")
+		}
+		for _, address := range addresses {
+			recordType := "A"
+			if net.ParseIP(address).To4() == nil {
+				recordType = "AAAA"
+			}
+			records = append(records, Record{Name: strings.TrimSuffix(nameServer, "."+parent.Domain), Type: recordType, Value: address})
+		}
+	}
+
+	return records, nil
+}
+
+// Commits the parent zone after its delegation records changed
+func commitParent(parent *Zone) {
+	err := Commit(parent.ID)
+	if err != nil && err != ErrCommitQueued && err != ErrSerialBatched {
+		log.Errorf("commit of delegations in " + parent.Domain + ": " + err.Error())
+	}
+}
+
+// DelegateZone adds NS records (and glue) of the child into its parent zone hosted here and commits the parent.
+// Nothing is done without DNSAPI_AUTO_DELEGATE or when the parent isn't hosted here. Delegations added
+// by hand are not replaced.
+func DelegateZone(child *Zone) error {
+	if !config.AutoDelegate {
+		return nil
+	}
+
+	parent, err := parentZone(child)
+	if err != nil || parent == nil {
+		return err
+	}
+
+	records, err := delegationRecords(child, parent)
+	if err != nil {
+		return err
+	}
+
+	result, errs := ApplyZoneRecords(parent.ID, delegationOwner(child), records, false)
+	if len(errs) > 0 {
+		var messages []string
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		return errors.New("delegation in " + parent.Domain + ": " + strings.Join(messages, ", "))
+	}
+	if len(result.Created) > 0 || len(result.Deleted) > 0 {
+		Audit("zone.delegated", parent, child.Domain)
+		commitParent(parent)
+	}
+
+	return nil
+}
+
+// RemoveDelegation removes records delegating the child from parent zones and commits them, it's done also
+// when DNSAPI_AUTO_DELEGATE was turned off since the delegation was added.
+func RemoveDelegation(child *Zone) error {
+	var records []Record
+
+	db := GetDatabaseConnection()
+	err := db.Where("owner = ?", delegationOwner(child)).Find(&records).Error
+	if err != nil {
+		return err
+	}
+
+	parents := make(map[uint]bool)
+	for _, record := range records {
+		parents[record.ZoneId] = true
+	}
+
+	for parentId := range parents {
+		var parent Zone
+		err := db.Where("id = ?", parentId).Find(&parent).Error
+		if err != nil {
+			return err
+		}
+
+		_, errs := ApplyZoneRecords(parent.ID, delegationOwner(child), nil, false)
+		if len(errs) > 0 {
+			return errors.Wrap(errs[0], "removal of delegation from "+parent.Domain)
+		}
+		Audit("zone.delegation_removed", &parent, child.Domain)
+		commitParent(&parent)
+	}
+
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func delegationNames(zone *Zone) []string {
+	var names []string
+	for _, record := range zone.SortedRecords() {
+		names = append(names, record.Name+" "+record.Type+" "+record.Value)
+	}
+	return names
+}
+
+func TestDelegateZone(t *testing.T) {
+	config.TTL = 300
+	config.SkipDeploy = true
+	config.AutoDelegate = true
+	defer func() {
+		config.TTL = 0
+		config.SkipDeploy = false
+		config.AutoDelegate = false
+	}()
+
+	parent, errs := NewZone("BQ-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(parent)
+	_, errs = NewRecord(parent.ID, "manual", 300, "NS", 0, "ns.example.com.")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	child, errs := NewZone("customer.BQ-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(child)
+
+	parent, _ = GetStore().GetZone(parent.ID)
+	assert.Equal(t, []string{"customer NS ns1.rosti.cz.", "customer NS ns2.rosti.cz.", "manual NS ns.example.com."}, delegationNames(parent))
+	for _, record := range parent.Records {
+		if record.Name == "customer" {
+			assert.Equal(t, delegationOwner(child), record.Owner)
+		}
+	}
+
+	// Delegations added by hand are kept
+	manual, errs := NewZone("manual.BQ-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(manual)
+	parent, _ = GetStore().GetZone(parent.ID)
+	assert.Len(t, parent.Records, 3)
+
+	assert.NoError(t, DeleteZone(child.ID))
+	parent, _ = GetStore().GetZone(parent.ID)
+	assert.Equal(t, []string{"manual NS ns.example.com."}, delegationNames(parent))
+
+	// Zones of another tenant aren't parents
+	other := Zone{ID: 1, TenantId: 1, Domain: "other.bq-" + TEST_DOMAIN}
+	found, err := parentZone(&other)
+	assert.NoError(t, err)
+	assert.Nil(t, found)
+}
+
+func TestDelegationRecords_glue(t *testing.T) {
+	nameServers := config.NameServers
+	config.NameServers = []string{"ns1.shop.bq-" + TEST_DOMAIN, "ns2.rosti.cz"}
+	defer func() { config.NameServers = nameServers }()
+
+	parent := Zone{ID: 1, Domain: "bq-" + TEST_DOMAIN}
+	child := Zone{ID: 2, Domain: "shop.bq-" + TEST_DOMAIN}
+
+	_, err := delegationRecords(&child, &parent)
+	assert.EqualError(t, err, "name server ns1.shop.bq-"+TEST_DOMAIN+" is inside shop.bq-"+TEST_DOMAIN+", its address for glue has to be in the name server inventory")
+
+	db := GetDatabaseConnection()
+	servers := []NameServer{
+		{Hostname: "ns1.shop.bq-" + TEST_DOMAIN, IP: "192.0.2.53", Role: "secondary"},
+		{Hostname: "ns1.shop.bq-" + TEST_DOMAIN, IP: "2001:db8::53", Role: "secondary"},
+	}
+	for i := range servers {
+		assert.NoError(t, db.Create(&servers[i]).Error)
+		defer db.Delete(&servers[i])
+	}
+
+	records, err := delegationRecords(&child, &parent)
+	assert.NoError(t, err)
+	var names []string
+	for _, record := range records {
+		names = append(names, record.Name+" "+record.Type+" "+record.Value)
+	}
+	assert.Equal(t, []string{
+		"shop NS ns1.shop.bq-" + TEST_DOMAIN + ".",
+		"ns1.shop A 192.0.2.53",
+		"ns1.shop AAAA 2001:db8::53",
+		"shop NS ns2.rosti.cz.",
+	}, names)
+}
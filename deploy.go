@@ -0,0 +1,265 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Returned for hosts which are degraded, nothing is sent to them until they recover
+var ErrHostDegraded = errors.New("name server is degraded, deployment postponed until it recovers")
+
+// HostState is health of one name server from deployment's point of view
+type HostState struct {
+	Host       string     `json:"host"`
+	Degraded   bool       `json:"degraded"`
+	DegradedAt *time.Time `json:"degraded_at"`
+	LastError  string     `json:"last_error"`
+	// Zones that were committed while the host was degraded
+	MissedZones []uint `json:"missed_zones"`
+
+	// Config has to be deployed when the host recovers
+	missedConfig bool
+	missed       map[uint]bool
+}
+
+var hostStatesLock sync.Mutex
+var hostStates = make(map[string]*HostState)
+
+// Returns state of the host, hostStatesLock has to be locked
+func getHostState(host string) *HostState {
+	state, ok := hostStates[host]
+	if !ok {
+		state = &HostState{
+			Host:   host,
+			missed: make(map[uint]bool),
+		}
+		hostStates[host] = state
+	}
+	return state
+}
+
+// Remembers what has to be deployed when the host recovers, hostStatesLock has to be locked
+func (h *HostState) miss(zoneId uint) {
+	if zoneId == 0 {
+		h.missedConfig = true
+	} else {
+		h.missed[zoneId] = true
+	}
+}
+
+// HostStates returns copy of states of all hosts we have tried to deploy to
+func HostStates() []HostState {
+	hostStatesLock.Lock()
+	defer hostStatesLock.Unlock()
+
+	var states []HostState
+	for _, state := range hostStates {
+		stateCopy := *state
+		stateCopy.MissedZones = []uint{}
+		for zoneId := range state.missed {
+			stateCopy.MissedZones = append(stateCopy.MissedZones, zoneId)
+		}
+		sort.Slice(stateCopy.MissedZones, func(i, j int) bool { return stateCopy.MissedZones[i] < stateCopy.MissedZones[j] })
+		states = append(states, stateCopy)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Host < states[j].Host })
+
+	return states
+}
+
+// RunOnHost runs action against the host with retries and exponential backoff. When all attempts
+// fail the host is marked degraded and following calls fail immediately with ErrHostDegraded.
+// zoneId (0 for config only changes) is remembered and deployed again when the host recovers.
+func RunOnHost(host string, zoneId uint, action func() error) error {
+	hostStatesLock.Lock()
+	state := getHostState(host)
+	if state.Degraded {
+		state.miss(zoneId)
+		hostStatesLock.Unlock()
+		return ErrHostDegraded
+	}
+	hostStatesLock.Unlock()
+
+	delay := time.Duration(config.DeployRetryDelay) * time.Millisecond
+	var err error
+	for attempt := 0; attempt <= config.DeployRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+
+		err = action()
+		if err == nil {
+			return nil
+		}
+
+		MetricsCounterAdd("dnsapi_deploy_failures_total", "Number of failed deployment attempts", map[string]string{"host": host}, 1)
+		log.Warnf("deployment to " + host + " failed: " + err.Error())
+	}
+
+	markHostDegraded(host, zoneId, err)
+
+	return err
+}
+
+// Opens the circuit breaker for the host
+func markHostDegraded(host string, zoneId uint, err error) {
+	hostStatesLock.Lock()
+	defer hostStatesLock.Unlock()
+
+	state := getHostState(host)
+	state.miss(zoneId)
+	state.LastError = err.Error()
+	if state.Degraded {
+		return
+	}
+
+	now := time.Now().UTC()
+	state.Degraded = true
+	state.DegradedAt = &now
+
+	MetricsGaugeSet("dnsapi_nameserver_degraded", "1 if deployments to the name server are failing", map[string]string{"host": host}, 1)
+	SendWebhook("nameserver.degraded", *state)
+	log.Errorf("name server " + host + " is degraded: " + err.Error())
+}
+
+// Closes the circuit breaker and returns what was missed meanwhile
+func markHostRecovered(host string) (bool, []uint) {
+	hostStatesLock.Lock()
+	defer hostStatesLock.Unlock()
+
+	state := getHostState(host)
+
+	var zoneIds []uint
+	for zoneId := range state.missed {
+		zoneIds = append(zoneIds, zoneId)
+	}
+	missedConfig := state.missedConfig
+
+	state.Degraded = false
+	state.DegradedAt = nil
+	state.LastError = ""
+	state.missedConfig = false
+	state.missed = make(map[uint]bool)
+
+	MetricsGaugeSet("dnsapi_nameserver_degraded", "1 if deployments to the name server are failing", map[string]string{"host": host}, 0)
+	SendWebhook("nameserver.recovered", *state)
+	log.Infof("name server " + host + " recovered")
+
+	return missedConfig, zoneIds
+}
+
+// Deploys everything the host missed while it was degraded
+func catchUpHost(host string, missedConfig bool, zoneIds []uint) error {
+	db := GetDatabaseConnection()
+
+	var zones []Zone
+	for _, zoneId := range zoneIds {
+		var zone Zone
+		err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+		if err != nil || zone.Delete {
+			// Zone was deleted meanwhile
+			continue
+		}
+		zones = append(zones, zone)
+	}
+
+	if host == config.PrimaryNameServer {
+		for _, zone := range zones {
+			err := RunOnHost(host, zone.ID, func() error { return deployZoneFile(&zone) })
+			if err != nil {
+				setZoneDeployState(zone.ID, DeployStateFailed, err)
+				return err
+			}
+		}
+
+		err := RunOnHost(host, 0, deployMasterBindConfig)
+		if err != nil {
+			return err
+		}
+
+		err = RunOnHost(host, 0, func() error { return deployZoneFragments(host, zones) })
+		if err != nil {
+			return err
+		}
+
+		for _, zone := range zones {
+			err = setZoneDeployState(zone.ID, DeployStateDeployed, nil)
+			if err != nil {
+				return err
+			}
+		}
+		finishHostDeployments(host, zones)
+
+		return nil
+	}
+
+	// Secondary gets fresh config and refreshes all missed zones
+	if missedConfig || len(zones) > 0 {
+		bindConfig, err := renderSecondaryBindConfig()
+		if err != nil {
+			return err
+		}
+		err = RunOnHost(host, 0, func() error { return deploySecondaryBindConfig(host, bindConfig) })
+		if err != nil {
+			return err
+		}
+
+		err = RunOnHost(host, 0, func() error { return deployZoneFragments(host, zones) })
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, zone := range zones {
+		err := RunOnHost(host, zone.ID, func() error {
+			_, err := SendCommandViaSSH(host, "rndc refresh "+zone.Domain)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	finishHostDeployments(host, zones)
+
+	return nil
+}
+
+// ProbeDegradedHosts checks whether degraded hosts are reachable again and deploys what they missed
+func ProbeDegradedHosts() {
+	var degraded []string
+
+	hostStatesLock.Lock()
+	for host, state := range hostStates {
+		if state.Degraded {
+			degraded = append(degraded, host)
+		}
+	}
+	hostStatesLock.Unlock()
+
+	for _, host := range degraded {
+		_, err := SendCommandViaSSH(host, "true")
+		if err != nil {
+			continue
+		}
+
+		missedConfig, zoneIds := markHostRecovered(host)
+		err = catchUpHost(host, missedConfig, zoneIds)
+		if err != nil {
+			log.Errorf("catch-up deployment of " + host + " failed: " + err.Error())
+		}
+	}
+}
+
+// RunHostProbes probes degraded hosts every config.DeployProbeInterval seconds, it's supposed to run as goroutine
+func RunHostProbes() {
+	ticker := time.NewTicker(time.Duration(config.DeployProbeInterval) * time.Second)
+
+	for range ticker.C {
+		ProbeDegradedHosts()
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRunOnHost(t *testing.T) {
+	config.DeployRetries = 2
+	config.DeployRetryDelay = 1
+	defer func() {
+		config.DeployRetries = 0
+		config.DeployRetryDelay = 0
+	}()
+
+	host := "ns-test-breaker.rosti.cz"
+
+	// Retries until the action passes
+	attempts := 0
+	err := RunOnHost(host, 1, func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	})
+	if err != nil || attempts != 3 {
+		t.Error("Action was not retried", attempts, err)
+	}
+
+	// All attempts fail, host gets degraded
+	attempts = 0
+	err = RunOnHost(host, 2, func() error {
+		attempts++
+		return errors.New("connection refused")
+	})
+	if err == nil || attempts != 3 {
+		t.Error("Failing action was not retried", attempts, err)
+	}
+
+	// Degraded host is skipped
+	attempts = 0
+	err = RunOnHost(host, 3, func() error {
+		attempts++
+		return nil
+	})
+	if err != ErrHostDegraded || attempts != 0 {
+		t.Error("Degraded host was not skipped", attempts, err)
+	}
+
+	var state HostState
+	for _, hostState := range HostStates() {
+		if hostState.Host == host {
+			state = hostState
+		}
+	}
+	if !state.Degraded || len(state.MissedZones) != 2 || state.MissedZones[0] != 2 || state.MissedZones[1] != 3 {
+		t.Error("Unexpected host state", state)
+	}
+
+	missedConfig, zoneIds := markHostRecovered(host)
+	if missedConfig || len(zoneIds) != 2 {
+		t.Error("Missed deployments were not returned", missedConfig, zoneIds)
+	}
+
+	err = RunOnHost(host, 4, func() error { return nil })
+	if err != nil {
+		t.Error("Recovered host is still skipped", err)
+	}
+}
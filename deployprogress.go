@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	DeploymentRolePrimary   = "primary"
+	DeploymentRoleSecondary = "secondary"
+
+	DeploymentStatePending = "pending" // Not finished yet, resumed on startup if the process stopped meanwhile
+	DeploymentStateDone    = "done"
+	DeploymentStateFailed  = "failed" // See Error, degraded hosts get the zone when they recover
+)
+
+// ZoneDeployment is progress of the deployment of one serial of the zone to one name server. Deployments
+// are written before the commit starts to deploy, so name servers left behind by a restart are known.
+type ZoneDeployment struct {
+	ID        uint      `json:"-" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ZoneId   uint   `json:"zone_id" sql:"index"`
+	Serial   string `json:"serial"`
+	Host     string `json:"host"`
+	Role     string `json:"role"` // primary or secondary
+	State    string `json:"state" sql:"index"`
+	Attempts int    `json:"attempts"` // Resumed deployments are attempts too
+	Error    string `json:"error,omitempty"`
+}
+
+// Deploys the zone to the name server of the resumed deployment, replaced by tests
+var deploymentRunner = runDeployment
+
+// Starts deployments of the committed serial to the primary and secondaries, deployments of older serials
+// are replaced because the new serial supersedes them
+func startZoneDeployments(zone *Zone, secondaries []string) error {
+	db := GetDatabaseConnection()
+	tx := db.Begin()
+
+	err := tx.Where("zone_id = ?", zone.ID).Delete(&ZoneDeployment{}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	deployments := []ZoneDeployment{{Host: config.PrimaryNameServer, Role: DeploymentRolePrimary}}
+	for _, server := range secondaries {
+		deployments = append(deployments, ZoneDeployment{Host: server, Role: DeploymentRoleSecondary})
+	}
+	for _, deployment := range deployments {
+		deployment.ZoneId = zone.ID
+		deployment.Serial = zone.Serial
+		deployment.State = DeploymentStatePending
+		deployment.Attempts = 1
+		err = tx.Create(&deployment).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+// Finishes the deployment of the serial to the host, failed if deployErr isn't nil. Failure is only logged,
+// the name server is already deployed or failed.
+func finishZoneDeployment(zoneId uint, serial string, host string, deployErr error) {
+	values := map[string]interface{}{"state": DeploymentStateDone, "error": ""}
+	if deployErr != nil {
+		values["state"] = DeploymentStateFailed
+		values["error"] = deployErr.Error()
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Model(&ZoneDeployment{}).Where("zone_id = ? AND serial = ? AND host = ?", zoneId, serial, host).Updates(values).Error
+	if err != nil {
+		log.Errorf("deployment of zone " + strconv.Itoa(int(zoneId)) + " to " + host + ": " + err.Error())
+	}
+}
+
+// Finishes deployments of current serials of the zones to the host, used by catch-up of recovered hosts
+func finishHostDeployments(host string, zones []Zone) {
+	for _, zone := range zones {
+		finishZoneDeployment(zone.ID, zone.Serial, host, nil)
+	}
+}
+
+// GetZoneDeployments returns progress of the last commit of the zone on every name server
+func GetZoneDeployments(zoneId uint) ([]ZoneDeployment, error) {
+	var zone Zone
+	deployments := []ZoneDeployment{}
+
+	db := GetReadDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Where("zone_id = ?", zoneId).Order("id").Find(&deployments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return deployments, nil
+}
+
+// Loads records of the committed serial, records changed after the commit are not deployed by the resumption
+func committedZone(zoneId uint, serial string) (*Zone, error) {
+	var zone Zone
+	var version ZoneVersion
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if zone.Delete || zone.Serial != serial {
+		return nil, nil
+	}
+
+	err = db.Where("zone_id = ? AND serial = ?", zoneId, serial).Order("id desc").First(&version).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zone.Records = []Record{}
+	err = json.Unmarshal([]byte(version.Records), &zone.Records)
+	if err != nil {
+		return nil, err
+	}
+
+	return &zone, nil
+}
+
+// Deploys the zone to the name server like the commit does, everything done is safe to repeat
+func runDeployment(zone *Zone, deployment *ZoneDeployment) error {
+	if deployment.Role == DeploymentRolePrimary {
+		release := acquireDeploySlot()
+		defer release()
+
+		return RunOnHost(deployment.Host, zone.ID, func() error { return deployPrimaryZone(zone) })
+	}
+
+	err := RunOnHost(deployment.Host, zone.ID, func() error {
+		if fragmentsMode() {
+			return deployZoneFragment(deployment.Host, zone, zone.RenderSecondaryOn(deployment.Host))
+		}
+		bindConfig, err := renderSecondaryBindConfig()
+		if err != nil {
+			return err
+		}
+		return deploySecondaryBindConfig(deployment.Host, bindConfig)
+	})
+	if err != nil {
+		return err
+	}
+
+	return RunOnHost(deployment.Host, zone.ID, func() error {
+		_, err := SendCommandViaSSH(deployment.Host, "rndc refresh "+zone.Domain)
+		return err
+	})
+}
+
+// ResumeDeployments runs deployments which were pending when the process stopped. Deployments superseded
+// by a newer commit or of deleted zones are dropped, zones being committed right now are left to the commit.
+func ResumeDeployments() error {
+	var deployments []ZoneDeployment
+
+	db := GetDatabaseConnection()
+	err := db.Where("state = ?", DeploymentStatePending).Order("zone_id, id").Find(&deployments).Error
+	if err != nil {
+		return err
+	}
+
+	zones := make(map[uint][]ZoneDeployment)
+	var zoneIds []uint
+	for _, deployment := range deployments {
+		if _, ok := zones[deployment.ZoneId]; !ok {
+			zoneIds = append(zoneIds, deployment.ZoneId)
+		}
+		zones[deployment.ZoneId] = append(zones[deployment.ZoneId], deployment)
+	}
+
+	for _, zoneId := range zoneIds {
+		if !lockZoneCommit(zoneId) {
+			continue
+		}
+		resumeZoneDeployments(zoneId, zones[zoneId])
+		unlockZoneCommit(zoneId)
+	}
+
+	return nil
+}
+
+// Runs pending deployments of one zone, the primary goes first so secondaries can transfer the serial
+func resumeZoneDeployments(zoneId uint, deployments []ZoneDeployment) {
+	db := GetDatabaseConnection()
+
+	zone, err := committedZone(zoneId, deployments[0].Serial)
+	if err != nil {
+		log.Errorf("resumed deployment of zone " + strconv.Itoa(int(zoneId)) + ": " + err.Error())
+		return
+	}
+	if zone == nil {
+		db.Where("zone_id = ? AND serial = ?", zoneId, deployments[0].Serial).Delete(&ZoneDeployment{})
+		return
+	}
+
+	for _, deployment := range deployments {
+		if deployment.Role != DeploymentRolePrimary {
+			continue
+		}
+		db.Model(&ZoneDeployment{}).Where("id = ?", deployment.ID).Update("attempts", deployment.Attempts+1)
+		log.Infof("resuming deployment of " + zone.Domain + " (" + zone.Serial + ") to " + deployment.Host)
+
+		err = deploymentRunner(zone, &deployment)
+		finishZoneDeployment(zone.ID, zone.Serial, deployment.Host, err)
+		if err != nil {
+			setZoneDeployState(zone.ID, DeployStateFailed, err)
+			return
+		}
+		err = setZoneDeployState(zone.ID, DeployStateDeployed, nil)
+		if err != nil {
+			log.Errorf("resumed deployment of " + zone.Domain + ": " + err.Error())
+			return
+		}
+	}
+
+	for _, deployment := range deployments {
+		if deployment.Role != DeploymentRoleSecondary {
+			continue
+		}
+		db.Model(&ZoneDeployment{}).Where("id = ?", deployment.ID).Update("attempts", deployment.Attempts+1)
+		log.Infof("resuming deployment of " + zone.Domain + " (" + zone.Serial + ") to " + deployment.Host)
+
+		err = deploymentRunner(zone, &deployment)
+		finishZoneDeployment(zone.ID, zone.Serial, deployment.Host, err)
+		if err != nil {
+			log.Errorf("resumed deployment of " + zone.Domain + " to " + deployment.Host + ": " + err.Error())
+		}
+	}
+}
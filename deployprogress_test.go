@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResumeDeployments(t *testing.T) {
+	config.TTL = 300
+	config.SkipDeploy = true
+	defer func() {
+		config.TTL = 0
+		config.SkipDeploy = false
+	}()
+
+	zone, errs := NewZone("BU-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.NoError(t, Commit(zone.ID))
+
+	// Nothing is deployed without name servers
+	deployments, err := GetZoneDeployments(zone.ID)
+	assert.NoError(t, err)
+	assert.Len(t, deployments, 0)
+
+	// The process stopped after the commit started to deploy, the record added later isn't committed
+	zone, _ = GetStore().GetZone(zone.ID)
+	assert.NoError(t, startZoneDeployments(zone, []string{"192.0.2.53"}))
+	_, errs = NewRecord(zone.ID, "uncommitted", 300, "A", 0, "192.0.2.2")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	var deployed []string
+	deploymentRunner = func(zone *Zone, deployment *ZoneDeployment) error {
+		deployed = append(deployed, deployment.Role+" "+deployment.Host)
+		assert.Len(t, zone.Records, 1)
+		if deployment.Role == DeploymentRoleSecondary {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	defer func() { deploymentRunner = runDeployment }()
+
+	assert.NoError(t, ResumeDeployments())
+	assert.Equal(t, []string{"primary ns1.rosti.cz", "secondary 192.0.2.53"}, deployed)
+
+	deployments, err = GetZoneDeployments(zone.ID)
+	assert.NoError(t, err)
+	if assert.Len(t, deployments, 2) {
+		assert.Equal(t, DeploymentStateDone, deployments[0].State)
+		assert.Equal(t, 2, deployments[0].Attempts)
+		assert.Equal(t, zone.Serial, deployments[0].Serial)
+		assert.Equal(t, DeploymentStateFailed, deployments[1].State)
+		assert.Equal(t, "connection refused", deployments[1].Error)
+	}
+	updated, _ := GetStore().GetZone(zone.ID)
+	assert.Equal(t, DeployStateDeployed, updated.DeployState)
+
+	// Only pending deployments are resumed
+	deployed = nil
+	assert.NoError(t, ResumeDeployments())
+	assert.Len(t, deployed, 0)
+
+	// Deployments superseded by a newer serial are dropped
+	superseded := *zone
+	superseded.Serial = "2000010101"
+	assert.NoError(t, startZoneDeployments(&superseded, nil))
+	assert.NoError(t, ResumeDeployments())
+	assert.Len(t, deployed, 0)
+	deployments, err = GetZoneDeployments(zone.ID)
+	assert.NoError(t, err)
+	assert.Len(t, deployments, 0)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Deployments to the primary waiting for a free slot, DNSAPI_MAX_PARALLEL_DEPLOYS of them run at once
+var deployQueue = struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	active  int
+	waiting int
+}{}
+
+func init() {
+	deployQueue.cond = sync.NewCond(&deployQueue.lock)
+}
+
+// Has to be called with the lock held
+func updateDeployQueueMetrics() {
+	MetricsGaugeSet("dnsapi_deploy_queue_depth", "Number of commits waiting for a deployment slot", nil, float64(deployQueue.waiting))
+	MetricsGaugeSet("dnsapi_deploys_in_progress", "Number of deployments running at the moment", nil, float64(deployQueue.active))
+}
+
+// Blocks until the deployment can start, the returned function releases the slot. The limit is read on every
+// check, so raising it lets waiting deployments start.
+func acquireDeploySlot() func() {
+	started := time.Now()
+
+	deployQueue.lock.Lock()
+	deployQueue.waiting++
+	updateDeployQueueMetrics()
+	for config.MaxParallelDeploys > 0 && deployQueue.active >= config.MaxParallelDeploys {
+		deployQueue.cond.Wait()
+	}
+	deployQueue.waiting--
+	deployQueue.active++
+	updateDeployQueueMetrics()
+	deployQueue.lock.Unlock()
+
+	wait := time.Since(started).Seconds()
+	MetricsCounterAdd("dnsapi_deploy_queue_wait_seconds_total", "Time deployments waited for a slot", nil, wait)
+	MetricsCounterAdd("dnsapi_deploy_queue_waits_total", "Number of deployments which got a slot", nil, 1)
+	MetricsGaugeSet("dnsapi_deploy_queue_last_wait_seconds", "How long the last started deployment waited for a slot", nil, wait)
+
+	return func() {
+		deployQueue.lock.Lock()
+		deployQueue.active--
+		updateDeployQueueMetrics()
+		deployQueue.cond.Broadcast()
+		deployQueue.lock.Unlock()
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireDeploySlot(t *testing.T) {
+	config.MaxParallelDeploys = 1
+	defer func() {
+		config.MaxParallelDeploys = 0
+	}()
+
+	release := acquireDeploySlot()
+
+	started := make(chan bool)
+	go func() {
+		releaseSecond := acquireDeploySlot()
+		started <- true
+		releaseSecond()
+	}()
+
+	select {
+	case <-started:
+		t.Fatal("Second deployment started while the slot was taken")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Contains(t, RenderMetrics(), "dnsapi_deploy_queue_depth 1\n")
+	assert.Contains(t, RenderMetrics(), "dnsapi_deploys_in_progress 1\n")
+
+	release()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Second deployment didn't start after the slot was released")
+	}
+	assert.Contains(t, RenderMetrics(), "dnsapi_deploy_queue_waits_total")
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Label under which DKIM keys are published, RFC 6376 section 3.6.2.1
+const DKIMLabel = "_domainkey"
+
+// Shortest RSA key verifiers have to accept, RFC 8301 section 3.2
+const MinDKIMRSABits = 1024
+
+// DKIM key types, RFC 6376 and RFC 8463
+const (
+	DKIMKeyTypeRSA     = "rsa"
+	DKIMKeyTypeEd25519 = "ed25519"
+)
+
+// DKIMKey is a public key published as TXT record selector._domainkey
+type DKIMKey struct {
+	Selector  string `json:"selector"`
+	KeyType   string `json:"key_type"`   // rsa or ed25519, detected from the key if empty
+	PublicKey string `json:"public_key"` // PEM or base64 encoded key, ex. the p= tag of provider's record
+	Testing   bool   `json:"testing"`    // Publish t=y, verifiers don't treat failures differently
+	TTL       int    `json:"ttl"`
+}
+
+var dkimSelectorPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9_-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9_-]*[a-z0-9])?)*$`)
+
+// Decodes the key from PEM or base64, whitespace and p= tag of a pasted record are ignored.
+// Returns the key type and data of the p= tag: SubjectPublicKeyInfo for RSA, raw key for Ed25519.
+func parseDKIMPublicKey(keyType string, publicKey string) (string, []byte, error) {
+	var der []byte
+
+	if block, _ := pem.Decode([]byte(strings.TrimSpace(publicKey))); block != nil {
+		der = block.Bytes
+	} else {
+		encoded := strings.Join(strings.Fields(publicKey), "")
+		encoded = strings.TrimSuffix(strings.TrimPrefix(encoded, "p="), ";")
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return "", nil, errors.New("public key has to be PEM or base64 encoded")
+		}
+		der = decoded
+	}
+
+	if len(der) == ed25519.PublicKeySize && keyType != DKIMKeyTypeRSA {
+		return DKIMKeyTypeEd25519, der, nil
+	}
+
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		pkcs1, pkcs1Err := x509.ParsePKCS1PublicKey(der)
+		if pkcs1Err != nil {
+			return "", nil, errors.Wrap(err, "invalid public key")
+		}
+		key = pkcs1
+	}
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if keyType != "" && keyType != DKIMKeyTypeRSA {
+			return "", nil, errors.New("public key is RSA key, not " + keyType)
+		}
+		if key.N.BitLen() < MinDKIMRSABits {
+			return "", nil, errors.New("RSA key has to have at least " + strconv.Itoa(MinDKIMRSABits) + " bits")
+		}
+		der, err = x509.MarshalPKIXPublicKey(key)
+		if err != nil {
+			return "", nil, err
+		}
+		return DKIMKeyTypeRSA, der, nil
+	case ed25519.PublicKey:
+		if keyType != "" && keyType != DKIMKeyTypeEd25519 {
+			return "", nil, errors.New("public key is Ed25519 key, not " + keyType)
+		}
+		return DKIMKeyTypeEd25519, []byte(key), nil
+	}
+
+	return "", nil, errors.New("public key has to be RSA or Ed25519 key")
+}
+
+// Record returns the TXT record of the key, its value is split into strings when the zone is rendered
+func (k *DKIMKey) Record(domain string) (*Record, error) {
+	selector := strings.ToLower(strings.TrimSpace(k.Selector))
+	selector = strings.TrimSuffix(selector, "."+DKIMLabel)
+	if !dkimSelectorPattern.MatchString(selector) {
+		return nil, errors.New(k.Selector + " is not a valid DKIM selector")
+	}
+	keyType := strings.ToLower(k.KeyType)
+	if keyType != "" && keyType != DKIMKeyTypeRSA && keyType != DKIMKeyTypeEd25519 {
+		return nil, errors.New("key type has to be " + DKIMKeyTypeRSA + " or " + DKIMKeyTypeEd25519)
+	}
+
+	keyType, data, err := parseDKIMPublicKey(keyType, k.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	value := "v=DKIM1; k=" + keyType + "; "
+	if k.Testing {
+		value += "t=y; "
+	}
+	value += "p=" + base64.StdEncoding.EncodeToString(data)
+
+	record := &Record{Name: selector + "." + DKIMLabel, TTL: k.TTL, Type: "TXT", Value: value}
+	record.Normalize(domain)
+	return record, nil
+}
+
+// SetDKIMKey publishes the key in the zone and commits it. Records with the same name are replaced,
+// so a new key of the selector replaces the previous one.
+func SetDKIMKey(zoneId uint, key DKIMKey) (*Record, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	record, err := key.Record(zone.Domain)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return publishNameRecord(&zone, record)
+}
+
+// Replaces all records with the name of the record by the record and commits the zone, zone's records
+// have to be loaded. Used by helpers publishing one record per name like DKIM keys and DMARC policies.
+func publishNameRecord(zone *Zone, record *Record) (*Record, []error) {
+	record.ZoneId = zone.ID
+	if record.TTL == 0 {
+		record.TTL = zone.TypeTTL(record.Type)
+	}
+
+	var records []Record
+	for _, existing := range zone.Records {
+		if existing.Name != record.Name {
+			records = append(records, existing)
+		}
+	}
+	records = append(records, *record)
+
+	updated, errs := ReplaceRecords(zone.ID, records)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	err := Commit(zone.ID)
+	if err != nil && err != ErrCommitQueued && err != ErrSerialBatched {
+		return nil, []error{err}
+	}
+
+	for _, published := range updated.Records {
+		if published.Name == record.Name {
+			return &published, nil
+		}
+	}
+	return record, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetDKIMKey(t *testing.T) {
+	config.TTL = 300
+	config.SkipDeploy = true
+	defer func() {
+		config.TTL = 0
+		config.SkipDeploy = false
+	}()
+
+	zone, errs := NewZone("BJ-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString(der)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	record, errs := SetDKIMKey(zone.ID, DKIMKey{Selector: "Mail", PublicKey: pemKey})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "mail._domainkey", record.Name)
+	assert.Equal(t, "v=DKIM1; k=rsa; p="+encoded, record.Value)
+	assert.NotZero(t, record.ID)
+
+	// Rendered strings fit into character strings and the zone file gives the same key back
+	zone, err = GetStore().GetZone(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rendered := zone.Render()
+	parser := dns.NewZoneParser(strings.NewReader(rendered), dns.Fqdn(zone.Domain), "")
+	found := false
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		if txt, ok := rr.(*dns.TXT); ok && strings.HasPrefix(txt.Hdr.Name, "mail._domainkey.") {
+			found = true
+			assert.Equal(t, record.Value, strings.Join(txt.Txt, ""))
+			for _, part := range txt.Txt {
+				assert.True(t, len(part) <= 255)
+			}
+		}
+	}
+	assert.NoError(t, parser.Err())
+	assert.True(t, found)
+	records, err := ParseZoneFile(rendered, zone.Domain)
+	if assert.NoError(t, err) {
+		assert.Contains(t, records, Record{Name: "mail._domainkey", TTL: 300, Type: "TXT", Value: record.Value})
+	}
+
+	// New key of the selector replaces the previous one, a pasted p= tag is accepted
+	record, errs = SetDKIMKey(zone.ID, DKIMKey{Selector: "mail._domainkey", PublicKey: "p=" + encoded[:100] + "\n  " + encoded[100:], Testing: true})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "v=DKIM1; k=rsa; t=y; p="+encoded, record.Value)
+	zone, _ = GetStore().GetZone(zone.ID)
+	assert.Len(t, zone.Records, 1)
+
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record, errs = SetDKIMKey(zone.ID, DKIMKey{Selector: "ed", PublicKey: base64.StdEncoding.EncodeToString(edKey)})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "v=DKIM1; k=ed25519; p="+base64.StdEncoding.EncodeToString(edKey), record.Value)
+
+	weakKey := rsa.PublicKey{N: new(big.Int).Lsh(big.NewInt(1), 511), E: 65537}
+	weakDer, _ := x509.MarshalPKIXPublicKey(&weakKey)
+	_, errs = SetDKIMKey(zone.ID, DKIMKey{Selector: "weak", PublicKey: base64.StdEncoding.EncodeToString(weakDer)})
+	assert.Len(t, errs, 1)
+	_, errs = SetDKIMKey(zone.ID, DKIMKey{Selector: "bad selector", PublicKey: encoded})
+	assert.Len(t, errs, 1)
+	_, errs = SetDKIMKey(zone.ID, DKIMKey{Selector: "mail", KeyType: DKIMKeyTypeEd25519, PublicKey: encoded})
+	assert.Len(t, errs, 1)
+	_, errs = SetDKIMKey(zone.ID, DKIMKey{Selector: "mail", PublicKey: "not a key"})
+	assert.Len(t, errs, 1)
+}
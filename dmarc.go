@@ -0,0 +1,297 @@
+package main
+
+import (
+	"net/mail"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Label of names where DMARC policies are published, RFC 7489 section 6.1
+const DMARCLabel = "_dmarc"
+
+// DMARC policies of p= and sp= tags
+var DMARCPolicies = []string{"none", "quarantine", "reject"}
+
+// Tags defined by RFC 7489 section 6.3
+var dmarcTags = map[string]bool{
+	"v": true, "p": true, "sp": true, "adkim": true, "aspf": true, "pct": true,
+	"fo": true, "rf": true, "ri": true, "rua": true, "ruf": true,
+}
+
+var dmarcFailureOptionsPattern = regexp.MustCompile(`^[01ds](:[01ds])*$`)
+var dmarcReportSizePattern = regexp.MustCompile(`^[0-9]+[kmgt]?$`)
+
+// DMARCPolicy are the fields the DMARC record is built from, empty fields are not published
+type DMARCPolicy struct {
+	Name            string   `json:"name"`             // Domain the policy is for, the apex if empty
+	Policy          string   `json:"policy"`           // none, quarantine or reject
+	SubdomainPolicy string   `json:"subdomain_policy"` // Policy of subdomains, the same as policy if empty
+	Percentage      *int     `json:"percentage"`       // Percentage of messages the policy applies to, 100 if empty
+	AggregateURIs   []string `json:"aggregate_uris"`   // Where aggregate reports are sent, ex. mailto:dmarc@example.com
+	FailureURIs     []string `json:"failure_uris"`     // Where failure reports are sent
+	StrictDKIM      bool     `json:"strict_dkim"`      // adkim=s, the domain of DKIM signature has to match exactly
+	StrictSPF       bool     `json:"strict_spf"`       // aspf=s, the domain of SPF check has to match exactly
+	FailureOptions  string   `json:"failure_options"`  // When failure reports are sent, ex. 1 or d:s
+	TTL             int      `json:"ttl"`
+}
+
+// True if the record name is a DMARC policy of the apex or of a subdomain
+func isDMARCName(name string) bool {
+	return name == DMARCLabel || strings.HasPrefix(name, DMARCLabel+".")
+}
+
+// Tag of DMARC record, tags keep their order for checks of the v= tag
+type dmarcTag struct {
+	Name  string
+	Value string
+}
+
+// Splits the record into tag=value pairs
+func parseDMARCTags(value string) ([]dmarcTag, error) {
+	var tags []dmarcTag
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		pair := strings.SplitN(part, "=", 2)
+		if len(pair) != 2 {
+			return nil, errors.New("DMARC tag " + part + " has no value")
+		}
+		name := strings.ToLower(strings.TrimSpace(pair[0]))
+		if seen[name] {
+			return nil, errors.New("DMARC tag " + name + " is set more than once")
+		}
+		seen[name] = true
+		tags = append(tags, dmarcTag{Name: name, Value: strings.TrimSpace(pair[1])})
+	}
+
+	return tags, nil
+}
+
+// Checks comma separated report URIs, mailto URIs can have size limit after !
+func validateDMARCURIs(tag string, value string) error {
+	for _, uri := range strings.Split(value, ",") {
+		uri = strings.TrimSpace(uri)
+		if i := strings.LastIndex(uri, "!"); i >= 0 {
+			if !dmarcReportSizePattern.MatchString(uri[i+1:]) {
+				return errors.New(tag + ": " + uri + " has invalid size limit")
+			}
+			uri = uri[:i]
+		}
+
+		parsed, err := url.Parse(uri)
+		if err != nil || parsed.Scheme == "" {
+			return errors.New(tag + ": " + uri + " is not a valid URI, ex. mailto:dmarc@example.com")
+		}
+		switch parsed.Scheme {
+		case "mailto":
+			if _, err := mail.ParseAddress(parsed.Opaque); err != nil || parsed.Opaque == "" {
+				return errors.New(tag + ": " + uri + " has invalid email address")
+			}
+		case "http", "https":
+			if parsed.Host == "" {
+				return errors.New(tag + ": " + uri + " has no host")
+			}
+		default:
+			return errors.New(tag + ": " + uri + " has to be mailto or https URI")
+		}
+	}
+
+	return nil
+}
+
+func validDMARCPolicy(policy string) bool {
+	for _, valid := range DMARCPolicies {
+		if policy == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Validates DMARC record syntax, RFC 7489 section 6.4
+func validateDMARC(value string) error {
+	tags, err := parseDMARCTags(value)
+	if err != nil {
+		return err
+	}
+	if len(tags) == 0 || tags[0].Name != "v" || tags[0].Value != "DMARC1" {
+		return errors.New("DMARC record has to start with v=DMARC1")
+	}
+	if len(tags) < 2 || tags[1].Name != "p" {
+		return errors.New("DMARC record has to have p= tag right after v=DMARC1")
+	}
+
+	for _, tag := range tags[1:] {
+		switch tag.Name {
+		case "p", "sp":
+			if !validDMARCPolicy(tag.Value) {
+				return errors.New("DMARC tag " + tag.Name + " has to be one of " + strings.Join(DMARCPolicies, ", "))
+			}
+		case "adkim", "aspf":
+			if tag.Value != "r" && tag.Value != "s" {
+				return errors.New("DMARC tag " + tag.Name + " has to be r (relaxed) or s (strict)")
+			}
+		case "pct":
+			pct, err := strconv.Atoi(tag.Value)
+			if err != nil || pct < 0 || pct > 100 {
+				return errors.New("DMARC tag pct has to be number between 0 and 100")
+			}
+		case "ri":
+			if _, err := strconv.ParseUint(tag.Value, 10, 32); err != nil {
+				return errors.New("DMARC tag ri has to be number of seconds")
+			}
+		case "fo":
+			if !dmarcFailureOptionsPattern.MatchString(tag.Value) {
+				return errors.New("DMARC tag fo has to be colon separated list of 0, 1, d and s")
+			}
+		case "rua", "ruf":
+			if err := validateDMARCURIs(tag.Name, tag.Value); err != nil {
+				return errors.Wrap(err, "DMARC tag")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Domain of the mailto report URI, empty for other URIs
+func dmarcReportDomain(uri string) string {
+	parsed, err := url.Parse(strings.SplitN(strings.TrimSpace(uri), "!", 2)[0])
+	if err != nil || parsed.Scheme != "mailto" {
+		return ""
+	}
+	at := strings.LastIndex(parsed.Opaque, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(parsed.Opaque[at+1:])
+}
+
+// Common mistakes in DMARC records which are valid but likely don't do what was meant
+func lintDMARC(zone *Zone) []LintIssue {
+	var issues []LintIssue
+
+	counts := make(map[string]int)
+	for _, record := range zone.Records {
+		if record.Type == "TXT" && isDMARCName(record.Name) && strings.HasPrefix(record.Value, "v=DMARC1") {
+			counts[record.Name]++
+		}
+	}
+
+	for _, record := range zone.Records {
+		if record.Type != "TXT" || !isDMARCName(record.Name) {
+			continue
+		}
+		issue := func(severity string, message string) {
+			issues = append(issues, LintIssue{Severity: severity, RecordId: record.ID, Name: record.Name, Type: record.Type, Message: message})
+		}
+
+		if counts[record.Name] > 1 {
+			issue(LintSeverityError, "more DMARC records for the same name, receivers ignore all of them")
+		}
+		tags, err := parseDMARCTags(record.Value)
+		if err != nil {
+			continue
+		}
+		values := make(map[string]string)
+		for _, tag := range tags {
+			values[tag.Name] = tag.Value
+			if !dmarcTags[tag.Name] {
+				issue(LintSeverityWarning, "unknown DMARC tag "+tag.Name+" is ignored by receivers")
+			}
+		}
+
+		if values["p"] == "none" && values["rua"] == "" {
+			issue(LintSeverityWarning, "policy none without rua tag only monitors, but no reports are sent anywhere")
+		}
+		if values["pct"] != "" && values["pct"] != "100" && values["p"] == "none" {
+			issue(LintSeverityWarning, "pct has no effect with policy none")
+		}
+		if values["ruf"] != "" && values["fo"] == "" {
+			issue(LintSeverityWarning, "ruf without fo tag, failure reports are sent only when all checks fail")
+		}
+
+		// Reports to another domain need its permission, RFC 7489 section 7.1
+		for _, tag := range []string{"rua", "ruf"} {
+			if values[tag] == "" {
+				continue
+			}
+			for _, uri := range strings.Split(values[tag], ",") {
+				domain := dmarcReportDomain(uri)
+				if domain != "" && domain != strings.ToLower(zone.Domain) && !strings.HasSuffix(domain, "."+strings.ToLower(zone.Domain)) {
+					issue(LintSeverityWarning, tag+" sends reports to "+domain+", it has to publish TXT record "+
+						strings.ToLower(zone.Domain)+"._report._dmarc."+domain+" with v=DMARC1")
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+// Record returns the TXT record with the policy
+func (p *DMARCPolicy) Record(domain string) (*Record, error) {
+	name := normalizeName(p.Name, domain)
+	recordName := DMARCLabel
+	if name != "@" && name != "" {
+		recordName = DMARCLabel + "." + strings.TrimPrefix(name, DMARCLabel+".")
+	}
+
+	tags := []string{"v=DMARC1", "p=" + p.Policy}
+	if p.SubdomainPolicy != "" {
+		tags = append(tags, "sp="+p.SubdomainPolicy)
+	}
+	if p.Percentage != nil {
+		tags = append(tags, "pct="+strconv.Itoa(*p.Percentage))
+	}
+	if len(p.AggregateURIs) > 0 {
+		tags = append(tags, "rua="+strings.Join(p.AggregateURIs, ","))
+	}
+	if len(p.FailureURIs) > 0 {
+		tags = append(tags, "ruf="+strings.Join(p.FailureURIs, ","))
+	}
+	if p.StrictDKIM {
+		tags = append(tags, "adkim=s")
+	}
+	if p.StrictSPF {
+		tags = append(tags, "aspf=s")
+	}
+	if p.FailureOptions != "" {
+		tags = append(tags, "fo="+p.FailureOptions)
+	}
+
+	value := strings.Join(tags, "; ")
+	if err := validateDMARC(value); err != nil {
+		return nil, err
+	}
+
+	record := &Record{Name: recordName, TTL: p.TTL, Type: "TXT", Value: value}
+	record.Normalize(domain)
+	return record, nil
+}
+
+// SetDMARCPolicy publishes the policy in the zone and commits it, records with the same name are replaced
+func SetDMARCPolicy(zoneId uint, policy DMARCPolicy) (*Record, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	record, err := policy.Record(zone.Domain)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return publishNameRecord(&zone, record)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDMARCRecord(t *testing.T) {
+	cases := []struct {
+		value string
+		valid bool
+	}{
+		{"v=DMARC1; p=reject", true},
+		{"v=DMARC1; p=quarantine; sp=none; pct=50; adkim=s; aspf=r; fo=1:d; ri=86400; rua=mailto:dmarc@example.com!10m,https://reports.example.com/dmarc; ruf=mailto:ruf@example.com", true},
+		{"v=DMARC1;p=none;", true},
+		{"p=reject; v=DMARC1", false},
+		{"v=dmarc1; p=reject", false},
+		{"v=DMARC1; rua=mailto:dmarc@example.com; p=reject", false},
+		{"v=DMARC1; p=block", false},
+		{"v=DMARC1; p=reject; sp=never", false},
+		{"v=DMARC1; p=reject; pct=150", false},
+		{"v=DMARC1; p=reject; adkim=relaxed", false},
+		{"v=DMARC1; p=reject; fo=2", false},
+		{"v=DMARC1; p=reject; rua=dmarc@example.com", false},
+		{"v=DMARC1; p=reject; rua=mailto:not an address", false},
+		{"v=DMARC1; p=reject; rua=mailto:dmarc@example.com!10x", false},
+		{"v=DMARC1; p=reject; p=none", false},
+		{"v=DMARC1; p", false},
+	}
+
+	for _, c := range cases {
+		record := Record{Name: "_dmarc", TTL: 300, Type: "TXT", Value: c.value}
+		err := record.Validate()
+		if c.valid {
+			assert.NoError(t, err, c.value)
+		} else {
+			assert.Error(t, err, c.value)
+		}
+	}
+
+	// Other TXT records aren't checked
+	record := Record{Name: "dmarc", TTL: 300, Type: "TXT", Value: "p=reject"}
+	assert.NoError(t, record.Validate())
+}
+
+func TestLintDMARC(t *testing.T) {
+	zone := Zone{Domain: "bl-" + TEST_DOMAIN, Records: []Record{
+		{Name: "_dmarc", TTL: 300, Type: "TXT", Value: "v=DMARC1; p=none; pct=20; ruf=mailto:dmarc@reports.example.com; policy=strict"},
+		{Name: "_dmarc.shop", TTL: 300, Type: "TXT", Value: "v=DMARC1; p=reject"},
+		{Name: "_dmarc.shop", TTL: 300, Type: "TXT", Value: "v=DMARC1; p=none; rua=mailto:dmarc@bl-" + TEST_DOMAIN},
+	}}
+
+	var messages []string
+	for _, issue := range lintDMARC(&zone) {
+		messages = append(messages, issue.Severity+" "+issue.Name+": "+issue.Message)
+	}
+	assert.ElementsMatch(t, []string{
+		"warning _dmarc: unknown DMARC tag policy is ignored by receivers",
+		"warning _dmarc: policy none without rua tag only monitors, but no reports are sent anywhere",
+		"warning _dmarc: pct has no effect with policy none",
+		"warning _dmarc: ruf without fo tag, failure reports are sent only when all checks fail",
+		"warning _dmarc: ruf sends reports to reports.example.com, it has to publish TXT record bl-" + TEST_DOMAIN + "._report._dmarc.reports.example.com with v=DMARC1",
+		"error _dmarc.shop: more DMARC records for the same name, receivers ignore all of them",
+		"error _dmarc.shop: more DMARC records for the same name, receivers ignore all of them",
+	}, messages)
+}
+
+func TestSetDMARCPolicy(t *testing.T) {
+	config.TTL = 300
+	config.SkipDeploy = true
+	defer func() {
+		config.TTL = 0
+		config.SkipDeploy = false
+	}()
+
+	zone, errs := NewZone("BL-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	percentage := 25
+	record, errs := SetDMARCPolicy(zone.ID, DMARCPolicy{
+		Policy:        "quarantine",
+		Percentage:    &percentage,
+		AggregateURIs: []string{"mailto:dmarc@bl-" + TEST_DOMAIN},
+		StrictDKIM:    true,
+	})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "_dmarc", record.Name)
+	assert.Equal(t, "v=DMARC1; p=quarantine; pct=25; rua=mailto:dmarc@bl-"+TEST_DOMAIN+"; adkim=s", record.Value)
+
+	record, errs = SetDMARCPolicy(zone.ID, DMARCPolicy{Name: "shop", Policy: "reject", SubdomainPolicy: "reject"})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "_dmarc.shop", record.Name)
+	assert.Equal(t, "v=DMARC1; p=reject; sp=reject", record.Value)
+
+	// The policy replaces the previous one
+	_, errs = SetDMARCPolicy(zone.ID, DMARCPolicy{Policy: "reject"})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	zone, _ = GetStore().GetZone(zone.ID)
+	assert.Len(t, zone.Records, 2)
+
+	_, errs = SetDMARCPolicy(zone.ID, DMARCPolicy{Policy: "strict"})
+	assert.Len(t, errs, 1)
+	_, errs = SetDMARCPolicy(zone.ID, DMARCPolicy{Policy: "none", FailureURIs: []string{"ftp://example.com"}})
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Checks of the doctor
+const (
+	DoctorOrphanRecord    = "orphan_record"
+	DoctorSerial          = "serial"
+	DoctorDuplicateDomain = "duplicate_domain"
+	DoctorCharacters      = "characters"
+)
+
+// DoctorIssue is one inconsistency found in the database, target is the zone or the record. Fixable issues
+// are repaired by the doctor with --fix, the others need a decision of the operator.
+type DoctorIssue struct {
+	Check   string `json:"check"`
+	Target  string `json:"target"`
+	Message string `json:"message"`
+	Fixable bool   `json:"fixable"`
+	Fixed   bool   `json:"fixed"`
+}
+
+// DoctorReport are inconsistencies found by one run of the doctor
+type DoctorReport struct {
+	Issues []DoctorIssue `json:"issues"`
+	Fixed  int           `json:"fixed"`
+}
+
+func (r *DoctorReport) add(check string, target string, message string, fixable bool, fixed bool) {
+	r.Issues = append(r.Issues, DoctorIssue{Check: check, Target: target, Message: message, Fixable: fixable, Fixed: fixed})
+	if fixed {
+		r.Fixed++
+	}
+}
+
+// Render formats the report as aligned text lines
+func (r *DoctorReport) Render() string {
+	var output string
+	for _, issue := range r.Issues {
+		state := "manual"
+		if issue.Fixed {
+			state = "fixed"
+		} else if issue.Fixable {
+			state = "fixable"
+		}
+		output += fmt.Sprintf("%-8s %-16s %s: %s\n", state, issue.Check, issue.Target, issue.Message)
+	}
+	if len(r.Issues) == 0 {
+		return "no issues found\n"
+	}
+	output += "\n" + strconv.Itoa(len(r.Issues)) + " issues found, " + strconv.Itoa(r.Fixed) + " fixed\n"
+	return output
+}
+
+// Removes control characters and invalid UTF-8 which can't be rendered into zone files
+func renderableText(text string) string {
+	text = strings.ToValidUTF8(text, "")
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+func recordTarget(record *Record) string {
+	return "record " + strconv.Itoa(int(record.ID)) + " (" + record.Name + " " + record.Type + ")"
+}
+
+// Records checked by the doctor at once
+const DoctorBatchSize = 1000
+
+// Tells why the serial doesn't follow DNSAPI_SERIAL_FORMAT, empty if it does. Unix time serials keep
+// serials of the date format until the time passes them, so only date serials are checked.
+func serialFormatProblem(serial string) string {
+	if config.SerialFormat == SerialFormatUnixTime {
+		return ""
+	}
+	if len(serial) != 10 {
+		return "serial " + strconv.Quote(serial) + " doesn't have 10 digits of YYYYMMDDnn"
+	}
+	if _, err := time.Parse("20060102", serial[0:8]); err != nil {
+		return "serial " + strconv.Quote(serial) + " doesn't start with a valid date of YYYYMMDDnn"
+	}
+	return ""
+}
+
+// RunDoctor scans the database for inconsistencies left by older versions, interrupted operations and races:
+// records of missing zones, serials which aren't 32-bit numbers or don't follow the serial format, zones
+// of the same domain and record names or values with characters which can't be rendered. With fix it repairs
+// issues which are safe to repair, zones with repaired issues are deployed by the next commit.
+func RunDoctor(fix bool) (*DoctorReport, error) {
+	return runDoctor(fix, true)
+}
+
+// Scan of the doctor, records are checked only with checkRecords
+func runDoctor(fix bool, checkRecords bool) (*DoctorReport, error) {
+	var zones []Zone
+
+	report := &DoctorReport{Issues: []DoctorIssue{}}
+	db := GetDatabaseConnection()
+
+	err := db.Order("id").Find(&zones).Error
+	if err != nil {
+		return nil, err
+	}
+	zonesById := make(map[uint]*Zone)
+	for i := range zones {
+		zonesById[zones[i].ID] = &zones[i]
+	}
+	repaired := make(map[uint]bool)
+
+	var lastId uint
+	for checkRecords {
+		var records []Record
+		err = db.Where("id > ?", lastId).Order("id").Limit(DoctorBatchSize).Find(&records).Error
+		if err != nil {
+			return nil, err
+		}
+		if len(records) < DoctorBatchSize {
+			checkRecords = false
+		}
+
+		for i := range records {
+			record := &records[i]
+			lastId = record.ID
+			zone, ok := zonesById[record.ZoneId]
+			if !ok {
+				// Records aren't rendered without their zone, nothing depends on them
+				fixed := false
+				if fix {
+					err = db.Where("id = ?", record.ID).Delete(&Record{}).Error
+					if err != nil {
+						return nil, err
+					}
+					Audit("zone.repaired", &Zone{ID: record.ZoneId}, "removed "+recordTarget(record)+" "+record.Value+" of missing zone "+strconv.Itoa(int(record.ZoneId)))
+					fixed = true
+				}
+				report.add(DoctorOrphanRecord, recordTarget(record), "zone "+strconv.Itoa(int(record.ZoneId))+" doesn't exist", true, fixed)
+				continue
+			}
+
+			name, value := renderableText(record.Name), renderableText(record.Value)
+			if name == record.Name && value == record.Value {
+				continue
+			}
+			// Fixed only if the record stays valid without the characters
+			repairedRecord := *record
+			repairedRecord.Name, repairedRecord.Value = name, value
+			fixable := repairedRecord.Validate() == nil
+			fixed := false
+			if fix && fixable {
+				err = db.Model(record).Updates(map[string]interface{}{"name": name, "value": value}).Error
+				if err != nil {
+					return nil, err
+				}
+				Audit("zone.repaired", zone, "removed unrenderable characters of "+recordTarget(&repairedRecord))
+				repaired[zone.ID] = true
+				fixed = true
+			}
+			report.add(DoctorCharacters, recordTarget(record)+" of "+zone.Domain, "name or value contains control characters "+strconv.Quote(record.Name+" "+record.Value), fixable, fixed)
+		}
+	}
+
+	domains := make(map[string]*Zone)
+	for i := range zones {
+		zone := &zones[i]
+
+		if zone.Serial != "" {
+			if _, err := strconv.ParseUint(zone.Serial, 10, 32); err != nil {
+				invalid := zone.Serial
+				fixed := false
+				if fix {
+					// Invalid serial starts over as a new serial of the configured format
+					zone.SetNewSerial()
+					err = db.Model(zone).Update("serial", zone.Serial).Error
+					if err != nil {
+						return nil, err
+					}
+					Audit("zone.repaired", zone, "serial "+invalid+" replaced by "+zone.Serial)
+					repaired[zone.ID] = true
+					fixed = true
+				}
+				report.add(DoctorSerial, "zone "+zone.Domain, "serial "+strconv.Quote(invalid)+" isn't a 32-bit number", true, fixed)
+			} else if problem := serialFormatProblem(zone.Serial); problem != "" {
+				// New serials continue from the current one, only an older serial set by the operator starts
+				// the format over and secondaries have to get the zone again then
+				report.add(DoctorSerial, "zone "+zone.Domain, problem+", the next serial can be set by PUT /admin/zones/:zone_id/serial", false, false)
+			}
+		}
+
+		if zone.Delete {
+			continue
+		}
+		// Which of the zones is the right one is up to the operator
+		domain := strings.ToLower(strings.TrimSuffix(zone.Domain, "."))
+		if first, ok := domains[domain]; ok {
+			report.add(DoctorDuplicateDomain, "zone "+zone.Domain, "zones "+strconv.Itoa(int(first.ID))+" and "+strconv.Itoa(int(zone.ID))+" have the same domain", false, false)
+			continue
+		}
+		domains[domain] = zone
+	}
+
+	for zoneId := range repaired {
+		err = markZonePending(zoneId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// Logs inconsistencies of zones found by the doctor when the server starts, they are repaired by the doctor
+// command. Records are checked only by the command, scanning all of them would slow down every start.
+func checkDataConsistency() error {
+	report, err := runDoctor(false, false)
+	if err != nil {
+		return err
+	}
+	if len(report.Issues) == 0 {
+		return nil
+	}
+	for _, issue := range report.Issues {
+		log.Warnf("doctor: " + issue.Check + " " + issue.Target + ": " + issue.Message)
+	}
+	log.Warnf("doctor: " + strconv.Itoa(len(report.Issues)) + " issues found, run dnsapi doctor --fix to repair fixable ones")
+	return nil
+}
+
+func doctorCommand(args []string) error {
+	fix := false
+	for _, arg := range args {
+		if arg != "--fix" {
+			return errors.New("usage: dnsapi doctor [--fix]")
+		}
+		fix = true
+	}
+
+	report, err := RunDoctor(fix)
+	if err != nil {
+		return err
+	}
+	fmt.Print(report.Render())
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunDoctor(t *testing.T) {
+	zone, errs := NewZone("CD-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	// Data left by older versions and races, written around validation
+	db := GetDatabaseConnection()
+	duplicate := Zone{Domain: strings.ToUpper(zone.Domain), Serial: "2026133101"}
+	assert.NoError(t, db.Create(&duplicate).Error)
+	defer purgeZone(&duplicate)
+	orphan := Record{ZoneId: zone.ID + 100000, Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"}
+	assert.NoError(t, db.Create(&orphan).Error)
+	fixable := Record{ZoneId: zone.ID, Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1\r"}
+	assert.NoError(t, db.Create(&fixable).Error)
+	broken := Record{ZoneId: zone.ID, Name: "mail", TTL: 300, Type: "A", Value: "\n"}
+	assert.NoError(t, db.Create(&broken).Error)
+	assert.NoError(t, db.Model(zone).Update("serial", "20261014100").Error)
+
+	issues := func(report *DoctorReport) map[string]DoctorIssue {
+		found := make(map[string]DoctorIssue)
+		for _, issue := range report.Issues {
+			if strings.Contains(issue.Target, zone.Domain) || strings.Contains(issue.Target, duplicate.Domain) || strings.Contains(issue.Message, strconv.Itoa(int(zone.ID))) ||
+				strings.HasPrefix(issue.Target, "record "+strconv.Itoa(int(orphan.ID))+" ") {
+				found[issue.Check+" "+issue.Target] = issue
+			}
+		}
+		return found
+	}
+
+	report, err := RunDoctor(false)
+	assert.NoError(t, err)
+	found := issues(report)
+	assert.Len(t, found, 6)
+	assert.True(t, found[DoctorOrphanRecord+" record "+strconv.Itoa(int(orphan.ID))+" (www A)"].Fixable)
+	assert.True(t, found[DoctorCharacters+" record "+strconv.Itoa(int(fixable.ID))+" (www A) of "+zone.Domain].Fixable)
+	assert.False(t, found[DoctorCharacters+" record "+strconv.Itoa(int(broken.ID))+" (mail A) of "+zone.Domain].Fixable, "Invalid without the characters")
+	assert.True(t, found[DoctorSerial+" zone "+zone.Domain].Fixable)
+	assert.False(t, found[DoctorDuplicateDomain+" zone "+duplicate.Domain].Fixable)
+	assert.False(t, found[DoctorSerial+" zone "+duplicate.Domain].Fixable, "Date serial with an invalid date")
+	assert.Contains(t, report.Render(), "fixable  serial           zone "+zone.Domain+": serial \"20261014100\" isn't a 32-bit number\n")
+
+	// Records are checked only by the doctor command
+	report, err = runDoctor(false, false)
+	assert.NoError(t, err)
+	assert.Len(t, issues(report), 3)
+
+	report, err = RunDoctor(true)
+	assert.NoError(t, err)
+	for _, issue := range issues(report) {
+		assert.Equal(t, issue.Fixable, issue.Fixed, issue.Check)
+	}
+
+	var count int
+	assert.NoError(t, db.Model(&Record{}).Where("id = ?", orphan.ID).Count(&count).Error)
+	assert.Equal(t, 0, count, "Record of missing zone is removed")
+	var entry AuditEntry
+	assert.NoError(t, db.Where("action = ? AND zone_id = ?", "zone.repaired", orphan.ZoneId).Order("id desc").First(&entry).Error)
+	assert.Contains(t, entry.Message, recordTarget(&orphan))
+	repaired, err := GetStore().GetZone(zone.ID)
+	assert.NoError(t, err)
+	_, err = strconv.ParseUint(repaired.Serial, 10, 32)
+	assert.NoError(t, err)
+	assert.Equal(t, DeployStatePending, repaired.DeployState)
+	for _, record := range repaired.Records {
+		if record.ID == fixable.ID {
+			assert.Equal(t, "192.0.2.1", record.Value)
+		}
+	}
+
+	// Issues which need the operator stay
+	report, err = RunDoctor(false)
+	assert.NoError(t, err)
+	assert.Len(t, issues(report), 3)
+}
@@ -0,0 +1,162 @@
+package main
+
+// Results of one validation check
+const (
+	CheckPassed  = "passed"
+	CheckFailed  = "failed"
+	CheckSkipped = "skipped" // Not run because an earlier check of the record failed
+)
+
+// ValidationCheck is result of one check of one record
+type ValidationCheck struct {
+	Check     string `json:"check"`
+	Result    string `json:"result"`
+	Message   string `json:"message,omitempty"`
+	Reference string `json:"reference,omitempty"` // RFC or policy behind the check
+}
+
+// RecordExplanation lists all checks of one record in the order they ran
+type RecordExplanation struct {
+	Record Record            `json:"record"`
+	Valid  bool              `json:"valid"`
+	Checks []ValidationCheck `json:"checks"`
+}
+
+// Explanation is the result of validation in explain mode, nothing is changed by it
+type Explanation struct {
+	Valid   bool                `json:"valid"`
+	Errors  []string            `json:"errors,omitempty"` // Problems not belonging to one record, e.g. unparsable zone file
+	Records []RecordExplanation `json:"records"`
+}
+
+// Explains validation of records on given indexes, the other records are checked only as their neighbours
+// in the zone. Mirrors Record.Validate and checks of records in Zone.Validate.
+func explainRecords(zone *Zone, records []Record, indexes []int) *Explanation {
+	explanation := &Explanation{Valid: true, Records: []RecordExplanation{}}
+	conflicts := cnameConflicts(records)
+	duplicates := duplicateRecords(records)
+	bounds := zone.RecordTTLBounds()
+
+	for _, i := range indexes {
+		record := records[i]
+		recordType := GetRecordType(record.Type)
+		recordExplanation := RecordExplanation{Record: record, Valid: true}
+		addCheck := func(name string, reference string, err error) {
+			check := ValidationCheck{Check: name, Result: CheckPassed, Reference: reference}
+			if err != nil {
+				check.Result = CheckFailed
+				check.Message = err.Error()
+				recordExplanation.Valid = false
+			}
+			recordExplanation.Checks = append(recordExplanation.Checks, check)
+		}
+
+		for _, check := range recordChecks {
+			reference := check.Reference
+			if reference == "" && recordType != nil {
+				reference = recordType.Reference
+			}
+			if !recordExplanation.Valid {
+				recordExplanation.Checks = append(recordExplanation.Checks, ValidationCheck{Check: check.Name, Result: CheckSkipped, Reference: reference})
+				continue
+			}
+			addCheck(check.Name, reference, check.Check(&record, recordType))
+		}
+		if recordExplanation.Valid {
+			addCheck("ttl_bounds", "tenant's min_ttl and max_ttl, DNSAPI_POOL_TTL_BOUNDS", bounds.Check(&record))
+		} else {
+			recordExplanation.Checks = append(recordExplanation.Checks, ValidationCheck{Check: "ttl_bounds", Result: CheckSkipped})
+		}
+
+		// Checks against the other records run always, Zone.Validate doesn't stop on invalid records either
+		if record.Type == "CNAME" {
+			addCheck("cname_conflict", "RFC 1034 section 3.6.2", conflicts[i])
+		}
+		if record.Type == "A" || record.Type == "AAAA" {
+			addCheck("duplicate_address", "RFC 2181 section 5", duplicates[i])
+		} else {
+			addCheck("duplicate_record", "RFC 2181 section 5", duplicates[i])
+		}
+
+		if !recordExplanation.Valid {
+			explanation.Valid = false
+		}
+		explanation.Records = append(explanation.Records, recordExplanation)
+	}
+
+	return explanation
+}
+
+// ExplainImport explains validation of records from the zone file imported into the zone, see ImportZoneFile
+func ExplainImport(zoneId uint, content string) (*Explanation, error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := ParseImport(content, &zone)
+	if err != nil {
+		return &Explanation{Errors: []string{err.Error()}, Records: []RecordExplanation{}}, nil
+	}
+
+	// Imported records replace all records of the zone
+	var indexes []int
+	for i := range records {
+		indexes = append(indexes, i)
+	}
+
+	return explainRecords(&zone, records, indexes), nil
+}
+
+// ExplainNewRecord explains validation of a new record of the zone, see NewRecord
+func ExplainNewRecord(zoneId uint, name string, ttl int, recordType string, prio int, value string) (*Explanation, error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if ttl == 0 {
+		ttl = zone.TypeTTL(recordType)
+	}
+	record := Record{ZoneId: zone.ID, Name: name, TTL: ttl, Type: recordType, Prio: prio, Value: value}
+	record.Normalize(zone.Domain)
+	records := append(zone.Records, record)
+
+	return explainRecords(&zone, records, []int{len(records) - 1}), nil
+}
+
+// ExplainUpdateRecord explains validation of the updated record, see UpdateRecord
+func ExplainUpdateRecord(recordId uint, name string, ttl int, prio int, value string) (*Explanation, error) {
+	var record Record
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", recordId).Find(&record).Error
+	if err != nil {
+		return nil, err
+	}
+	err = db.Where("id = ?", record.ZoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var indexes []int
+	for i := range zone.Records {
+		if zone.Records[i].ID == recordId {
+			zone.Records[i].Name = name
+			zone.Records[i].TTL = ttl
+			zone.Records[i].Prio = prio
+			zone.Records[i].Value = value
+			zone.Records[i].Normalize(zone.Domain)
+			indexes = append(indexes, i)
+		}
+	}
+
+	return explainRecords(&zone, zone.Records, indexes), nil
+}
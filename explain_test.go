@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	config.TTL = 300
+	defer func() { config.TTL = 0 }()
+
+	zone, errs := NewZone("AO-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	record, errs := NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	results := func(explanation *RecordExplanation) map[string]string {
+		checks := make(map[string]string)
+		for _, check := range explanation.Checks {
+			checks[check.Check] = check.Result
+		}
+		return checks
+	}
+
+	explanation, err := ExplainNewRecord(zone.ID, "mail", 0, "a", 0, "192.0.2.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, explanation.Valid)
+	assert.Len(t, explanation.Records, 1)
+	assert.Equal(t, "A", explanation.Records[0].Record.Type)
+	assert.Equal(t, 300, explanation.Records[0].Record.TTL)
+	assert.Equal(t, map[string]string{
+		"name":              CheckPassed,
+		"ttl":               CheckPassed,
+		"type":              CheckPassed,
+		"length":            CheckPassed,
+		"value":             CheckPassed,
+		"syntax":            CheckPassed,
+		"ttl_bounds":        CheckPassed,
+		"duplicate_address": CheckPassed,
+	}, results(&explanation.Records[0]))
+	assert.Equal(t, "RFC 1035 section 3.4.1", explanation.Records[0].Checks[4].Reference)
+
+	// The failed check stops the following ones, checks against other records still run
+	explanation, err = ExplainNewRecord(zone.ID, "www", 30, "CNAME", 0, "example.com.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, explanation.Valid)
+	checks := results(&explanation.Records[0])
+	assert.Equal(t, CheckFailed, checks["ttl"])
+	assert.Equal(t, CheckSkipped, checks["value"])
+	assert.Equal(t, CheckFailed, checks["cname_conflict"])
+
+	explanation, err = ExplainUpdateRecord(record.ID, "www", 300, 0, "192.0.2.300")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, CheckFailed, results(&explanation.Records[0])["value"])
+
+	// Explained import of a legacy zone file, nothing is changed
+	explanation, err = ExplainImport(zone.ID, "www 300 A 192.0.2.5\nwww 300 A 192.0.2.5\nftp 300 CNAME www\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, explanation.Valid)
+	assert.Len(t, explanation.Records, 3)
+	assert.Equal(t, CheckPassed, results(&explanation.Records[0])["duplicate_address"])
+	assert.Equal(t, CheckFailed, results(&explanation.Records[1])["duplicate_address"])
+	assert.True(t, explanation.Records[2].Valid)
+
+	var records []Record
+	GetDatabaseConnection().Where("zone_id = ?", zone.ID).Find(&records)
+	assert.Len(t, records, 1)
+
+	explanation, err = ExplainImport(zone.ID, "www never A 192.0.2.5\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, explanation.Valid)
+	assert.Len(t, explanation.Errors, 1)
+
+	_, err = ExplainNewRecord(0, "www", 300, "A", 0, "192.0.2.1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Modes of forbidden values
+const (
+	ForbiddenModeWarn  = "warn"  // Matching records are reported by lint as warnings
+	ForbiddenModeBlock = "block" // Matching records fail validation
+)
+
+// ForbiddenValue is a rule of the admin-managed policy of record values. Pattern is a network in CIDR notation
+// matching addresses of A and AAAA records (ex. 10.0.0.0/8) or a regular expression matching the whole value
+// or, for records pointing to another name, the fully qualified target without trailing dot (ex. localhost).
+type ForbiddenValue struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Pattern     string `json:"pattern"`
+	Types       string `json:"types"`        // Record types separated by comma, empty for all types
+	ExceptPools string `json:"except_pools"` // Pools where the rule doesn't apply separated by comma, ex. internal
+	Mode        string `json:"mode"`         // warn or block
+	Reason      string `json:"reason"`       // Told to users whose record matches
+}
+
+// Validates the rule
+func (f *ForbiddenValue) Validate() []error {
+	var errorsMsgs []error
+
+	if strings.TrimSpace(f.Pattern) == "" {
+		errorsMsgs = append(errorsMsgs, errors.New("pattern of the forbidden value can't be empty"))
+	} else if _, _, err := net.ParseCIDR(f.Pattern); err != nil {
+		if _, err := regexp.Compile(f.Pattern); err != nil {
+			errorsMsgs = append(errorsMsgs, errors.New("pattern has to be a network in CIDR notation or a regular expression"))
+		}
+	}
+
+	for _, recordType := range splitList(f.Types) {
+		if GetRecordType(recordType) == nil {
+			errorsMsgs = append(errorsMsgs, errors.New(recordType+" is not a known record type"))
+		}
+	}
+
+	if f.Mode != ForbiddenModeWarn && f.Mode != ForbiddenModeBlock {
+		errorsMsgs = append(errorsMsgs, errors.New("mode has to be "+ForbiddenModeWarn+" or "+ForbiddenModeBlock))
+	}
+
+	return errorsMsgs
+}
+
+// Splits comma separated list and drops empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Returns true if the rule applies to the record in the zone and its value matches the pattern
+func (f *ForbiddenValue) Matches(record *Record, zone *Zone) bool {
+	for _, pool := range splitList(f.ExceptPools) {
+		if pool == zone.Pool {
+			return false
+		}
+	}
+
+	types := splitList(f.Types)
+	if len(types) > 0 {
+		found := false
+		for _, recordType := range types {
+			if strings.EqualFold(recordType, record.Type) {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if _, network, err := net.ParseCIDR(f.Pattern); err == nil {
+		if record.Type != "A" && record.Type != "AAAA" {
+			return false
+		}
+		ip := net.ParseIP(record.Value)
+		return ip != nil && network.Contains(ip)
+	}
+
+	pattern, err := regexp.Compile("(?i)^(?:" + f.Pattern + ")$")
+	if err != nil {
+		return false
+	}
+	if pattern.MatchString(record.Value) {
+		return true
+	}
+	if recordType := GetRecordType(record.Type); recordType != nil && recordType.Target != nil {
+		target := recordType.Target(record)
+		if target != "" && target != "." {
+			return pattern.MatchString(fqdnInZone(target, zone.Domain))
+		}
+	}
+	return false
+}
+
+// Message for the record matching the rule
+func (f *ForbiddenValue) message(record *Record) string {
+	message := "value " + record.Value + " is forbidden"
+	if f.Reason != "" {
+		message += ": " + f.Reason
+	}
+	return message
+}
+
+// Returns all rules of the policy
+func forbiddenValues() []ForbiddenValue {
+	var rules []ForbiddenValue
+
+	db := GetDatabaseConnection()
+	err := db.Order("id").Find(&rules).Error
+	if err != nil {
+		panic(err)
+	}
+
+	return rules
+}
+
+// Checks records of the zone against rules with block mode
+func validateForbiddenValues(zone *Zone) []error {
+	var errorsMsgs []error
+
+	for _, rule := range forbiddenValues() {
+		if rule.Mode != ForbiddenModeBlock {
+			continue
+		}
+		for _, record := range zone.Records {
+			if rule.Matches(&record, zone) {
+				errorsMsgs = append(errorsMsgs, errors.New(record.Type+" "+record.Name+": "+rule.message(&record)))
+			}
+		}
+	}
+
+	return errorsMsgs
+}
+
+// Reports records matching rules with warn mode
+func lintForbiddenValues(zone *Zone) []LintIssue {
+	var issues []LintIssue
+
+	for _, rule := range forbiddenValues() {
+		if rule.Mode != ForbiddenModeWarn {
+			continue
+		}
+		for _, record := range zone.Records {
+			if rule.Matches(&record, zone) {
+				issues = append(issues, LintIssue{
+					Severity: LintSeverityWarning,
+					RecordId: record.ID,
+					Name:     record.Name,
+					Type:     record.Type,
+					Message:  rule.message(&record),
+				})
+			}
+		}
+	}
+
+	return issues
+}
+
+// NewForbiddenValue adds a rule to the policy, it applies to all following changes
+func NewForbiddenValue(rule ForbiddenValue) (*ForbiddenValue, []error) {
+	rule.ID = 0
+	rule.Pattern = strings.TrimSpace(rule.Pattern)
+	rule.Types = strings.ToUpper(strings.Replace(rule.Types, " ", "", -1))
+	rule.ExceptPools = strings.Replace(rule.ExceptPools, " ", "", -1)
+
+	errs := rule.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Create(&rule).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+	Audit("forbidden_value.created", nil, rule.Mode+" "+rule.Pattern)
+
+	return &rule, nil
+}
+
+// DeleteForbiddenValue removes the rule from the policy
+func DeleteForbiddenValue(ruleId uint) error {
+	var rule ForbiddenValue
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", ruleId).Find(&rule).Error
+	if err != nil {
+		return err
+	}
+
+	err = db.Where("id = ?", ruleId).Delete(&ForbiddenValue{}).Error
+	if err != nil {
+		return err
+	}
+	Audit("forbidden_value.deleted", nil, rule.Mode+" "+rule.Pattern)
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForbiddenValues(t *testing.T) {
+	_, errs := NewForbiddenValue(ForbiddenValue{Pattern: "10.0.0.0/8", Mode: "deny"})
+	assert.Len(t, errs, 1)
+	_, errs = NewForbiddenValue(ForbiddenValue{Pattern: "(broken", Mode: ForbiddenModeBlock})
+	assert.Len(t, errs, 1)
+	_, errs = NewForbiddenValue(ForbiddenValue{Pattern: "localhost", Types: "CNAME,BOGUS", Mode: ForbiddenModeBlock})
+	assert.Len(t, errs, 1)
+
+	private, errs := NewForbiddenValue(ForbiddenValue{Pattern: "10.0.0.0/8", ExceptPools: "internal", Mode: ForbiddenModeBlock, Reason: "private network"})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteForbiddenValue(private.ID)
+	internal, errs := NewForbiddenValue(ForbiddenValue{Pattern: `.*\.corp\.example\.net`, Types: "cname, mx", Mode: ForbiddenModeWarn})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteForbiddenValue(internal.ID)
+	assert.Equal(t, "CNAME,MX", internal.Types)
+
+	zone, errs := NewZone("BF-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	_, errs = NewRecord(zone.ID, "db", 300, "A", 0, "10.1.2.3")
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "A db: value 10.1.2.3 is forbidden: private network", errs[0].Error())
+	}
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.1")
+	assert.Len(t, errs, 0)
+
+	// Warnings don't block the change
+	record, errs := NewRecord(zone.ID, "intranet", 300, "CNAME", 0, "wiki.corp.example.net.")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	GetDatabaseConnection().Where("id = ?", zone.ID).Preload("Records").Find(zone)
+	issues := lintForbiddenValues(zone)
+	if assert.Len(t, issues, 1) {
+		assert.Equal(t, record.ID, issues[0].RecordId)
+		assert.Equal(t, LintSeverityWarning, issues[0].Severity)
+	}
+
+	// Zones of excluded pools aren't checked
+	GetDatabaseConnection().Model(&Zone{}).Where("id = ?", zone.ID).Update("pool", "internal")
+	_, errs = NewRecord(zone.ID, "db", 300, "A", 0, "10.1.2.3")
+	assert.Len(t, errs, 0)
+
+	assert.NoError(t, DeleteForbiddenValue(private.ID))
+	assert.Error(t, DeleteForbiddenValue(private.ID))
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Deployment modes of zone configs
+const (
+	DeployModeMonolithic = "monolithic" // All zones are in one config file which is rewritten and reloaded on every change
+	DeployModeFragments  = "fragments"  // Every zone has its own fragment, zones are added by rndc addzone/modzone/delzone
+)
+
+// Where conf fragments of single zones are saved on all name servers
+const BindFragmentsPath = "/etc/bind/dnsapi.d"
+
+func fragmentsMode() bool {
+	return config.DeployMode == DeployModeFragments
+}
+
+// Command applying changed config file on the server
+func bindReconfigCommand() string {
+	if fragmentsMode() {
+		// Reads only the config, zones added by rndc addzone are not touched
+		return "rndc reconfig"
+	}
+	return "systemctl reload bind9"
+}
+
+// Converts rendered zone stanza into configuration accepted by rndc addzone/modzone, key blocks are left out
+func rndcZoneConfig(stanza string) string {
+	start := strings.Index(stanza, "zone \"")
+	if start < 0 {
+		return ""
+	}
+	stanza = stanza[start:]
+	stanza = stanza[strings.Index(stanza, "{"):]
+
+	return strings.Join(strings.Fields(stanza), " ")
+}
+
+// Returns key blocks of the rendered primary stanza, they have to be in the main config because rndc addzone can't add them
+func primaryKeyConfig(stanza string) string {
+	return stanza[:strings.Index(stanza, "zone \"")]
+}
+
+// Saves the fragment and adds the zone into running Bind, the zone is modified if it already exists
+func deployZoneFragment(server string, zone *Zone, stanza string) error {
+	fragment := path.Join(BindFragmentsPath, zone.Domain+".conf")
+	zoneConfig := rndcZoneConfig(stanza)
+
+	_, err := SendCommandViaSSH(server, "mkdir -p "+BindFragmentsPath)
+	if err != nil {
+		return err
+	}
+
+	err = SendDeployFileViaSSH(server, fragment, stanza)
+	if err != nil {
+		return err
+	}
+
+	output, err := SendCommandViaSSH(server, "rndc addzone "+zone.Domain+" '"+zoneConfig+"' 2>/dev/null || rndc modzone "+zone.Domain+" '"+zoneConfig+"'")
+	if err != nil {
+		if output != nil {
+			return errors.Wrap(err, output.String())
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Deploys zone file of the zone and its config to the primary server
+func deployPrimaryZone(zone *Zone) error {
+	err := deployZoneFile(zone)
+	if err != nil {
+		return err
+	}
+
+	if !fragmentsMode() {
+		return deployMasterBindConfig()
+	}
+
+	// TSIG key lives in the main config
+	if zone.TSIGKeyName() != "" {
+		err = deployMasterBindConfig()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = deployZoneFragment(config.PrimaryNameServer, zone, zone.RenderPrimary())
+	if err != nil {
+		return err
+	}
+
+	_, err = SendCommandViaSSH(config.PrimaryNameServer, "rndc reload "+zone.Domain)
+	return err
+}
+
+// Adds zones to the server in fragments mode, in monolithic mode they are part of the config and nothing is done
+func deployZoneFragments(server string, zones []Zone) error {
+	if !fragmentsMode() {
+		return nil
+	}
+
+	for _, zone := range zones {
+		stanza := zone.RenderSecondaryOn(server)
+		if server == config.PrimaryNameServer {
+			stanza = zone.RenderPrimary()
+		}
+
+		err := deployZoneFragment(server, &zone, stanza)
+		if err != nil {
+			return errors.Wrap(err, zone.Domain)
+		}
+	}
+
+	return nil
+}
+
+// Removes the zone from running Bind, its fragment and its zone file
+func removeZoneFragment(server string, zone *Zone) error {
+	_, err := SendCommandViaSSH(server, "(rndc delzone "+zone.Domain+" || true) && rm -f "+
+		path.Join(BindFragmentsPath, zone.Domain+".conf")+" "+path.Join(PrimaryZonePath, zone.Domain+".zone"))
+	return err
+}
+
+// SetSlavesZoneFragment adds or modifies one zone on all secondaries in fragments mode
+func SetSlavesZoneFragment(zone *Zone) {
+	for _, server := range SecondaryNameServerAddresses() {
+		go func(server string) {
+			err := RunOnHost(server, zone.ID, func() error {
+				return deployZoneFragment(server, zone, zone.RenderSecondaryOn(server))
+			})
+			if err != nil {
+				log.Errorf("fragment of " + zone.Domain + " on " + server + ": " + err.Error())
+			}
+		}(server)
+	}
+}
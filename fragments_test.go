@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+)
+
+const testPrimaryStanza = `key "transfer-example.com" {
+        algorithm hmac-sha256;
+        secret "c2VjcmV0";
+};
+zone "example.com" IN {
+        type master;
+        file "example.com.zone";
+        allow-transfer { 5.6.7.8; key "transfer-example.com"; };
+};
+`
+
+func TestRndcZoneConfig(t *testing.T) {
+	expected := `{ type master; file "example.com.zone"; allow-transfer { 5.6.7.8; key "transfer-example.com"; }; };`
+	if zoneConfig := rndcZoneConfig(testPrimaryStanza); zoneConfig != expected {
+		t.Error("Unexpected rndc config", zoneConfig)
+	}
+
+	if zoneConfig := rndcZoneConfig(""); zoneConfig != "" {
+		t.Error("Config rendered for empty stanza", zoneConfig)
+	}
+}
+
+func TestPrimaryKeyConfig(t *testing.T) {
+	expected := `key "transfer-example.com" {
+        algorithm hmac-sha256;
+        secret "c2VjcmV0";
+};
+`
+	if keyConfig := primaryKeyConfig(testPrimaryStanza); keyConfig != expected {
+		t.Error("Unexpected key config", keyConfig)
+	}
+}
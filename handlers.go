@@ -1,10 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
 	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
 	"strings"
 	"strconv"
+	"time"
 	"github.com/jinzhu/gorm"
 )
 
@@ -13,11 +17,27 @@ import (
 // ##############
 
 func GetZonesHandler(c echo.Context) error {
-	db := GetDatabaseConnection()
+	var filter ZoneFilter
 
-	var zones []Zone
+	// Filters
+	params := c.QueryParams()
+	if _, ok := params["pool"]; ok {
+		pool := c.QueryParam("pool")
+		filter.Pool = &pool
+	}
+	filter.State = c.QueryParam("state")
+	if dnssec := c.QueryParam("dnssec"); dnssec != "" {
+		dnssecBool, err := strconv.ParseBool(dnssec)
+		if err != nil {
+			return &echo.HTTPError{
+				Code: http.StatusBadRequest,
+				Message: "dnssec has to be true or false",
+			}
+		}
+		filter.DNSSEC = &dnssecBool
+	}
 
-	err := db.Model(&Zone{}).Preload("Records").Find(&zones).Error
+	zones, err := GetStore().ListZones(filter)
 	if err != nil {
 		panic(err)
 	}
@@ -26,13 +46,37 @@ func GetZonesHandler(c echo.Context) error {
 }
 
 func GetZoneHandler(c echo.Context) error {
-	db := GetDatabaseConnection()
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
 
-	var zoneId = c.Param("zone_id")
+	// Records committed at the given time
+	if asOf := c.QueryParam("as_of"); asOf != "" {
+		at, err := time.Parse(time.RFC3339, asOf)
+		if err != nil {
+			return &echo.HTTPError{
+				Code: http.StatusBadRequest,
+				Message: "as_of has to be a time in RFC 3339 format, ex. 2024-01-01T00:00:00Z",
+			}
+		}
 
-	var zone Zone
+		zone, err := GetZoneAsOf(uint(zoneIdInt), at)
+		if err != nil {
+			if err.Error() == RECORD_NOT_FOUND_MESSAGE || err == ErrNoZoneVersion {
+				return &echo.HTTPError{
+					Code: http.StatusNotFound,
+					Message: err.Error(),
+				}
+			}
 
-	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+			panic(err)
+		}
+
+		return c.JSONPretty(http.StatusOK, zone, "  ")
+	}
+
+	zone, err := GetStore().GetZone(uint(zoneIdInt))
 	if err != nil {
 		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
 			return &echo.HTTPError{
@@ -59,7 +103,7 @@ func NewZoneHandler(c echo.Context) error {
 		}
 	}
 
-	pzone, errs := NewZone(zone.Domain, strings.Split(zone.Tags, ","), zone.AbuseEmail)
+	pzone, errs := NewTenantZone(zone.TenantId, zone.Domain, strings.Split(zone.Tags, ","), zone.AbuseEmail)
 	if len(errs) != 0 {
 		message := ""
 		for _, err := range errs {
@@ -98,6 +142,11 @@ func DeleteZoneHandler(c echo.Context) error {
 		}
 	}
 
+	// Zone is removed from the database when it's gone from all name servers
+	if !config.SkipDeploy {
+		return c.JSONPretty(http.StatusAccepted, map[string]string{"message": "deletion started"}, "  ")
+	}
+
 	return c.JSONPretty(http.StatusOK, map[string]string{"message": "deleted"}, "  ")
 }
 
@@ -141,60 +190,53 @@ func UpdateZoneHandler(c echo.Context) error {
 	return c.JSONPretty(http.StatusOK, zone, "  ")
 }
 
-
-func CommitHandler(c echo.Context) error {
+func SetZoneTransferHandler(c echo.Context) error {
 	var zoneId = c.Param("zone_id")
+	var zoneBody Zone
 
-	zoneIdInt, err := strconv.Atoi(zoneId)
+	err := c.Bind(&zoneBody)
 	if err != nil {
-		panic(err)
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
 	}
 
-	err = Commit(uint(zoneIdInt))
+	zoneIdInt, err := strconv.Atoi(zoneId)
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return c.JSONPretty(http.StatusNotFound, map[string]string{"message": "Zone not found"}, "  ")
-		}
 		panic(err)
 	}
 
-	return c.JSONPretty(http.StatusOK, map[string]string{"message": "committed"}, "  ")
-}
-
-// ################
-// Records handlers
-// ################
-
-func GetRecordsHandler(c echo.Context) error {
-	db := GetDatabaseConnection()
-
-	zoneId := c.Param("zone_id")
-
-	var records []Record
+	zone, errs := SetZoneTransfer(uint(zoneIdInt), zoneBody.TransferIPList(), zoneBody.TSIGAlgorithm, zoneBody.TSIGSecret)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
 
-	err := db.Model(&Record{}).Where("zone_id = ?", zoneId).Find(&records).Error
-	if err != nil {
-		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
 			return &echo.HTTPError{
 				Code: http.StatusNotFound,
-				Message: strings.Trim(err.Error(), "\n"),
+				Message: strings.Trim(message, "\n"),
 			}
 		}
 
-		panic(err)
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
 	}
 
-	return c.JSONPretty(http.StatusOK, records, "  ")
+	return c.JSONPretty(http.StatusOK, zone, "  ")
 }
 
-func GetRecordHandler(c echo.Context) error {
-	db := GetDatabaseConnection()
-
-	var record Record
-
-	recordId := c.Param("record_id")
+func RequestAbuseEmailVerificationHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
 
-	err := db.Where("id = ?", recordId).Find(&record).Error
+	err = RequestAbuseEmailVerification(uint(zoneIdInt))
 	if err != nil {
 		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
 			return &echo.HTTPError{
@@ -202,41 +244,62 @@ func GetRecordHandler(c echo.Context) error {
 				Message: strings.Trim(err.Error(), "\n"),
 			}
 		}
+
 		return &echo.HTTPError{
-			Code: http.StatusInternalServerError,
+			Code: http.StatusBadRequest,
 			Message: err.Error(),
 		}
 	}
 
-	return c.JSONPretty(http.StatusOK, record, "  ")
+	return c.JSONPretty(http.StatusOK, map[string]string{"message": "verification sent"}, "  ")
 }
 
-func NewRecordHandler(c echo.Context) error {
-	var recordBody Record
-
-	err := c.Bind(&recordBody)
+// Public endpoint opened from the verification email
+func VerifyAbuseEmailHandler(c echo.Context) error {
+	zone, err := VerifyAbuseEmail(c.Param("token"))
 	if err != nil {
-		return &echo.HTTPError{
-			Code: http.StatusBadRequest,
-			Message: err.Error(),
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return c.String(http.StatusNotFound, "The link is not valid or it was already used.")
 		}
+
+		panic(err)
 	}
 
-	zoneId := c.Param("zone_id")
+	return c.String(http.StatusOK, "Abuse contact "+zone.AbuseEmail+" of "+zone.Domain+" is verified. Thank you!")
+}
 
-	zoneIdInt, err := strconv.Atoi(zoneId)
+func ApplyTemplateHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
 	if err != nil {
 		panic(err)
 	}
 
-	record, errs := NewRecord(
-		uint(zoneIdInt),
-		recordBody.Name,
-		recordBody.TTL,
-		recordBody.Type,
-		recordBody.Prio,
-		recordBody.Value,
-	)
+	templateIdInt, err := strconv.Atoi(c.Param("template_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	var change *RecordChange
+	if !isAdmin(c) {
+		err = CheckReservedTemplate(uint(zoneIdInt), uint(templateIdInt))
+		if err != nil {
+			return reservedNameError(err)
+		}
+
+		change = templateChange(uint(zoneIdInt), uint(templateIdInt))
+		request, err := ReviewChange(change, 0, changePayload(uint(templateIdInt)))
+		if err != nil {
+			if IsReservedNameError(err) {
+				return reservedNameError(err)
+			}
+			panic(err)
+		}
+		if request != nil {
+			return c.JSONPretty(http.StatusAccepted, request, "  ")
+		}
+	}
+
+	zone, errs := ApplyTemplate(uint(zoneIdInt), uint(templateIdInt))
 	if len(errs) != 0 {
 		message := ""
 		for _, err := range errs {
@@ -256,18 +319,67 @@ func NewRecordHandler(c echo.Context) error {
 		}
 	}
 
-	return c.JSONPretty(http.StatusCreated, record, "  ")
+	ChangeDone(change)
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
 }
 
-func DeleteRecordHandler(c echo.Context) error {
-	recordId := c.Param("record_id")
+func CommitHandler(c echo.Context) error {
+	var zoneId = c.Param("zone_id")
 
-	recordIdInt, err := strconv.Atoi(recordId)
+	zoneIdInt, err := strconv.Atoi(zoneId)
 	if err != nil {
 		panic(err)
 	}
 
-	err = DeleteRecord(uint(recordIdInt))
+	// Operator can deploy outside of deployment windows, ?override is ignored without the admin token
+	override, _ := strconv.ParseBool(c.QueryParam("override"))
+	override = override && isAdmin(c)
+
+	err = CommitZone(uint(zoneIdInt), override)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.JSONPretty(http.StatusNotFound, map[string]string{"message": "Zone not found"}, "  ")
+		}
+		if err == ErrCommitQueued || err == ErrSerialBatched {
+			return c.JSONPretty(http.StatusAccepted, map[string]string{"message": err.Error()}, "  ")
+		}
+		if lintErr, ok := err.(*LintError); ok {
+			return c.JSONPretty(http.StatusUnprocessableEntity, lintErr.Report, "  ")
+		}
+		if err == ErrZoneFrozen || err == ErrZoneDeleted || err == ErrCommitInProgress {
+			return &echo.HTTPError{
+				Code: http.StatusConflict,
+				Message: err.Error(),
+			}
+		}
+		if err == ErrSerialLimit {
+			return &echo.HTTPError{
+				Code: http.StatusTooManyRequests,
+				Message: err.Error(),
+			}
+		}
+		panic(err)
+	}
+
+	// Names changed by the commit are flushed from our resolvers once it's deployed
+	if flush, _ := strconv.ParseBool(c.QueryParam("flush")); flush {
+		names, err := FlushCaches(uint(zoneIdInt))
+		if err != nil {
+			return c.JSONPretty(http.StatusOK, map[string]string{"message": "committed", "flush_error": err.Error()}, "  ")
+		}
+		return c.JSONPretty(http.StatusOK, map[string]interface{}{"message": "committed", "flushed_names": names}, "  ")
+	}
+
+	return c.JSONPretty(http.StatusOK, map[string]string{"message": "committed"}, "  ")
+}
+
+func GetZoneLintHandler(c echo.Context) error {
+	db := GetDatabaseConnection()
+
+	var zone Zone
+
+	err := db.Where("id = ?", c.Param("zone_id")).Preload("Records").Find(&zone).Error
 	if err != nil {
 		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
 			return &echo.HTTPError{
@@ -276,20 +388,60 @@ func DeleteRecordHandler(c echo.Context) error {
 			}
 		}
 
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, LintZone(&zone), "  ")
+}
+
+func SetZoneDeployWindowsHandler(c echo.Context) error {
+	var zoneBody Zone
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&zoneBody)
+	if err != nil {
 		return &echo.HTTPError{
 			Code: http.StatusBadRequest,
 			Message: err.Error(),
 		}
 	}
 
-	return c.JSONPretty(http.StatusOK, map[string]string{"message": "deleted"}, "  ")
+	zone, errs := SetZoneDeployWindows(uint(zoneIdInt), zoneBody.DeployWindows)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
 }
 
-func UpdateRecordHandler(c echo.Context) error {
-	var recordId = c.Param("record_id")
-	var recordBody Record
+func SetZoneVariablesHandler(c echo.Context) error {
+	var zoneBody Zone
 
-	err := c.Bind(&recordBody)
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&zoneBody)
 	if err != nil {
 		return &echo.HTTPError{
 			Code: http.StatusBadRequest,
@@ -297,18 +449,65 @@ func UpdateRecordHandler(c echo.Context) error {
 		}
 	}
 
-	recordIdInt, err := strconv.Atoi(recordId)
+	var change *RecordChange
+	if !isAdmin(c) {
+		err = CheckReservedVariables(uint(zoneIdInt), zoneBody.Variables)
+		if err != nil {
+			return reservedNameError(err)
+		}
+
+		change = variablesChange(uint(zoneIdInt), zoneBody.Variables)
+		request, err := ReviewChange(change, 0, changePayload(zoneBody.Variables))
+		if err != nil {
+			panic(err)
+		}
+		if request != nil {
+			return c.JSONPretty(http.StatusAccepted, request, "  ")
+		}
+	}
+
+	zone, errs := SetZoneVariables(uint(zoneIdInt), zoneBody.Variables)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	ChangeDone(change)
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func SetZoneTypeTTLsHandler(c echo.Context) error {
+	var zoneBody Zone
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
 	if err != nil {
 		panic(err)
 	}
 
-	zone, errs := UpdateRecord(
-		uint(recordIdInt),
-		recordBody.Name,
-		recordBody.TTL,
-		recordBody.Prio,
-		recordBody.Value,
-	)
+	err = c.Bind(&zoneBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zone, errs := SetZoneTypeTTLs(uint(zoneIdInt), zoneBody.TypeTTLs)
 	if len(errs) != 0 {
 		message := ""
 		for _, err := range errs {
@@ -330,3 +529,3106 @@ func UpdateRecordHandler(c echo.Context) error {
 
 	return c.JSONPretty(http.StatusOK, zone, "  ")
 }
+
+func GetSOAAdviceHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	advice, err := AdviseSOATimers(uint(zoneIdInt), time.Now())
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, advice, "  ")
+}
+
+func SetZoneSOATimersHandler(c echo.Context) error {
+	var zoneBody Zone
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&zoneBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zone, errs := SetZoneSOATimers(uint(zoneIdInt), zoneBody.Refresh, zoneBody.Retry)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func SetZoneSOAExpireHandler(c echo.Context) error {
+	var zoneBody Zone
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&zoneBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zone, errs := SetZoneSOAExpire(uint(zoneIdInt), zoneBody.Expire)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func ProposeSOATimersHandler(c echo.Context) error {
+	requests, err := ProposeSOATimers(time.Now())
+	if err != nil {
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, requests, "  ")
+}
+
+func SetZoneMinimumTTLHandler(c echo.Context) error {
+	var zoneBody Zone
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&zoneBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zone, warnings, errs := SetZoneMinimumTTL(uint(zoneIdInt), zoneBody.MinimumTTL)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	if warnings == nil {
+		warnings = []LintIssue{}
+	}
+
+	return c.JSONPretty(http.StatusOK, map[string]interface{}{
+		"zone": zone,
+		"warnings": warnings,
+	}, "  ")
+}
+
+func FreezeZoneHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	var zone *Zone
+	if c.Request().Method == http.MethodDelete {
+		zone, err = UnfreezeZone(uint(zoneIdInt))
+	} else {
+		zone, err = FreezeZone(uint(zoneIdInt))
+	}
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func SetZoneWWWSyncHandler(c echo.Context) error {
+	var zoneBody Zone
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&zoneBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	var change *RecordChange
+	if !isAdmin(c) {
+		err = CheckReservedWWWSync(uint(zoneIdInt), zoneBody.WWWSync)
+		if err != nil {
+			return reservedNameError(err)
+		}
+
+		change = wwwSyncChange(uint(zoneIdInt), zoneBody.WWWSync)
+		request, err := ReviewChange(change, 0, changePayload(zoneBody.WWWSync))
+		if err != nil {
+			panic(err)
+		}
+		if request != nil {
+			return c.JSONPretty(http.StatusAccepted, request, "  ")
+		}
+	}
+
+	zone, errs := SetZoneWWWSync(uint(zoneIdInt), zoneBody.WWWSync)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	ChangeDone(change)
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func SetZoneNotesHandler(c echo.Context) error {
+	var zoneBody Zone
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&zoneBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zone, errs := SetZoneNotes(uint(zoneIdInt), zoneBody.Notes)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func SetZoneMonitorHandler(c echo.Context) error {
+	var zoneBody Zone
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&zoneBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	if !isAdmin(c) {
+		err = ValidateMonitorHost(zoneBody.MonitorURL)
+		if err != nil {
+			return &echo.HTTPError{
+				Code: http.StatusBadRequest,
+				Message: err.Error(),
+			}
+		}
+	}
+
+	zone, errs := SetZoneMonitor(uint(zoneIdInt), zoneBody.MonitorURL, zoneBody.MonitorID)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func SetZoneBindOptionsHandler(c echo.Context) error {
+	var options BindOptions
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&options)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zone, errs := SetZoneBindOptions(uint(zoneIdInt), options)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func SetNextSerialHandler(c echo.Context) error {
+	var body struct {
+		Serial string `json:"serial"`
+	}
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&body)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zone, errs := SetNextSerial(uint(zoneIdInt), body.Serial)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+// Progress of the last commit of the zone on every name server
+func GetZoneDeploymentsHandler(c echo.Context) error {
+	zoneId, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	deployments, err := GetZoneDeployments(uint(zoneId))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, deployments, "  ")
+}
+
+func GetLiveSerialsHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	zone, err := GetStore().GetZone(uint(zoneIdInt))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, map[string]interface{}{"serial": zone.Serial, "live": LiveSerials(zone)}, "  ")
+}
+
+func SetZoneStandbyHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	zone, err := SetZoneStandby(uint(zoneIdInt), c.Request().Method != http.MethodDelete)
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func GetZoneRenderHandler(c echo.Context) error {
+	db := GetReadDatabaseConnection()
+
+	var zoneId = c.Param("zone_id")
+
+	var zone Zone
+
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	content := zone.Render()
+	if notModified(c, zone.LastModified(), contentETag(content)) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.String(http.StatusOK, content)
+}
+
+// Zone in the stable JSON export format
+func GetZoneExportHandler(c echo.Context) error {
+	db := GetReadDatabaseConnection()
+
+	var zone Zone
+
+	err := db.Where("id = ?", c.Param("zone_id")).Preload("Records").Find(&zone).Error
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	export, err := ExportZone(&zone)
+	if err != nil {
+		panic(err)
+	}
+	content, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	if notModified(c, zone.LastModified(), contentETag(string(content))) {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.JSONBlob(http.StatusOK, content)
+}
+
+// Whole dataset for analytics and backups, streamed line by line
+func ExportAllHandler(c echo.Context) error {
+	var limit int
+	var err error
+
+	if c.QueryParam("limit") != "" {
+		limit, err = strconv.Atoi(c.QueryParam("limit"))
+		if err != nil || limit < 0 {
+			return &echo.HTTPError{
+				Code: http.StatusBadRequest,
+				Message: "limit has to be a positive number",
+			}
+		}
+	}
+	cursor := c.QueryParam("cursor")
+	if _, err := strconv.ParseUint(cursor, 10, 64); cursor != "" && err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: ErrInvalidCursor.Error(),
+		}
+	}
+
+	// Values are replaced the same way only within one response, a stream continued by cursor gets other ones
+	var anonymizer *Anonymizer
+	if c.QueryParam("anonymize") == "true" {
+		anonymizer, err = NewAnonymizer()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	response := c.Response()
+	response.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	response.WriteHeader(http.StatusOK)
+
+	// The status is already sent, the stream just ends early
+	access := requestAccess(c)
+	err = StreamZones(response, cursor, limit, anonymizer, func(zones []Zone) {
+		var zoneIds []uint
+		for _, zone := range zones {
+			zoneIds = append(zoneIds, zone.ID)
+		}
+		LogZoneAccess(zoneIds, access)
+		response.Flush()
+	})
+	if err != nil {
+		log.Errorf("export of all zones: " + err.Error())
+	}
+
+	return nil
+}
+
+func CompareZonesHandler(c echo.Context) error {
+	zoneIdA, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+	zoneIdB, err := strconv.Atoi(c.Param("other_zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	comparison, err := CompareZones(uint(zoneIdA), uint(zoneIdB))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, comparison, "  ")
+}
+
+// Onboarding returns 201 whenever the zone is created, statuses of its steps are in the result
+func OnboardHandler(c echo.Context) error {
+	var onboardBody OnboardRequest
+
+	err := c.Bind(&onboardBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	result, errs := Onboard(onboardBody)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusCreated, result, "  ")
+}
+
+// Manifest is CSV or JSON in the body, report of all rows is returned even if some of them failed
+func BulkCreateZonesHandler(c echo.Context) error {
+	var tenantId int
+
+	if c.QueryParam("tenant_id") != "" {
+		var err error
+		tenantId, err = strconv.Atoi(c.QueryParam("tenant_id"))
+		if err != nil {
+			return &echo.HTTPError{
+				Code: http.StatusBadRequest,
+				Message: "tenant_id has to be a number",
+			}
+		}
+	}
+
+	content, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	rows, err := ParseManifest(string(content))
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, CreateZonesFromManifest(uint(tenantId), rows), "  ")
+}
+
+func ImportZoneFileHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	content, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	if isExplain(c) {
+		explanation, err := ExplainImport(uint(zoneIdInt), string(content))
+		return explainResponse(c, explanation, err)
+	}
+
+	var change *RecordChange
+	if !isAdmin(c) {
+		zone := reservedNamesZone(uint(zoneIdInt))
+		if zone != nil {
+			records, err := ParseImport(string(content), zone)
+			if err == nil {
+				err = CheckReservedRecords(zone.ID, records)
+				if err != nil {
+					return reservedNameError(err)
+				}
+			}
+		}
+
+		change = importChange(uint(zoneIdInt), string(content))
+		request, err := ReviewChange(change, 0, string(content))
+		if err != nil {
+			if IsReservedNameError(err) {
+				return reservedNameError(err)
+			}
+			panic(err)
+		}
+		if request != nil {
+			return c.JSONPretty(http.StatusAccepted, request, "  ")
+		}
+	}
+
+	if wantsImportProgress(c) {
+		return streamImport(c, func(report func(progress ImportProgress)) (interface{}, []error) {
+			zone, errs := ImportZoneFileProgress(uint(zoneIdInt), string(content), report)
+			if len(errs) == 0 {
+				ChangeDone(change)
+			}
+			return zone, errs
+		})
+	}
+
+	zone, errs := ImportZoneFile(uint(zoneIdInt), string(content))
+	if len(errs) == 1 {
+		if linesErr, ok := errs[0].(*ImportLinesError); ok {
+			return c.JSONPretty(http.StatusBadRequest, linesErr, "  ")
+		}
+	}
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+	ChangeDone(change)
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func ImportZoneTransferHandler(c echo.Context) error {
+	var body struct {
+		Server string `json:"server"`
+	}
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&body)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	if wantsImportProgress(c) {
+		return streamImport(c, func(report func(progress ImportProgress)) (interface{}, []error) {
+			zone, skipped, errs := ImportZoneTransfer(uint(zoneIdInt), body.Server, report)
+			return ZoneTransferImport{Zone: zone, SkippedRecords: skipped}, errs
+		})
+	}
+
+	zone, skipped, errs := ImportZoneTransfer(uint(zoneIdInt), body.Server, nil)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, ZoneTransferImport{Zone: zone, SkippedRecords: skipped}, "  ")
+}
+
+func DelegateAcmeChallengeHandler(c echo.Context) error {
+	var body struct {
+		Names []string `json:"names"`
+	}
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&body)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	if !isAdmin(c) {
+		zone := reservedNamesZone(uint(zoneIdInt))
+		if zone != nil {
+			names := body.Names
+			if len(names) == 0 {
+				names = []string{"@"}
+			}
+			for _, name := range names {
+				err = CheckReservedNewRecord(zone.ID, acmeChallengeName(normalizeName(name, zone.Domain)))
+				if err != nil {
+					return reservedNameError(err)
+				}
+			}
+		}
+	}
+
+	delegations, errs := DelegateAcmeChallenge(uint(zoneIdInt), body.Names)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, delegations, "  ")
+}
+
+func SetDKIMKeyHandler(c echo.Context) error {
+	var key DKIMKey
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&key)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	if !isAdmin(c) {
+		zone := reservedNamesZone(uint(zoneIdInt))
+		if zone != nil {
+			record, err := key.Record(zone.Domain)
+			if err == nil {
+				err = CheckReservedNewRecord(zone.ID, record.Name)
+				if err != nil {
+					return reservedNameError(err)
+				}
+			}
+		}
+	}
+
+	record, errs := SetDKIMKey(uint(zoneIdInt), key)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, record, "  ")
+}
+
+func SetDMARCPolicyHandler(c echo.Context) error {
+	var policy DMARCPolicy
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&policy)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	if !isAdmin(c) {
+		zone := reservedNamesZone(uint(zoneIdInt))
+		if zone != nil {
+			record, err := policy.Record(zone.Domain)
+			if err == nil {
+				err = CheckReservedNewRecord(zone.ID, record.Name)
+				if err != nil {
+					return reservedNameError(err)
+				}
+			}
+		}
+	}
+
+	record, errs := SetDMARCPolicy(uint(zoneIdInt), policy)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, record, "  ")
+}
+
+func BulkDelegateAcmeChallengeHandler(c echo.Context) error {
+	var body struct {
+		ZoneIds []uint   `json:"zone_ids"`
+		Names   []string `json:"names"`
+	}
+
+	err := c.Bind(&body)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+	if len(body.ZoneIds) == 0 {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: "zone_ids can't be empty",
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, DelegateAcmeChallengeZones(body.ZoneIds, body.Names), "  ")
+}
+
+// Changes of reserved names without the admin token are forbidden
+func reservedNameError(err error) error {
+	return &echo.HTTPError{
+		Code: http.StatusForbidden,
+		Message: err.Error(),
+	}
+}
+
+// Validation in explain mode (?explain=true) returns its trace instead of doing the change
+func isExplain(c echo.Context) bool {
+	explain, _ := strconv.ParseBool(c.QueryParam("explain"))
+	return explain
+}
+
+func explainResponse(c echo.Context, explanation *Explanation, err error) error {
+	if err != nil {
+		if err.Error() == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: err.Error(),
+			}
+		}
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, explanation, "  ")
+}
+
+// ################
+// Records handlers
+// ################
+
+func GetRecordsHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	records, err := GetStore().ListRecords(uint(zoneIdInt))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, records, "  ")
+}
+
+func GetRecordHandler(c echo.Context) error {
+	recordIdInt, err := strconv.Atoi(c.Param("record_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	record, err := GetStore().GetRecord(uint(recordIdInt))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+		return &echo.HTTPError{
+			Code: http.StatusInternalServerError,
+			Message: err.Error(),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, record, "  ")
+}
+
+func NewRecordHandler(c echo.Context) error {
+	var recordBody Record
+
+	err := c.Bind(&recordBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zoneId := c.Param("zone_id")
+
+	zoneIdInt, err := strconv.Atoi(zoneId)
+	if err != nil {
+		panic(err)
+	}
+
+	if isExplain(c) {
+		explanation, err := ExplainNewRecord(
+			uint(zoneIdInt),
+			recordBody.Name,
+			recordBody.TTL,
+			recordBody.Type,
+			recordBody.Prio,
+			recordBody.Value,
+		)
+		return explainResponse(c, explanation, err)
+	}
+
+	var change *RecordChange
+	if !isAdmin(c) {
+		err = CheckReservedNewRecord(uint(zoneIdInt), recordBody.Name)
+		if err != nil {
+			return reservedNameError(err)
+		}
+
+		change = recordChange(ChangeOperationCreate, uint(zoneIdInt), 0, &recordBody)
+		request, err := ReviewChange(change, 0, changePayload(&recordBody))
+		if err != nil {
+			if IsReservedNameError(err) {
+				return reservedNameError(err)
+			}
+			panic(err)
+		}
+		if request != nil {
+			return c.JSONPretty(http.StatusAccepted, request, "  ")
+		}
+	}
+
+	record, errs := NewRecord(
+		uint(zoneIdInt),
+		recordBody.Name,
+		recordBody.TTL,
+		recordBody.Type,
+		recordBody.Prio,
+		recordBody.Value,
+	)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+	ChangeDone(change)
+
+	return c.JSONPretty(http.StatusCreated, record, "  ")
+}
+
+func DeleteRecordHandler(c echo.Context) error {
+	recordId := c.Param("record_id")
+
+	recordIdInt, err := strconv.Atoi(recordId)
+	if err != nil {
+		panic(err)
+	}
+
+	var change *RecordChange
+	if !isAdmin(c) {
+		err = CheckReservedRecord(uint(recordIdInt), "")
+		if err != nil {
+			return reservedNameError(err)
+		}
+
+		change = recordChange(ChangeOperationDelete, 0, uint(recordIdInt), nil)
+		request, err := ReviewChange(change, uint(recordIdInt), "")
+		if err != nil {
+			if IsReservedNameError(err) {
+				return reservedNameError(err)
+			}
+			panic(err)
+		}
+		if request != nil {
+			return c.JSONPretty(http.StatusAccepted, request, "  ")
+		}
+	}
+
+	err = DeleteRecord(uint(recordIdInt))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+	ChangeDone(change)
+
+	return c.JSONPretty(http.StatusOK, map[string]string{"message": "deleted"}, "  ")
+}
+
+// Without ?confirm= only previews the deletion, the preview's token confirms it
+func DeleteRecordsHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	filter := BulkDeleteFilter{Type: c.QueryParam("type"), NamePrefix: c.QueryParam("name_prefix")}
+	token := c.QueryParam("confirm")
+
+	var preview *BulkDeletePreview
+	if token == "" {
+		preview, err = PreviewBulkDelete(uint(zoneIdInt), filter, !isAdmin(c))
+	} else {
+		preview, err = ConfirmBulkDelete(uint(zoneIdInt), filter, token, !isAdmin(c))
+	}
+	if err != nil {
+		if err.Error() == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: err.Error(),
+			}
+		}
+		if err == ErrBulkDeleteChanged {
+			return &echo.HTTPError{
+				Code: http.StatusConflict,
+				Message: err.Error(),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+	if token == "" {
+		return c.JSONPretty(http.StatusOK, preview, "  ")
+	}
+
+	var change *RecordChange
+	if !isAdmin(c) {
+		change = &RecordChange{ZoneId: preview.ZoneId, Operation: ChangeOperationBulk, Removed: preview.Records}
+		request, err := ReviewChange(change, 0, changePayload(preview.RecordIds()))
+		if err != nil {
+			if IsReservedNameError(err) {
+				return reservedNameError(err)
+			}
+			panic(err)
+		}
+		if request != nil {
+			return c.JSONPretty(http.StatusAccepted, request, "  ")
+		}
+	}
+
+	deleted, err := DeleteRecords(preview.ZoneId, preview.RecordIds())
+	if err != nil {
+		panic(err)
+	}
+	ChangeDone(change)
+
+	return c.JSONPretty(http.StatusOK, map[string][]uint{"deleted": deleted}, "  ")
+}
+
+func UpdateRecordHandler(c echo.Context) error {
+	var recordId = c.Param("record_id")
+	var recordBody Record
+
+	err := c.Bind(&recordBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	recordIdInt, err := strconv.Atoi(recordId)
+	if err != nil {
+		panic(err)
+	}
+
+	if isExplain(c) {
+		explanation, err := ExplainUpdateRecord(
+			uint(recordIdInt),
+			recordBody.Name,
+			recordBody.TTL,
+			recordBody.Prio,
+			recordBody.Value,
+		)
+		return explainResponse(c, explanation, err)
+	}
+
+	var change *RecordChange
+	if !isAdmin(c) {
+		err = CheckReservedRecord(uint(recordIdInt), recordBody.Name)
+		if err != nil {
+			return reservedNameError(err)
+		}
+
+		change = recordChange(ChangeOperationUpdate, 0, uint(recordIdInt), &recordBody)
+		request, err := ReviewChange(change, uint(recordIdInt), changePayload(&recordBody))
+		if err != nil {
+			if IsReservedNameError(err) {
+				return reservedNameError(err)
+			}
+			panic(err)
+		}
+		if request != nil {
+			return c.JSONPretty(http.StatusAccepted, request, "  ")
+		}
+	}
+
+	zone, errs := UpdateRecord(
+		uint(recordIdInt),
+		recordBody.Name,
+		recordBody.TTL,
+		recordBody.Prio,
+		recordBody.Value,
+	)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+	ChangeDone(change)
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func SetRecordCommentHandler(c echo.Context) error {
+	var recordBody Record
+
+	recordIdInt, err := strconv.Atoi(c.Param("record_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&recordBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	if !isAdmin(c) {
+		err = CheckReservedRecord(uint(recordIdInt), "")
+		if err != nil {
+			return reservedNameError(err)
+		}
+	}
+
+	record, errs := SetRecordComment(uint(recordIdInt), recordBody.Comment)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, record, "  ")
+}
+
+func GetRecordMigrationHandler(c echo.Context) error {
+	recordIdInt, err := strconv.Atoi(c.Param("record_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	migration, err := GetRecordMigration(uint(recordIdInt))
+	if err != nil {
+		if err.Error() == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: err.Error(),
+			}
+		}
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, migration, "  ")
+}
+
+// Body contains the final ttl, prio and value of the record and optional lowered_ttl
+func StartRecordMigrationHandler(c echo.Context) error {
+	var migrationBody RecordMigrationRequest
+
+	err := c.Bind(&migrationBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	recordIdInt, err := strconv.Atoi(c.Param("record_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	// The final value is reviewed now, the migration changes it later without the token
+	var change *RecordChange
+	if !isAdmin(c) {
+		err = CheckReservedRecord(uint(recordIdInt), "")
+		if err != nil {
+			return reservedNameError(err)
+		}
+
+		change = migrationChange(uint(recordIdInt), &migrationBody)
+		request, err := ReviewChange(change, uint(recordIdInt), changePayload(&migrationBody))
+		if err != nil {
+			if IsReservedNameError(err) {
+				return reservedNameError(err)
+			}
+			panic(err)
+		}
+		if request != nil {
+			return c.JSONPretty(http.StatusAccepted, request, "  ")
+		}
+	}
+
+	migration, errs := StartRecordMigration(
+		uint(recordIdInt),
+		migrationBody.TTL,
+		migrationBody.Prio,
+		migrationBody.Value,
+		migrationBody.LoweredTTL,
+	)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	ChangeDone(change)
+
+	return c.JSONPretty(http.StatusOK, migration, "  ")
+}
+
+func CancelRecordMigrationHandler(c echo.Context) error {
+	recordIdInt, err := strconv.Atoi(c.Param("record_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	migration, err := CancelRecordMigration(uint(recordIdInt))
+	if err != nil {
+		if err.Error() == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: err.Error(),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, migration, "  ")
+}
+
+// Supported record types with JSON schemas of their bodies
+func GetRecordTypesHandler(c echo.Context) error {
+	schemas := make(map[string]interface{})
+	for _, name := range RecordTypeNames() {
+		schemas[name] = GetRecordType(name).Schema
+	}
+
+	return c.JSONPretty(http.StatusOK, schemas, "  ")
+}
+
+// ###############
+// RRsets handlers
+// ###############
+
+func GetRRSetsHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	sets, err := GetRRSets(uint(zoneIdInt))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, sets, "  ")
+}
+
+func GetRRSetHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	set, err := GetRRSet(uint(zoneIdInt), c.Param("name"), c.Param("type"))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, set, "  ")
+}
+
+// Name and type are taken from the path, the body contains ttl and records
+func ReplaceRRSetHandler(c echo.Context) error {
+	var setBody RRSet
+
+	err := c.Bind(&setBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	setBody.Name = c.Param("name")
+	setBody.Type = c.Param("type")
+
+	return replaceRRSet(c, uint(zoneIdInt), setBody)
+}
+
+func DeleteRRSetHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	return replaceRRSet(c, uint(zoneIdInt), RRSet{Name: c.Param("name"), Type: c.Param("type")})
+}
+
+// Adds one value of the body to the RRset, ex. {"value": "google-site-verification=..."}
+func AddRRSetValueHandler(c echo.Context) error {
+	var valueBody RRSetRecord
+
+	err := c.Bind(&valueBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	set, err := RRSetAddValue(uint(zoneIdInt), c.Param("name"), c.Param("type"), valueBody)
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	return replaceRRSet(c, uint(zoneIdInt), *set)
+}
+
+// Removes one value given by ?value= and ?prio= from the RRset
+func RemoveRRSetValueHandler(c echo.Context) error {
+	var prio int
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	if c.QueryParam("prio") != "" {
+		prio, err = strconv.Atoi(c.QueryParam("prio"))
+		if err != nil {
+			return &echo.HTTPError{
+				Code: http.StatusBadRequest,
+				Message: "prio has to be a number",
+			}
+		}
+	}
+
+	set, err := RRSetRemoveValue(uint(zoneIdInt), c.Param("name"), c.Param("type"), RRSetRecord{Prio: prio, Value: c.QueryParam("value")})
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	return replaceRRSet(c, uint(zoneIdInt), *set)
+}
+
+// Shared by replacement and deletion, RRset without records is deleted
+func replaceRRSet(c echo.Context, zoneId uint, set RRSet) error {
+	var change *RecordChange
+	if !isAdmin(c) {
+		zone := reservedNamesZone(zoneId)
+		if zone != nil {
+			records, err := RRSetZoneRecords(zoneId, set)
+			if err == nil {
+				err = CheckReservedRecords(zoneId, records)
+				if err != nil {
+					return reservedNameError(err)
+				}
+
+				change = replaceChange(ChangeOperationRRSet, zone, records)
+				request, err := ReviewChange(change, 0, changePayload(&set))
+				if err != nil {
+					if IsReservedNameError(err) {
+						return reservedNameError(err)
+					}
+					panic(err)
+				}
+				if request != nil {
+					return c.JSONPretty(http.StatusAccepted, request, "  ")
+				}
+			}
+		}
+	}
+
+	replaced, errs := ReplaceRRSet(zoneId, set)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+	ChangeDone(change)
+
+	if replaced == nil {
+		return c.JSONPretty(http.StatusOK, map[string]string{"message": "deleted"}, "  ")
+	}
+
+	return c.JSONPretty(http.StatusOK, replaced, "  ")
+}
+
+// Records of the owner in the body become the desired records, other records stay untouched.
+// Changes are only validated and returned with ?dry_run=true.
+func ApplyHandler(c echo.Context) error {
+	var applyBody ApplyRequest
+
+	err := c.Bind(&applyBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+	dryRun := c.QueryParam("dry_run") == "true"
+
+	var change *RecordChange
+	if !isAdmin(c) && !dryRun {
+		zone, records, _, errs := PlanApply(uint(zoneIdInt), applyBody.Owner, applyBody.Records)
+		if len(errs) == 0 {
+			err = CheckReservedRecords(zone.ID, records)
+			if err != nil {
+				return reservedNameError(err)
+			}
+
+			change = replaceChange(ChangeOperationApply, zone, records)
+			request, err := ReviewChange(change, 0, changePayload(&applyBody))
+			if err != nil {
+				if IsReservedNameError(err) {
+					return reservedNameError(err)
+				}
+				panic(err)
+			}
+			if request != nil {
+				return c.JSONPretty(http.StatusAccepted, request, "  ")
+			}
+		}
+	}
+
+	result, errs := ApplyZoneRecords(uint(zoneIdInt), applyBody.Owner, applyBody.Records, dryRun)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+	ChangeDone(change)
+
+	return c.JSONPretty(http.StatusOK, result, "  ")
+}
+
+// ###################
+// Assertions handlers
+// ###################
+
+func GetAssertionsHandler(c echo.Context) error {
+	db := GetDatabaseConnection()
+
+	zoneId := c.Param("zone_id")
+
+	var assertions []Assertion
+
+	err := db.Model(&Assertion{}).Where("zone_id = ?", zoneId).Find(&assertions).Error
+	if err != nil {
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, assertions, "  ")
+}
+
+func NewAssertionHandler(c echo.Context) error {
+	var assertionBody Assertion
+
+	err := c.Bind(&assertionBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zoneId := c.Param("zone_id")
+
+	zoneIdInt, err := strconv.Atoi(zoneId)
+	if err != nil {
+		panic(err)
+	}
+
+	assertion, errs := NewAssertion(
+		uint(zoneIdInt),
+		assertionBody.Name,
+		assertionBody.Type,
+		strings.Split(assertionBody.Expected, ","),
+		assertionBody.Mode,
+	)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusCreated, assertion, "  ")
+}
+
+func DeleteAssertionHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	assertionIdInt, err := strconv.Atoi(c.Param("assertion_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = DeleteAssertion(uint(zoneIdInt), uint(assertionIdInt))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, map[string]string{"message": "deleted"}, "  ")
+}
+
+// ##########################
+// Deployment freeze handlers
+// ##########################
+
+func GetDeployFreezesHandler(c echo.Context) error {
+	db := GetDatabaseConnection()
+
+	var freezes []DeployFreeze
+
+	err := db.Model(&DeployFreeze{}).Order("`from`").Find(&freezes).Error
+	if err != nil {
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, freezes, "  ")
+}
+
+func NewDeployFreezeHandler(c echo.Context) error {
+	var freezeBody DeployFreeze
+
+	err := c.Bind(&freezeBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	freeze, errs := NewDeployFreeze(freezeBody.From, freezeBody.To, freezeBody.Reason)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusCreated, freeze, "  ")
+}
+
+func DeleteDeployFreezeHandler(c echo.Context) error {
+	freezeIdInt, err := strconv.Atoi(c.Param("freeze_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = DeleteDeployFreeze(uint(freezeIdInt))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, map[string]string{"message": "deleted"}, "  ")
+}
+
+func GetForbiddenValuesHandler(c echo.Context) error {
+	return c.JSONPretty(http.StatusOK, forbiddenValues(), "  ")
+}
+
+func NewForbiddenValueHandler(c echo.Context) error {
+	var ruleBody ForbiddenValue
+
+	err := c.Bind(&ruleBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	rule, errs := NewForbiddenValue(ruleBody)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusCreated, rule, "  ")
+}
+
+func DeleteForbiddenValueHandler(c echo.Context) error {
+	ruleIdInt, err := strconv.Atoi(c.Param("forbidden_value_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = DeleteForbiddenValue(uint(ruleIdInt))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, map[string]string{"message": "deleted"}, "  ")
+}
+
+// ################
+// Reports handlers
+// ################
+
+// Zone of the orphaned records endpoints, 0 for the admin report of all zones
+func orphansZoneId(c echo.Context) uint {
+	if c.Param("zone_id") == "" {
+		return 0
+	}
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+	return uint(zoneIdInt)
+}
+
+func GetOrphanedRecordsHandler(c echo.Context) error {
+	orphans, err := OrphanedRecords(orphansZoneId(c))
+	if err != nil {
+		if err.Error() == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: err.Error(),
+			}
+		}
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, orphans, "  ")
+}
+
+func DeleteOrphanedRecordsHandler(c echo.Context) error {
+	var body struct {
+		RecordIds []uint `json:"record_ids"`
+	}
+
+	err := c.Bind(&body)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	// Records with reserved names are left alone without the admin token
+	if !isAdmin(c) {
+		var allowed []uint
+		for _, recordId := range body.RecordIds {
+			if CheckReservedRecord(recordId, "") == nil {
+				allowed = append(allowed, recordId)
+			}
+		}
+		body.RecordIds = allowed
+	}
+
+	var change *RecordChange
+	if !isAdmin(c) {
+		change, err = orphansChange(orphansZoneId(c), body.RecordIds)
+		if err != nil {
+			if err.Error() == RECORD_NOT_FOUND_MESSAGE {
+				return &echo.HTTPError{
+					Code: http.StatusNotFound,
+					Message: err.Error(),
+				}
+			}
+			panic(err)
+		}
+		// Approval deletes only records which were orphaned when it was requested
+		body.RecordIds = []uint{}
+		for _, record := range change.Removed {
+			body.RecordIds = append(body.RecordIds, record.ID)
+		}
+		request, err := ReviewChange(change, 0, changePayload(body.RecordIds))
+		if err != nil {
+			if IsReservedNameError(err) {
+				return reservedNameError(err)
+			}
+			panic(err)
+		}
+		if request != nil {
+			return c.JSONPretty(http.StatusAccepted, request, "  ")
+		}
+	}
+
+	deleted, err := DeleteOrphanedRecords(orphansZoneId(c), body.RecordIds)
+	if err != nil {
+		if err.Error() == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: err.Error(),
+			}
+		}
+		panic(err)
+	}
+	ChangeDone(change)
+
+	return c.JSONPretty(http.StatusOK, map[string][]uint{"deleted": deleted}, "  ")
+}
+
+func GetUsageHandler(c echo.Context) error {
+	return usageResponse(c, 0)
+}
+
+func GetExpiringZonesHandler(c echo.Context) error {
+	var err error
+
+	days := config.ExpiryWarningDays
+	if c.QueryParam("days") != "" {
+		days, err = strconv.Atoi(c.QueryParam("days"))
+		if err != nil || days < 0 {
+			return &echo.HTTPError{
+				Code: http.StatusBadRequest,
+				Message: "days has to be a positive number",
+			}
+		}
+	}
+
+	zones, err := GetExpiringZones(days, time.Now())
+	if err != nil {
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, zones, "  ")
+}
+
+// Usage as JSON or CSV with ?format=csv
+func usageResponse(c echo.Context, tenantId uint) error {
+	usages, err := GetUsage(tenantId, c.QueryParam("period"), time.Now())
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	if c.QueryParam("format") == "csv" {
+		content, err := RenderUsageCSV(usages)
+		if err != nil {
+			panic(err)
+		}
+
+		c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="usage.csv"`)
+		return c.Blob(http.StatusOK, "text/csv", []byte(content))
+	}
+
+	return c.JSONPretty(http.StatusOK, usages, "  ")
+}
+
+// ##################
+// Query log handlers
+// ##################
+
+func IngestQueryLogHandler(c echo.Context) error {
+	content, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	result, err := IngestQueryLog(string(content), time.Now())
+	if err != nil {
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, result, "  ")
+}
+
+// Report of the last ?days= (7 by default), ?limit= names (10 by default)
+func GetTopTalkersHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	days := 7
+	limit := 10
+	if c.QueryParam("days") != "" {
+		days, err = strconv.Atoi(c.QueryParam("days"))
+		if err != nil || days < 1 {
+			return &echo.HTTPError{
+				Code: http.StatusBadRequest,
+				Message: "days has to be a positive number",
+			}
+		}
+	}
+	if c.QueryParam("limit") != "" {
+		limit, err = strconv.Atoi(c.QueryParam("limit"))
+		if err != nil || limit < 1 {
+			return &echo.HTTPError{
+				Code: http.StatusBadRequest,
+				Message: "limit has to be a positive number",
+			}
+		}
+	}
+
+	report, err := GetTopTalkers(uint(zoneIdInt), days, limit, time.Now())
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, report, "  ")
+}
+
+// ####################
+// Bind config handlers
+// ####################
+
+// Aggregated stanzas of all zones for the primary (?type=primary, default) or secondaries (?type=secondary)
+func GetIncludesHandler(c echo.Context) error {
+	var content, checksum string
+	var err error
+
+	switch c.QueryParam("type") {
+	case "", "primary":
+		content, checksum, err = RenderPrimaryIncludes()
+	case "secondary":
+		content, checksum, err = RenderSecondaryIncludes()
+	default:
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: "type has to be primary or secondary",
+		}
+	}
+	if err != nil {
+		panic(err)
+	}
+
+	c.Response().Header().Set("X-Checksum-SHA256", checksum)
+	c.Response().Header().Set("ETag", "\""+checksum+"\"")
+	if c.Request().Header.Get("If-None-Match") == "\""+checksum+"\"" {
+		return c.NoContent(http.StatusNotModified)
+	}
+
+	return c.String(http.StatusOK, content)
+}
+
+// ##################
+// Audit log handlers
+// ##################
+
+func GetAuditLogHandler(c echo.Context) error {
+	db := GetReadDatabaseConnection()
+
+	var entries []AuditEntry
+
+	query := db.Model(&AuditEntry{})
+	if zoneId := c.QueryParam("zone_id"); zoneId != "" {
+		query = query.Where("zone_id = ?", zoneId)
+	}
+	if action := c.QueryParam("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+
+	err := query.Order("id").Find(&entries).Error
+	if err != nil {
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, entries, "  ")
+}
+
+// Accesses of the zone in the last ?days= (7 by default)
+func GetZoneAccessLogHandler(c echo.Context) error {
+	zoneId, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	days := 7
+	if c.QueryParam("days") != "" {
+		days, err = strconv.Atoi(c.QueryParam("days"))
+		if err != nil || days < 1 {
+			return &echo.HTTPError{
+				Code: http.StatusBadRequest,
+				Message: "days has to be a positive number",
+			}
+		}
+	}
+
+	entries, err := GetZoneAccessLog(uint(zoneId), time.Now().AddDate(0, 0, -days))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, entries, "  ")
+}
+
+func VerifyAuditLogHandler(c echo.Context) error {
+	verification, err := VerifyAuditLog()
+	if err != nil {
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, verification, "  ")
+}
+
+func GetAuditBatchesHandler(c echo.Context) error {
+	db := GetReadDatabaseConnection()
+
+	var batches = []AuditBatch{}
+
+	err := db.Order("id").Find(&batches).Error
+	if err != nil {
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, batches, "  ")
+}
+
+func SignAuditLogHandler(c echo.Context) error {
+	err := SignAuditLog()
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	return VerifyAuditLogHandler(c)
+}
+
+// ################
+// Tenants handlers
+// ################
+
+func GetTenantsHandler(c echo.Context) error {
+	db := GetReadDatabaseConnection()
+
+	var tenants []Tenant
+
+	err := db.Model(&Tenant{}).Find(&tenants).Error
+	if err != nil {
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, tenants, "  ")
+}
+
+func NewTenantHandler(c echo.Context) error {
+	var tenantBody Tenant
+
+	err := c.Bind(&tenantBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	if !isAdmin(c) {
+		err = CheckTenantLimits(0, &tenantBody)
+		if err != nil {
+			if err.Error() == RECORD_NOT_FOUND_MESSAGE {
+				return &echo.HTTPError{
+					Code: http.StatusNotFound,
+					Message: err.Error(),
+				}
+			}
+
+			return &echo.HTTPError{
+				Code: http.StatusForbidden,
+				Message: err.Error(),
+			}
+		}
+	}
+
+	tenant, errs := NewTenant(tenantBody)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusCreated, tenant, "  ")
+}
+
+func GetTenantSettingsHandler(c echo.Context) error {
+	db := GetDatabaseConnection()
+
+	var tenant Tenant
+
+	err := db.Where("id = ?", c.Param("tenant_id")).Find(&tenant).Error
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, tenant, "  ")
+}
+
+func UpdateTenantSettingsHandler(c echo.Context) error {
+	var tenantBody Tenant
+
+	err := c.Bind(&tenantBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	tenantIdInt, err := strconv.Atoi(c.Param("tenant_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	if !isAdmin(c) {
+		err = CheckTenantLimits(uint(tenantIdInt), &tenantBody)
+		if err != nil {
+			if err.Error() == RECORD_NOT_FOUND_MESSAGE {
+				return &echo.HTTPError{
+					Code: http.StatusNotFound,
+					Message: err.Error(),
+				}
+			}
+
+			return &echo.HTTPError{
+				Code: http.StatusForbidden,
+				Message: err.Error(),
+			}
+		}
+	}
+
+	tenant, errs := UpdateTenant(uint(tenantIdInt), tenantBody)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, tenant, "  ")
+}
+
+func GetTenantUsageHandler(c echo.Context) error {
+	tenantIdInt, err := strconv.Atoi(c.Param("tenant_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	return usageResponse(c, uint(tenantIdInt))
+}
+
+func DeleteTenantHandler(c echo.Context) error {
+	tenantIdInt, err := strconv.Atoi(c.Param("tenant_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = DeleteTenant(uint(tenantIdInt))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, map[string]string{"message": "deleted"}, "  ")
+}
+
+// ##################
+// Templates handlers
+// ##################
+
+func GetTemplatesHandler(c echo.Context) error {
+	db := GetReadDatabaseConnection()
+
+	var templates []Template
+
+	err := db.Model(&Template{}).Preload("Records").Find(&templates).Error
+	if err != nil {
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, templates, "  ")
+}
+
+func GetTemplateHandler(c echo.Context) error {
+	db := GetDatabaseConnection()
+
+	var template Template
+
+	err := db.Where("id = ?", c.Param("template_id")).Preload("Records").Find(&template).Error
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, template, "  ")
+}
+
+func NewTemplateHandler(c echo.Context) error {
+	var templateBody Template
+
+	err := c.Bind(&templateBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	template, errs := NewTemplate(templateBody.Name, templateBody.Records)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusCreated, template, "  ")
+}
+
+func DeleteTemplateHandler(c echo.Context) error {
+	templateIdInt, err := strconv.Atoi(c.Param("template_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = DeleteTemplate(uint(templateIdInt))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, map[string]string{"message": "deleted"}, "  ")
+}
+
+// ####################
+// Name server handlers
+// ####################
+
+func GetNameServersHandler(c echo.Context) error {
+	db := GetDatabaseConnection()
+
+	var nameServers []NameServer
+
+	err := db.Model(&NameServer{}).Order("id").Find(&nameServers).Error
+	if err != nil {
+		panic(err)
+	}
+
+	// Add health reported by deployments
+	type nameServerStatus struct {
+		NameServer
+		Degraded    bool   `json:"degraded"`
+		LastError   string `json:"last_error"`
+		MissedZones []uint `json:"missed_zones"`
+	}
+
+	states := HostStates()
+	statuses := []nameServerStatus{}
+	for _, nameServer := range nameServers {
+		status := nameServerStatus{NameServer: nameServer, MissedZones: []uint{}}
+		for _, state := range states {
+			if state.Host == nameServer.Address() {
+				status.Degraded = state.Degraded
+				status.LastError = state.LastError
+				status.MissedZones = state.MissedZones
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	return c.JSONPretty(http.StatusOK, statuses, "  ")
+}
+
+func NewNameServerHandler(c echo.Context) error {
+	var nameServerBody NameServer
+
+	err := c.Bind(&nameServerBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	nameServer, errs := NewNameServer(nameServerBody)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusCreated, nameServer, "  ")
+}
+
+func DeleteNameServerHandler(c echo.Context) error {
+	nameServerIdInt, err := strconv.Atoi(c.Param("nameserver_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = DeleteNameServer(uint(nameServerIdInt))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, map[string]string{"message": "deleted"}, "  ")
+}
+
+func UpdateNameServerFilesHandler(c echo.Context) error {
+	var nameServerBody NameServer
+
+	nameServerIdInt, err := strconv.Atoi(c.Param("nameserver_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&nameServerBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	nameServer, errs := UpdateNameServerFiles(uint(nameServerIdInt), nameServerBody.FileOwner, nameServerBody.FileGroup, nameServerBody.FileMode, nameServerBody.RestoreCon)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, nameServer, "  ")
+}
+
+func SetNameServerBindOptionsHandler(c echo.Context) error {
+	var options BindOptions
+
+	nameServerIdInt, err := strconv.Atoi(c.Param("nameserver_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&options)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	nameServer, errs := SetNameServerBindOptions(uint(nameServerIdInt), options)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, nameServer, "  ")
+}
+
+// Provisioning runs in background, only the inventory data are validated before
+func ProvisionNameServerHandler(c echo.Context) error {
+	var nameServerBody NameServer
+
+	err := c.Bind(&nameServerBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	if config.SkipDeploy {
+		return &echo.HTTPError{
+			Code: http.StatusConflict,
+			Message: "deployment is disabled by DNSAPI_SKIP_DEPLOY",
+		}
+	}
+
+	errs := ValidateProvisioning(nameServerBody)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	go func(nameServerBody NameServer) {
+		nameServer, err := ProvisionSecondary(nameServerBody)
+		if err != nil {
+			log.Errorf("provisioning of " + nameServerBody.Hostname + ": " + err.Error())
+			SendWebhook("nameserver.provisioning_failed", map[string]interface{}{"hostname": nameServerBody.Hostname, "ip": nameServerBody.IP, "error": err.Error()})
+			return
+		}
+		SendWebhook("nameserver.provisioned", nameServer)
+	}(nameServerBody)
+
+	return c.JSONPretty(http.StatusAccepted, map[string]string{"message": "provisioning started"}, "  ")
+}
+
+// Resync runs in background because it can take a long time for many zones
+func ResyncNameServerHandler(c echo.Context) error {
+	nameServer, err := FindNameServer(c.Param("nameserver_id"))
+	if err != nil {
+		if strings.Trim(err.Error(), "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(err.Error(), "\n"),
+			}
+		}
+
+		panic(err)
+	}
+
+	if config.SkipDeploy {
+		return &echo.HTTPError{
+			Code: http.StatusConflict,
+			Message: "deployment is disabled by DNSAPI_SKIP_DEPLOY",
+		}
+	}
+
+	go func(nameServer *NameServer) {
+		err := ResyncNameServer(nameServer)
+		if err != nil {
+			log.Errorf("resync of " + nameServer.Hostname + ": " + err.Error())
+			SendWebhook("nameserver.resync_failed", map[string]interface{}{"nameserver": nameServer, "error": err.Error()})
+			return
+		}
+		SendWebhook("nameserver.resynced", nameServer)
+	}(nameServer)
+
+	return c.JSONPretty(http.StatusAccepted, map[string]string{"message": "resync started"}, "  ")
+}
+
+// ##############
+// Admin handlers
+// ##############
+
+func GetRuntimeSettingsHandler(c echo.Context) error {
+	return c.JSONPretty(http.StatusOK, CurrentRuntimeSettings(), "  ")
+}
+
+// Only values in the body are changed, the rest is kept as it is
+func UpdateRuntimeSettingsHandler(c echo.Context) error {
+	// Only settings in the body are changed
+	var settingsBody map[string]json.RawMessage
+
+	err := c.Bind(&settingsBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	settings, affected, errs := UpdateRuntimeSettings(settingsBody)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, map[string]interface{}{
+		"settings": settings,
+		"affected_zones": affected,
+	}, "  ")
+}
+
+func SetZoneReservedNamesHandler(c echo.Context) error {
+	var body struct {
+		ReservedNames []string `json:"reserved_names"`
+	}
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&body)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zone, errs := SetZoneReservedNames(uint(zoneIdInt), body.ReservedNames)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+// PUT parks the zone, DELETE restores its archived records
+func ParkZoneHandler(c echo.Context) error {
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	var zone *Zone
+	var errs []error
+	if c.Request().Method == http.MethodDelete {
+		zone, errs = UnparkZone(uint(zoneIdInt))
+	} else {
+		zone, errs = ParkZone(uint(zoneIdInt))
+	}
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func SetZoneLifecycleHandler(c echo.Context) error {
+	var zoneBody Zone
+
+	zoneIdInt, err := strconv.Atoi(c.Param("zone_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	err = c.Bind(&zoneBody)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	zone, errs := SetZoneLifecycle(uint(zoneIdInt), zoneBody.Lifecycle)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, zone, "  ")
+}
+
+func SyncRPZHandler(c echo.Context) error {
+	result, err := SyncRPZ()
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, result, "  ")
+}
+
+func ExportInventoryHandler(c echo.Context) error {
+	inventory, err := ExportInventory()
+	if err != nil {
+		panic(err)
+	}
+
+	content, err := RenderInventory(inventory)
+	if err != nil {
+		panic(err)
+	}
+
+	return c.Blob(http.StatusOK, "application/yaml", []byte(content))
+}
+
+func ImportInventoryHandler(c echo.Context) error {
+	content, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	inventory, err := ParseInventory(string(content))
+	if err != nil {
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: err.Error(),
+		}
+	}
+
+	result, errs := ImportInventory(inventory)
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, result, "  ")
+}
+
+func GetChangeRequestsHandler(c echo.Context) error {
+	requests, err := GetChangeRequests(c.QueryParam("state"))
+	if err != nil {
+		panic(err)
+	}
+
+	return c.JSONPretty(http.StatusOK, requests, "  ")
+}
+
+// Approved change is done as if it was requested with the admin token
+func ApproveChangeHandler(c echo.Context) error {
+	changeIdInt, err := strconv.Atoi(c.Param("change_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	request, errs := ApproveChange(uint(changeIdInt))
+	return changeRequestResponse(c, request, errs)
+}
+
+func RejectChangeHandler(c echo.Context) error {
+	changeIdInt, err := strconv.Atoi(c.Param("change_id"))
+	if err != nil {
+		panic(err)
+	}
+
+	request, errs := RejectChange(uint(changeIdInt))
+	return changeRequestResponse(c, request, errs)
+}
+
+func changeRequestResponse(c echo.Context, request *ChangeRequest, errs []error) error {
+	if len(errs) != 0 {
+		message := ""
+		for _, err := range errs {
+			message += "\n" + err.Error()
+		}
+
+		if strings.Trim(message, "\n") == RECORD_NOT_FOUND_MESSAGE {
+			return &echo.HTTPError{
+				Code: http.StatusNotFound,
+				Message: strings.Trim(message, "\n"),
+			}
+		}
+
+		return &echo.HTTPError{
+			Code: http.StatusBadRequest,
+			Message: strings.Trim(message, "\n"),
+		}
+	}
+
+	return c.JSONPretty(http.StatusOK, request, "  ")
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"github.com/stretchr/testify/assert"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func TestGetZonesHandler(t *testing.T) {
@@ -22,4 +24,146 @@ func TestGetZonesHandler(t *testing.T) {
 		assert.Equal(t, http.StatusOK, recorder.Code)
 		// TODO: test content
 	}
-}
\ No newline at end of file
+}
+func TestGetZoneRenderHandler(t *testing.T) {
+	zone, errs := NewZone("H-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "1.2.3.4")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// Setup
+	e := echo.New()
+	request := httptest.NewRequest(echo.GET, "/", strings.NewReader(""))
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+	context.SetPath("/zones/:zone_id/render")
+	context.SetParamNames("zone_id")
+	context.SetParamValues(strconv.Itoa(int(zone.ID)))
+
+	// Assertions
+	if assert.NoError(t, GetZoneRenderHandler(context)) {
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "www    300s    A      1.2.3.4")
+	}
+}
+
+func TestGetZoneRenderHandler_conditional(t *testing.T) {
+	zone, errs := NewZone("AD-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "1.2.3.4")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	render := func(header string, value string) *httptest.ResponseRecorder {
+		e := echo.New()
+		request := httptest.NewRequest(echo.GET, "/", strings.NewReader(""))
+		if header != "" {
+			request.Header.Set(header, value)
+		}
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+		context.SetPath("/zones/:zone_id/render")
+		context.SetParamNames("zone_id")
+		context.SetParamValues(strconv.Itoa(int(zone.ID)))
+
+		assert.NoError(t, GetZoneRenderHandler(context))
+		return recorder
+	}
+
+	first := render("", "")
+	assert.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	lastModified := first.Header().Get(echo.HeaderLastModified)
+	assert.NotEmpty(t, etag)
+	assert.NotEmpty(t, lastModified)
+
+	assert.Equal(t, http.StatusNotModified, render("If-None-Match", etag).Code)
+	assert.Equal(t, http.StatusNotModified, render(echo.HeaderIfModifiedSince, lastModified).Code)
+	assert.Equal(t, http.StatusOK, render(echo.HeaderIfModifiedSince, time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)).Code)
+
+	// Changed zone is downloaded again
+	_, errs = NewRecord(zone.ID, "ftp", 300, "A", 0, "1.2.3.5")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	second := render("If-None-Match", etag)
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Contains(t, second.Body.String(), "1.2.3.5")
+}
+
+func TestGetZonesHandler_filters(t *testing.T) {
+	zone, errs := NewZone("O-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, err := FreezeZone(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Setup
+	e := echo.New()
+	request := httptest.NewRequest(echo.GET, "/zones/?state=frozen&dnssec=false", strings.NewReader(""))
+	recorder := httptest.NewRecorder()
+	context := e.NewContext(request, recorder)
+
+	// Assertions
+	if assert.NoError(t, GetZonesHandler(context)) {
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "o-"+TEST_DOMAIN)
+		assert.NotContains(t, recorder.Body.String(), "a-"+TEST_DOMAIN)
+	}
+
+	request = httptest.NewRequest(echo.GET, "/zones/?dnssec=maybe", strings.NewReader(""))
+	recorder = httptest.NewRecorder()
+	context = e.NewContext(request, recorder)
+	assert.Error(t, GetZonesHandler(context))
+}
+
+func TestUpdateTenantSettingsHandler_limits(t *testing.T) {
+	tenant, errs := NewTenant(Tenant{Name: "Free tier", DefaultPool: "free", MinTTL: 3600})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteTenant(tenant.ID)
+
+	e := echo.New()
+	update := func(body string, admin bool) error {
+		request := httptest.NewRequest(echo.PUT, "/tenants/"+strconv.Itoa(int(tenant.ID))+"/settings", strings.NewReader(body))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		context := e.NewContext(request, httptest.NewRecorder())
+		context.SetParamNames("tenant_id")
+		context.SetParamValues(strconv.Itoa(int(tenant.ID)))
+		context.Set("admin", admin)
+		return UpdateTenantSettingsHandler(context)
+	}
+
+	// The customer token can't leave the limits of the tenant
+	for _, body := range []string{`{"default_pool": "free", "min_ttl": 0}`, `{"default_pool": "free", "min_ttl": 3600, "max_ttl": 60}`, `{"min_ttl": 3600}`} {
+		err := update(body, false)
+		if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok, body) {
+			assert.Equal(t, http.StatusForbidden, httpErr.Code, body)
+		}
+	}
+	assert.NoError(t, update(`{"name": "Renamed", "default_pool": "free", "min_ttl": 3600}`, false))
+	assert.NoError(t, update(`{"name": "Renamed", "default_pool": "free", "min_ttl": 600}`, true))
+
+	var updated Tenant
+	assert.NoError(t, GetDatabaseConnection().Where("id = ?", tenant.ID).Find(&updated).Error)
+	assert.Equal(t, 600, updated.MinTTL)
+
+	request := httptest.NewRequest(echo.POST, "/tenants/", strings.NewReader(`{"name": "Unbounded", "max_ttl": 86400}`))
+	request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	err := NewTenantHandler(e.NewContext(request, httptest.NewRecorder()))
+	if httpErr, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusForbidden, httpErr.Code)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"github.com/labstack/echo"
+	"github.com/labstack/gommon/log"
+)
+
+// ValidateHook checks the zone before its own validation, ex. a billing check of the number of records.
+// Returned error is reported together with validation errors.
+type ValidateHook func(zone *Zone) error
+
+// PreCommitHook can refuse the commit of the zone, the error is returned by the commit
+type PreCommitHook func(zone *Zone) error
+
+// PostCommitHook is called after the zone got a new serial and its deployment started
+type PostCommitHook func(zone *Zone)
+
+// Hooks and middleware of embedding applications, registered before the server starts
+var (
+	validateHooks     []ValidateHook
+	preCommitHooks    []PreCommitHook
+	postCommitHooks   []PostCommitHook
+	customMiddlewares []echo.MiddlewareFunc
+)
+
+// RegisterValidateHook adds a check run at the start of every zone validation
+func RegisterValidateHook(hook ValidateHook) {
+	validateHooks = append(validateHooks, hook)
+}
+
+// RegisterPreCommitHook adds a check run before every commit, after the zone passed lint
+func RegisterPreCommitHook(hook PreCommitHook) {
+	preCommitHooks = append(preCommitHooks, hook)
+}
+
+// RegisterPostCommitHook adds a function called after every commit
+func RegisterPostCommitHook(hook PostCommitHook) {
+	postCommitHooks = append(postCommitHooks, hook)
+}
+
+// RegisterMiddleware adds the middleware to all routes, it runs after the token is checked
+func RegisterMiddleware(middleware echo.MiddlewareFunc) {
+	customMiddlewares = append(customMiddlewares, middleware)
+}
+
+func runValidateHooks(zone *Zone) []error {
+	var errs []error
+	for _, hook := range validateHooks {
+		if err := hook(zone); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+func runPreCommitHooks(zone *Zone) error {
+	for _, hook := range preCommitHooks {
+		if err := hook(zone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Panics of hooks don't break the commit which is already done
+func runPostCommitHooks(zone *Zone) {
+	for _, hook := range postCommitHooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Errorf("post-commit hook of %s: %v", zone.Domain, r)
+				}
+			}()
+			hook(zone)
+		}()
+	}
+}
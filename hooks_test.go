@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHooks(t *testing.T) {
+	config.SkipDeploy = true
+	defer func() {
+		config.SkipDeploy = false
+		validateHooks = nil
+		preCommitHooks = nil
+		postCommitHooks = nil
+	}()
+
+	zone, errs := NewZone("AX-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	RegisterValidateHook(func(validated *Zone) error {
+		if validated.ID == zone.ID && len(validated.Records) > 1 {
+			return errors.New("plan allows one record")
+		}
+		return nil
+	})
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.1")
+	assert.Len(t, errs, 0)
+	_, errs = NewRecord(zone.ID, "mail", 300, "A", 0, "192.0.2.2")
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, "plan allows one record", errs[0].Error())
+	}
+
+	refused := true
+	RegisterPreCommitHook(func(committed *Zone) error {
+		if refused {
+			return errors.New("unpaid invoice")
+		}
+		return nil
+	})
+	var committed []string
+	RegisterPostCommitHook(func(zone *Zone) {
+		committed = append(committed, zone.Domain)
+	})
+	RegisterPostCommitHook(func(zone *Zone) {
+		panic("broken hook")
+	})
+
+	err := Commit(zone.ID)
+	assert.EqualError(t, err, "unpaid invoice")
+	assert.Len(t, committed, 0)
+
+	refused = false
+	err = Commit(zone.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{zone.Domain}, committed)
+}
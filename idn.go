@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Prefix of labels of internationalized names in punycode, RFC 5891 section 4.2.1
+const ACEPrefix = "xn--"
+
+func isASCII(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// Converts labels written in Unicode to punycode, ex. pošta to xn--pota-s3a. ASCII labels are kept as they
+// are, labels which can't be converted too and validation of the name refuses them.
+func asciiName(name string) string {
+	if isASCII(name) {
+		return name
+	}
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if isASCII(label) {
+			continue
+		}
+		converted, err := idna.Lookup.ToASCII(label)
+		if err == nil {
+			labels[i] = converted
+		}
+	}
+	return strings.Join(labels, ".")
+}
+
+// Unicode form of the name with punycode labels, empty if the name has none
+func unicodeName(name string) string {
+	if !strings.Contains(name, ACEPrefix) {
+		return ""
+	}
+
+	labels := strings.Split(name, ".")
+	for i, label := range labels {
+		if !strings.HasPrefix(label, ACEPrefix) {
+			continue
+		}
+		converted, err := idna.Lookup.ToUnicode(label)
+		if err == nil {
+			labels[i] = converted
+		}
+	}
+
+	unicode := strings.Join(labels, ".")
+	if unicode == name {
+		return ""
+	}
+	return unicode
+}
+
+// MarshalJSON adds domain_unicode to zones of internationalized domains
+func (z Zone) MarshalJSON() ([]byte, error) {
+	type zone Zone
+	return json.Marshal(struct {
+		zone
+		DomainUnicode string `json:"domain_unicode,omitempty"`
+	}{zone(z), unicodeName(z.Domain)})
+}
+
+// MarshalJSON adds name_unicode to records with internationalized names
+func (r Record) MarshalJSON() ([]byte, error) {
+	type record Record
+	return json.Marshal(struct {
+		record
+		NameUnicode string `json:"name_unicode,omitempty"`
+	}{record(r), unicodeName(r.Name)})
+}
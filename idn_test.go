@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIDNNames(t *testing.T) {
+	assert.Equal(t, "xn--pota-h6a", asciiName("pošta"))
+	assert.Equal(t, "_dmarc.xn--pota-h6a", asciiName("_dmarc.pošta"))
+	assert.Equal(t, "*.xn--pota-h6a.xn--luouk-uva4it5a4g.cz", asciiName("*.pošta.žluťoučký.cz"))
+	assert.Equal(t, "www.example.com", asciiName("www.example.com"))
+
+	assert.Equal(t, "pošta.žluťoučký.cz", unicodeName("xn--pota-h6a.xn--luouk-uva4it5a4g.cz"))
+	assert.Equal(t, "", unicodeName("www.example.com"))
+	assert.Equal(t, "pošta", unicodeName("xn--pota-h6a"))
+
+	assert.Equal(t, "xn--pota-h6a", normalizeName("Pošta.žluťoučký.cz.", "xn--luouk-uva4it5a4g.cz"))
+	assert.Equal(t, "@", normalizeName("žluťoučký.cz.", "žluťoučký.cz"))
+}
+
+func TestIDNZone(t *testing.T) {
+	config.TTL = 300
+	defer func() { config.TTL = 0 }()
+
+	zone, errs := NewZone("BR-Žluťoučký-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	assert.True(t, strings.HasPrefix(zone.Domain, "xn--br-"), zone.Domain)
+
+	_, errs = NewRecord(zone.ID, "pošta", 300, "CNAME", 0, "Schránka.BR-žluťoučký-"+TEST_DOMAIN+".")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	zone, _ = GetStore().GetZone(zone.ID)
+	assert.Equal(t, "xn--pota-h6a", zone.Records[0].Name)
+	assert.Equal(t, asciiName("schránka"), zone.Records[0].Value)
+	assert.Contains(t, zone.Render(), "\nxn--pota-h6a        CNAME      "+asciiName("schránka")+"\n")
+
+	data, err := json.Marshal(zone)
+	assert.NoError(t, err)
+	var decoded struct {
+		Domain        string `json:"domain"`
+		DomainUnicode string `json:"domain_unicode"`
+		Records       []struct {
+			Name        string `json:"name"`
+			NameUnicode string `json:"name_unicode"`
+		} `json:"records"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, zone.Domain, decoded.Domain)
+	assert.Equal(t, "br-žluťoučký-"+TEST_DOMAIN, decoded.DomainUnicode)
+	if assert.Len(t, decoded.Records, 1) {
+		assert.Equal(t, "xn--pota-h6a", decoded.Records[0].Name)
+		assert.Equal(t, "pošta", decoded.Records[0].NameUnicode)
+	}
+	assert.NotContains(t, string(data), "name_unicode\": \"\"")
+}
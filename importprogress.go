@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo"
+	"github.com/pkg/errors"
+)
+
+// Progress of imports is reported after every this many records
+const ImportProgressStep = 100
+
+// Stages of imports
+const (
+	ImportStageParsing    = "parsing"
+	ImportStageValidating = "validating"
+	ImportStageInserting  = "inserting"
+	ImportStageDone       = "done"
+	ImportStageFailed     = "failed"
+)
+
+// ImportProgress is the state of a running import, records are counted in every stage separately
+type ImportProgress struct {
+	Stage     string   `json:"stage"`
+	Parsed    int      `json:"parsed"`    // Records read from the zone file or the transfer
+	Validated int      `json:"validated"` // Records checked so far
+	Inserted  int      `json:"inserted"`  // New records saved so far, unchanged records are kept
+	Total     int      `json:"total"`     // Records of the current stage, 0 while parsing
+	Errors    []string `json:"errors"`    // Errors found so far
+}
+
+// Counts records of one import and reports its progress to the callback
+type importReporter struct {
+	progress ImportProgress
+	report   func(progress ImportProgress)
+}
+
+func newImportReporter(report func(progress ImportProgress)) *importReporter {
+	if report == nil {
+		return nil
+	}
+	return &importReporter{progress: ImportProgress{Stage: ImportStageParsing, Errors: []string{}}, report: report}
+}
+
+// Reports every ImportProgressStep records and the last record of the stage, the nil reporter does nothing
+func (r *importReporter) step(count int) {
+	if r == nil {
+		return
+	}
+	if count%ImportProgressStep == 0 || count == r.progress.Total {
+		r.report(r.progress)
+	}
+}
+
+// One more record was parsed, the total is not known yet
+func (r *importReporter) parsedOne() {
+	if r == nil {
+		return
+	}
+	r.progress.Parsed++
+	if r.progress.Parsed%ImportProgressStep == 0 {
+		r.report(r.progress)
+	}
+}
+
+// Parsing is finished with count records
+func (r *importReporter) parsed(count int) {
+	if r == nil {
+		return
+	}
+	r.progress.Parsed = count
+	r.report(r.progress)
+}
+
+// Validates records one by one so errors are reported before the whole zone is checked
+func (r *importReporter) validate(records []Record) {
+	if r == nil {
+		return
+	}
+	r.progress.Stage = ImportStageValidating
+	r.progress.Total = len(records)
+	for _, record := range records {
+		if err := record.Validate(); err != nil {
+			r.progress.Errors = append(r.progress.Errors, err.Error())
+		}
+		r.progress.Validated++
+		r.step(r.progress.Validated)
+	}
+}
+
+func (r *importReporter) inserting(count int) {
+	if r == nil {
+		return
+	}
+	r.progress.Stage = ImportStageInserting
+	r.progress.Total = count
+	r.report(r.progress)
+}
+
+func (r *importReporter) inserted() {
+	if r == nil {
+		return
+	}
+	r.progress.Inserted++
+	r.step(r.progress.Inserted)
+}
+
+// The import failed, errors of the zone replace the ones found record by record
+func (r *importReporter) fail(errs ...error) {
+	if r == nil {
+		return
+	}
+	r.progress.Stage = ImportStageFailed
+	r.progress.Errors = []string{}
+	for _, err := range errs {
+		r.progress.Errors = append(r.progress.Errors, err.Error())
+	}
+	r.report(r.progress)
+}
+
+// True if the client asked for progress events instead of one response
+func wantsImportProgress(c echo.Context) bool {
+	return c.QueryParam("progress") == "true" || strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "text/event-stream")
+}
+
+// Writes one server-sent event and flushes it to the client
+func writeEvent(c echo.Context, event string, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		panic(err)
+	}
+	c.Response().Write([]byte("event: " + event + "\ndata: " + string(body) + "\n\n"))
+	c.Response().Flush()
+}
+
+// Runs the import and streams its progress as server-sent events. Every progress is a "progress" event,
+// the last event is "result" with the result of the import or "error" with its message.
+func streamImport(c echo.Context, run func(report func(progress ImportProgress)) (interface{}, []error)) error {
+	c.Response().Header().Set(echo.HeaderContentType, "text/event-stream")
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	c.Response().WriteHeader(http.StatusOK)
+
+	var last ImportProgress
+	result, errs := run(func(progress ImportProgress) {
+		last = progress
+		writeEvent(c, "progress", progress)
+	})
+	if len(errs) > 0 {
+		var messages []string
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		writeEvent(c, "error", map[string]string{"message": strings.Join(messages, "\n")})
+		return nil
+	}
+
+	last.Stage = ImportStageDone
+	writeEvent(c, "progress", last)
+	writeEvent(c, "result", result)
+	return nil
+}
+
+// ZoneTransferImport is the result of import by AXFR
+type ZoneTransferImport struct {
+	Zone           *Zone    `json:"zone"`
+	SkippedRecords []string `json:"skipped_records"` // Transferred records of types we don't manage
+}
+
+// ImportZoneTransfer replaces records of the zone by records transferred from the server (ip or ip:port)
+// by AXFR. SOA and apex NS records are managed by us, records of unsupported types are returned as skipped.
+func ImportZoneTransfer(zoneId uint, server string, report func(progress ImportProgress)) (*Zone, []string, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+	if strings.TrimSpace(server) == "" {
+		return nil, nil, []error{errors.New("server to transfer the zone from can't be empty")}
+	}
+
+	reporter := newImportReporter(report)
+	records, skipped, err := transferZone(zone.Domain, server, reporter.parsedOne)
+	if err != nil {
+		reporter.fail(err)
+		return nil, nil, []error{err}
+	}
+	reporter.parsed(len(records))
+
+	imported, errs := replaceRecords(zone.ID, records, reporter)
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	return imported, skipped, nil
+}
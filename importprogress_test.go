@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+// Parses server-sent events from the body into event names and data
+func parseEvents(body string) ([]string, []string) {
+	var names, data []string
+	for _, event := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		lines := strings.SplitN(event, "\n", 2)
+		names = append(names, strings.TrimPrefix(lines[0], "event: "))
+		data = append(data, strings.TrimPrefix(lines[1], "data: "))
+	}
+	return names, data
+}
+
+func TestImportZoneFileHandler_progress(t *testing.T) {
+	zone, errs := NewZone("BK-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	var content strings.Builder
+	for i := 0; i < 250; i++ {
+		fmt.Fprintf(&content, "host%d 300s A 192.0.2.%d\n", i, i%250+1)
+	}
+	importFile := func(content string) (int, string) {
+		e := echo.New()
+		request := httptest.NewRequest(echo.POST, "/?progress=true", strings.NewReader(content))
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+		context.SetParamNames("zone_id")
+		context.SetParamValues(strconv.Itoa(int(zone.ID)))
+		assert.NoError(t, ImportZoneFileHandler(context))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	code, body := importFile(content.String())
+	assert.Equal(t, http.StatusOK, code)
+	names, data := parseEvents(body)
+	if assert.True(t, len(names) > 2) {
+		assert.Equal(t, "result", names[len(names)-1])
+		assert.Contains(t, data[len(data)-1], "host249")
+	}
+
+	var progress []ImportProgress
+	for i, name := range names {
+		if name == "progress" {
+			var p ImportProgress
+			assert.NoError(t, json.Unmarshal([]byte(data[i]), &p))
+			progress = append(progress, p)
+		}
+	}
+	assert.Contains(t, progress, ImportProgress{Stage: ImportStageValidating, Parsed: 250, Validated: 100, Total: 250, Errors: []string{}})
+	assert.Contains(t, progress, ImportProgress{Stage: ImportStageInserting, Parsed: 250, Validated: 250, Inserted: 200, Total: 250, Errors: []string{}})
+	assert.Equal(t, ImportProgress{Stage: ImportStageDone, Parsed: 250, Validated: 250, Inserted: 250, Total: 250, Errors: []string{}}, progress[len(progress)-1])
+
+	// Errors are reported before the import fails
+	code, body = importFile("www 300s A 192.0.2.1\nmail 300s A not-an-ip\n")
+	assert.Equal(t, http.StatusOK, code)
+	names, data = parseEvents(body)
+	assert.Contains(t, body, "\"stage\":\"validating\"")
+	if assert.True(t, len(names) > 1) {
+		assert.Equal(t, "error", names[len(names)-1])
+		assert.Contains(t, data[len(data)-1], "A mail: IP address of A record is not valid")
+	}
+	zone, _ = GetStore().GetZone(zone.ID)
+	assert.Len(t, zone.Records, 250)
+}
+
+func TestImportZoneTransfer(t *testing.T) {
+	zone, errs := NewZone("BK-axfr-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	address, stop := startTransferServer(t, zone.Domain, []string{
+		zone.Domain + ". 300 IN NS ns.example.com.",
+		zone.Domain + ". 300 IN A 192.0.2.1",
+		"www." + zone.Domain + ". 300 IN CNAME " + zone.Domain + ".",
+		zone.Domain + ". 300 IN SSHFP 1 1 123456789abcdef67890123456789abcdef67890",
+	})
+	defer stop()
+
+	var stages []string
+	imported, skipped, errs := ImportZoneTransfer(zone.ID, address, func(progress ImportProgress) {
+		stages = append(stages, progress.Stage)
+	})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Len(t, imported.Records, 2)
+	assert.Len(t, skipped, 1)
+	assert.Equal(t, []string{ImportStageParsing, ImportStageValidating, ImportStageInserting, ImportStageInserting}, stages)
+
+	_, _, errs = ImportZoneTransfer(zone.ID, "", nil)
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Prefix of the first line of aggregated includes, the checksum is SHA-256 of everything after the line
+const includesHeaderPrefix = "// dnsapi includes: "
+
+// Joins stanzas of all active zones ordered by domain so the same zones give the same file
+func renderIncludes(render func(zone *Zone) string) (string, string, error) {
+	var zones []Zone
+
+	db := GetDatabaseConnection()
+	err := activeZones(db).Order("domain").Find(&zones).Error
+	if err != nil {
+		return "", "", err
+	}
+
+	// Zones without stanza (ex. without TSIG key in the key config) are skipped
+	var body strings.Builder
+	count := 0
+	for i := range zones {
+		stanza := strings.TrimSpace(render(&zones[i]))
+		if stanza == "" {
+			continue
+		}
+		body.WriteString(stanza)
+		body.WriteString("\n\n")
+		count++
+	}
+
+	checksum := fmt.Sprintf("%x", sha256.Sum256([]byte(body.String())))
+	header := includesHeaderPrefix + strconv.Itoa(count) + " zones, sha256 " + checksum + "\n\n"
+
+	return header + body.String(), checksum, nil
+}
+
+// RenderPrimaryIncludes returns primary's stanzas of all zones in one file and its checksum
+func RenderPrimaryIncludes() (string, string, error) {
+	return renderIncludes(func(zone *Zone) string { return zone.RenderPrimary() })
+}
+
+// RenderSecondaryIncludes returns secondary's stanzas of all zones in one file and its checksum
+func RenderSecondaryIncludes() (string, string, error) {
+	return renderIncludes(func(zone *Zone) string { return zone.RenderSecondary() })
+}
+
+// VerifyIncludes checks the checksum in the header of aggregated includes
+func VerifyIncludes(content string) bool {
+	parts := strings.SplitN(content, "\n\n", 2)
+	if len(parts) != 2 || !strings.HasPrefix(parts[0], includesHeaderPrefix) {
+		return false
+	}
+
+	fields := strings.Fields(parts[0])
+	checksum := fields[len(fields)-1]
+
+	return checksum == fmt.Sprintf("%x", sha256.Sum256([]byte(parts[1])))
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderIncludes(t *testing.T) {
+	for _, domain := range []string{"ag-b." + TEST_DOMAIN, "ag-a." + TEST_DOMAIN} {
+		zone, errs := NewZone(domain, []string{}, TEST_ABUSE_EMAIL)
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		defer purgeZone(zone)
+	}
+
+	for _, render := range []func() (string, string, error){RenderPrimaryIncludes, RenderSecondaryIncludes} {
+		content, checksum, err := render()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a := strings.Index(content, `zone "ag-a.`+TEST_DOMAIN+`"`)
+		b := strings.Index(content, `zone "ag-b.`+TEST_DOMAIN+`"`)
+		if a < 0 || b < 0 || a > b {
+			t.Error("Zones are not ordered by domain", content)
+		}
+		if !strings.HasPrefix(content, includesHeaderPrefix) || !strings.Contains(strings.Split(content, "\n")[0], checksum) {
+			t.Error("Unexpected header", strings.Split(content, "\n")[0])
+		}
+		if !VerifyIncludes(content) {
+			t.Error("Checksum doesn't match")
+		}
+		if VerifyIncludes(strings.Replace(content, "ag-a.", "ag-c.", 1)) {
+			t.Error("Changed includes passed verification")
+		}
+
+		again, _, err := render()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again != content {
+			t.Error("Includes are not stable")
+		}
+	}
+}
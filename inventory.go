@@ -0,0 +1,495 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Version of the inventory format
+const InventoryVersion = 1
+
+// Inventory is the whole configuration state except zones, so other environments can mirror it.
+// Objects are matched by hostname or name, not by IDs, which differ between environments.
+type Inventory struct {
+	Version     int                   `yaml:"version"`
+	Settings    *RuntimeSettings      `yaml:"settings,omitempty"`
+	NameServers []InventoryNameServer `yaml:"name_servers"`
+	Templates   []InventoryTemplate   `yaml:"templates"`
+	Tenants     []InventoryTenant     `yaml:"tenants"`
+	APIKeys     []InventoryAPIKey     `yaml:"api_keys"` // Only exported, tokens come from the environment
+}
+
+type InventoryNameServer struct {
+	Hostname   string `yaml:"hostname"`
+	IP         string `yaml:"ip"`
+	Role       string `yaml:"role"`
+	Pool       string `yaml:"pool,omitempty"`
+	FileOwner  string `yaml:"file_owner,omitempty"`
+	FileGroup  string `yaml:"file_group,omitempty"`
+	FileMode   string `yaml:"file_mode,omitempty"`
+	RestoreCon bool   `yaml:"restorecon,omitempty"`
+
+	BindOptions `yaml:",inline"`
+}
+
+type InventoryTemplate struct {
+	Name    string                    `yaml:"name"`
+	Records []InventoryTemplateRecord `yaml:"records"`
+}
+
+type InventoryTemplateRecord struct {
+	Name  string `yaml:"name"`
+	TTL   int    `yaml:"ttl,omitempty"`
+	Type  string `yaml:"type"`
+	Prio  int    `yaml:"prio,omitempty"`
+	Value string `yaml:"value"`
+}
+
+type InventoryTenant struct {
+	Name              string `yaml:"name"`
+	DefaultTTL        int    `yaml:"default_ttl,omitempty"`
+	DefaultAbuseEmail string `yaml:"default_abuse_email,omitempty"`
+	DefaultTags       string `yaml:"default_tags,omitempty"`
+	DefaultPool       string `yaml:"default_pool,omitempty"`
+	DefaultTemplate   string `yaml:"default_template,omitempty"` // Name of the template
+	MinTTL            int    `yaml:"min_ttl,omitempty"`
+	MaxTTL            int    `yaml:"max_ttl,omitempty"`
+	NameServers       string `yaml:"name_servers,omitempty"`
+	SOAMName          string `yaml:"soa_mname,omitempty"`
+	AccessLog         bool   `yaml:"access_log,omitempty"`
+}
+
+// InventoryAPIKey says which tokens are configured, secrets are never exported
+type InventoryAPIKey struct {
+	Scope      string `yaml:"scope"` // customer (DNSAPI_API_TOKEN), admin (DNSAPI_ADMIN_TOKEN) or export (DNSAPI_EXPORT_TOKEN)
+	Configured bool   `yaml:"configured"`
+}
+
+// InventoryImportResult counts created and updated objects by their kind
+type InventoryImportResult struct {
+	Created         map[string]int `json:"created"`
+	Updated         map[string]int `json:"updated"`
+	SettingsUpdated bool           `json:"settings_updated"`
+	AffectedZones   []uint         `json:"affected_zones"` // Zones committed because of changed settings
+}
+
+// ExportInventory returns name servers, templates, tenants, runtime settings and API keys without secrets
+func ExportInventory() (*Inventory, error) {
+	var nameServers []NameServer
+	var templates []Template
+	var tenants []Tenant
+
+	db := GetReadDatabaseConnection()
+	err := db.Order("id").Find(&nameServers).Error
+	if err != nil {
+		return nil, err
+	}
+	err = db.Order("name").Preload("Records", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).Find(&templates).Error
+	if err != nil {
+		return nil, err
+	}
+	err = db.Order("name").Find(&tenants).Error
+	if err != nil {
+		return nil, err
+	}
+
+	settings := CurrentRuntimeSettings()
+	inventory := Inventory{
+		Version:     InventoryVersion,
+		Settings:    &settings,
+		NameServers: []InventoryNameServer{},
+		Templates:   []InventoryTemplate{},
+		Tenants:     []InventoryTenant{},
+		APIKeys: []InventoryAPIKey{
+			{Scope: "customer", Configured: config.APIToken != ""},
+			{Scope: "admin", Configured: config.AdminToken != ""},
+			{Scope: "export", Configured: config.ExportToken != ""},
+		},
+	}
+
+	for _, nameServer := range nameServers {
+		inventory.NameServers = append(inventory.NameServers, InventoryNameServer{
+			Hostname:   nameServer.Hostname,
+			IP:         nameServer.IP,
+			Role:       nameServer.Role,
+			Pool:       nameServer.Pool,
+			FileOwner:  nameServer.FileOwner,
+			FileGroup:  nameServer.FileGroup,
+			FileMode:   nameServer.FileMode,
+			RestoreCon: nameServer.RestoreCon,
+
+			BindOptions: nameServer.BindOptions,
+		})
+	}
+
+	templateNames := make(map[uint]string)
+	for _, template := range templates {
+		templateNames[template.ID] = template.Name
+
+		exported := InventoryTemplate{Name: template.Name, Records: []InventoryTemplateRecord{}}
+		for _, record := range template.Records {
+			exported.Records = append(exported.Records, InventoryTemplateRecord{
+				Name:  record.Name,
+				TTL:   record.TTL,
+				Type:  record.Type,
+				Prio:  record.Prio,
+				Value: record.Value,
+			})
+		}
+		inventory.Templates = append(inventory.Templates, exported)
+	}
+
+	for _, tenant := range tenants {
+		inventory.Tenants = append(inventory.Tenants, InventoryTenant{
+			Name:              tenant.Name,
+			DefaultTTL:        tenant.DefaultTTL,
+			DefaultAbuseEmail: tenant.DefaultAbuseEmail,
+			DefaultTags:       tenant.DefaultTags,
+			DefaultPool:       tenant.DefaultPool,
+			DefaultTemplate:   templateNames[tenant.DefaultTemplateId],
+			MinTTL:            tenant.MinTTL,
+			MaxTTL:            tenant.MaxTTL,
+			NameServers:       tenant.NameServers,
+			SOAMName:          tenant.SOAMName,
+			AccessLog:         tenant.AccessLog,
+		})
+	}
+
+	return &inventory, nil
+}
+
+// RenderInventory renders the inventory as YAML
+func RenderInventory(inventory *Inventory) (string, error) {
+	content, err := yaml.Marshal(inventory)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// ParseInventory parses inventory in YAML, unknown fields are refused so typos don't get lost
+func ParseInventory(content string) (*Inventory, error) {
+	var inventory Inventory
+
+	err := yaml.UnmarshalStrict([]byte(content), &inventory)
+	if err != nil {
+		return nil, err
+	}
+	if inventory.Version != InventoryVersion {
+		return nil, errors.Errorf("unsupported inventory version %d", inventory.Version)
+	}
+
+	return &inventory, nil
+}
+
+// Checks the whole inventory before anything is changed
+func (i *Inventory) Validate() []error {
+	var errorsMsgs []error
+
+	templates := make(map[string]bool)
+	for _, template := range i.Templates {
+		if templates[template.Name] {
+			errorsMsgs = append(errorsMsgs, errors.New("template "+template.Name+" is in the inventory twice"))
+		}
+		templates[template.Name] = true
+
+		candidate := Template{Name: template.Name, Records: template.templateRecords()}
+		errorsMsgs = append(errorsMsgs, candidate.Validate()...)
+	}
+
+	hostnames := make(map[string]bool)
+	for _, nameServer := range i.NameServers {
+		hostname := strings.ToLower(nameServer.Hostname)
+		if hostnames[hostname] {
+			errorsMsgs = append(errorsMsgs, errors.New("name server "+hostname+" is in the inventory twice"))
+		}
+		hostnames[hostname] = true
+	}
+
+	tenants := make(map[string]bool)
+	for _, tenant := range i.Tenants {
+		if tenants[tenant.Name] {
+			errorsMsgs = append(errorsMsgs, errors.New("tenant "+tenant.Name+" is in the inventory twice"))
+		}
+		tenants[tenant.Name] = true
+
+		if tenant.DefaultTemplate != "" && !templates[tenant.DefaultTemplate] {
+			var count int
+			db := GetDatabaseConnection()
+			err := db.Model(&Template{}).Where("name = ?", tenant.DefaultTemplate).Count(&count).Error
+			if err != nil {
+				panic(err)
+			}
+			if count == 0 {
+				errorsMsgs = append(errorsMsgs, errors.New("default template "+tenant.DefaultTemplate+" of tenant "+tenant.Name+" doesn't exist"))
+			}
+		}
+	}
+
+	if i.Settings != nil {
+		errorsMsgs = append(errorsMsgs, i.Settings.Validate()...)
+	}
+
+	return errorsMsgs
+}
+
+// Records of the inventory template as they are saved
+func (t *InventoryTemplate) templateRecords() []TemplateRecord {
+	records := []TemplateRecord{}
+	for _, record := range t.Records {
+		records = append(records, TemplateRecord{
+			Name:  record.Name,
+			TTL:   record.TTL,
+			Type:  record.Type,
+			Prio:  record.Prio,
+			Value: record.Value,
+		})
+	}
+	return records
+}
+
+// Creates the template or replaces records of the existing one with the same name
+func importTemplate(template InventoryTemplate, result *InventoryImportResult) error {
+	var existing Template
+
+	db := GetDatabaseConnection()
+	err := db.Where("name = ?", template.Name).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		_, errs := NewTemplate(template.Name, template.templateRecords())
+		if len(errs) > 0 {
+			return errs[0]
+		}
+		result.Created["templates"]++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tx := db.Begin()
+	err = tx.Where("template_id = ?", existing.ID).Delete(&TemplateRecord{}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, record := range template.templateRecords() {
+		record.TemplateId = existing.ID
+		err = tx.Create(&record).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return err
+	}
+
+	result.Updated["templates"]++
+	return nil
+}
+
+// Creates the name server or updates the existing one with the same hostname
+func importNameServer(nameServer InventoryNameServer, result *InventoryImportResult) error {
+	var existing NameServer
+
+	imported := NameServer{
+		Hostname:   strings.ToLower(nameServer.Hostname),
+		IP:         nameServer.IP,
+		Role:       nameServer.Role,
+		Pool:       nameServer.Pool,
+		FileOwner:  nameServer.FileOwner,
+		FileGroup:  nameServer.FileGroup,
+		FileMode:   nameServer.FileMode,
+		RestoreCon: nameServer.RestoreCon,
+
+		BindOptions: nameServer.BindOptions,
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("hostname = ?", imported.Hostname).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		_, errs := NewNameServer(imported)
+		if len(errs) > 0 {
+			return errors.Wrap(errs[0], "name server "+imported.Hostname)
+		}
+		result.Created["name_servers"]++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	imported.ID = existing.ID
+	imported.CreatedAt = existing.CreatedAt
+	errs := imported.Validate()
+	if len(errs) > 0 {
+		return errors.Wrap(errs[0], "name server "+imported.Hostname)
+	}
+	err = db.Save(&imported).Error
+	if err != nil {
+		return err
+	}
+
+	result.Updated["name_servers"]++
+	return nil
+}
+
+// Creates the tenant or updates the existing one with the same name
+func importTenant(tenant InventoryTenant, result *InventoryImportResult) error {
+	var existing Tenant
+	var templateId uint
+
+	db := GetDatabaseConnection()
+	if tenant.DefaultTemplate != "" {
+		var template Template
+		err := db.Where("name = ?", tenant.DefaultTemplate).First(&template).Error
+		if err != nil {
+			return errors.Wrap(err, "default template "+tenant.DefaultTemplate)
+		}
+		templateId = template.ID
+	}
+
+	imported := Tenant{
+		Name:              tenant.Name,
+		DefaultTTL:        tenant.DefaultTTL,
+		DefaultAbuseEmail: tenant.DefaultAbuseEmail,
+		DefaultTags:       tenant.DefaultTags,
+		DefaultPool:       tenant.DefaultPool,
+		DefaultTemplateId: templateId,
+		MinTTL:            tenant.MinTTL,
+		MaxTTL:            tenant.MaxTTL,
+		NameServers:       tenant.NameServers,
+		SOAMName:          tenant.SOAMName,
+		AccessLog:         tenant.AccessLog,
+	}
+
+	err := db.Where("name = ?", tenant.Name).First(&existing).Error
+	if err == gorm.ErrRecordNotFound {
+		_, errs := NewTenant(imported)
+		if len(errs) > 0 {
+			return errors.Wrap(errs[0], "tenant "+tenant.Name)
+		}
+		result.Created["tenants"]++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, errs := UpdateTenant(existing.ID, imported)
+	if len(errs) > 0 {
+		return errors.Wrap(errs[0], "tenant "+tenant.Name)
+	}
+
+	result.Updated["tenants"]++
+	return nil
+}
+
+// ImportInventory creates or updates everything from the inventory, objects which are not in it are kept.
+// Templates go first so tenants can use them, runtime settings go last and commit affected zones.
+func ImportInventory(inventory *Inventory) (*InventoryImportResult, []error) {
+	errs := inventory.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	result := &InventoryImportResult{
+		Created:       map[string]int{"name_servers": 0, "templates": 0, "tenants": 0},
+		Updated:       map[string]int{"name_servers": 0, "templates": 0, "tenants": 0},
+		AffectedZones: []uint{},
+	}
+
+	for _, template := range inventory.Templates {
+		err := importTemplate(template, result)
+		if err != nil {
+			return result, []error{err}
+		}
+	}
+	for _, nameServer := range inventory.NameServers {
+		err := importNameServer(nameServer, result)
+		if err != nil {
+			return result, []error{err}
+		}
+	}
+	for _, tenant := range inventory.Tenants {
+		err := importTenant(tenant, result)
+		if err != nil {
+			return result, []error{err}
+		}
+	}
+
+	if inventory.Settings != nil {
+		// Settings which are the same as the current ones stay with the environment
+		_, affected, errs := UpdateRuntimeSettings(inventory.Settings.changedFrom(CurrentRuntimeSettings()))
+		if len(errs) > 0 {
+			return result, errs
+		}
+		result.SettingsUpdated = true
+		result.AffectedZones = affected
+	}
+
+	return result, nil
+}
+
+// Exports the inventory into a file or stdout, or imports it from a file
+func inventoryCommand(args []string) error {
+	usage := errors.New("usage: dnsapi inventory export [file] | dnsapi inventory import <file>")
+	if len(args) < 1 {
+		return usage
+	}
+
+	switch args[0] {
+	case "export":
+		if len(args) > 2 {
+			return usage
+		}
+
+		inventory, err := ExportInventory()
+		if err != nil {
+			return err
+		}
+		content, err := RenderInventory(inventory)
+		if err != nil {
+			return err
+		}
+
+		if len(args) == 2 {
+			return ioutil.WriteFile(args[1], []byte(content), 0600)
+		}
+		_, err = os.Stdout.WriteString(content)
+		return err
+	case "import":
+		if len(args) != 2 {
+			return usage
+		}
+
+		content, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		inventory, err := ParseInventory(string(content))
+		if err != nil {
+			return err
+		}
+
+		SetNameServerIPs()
+
+		_, errs := ImportInventory(inventory)
+		if len(errs) > 0 {
+			var messages []string
+			for _, err := range errs {
+				messages = append(messages, err.Error())
+			}
+			return errors.New(strings.Join(messages, "\n"))
+		}
+		return nil
+	}
+
+	return usage
+}
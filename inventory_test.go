@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInventory(t *testing.T) {
+	config.APIToken = "inventory-secret"
+	defer func() { config.APIToken = "" }()
+
+	template, errs := NewTemplate("AN-template", []TemplateRecord{{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"}})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteTemplate(template.ID)
+
+	tenant, errs := NewTenant(Tenant{Name: "AN tenant", DefaultTemplateId: template.ID})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer func() {
+		var templates []Template
+		DeleteTenant(tenant.ID)
+		GetDatabaseConnection().Where("name = ?", "AN-template-2").Find(&templates)
+		for _, template := range templates {
+			DeleteTemplate(template.ID)
+		}
+	}()
+
+	inventory, err := ExportInventory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := RenderInventory(inventory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, content, "name: AN-template")
+	assert.Contains(t, content, "default_template: AN-template")
+	assert.Contains(t, content, "scope: customer\n  configured: true")
+	assert.NotContains(t, content, "inventory-secret")
+
+	parsed, err := ParseInventory(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, inventory.Tenants, parsed.Tenants)
+
+	_, err = ParseInventory(content + "unknown: 1\n")
+	assert.NotNil(t, err)
+	_, err = ParseInventory(strings.Replace(content, "version: 1", "version: 2", 1))
+	assert.NotNil(t, err)
+
+	// Staging gets a new template, name server and changed tenant
+	imported := &Inventory{
+		Version: InventoryVersion,
+		Templates: []InventoryTemplate{
+			{Name: "AN-template", Records: []InventoryTemplateRecord{{Name: "www", Type: "A", Value: "192.0.2.2"}}},
+			{Name: "AN-template-2", Records: []InventoryTemplateRecord{{Name: "@", Type: "MX", Prio: 10, Value: "mail.example.com."}}},
+		},
+		NameServers: []InventoryNameServer{{Hostname: "AN-ns.example.com", IP: "192.0.2.153", Role: NameServerRoleSecondary, Pool: "an-pool"}},
+		Tenants:     []InventoryTenant{{Name: "AN tenant", DefaultTTL: 600, DefaultTemplate: "AN-template-2"}},
+	}
+	result, errs := ImportInventory(imported)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, 1, result.Created["templates"])
+	assert.Equal(t, 1, result.Updated["templates"])
+	assert.Equal(t, 1, result.Created["name_servers"])
+	assert.Equal(t, 1, result.Updated["tenants"])
+	assert.False(t, result.SettingsUpdated)
+
+	db := GetDatabaseConnection()
+	var nameServer NameServer
+	err = db.Where("hostname = ?", "an-ns.example.com").First(&nameServer).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer DeleteNameServer(nameServer.ID)
+
+	var secondTemplate Template
+	err = db.Where("name = ?", "AN-template-2").First(&secondTemplate).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var updatedTenant Tenant
+	db.Where("id = ?", tenant.ID).First(&updatedTenant)
+	assert.Equal(t, 600, updatedTenant.DefaultTTL)
+	assert.Equal(t, secondTemplate.ID, updatedTenant.DefaultTemplateId)
+
+	var records []TemplateRecord
+	db.Where("template_id = ?", template.ID).Find(&records)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "192.0.2.2", records[0].Value)
+
+	// Import is idempotent
+	result, errs = ImportInventory(imported)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, 0, result.Created["name_servers"])
+	assert.Equal(t, 1, result.Updated["name_servers"])
+
+	imported.Tenants[0].DefaultTemplate = "AN-missing"
+	_, errs = ImportInventory(imported)
+	assert.Len(t, errs, 1)
+}
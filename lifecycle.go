@@ -0,0 +1,159 @@
+package main
+
+import (
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Lifecycle states of zones
+const (
+	LifecycleActive        = "active"         // Served with its records
+	LifecycleSuspended     = "suspended"      // Served with parked records, see ParkZone
+	LifecyclePendingDelete = "pending-delete" // Removed from name servers, the data is retained for restore
+	LifecyclePurged        = "purged"         // Removed from name servers and the database
+)
+
+// Allowed transitions between lifecycle states
+var lifecycleTransitions = map[string][]string{
+	LifecycleActive:        {LifecycleSuspended, LifecyclePendingDelete},
+	LifecycleSuspended:     {LifecycleActive, LifecyclePendingDelete},
+	LifecyclePendingDelete: {LifecycleActive, LifecyclePurged},
+}
+
+// LifecycleState returns the lifecycle state, zones marked for deletion by older versions are pending delete
+func (z *Zone) LifecycleState() string {
+	if z.Lifecycle == "" {
+		if z.Delete {
+			return LifecyclePendingDelete
+		}
+		return LifecycleActive
+	}
+	return z.Lifecycle
+}
+
+func lifecycleTransitionAllowed(from string, to string) bool {
+	for _, state := range lifecycleTransitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SetZoneLifecycle moves the zone into the lifecycle state. Suspended zones are parked, zones pending delete
+// are removed from name servers in background and restored by moving them back to active, purged zones
+// are deleted from the database. The returned zone is in the new state.
+func SetZoneLifecycle(zoneId uint, state string) (*Zone, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	current := zone.LifecycleState()
+	if _, ok := lifecycleTransitions[state]; !ok && state != LifecyclePurged {
+		return nil, []error{errors.New("lifecycle has to be " + LifecycleActive + ", " + LifecycleSuspended + ", " +
+			LifecyclePendingDelete + " or " + LifecyclePurged)}
+	}
+	if !lifecycleTransitionAllowed(current, state) {
+		return nil, []error{errors.New("zone can't be moved from " + current + " to " + state)}
+	}
+
+	switch {
+	case state == LifecycleSuspended:
+		_, errs := ParkZone(zone.ID)
+		if len(errs) > 0 {
+			return nil, errs
+		}
+	case state == LifecycleActive && current == LifecycleSuspended:
+		_, errs := UnparkZone(zone.ID)
+		if len(errs) > 0 {
+			return nil, errs
+		}
+	case state == LifecyclePendingDelete:
+		err = db.Model(&Zone{}).Where("id = ?", zone.ID).Updates(map[string]interface{}{"delete": true, "lifecycle": state}).Error
+		if err != nil {
+			return nil, []error{err}
+		}
+		err = setZoneDeployState(zone.ID, DeployStatePending, nil)
+		if err != nil {
+			return nil, []error{err}
+		}
+		if !config.SkipDeploy {
+			go removeFromNameServers(zone)
+		}
+	case state == LifecycleActive:
+		err = restoreZone(&zone)
+		if err != nil {
+			return nil, []error{err}
+		}
+	case state == LifecyclePurged:
+		// Removal from name servers could fail before, it's repeated
+		if !config.SkipDeploy {
+			err = decommissionZone(&zone)
+			if err != nil {
+				return nil, []error{errors.Wrap(err, "removal from name servers")}
+			}
+		}
+		err = purgeZone(&zone)
+		if err != nil {
+			return nil, []error{err}
+		}
+		zone.Lifecycle = state
+		Audit("zone.lifecycle_changed", &zone, current+" -> "+state)
+		return &zone, nil
+	}
+
+	err = db.Model(&Zone{}).Where("id = ?", zone.ID).Update("lifecycle", state).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+	Audit("zone.lifecycle_changed", &zone, current+" -> "+state)
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
+
+// Removes the zone pending delete from name servers, its data stays in the database
+func removeFromNameServers(zone Zone) {
+	err := decommissionZone(&zone)
+	if err != nil {
+		setZoneDeployState(zone.ID, DeployStateFailed, err)
+		Audit("zone.decommission_failed", &zone, err.Error())
+		log.Errorf("removal of " + zone.Domain + " from name servers: " + err.Error())
+		return
+	}
+
+	setZoneDeployState(zone.ID, DeployStateDeployed, nil)
+	Audit("zone.removed_from_name_servers", &zone, "")
+}
+
+// Zone pending delete is served again, it's committed with its records
+func restoreZone(zone *Zone) error {
+	db := GetDatabaseConnection()
+	err := db.Model(&Zone{}).Where("id = ?", zone.ID).Updates(map[string]interface{}{"delete": false, "lifecycle": LifecycleActive}).Error
+	if err != nil {
+		return err
+	}
+
+	// Zone suspended before the deletion goes back with its own records
+	if zone.Parked {
+		_, errs := UnparkZone(zone.ID)
+		if len(errs) > 0 {
+			return errs[0]
+		}
+		return nil
+	}
+
+	err = Commit(zone.ID)
+	if err != nil && err != ErrCommitQueued && err != ErrSerialBatched {
+		return errors.Wrap(err, "commit of the restored zone")
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetZoneLifecycle(t *testing.T) {
+	config.TTL = 300
+	config.SkipDeploy = true
+	config.ParkingIP = "192.0.2.10"
+	defer func() {
+		config.TTL = 0
+		config.SkipDeploy = false
+		config.ParkingIP = ""
+	}()
+
+	zone, errs := NewZone("BD-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	_, errs = SetZoneLifecycle(zone.ID, "archived")
+	assert.Len(t, errs, 1)
+	_, errs = SetZoneLifecycle(zone.ID, LifecyclePurged)
+	assert.Len(t, errs, 1)
+
+	suspended, errs := SetZoneLifecycle(zone.ID, LifecycleSuspended)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, LifecycleSuspended, suspended.Lifecycle)
+	assert.True(t, suspended.Parked)
+
+	deleted, errs := SetZoneLifecycle(zone.ID, LifecyclePendingDelete)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, LifecyclePendingDelete, deleted.Lifecycle)
+	assert.True(t, deleted.Delete)
+
+	restored, errs := SetZoneLifecycle(zone.ID, LifecycleActive)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, LifecycleActive, restored.Lifecycle)
+	assert.False(t, restored.Delete)
+	assert.False(t, restored.Parked)
+	if assert.Len(t, restored.Records, 1) {
+		assert.Equal(t, "192.0.2.1", restored.Records[0].Value)
+	}
+
+	_, errs = SetZoneLifecycle(zone.ID, LifecyclePendingDelete)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	purged, errs := SetZoneLifecycle(zone.ID, LifecyclePurged)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, LifecyclePurged, purged.Lifecycle)
+	_, errs = SetZoneLifecycle(zone.ID, LifecycleActive)
+	if assert.Len(t, errs, 1) {
+		assert.Equal(t, RECORD_NOT_FOUND_MESSAGE, errs[0].Error())
+	}
+}
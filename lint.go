@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Severities of lint issues, errors block commit in strict mode
+const (
+	LintSeverityWarning = "warning"
+	LintSeverityError   = "error"
+)
+
+// LintIssue is one problem found in the zone
+type LintIssue struct {
+	Severity string `json:"severity"`
+	RecordId uint   `json:"record_id"` // 0 for issues of the whole zone
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Message  string `json:"message"`
+}
+
+// LintReport contains all issues found in the zone
+type LintReport struct {
+	ZoneId uint        `json:"zone_id"`
+	Domain string      `json:"domain"`
+	Issues []LintIssue `json:"issues"`
+}
+
+// Errors returns issues with error severity
+func (l *LintReport) Errors() []LintIssue {
+	var issues []LintIssue
+	for _, issue := range l.Issues {
+		if issue.Severity == LintSeverityError {
+			issues = append(issues, issue)
+		}
+	}
+	return issues
+}
+
+// LintError is returned by commit in strict mode when the zone has lint errors
+type LintError struct {
+	Report *LintReport
+}
+
+func (l *LintError) Error() string {
+	var messages []string
+	for _, issue := range l.Report.Errors() {
+		messages = append(messages, issue.Type+" "+issue.Name+": "+issue.Message)
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Checks run by LintZone, each returns issues it found in the zone
+var zoneLinters = []func(zone *Zone) []LintIssue{
+	lintDanglingTargets,
+	lintMXTargets,
+	lintNegativeTTL,
+	lintRenderLimits,
+	lintForbiddenValues,
+	lintDMARC,
+	lintVariables,
+}
+
+// LintZone runs all checks on the zone, records have to be loaded
+func LintZone(zone *Zone) *LintReport {
+	report := LintReport{
+		ZoneId: zone.ID,
+		Domain: zone.Domain,
+		Issues: []LintIssue{},
+	}
+
+	// Records are linted with values of their variables
+	expanded := *zone
+	expanded.Records, _ = zone.expandRecords(zone.Records)
+	for _, linter := range zoneLinters {
+		report.Issues = append(report.Issues, linter(&expanded)...)
+	}
+
+	return &report
+}
+
+// Returns fully qualified name without trailing dot for name used in the zone
+func fqdnInZone(name string, domain string) string {
+	name = strings.ToLower(name)
+	if name == "@" {
+		return strings.ToLower(domain)
+	}
+	if strings.HasSuffix(name, ".") {
+		return strings.TrimSuffix(name, ".")
+	}
+	return name + "." + strings.ToLower(domain)
+}
+
+// Returns the most specific managed zone containing the name with its records, records of the linted zone
+// are taken from it. Nil zone is returned for names outside managed zones.
+func managedNameOwner(fqdn string, zone *Zone) (*Zone, []Record, error) {
+	var suffixes []string
+	labels := strings.Split(fqdn, ".")
+	for i := range labels {
+		suffixes = append(suffixes, strings.Join(labels[i:], "."))
+	}
+
+	var owner Zone
+	db := GetDatabaseConnection()
+	err := activeZones(db).Where("domain IN (?)", suffixes).Order("length(domain) DESC").First(&owner).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	records := zone.Records
+	if owner.ID != zone.ID {
+		err = db.Where("zone_id = ?", owner.ID).Find(&records).Error
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return &owner, records, nil
+}
+
+// Finds out whether the name exists in the zone of the records. Names without own records exist when they
+// have records below them or a wildcard of their closest encloser (RFC 4592 section 3.3.1) covers them.
+// Names under NS records delegating a subzone are known only to name servers of the subzone, error
+// is returned for them.
+func managedNameExists(fqdn string, domain string, records []Record) (bool, error) {
+	domain = strings.ToLower(domain)
+	owners := make(map[string]bool)
+	existing := map[string]bool{domain: true}
+	cuts := make(map[string]bool)
+	for _, record := range records {
+		name := fqdnInZone(record.Name, domain)
+		owners[name] = true
+		if record.Type == "NS" && name != domain {
+			cuts[name] = true
+		}
+		for ; name != domain && strings.HasSuffix(name, "."+domain); name = name[strings.Index(name, ".")+1:] {
+			existing[name] = true
+		}
+	}
+
+	if existing[fqdn] {
+		return true, nil
+	}
+	for name := fqdn; name != domain; {
+		name = name[strings.Index(name, ".")+1:]
+		if cuts[name] {
+			return false, errors.New("names under delegation of " + name + " are not known")
+		}
+		if owners["*."+name] {
+			return true, nil
+		}
+		if existing[name] {
+			return false, nil
+		}
+	}
+	return false, nil
+}
+
+// Finds out whether the name exists. Names in zones managed by us are looked up in the database,
+// other names via the resolver used for assertions. Error is returned when it can't be decided.
+func nameExists(fqdn string, zone *Zone) (bool, error) {
+	owner, records, err := managedNameOwner(fqdn, zone)
+	if err != nil {
+		return false, err
+	}
+
+	if owner != nil {
+		return managedNameExists(fqdn, owner.Domain, records)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), AssertionTimeout)
+	defer cancel()
+
+	_, err = assertionResolver().LookupHost(ctx, fqdn)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Targets of CNAME, MX, SRV, NS, PTR, NAPTR and ALIAS records have to exist
+func lintDanglingTargets(zone *Zone) []LintIssue {
+	var issues []LintIssue
+
+	for _, record := range zone.Records {
+		recordType := GetRecordType(record.Type)
+		if recordType == nil || recordType.Target == nil {
+			continue
+		}
+
+		target := recordType.Target(&record)
+		// "." means no target, ex. SRV of a service which is not available
+		if target == "" || target == "." {
+			continue
+		}
+
+		fqdn := fqdnInZone(target, zone.Domain)
+		exists, err := nameExists(fqdn, zone)
+		if err != nil {
+			issues = append(issues, LintIssue{
+				Severity: LintSeverityWarning,
+				RecordId: record.ID,
+				Name:     record.Name,
+				Type:     record.Type,
+				Message:  "target " + fqdn + " can't be resolved: " + err.Error(),
+			})
+		} else if !exists {
+			issues = append(issues, LintIssue{
+				Severity: LintSeverityError,
+				RecordId: record.ID,
+				Name:     record.Name,
+				Type:     record.Type,
+				Message:  "target " + fqdn + " doesn't exist",
+			})
+		}
+	}
+
+	return issues
+}
+
+// MX targets have to have A or AAAA records (RFC 5321 section 5.1) and can't be CNAME (RFC 2181 section 10.3).
+// Only targets in managed zones are checked, other names exist for the resolver only if they have addresses
+// and missing ones are reported by lintDanglingTargets.
+func lintMXTargets(zone *Zone) []LintIssue {
+	var issues []LintIssue
+
+	for _, record := range zone.Records {
+		if record.Type != "MX" || record.Value == "" || record.Value == "." {
+			continue
+		}
+
+		fqdn := fqdnInZone(record.Value, zone.Domain)
+		owner, records, err := managedNameOwner(fqdn, zone)
+		if err != nil || owner == nil {
+			continue
+		}
+
+		exists := fqdn == owner.Domain
+		addresses := false
+		alias := false
+		for _, target := range records {
+			if fqdnInZone(target.Name, owner.Domain) != fqdn {
+				continue
+			}
+			exists = true
+			switch target.Type {
+			case "A", "AAAA", "ALIAS":
+				addresses = true
+			case "CNAME":
+				alias = true
+			}
+		}
+
+		issue := LintIssue{Severity: LintSeverityWarning, RecordId: record.ID, Name: record.Name, Type: record.Type}
+		if alias {
+			issue.Message = "target " + fqdn + " is CNAME, MX has to point at a name with A or AAAA record"
+			issues = append(issues, issue)
+		} else if exists && !addresses {
+			issue.Message = "target " + fqdn + " has no A or AAAA record, mail can't be delivered to it"
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues
+}
+
+// Resolvers cap negative caching, Bind at 3 hours by default
+const negativeCacheCap = 10800
+
+// Negative caching TTL longer than TTLs of records hides new records for longer than changes of existing ones take
+func lintNegativeTTL(zone *Zone) []LintIssue {
+	var issues []LintIssue
+
+	negativeTTL := zone.NegativeTTL()
+	if negativeTTL > negativeCacheCap {
+		issues = append(issues, LintIssue{
+			Severity: LintSeverityWarning,
+			Name:     "@",
+			Type:     "SOA",
+			Message:  "minimum TTL " + strconv.Itoa(negativeTTL) + " is longer than resolvers cache negative answers (" + strconv.Itoa(negativeCacheCap) + ")",
+		})
+	}
+
+	for _, record := range zone.Records {
+		if record.TTL < negativeTTL {
+			issues = append(issues, LintIssue{
+				Severity: LintSeverityWarning,
+				RecordId: record.ID,
+				Name:     record.Name,
+				Type:     record.Type,
+				Message:  "TTL " + strconv.Itoa(record.TTL) + " is lower than minimum TTL " + strconv.Itoa(negativeTTL) + " of the zone",
+			})
+		}
+	}
+
+	return issues
+}
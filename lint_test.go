@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLintZone(t *testing.T) {
+	zone, errs := NewZone("T-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	records := []Record{
+		{Name: "www", Type: "A", Value: "1.2.3.4"},
+		{Name: "alias", Type: "CNAME", Value: "www"},
+		{Name: "apex", Type: "CNAME", Value: "@"},
+		{Name: "broken", Type: "CNAME", Value: "missing"},
+		{Name: "@", Type: "MX", Prio: 10, Value: "mail." + zone.Domain + "."},
+		{Name: "_sip._tcp", Type: "SRV", Value: "10 5 5060 ."},
+		{Name: "external", Type: "CNAME", Value: "host.example.invalid."},
+		{Name: "*.wild", Type: "A", Value: "1.2.3.4"},
+		{Name: "x.deep.wild", Type: "A", Value: "1.2.3.4"},
+		{Name: "covered", Type: "CNAME", Value: "host.wild"},
+		{Name: "uncovered", Type: "CNAME", Value: "y.deep.wild"},
+		{Name: "sub", Type: "NS", Value: "www"},
+		{Name: "delegated", Type: "CNAME", Value: "host.sub"},
+	}
+	for _, record := range records {
+		_, errs = NewRecord(zone.ID, record.Name, 300, record.Type, record.Prio, record.Value)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+	}
+
+	// Resolver which doesn't answer
+	config.AssertionResolver = "127.0.0.1:1"
+	defer func() { config.AssertionResolver = "" }()
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zone.ID).Preload("Records").Find(zone).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := LintZone(zone)
+	if len(report.Issues) != 5 {
+		t.Fatal("Unexpected issues", report.Issues)
+	}
+
+	found := make(map[string]string)
+	for _, issue := range report.Issues {
+		found[issue.Name] = issue.Severity
+	}
+	if found["broken"] != LintSeverityError || found["@"] != LintSeverityError || found["external"] != LintSeverityWarning {
+		t.Error("Unexpected issues", report.Issues)
+	}
+	// Wildcard covers names without closer existing names, names under delegation are unknown
+	if found["covered"] != "" || found["uncovered"] != LintSeverityError || found["delegated"] != LintSeverityWarning {
+		t.Error("Unexpected issues", report.Issues)
+	}
+
+	config.LintStrict = true
+	defer func() { config.LintStrict = false }()
+
+	err = Commit(zone.ID)
+	if _, ok := err.(*LintError); !ok {
+		t.Error("Zone with lint errors was committed", err)
+	}
+}
+
+func TestLintMXTargets(t *testing.T) {
+	zone, errs := NewZone("BW-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	records := []Record{
+		{Name: "mail", Type: "A", Value: "192.0.2.25"},
+		{Name: "relay", Type: "CNAME", Value: "mail"},
+		{Name: "text", Type: "TXT", Value: "no addresses"},
+		{Name: "@", Type: "MX", Prio: 10, Value: "mail"},
+		{Name: "@", Type: "MX", Prio: 20, Value: "relay"},
+		{Name: "@", Type: "MX", Prio: 30, Value: "text"},
+		{Name: "@", Type: "MX", Prio: 40, Value: "@"},
+	}
+	for _, record := range records {
+		_, errs = NewRecord(zone.ID, record.Name, 300, record.Type, record.Prio, record.Value)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+	}
+
+	zone, err := GetStore().GetZone(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues := lintMXTargets(zone)
+	if len(issues) != 3 {
+		t.Fatal("Unexpected issues", issues)
+	}
+	for _, issue := range issues {
+		if issue.Severity != LintSeverityWarning || issue.Type != "MX" {
+			t.Error("Unexpected issue", issue)
+		}
+	}
+	if !strings.Contains(issues[0].Message, "is CNAME") && !strings.Contains(issues[1].Message, "is CNAME") {
+		t.Error("CNAME target isn't reported", issues)
+	}
+}
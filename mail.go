@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Returns true if email is a plain address (no display name) usable in SOA records
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return false
+	}
+
+	parts := strings.Split(email, "@")
+	if len(parts) != 2 || parts[0] == "" || strings.ContainsAny(parts[0], " \"\\;()") {
+		return false
+	}
+
+	domain := parts[1]
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") || strings.Contains(domain, "..") {
+		return false
+	}
+
+	return true
+}
+
+// SendEmail sends plain text email via config.SMTPServer
+func SendEmail(to string, subject string, body string) error {
+	if config.SMTPServer == "" || config.SMTPFrom == "" {
+		return errors.New("sending of emails is not configured, set DNSAPI_SMTP_SERVER and DNSAPI_SMTP_FROM")
+	}
+
+	var auth smtp.Auth
+	if config.SMTPUser != "" {
+		host := strings.Split(config.SMTPServer, ":")[0]
+		auth = smtp.PlainAuth("", config.SMTPUser, config.SMTPPassword, host)
+	}
+
+	message := "From: " + config.SMTPFrom + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		strings.Replace(body, "\n", "\r\n", -1)
+
+	return smtp.SendMail(config.SMTPServer, auth, config.SMTPFrom, []string{to}, []byte(message))
+}
@@ -10,12 +10,21 @@ import (
 	"github.com/labstack/echo/middleware"
 	"errors"
 	"strconv"
+	"strings"
+	"os"
+	"sync"
+	"sync/atomic"
 )
 
 var config Config
 
 var dbConnection *gorm.DB
 
+// Connections to read replicas, opened on the first read
+var replicaConnections []*gorm.DB
+var replicaConnectionsOnce sync.Once
+var replicaCounter uint32
+
 func GetDatabaseConnection() *gorm.DB {
 	if dbConnection == nil {
 		db, err := gorm.Open("sqlite3", config.DatabasePath)
@@ -24,8 +33,30 @@ func GetDatabaseConnection() *gorm.DB {
 			log.Fatalln(err)
 		}
 
+		// Every connection to in-memory database opens a new empty database so we have to stick with one
+		if config.DatabasePath == MemoryDatabasePath {
+			db.DB().SetMaxOpenConns(1)
+		}
+
 		db.AutoMigrate(&Zone{})
 		db.AutoMigrate(&Record{})
+		db.AutoMigrate(&Assertion{})
+		db.AutoMigrate(&Tenant{})
+		db.AutoMigrate(&Template{})
+		db.AutoMigrate(&TemplateRecord{})
+		db.AutoMigrate(&NameServer{})
+		db.AutoMigrate(&AuditEntry{})
+		db.AutoMigrate(&AuditBatch{})
+		db.AutoMigrate(&RecordMigration{})
+		db.AutoMigrate(&DeployFreeze{})
+		db.AutoMigrate(&Setting{})
+		db.AutoMigrate(&QueryStat{})
+		db.AutoMigrate(&ChangeRequest{})
+		db.AutoMigrate(&CommitStat{})
+		db.AutoMigrate(&ZoneVersion{})
+		db.AutoMigrate(&ForbiddenValue{})
+		db.AutoMigrate(&ZoneAccess{})
+		db.AutoMigrate(&ZoneDeployment{})
 
 		dbConnection = db
 	}
@@ -33,6 +64,64 @@ func GetDatabaseConnection() *gorm.DB {
 	return dbConnection
 }
 
+// Opens the replica read-only, so a missing replica isn't created as an empty database. Replica without
+// the schema isn't used either.
+func openReplica(path string) (*gorm.DB, error) {
+	dsn := path
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	if !strings.Contains(dsn, "mode=") {
+		if strings.Contains(dsn, "?") {
+			dsn += "&mode=ro"
+		} else {
+			dsn += "?mode=ro"
+		}
+	}
+
+	db, err := gorm.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	var tables int
+	err = db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", db.NewScope(&Zone{}).TableName()).Row().Scan(&tables)
+	if err == nil && tables == 0 {
+		err = errors.New("database has no zones table")
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// GetReadDatabaseConnection returns connection for list, render and export queries. Replicas from
+// DNSAPI_DATABASE_REPLICAS take turns, the primary database is used without replicas or when the replica
+// doesn't respond. Data written a moment ago doesn't have to be in the replica yet.
+func GetReadDatabaseConnection() *gorm.DB {
+	replicaConnectionsOnce.Do(func() {
+		for _, path := range config.DatabaseReplicas {
+			db, err := openReplica(path)
+			if err != nil {
+				log.Println("database replica " + path + ": " + err.Error())
+				continue
+			}
+			replicaConnections = append(replicaConnections, db)
+		}
+	})
+
+	for range replicaConnections {
+		db := replicaConnections[atomic.AddUint32(&replicaCounter, 1) % uint32(len(replicaConnections))]
+		if db.DB().Ping() == nil {
+			return db
+		}
+	}
+
+	return GetDatabaseConnection()
+}
+
 func FetchConfigData() {
 	err := envconfig.Process("DNSAPI", &config)
 	if err != nil {
@@ -85,40 +174,260 @@ func SetNameServerIPs() {
 }
 
 func main() {
+	// Invalid configuration is reported by check-config as one of its checks
+	if len(os.Args) > 1 && os.Args[1] == "check-config" {
+		err := envconfig.Process("DNSAPI", &config)
+		if err == nil {
+			err = checkConfigCommand(os.Args[2:])
+		}
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
 	FetchConfigData()
-	SetNameServerIPs()
+
+	// Commands
+	if len(os.Args) > 1 {
+		db := GetDatabaseConnection()
+		err := LoadRuntimeSettings()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		err = RunCommand(os.Args[1], os.Args[2:])
+		db.Close()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		return
+	}
+
+	// Name servers are not contacted in skip deploy mode so we don't need their IPs
+	if !config.SkipDeploy {
+		SetNameServerIPs()
+	}
 
 	// Database stuff
 	db := GetDatabaseConnection()
 	defer db.Close()
 
+	err := LoadRuntimeSettings()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = CanonicalizeAddresses()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = ChainAuditLog()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = checkDataConsistency()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if !config.SkipDeploy {
+		err := SyncNameServers()
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+
 	log.Println("Loaded configuration:")
 	log.Printf("%+v\n", config)
 
+	// Background jobs
+	if config.AssertionInterval > 0 {
+		go RunAssertionsScheduler()
+	}
+	if !config.SkipDeploy && config.DeployProbeInterval > 0 {
+		go RunHostProbes()
+	}
+	if !config.SkipDeploy {
+		go func() {
+			err := ResumeDeployments()
+			if err != nil {
+				log.Println("resuming of interrupted deployments: " + err.Error())
+			}
+		}()
+	}
+	go RunDeployWindowsScheduler()
+	go RunRecordMigrationsScheduler()
+	if config.MonitorInterval > 0 {
+		go RunMonitorScheduler()
+	}
+	if config.AliasInterval > 0 {
+		go RunAliasScheduler()
+	}
+	if config.RPZZone != "" && len(config.RPZFeeds) > 0 && config.RPZInterval > 0 {
+		go RunRPZScheduler()
+	}
+	if config.AccessLogRetention > 0 {
+		go RunAccessLogPruneScheduler()
+	}
+	if config.RDAPInterval > 0 {
+		go RunRegistrationScheduler()
+	}
+	if config.SOAAdvisorInterval > 0 {
+		go RunSOAAdvisorScheduler()
+	}
+
 	// Echo instance
 	e := echo.New()
 
 	// Middleware
+	e.Pre(VersionMiddleware)
 	e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{
 		StackSize:  4 << 10, // 1 KB
 	}))
+	e.Use(SecurityHeadersMiddleware)
+	if config.MaxBodySize != "" {
+		e.Use(middleware.BodyLimit(config.MaxBodySize))
+	}
+	if cors := CORSMiddleware(); cors != nil {
+		e.Use(cors)
+	}
+	e.Use(SettingsMiddleware)
 	e.Use(TokenMiddleware)
+	e.Use(ZoneAccessMiddleware)
+	for _, custom := range customMiddlewares {
+		e.Use(custom)
+	}
 	e.Use(middleware.Logger())
 
 	// Routes
 	e.GET("/zones/", GetZonesHandler) // List of zone
 	e.GET("/zones/:zone_id", GetZoneHandler) // Get one zone
 	e.POST("/zones/", NewZoneHandler) // New zone
+	e.POST("/onboard", OnboardHandler) // New zone from template or zone transfer, linted, committed and delegation checked
+	e.POST("/onboard/bulk", BulkCreateZonesHandler) // Many zones from CSV or JSON manifest with per-row report
 	e.DELETE("/zones/:zone_id", DeleteZoneHandler) // Delete the zone
 	e.PUT("/zones/:zone_id", UpdateZoneHandler) // Update the zone
 	e.PUT("/zones/:zone_id/commit", CommitHandler) // Commit the zone
+	e.PUT("/zones/:zone_id/freeze", FreezeZoneHandler) // Stop deployments of the zone
+	e.DELETE("/zones/:zone_id/freeze", FreezeZoneHandler) // Allow deployments of the zone again
+	e.PUT("/zones/:zone_id/deploy_windows", SetZoneDeployWindowsHandler) // When the zone can be deployed
+	e.PUT("/zones/:zone_id/minimum_ttl", SetZoneMinimumTTLHandler) // Negative caching TTL of the zone
+	e.PUT("/zones/:zone_id/type_ttls", SetZoneTypeTTLsHandler) // Default TTLs of new records by type
+	e.GET("/zones/:zone_id/soa_advice", GetSOAAdviceHandler) // Suggested SOA refresh and retry by the zone's change rate
+	e.PUT("/zones/:zone_id/variables", SetZoneVariablesHandler) // Custom variables of record values
+	e.PUT("/zones/:zone_id/www_sync", SetZoneWWWSyncHandler) // Keep A/AAAA records of www and the apex the same
+	e.PUT("/zones/:zone_id/notes", SetZoneNotesHandler) // Notes rendered as comments of the zone file
+	e.PUT("/zones/:zone_id/monitor", SetZoneMonitorHandler) // Status check URL and monitoring ID of the zone
+	e.PUT("/zones/:zone_id/standby", SetZoneStandbyHandler) // Mirror the zone into the standby server
+	e.DELETE("/zones/:zone_id/standby", SetZoneStandbyHandler) // Stop mirroring, records stay in the standby
+	e.PUT("/zones/:zone_id/transfer", SetZoneTransferHandler) // Customer's secondaries
+	e.POST("/zones/:zone_id/abuse_email/verification", RequestAbuseEmailVerificationHandler) // Send verification email
+	e.GET("/verify/:token", VerifyAbuseEmailHandler) // Confirm abuse email, public
+	e.POST("/zones/:zone_id/templates/:template_id", ApplyTemplateHandler) // Apply template on the zone
+	e.GET("/zones/:zone_id/lint", GetZoneLintHandler) // Problems found in the zone
+	e.GET("/zones/:zone_id/orphaned", GetOrphanedRecordsHandler) // Records of the zone pointing at retired infrastructure
+	e.POST("/zones/:zone_id/orphaned/delete", DeleteOrphanedRecordsHandler) // Bulk delete of orphaned records of the zone
+	e.GET("/zones/:zone_id/render", GetZoneRenderHandler) // Rendered zone file
+	e.GET("/zones/:zone_id/export", GetZoneExportHandler) // Zone in the stable JSON format for resolvers and caches
+	e.POST("/zones/:zone_id/import", ImportZoneFileHandler) // Replace records by records from a zone file
+	e.POST("/zones/:zone_id/acme_challenge", DelegateAcmeChallengeHandler) // Delegate _acme-challenge names to the validation zone
+	e.POST("/zones/:zone_id/dkim", SetDKIMKeyHandler) // Publish DKIM public key as TXT record of the selector
+	e.POST("/zones/:zone_id/dmarc", SetDMARCPolicyHandler) // Publish DMARC policy built from its fields
+	e.GET("/zones/:zone_id/compare/:other_zone_id", CompareZonesHandler) // Differences between records of two zones
+	e.GET("/zones/:zone_id/top_names", GetTopTalkersHandler) // Most queried names and NXDOMAIN leaders
+	e.GET(ZoneAccessLogPath, GetZoneAccessLogHandler) // Reads and exports of the zone in the last ?days=
+	e.GET("/zones/:zone_id/deployments", GetZoneDeploymentsHandler) // Progress of the last commit on every name server
 
 	e.GET("/zones/:zone_id/records/", GetRecordsHandler) // List of records
 	e.GET("/zones/:zone_id/records/:record_id", GetRecordHandler) // Get record
 	e.POST("/zones/:zone_id/records/", NewRecordHandler) // New record
 	e.DELETE("/zones/:zone_id/records/:record_id", DeleteRecordHandler) // Delete record
+	e.DELETE("/zones/:zone_id/records", DeleteRecordsHandler) // Preview and delete records by ?type= and ?name_prefix=, ?confirm= with the preview's token
+	e.DELETE("/zones/:zone_id/records/", DeleteRecordsHandler)
 	e.PUT("/zones/:zone_id/records/:record_id", UpdateRecordHandler) // Update record
+	e.PUT("/zones/:zone_id/records/:record_id/comment", SetRecordCommentHandler) // Comment rendered before the record
+	e.GET("/zones/:zone_id/records/:record_id/migration", GetRecordMigrationHandler) // The latest two-phase change of the record
+	e.POST("/zones/:zone_id/records/:record_id/migration", StartRecordMigrationHandler) // Lower TTL now, change the value after the previous TTL expires
+	e.DELETE("/zones/:zone_id/records/:record_id/migration", CancelRecordMigrationHandler) // Cancel the scheduled change
+	e.GET("/record_types/", GetRecordTypesHandler) // Supported record types and their JSON schemas
+
+	e.GET("/zones/:zone_id/rrsets/", GetRRSetsHandler) // Records grouped by name and type
+	e.GET("/zones/:zone_id/rrsets/:name/:type", GetRRSetHandler) // Get one RRset
+	e.PUT("/zones/:zone_id/rrsets/:name/:type", ReplaceRRSetHandler) // Replace the whole RRset atomically
+	e.DELETE("/zones/:zone_id/rrsets/:name/:type", DeleteRRSetHandler) // Delete all records of the RRset
+	e.POST("/zones/:zone_id/rrsets/:name/:type/values", AddRRSetValueHandler) // Add one value to the RRset, ex. TXT verification token
+	e.DELETE("/zones/:zone_id/rrsets/:name/:type/values", RemoveRRSetValueHandler) // Remove one value given by ?value= from the RRset
+	e.POST("/zones/:zone_id/apply", ApplyHandler) // Converge records of one owner to the desired state
+
+	e.GET("/zones/:zone_id/assertions/", GetAssertionsHandler) // List of assertions
+	e.POST("/zones/:zone_id/assertions/", NewAssertionHandler) // New assertion
+	e.DELETE("/zones/:zone_id/assertions/:assertion_id", DeleteAssertionHandler) // Delete assertion
+
+	e.GET("/tenants/", GetTenantsHandler) // List of tenants
+	e.POST("/tenants/", NewTenantHandler) // New tenant
+	e.GET("/tenants/:tenant_id/settings", GetTenantSettingsHandler) // Tenant's default settings
+	e.PUT("/tenants/:tenant_id/settings", UpdateTenantSettingsHandler) // Update tenant's default settings
+	e.GET("/tenants/:tenant_id/usage", GetTenantUsageHandler) // Usage of the tenant in ?period=YYYY-MM, ?format=csv
+	e.DELETE("/tenants/:tenant_id", DeleteTenantHandler) // Delete tenant
+
+	e.GET("/templates/", GetTemplatesHandler) // List of templates
+	e.GET("/templates/:template_id", GetTemplateHandler) // Get one template
+	e.POST("/templates/", NewTemplateHandler) // New template
+	e.DELETE("/templates/:template_id", DeleteTemplateHandler) // Delete template
+
+	// Name servers are managed with the admin token, the old paths stay for it
+	for _, prefix := range []string{"/admin/nameservers", "/nameservers"} {
+		e.GET(prefix+"/", GetNameServersHandler) // Name server inventory
+		e.POST(prefix+"/", NewNameServerHandler) // Register name server
+		e.POST(prefix+"/provision", ProvisionNameServerHandler) // Bootstrap and register a new secondary
+		e.PUT(prefix+"/:nameserver_id/files", UpdateNameServerFilesHandler) // Owner, mode and SELinux label of deployed files
+		e.PUT(prefix+"/:nameserver_id/bind_options", SetNameServerBindOptionsHandler) // Defaults of key directory, journal and log channel in zone stanzas
+		e.DELETE(prefix+"/:nameserver_id", DeleteNameServerHandler) // Remove name server
+		e.POST(prefix+"/:nameserver_id/resync", ResyncNameServerHandler) // Deploy everything to the name server
+	}
+
+	e.GET("/admin/deploy_freezes/", GetDeployFreezesHandler) // List declared deployment freezes
+	e.POST("/admin/deploy_freezes/", NewDeployFreezeHandler) // Declare deployment freeze
+	e.DELETE("/admin/deploy_freezes/:freeze_id", DeleteDeployFreezeHandler) // Cancel deployment freeze
+	e.POST("/admin/querylog", IngestQueryLogHandler) // Bind's query log or collector's JSON lines
+	e.GET("/admin/reports/orphaned", GetOrphanedRecordsHandler) // Records of all zones pointing at retired infrastructure
+	e.POST("/admin/reports/orphaned/delete", DeleteOrphanedRecordsHandler) // Bulk delete of orphaned records of all zones
+	e.GET("/admin/reports/usage", GetUsageHandler) // Usage of all tenants in ?period=YYYY-MM, ?format=csv
+	e.GET("/reports/expiring", GetExpiringZonesHandler) // Zones whose registration expires within ?days=
+	e.GET("/config/includes", GetIncludesHandler) // All zone stanzas in one file with checksum, ?type=primary or secondary
+	e.GET("/admin/audit/", GetAuditLogHandler) // Audit log, filtered by ?zone_id= and ?action=
+	e.GET("/admin/audit/verify", VerifyAuditLogHandler) // Check the hash chain and signatures of the audit log
+	e.GET("/admin/audit/batches/", GetAuditBatchesHandler) // Signed batches of audit log entries
+	e.POST("/admin/audit/sign", SignAuditLogHandler) // Sign entries which aren't in any batch yet
+	e.GET("/metrics", MetricsHandler) // Prometheus metrics
+
+	e.GET("/admin/settings", GetRuntimeSettingsHandler) // Runtime settings
+	e.PUT("/admin/settings", UpdateRuntimeSettingsHandler) // Change runtime settings, affected zones are committed
+	e.PUT("/admin/zones/:zone_id/reserved_names", SetZoneReservedNamesHandler) // Names which can be changed only with the admin token
+	e.PUT("/admin/zones/:zone_id/park", ParkZoneHandler) // Replace records by the parked ones, the previous are archived
+	e.DELETE("/admin/zones/:zone_id/park", ParkZoneHandler) // Restore archived records of the parked zone
+	e.PUT("/admin/zones/:zone_id/lifecycle", SetZoneLifecycleHandler) // Suspend, delete, restore or purge the zone
+	e.PUT("/admin/zones/:zone_id/bind_options", SetZoneBindOptionsHandler) // Key directory, journal and log channel of zone's stanza
+	e.POST("/admin/zones/:zone_id/import/axfr", ImportZoneTransferHandler) // Replace records by records transferred from another server
+	e.GET("/admin/zones/:zone_id/live_serials", GetLiveSerialsHandler) // Serials of the zone served by name servers
+	e.PUT("/admin/zones/:zone_id/serial", SetNextSerialHandler) // Serial of the next commit, also an older one
+	e.PUT("/admin/zones/:zone_id/soa_timers", SetZoneSOATimersHandler) // SOA refresh and retry of the zone, ex. the suggested ones
+	e.PUT("/admin/zones/:zone_id/soa_expire", SetZoneSOAExpireHandler) // SOA expire of the zone, ex. ones under migration
+	e.POST("/admin/soa_advice", ProposeSOATimersHandler) // Hold changed SOA advice of all zones for approval now
+	e.POST("/admin/acme_challenge", BulkDelegateAcmeChallengeHandler) // Delegate _acme-challenge names of many zones
+	e.POST("/admin/rpz/sync", SyncRPZHandler) // Sync blocklists into the RPZ zone now
+	e.GET("/admin/inventory", ExportInventoryHandler) // Name servers, templates, tenants and settings as YAML
+	e.PUT("/admin/inventory", ImportInventoryHandler) // Create or update everything from the YAML inventory
+	e.GET("/admin/changes/", GetChangeRequestsHandler) // Changes held by anomaly rules, ?state=pending
+	e.POST("/admin/changes/:change_id/approve", ApproveChangeHandler) // Do the held change
+	e.DELETE("/admin/changes/:change_id", RejectChangeHandler) // Reject the held change
+	e.GET("/admin/forbidden_values/", GetForbiddenValuesHandler) // Policy of forbidden record values
+	e.POST("/admin/forbidden_values/", NewForbiddenValueHandler) // Add a rule with warn or block mode
+	e.DELETE("/admin/forbidden_values/:forbidden_value_id", DeleteForbiddenValueHandler) // Remove the rule
 
+	e.GET(MirrorPath, ExportAllHandler) // All zones with records as NDJSON, ?cursor= and ?limit=
 	e.GET("/export/", nil) // Export all data
 	e.POST("/import/", nil) // Import all data
 
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetReadDatabaseConnection(t *testing.T) {
+	resetReplicas := func(paths []string) {
+		for _, db := range replicaConnections {
+			db.Close()
+		}
+		replicaConnections = nil
+		replicaConnectionsOnce = sync.Once{}
+		config.DatabaseReplicas = paths
+	}
+	defer resetReplicas(nil)
+
+	resetReplicas(nil)
+	assert.Equal(t, GetDatabaseConnection(), GetReadDatabaseConnection())
+
+	zone, errs := NewZone("AM-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	// The test database opened read-only is the replica
+	resetReplicas([]string{"file:" + config.DatabasePath + "?mode=ro"})
+	replica := GetReadDatabaseConnection()
+	assert.NotEqual(t, GetDatabaseConnection(), replica)
+
+	var replicated Zone
+	err := replica.Where("id = ?", zone.ID).Find(&replicated).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, zone.Domain, replicated.Domain)
+	assert.NotNil(t, replica.Model(&replicated).Update("tags", "written").Error)
+
+	// Replica which doesn't respond isn't used
+	replicaConnections[0].Close()
+	assert.Equal(t, GetDatabaseConnection(), GetReadDatabaseConnection())
+
+	// Missing replica isn't created and a database without the schema isn't a replica
+	missing := filepath.Join(os.TempDir(), "dnsapi-missing-replica.db")
+	os.Remove(missing)
+	resetReplicas([]string{missing})
+	assert.Equal(t, GetDatabaseConnection(), GetReadDatabaseConnection())
+	_, err = os.Stat(missing)
+	assert.True(t, os.IsNotExist(err), "Replica is created")
+	assert.Error(t, checkReplica(missing))
+
+	empty := filepath.Join(os.TempDir(), "dnsapi-empty-replica.db")
+	assert.NoError(t, ioutil.WriteFile(empty, nil, 0600))
+	defer os.Remove(empty)
+	resetReplicas([]string{empty})
+	assert.Equal(t, GetDatabaseConnection(), GetReadDatabaseConnection())
+}
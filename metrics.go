@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo"
+)
+
+// Very small registry of metrics exported in Prometheus text format
+
+type metric struct {
+	Name   string
+	Type   string // counter or gauge
+	Help   string
+	Labels string // rendered labels, ex. {zone="rosti.cz"}
+	Value  float64
+}
+
+var metricsLock sync.Mutex
+var metrics = make(map[string]*metric)
+
+// Renders labels in stable order
+func renderMetricLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	var keys []string
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		value := strings.Replace(labels[key], "\\", "\\\\", -1)
+		value = strings.Replace(value, "\"", "\\\"", -1)
+		value = strings.Replace(value, "\n", "\\n", -1)
+		parts = append(parts, key+"=\""+value+"\"")
+	}
+
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// Returns metric for the name and labels, creates it if it doesn't exist yet
+func getMetric(name string, metricType string, help string, labels map[string]string) *metric {
+	renderedLabels := renderMetricLabels(labels)
+
+	m, ok := metrics[name+renderedLabels]
+	if !ok {
+		m = &metric{
+			Name:   name,
+			Type:   metricType,
+			Help:   help,
+			Labels: renderedLabels,
+		}
+		metrics[name+renderedLabels] = m
+	}
+
+	return m
+}
+
+// MetricsCounterAdd increases counter by value
+func MetricsCounterAdd(name string, help string, labels map[string]string, value float64) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+
+	getMetric(name, "counter", help, labels).Value += value
+}
+
+// MetricsGaugeSet sets a gauge to value
+func MetricsGaugeSet(name string, help string, labels map[string]string, value float64) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+
+	getMetric(name, "gauge", help, labels).Value = value
+}
+
+// MetricsDelete removes one metric, used when the measured object doesn't exist anymore
+func MetricsDelete(name string, labels map[string]string) {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+
+	delete(metrics, name+renderMetricLabels(labels))
+}
+
+// RenderMetrics renders all metrics in Prometheus text format
+func RenderMetrics() string {
+	metricsLock.Lock()
+	defer metricsLock.Unlock()
+
+	var sorted []*metric
+	for _, m := range metrics {
+		sorted = append(sorted, m)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Name == sorted[j].Name {
+			return sorted[i].Labels < sorted[j].Labels
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	var output string
+	var lastName string
+	for _, m := range sorted {
+		if m.Name != lastName {
+			output += "# HELP " + m.Name + " " + m.Help + "\n"
+			output += "# TYPE " + m.Name + " " + m.Type + "\n"
+			lastName = m.Name
+		}
+		output += m.Name + m.Labels + " " + strconv.FormatFloat(m.Value, 'f', -1, 64) + "\n"
+	}
+
+	return output
+}
+
+func MetricsHandler(c echo.Context) error {
+	return c.String(http.StatusOK, RenderMetrics())
+}
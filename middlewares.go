@@ -2,19 +2,86 @@ package main
 
 import (
 	"github.com/labstack/echo"
+	"github.com/labstack/echo/middleware"
+	"net/http"
+	"strconv"
 	"strings"
+	"time"
 )
 
+// Current version of the API, its routes are prefixed by /v1
+const APIVersion = "v1"
+
+// Version of unprefixed routes, they are deprecated and answer as the current version
+const LegacyAPIVersion = "legacy"
+
+// Paths accessible without the token
+var publicPaths = map[string]bool{
+	"/verify/:token": true,
+}
+
+// Admin endpoints from before the admin scope, they are under /admin/ now and their old paths answer
+// only to the admin token too
+var legacyAdminPaths = []string{"/nameservers/"}
+
+// Returns true if only the admin token has access to the path
+func adminPath(path string) bool {
+	if strings.HasPrefix(path, "/admin/") {
+		return true
+	}
+	for _, prefix := range legacyAdminPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the request is authenticated by the admin token
+func isAdmin(c echo.Context) bool {
+	admin, _ := c.Get("admin").(bool)
+	return admin
+}
 
 // Process is the middleware function.
 func TokenMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
+		if publicPaths[c.Path()] {
+			return next(c)
+		}
+
 		tokenHeader := c.Request().Header.Get("Authorization")
 		token := strings.Replace(tokenHeader, "Token ", "", -1)
 
-		if token != config.APIToken || config.APIToken == "" {
+		// Export token gives access only to the mirror of the whole dataset
+		if token == config.ExportToken && config.ExportToken != "" {
+			if c.Path() != MirrorPath {
+				return c.JSONPretty(403, map[string]string{"message": "access denied"}, " ")
+			}
+			c.Set("admin", false)
+			c.Set("key_scope", "export")
+
+			if err := next(c); err != nil {
+				c.Error(err)
+			}
+
+			return nil
+		}
+
+		// Admin token gives access everywhere, the API token everywhere except admin endpoints
+		admin := token == config.AdminToken && config.AdminToken != ""
+		if adminPath(c.Path()) && !admin {
+			return c.JSONPretty(403, map[string]string{"message": "access denied"}, " ")
+		}
+		if !admin && (token != config.APIToken || config.APIToken == "") {
 			return c.JSONPretty(403, map[string]string{"message": "access denied"}, " ")
 		}
+		c.Set("admin", admin)
+		if admin {
+			c.Set("key_scope", "admin")
+		} else {
+			c.Set("key_scope", "customer")
+		}
 
 		if err := next(c); err != nil {
 			c.Error(err)
@@ -22,4 +89,118 @@ func TokenMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 
 		return nil
 	}
-}
\ No newline at end of file
+}
+
+// SettingsMiddleware holds runtime settings for reading during the request, so they don't change while it's
+// handled. Requests updating the settings lock them themselves.
+func SettingsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if settingsWriters[c.Request().Method+" "+c.Path()] {
+			return next(c)
+		}
+
+		settingsLock.RLock()
+		defer settingsLock.RUnlock()
+		return next(c)
+	}
+}
+
+// ZoneAccessMiddleware writes successful GET requests of routes with :zone_id (and :other_zone_id of
+// comparisons) into the zone access log. It has to be registered after TokenMiddleware.
+func ZoneAccessMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := next(c)
+		if err != nil || c.Request().Method != http.MethodGet || c.Response().Status >= 300 || c.Path() == ZoneAccessLogPath {
+			return err
+		}
+
+		var zoneIds []uint
+		for _, param := range []string{"zone_id", "other_zone_id"} {
+			if zoneId, err := strconv.Atoi(c.Param(param)); err == nil && zoneId > 0 {
+				zoneIds = append(zoneIds, uint(zoneId))
+			}
+		}
+		LogZoneAccess(zoneIds, requestAccess(c))
+
+		return nil
+	}
+}
+
+// Returns version of the API requested by the client, handlers can shape responses by it
+func apiVersion(c echo.Context) string {
+	version, _ := c.Get("api_version").(string)
+	if version == "" {
+		return LegacyAPIVersion
+	}
+	return version
+}
+
+// VersionMiddleware strips the version prefix so all versions share the routes, it has to be registered
+// by Pre. Unprefixed requests get Deprecation, Sunset (if DNSAPI_LEGACY_SUNSET is set) and Link headers.
+func VersionMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request := c.Request()
+		prefix := "/" + APIVersion
+
+		if request.URL.Path == prefix || strings.HasPrefix(request.URL.Path, prefix+"/") {
+			request.URL.Path = strings.TrimPrefix(request.URL.Path, prefix)
+			if request.URL.RawPath != "" {
+				request.URL.RawPath = strings.TrimPrefix(request.URL.RawPath, prefix)
+			}
+			if request.URL.Path == "" {
+				request.URL.Path = "/"
+			}
+			c.Set("api_version", APIVersion)
+			c.Response().Header().Set("API-Version", APIVersion)
+			return next(c)
+		}
+
+		header := c.Response().Header()
+		header.Set("Deprecation", "true")
+		if config.LegacySunset != "" {
+			sunset, err := time.Parse("2006-01-02", config.LegacySunset)
+			if err == nil {
+				header.Set("Sunset", sunset.UTC().Format(http.TimeFormat))
+			}
+		}
+		header.Set("Link", "<"+prefix+request.URL.Path+">; rel=\"successor-version\"")
+
+		return next(c)
+	}
+}
+
+// Headers useful for browser clients, ex. for conditional requests and versioning
+var corsExposedHeaders = []string{"ETag", echo.HeaderLastModified, "Deprecation", "Sunset", "Link", "API-Version"}
+
+// CORSMiddleware allows browser clients from DNSAPI_CORS_ORIGINS, nil is returned if no origin is allowed.
+// It has to be registered before TokenMiddleware so preflight requests don't need the token.
+func CORSMiddleware() echo.MiddlewareFunc {
+	if len(config.CORSOrigins) == 0 {
+		return nil
+	}
+
+	return middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOrigins:  config.CORSOrigins,
+		AllowMethods:  config.CORSMethods,
+		AllowHeaders:  config.CORSHeaders,
+		ExposeHeaders: corsExposedHeaders,
+		MaxAge:        config.CORSMaxAge,
+	})
+}
+
+// SecurityHeadersMiddleware sets standard security headers, the API returns only data so nothing
+// is allowed to be loaded or framed. HSTS is sent over HTTPS if DNSAPI_HSTS_MAX_AGE is set.
+func SecurityHeadersMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	secure := middleware.SecureWithConfig(middleware.SecureConfig{
+		XSSProtection:         "1; mode=block",
+		ContentTypeNosniff:    "nosniff",
+		XFrameOptions:         "DENY",
+		HSTSMaxAge:            config.HSTSMaxAge,
+		ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+	})
+
+	return secure(func(c echo.Context) error {
+		c.Response().Header().Set("Referrer-Policy", "no-referrer")
+		return next(c)
+	})
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVersionMiddleware(t *testing.T) {
+	config.LegacySunset = "2030-01-31"
+	defer func() { config.LegacySunset = "" }()
+
+	e := echo.New()
+	e.Pre(VersionMiddleware)
+	e.GET("/zones/:zone_id", func(c echo.Context) error {
+		return c.String(http.StatusOK, apiVersion(c)+" "+c.Param("zone_id"))
+	})
+
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest(echo.GET, "/v1/zones/12", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "v1 12", recorder.Body.String())
+	assert.Equal(t, "", recorder.Header().Get("Deprecation"))
+	assert.Equal(t, APIVersion, recorder.Header().Get("API-Version"))
+
+	recorder = httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest(echo.GET, "/zones/12", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "legacy 12", recorder.Body.String())
+	assert.Equal(t, "true", recorder.Header().Get("Deprecation"))
+	assert.Equal(t, "Thu, 31 Jan 2030 00:00:00 GMT", recorder.Header().Get("Sunset"))
+	assert.Equal(t, `</v1/zones/12>; rel="successor-version"`, recorder.Header().Get("Link"))
+
+	recorder = httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest(echo.GET, "/v10/zones/12", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	assert.Nil(t, CORSMiddleware())
+
+	config.CORSOrigins = []string{"https://admin.example.com"}
+	config.CORSMaxAge = 600
+	config.APIToken = "cors-token"
+	defer func() {
+		config.CORSOrigins = nil
+		config.CORSMaxAge = 0
+		config.APIToken = ""
+	}()
+
+	e := echo.New()
+	e.Use(SecurityHeadersMiddleware)
+	e.Use(CORSMiddleware())
+	e.Use(TokenMiddleware)
+	e.GET("/zones/", func(c echo.Context) error {
+		return c.String(http.StatusOK, "zones")
+	})
+
+	// Preflight doesn't need the token
+	request := httptest.NewRequest(echo.OPTIONS, "/zones/", nil)
+	request.Header.Set(echo.HeaderOrigin, "https://admin.example.com")
+	request.Header.Set(echo.HeaderAccessControlRequestMethod, "GET")
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusNoContent, recorder.Code)
+	assert.Equal(t, "https://admin.example.com", recorder.Header().Get(echo.HeaderAccessControlAllowOrigin))
+	assert.Equal(t, "600", recorder.Header().Get(echo.HeaderAccessControlMaxAge))
+
+	request = httptest.NewRequest(echo.GET, "/zones/", nil)
+	request.Header.Set(echo.HeaderOrigin, "https://admin.example.com")
+	request.Header.Set("Authorization", "Token cors-token")
+	recorder = httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "https://admin.example.com", recorder.Header().Get(echo.HeaderAccessControlAllowOrigin))
+	assert.Contains(t, recorder.Header().Get(echo.HeaderAccessControlExposeHeaders), "ETag")
+	assert.Equal(t, "nosniff", recorder.Header().Get(echo.HeaderXContentTypeOptions))
+	assert.Equal(t, "DENY", recorder.Header().Get(echo.HeaderXFrameOptions))
+	assert.Equal(t, "no-referrer", recorder.Header().Get("Referrer-Policy"))
+
+	// Other origins are not allowed
+	request = httptest.NewRequest(echo.GET, "/zones/", nil)
+	request.Header.Set(echo.HeaderOrigin, "https://evil.example.com")
+	request.Header.Set("Authorization", "Token cors-token")
+	recorder = httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+	assert.Equal(t, "", recorder.Header().Get(echo.HeaderAccessControlAllowOrigin))
+}
+
+func TestTokenMiddleware_admin(t *testing.T) {
+	config.APIToken = "customer-token"
+	config.AdminToken = "admin-token"
+	defer func() {
+		config.APIToken = ""
+		config.AdminToken = ""
+	}()
+
+	e := echo.New()
+	e.Use(TokenMiddleware)
+	for _, path := range []string{"/admin/nameservers/", "/nameservers/", "/nameservers/:nameserver_id/resync", "/zones/"} {
+		e.POST(path, func(c echo.Context) error {
+			return c.String(http.StatusOK, "ok")
+		})
+	}
+	post := func(path string, token string) int {
+		request := httptest.NewRequest(echo.POST, path, nil)
+		request.Header.Set("Authorization", "Token "+token)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	// Name servers moved under /admin/, the old paths are admin only too
+	for _, path := range []string{"/admin/nameservers/", "/nameservers/", "/nameservers/1/resync"} {
+		assert.Equal(t, http.StatusForbidden, post(path, "customer-token"), path)
+		assert.Equal(t, http.StatusOK, post(path, "admin-token"), path)
+	}
+	assert.Equal(t, http.StatusOK, post("/zones/", "customer-token"))
+}
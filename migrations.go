@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+)
+
+// CanonicalizeAddresses rewrites A and AAAA values stored before normalization into their canonical
+// form (RFC 5952 for IPv6). Records which become duplicates of another record (see duplicateRecords) are
+// removed, the kept record gets the lowest TTL of them.
+func CanonicalizeAddresses() error {
+	var records []Record
+
+	db := GetDatabaseConnection()
+	err := db.Where("type IN (?)", []string{"A", "AAAA"}).Order("id").Find(&records).Error
+	if err != nil {
+		return err
+	}
+
+	kept := make(map[string]*Record)
+	for i := range records {
+		record := &records[i]
+		value := record.Value
+		if parsed := net.ParseIP(record.Value); parsed != nil {
+			value = parsed.String()
+		}
+
+		key := strconv.Itoa(int(record.ZoneId)) + " " + record.Type + " " + strings.ToLower(record.Name) + " " + strconv.Itoa(record.Prio) + " " + value
+		if first, ok := kept[key]; ok {
+			log.Infof("removing duplicate record " + record.Type + " " + record.Name + " " + record.Value + " of zone " + strconv.Itoa(int(record.ZoneId)))
+			err = db.Where("id = ?", record.ID).Delete(&Record{}).Error
+			if err != nil {
+				return err
+			}
+			if record.TTL < first.TTL {
+				first.TTL = record.TTL
+				err = db.Model(first).Update("ttl", first.TTL).Error
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		kept[key] = record
+
+		if value != record.Value {
+			err = db.Model(record).Update("value", value).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCanonicalizeAddresses(t *testing.T) {
+	db := GetDatabaseConnection()
+
+	zone, errs := NewZone("S-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	_, errs = NewRecord(zone.ID, "www", 300, "AAAA", 0, "2001:db8::1")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(zone.ID, "www", 300, "AAAA", 0, "2001:DB8:0:0::1")
+	if len(errs) != 1 {
+		t.Error("Equivalent AAAA record was added", errs)
+	}
+
+	// Records stored before normalization
+	for _, value := range []string{"2001:0DB8:0:0:0:0:0:2", "2001:db8::2", "2001:DB8::3"} {
+		err := db.Create(&Record{ZoneId: zone.ID, Name: "old", TTL: 300, Type: "AAAA", Value: value}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := CanonicalizeAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []Record
+	err = db.Where("zone_id = ? AND name = ?", zone.ID, "old").Order("id").Find(&records).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Value != "2001:db8::2" || records[1].Value != "2001:db8::3" {
+		t.Error("Unexpected records after canonicalization", records)
+	}
+
+	// Duplicates differing in TTL and case of the name, the lowest TTL is kept
+	for _, record := range []Record{
+		{ZoneId: zone.ID, Name: "mixed", TTL: 3600, Type: "A", Value: "192.0.2.1"},
+		{ZoneId: zone.ID, Name: "MIXED", TTL: 60, Type: "A", Value: "192.0.2.1"},
+	} {
+		err := db.Create(&record).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = CanonicalizeAddresses()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records = nil
+	err = db.Where("zone_id = ? AND lower(name) = ?", zone.ID, "mixed").Find(&records).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].TTL != 60 {
+		t.Error("Unexpected records after removing duplicates", records)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidCursor = errors.New("cursor has to be the cursor of a line of the mirror")
+
+// Path of the read-only mirror, the only one allowed with DNSAPI_EXPORT_TOKEN
+const MirrorPath = "/export/all"
+
+// Zones loaded from the database at once while the mirror is streamed
+const MirrorBatchSize = 100
+
+// MirrorLine is one line of the mirror, cursor of the last received line continues the stream after it
+type MirrorLine struct {
+	Cursor string `json:"cursor"`
+	Zone   Zone   `json:"zone"`
+}
+
+// StreamZones writes zones with records ordered by ID as NDJSON, starting after the zone ID in cursor
+// (empty for the start). Limit 0 streams all zones. Zones are anonymized unless the anonymizer is nil.
+// Flush is called after every batch with its zones.
+func StreamZones(w io.Writer, cursor string, limit int, anonymizer *Anonymizer, flush func(zones []Zone)) error {
+	var after uint64
+	var err error
+
+	if cursor != "" {
+		after, err = strconv.ParseUint(cursor, 10, 64)
+		if err != nil {
+			return ErrInvalidCursor
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	db := GetReadDatabaseConnection()
+	written := 0
+	for {
+		var zones []Zone
+
+		batch := MirrorBatchSize
+		if limit > 0 && limit-written < batch {
+			batch = limit - written
+		}
+		if batch == 0 {
+			return nil
+		}
+
+		err = db.Where("id > ?", after).Order("id").Limit(batch).Preload("Records").Find(&zones).Error
+		if err != nil {
+			return err
+		}
+		for _, zone := range zones {
+			line := MirrorLine{Cursor: strconv.Itoa(int(zone.ID)), Zone: zone}
+			if anonymizer != nil {
+				line.Zone = anonymizer.Zone(zone)
+			}
+			err = encoder.Encode(line)
+			if err != nil {
+				return err
+			}
+			after = uint64(zone.ID)
+		}
+		written += len(zones)
+		flush(zones)
+
+		if len(zones) < batch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportAll(t *testing.T) {
+	config.ExportToken = "export-token"
+	config.APIToken = "api-token"
+	defer func() {
+		config.ExportToken = ""
+		config.APIToken = ""
+	}()
+
+	first, errs := NewZone("BC-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(first)
+	_, errs = NewRecord(first.ID, "www", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	second, errs := NewZone("BC-2-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(second)
+
+	e := echo.New()
+	e.Use(TokenMiddleware)
+	e.GET(MirrorPath, ExportAllHandler)
+	e.GET("/zones/", GetZonesHandler)
+	get := func(path string, token string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(echo.GET, path, nil)
+		request.Header.Set("Authorization", "Token "+token)
+		recorder := httptest.NewRecorder()
+		e.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// The export token allows only the mirror
+	assert.Equal(t, http.StatusForbidden, get("/zones/", "export-token").Code)
+	assert.Equal(t, http.StatusBadRequest, get(MirrorPath+"?cursor=abc", "export-token").Code)
+
+	recorder := get(MirrorPath+"?limit=2&cursor="+strconv.Itoa(int(first.ID)-1), "export-token")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "application/x-ndjson", recorder.Header().Get(echo.HeaderContentType))
+
+	var lines []MirrorLine
+	scanner := bufio.NewScanner(strings.NewReader(recorder.Body.String()))
+	for scanner.Scan() {
+		var line MirrorLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, line)
+	}
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, first.Domain, lines[0].Zone.Domain)
+		assert.Len(t, lines[0].Zone.Records, 1)
+		assert.Equal(t, second.Domain, lines[1].Zone.Domain)
+	}
+
+	// Cursor of the last line continues the stream
+	recorder = get(MirrorPath+"?cursor="+lines[0].Cursor, "api-token")
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, strings.HasPrefix(recorder.Body.String(), `{"cursor":"`+strconv.Itoa(int(second.ID))+`"`), recorder.Body.String())
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Timeout of one status check and of one call of DNSAPI_MONITORING_PAUSE_URL
+const MonitorTimeout = 10 * time.Second
+
+// Longest monitoring ID accepted
+const MaxMonitorIDLength = 255
+
+// Statuses of zone monitors
+const (
+	MonitorStatusUp   = "up"   // Status URL answered with 2xx or 3xx
+	MonitorStatusDown = "down" // Status URL failed or answered with an error
+)
+
+// Private and shared address ranges, loopback and link-local addresses are recognized by net.IP
+var internalRanges = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"}
+
+// Body of the call of DNSAPI_MONITORING_PAUSE_URL
+type MonitorPauseRequest struct {
+	MonitorID string `json:"monitor_id"`
+	Zone      string `json:"zone"`
+	Paused    bool   `json:"paused"`
+}
+
+// SetZoneMonitor attaches a status check URL and/or an ID of the check in the external monitoring system
+// to the zone, empty values detach them. Status of the last check is reset when the URL changes.
+func SetZoneMonitor(zoneId uint, monitorURL string, monitorID string) (*Zone, []error) {
+	var zone Zone
+
+	if monitorURL != "" {
+		parsed, err := url.Parse(monitorURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, []error{errors.New("monitor URL has to be http or https URL")}
+		}
+	}
+	if len(monitorID) > MaxMonitorIDLength {
+		return nil, []error{errors.New("monitor ID is longer than " + strconv.Itoa(MaxMonitorIDLength) + " characters")}
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	updates := map[string]interface{}{"monitor_url": monitorURL, "monitor_id": monitorID}
+	if monitorURL != zone.MonitorURL {
+		updates["monitor_status"] = ""
+		updates["monitor_checked_at"] = nil
+	}
+	err = db.Model(&Zone{}).Where("id = ?", zone.ID).Updates(updates).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+	if monitorURL == "" {
+		MetricsDelete("dnsapi_monitor_up", map[string]string{"zone": zone.Domain})
+	}
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
+
+// True if the address isn't reachable from the internet and isn't in DNSAPI_MONITOR_ALLOWED_RANGES
+func internalAddress(ip net.IP) bool {
+	for _, cidr := range config.MonitorAllowedRanges {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err == nil && ipNet.Contains(ip) {
+			return false
+		}
+	}
+
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, cidr := range internalRanges {
+		_, ipNet, _ := net.ParseCIDR(cidr)
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateMonitorHost checks whether the status URL can be set without the admin token, all addresses of its
+// host have to be public so the checks can't probe internal services
+func ValidateMonitorHost(monitorURL string) error {
+	if monitorURL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(monitorURL)
+	if err != nil || parsed.Hostname() == "" {
+		return errors.New("monitor URL has to be http or https URL")
+	}
+
+	addresses, err := net.LookupIP(parsed.Hostname())
+	if err != nil {
+		return errors.New("host of the monitor URL can't be resolved: " + err.Error())
+	}
+	for _, ip := range addresses {
+		if internalAddress(ip) {
+			return errors.New("monitor URL points to internal address " + ip.String() + ", it can be set only with the admin token")
+		}
+	}
+
+	return nil
+}
+
+// Calls the status URL, redirects are not followed
+func checkMonitorURL(monitorURL string) string {
+	client := http.Client{
+		Timeout: MonitorTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(monitorURL)
+	if err != nil {
+		return MonitorStatusDown
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return MonitorStatusDown
+	}
+	return MonitorStatusUp
+}
+
+// CheckZoneMonitors calls status URLs of all zones and saves their status. Changes of the status are sent
+// as monitor.down and monitor.recovered webhooks unless alerting of the zone is paused.
+func CheckZoneMonitors() error {
+	var zones []Zone
+
+	db := GetDatabaseConnection()
+	err := activeZones(db).Where("monitor_url != ''").Find(&zones).Error
+	if err != nil {
+		return err
+	}
+
+	for _, zone := range zones {
+		previous := zone.MonitorStatus
+		now := time.Now().UTC()
+		zone.MonitorStatus = checkMonitorURL(zone.MonitorURL)
+		zone.MonitorCheckedAt = &now
+
+		err = db.Model(&Zone{}).Where("id = ?", zone.ID).
+			Updates(map[string]interface{}{"monitor_status": zone.MonitorStatus, "monitor_checked_at": &now}).Error
+		if err != nil {
+			return err
+		}
+
+		up := 0.0
+		if zone.MonitorStatus == MonitorStatusUp {
+			up = 1
+		}
+		MetricsGaugeSet("dnsapi_monitor_up", "1 if the last status check of the zone passed", map[string]string{"zone": zone.Domain}, up)
+
+		if zone.MonitorPaused || previous == zone.MonitorStatus {
+			continue
+		}
+		if zone.MonitorStatus == MonitorStatusDown {
+			SendWebhook("monitor.down", zone)
+		} else if previous == MonitorStatusDown {
+			SendWebhook("monitor.recovered", zone)
+		}
+	}
+
+	return nil
+}
+
+// Pauses or resumes alerting of the zone during a planned change. The monitoring system is told through
+// DNSAPI_MONITORING_PAUSE_URL if the zone has a monitoring ID. Errors are logged, the change goes on.
+func setZoneMonitorPaused(zoneId uint, paused bool) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		log.Errorf("pause of monitoring of zone " + strconv.Itoa(int(zoneId)) + ": " + err.Error())
+		return
+	}
+	if zone.MonitorPaused == paused {
+		return
+	}
+
+	err = db.Model(&Zone{}).Where("id = ?", zone.ID).Update("monitor_paused", paused).Error
+	if err != nil {
+		log.Errorf("pause of monitoring of " + zone.Domain + ": " + err.Error())
+		return
+	}
+	if paused {
+		Audit("zone.monitoring_paused", &zone, "")
+	} else {
+		Audit("zone.monitoring_resumed", &zone, "")
+	}
+
+	if config.MonitoringPauseURL == "" || zone.MonitorID == "" {
+		return
+	}
+
+	body, err := json.Marshal(MonitorPauseRequest{MonitorID: zone.MonitorID, Zone: zone.Domain, Paused: paused})
+	if err != nil {
+		panic(err)
+	}
+
+	client := http.Client{Timeout: MonitorTimeout}
+	resp, err := client.Post(config.MonitoringPauseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Errorf("pause of monitoring of " + zone.Domain + ": " + err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		log.Errorf("pause of monitoring of " + zone.Domain + ": unexpected status code " + strconv.Itoa(resp.StatusCode))
+	}
+}
+
+// Alerting is resumed once the zone has no scheduled record migration
+func resumeZoneMonitorIfIdle(zoneId uint) {
+	var running int
+
+	db := GetDatabaseConnection()
+	err := db.Model(&RecordMigration{}).Where("zone_id = ? AND state = ?", zoneId, MigrationStateScheduled).Count(&running).Error
+	if err != nil {
+		log.Errorf("resume of monitoring of zone " + strconv.Itoa(int(zoneId)) + ": " + err.Error())
+		return
+	}
+	if running == 0 {
+		setZoneMonitorPaused(zoneId, false)
+	}
+}
+
+// RunMonitorScheduler checks zone monitors every config.MonitorInterval seconds, it's supposed to run as goroutine
+func RunMonitorScheduler() {
+	ticker := time.NewTicker(time.Duration(config.MonitorInterval) * time.Second)
+
+	for range ticker.C {
+		err := CheckZoneMonitors()
+		if err != nil {
+			log.Errorf("monitors: " + err.Error())
+		}
+	}
+}
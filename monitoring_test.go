@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZoneMonitor(t *testing.T) {
+	healthy := true
+	status := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !healthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer status.Close()
+
+	var pauses []MonitorPauseRequest
+	monitoring := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request MonitorPauseRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		pauses = append(pauses, request)
+	}))
+	defer monitoring.Close()
+
+	config.TTL = 300
+	config.SkipDeploy = true
+	config.MonitoringPauseURL = monitoring.URL
+	defer func() {
+		config.TTL = 0
+		config.SkipDeploy = false
+		config.MonitoringPauseURL = ""
+	}()
+
+	zone, errs := NewZone("BE-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	record, errs := NewRecord(zone.ID, "www", 3600, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	_, errs = SetZoneMonitor(zone.ID, "ftp://example.com/", "")
+	assert.Len(t, errs, 1)
+
+	monitored, errs := SetZoneMonitor(zone.ID, status.URL, "check-42")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "check-42", monitored.MonitorID)
+	assert.Equal(t, "", monitored.MonitorStatus)
+
+	check := func() Zone {
+		var checked Zone
+		if err := CheckZoneMonitors(); err != nil {
+			t.Fatal(err)
+		}
+		GetDatabaseConnection().Where("id = ?", zone.ID).Find(&checked)
+		return checked
+	}
+	checked := check()
+	assert.Equal(t, MonitorStatusUp, checked.MonitorStatus)
+	assert.NotNil(t, checked.MonitorCheckedAt)
+	healthy = false
+	assert.Equal(t, MonitorStatusDown, check().MonitorStatus)
+
+	// Planned change pauses alerting until it's over
+	_, errs = StartRecordMigration(record.ID, 3600, 0, "192.0.2.2", 0)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.True(t, check().MonitorPaused)
+	if assert.Len(t, pauses, 1) {
+		assert.Equal(t, MonitorPauseRequest{MonitorID: "check-42", Zone: zone.Domain, Paused: true}, pauses[0])
+	}
+
+	_, err := CancelRecordMigration(record.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, check().MonitorPaused)
+	if assert.Len(t, pauses, 2) {
+		assert.False(t, pauses[1].Paused)
+	}
+
+	// Deleted zones are not probed anymore
+	healthy = true
+	GetDatabaseConnection().Model(&Zone{}).Where("id = ?", zone.ID).Update("delete", true)
+	assert.Equal(t, MonitorStatusDown, check().MonitorStatus)
+}
+
+func TestValidateMonitorHost(t *testing.T) {
+	defer func() {
+		config.MonitorAllowedRanges = nil
+	}()
+
+	for _, monitorURL := range []string{"http://127.0.0.1:8080/", "http://localhost/", "http://169.254.169.254/latest/meta-data/", "http://10.1.2.3/", "https://192.168.0.1/", "http://[::1]/", "http://[fd00::1]/", "http://0.0.0.0/"} {
+		assert.Error(t, ValidateMonitorHost(monitorURL), monitorURL)
+	}
+	assert.NoError(t, ValidateMonitorHost(""))
+	assert.NoError(t, ValidateMonitorHost("http://192.0.2.1/status"))
+	assert.NoError(t, ValidateMonitorHost("https://[2001:db8::1]:8443/"))
+
+	config.MonitorAllowedRanges = []string{"127.0.0.0/8"}
+	assert.NoError(t, ValidateMonitorHost("http://127.0.0.1:8080/"))
+	assert.Error(t, ValidateMonitorHost("http://169.254.169.254/"))
+}
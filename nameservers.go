@@ -0,0 +1,396 @@
+package main
+
+import (
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Roles of name servers
+const (
+	NameServerRolePrimary   = "primary"
+	NameServerRoleSecondary = "secondary"
+)
+
+// NameServer is one Bind server in the inventory. Servers from the configuration are added automatically on startup.
+type NameServer struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Hostname string `json:"hostname"`
+	IP       string `json:"ip" sql:"index"`
+	Role     string `json:"role"` // primary or secondary
+	Pool     string `json:"pool"` // Name server pool, empty for the default pool
+
+	// Deployed files (zone files, configs), they are left as written by SSH user if empty
+	FileOwner  string `json:"file_owner"`
+	FileGroup  string `json:"file_group"`
+	FileMode   string `json:"file_mode"`                           // Octal mode, ex. 0640
+	RestoreCon bool   `json:"restorecon" gorm:"column:restorecon"` // Run restorecon to set SELinux labels
+
+	// Defaults of zone stanzas deployed to the server
+	BindOptions
+}
+
+var fileOwnerRegexp = regexp.MustCompile(`^[a-z_][a-z0-9_-]*$`)
+var fileModeRegexp = regexp.MustCompile(`^0?[0-7]{3}$`)
+
+// Validates the name server
+func (n *NameServer) Validate() []error {
+	var errorsMsgs []error
+
+	if strings.TrimSpace(n.Hostname) == "" {
+		errorsMsgs = append(errorsMsgs, errors.New("hostname of the name server can't be empty"))
+	}
+	if net.ParseIP(n.IP) == nil {
+		errorsMsgs = append(errorsMsgs, errors.New(n.IP+" is not a valid IP address of the name server"))
+	}
+	if n.Role != NameServerRolePrimary && n.Role != NameServerRoleSecondary {
+		errorsMsgs = append(errorsMsgs, errors.New("role of the name server has to be "+NameServerRolePrimary+" or "+NameServerRoleSecondary))
+	}
+	if n.FileOwner != "" && !fileOwnerRegexp.MatchString(n.FileOwner) {
+		errorsMsgs = append(errorsMsgs, errors.New(n.FileOwner+" is not a valid owner of files"))
+	}
+	if n.FileGroup != "" && !fileOwnerRegexp.MatchString(n.FileGroup) {
+		errorsMsgs = append(errorsMsgs, errors.New(n.FileGroup+" is not a valid group of files"))
+	}
+	if n.FileMode != "" && !fileModeRegexp.MatchString(n.FileMode) {
+		errorsMsgs = append(errorsMsgs, errors.New(n.FileMode+" is not a valid octal mode of files"))
+	}
+	errorsMsgs = append(errorsMsgs, n.BindOptions.Validate()...)
+
+	var count int
+	db := GetDatabaseConnection()
+	err := db.Model(&NameServer{}).Where("ip = ? AND id != ?", n.IP, n.ID).Count(&count).Error
+	if err != nil {
+		panic(err)
+	}
+	if count > 0 {
+		errorsMsgs = append(errorsMsgs, errors.New("name server with IP "+n.IP+" already exists"))
+	}
+
+	// SOA of zones in the pool names its primary, there can't be more of them
+	if n.Role == NameServerRolePrimary {
+		err = db.Model(&NameServer{}).Where("role = ? AND pool = ? AND id != ?", NameServerRolePrimary, n.Pool, n.ID).Count(&count).Error
+		if err != nil {
+			panic(err)
+		}
+		if count > 0 {
+			errorsMsgs = append(errorsMsgs, errors.New("pool "+strconv.Quote(n.Pool)+" already has a primary name server"))
+		}
+	}
+
+	return errorsMsgs
+}
+
+// Address used for SSH connections, the configured primary is accessed by its hostname like in the rest of deployment
+func (n *NameServer) Address() string {
+	if n.Role == NameServerRolePrimary && n.Hostname == config.PrimaryNameServer {
+		return config.PrimaryNameServer
+	}
+	return n.IP
+}
+
+// FileSettingsCommand returns shell command applying owner, mode and SELinux label on deployed file, empty if there is nothing to set
+func (n *NameServer) FileSettingsCommand(filename string) string {
+	var commands []string
+
+	owner := n.FileOwner
+	if n.FileGroup != "" {
+		owner += ":" + n.FileGroup
+	}
+	if owner != "" {
+		commands = append(commands, "chown "+owner+" "+filename)
+	}
+	if n.FileMode != "" {
+		commands = append(commands, "chmod "+n.FileMode+" "+filename)
+	}
+	if n.RestoreCon {
+		commands = append(commands, "restorecon "+filename)
+	}
+
+	return strings.Join(commands, " && ")
+}
+
+// Returns name server from the inventory by address used for SSH, nil if it's not there
+func nameServerByAddress(address string) *NameServer {
+	var nameServer NameServer
+
+	db := GetDatabaseConnection()
+	err := db.Where("ip = ? OR hostname = ?", address, address).First(&nameServer).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		panic(err)
+	}
+
+	return &nameServer
+}
+
+// PoolPrimaryNameServer returns hostname of the primary name server of the pool, it's used as MNAME in SOA
+// of pool's zones. The configured primary is used for the default pool and pools without their own primary.
+func PoolPrimaryNameServer(pool string) string {
+	if pool == "" {
+		return config.PrimaryNameServer
+	}
+
+	var nameServer NameServer
+
+	db := GetDatabaseConnection()
+	err := db.Where("role = ? AND pool = ?", NameServerRolePrimary, pool).First(&nameServer).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return config.PrimaryNameServer
+		}
+		panic(err)
+	}
+
+	return nameServer.Hostname
+}
+
+// SecondaryNameServerAddresses returns addresses of all secondary servers, the configured ones and the ones from inventory
+func SecondaryNameServerAddresses() []string {
+	var nameServers []NameServer
+
+	addresses := append([]string{}, config.SecondaryNameServerIPs...)
+
+	db := GetDatabaseConnection()
+	err := db.Where("role = ?", NameServerRoleSecondary).Order("id").Find(&nameServers).Error
+	if err != nil {
+		panic(err)
+	}
+
+	for _, nameServer := range nameServers {
+		exists := false
+		for _, address := range addresses {
+			if address == nameServer.IP {
+				exists = true
+			}
+		}
+		if !exists {
+			addresses = append(addresses, nameServer.IP)
+		}
+	}
+
+	return addresses
+}
+
+// SyncNameServers adds name servers from the configuration into the inventory
+func SyncNameServers() error {
+	configured := []NameServer{
+		{
+			Hostname: config.PrimaryNameServer,
+			IP:       config.PrimaryNameServerIP,
+			Role:     NameServerRolePrimary,
+		},
+	}
+	for _, ip := range config.SecondaryNameServerIPs {
+		configured = append(configured, NameServer{
+			Hostname: ip,
+			IP:       ip,
+			Role:     NameServerRoleSecondary,
+		})
+	}
+
+	db := GetDatabaseConnection()
+	for _, nameServer := range configured {
+		var count int
+		err := db.Model(&NameServer{}).Where("ip = ?", nameServer.IP).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		err = db.Create(&nameServer).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Register a new name server into the inventory
+func NewNameServer(nameServer NameServer) (*NameServer, []error) {
+	nameServer.ID = 0
+	nameServer.Hostname = strings.ToLower(nameServer.Hostname)
+
+	errs := nameServer.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Create(&nameServer).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &nameServer, nil
+}
+
+// Update settings of deployed files on the name server
+func UpdateNameServerFiles(nameServerId uint, owner string, group string, mode string, restoreCon bool) (*NameServer, []error) {
+	var nameServer NameServer
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", nameServerId).Find(&nameServer).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	nameServer.FileOwner = owner
+	nameServer.FileGroup = group
+	nameServer.FileMode = mode
+	nameServer.RestoreCon = restoreCon
+
+	errs := nameServer.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	err = db.Model(&nameServer).Updates(map[string]interface{}{
+		"file_owner": owner,
+		"file_group": group,
+		"file_mode":  mode,
+		"restorecon": restoreCon,
+	}).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &nameServer, nil
+}
+
+// Remove the name server from the inventory, configured servers will be added again on next start
+func DeleteNameServer(nameServerId uint) error {
+	var nameServer NameServer
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", nameServerId).Find(&nameServer).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Where("id = ?", nameServerId).Delete(&NameServer{}).Error
+}
+
+// FindNameServer returns name server by its ID, hostname or IP
+func FindNameServer(identifier string) (*NameServer, error) {
+	var nameServer NameServer
+
+	db := GetDatabaseConnection()
+	query := db.Where("hostname = ? OR ip = ?", strings.ToLower(identifier), identifier)
+	if id, err := strconv.Atoi(identifier); err == nil {
+		query = db.Where("id = ?", id)
+	}
+
+	err := query.First(&nameServer).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &nameServer, nil
+}
+
+// ResyncNameServer renders and deploys everything to one name server: all zone files and the config
+// for the primary, the config and forced transfer of all zones for secondaries. The circuit breaker is
+// bypassed and the server is marked as recovered after successful resync.
+func ResyncNameServer(nameServer *NameServer) error {
+	var zones []Zone
+
+	db := GetDatabaseConnection()
+	err := activeZones(db).Preload("Records").Find(&zones).Error
+	if err != nil {
+		return err
+	}
+
+	address := nameServer.Address()
+
+	if nameServer.Role == NameServerRolePrimary {
+		if address != config.PrimaryNameServer {
+			return errors.New("only the configured primary server " + config.PrimaryNameServer + " can be resynced")
+		}
+
+		for _, zone := range zones {
+			err = deployZoneFile(&zone)
+			if err != nil {
+				return errors.Wrap(err, zone.Domain)
+			}
+		}
+
+		err = deployMasterBindConfig()
+		if err != nil {
+			return err
+		}
+
+		err = deployZoneFragments(address, zones)
+		if err != nil {
+			return err
+		}
+	} else {
+		bindConfig, err := renderSecondaryBindConfig()
+		if err != nil {
+			return err
+		}
+
+		err = deploySecondaryBindConfig(address, bindConfig)
+		if err != nil {
+			return err
+		}
+
+		err = deployZoneFragments(address, zones)
+		if err != nil {
+			return err
+		}
+
+		for _, zone := range zones {
+			_, err = SendCommandViaSSH(address, "rndc retransfer "+zone.Domain)
+			if err != nil {
+				return errors.Wrap(err, zone.Domain)
+			}
+		}
+	}
+
+	// Everything is deployed so what the server missed doesn't matter anymore
+	for _, state := range HostStates() {
+		if state.Host == address && state.Degraded {
+			markHostRecovered(address)
+		}
+	}
+
+	log.Infof("name server " + nameServer.Hostname + " resynced, " + strconv.Itoa(len(zones)) + " zones")
+
+	return nil
+}
+
+// Command line resync, identifier is ID, hostname or IP of the name server
+func resyncCommand(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: dnsapi resync <name server id, hostname or IP>")
+	}
+
+	SetNameServerIPs()
+
+	err := SyncNameServers()
+	if err != nil {
+		return err
+	}
+
+	nameServer, err := FindNameServer(args[0])
+	if err != nil {
+		return errors.Wrap(err, "name server "+args[0])
+	}
+
+	return ResyncNameServer(nameServer)
+}
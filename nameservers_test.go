@@ -0,0 +1,115 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestNameServers(t *testing.T) {
+	err := SyncNameServers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Second sync doesn't create duplicates
+	err = SyncNameServers()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	primary, err := FindNameServer("ns1.rosti.cz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if primary.Role != NameServerRolePrimary || primary.Address() != "ns1.rosti.cz" {
+		t.Error("Unexpected primary server", primary)
+	}
+
+	_, errs := NewNameServer(NameServer{Hostname: "ns3.rosti.cz", IP: "5.6.7.8", Role: NameServerRoleSecondary})
+	if len(errs) != 1 {
+		t.Error("Name server with existing IP was registered", errs)
+	}
+
+	nameServer, errs := NewNameServer(NameServer{Hostname: "NS3.rosti.cz", IP: "9.9.9.9", Role: NameServerRoleSecondary})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteNameServer(nameServer.ID)
+
+	found, err := FindNameServer(strconv.Itoa(int(nameServer.ID)))
+	if err != nil || found.Hostname != "ns3.rosti.cz" {
+		t.Error("Name server not found by ID", found, err)
+	}
+
+	addresses := SecondaryNameServerAddresses()
+	if len(addresses) != 2 || addresses[0] != "5.6.7.8" || addresses[1] != "9.9.9.9" {
+		t.Error("Unexpected secondary addresses", addresses)
+	}
+}
+
+func TestValidateProvisioning(t *testing.T) {
+	errs := ValidateProvisioning(NameServer{Hostname: "ns4.rosti.cz", IP: "5.6.7.8"})
+	if len(errs) != 1 {
+		t.Error("Provisioning of a server with existing IP passed", errs)
+	}
+
+	errs = ValidateProvisioning(NameServer{IP: "not-an-ip"})
+	if len(errs) != 2 {
+		t.Error("Expected two errors", errs)
+	}
+
+	errs = ValidateProvisioning(NameServer{Hostname: "ns4.rosti.cz", IP: "9.9.9.10"})
+	if len(errs) != 0 {
+		t.Error(errs)
+	}
+}
+
+func TestNameServer_FileSettingsCommand(t *testing.T) {
+	nameServer := NameServer{}
+	if command := nameServer.FileSettingsCommand("/var/cache/bind/a.zone"); command != "" {
+		t.Error("Command for name server without file settings", command)
+	}
+
+	nameServer = NameServer{FileOwner: "named", FileGroup: "named", FileMode: "0640", RestoreCon: true}
+	expected := "chown named:named /var/cache/bind/a.zone && chmod 0640 /var/cache/bind/a.zone && restorecon /var/cache/bind/a.zone"
+	if command := nameServer.FileSettingsCommand("/var/cache/bind/a.zone"); command != expected {
+		t.Error("Unexpected command", command)
+	}
+
+	primary, err := FindNameServer("ns1.rosti.cz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errs := UpdateNameServerFiles(primary.ID, "root; rm", "", "999", false)
+	if len(errs) != 2 {
+		t.Error("Invalid file settings were accepted", errs)
+	}
+}
+
+func TestPoolPrimaryNameServer(t *testing.T) {
+	nameServer, errs := NewNameServer(NameServer{Hostname: "ns1.eu.rosti.cz", IP: "10.0.0.1", Role: NameServerRolePrimary, Pool: "eu"})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteNameServer(nameServer.ID)
+
+	_, errs = NewNameServer(NameServer{Hostname: "ns2.eu.rosti.cz", IP: "10.0.0.2", Role: NameServerRolePrimary, Pool: "eu"})
+	if len(errs) != 1 {
+		t.Error("Second primary of the pool was registered", errs)
+	}
+
+	if primary := PoolPrimaryNameServer("eu"); primary != "ns1.eu.rosti.cz" {
+		t.Error("Unexpected primary of the pool", primary)
+	}
+	if primary := PoolPrimaryNameServer(""); primary != "ns1.rosti.cz" {
+		t.Error("Unexpected primary of the default pool", primary)
+	}
+	if primary := PoolPrimaryNameServer("us"); primary != "ns1.rosti.cz" {
+		t.Error("Pool without primary doesn't fall back to the configured one", primary)
+	}
+
+	zone := Zone{Domain: "V-" + TEST_DOMAIN, Serial: "2020010101", Pool: "eu"}
+	if !strings.Contains(zone.Render(), "SOA     ns1.eu.rosti.cz. ") {
+		t.Error("SOA doesn't name primary of the pool", zone.Render())
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// Longest notes of a zone and comment of a record
+const (
+	MaxZoneNotesLength     = 2000
+	MaxRecordCommentLength = 255
+)
+
+// Lines of the text which can be rendered after ";" in the zone file. Tabs become spaces, other control
+// and non-printable characters are removed, so the text can't end the comment and inject records.
+func commentLines(text string) []string {
+	var lines []string
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		line = strings.Map(func(r rune) rune {
+			if r == '\t' {
+				return ' '
+			}
+			if !unicode.IsPrint(r) {
+				return -1
+			}
+			return r
+		}, line)
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+
+	// Empty lines around the text are left out
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// Renders the text as comment lines of the zone file, empty for no text
+func renderComment(text string) string {
+	var rendered string
+	for _, line := range commentLines(text) {
+		if line == "" {
+			rendered += ";\n"
+		} else {
+			rendered += "; " + line + "\n"
+		}
+	}
+	return rendered
+}
+
+// SetZoneNotes sets notes of the zone which are rendered at the start of its zone file
+func SetZoneNotes(zoneId uint, notes string) (*Zone, []error) {
+	var zone Zone
+
+	notes = strings.TrimSpace(notes)
+	if len(notes) > MaxZoneNotesLength {
+		return nil, []error{errors.New("notes can't be longer than " + strconv.Itoa(MaxZoneNotesLength) + " characters")}
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Model(&Zone{}).Where("id = ?", zoneId).Update("notes", notes).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return nil, []error{err}
+	}
+	Audit("zone.notes_updated", &zone, "")
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
+
+// SetRecordComment sets comment of the record which is rendered on the line before it, one line only
+func SetRecordComment(recordId uint, comment string) (*Record, []error) {
+	var record Record
+
+	comment = strings.Join(commentLines(comment), " ")
+	if len(comment) > MaxRecordCommentLength {
+		return nil, []error{errors.New("comment can't be longer than " + strconv.Itoa(MaxRecordCommentLength) + " characters")}
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", recordId).Find(&record).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Model(&record).Update("comment", comment).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = markZonePending(record.ZoneId)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &record, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZone_RenderComments(t *testing.T) {
+	zone := Zone{Domain: "az-" + TEST_DOMAIN, Serial: "2020010101", TTL: 300}
+	zone.Notes = "Owner: web team\n\n\tTicket OPS-1\r\n\x00$ORIGIN evil.\n"
+	zone.Records = []Record{
+		{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1", Comment: "load balancer\n@ 300 A 198.51.100.1"},
+	}
+
+	rendered := zone.Render()
+	assert.True(t, strings.HasPrefix(rendered, "; Owner: web team\n;\n;  Ticket OPS-1\n; $ORIGIN evil.\n$TTL 300s\n"), rendered)
+	assert.Contains(t, rendered, "; load balancer\n; @ 300 A 198.51.100.1\nwww")
+
+	records, err := ParseZoneFile(rendered, zone.Domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, "192.0.2.1", records[0].Value)
+	}
+}
+
+func TestSetZoneNotes(t *testing.T) {
+	zone, errs := NewZone("AZ-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	record, errs := NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	updated, errs := SetZoneNotes(zone.ID, "Managed by the web team")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "Managed by the web team", updated.Notes)
+	_, errs = SetZoneNotes(zone.ID, strings.Repeat("x", MaxZoneNotesLength+1))
+	assert.Len(t, errs, 1)
+
+	commented, errs := SetRecordComment(record.ID, "front\nend")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "front end", commented.Comment)
+	_, errs = SetRecordComment(record.ID, strings.Repeat("x", MaxRecordCommentLength+1))
+	assert.Len(t, errs, 1)
+
+	// Later updates keep the comment
+	_, errs = UpdateRecord(record.ID, "www", 300, 0, "192.0.2.2")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	var stored Record
+	GetDatabaseConnection().Where("id = ?", record.ID).Find(&stored)
+	assert.Equal(t, "front end", stored.Comment)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Statuses of onboarding steps and of the whole onboarding
+const (
+	OnboardStatusOK             = "ok"
+	OnboardStatusWarning        = "warning"         // Step passed but something needs attention
+	OnboardStatusFailed         = "failed"          // Step failed, the zone is not deployed
+	OnboardStatusSkipped        = "skipped"         // Step was not requested
+	OnboardStatusActionRequired = "action_required" // Zone is committed but something needs attention, ex. delegation
+)
+
+// OnboardRequest describes a new customer's domain
+type OnboardRequest struct {
+	Domain     string   `json:"domain"`
+	TenantId   uint     `json:"tenant_id"`
+	Tags       []string `json:"tags"`
+	AbuseEmail string   `json:"abuse_email"`
+	TemplateId uint     `json:"template_id"` // Template applied on the new zone
+	AXFRServer string   `json:"axfr_server"` // Records are transferred from this server (ip or ip:port) instead of template
+	DNSSEC     bool     `json:"dnssec"`
+}
+
+// OnboardStep is result of one step of the onboarding
+type OnboardStep struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// DelegationCheck compares name servers of the domain in DNS with ours
+type DelegationCheck struct {
+	Expected  []string `json:"expected"`
+	Found     []string `json:"found"`
+	Delegated bool     `json:"delegated"`
+}
+
+// OnboardResult is consolidated status of the onboarding
+type OnboardResult struct {
+	Status     string           `json:"status"`
+	Zone       *Zone            `json:"zone"`
+	Steps      []OnboardStep    `json:"steps"`
+	Lint       *LintReport      `json:"lint"`
+	Delegation *DelegationCheck `json:"delegation"`
+	Skipped    []string         `json:"skipped_records"` // Transferred records of types we don't manage
+}
+
+func (o *OnboardResult) step(name string, status string, message string) {
+	o.Steps = append(o.Steps, OnboardStep{Name: name, Status: status, Message: message})
+}
+
+// CheckDelegation finds out whether the domain is delegated to the expected name servers, ex. zone's ApexNameServers
+func CheckDelegation(domain string, expected []string) (*DelegationCheck, error) {
+	check := DelegationCheck{
+		Expected: []string{},
+		Found:    []string{},
+	}
+	for _, nameServer := range expected {
+		check.Expected = append(check.Expected, strings.ToLower(strings.TrimSuffix(nameServer, ".")))
+	}
+	sort.Strings(check.Expected)
+
+	ctx, cancel := context.WithTimeout(context.Background(), AssertionTimeout)
+	defer cancel()
+
+	nameServers, err := assertionResolver().LookupNS(ctx, domain)
+	if err != nil {
+		return &check, err
+	}
+	for _, nameServer := range nameServers {
+		check.Found = append(check.Found, strings.ToLower(strings.TrimSuffix(nameServer.Host, ".")))
+	}
+	sort.Strings(check.Found)
+
+	check.Delegated = strings.Join(check.Found, ",") == strings.Join(check.Expected, ",")
+
+	return &check, nil
+}
+
+// Onboard creates the zone, fills it from the template or by zone transfer, lints it, enables DNSSEC,
+// commits it and checks the delegation. Errors are returned only when the zone can't be created or filled,
+// the zone is removed again in that case so the onboarding can be repeated.
+func Onboard(request OnboardRequest) (*OnboardResult, []error) {
+	result := OnboardResult{
+		Status:  OnboardStatusOK,
+		Steps:   []OnboardStep{},
+		Skipped: []string{},
+	}
+
+	if request.TemplateId != 0 && request.AXFRServer != "" {
+		return nil, []error{errors.New("template and zone transfer can't be used together")}
+	}
+
+	// Zone
+	zone, errs := NewTenantZone(request.TenantId, request.Domain, request.Tags, request.AbuseEmail)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	created := zone
+	result.step("create", OnboardStatusOK, "zone "+zone.Domain+" created")
+
+	// Records
+	if request.TemplateId != 0 {
+		zone, errs = ApplyTemplate(zone.ID, request.TemplateId)
+		if len(errs) > 0 {
+			purgeZone(created)
+			return nil, errs
+		}
+		result.step("records", OnboardStatusOK, strconv.Itoa(len(zone.Records))+" records from template")
+	} else if request.AXFRServer != "" {
+		records, skipped, err := TransferZone(zone.Domain, request.AXFRServer)
+		if err == nil {
+			zone, errs = ReplaceRecords(zone.ID, records)
+		} else {
+			errs = []error{err}
+		}
+		if len(errs) > 0 {
+			purgeZone(created)
+			return nil, errs
+		}
+		result.Skipped = append(result.Skipped, skipped...)
+
+		status := OnboardStatusOK
+		message := strconv.Itoa(len(zone.Records)) + " records transferred from " + request.AXFRServer
+		if len(skipped) > 0 {
+			status = OnboardStatusWarning
+			message += ", " + strconv.Itoa(len(skipped)) + " records of unsupported types skipped"
+		}
+		result.step("records", status, message)
+	} else {
+		result.step("records", OnboardStatusSkipped, "")
+	}
+	result.Zone = zone
+
+	// Lint, errors block the commit only in strict mode
+	result.Lint = LintZone(zone)
+	if len(result.Lint.Issues) > 0 {
+		result.step("lint", OnboardStatusWarning, strconv.Itoa(len(result.Lint.Errors()))+" errors and "+
+			strconv.Itoa(len(result.Lint.Issues)-len(result.Lint.Errors()))+" warnings, see the lint report")
+	} else {
+		result.step("lint", OnboardStatusOK, "")
+	}
+
+	// DNSSEC
+	if request.DNSSEC {
+		db := GetDatabaseConnection()
+		err := db.Model(zone).Update("dnssec", true).Error
+		if err != nil {
+			purgeZone(created)
+			return nil, []error{err}
+		}
+		result.step("dnssec", OnboardStatusOK, "zone will be signed on the primary server")
+	} else {
+		result.step("dnssec", OnboardStatusSkipped, "")
+	}
+
+	// Commit
+	err := Commit(zone.ID)
+	if err == ErrCommitQueued || err == ErrSerialBatched {
+		result.step("commit", OnboardStatusWarning, err.Error())
+	} else if err != nil {
+		result.step("commit", OnboardStatusFailed, err.Error())
+		result.Status = OnboardStatusFailed
+	} else {
+		result.step("commit", OnboardStatusOK, "")
+	}
+
+	// Delegation
+	result.Delegation, err = CheckDelegation(zone.Domain, zone.ApexNameServers())
+	if err != nil {
+		result.step("delegation", OnboardStatusWarning, "delegation can't be checked: "+err.Error())
+	} else if !result.Delegation.Delegated {
+		result.step("delegation", OnboardStatusWarning, "domain is not delegated to "+strings.Join(result.Delegation.Expected, ", "))
+	} else {
+		result.step("delegation", OnboardStatusOK, "")
+	}
+
+	for _, step := range result.Steps {
+		if step.Status == OnboardStatusWarning && result.Status == OnboardStatusOK {
+			result.Status = OnboardStatusActionRequired
+		}
+	}
+
+	err = GetDatabaseConnection().Where("id = ?", zone.ID).Preload("Records").Find(zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &result, nil
+}
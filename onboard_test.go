@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// Starts DNS server answering AXFR of the domain with given records, returns its address
+func startTransferServer(t *testing.T, domain string, records []string) (string, func()) {
+	soa, err := dns.NewRR(dns.Fqdn(domain) + " 300 IN SOA ns.example.com. admin.example.com. 1 300 180 604800 60")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	answer := []dns.RR{soa}
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		answer = append(answer, rr)
+	}
+	answer = append(answer, soa)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &dns.Server{
+		Listener: listener,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, request *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetReply(request)
+			response.Answer = answer
+			w.WriteMsg(response)
+		}),
+	}
+	go server.ActivateAndServe()
+
+	return listener.Addr().String(), func() { server.Shutdown() }
+}
+
+func TestTransferZone(t *testing.T) {
+	domain := "y-" + TEST_DOMAIN
+	address, stop := startTransferServer(t, domain, []string{
+		domain + ". 300 IN NS ns.example.com.",
+		domain + ". 300 IN A 1.2.3.4",
+		"www." + domain + ". 600 IN CNAME " + domain + ".",
+		domain + ". 300 IN MX 10 mail.example.com.",
+		domain + ". 300 IN TXT \"v=spf1\" \" mx ~all\"",
+		"_sip._tcp." + domain + ". 300 IN SRV 10 5 5060 sip.example.com.",
+		"sub." + domain + ". 300 IN NS ns.example.com.",
+	})
+	defer stop()
+
+	records, skipped, err := TransferZone(domain, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := make(map[string]Record)
+	for _, record := range records {
+		found[record.Name+" "+record.Type] = record
+	}
+	if len(records) != 6 || found["@ A"].Value != "1.2.3.4" || found["www CNAME"].Value != "@" ||
+		found["@ MX"].Prio != 10 || found["@ TXT"].Value != "v=spf1 mx ~all" ||
+		found["_sip._tcp SRV"].Value != "10 5 5060 sip.example.com." || found["www CNAME"].TTL != 600 ||
+		found["sub NS"].Value != "ns.example.com." {
+		t.Error("Unexpected records", records)
+	}
+	// NS of the apex is replaced by ours, delegations are imported
+	if len(skipped) != 0 {
+		t.Error("Unexpected skipped records", skipped)
+	}
+
+	_, _, err = TransferZone(domain, "127.0.0.1:1")
+	if err == nil {
+		t.Error("Transfer from not existing server passed")
+	}
+}
+
+func TestOnboard(t *testing.T) {
+	config.SkipDeploy = true
+	config.AssertionResolver = "127.0.0.1:1"
+	defer func() {
+		config.SkipDeploy = false
+		config.AssertionResolver = ""
+	}()
+
+	domain := "y-" + TEST_DOMAIN
+	address, stop := startTransferServer(t, domain, []string{
+		domain + ". 300 IN A 1.2.3.4",
+		"www." + domain + ". 300 IN CNAME " + domain + ".",
+	})
+	defer stop()
+
+	_, errs := Onboard(OnboardRequest{Domain: domain, AXFRServer: "127.0.0.1:1"})
+	if len(errs) == 0 {
+		t.Error("Onboarding with failed transfer passed")
+	}
+
+	result, errs := Onboard(OnboardRequest{Domain: domain, AXFRServer: address, DNSSEC: true})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(result.Zone)
+
+	if len(result.Zone.Records) != 2 || !result.Zone.DNSSEC || result.Zone.DeployState != DeployStateDeployed {
+		t.Error("Zone wasn't onboarded", result.Zone)
+	}
+
+	steps := make(map[string]string)
+	for _, step := range result.Steps {
+		steps[step.Name] = step.Status
+	}
+	if steps["create"] != OnboardStatusOK || steps["records"] != OnboardStatusOK || steps["dnssec"] != OnboardStatusOK ||
+		steps["commit"] != OnboardStatusOK || steps["delegation"] != OnboardStatusWarning {
+		t.Error("Unexpected steps", result.Steps)
+	}
+	if result.Status != OnboardStatusActionRequired {
+		t.Error("Missing delegation doesn't require action", result.Status)
+	}
+}
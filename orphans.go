@@ -0,0 +1,168 @@
+package main
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// OrphanedRecord is a record pointing at retired infrastructure
+type OrphanedRecord struct {
+	RecordId uint   `json:"record_id"`
+	ZoneId   uint   `json:"zone_id"`
+	Domain   string `json:"domain"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Value    string `json:"value"`
+	Reason   string `json:"reason"`
+}
+
+// Returns decommissioned range containing the IP, nil if there is none
+func decommissionedRange(ip net.IP) *net.IPNet {
+	for _, cidr := range config.DecommissionedRanges {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if ipNet.Contains(ip) {
+			return ipNet
+		}
+	}
+	return nil
+}
+
+// OrphanedRecords finds records pointing at IPs in DNSAPI_DECOMMISSIONED_RANGES and records whose targets
+// don't exist anymore, of one zone or of all zones with zone ID 0
+func OrphanedRecords(zoneId uint) ([]OrphanedRecord, error) {
+	var zones []Zone
+
+	db := GetDatabaseConnection()
+	query := activeZones(db).Preload("Records").Order("id")
+	if zoneId != 0 {
+		query = query.Where("id = ?", zoneId)
+	}
+	err := query.Find(&zones).Error
+	if err != nil {
+		return nil, err
+	}
+	if zoneId != 0 && len(zones) == 0 {
+		return nil, errors.New(RECORD_NOT_FOUND_MESSAGE)
+	}
+
+	orphans := []OrphanedRecord{}
+	resolved := make(map[string]bool) // Targets already looked up
+
+	for _, zone := range zones {
+		for _, record := range zone.Records {
+			reason := ""
+
+			if record.Type == "A" || record.Type == "AAAA" {
+				if ip := net.ParseIP(record.Value); ip != nil {
+					if ipNet := decommissionedRange(ip); ipNet != nil {
+						reason = "address is in decommissioned range " + ipNet.String()
+					}
+				}
+			}
+
+			recordType := GetRecordType(record.Type)
+			if recordType != nil && recordType.Target != nil {
+				target := recordType.Target(&record)
+				if target != "" && target != "." {
+					fqdn := fqdnInZone(target, zone.Domain)
+					exists, ok := resolved[fqdn]
+					if !ok {
+						exists, err = nameExists(fqdn, &zone)
+						// Names which can't be resolved right now are not reported
+						if err != nil {
+							exists = true
+						}
+						resolved[fqdn] = exists
+					}
+					if !exists {
+						reason = "target " + fqdn + " doesn't resolve"
+					}
+				}
+			}
+
+			if reason != "" {
+				orphans = append(orphans, OrphanedRecord{
+					RecordId: record.ID,
+					ZoneId:   zone.ID,
+					Domain:   zone.Domain,
+					Name:     record.Name,
+					Type:     record.Type,
+					Value:    record.Value,
+					Reason:   reason,
+				})
+			}
+		}
+	}
+
+	return orphans, nil
+}
+
+// StillOrphaned returns orphaned records of the zone (all zones with zone ID 0) among given records
+func StillOrphaned(zoneId uint, recordIds []uint) ([]OrphanedRecord, error) {
+	orphans, err := OrphanedRecords(zoneId)
+	if err != nil {
+		return nil, err
+	}
+
+	requested := make(map[uint]bool)
+	for _, recordId := range recordIds {
+		requested[recordId] = true
+	}
+
+	found := []OrphanedRecord{}
+	for _, orphan := range orphans {
+		if requested[orphan.RecordId] {
+			found = append(found, orphan)
+		}
+	}
+	return found, nil
+}
+
+// DeleteOrphanedRecords deletes given records of the zone (all zones with zone ID 0) if they are still
+// orphaned, returns IDs of deleted records. Affected zones have to be committed to deploy the change.
+func DeleteOrphanedRecords(zoneId uint, recordIds []uint) ([]uint, error) {
+	orphans, err := StillOrphaned(zoneId, recordIds)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := []uint{}
+	for _, orphan := range orphans {
+		err = DeleteRecord(orphan.RecordId)
+		if err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, orphan.RecordId)
+
+		zone := Zone{ID: orphan.ZoneId, Domain: orphan.Domain}
+		Audit("record.orphan_deleted", &zone, orphan.Type+" "+orphan.Name+" "+orphan.Value+" (record "+strconv.Itoa(int(orphan.RecordId))+"): "+orphan.Reason)
+	}
+
+	return deleted, nil
+}
+
+// Describes deletion of given records of the zone which are still orphaned, for review of the change
+func orphansChange(zoneId uint, recordIds []uint) (*RecordChange, error) {
+	var records []Record
+
+	orphans, err := StillOrphaned(zoneId, recordIds)
+	if err != nil {
+		return nil, err
+	}
+	orphanIds := []uint{}
+	for _, orphan := range orphans {
+		orphanIds = append(orphanIds, orphan.RecordId)
+	}
+
+	err = GetDatabaseConnection().Where("id IN (?)", orphanIds).Order("id").Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordChange{ZoneId: zoneId, Operation: ChangeOperationBulk, Removed: records}, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestOrphanedRecords(t *testing.T) {
+	zone, errs := NewZone("U-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	retired, errs := NewRecord(zone.ID, "old", 300, "A", 0, "10.66.1.2")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if _, errs = NewRecord(zone.ID, "www", 300, "A", 0, "10.67.1.2"); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	dangling, errs := NewRecord(zone.ID, "ftp", 300, "CNAME", 0, "files")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	config.DecommissionedRanges = []string{"10.66.0.0/16"}
+	config.AssertionResolver = "127.0.0.1:1"
+	defer func() {
+		config.DecommissionedRanges = nil
+		config.AssertionResolver = ""
+	}()
+
+	orphansOfZone := func() []OrphanedRecord {
+		orphans, err := OrphanedRecords(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var found []OrphanedRecord
+		for _, orphan := range orphans {
+			if orphan.ZoneId == zone.ID {
+				found = append(found, orphan)
+			}
+		}
+		return found
+	}
+
+	orphans := orphansOfZone()
+	if len(orphans) != 2 || orphans[0].RecordId != retired.ID || orphans[1].RecordId != dangling.ID {
+		t.Fatal("Unexpected orphaned records", orphans)
+	}
+
+	deleted, err := DeleteOrphanedRecords(0, []uint{retired.ID, retired.ID + 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0] != retired.ID {
+		t.Error("Unexpected deleted records", deleted)
+	}
+
+	orphans = orphansOfZone()
+	if len(orphans) != 1 || orphans[0].RecordId != dangling.ID {
+		t.Error("Unexpected orphaned records after delete", orphans)
+	}
+
+	// Records of other zones are left alone by the zone's report
+	other, errs := NewZone("CF-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(other)
+	orphans, err = OrphanedRecords(other.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 0 {
+		t.Error("Orphaned records of other zone", orphans)
+	}
+	deleted, err = DeleteOrphanedRecords(other.ID, []uint{dangling.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 0 {
+		t.Error("Record of other zone was deleted", deleted)
+	}
+}
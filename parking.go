@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+var ErrZoneParked = errors.New("zone is already parked")
+var ErrZoneNotParked = errors.New("zone is not parked")
+
+// Records of a parked zone, from DNSAPI_PARKING_TEMPLATE or apex and wildcard records pointing to DNSAPI_PARKING_IP
+func parkingRecords(zone *Zone) ([]Record, error) {
+	var records []Record
+
+	if config.ParkingTemplate != "" {
+		var template Template
+
+		templateId, err := findTemplate(config.ParkingTemplate)
+		if err != nil {
+			return nil, err
+		}
+
+		db := GetDatabaseConnection()
+		err = db.Where("id = ?", templateId).Preload("Records").Find(&template).Error
+		if err != nil {
+			return nil, err
+		}
+
+		for _, templateRecord := range template.Records {
+			records = append(records, templateRecord.Record(zone.TypeTTL(templateRecord.Type)))
+		}
+	} else if config.ParkingIP != "" {
+		recordType := "A"
+		if ip := net.ParseIP(config.ParkingIP); ip != nil && ip.To4() == nil {
+			recordType = "AAAA"
+		}
+		for _, name := range []string{"@", "*"} {
+			records = append(records, Record{Name: name, TTL: zone.TypeTTL(recordType), Type: recordType, Value: config.ParkingIP})
+		}
+	} else {
+		return nil, errors.New("parking is not configured, set DNSAPI_PARKING_TEMPLATE or DNSAPI_PARKING_IP")
+	}
+
+	for i := range records {
+		records[i].ZoneId = zone.ID
+		records[i].Normalize(zone.Domain)
+	}
+
+	return records, nil
+}
+
+// Commits the zone after parking or restore, failures are kept in zone's deploy state
+func commitParking(zone *Zone) {
+	err := Commit(zone.ID)
+	if err != nil && err != ErrCommitQueued && err != ErrSerialBatched {
+		log.Errorf("commit of " + zone.Domain + " after parking: " + err.Error())
+	}
+}
+
+// ParkZone replaces records of the zone by the parked ones and commits it. Previous records are archived
+// in the zone and UnparkZone restores them.
+func ParkZone(zoneId uint) (*Zone, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+	if zone.Parked {
+		return nil, []error{ErrZoneParked}
+	}
+
+	records, err := parkingRecords(&zone)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	archive, err := json.Marshal(zone.SortedRecords())
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	// Archive goes first so the previous records can't be lost
+	now := time.Now().UTC()
+	err = db.Model(&zone).Updates(map[string]interface{}{
+		"parked":         true,
+		"parked_at":      &now,
+		"parked_records": string(archive),
+	}).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	_, errs := ReplaceRecords(zone.ID, records)
+	if len(errs) > 0 {
+		db.Model(&zone).Updates(map[string]interface{}{"parked": false, "parked_at": nil, "parked_records": ""})
+		return nil, errs
+	}
+
+	Audit("zone.parked", &zone, "")
+	commitParking(&zone)
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
+
+// UnparkZone restores records archived by ParkZone and commits the zone
+func UnparkZone(zoneId uint) (*Zone, []error) {
+	var zone Zone
+	var archived []Record
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+	if !zone.Parked {
+		return nil, []error{ErrZoneNotParked}
+	}
+
+	err = json.Unmarshal([]byte(zone.ParkedRecords), &archived)
+	if err != nil {
+		return nil, []error{errors.Wrap(err, "archived records")}
+	}
+	for i := range archived {
+		archived[i].ID = 0
+	}
+
+	_, errs := ReplaceRecords(zone.ID, archived)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	err = db.Model(&zone).Updates(map[string]interface{}{"parked": false, "parked_at": nil, "parked_records": ""}).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	Audit("zone.unparked", &zone, "")
+	commitParking(&zone)
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
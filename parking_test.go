@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParkZone(t *testing.T) {
+	config.SkipDeploy = true
+	config.ParkingIP = "192.0.2.10"
+	defer func() {
+		config.SkipDeploy = false
+		config.ParkingIP = ""
+	}()
+
+	zone, errs := NewZone("AH-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	_, errs = NewRecord(zone.ID, "@", 300, "MX", 10, "mail.example.com.")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "1.2.3.4")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	if _, errs := UnparkZone(zone.ID); len(errs) != 1 || errs[0] != ErrZoneNotParked {
+		t.Error("Zone which is not parked was restored", errs)
+	}
+
+	config.TTL = 300
+	parked, errs := ParkZone(zone.ID)
+	config.TTL = 0
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if !parked.Parked || parked.ParkedAt == nil || len(parked.Records) != 2 {
+		t.Fatal("Zone wasn't parked", parked)
+	}
+	for _, record := range parked.Records {
+		if record.Type != "A" || record.Value != "192.0.2.10" || (record.Name != "@" && record.Name != "*") {
+			t.Error("Unexpected parked record", record)
+		}
+	}
+
+	if _, errs := ParkZone(zone.ID); len(errs) != 1 || errs[0] != ErrZoneParked {
+		t.Error("Parked zone was parked again", errs)
+	}
+
+	restored, errs := UnparkZone(zone.ID)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if restored.Parked || restored.ParkedRecords != "" || len(restored.Records) != 2 {
+		t.Fatal("Zone wasn't restored", restored)
+	}
+	types := make(map[string]bool)
+	for _, record := range restored.Records {
+		types[record.Type] = true
+	}
+	if !types["MX"] || !types["A"] {
+		t.Error("Unexpected restored records", restored.Records)
+	}
+}
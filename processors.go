@@ -1,8 +1,12 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/jinzhu/gorm"
@@ -12,11 +16,37 @@ import (
 
 // Create a new zone
 func NewZone(domain string, tags []string, abuseEmail string) (*Zone, []error) {
+	return NewTenantZone(0, domain, tags, abuseEmail)
+}
+
+// Create a new zone owned by the tenant, tenant's defaults are used for values which are not set
+func NewTenantZone(tenantId uint, domain string, tags []string, abuseEmail string) (*Zone, []error) {
+	var tenant Tenant
+
+	db := GetDatabaseConnection()
+
+	if tenantId != 0 {
+		err := db.Where("id = ?", tenantId).Find(&tenant).Error
+		if err != nil {
+			return nil, []error{err}
+		}
+	}
+
 	zone := Zone{
-		Domain:     strings.ToLower(domain),
-		Tags:       strings.Join(tags, ","),
-		AbuseEmail: abuseEmail,
-		Delete:     false,
+		DeployState: DeployStatePending,
+		TenantId:    tenant.ID,
+		Pool:        tenant.DefaultPool,
+		TTL:         tenant.DefaultTTL,
+		Domain:      asciiName(strings.ToLower(domain)),
+		Tags:        strings.Join(tags, ","),
+		AbuseEmail:  abuseEmail,
+		Delete:      false,
+	}
+	if strings.Trim(zone.Tags, ", ") == "" {
+		zone.Tags = tenant.DefaultTags
+	}
+	if zone.AbuseEmail == "" {
+		zone.AbuseEmail = tenant.DefaultAbuseEmail
 	}
 
 	errs := zone.Validate()
@@ -24,13 +54,30 @@ func NewZone(domain string, tags []string, abuseEmail string) (*Zone, []error) {
 		return &zone, errs
 	}
 
-	db := GetDatabaseConnection()
 	db.NewRecord(&zone)
 	err := db.Create(&zone).Error
 	if err != nil {
 		return &zone, []error{err}
 	}
 
+	if tenant.DefaultTemplateId != 0 {
+		templatedZone, errs := ApplyTemplate(zone.ID, tenant.DefaultTemplateId)
+		if len(errs) > 0 {
+			// The zone is created again with the next attempt
+			err = purgeZone(&zone)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			return nil, errs
+		}
+		zone = *templatedZone
+	}
+
+	err = DelegateZone(&zone)
+	if err != nil {
+		log.Errorf("delegation of " + zone.Domain + ": " + err.Error())
+	}
+
 	return &zone, nil
 }
 
@@ -45,6 +92,12 @@ func UpdateZone(zoneId uint, tags []string, abuseEmail string) (*Zone, []error)
 	}
 
 	zone.Tags = strings.Join(tags, ",")
+	if zone.AbuseEmail != abuseEmail {
+		// New address has to be verified again
+		zone.AbuseEmailVerified = false
+		zone.AbuseEmailVerifiedAt = nil
+		zone.AbuseEmailToken = ""
+	}
 	zone.AbuseEmail = abuseEmail
 
 	errs := zone.Validate()
@@ -54,11 +107,19 @@ func UpdateZone(zoneId uint, tags []string, abuseEmail string) (*Zone, []error)
 
 	err = db.Model(&zone).Update("tags", zone.Tags).
 		Update("abuse_email", zone.AbuseEmail).
+		Update("abuse_email_verified", zone.AbuseEmailVerified).
+		Update("abuse_email_verified_at", zone.AbuseEmailVerifiedAt).
+		Update("abuse_email_token", zone.AbuseEmailToken).
 		Update("serial", zone.Serial).Error
 	if err != nil {
 		return nil, []error{err}
 	}
 
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return nil, []error{err}
+	}
+
 	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
 	if err != nil {
 		return nil, []error{err}
@@ -67,7 +128,163 @@ func UpdateZone(zoneId uint, tags []string, abuseEmail string) (*Zone, []error)
 	return &zone, nil
 }
 
-// Delete existing zone
+// RequestAbuseEmailVerification sends confirmation link to zone's abuse email
+func RequestAbuseEmailVerification(zoneId uint) error {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return err
+	}
+
+	if zone.AbuseEmail == "" {
+		return errors.New("zone uses the default abuse email")
+	}
+	if config.PublicURL == "" {
+		return errors.New("DNSAPI_PUBLIC_URL has to be set for sending of verification links")
+	}
+
+	tokenBytes := make([]byte, 32)
+	_, err = rand.Read(tokenBytes)
+	if err != nil {
+		return err
+	}
+	token := hex.EncodeToString(tokenBytes)
+
+	err = db.Model(&zone).Update("abuse_email_token", token).Error
+	if err != nil {
+		return err
+	}
+
+	link := strings.TrimSuffix(config.PublicURL, "/") + "/verify/" + token
+	body := "Hello,\n\n" +
+		"this address was set as abuse contact of DNS zone " + zone.Domain + ".\n" +
+		"Please confirm it by opening the following link:\n\n" +
+		link + "\n\n" +
+		"If you don't know anything about the zone, ignore this email.\n"
+
+	return SendEmail(zone.AbuseEmail, "Confirm abuse contact of "+zone.Domain, body)
+}
+
+// VerifyAbuseEmail marks abuse email of the zone with the token as verified
+func VerifyAbuseEmail(token string) (*Zone, error) {
+	var zone Zone
+
+	if token == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("abuse_email_token = ?", token).Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	zone.AbuseEmailVerified = true
+	zone.AbuseEmailVerifiedAt = &now
+	zone.AbuseEmailToken = ""
+
+	err = db.Model(&zone).Updates(map[string]interface{}{
+		"abuse_email_verified":    zone.AbuseEmailVerified,
+		"abuse_email_verified_at": zone.AbuseEmailVerifiedAt,
+		"abuse_email_token":       zone.AbuseEmailToken,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &zone, nil
+}
+
+// SetZoneTransfer sets customer's secondary servers allowed to transfer the zone, TSIG key is optional
+func SetZoneTransfer(zoneId uint, ips []string, tsigAlgorithm string, tsigSecret string) (*Zone, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	zone.TransferIPs = strings.Join(ips, ",")
+	zone.TSIGSecret = tsigSecret
+	zone.TSIGAlgorithm = tsigAlgorithm
+	if zone.TSIGAlgorithm == "" && zone.TSIGSecret != "" {
+		zone.TSIGAlgorithm = "hmac-sha256"
+	}
+
+	errs := zone.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	err = db.Model(&zone).Updates(map[string]interface{}{
+		"transfer_ips":   zone.TransferIPs,
+		"tsig_algorithm": zone.TSIGAlgorithm,
+		"tsig_secret":    zone.TSIGSecret,
+	}).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
+
+// SetZoneMinimumTTL sets negative caching TTL of the zone, 0 for DNSAPI_MINIMAL_TTL. Lint warnings about
+// conflicts with TTLs of zone's records are returned with the zone.
+func SetZoneMinimumTTL(zoneId uint, minimumTTL int) (*Zone, []LintIssue, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	zone.MinimumTTL = minimumTTL
+
+	errs := zone.Validate()
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+
+	err = db.Model(&zone).Update("minimum_ttl", zone.MinimumTTL).Error
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, nil, []error{err}
+	}
+
+	return &zone, lintNegativeTTL(&zone), nil
+}
+
+// Returns query selecting zones which are served by name servers, zones marked for deletion are left out
+func activeZones(db *gorm.DB) *gorm.DB {
+	return db.Where("`delete` = ?", false)
+}
+
+// DeleteZone marks the zone for deletion and decommissions it in background. The zone stays
+// in the database until it's removed from all name servers, calling this again retries failed removal.
 func DeleteZone(zoneId uint) error {
 	var zone Zone
 
@@ -77,15 +294,163 @@ func DeleteZone(zoneId uint) error {
 		return err
 	}
 
+	err = db.Model(&zone).Updates(map[string]interface{}{"delete": true, "lifecycle": LifecyclePendingDelete}).Error
+	if err != nil {
+		return err
+	}
+
+	err = setZoneDeployState(zone.ID, DeployStatePending, nil)
+	if err != nil {
+		return err
+	}
+
+	Audit("zone.delete_requested", &zone, "")
+
+	// The parent stops delegating the zone right away, it would be lame during the decommission
+	err = RemoveDelegation(&zone)
+	if err != nil {
+		log.Errorf("removal of delegation of " + zone.Domain + ": " + err.Error())
+	}
+
+	if config.SkipDeploy {
+		return purgeZone(&zone)
+	}
+
+	go func(zone *Zone) {
+		err := DecommissionZone(zone)
+		if err != nil {
+			log.Errorf("decommission of " + zone.Domain + ": " + err.Error())
+		}
+	}(&zone)
+
+	return nil
+}
+
+// DecommissionZone removes zone marked for deletion from configs of all name servers, deletes its zone files
+// and finally removes the zone from the database. Deployment state of the zone is set to failed on error.
+func DecommissionZone(zone *Zone) error {
+	err := decommissionZone(zone)
+	if err != nil {
+		setZoneDeployState(zone.ID, DeployStateFailed, err)
+		Audit("zone.decommission_failed", zone, err.Error())
+		return err
+	}
+
+	return purgeZone(zone)
+}
+
+func decommissionZone(zone *Zone) error {
+	zoneFile := path.Join(PrimaryZonePath, zone.Domain+".zone")
+
+	// Last notify so secondaries pick up the final state before their config changes
+	if config.DecommissionNotify {
+		_, err := SendCommandViaSSH(config.PrimaryNameServer, "rndc notify "+zone.Domain)
+		if err != nil {
+			log.Warnf("final notify of " + zone.Domain + ": " + err.Error())
+		}
+	}
+
+	if fragmentsMode() {
+		return decommissionZoneFragments(zone)
+	}
+
+	err := RunOnHost(config.PrimaryNameServer, 0, deployMasterBindConfig)
+	if err != nil {
+		return errors.Wrap(err, config.PrimaryNameServer)
+	}
+
+	bindConfig, err := renderSecondaryBindConfig()
+	if err != nil {
+		return err
+	}
+
+	for _, server := range SecondaryNameServerAddresses() {
+		err = RunOnHost(server, 0, func() error {
+			err := deploySecondaryBindConfig(server, bindConfig)
+			if err != nil {
+				return err
+			}
+			_, err = SendCommandViaSSH(server, "rm -f "+zoneFile)
+			return err
+		})
+		if err != nil {
+			return errors.Wrap(err, server)
+		}
+	}
+
+	return RunOnHost(config.PrimaryNameServer, 0, func() error {
+		_, err := SendCommandViaSSH(config.PrimaryNameServer, "rm -f "+zoneFile)
+		return err
+	})
+}
+
+// Removes only the zone from all name servers, configs of other zones are not touched
+func decommissionZoneFragments(zone *Zone) error {
+	for _, server := range SecondaryNameServerAddresses() {
+		err := RunOnHost(server, 0, func() error { return removeZoneFragment(server, zone) })
+		if err != nil {
+			return errors.Wrap(err, server)
+		}
+	}
+
+	return RunOnHost(config.PrimaryNameServer, 0, func() error {
+		return removeZoneFragment(config.PrimaryNameServer, zone)
+	})
+}
+
+// Removes the zone with its records, assertions, query statistics and change requests from the database
+func purgeZone(zone *Zone) error {
+	err := RemoveDelegation(zone)
+	if err != nil {
+		return err
+	}
+
+	db := GetDatabaseConnection()
 	tx := db.Begin()
 
-	err = tx.Where("zone_id = ?", zoneId).Delete(&Record{}).Error
+	err = tx.Where("zone_id = ?", zone.ID).Delete(&Record{}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Where("zone_id = ?", zone.ID).Delete(&Assertion{}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Where("zone_id = ?", zone.ID).Delete(&QueryStat{}).Error
 	if err != nil {
 		tx.Rollback()
 		return err
 	}
 
-	err = tx.Where("id = ?", zoneId).Delete(&zone).Error
+	err = tx.Where("zone_id = ?", zone.ID).Delete(&ChangeRequest{}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Where("zone_id = ?", zone.ID).Delete(&CommitStat{}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Where("zone_id = ?", zone.ID).Delete(&ZoneVersion{}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Where("zone_id = ?", zone.ID).Delete(&ZoneDeployment{}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Where("id = ?", zone.ID).Delete(&Zone{}).Error
 	if err != nil {
 		tx.Rollback()
 		return err
@@ -96,14 +461,38 @@ func DeleteZone(zoneId uint) error {
 		return err
 	}
 
-	// Delete the zone file
-	_, err = SendCommandViaSSH(config.PrimaryNameServerIP, "rm -f "+path.Join(PrimaryZonePath, zone.Domain+".zone"))
+	Audit("zone.decommissioned", zone, "")
+
+	return nil
+}
+
+// Checks the record against records with the same name stored in the database. The zone validated before
+// could be loaded while another request added records, the check runs in the transaction writing the record.
+func checkStoredRecord(tx *gorm.DB, record *Record) error {
+	var records []Record
+
+	err := tx.Where("zone_id = ? AND lower(name) = ? AND id != ?", record.ZoneId, strings.ToLower(record.Name), record.ID).Find(&records).Error
 	if err != nil {
-		panic(err)
+		return err
 	}
+	stored := cnameConflicts(records)
+	records = append(records, *record)
+	last := len(records) - 1
 
-	go SetSlavesBindConfig()
-	go SetMasterBindConfig()
+	if err := duplicateRecords(records)[last]; err != nil {
+		return err
+	}
+	conflicts := cnameConflicts(records)
+	if err := conflicts[last]; err != nil {
+		return err
+	}
+	// Stored CNAME or ALIAS conflicting because of the new record, conflicts which were there before are
+	// not the new record's
+	for i := 0; i < last; i++ {
+		if conflicts[i] != nil && stored[i] == nil {
+			return conflicts[i]
+		}
+	}
 
 	return nil
 }
@@ -112,8 +501,9 @@ func DeleteZone(zoneId uint) error {
 func NewRecord(zoneId uint, name string, ttl int, recordType string, prio int, value string) (*Record, []error) {
 	var zone Zone
 
+	// Existing records are needed to find conflicts and duplicates
 	db := GetDatabaseConnection()
-	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
 	if err != nil {
 		return nil, []error{err}
 	}
@@ -123,10 +513,27 @@ func NewRecord(zoneId uint, name string, ttl int, recordType string, prio int, v
 		return nil, errs
 	}
 
-	err = db.Create(record).Error
+	tx := db.Begin()
+	err = checkStoredRecord(tx, record)
 	if err != nil {
+		tx.Rollback()
+		return nil, []error{err}
+	}
+	err = tx.Create(record).Error
+	if err != nil {
+		tx.Rollback()
 		return record, []error{err}
 	}
+	err = tx.Commit().Error
+	if err != nil {
+		return record, []error{err}
+	}
+
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return record, []error{err}
+	}
+	syncWWWAfterChange(zone.ID, record.Name)
 
 	return record, nil
 }
@@ -156,10 +563,20 @@ func UpdateRecord(recordId uint, name string, ttl int, prio int, value string) (
 		panic(errors.New("record not found"))
 	}
 
+	previous := record
+	previousName := record.Name
 	record.Name = name
 	record.TTL = ttl
 	record.Prio = prio
 	record.Value = value
+	record.Normalize(zone.Domain)
+
+	// Zone is validated with the updated record
+	for i := range zone.Records {
+		if zone.Records[i].ID == recordId {
+			zone.Records[i] = record
+		}
+	}
 
 	errs := zone.Validate()
 	if len(errs) > 0 {
@@ -167,52 +584,308 @@ func UpdateRecord(recordId uint, name string, ttl int, prio int, value string) (
 	}
 
 	tx := db.Begin()
+	err = checkStoredRecord(tx, &record)
+	if err != nil {
+		tx.Rollback()
+		return nil, []error{err}
+	}
 	err = tx.Model(&zone).Update("serial", zone.Serial).Error
 	if err != nil {
 		tx.Rollback()
 		return nil, []error{err}
 	}
-	err = tx.Model(&record).Update("name", name).
-		Update("ttl", ttl).
-		Update("prio", prio).
-		Update("value", value).Error
+	err = tx.Model(&record).Update("name", record.Name).
+		Update("ttl", record.TTL).
+		Update("prio", record.Prio).
+		Update("value", record.Value).Error
 	if err != nil {
 		tx.Rollback()
 		return nil, []error{err}
 	}
+	// Addresses of the previous ALIAS target are resolved again by the next commit
+	if record.Type == "ALIAS" && record.Value != previous.Value {
+		err = tx.Model(&record).Updates(map[string]interface{}{"resolved": "", "resolved_at": nil}).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, []error{err}
+		}
+	}
 
 	err = tx.Commit().Error
 	if err != nil {
 		return nil, []error{err}
 	}
 
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return nil, []error{err}
+	}
+	syncWWWAfterChange(zone.ID, previousName, record.Name)
+
 	err = db.Where("id = ?", recordId).Find(&record).Error
 	if err != nil {
 		return nil, []error{err}
 	}
+	record.Advisory = adviseChange(&previous, &record)
 
 	return &record, nil
 }
 
 // Delete existing record
 func DeleteRecord(recordId uint) error {
+	var record Record
+
 	db := GetDatabaseConnection()
 
-	err := db.Where("id = ?", recordId).Delete(&Record{}).Error
+	err := db.Where("id = ?", recordId).Find(&record).Error
+	if err != nil {
+		return err
+	}
+
+	err = db.Where("id = ?", recordId).Delete(&Record{}).Error
 	if err != nil {
 		return err
 	}
 
+	err = markZonePending(record.ZoneId)
+	if err != nil {
+		return err
+	}
+	syncWWWAfterChange(record.ZoneId, record.Name)
+
 	return nil
 }
 
-// Write new zone into DNS servers
-// TODO: here is a lot of SSH stuff we can do in parallel
+// Records are the same when they differ only in ID
+func recordKey(record *Record) string {
+	return record.Name + " " + strconv.Itoa(record.TTL) + " " + record.Type + " " + strconv.Itoa(record.Prio) + " " + record.Value
+}
+
+// ImportZoneFile replaces records of the zone by records from the zone file rendered by Zone.Render, or
+// from pasted output of dig axfr and host -l. Records which didn't change keep their IDs.
+func ImportZoneFile(zoneId uint, content string) (*Zone, []error) {
+	return ImportZoneFileProgress(zoneId, content, nil)
+}
+
+// ImportZoneFileProgress imports the zone file like ImportZoneFile and reports progress of parsing, validation
+// and inserting of records to the callback, nil callback reports nothing
+func ImportZoneFileProgress(zoneId uint, content string, report func(progress ImportProgress)) (*Zone, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	reporter := newImportReporter(report)
+	records, err := ParseImport(content, &zone)
+	if err != nil {
+		reporter.fail(err)
+		return nil, []error{err}
+	}
+	reporter.parsed(len(records))
+
+	return replaceRecords(zoneId, records, reporter)
+}
+
+// ReplaceRecords replaces records of the zone by given records in one transaction, records which
+// didn't change keep their IDs. Nothing is changed if any record is invalid.
+func ReplaceRecords(zoneId uint, records []Record) (*Zone, []error) {
+	return replaceRecords(zoneId, records, nil)
+}
+
+func replaceRecords(zoneId uint, records []Record, reporter *importReporter) (*Zone, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	existing := make(map[string][]Record)
+	for _, record := range zone.Records {
+		existing[recordKey(&record)] = append(existing[recordKey(&record)], record)
+	}
+
+	var imported []Record
+	var created []Record
+	for _, record := range records {
+		key := recordKey(&record)
+		if len(existing[key]) > 0 {
+			imported = append(imported, existing[key][0])
+			existing[key] = existing[key][1:]
+			continue
+		}
+		record.ZoneId = zone.ID
+		imported = append(imported, record)
+		created = append(created, record)
+	}
+
+	zone.Records = imported
+	reporter.validate(imported)
+	errs := zone.Validate()
+	if len(errs) > 0 {
+		reporter.fail(errs...)
+		return nil, errs
+	}
+
+	reporter.inserting(len(created))
+	tx := db.Begin()
+	for _, removed := range existing {
+		for _, record := range removed {
+			err = tx.Where("id = ?", record.ID).Delete(&Record{}).Error
+			if err != nil {
+				tx.Rollback()
+				return nil, []error{err}
+			}
+		}
+	}
+	for _, record := range created {
+		err = tx.Create(&record).Error
+		if err != nil {
+			tx.Rollback()
+			reporter.fail(err)
+			return nil, []error{err}
+		}
+		reporter.inserted()
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
+
+// Sets deployment state of the zone, deployErr is saved for failed deployments
+func setZoneDeployState(zoneId uint, state string, deployErr error) error {
+	values := map[string]interface{}{
+		"deploy_state": state,
+		"deploy_error": "",
+	}
+	if deployErr != nil {
+		values["deploy_error"] = deployErr.Error()
+	}
+	if state == DeployStateDeployed {
+		values["deployed_at"] = time.Now().UTC()
+	}
+
+	db := GetDatabaseConnection()
+	return db.Model(&Zone{}).Where("id = ?", zoneId).Updates(values).Error
+}
+
+// Marks the zone as changed since the last deployment, frozen zones stay frozen and queued zones stay in the queue.
+// UpdatedAt is touched in every state, conditional requests of rendered zones depend on it.
+func markZonePending(zoneId uint) error {
+	db := GetDatabaseConnection()
+	err := db.Model(&Zone{}).Where("id = ?", zoneId).Update("updated_at", time.Now()).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Model(&Zone{}).
+		Where("id = ? AND deploy_state NOT IN (?)", zoneId, []string{DeployStateFrozen, DeployStateQueued}).
+		Update("deploy_state", DeployStatePending).Error
+}
+
+// FreezeZone stops deployments of the zone until it's unfrozen
+func FreezeZone(zoneId uint) (*Zone, error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = setZoneDeployState(zone.ID, DeployStateFrozen, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	return &zone, err
+}
+
+// UnfreezeZone allows deployments of frozen zone again, the zone has to be committed to deploy changes made meanwhile
+func UnfreezeZone(zoneId uint) (*Zone, error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if zone.DeployState == DeployStateFrozen {
+		err = setZoneDeployState(zone.ID, DeployStatePending, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	return &zone, err
+}
+
+// Zones being committed right now
+var commitLocksLock sync.Mutex
+var commitLocks = make(map[uint]bool)
+
+// Returns false if the zone is already being committed
+func lockZoneCommit(zoneId uint) bool {
+	commitLocksLock.Lock()
+	defer commitLocksLock.Unlock()
+
+	if commitLocks[zoneId] {
+		return false
+	}
+	commitLocks[zoneId] = true
+
+	return true
+}
+
+func unlockZoneCommit(zoneId uint) {
+	commitLocksLock.Lock()
+	defer commitLocksLock.Unlock()
+
+	delete(commitLocks, zoneId)
+}
+
+// Write new zone into DNS servers, the commit is queued if the zone is outside of its deployment window
 func Commit(zoneId uint) error {
-	var zones []Zone // all zones
-	var zone Zone    // updating zone
+	return CommitZone(zoneId, false)
+}
+
+// Write new zone into DNS servers, override deploys it even outside of deployment window
+// TODO: here is a lot of SSH stuff we can do in parallel
+func CommitZone(zoneId uint, override bool) error {
+	var zone Zone // updating zone
 
-	// Get the committing zone and all zones from db
+	// Serial bump and deployment of the primary can't interleave with another commit of the same zone
+	if !lockZoneCommit(zoneId) {
+		return ErrCommitInProgress
+	}
+	deploying := false
+	defer func() {
+		if !deploying {
+			unlockZoneCommit(zoneId)
+		}
+	}()
+
+	// Get the committing zone from db
 	db := GetDatabaseConnection()
 	err := db.Model(&zone).Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
 	if err != nil {
@@ -222,33 +895,107 @@ func Commit(zoneId uint) error {
 		return err
 	}
 
-	err = db.Find(&zones).Error
+	if zone.Delete {
+		return ErrZoneDeleted
+	}
+	if zone.DeployState == DeployStateFrozen {
+		return ErrZoneFrozen
+	}
+
+	_, err = resolveZoneAliases(&zone)
+	if err != nil {
+		return err
+	}
+	err = zone.checkVariables()
 	if err != nil {
 		return err
 	}
 
-	// Set new serial
-	zone.SetNewSerial()
-	err = db.Model(&zone).Update("serial", zone.Serial).Error
+	if config.LintStrict {
+		report := LintZone(&zone)
+		if len(report.Errors()) > 0 {
+			return &LintError{Report: report}
+		}
+	} else {
+		err = checkRenderLimits(&zone)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = runPreCommitHooks(&zone)
 	if err != nil {
 		return err
 	}
 
-	// Generate all config files for bind
-	var allZonesPrimaryConfig string
-	var allZonesSecondaryConfig string
-	for _, zone := range zones {
-		allZonesPrimaryConfig += zone.RenderPrimary()
-		allZonesPrimaryConfig += "\n"
+	if !override && !DeployWindowOpen(&zone, time.Now()) {
+		err = setZoneDeployState(zone.ID, DeployStateQueued, nil)
+		if err != nil {
+			return err
+		}
+		return ErrCommitQueued
+	}
 
-		allZonesSecondaryConfig += zone.RenderSecondary()
-		allZonesSecondaryConfig += "\n"
+	now := time.Now()
+	err = checkSerialLimit(&zone, now, override)
+	if err != nil {
+		return err
 	}
 
-	// Save slaves' main config
-	go SetSlavesBindConfig()
+	// Set new serial, it has to be newer than serials served by name servers (ex. after restore from backup)
+	if zone.NextSerial != "" {
+		zone.Serial = zone.NextSerial
+	} else {
+		zone.SetNewSerial()
+		if config.SerialCheck && !config.SkipDeploy {
+			zone.Serial, err = serialResolver(&zone, zone.Serial, LiveSerials(&zone))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err = db.Model(&zone).Updates(map[string]interface{}{"serial": zone.Serial, "serial_bumped_at": now.UTC(), "next_serial": ""}).Error
+	if err != nil {
+		return err
+	}
+	countCommit(zone.ID, now)
+	err = saveZoneVersion(&zone)
+	if err != nil {
+		return err
+	}
+
+	if config.SkipDeploy {
+		err = setZoneDeployState(zone.ID, DeployStateDeployed, nil)
+		if err != nil {
+			return err
+		}
+		runPostCommitHooks(&zone)
+		return nil
+	}
+
+	// Progress on every name server is kept, so deployments interrupted by a restart are resumed
+	secondaries := SecondaryNameServerAddresses()
+	err = startZoneDeployments(&zone, secondaries)
+	if err != nil {
+		return err
+	}
+
+	// Emergency copy at another provider doesn't wait for our name servers
+	if zone.Standby && config.StandbyServer != "" {
+		go SyncStandby(&zone)
+	}
+
+	// Save slaves' main config or just the zone's fragment
+	if fragmentsMode() {
+		go SetSlavesZoneFragment(&zone)
+	} else {
+		go SetSlavesBindConfig()
+	}
 
-	go func(zone *Zone, IP string, bindConfig string) {
+	// The lock is released when the primary is deployed
+	deploying = true
+	go func(zone *Zone) {
+		defer unlockZoneCommit(zone.ID)
 		// This is called as goroutine so we need to recover from panicing
 		defer func() {
 			// TODO: implement sentry here
@@ -256,35 +1003,43 @@ func Commit(zoneId uint) error {
 				log.Errorf(r.(error).Error())
 			}
 		}()
-		// Save zone file
-		err = SendFileViaSSH(IP, path.Join(PrimaryZonePath, zone.Domain+".zone"), zone.Render())
+		// Mass updates don't reload the primary in parallel
+		release := acquireDeploySlot()
+		defer release()
+
+		// Save zone file and master's config
+		err := RunOnHost(config.PrimaryNameServer, zone.ID, func() error {
+			return deployPrimaryZone(zone)
+		})
+		finishZoneDeployment(zone.ID, zone.Serial, config.PrimaryNameServer, err)
 		if err != nil {
+			setZoneDeployState(zone.ID, DeployStateFailed, err)
 			panic(err)
 		}
-
-		SetMasterBindConfig()
-	}(&zone, config.PrimaryNameServer, allZonesPrimaryConfig)
+		err = setZoneDeployState(zone.ID, DeployStateDeployed, nil)
+		if err != nil {
+			panic(err)
+		}
+	}(&zone)
 
 	// Force zone refresh a few moments after everything is done
-	go func(config *Config, zone *Zone) {
-		// This is called as goroutine so we need to recover from panicing
-		defer func() {
-			// TODO: implement sentry here
-			if r := recover(); r != nil {
-				log.Errorf(r.(error).Error())
-			}
-		}()
+	go func(servers []string, zone *Zone) {
 		// Wait for 10 second to settle things up
 		time.Sleep(10 * time.Second)
 
-		// When reload is done, force to refresh
-		for _, server := range config.SecondaryNameServerIPs {
-			_, err = SendCommandViaSSH(server, "rndc refresh "+zone.Domain)
+		// When reload is done, force to refresh, unreachable secondary doesn't stop the others
+		for _, server := range servers {
+			err := RunOnHost(server, zone.ID, func() error {
+				_, err := SendCommandViaSSH(server, "rndc refresh "+zone.Domain)
+				return err
+			})
+			finishZoneDeployment(zone.ID, zone.Serial, server, err)
 			if err != nil {
-				panic(err)
+				log.Errorf("refresh of " + zone.Domain + " on " + server + ": " + err.Error())
 			}
 		}
-	}(&config, &zone)
+	}(secondaries, &zone)
+	runPostCommitHooks(&zone)
 
 	return nil
 }
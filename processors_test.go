@@ -4,6 +4,7 @@ import (
 	"os"
 	"os/user"
 	"path"
+	"strings"
 	"testing"
 )
 
@@ -97,3 +98,419 @@ func TestNewZone(t *testing.T) {
 	//	t.Error("Zone doesn't have delete flag")
 	//}
 }
+
+func TestSeed(t *testing.T) {
+	db := GetDatabaseConnection()
+
+	err := Seed()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var zone Zone
+	err = db.Where("domain = ?", "big-hosting.test").Preload("Records").Find(&zone).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zone.Records) < SeedBigZoneSize {
+		t.Error("Big zone contains only", len(zone.Records), "records")
+	}
+
+	var signedZone Zone
+	err = db.Where("domain = ?", "signed-bank.test").Find(&signedZone).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !signedZone.DNSSEC {
+		t.Error("DNSSEC zone is not signed")
+	}
+
+	// Second run has to skip existing zones
+	err = Seed()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewTenantZone(t *testing.T) {
+	template, errs := NewTemplate("hosting", []TemplateRecord{
+		{Name: "@", Type: "A", Value: "1.2.3.4"},
+		{Name: "www", Type: "CNAME", TTL: 600, Value: "@"},
+	})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	tenant, errs := NewTenant(Tenant{
+		Name:              "Reseller",
+		DefaultTTL:        900,
+		DefaultAbuseEmail: "abuse@reseller.cz",
+		DefaultTags:       "reseller",
+		DefaultPool:       "eu",
+		DefaultTemplateId: template.ID,
+	})
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	zone, errs := NewTenantZone(tenant.ID, "K-"+TEST_DOMAIN, []string{""}, "")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if zone.TenantId != tenant.ID || zone.Tags != "reseller" || zone.AbuseEmail != "abuse@reseller.cz" || zone.Pool != "eu" || zone.TTL != 900 {
+		t.Error("Tenant's defaults were not applied", zone)
+	}
+	if len(zone.Records) != 2 {
+		t.Fatal("Template was not applied", zone.Records)
+	}
+	for _, record := range zone.Records {
+		if record.Name == "@" && record.TTL != 900 {
+			t.Error("Record without TTL doesn't use zone's default TTL", record)
+		}
+		if record.Name == "www" && record.TTL != 600 {
+			t.Error("Record's TTL was overwritten", record)
+		}
+	}
+
+	// Explicit values win over tenant's defaults
+	zone, errs = NewTenantZone(tenant.ID, "L-"+TEST_DOMAIN, []string{"own"}, TEST_ABUSE_EMAIL)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if zone.Tags != "own" || zone.AbuseEmail != TEST_ABUSE_EMAIL {
+		t.Error("Tenant's defaults overwrote given values", zone)
+	}
+
+	record, errs := NewRecord(zone.ID, "mail", 0, "A", 0, "1.2.3.5")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if record.TTL != 900 {
+		t.Error("Record without TTL doesn't use zone's default TTL", record)
+	}
+
+	if DeleteTemplate(template.ID) == nil {
+		t.Error("Template used by tenant was deleted")
+	}
+
+	// Zone without its template is removed, the next attempt doesn't find it
+	db := GetDatabaseConnection()
+	if err := db.Model(tenant).Update("default_template_id", template.ID+1000).Error; err != nil {
+		t.Fatal(err)
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		_, errs = NewTenantZone(tenant.ID, "CE-"+TEST_DOMAIN, []string{}, "")
+		if len(errs) == 0 {
+			t.Fatal("Zone was created with missing template")
+		}
+	}
+	var count int
+	db.Model(&Zone{}).Where("domain = ?", "ce-"+TEST_DOMAIN).Count(&count)
+	if count != 0 {
+		t.Error("Zone with failed template was kept", count)
+	}
+	if err := db.Model(tenant).Update("default_template_id", template.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if DeleteTenant(tenant.ID) == nil {
+		t.Error("Tenant owning zones was deleted")
+	}
+}
+
+func TestVerifyAbuseEmail(t *testing.T) {
+	db := GetDatabaseConnection()
+
+	zone, errs := NewZone("M-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	_, errs = UpdateZone(zone.ID, []string{}, "typo@ohphiuhi")
+	if len(errs) != 1 {
+		t.Error("Invalid abuse email accepted", errs)
+	}
+
+	err := db.Model(zone).Update("abuse_email_token", "testtoken").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = VerifyAbuseEmail("wrongtoken")
+	if err == nil {
+		t.Error("Wrong token accepted")
+	}
+
+	verifiedZone, err := VerifyAbuseEmail("testtoken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verifiedZone.AbuseEmailVerified || verifiedZone.AbuseEmailVerifiedAt == nil {
+		t.Error("Abuse email is not verified")
+	}
+
+	// Token can be used only once
+	_, err = VerifyAbuseEmail("testtoken")
+	if err == nil {
+		t.Error("Token was used twice")
+	}
+
+	// Changed email has to be verified again
+	updatedZone, errs := UpdateZone(zone.ID, []string{}, "new@ohphiuhi.txt")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if updatedZone.AbuseEmailVerified {
+		t.Error("Changed abuse email is still verified")
+	}
+}
+
+func TestZoneDeployState(t *testing.T) {
+	db := GetDatabaseConnection()
+
+	config.SkipDeploy = true
+	defer func() { config.SkipDeploy = false }()
+
+	zone, errs := NewZone("N-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	state := func() string {
+		var current Zone
+		err := db.Where("id = ?", zone.ID).Find(&current).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		return current.DeployState
+	}
+
+	if state() != DeployStatePending {
+		t.Error("New zone is not pending", state())
+	}
+
+	err := Commit(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state() != DeployStateDeployed {
+		t.Error("Committed zone is not deployed", state())
+	}
+
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "1.2.3.4")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if state() != DeployStatePending {
+		t.Error("Changed zone is not pending", state())
+	}
+
+	_, err = FreezeZone(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Commit(zone.ID) != ErrZoneFrozen {
+		t.Error("Frozen zone was committed")
+	}
+	_, errs = NewRecord(zone.ID, "www2", 300, "A", 0, "1.2.3.4")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if state() != DeployStateFrozen {
+		t.Error("Change unfroze the zone", state())
+	}
+
+	_, err = UnfreezeZone(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state() != DeployStatePending {
+		t.Error("Unfrozen zone is not pending", state())
+	}
+}
+
+func TestDeleteZone(t *testing.T) {
+	db := GetDatabaseConnection()
+
+	config.SkipDeploy = true
+	defer func() { config.SkipDeploy = false }()
+
+	zone, errs := NewZone("P-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "1.2.3.4")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	// Zone marked for deletion is left out from configs and can't be committed
+	err := db.Model(zone).Update("delete", true).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	bindConfig, err := renderSecondaryBindConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(bindConfig, zone.Domain) {
+		t.Error("Zone marked for deletion is still in the config")
+	}
+	if Commit(zone.ID) != ErrZoneDeleted {
+		t.Error("Zone marked for deletion was committed")
+	}
+
+	err = DeleteZone(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	db.Model(&Record{}).Where("zone_id = ?", zone.ID).Count(&count)
+	if count != 0 {
+		t.Error("Records of deleted zone were not removed")
+	}
+	db.Model(&Zone{}).Where("id = ?", zone.ID).Count(&count)
+	if count != 0 {
+		t.Error("Deleted zone was not removed")
+	}
+
+	var entries []AuditEntry
+	err = db.Where("zone_id = ?", zone.ID).Order("id").Find(&entries).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != "zone.delete_requested" || entries[1].Action != "zone.decommissioned" {
+		t.Error("Unexpected audit log", entries)
+	}
+}
+
+func TestCommitLock(t *testing.T) {
+	config.SkipDeploy = true
+	defer func() { config.SkipDeploy = false }()
+
+	zone, errs := NewZone("R-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if !lockZoneCommit(zone.ID) {
+		t.Fatal("Zone is locked before the first commit")
+	}
+	if Commit(zone.ID) != ErrCommitInProgress {
+		t.Error("Zone was committed while another commit was in progress")
+	}
+	unlockZoneCommit(zone.ID)
+
+	err := Commit(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lockZoneCommit(zone.ID) {
+		t.Error("Finished commit didn't release the lock")
+	}
+	unlockZoneCommit(zone.ID)
+}
+
+func TestSetZoneMinimumTTL(t *testing.T) {
+	zone, errs := NewZone("W-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "1.2.3.4")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(zone.ID, "short", 60, "A", 0, "1.2.3.5")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	_, _, errs = SetZoneMinimumTTL(zone.ID, 30)
+	if len(errs) == 0 {
+		t.Error("Too low minimum TTL passed")
+	}
+
+	updated, warnings, errs := SetZoneMinimumTTL(zone.ID, 120)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if updated.NegativeTTL() != 120 || !strings.Contains(updated.Render(), "\t\t120\n)") {
+		t.Error("Minimum TTL wasn't set", updated.Render())
+	}
+	if len(warnings) != 1 || warnings[0].Name != "short" {
+		t.Error("Unexpected warnings", warnings)
+	}
+
+	updated, warnings, errs = SetZoneMinimumTTL(zone.ID, 0)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if updated.NegativeTTL() != config.MinimalTTL || len(warnings) != 0 {
+		t.Error("Default minimum TTL wasn't restored", warnings)
+	}
+}
+
+func TestNewRecord_duplicates(t *testing.T) {
+	config.TTL = 300
+	defer func() { config.TTL = 0 }()
+
+	zone, errs := NewZone("BS-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	_, errs = NewRecord(zone.ID, "@", 300, "TXT", 0, "v=spf1 -all")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(zone.ID, "@", 600, "TXT", 0, "v=spf1 -all")
+	if len(errs) != 1 || errs[0].Error() != "TXT @: the same record with value v=spf1 -all already exists" {
+		t.Error("Duplicate record passed", errs)
+	}
+
+	www, errs := NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	other, errs := NewRecord(zone.ID, "ftp", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = UpdateRecord(other.ID, "www", 300, 0, "192.0.2.1")
+	if len(errs) != 1 {
+		t.Error("Update to a duplicate record passed", errs)
+	}
+
+	// Records stored after the zone was loaded, e.g. by a concurrent request, are checked too
+	err := checkStoredRecord(GetDatabaseConnection(), &Record{ZoneId: zone.ID, Name: "WWW", Type: "CNAME", Value: "example.com."})
+	if err == nil || err.Error() != "CNAME WWW is already used in another record, CNAME can't share its name with any other record" {
+		t.Error("CNAME conflicting with stored records passed", err)
+	}
+	err = checkStoredRecord(GetDatabaseConnection(), www)
+	if err != nil {
+		t.Error("Stored record conflicts with itself", err)
+	}
+
+	// Conflicts stored before don't refuse unrelated records, new ones conflicting with stored CNAME are refused
+	for _, record := range []Record{
+		{ZoneId: zone.ID, Name: "legacy", TTL: 300, Type: "CNAME", Value: "example.com."},
+		{ZoneId: zone.ID, Name: "legacy", TTL: 300, Type: "A", Value: "192.0.2.2"},
+		{ZoneId: zone.ID, Name: "alias", TTL: 300, Type: "CNAME", Value: "example.com."},
+	} {
+		if err := GetDatabaseConnection().Create(&record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = checkStoredRecord(GetDatabaseConnection(), &Record{ZoneId: zone.ID, Name: "mail", Type: "A", Value: "192.0.2.3"})
+	if err != nil {
+		t.Error("Record refused for conflict of other records", err)
+	}
+	err = checkStoredRecord(GetDatabaseConnection(), &Record{ZoneId: zone.ID, Name: "alias", Type: "A", Value: "192.0.2.3"})
+	if err == nil || err.Error() != "CNAME alias is already used in another record, CNAME can't share its name with any other record" {
+		t.Error("Record conflicting with stored CNAME passed", err)
+	}
+}
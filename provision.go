@@ -0,0 +1,131 @@
+package main
+
+import (
+	"path"
+	"strconv"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Commands preparing directory layout of a fresh secondary and including our config into Bind's config
+var provisionCommands = []string{
+	"mkdir -p " + PrimaryZonePath + " " + path.Dir(SecondaryBindConfigPath) + " " + BindFragmentsPath,
+	"chown bind:bind " + PrimaryZonePath,
+	"touch " + SecondaryBindConfigPath,
+	"grep -qF 'include \"" + SecondaryBindConfigPath + "\";' /etc/bind/named.conf || " +
+		"echo 'include \"" + SecondaryBindConfigPath + "\";' >> /etc/bind/named.conf",
+}
+
+// ValidateProvisioning checks that the host can be registered into the inventory before anything is sent to it
+func ValidateProvisioning(nameServer NameServer) []error {
+	nameServer.ID = 0
+	nameServer.Role = NameServerRoleSecondary
+
+	return nameServer.Validate()
+}
+
+// ProvisionSecondary bootstraps a fresh host accessible via SSH as a new secondary: registers it in the inventory,
+// prepares the directory layout, pushes all zone files, generates config of all zones and allows transfers
+// from it on the primary server. The host is removed from the inventory again if anything fails.
+func ProvisionSecondary(nameServerBody NameServer) (*NameServer, error) {
+	nameServerBody.Role = NameServerRoleSecondary
+
+	// Registered first so its file settings apply on everything sent to it
+	nameServer, errs := NewNameServer(nameServerBody)
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	zonesCount, err := provisionSecondary(nameServer)
+	if err != nil {
+		deleteErr := DeleteNameServer(nameServer.ID)
+		if deleteErr != nil {
+			log.Errorf("removal of unprovisioned " + nameServer.Hostname + ": " + deleteErr.Error())
+		}
+		return nil, err
+	}
+
+	// Primary has to allow transfers to the new server
+	err = RunOnHost(config.PrimaryNameServer, 0, deployMasterBindConfig)
+	if err != nil {
+		return nameServer, errors.Wrap(err, "primary server")
+	}
+
+	log.Infof("name server " + nameServer.Hostname + " provisioned with " + strconv.Itoa(zonesCount) + " zones")
+
+	return nameServer, nil
+}
+
+func provisionSecondary(nameServer *NameServer) (int, error) {
+	ip := nameServer.IP
+
+	for _, command := range provisionCommands {
+		output, err := SendCommandViaSSH(ip, command)
+		if err != nil {
+			if output != nil {
+				return 0, errors.Wrap(err, command+": "+output.String())
+			}
+			return 0, errors.Wrap(err, command)
+		}
+	}
+
+	// Zone files so the server can answer even before the first transfer
+	var zones []Zone
+
+	db := GetDatabaseConnection()
+	err := activeZones(db).Preload("Records").Find(&zones).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for _, zone := range zones {
+		err = SendDeployFileViaSSH(ip, path.Join(PrimaryZonePath, zone.Domain+".zone"), zone.Render())
+		if err != nil {
+			return 0, errors.Wrap(err, zone.Domain)
+		}
+	}
+
+	bindConfig, err := renderSecondaryBindConfig()
+	if err != nil {
+		return 0, err
+	}
+
+	err = deploySecondaryBindConfig(ip, bindConfig)
+	if err != nil {
+		return 0, err
+	}
+
+	err = deployZoneFragments(ip, zones)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(zones), nil
+}
+
+// Command line provisioning
+func provisionCommand(args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return errors.New("usage: dnsapi provision <hostname> <IP> [pool]")
+	}
+
+	pool := ""
+	if len(args) == 3 {
+		pool = args[2]
+	}
+
+	SetNameServerIPs()
+
+	err := SyncNameServers()
+	if err != nil {
+		return err
+	}
+
+	_, err = ProvisionSecondary(NameServer{
+		Hostname: args[0],
+		IP:       args[1],
+		Pool:     pool,
+	})
+	return err
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// QueryStat is number of queries of one name in one zone during one day (UTC)
+type QueryStat struct {
+	ID     uint   `json:"-" gorm:"primary_key"`
+	ZoneId uint   `json:"zone_id" sql:"index"`
+	Name   string `json:"name"`
+	Day    string `json:"day" sql:"index"` // 2006-01-02
+
+	Queries  int `json:"queries"`
+	NXDomain int `json:"nxdomain" gorm:"column:nxdomain"` // Answers with NXDOMAIN
+}
+
+// QueryLogEntry is one query sent by a collector, ex. converted dnstap message
+type QueryLogEntry struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Rcode string `json:"rcode"` // NOERROR, NXDOMAIN, ..., empty if unknown
+	Count int    `json:"count"` // 1 if not set
+
+	Time time.Time `json:"time"` // When the query was answered, time of the ingestion if not set
+}
+
+// QueryLogResult is summary of one ingestion
+type QueryLogResult struct {
+	Lines   int `json:"lines"`
+	Counted int `json:"counted"`
+	Skipped int `json:"skipped"` // Lines which can't be parsed or queries of names we don't host
+
+	// Counted lines without response code, ex. all lines of Bind's query log, they aren't in NXDOMAIN counts
+	WithoutRcode int `json:"without_rcode"`
+}
+
+// Timestamps Bind prints in front of log lines: the default format, iso8601 and iso8601-utc of print-time.
+// Fractional seconds are accepted by all of them.
+var queryLogTimeFormats = []string{"02-Jan-2006 15:04:05", "2006-01-02T15:04:05Z07:00", "2006-01-02T15:04:05"}
+
+// Parses the timestamp at the start of Bind's log line, times without zone are in the local time like Bind
+// logs them. Zero time is returned for lines without timestamp, ex. from syslog.
+func queryLogTime(line string) time.Time {
+	fields := strings.Fields(line)
+	var candidates []string
+	if len(fields) > 1 {
+		candidates = append(candidates, fields[0]+" "+fields[1])
+	}
+	if len(fields) > 0 {
+		candidates = append(candidates, fields[0])
+	}
+
+	for _, candidate := range candidates {
+		for _, format := range queryLogTimeFormats {
+			parsed, err := time.ParseInLocation(format, candidate, time.Local)
+			if err == nil {
+				return parsed
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// Parses one line of Bind's query log or JSON entry from a collector, false is returned for anything else.
+// Bind's format: 10-May-2020 12:00:00.000 ... client ... (www.example.com): query: www.example.com IN A +E(0)K (192.0.2.1)
+// Bind doesn't log response codes of queries, rcode of its lines is empty.
+func parseQueryLogLine(line string) (QueryLogEntry, bool) {
+	var entry QueryLogEntry
+
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		err := json.Unmarshal([]byte(line), &entry)
+		if err != nil || entry.Name == "" {
+			return entry, false
+		}
+	} else {
+		index := strings.Index(line, " query: ")
+		if index < 0 {
+			return entry, false
+		}
+		fields := strings.Fields(line[index+len(" query: "):])
+		if len(fields) < 3 {
+			return entry, false
+		}
+		entry.Name = fields[0]
+		entry.Type = fields[2]
+		entry.Time = queryLogTime(line[:index])
+	}
+
+	entry.Name = strings.ToLower(strings.TrimSuffix(entry.Name, "."))
+	entry.Rcode = strings.ToUpper(entry.Rcode)
+	if entry.Count <= 0 {
+		entry.Count = 1
+	}
+
+	return entry, true
+}
+
+// IngestQueryLog adds queries from the log into daily statistics of zones by the time of each query,
+// queries without time happened at given time
+func IngestQueryLog(content string, now time.Time) (*QueryLogResult, error) {
+	var zones []Zone
+
+	db := GetDatabaseConnection()
+	err := activeZones(db).Find(&zones).Error
+	if err != nil {
+		return nil, err
+	}
+
+	zoneIds := make(map[string]uint)
+	for _, zone := range zones {
+		zoneIds[zone.Domain] = zone.ID
+	}
+
+	// Aggregated in memory first, logs contain many queries of the same names
+	type statKey struct {
+		zoneId uint
+		name   string
+		day    string
+	}
+	stats := make(map[statKey]*QueryStat)
+	result := QueryLogResult{}
+
+	for _, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		result.Lines++
+
+		entry, ok := parseQueryLogLine(line)
+		if !ok {
+			result.Skipped++
+			continue
+		}
+
+		// The most specific zone containing the name
+		var zoneId uint
+		var domain string
+		labels := strings.Split(entry.Name, ".")
+		for i := range labels {
+			suffix := strings.Join(labels[i:], ".")
+			if id, ok := zoneIds[suffix]; ok {
+				zoneId = id
+				domain = suffix
+				break
+			}
+		}
+		if zoneId == 0 {
+			result.Skipped++
+			continue
+		}
+
+		answered := entry.Time
+		if answered.IsZero() {
+			answered = now
+		}
+		key := statKey{zoneId: zoneId, name: normalizeName(entry.Name+".", domain), day: answered.UTC().Format("2006-01-02")}
+		stat, ok := stats[key]
+		if !ok {
+			stat = &QueryStat{ZoneId: zoneId, Name: key.name, Day: key.day}
+			stats[key] = stat
+		}
+		stat.Queries += entry.Count
+		if entry.Rcode == "NXDOMAIN" {
+			stat.NXDomain += entry.Count
+		}
+		if entry.Rcode == "" {
+			result.WithoutRcode++
+		}
+		result.Counted++
+	}
+
+	tx := db.Begin()
+	for _, stat := range stats {
+		var existing QueryStat
+		err = tx.Where("zone_id = ? AND name = ? AND day = ?", stat.ZoneId, stat.Name, stat.Day).First(&existing).Error
+		if err == nil {
+			err = tx.Model(&existing).Updates(map[string]interface{}{
+				"queries":  existing.Queries + stat.Queries,
+				"nxdomain": existing.NXDomain + stat.NXDomain,
+			}).Error
+		} else if err == gorm.ErrRecordNotFound {
+			err = tx.Create(stat).Error
+		}
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// TopName is one name in the top talkers report
+type TopName struct {
+	Name     string `json:"name"`
+	Queries  int    `json:"queries"`
+	NXDomain int    `json:"nxdomain"`
+}
+
+// TopTalkers is report of the most queried names of the zone
+type TopTalkers struct {
+	ZoneId      uint      `json:"zone_id"`
+	Since       string    `json:"since"` // First day included in the report
+	TopQueried  []TopName `json:"top_queried"`
+	TopNXDomain []TopName `json:"top_nxdomain"`
+}
+
+// GetTopTalkers returns limit most queried names and names with most NXDOMAIN answers of the zone in the last days
+func GetTopTalkers(zoneId uint, days int, limit int, now time.Time) (*TopTalkers, error) {
+	var zone Zone
+	var stats []QueryStat
+
+	db := GetReadDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	since := now.UTC().AddDate(0, 0, -(days - 1)).Format("2006-01-02")
+	err = db.Where("zone_id = ? AND day >= ?", zoneId, since).Find(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]*TopName)
+	for _, stat := range stats {
+		if _, ok := names[stat.Name]; !ok {
+			names[stat.Name] = &TopName{Name: stat.Name}
+		}
+		names[stat.Name].Queries += stat.Queries
+		names[stat.Name].NXDomain += stat.NXDomain
+	}
+
+	var all []TopName
+	for _, name := range names {
+		all = append(all, *name)
+	}
+
+	report := TopTalkers{
+		ZoneId:      zone.ID,
+		Since:       since,
+		TopQueried:  []TopName{},
+		TopNXDomain: []TopName{},
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Queries != all[j].Queries {
+			return all[i].Queries > all[j].Queries
+		}
+		return all[i].Name < all[j].Name
+	})
+	for _, name := range all {
+		if len(report.TopQueried) >= limit {
+			break
+		}
+		report.TopQueried = append(report.TopQueried, name)
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].NXDomain != all[j].NXDomain {
+			return all[i].NXDomain > all[j].NXDomain
+		}
+		return all[i].Name < all[j].Name
+	})
+	for _, name := range all {
+		if len(report.TopNXDomain) >= limit || name.NXDomain == 0 {
+			break
+		}
+		report.TopNXDomain = append(report.TopNXDomain, name)
+	}
+
+	return &report, nil
+}
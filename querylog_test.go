@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIngestQueryLog(t *testing.T) {
+	zone, errs := NewZone("AB-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	now := time.Date(2020, 5, 10, 12, 0, 0, 0, time.UTC)
+	log := `10-May-2020 12:00:00.000 queries: info: client @0x7f 192.0.2.1#53535 (www.ab-ohphiuhi.txt): query: www.ab-ohphiuhi.txt IN A +E(0)K (198.51.100.1)
+10-May-2020 12:00:01.000 queries: info: client @0x7f 192.0.2.1#53536 (WWW.ab-ohphiuhi.txt): query: WWW.ab-ohphiuhi.txt IN AAAA +E(0)K (198.51.100.1)
+10-May-2020 12:00:02.000 queries: info: client @0x7f 192.0.2.2#53537 (ab-ohphiuhi.txt): query: ab-ohphiuhi.txt IN MX +E(0)K (198.51.100.1)
+10-May-2020 12:00:03.000 queries: info: client @0x7f 192.0.2.2#53538 (example.com): query: example.com IN A +E(0)K (198.51.100.1)
+{"name": "missing.ab-ohphiuhi.txt.", "type": "A", "rcode": "NXDOMAIN", "count": 5}
+garbage
+`
+
+	result, err := IngestQueryLog(log, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Lines != 6 || result.Counted != 4 || result.Skipped != 2 || result.WithoutRcode != 3 {
+		t.Error("Unexpected result", result)
+	}
+
+	// The next day with queries of the previous day ingested late
+	_, err = IngestQueryLog(`{"name": "www.ab-ohphiuhi.txt", "type": "A"}
+{"name": "www.ab-ohphiuhi.txt", "type": "A", "time": "2020-05-10T23:59:00Z"}
+2020-05-10T23:59:30.000Z queries: info: client @0x7f 192.0.2.1#53539 (www.ab-ohphiuhi.txt): query: www.ab-ohphiuhi.txt IN A +E(0)K (198.51.100.1)
+`, now.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := GetTopTalkers(zone.ID, 7, 2, now.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.TopQueried) != 2 || report.TopQueried[0].Name != "missing" || report.TopQueried[0].Queries != 5 ||
+		report.TopQueried[1].Name != "www" || report.TopQueried[1].Queries != 5 {
+		t.Error("Unexpected top queried names", report.TopQueried)
+	}
+	if len(report.TopNXDomain) != 1 || report.TopNXDomain[0].NXDomain != 5 {
+		t.Error("Unexpected NXDOMAIN leaders", report.TopNXDomain)
+	}
+
+	// Only the last day
+	report, err = GetTopTalkers(zone.ID, 1, 10, now.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.TopQueried) != 1 || report.TopQueried[0].Queries != 1 {
+		t.Error("Unexpected report of one day", report.TopQueried)
+	}
+}
@@ -0,0 +1,665 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RecordType handles one type of records. Common checks (name, TTL) are done by Record.Validate,
+// the type handles only what belongs to it. Nil Normalize keeps values as they are, nil RenderData
+// renders record's value as it is. Target is set for types pointing to another name.
+type RecordType struct {
+	Validate   func(r *Record) error
+	Normalize  func(r *Record, domain string)
+	RenderData func(r *Record) string // Data part of the line in zone file, after the type
+	Target     func(r *Record) string
+	Schema     map[string]interface{} // JSON schema of the record's body
+	MaxLength  int                    // Maximal length of the value, checked before Validate
+	Reference  string                 // Specification of the type, cited by explained validation
+
+	// Names may have underscored labels, ex. _dmarc or _sip._tcp (RFC 8552). Names of the other types are
+	// host names which can't contain underscores (RFC 1123 section 2.1).
+	UnderscoreNames bool
+}
+
+// Longest names allowed by DNS, used as maximal length of targets
+const MaxNameLength = 253
+
+// Longest TXT value which fits into one record, 255 strings of 255 characters and their length bytes
+// make 65280 bytes of record data. DNSAPI_MAX_TXT_LENGTH is usually much lower.
+const MaxTXTDataLength = 255 * 255
+
+// Length of strings TXT values are split into, one byte under the limit of a character string
+const txtStringLength = 254
+
+// Splits the TXT value into escaped character strings. Value is split before escaping so no escape
+// sequence is cut and no string is longer than the limit in the wire format.
+func splitTXT(value string) []string {
+	var parts []string
+
+	for current := 0; current < len(value); current += txtStringLength {
+		end := current + txtStringLength
+		if end > len(value) {
+			end = len(value)
+		}
+		parts = append(parts, strings.ReplaceAll(value[current:end], "\\", "\\\\"))
+	}
+	if len(parts) == 0 {
+		parts = append(parts, "")
+	}
+
+	return parts
+}
+
+// Joins TXT value given as quoted character strings, ex. "v=spf1 include:_spf.example.net" " -all" as
+// copied from dig or other providers. Values with anything except spaces between the strings are kept.
+func joinTXTStrings(value string) string {
+	if len(value) < 2 || !strings.HasPrefix(value, "\"") || !strings.HasSuffix(value, "\"") {
+		return value
+	}
+
+	parts := strings.Split(value, "\"")
+	if len(parts)%2 == 0 {
+		return value
+	}
+	for i := 0; i < len(parts); i += 2 {
+		if strings.TrimSpace(parts[i]) != "" {
+			return value
+		}
+	}
+	return unquoteParts(value)
+}
+
+// Longest target of URI records, URIs longer than 2000 characters aren't usable in common clients
+const MaxURILength = 2000
+
+var recordTypes = make(map[string]*RecordType)
+
+// RegisterRecordType adds support for a new record type or replaces the existing one
+func RegisterRecordType(name string, recordType *RecordType) {
+	recordTypes[strings.ToUpper(name)] = recordType
+}
+
+// GetRecordType returns handler of the record type, nil if the type is not supported
+func GetRecordType(name string) *RecordType {
+	return recordTypes[name]
+}
+
+// RecordTypeNames returns sorted names of all supported record types
+func RecordTypeNames() []string {
+	var names []string
+	for name := range recordTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// UnderscoreRecordTypes returns sorted names of record types allowing underscores in names
+func UnderscoreRecordTypes() []string {
+	var names []string
+	for _, name := range RecordTypeNames() {
+		if recordTypes[name].UnderscoreNames {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// Canonical text form of IP address, invalid addresses are left for validation
+func normalizeIP(r *Record, domain string) {
+	parsed := net.ParseIP(r.Value)
+	if parsed != nil {
+		r.Value = parsed.String()
+	}
+}
+
+// Target names are normalized the same way as names of records, empty target is left for validation
+func normalizeTarget(r *Record, domain string) {
+	if r.Value != "" {
+		r.Value = normalizeName(r.Value, domain)
+	}
+}
+
+// Value of the record is the target
+func valueTarget(r *Record) string {
+	return r.Value
+}
+
+// Host names are dot separated labels of letters, digits and hyphens, optionally fully qualified
+var hostnamePattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9\-]{0,61}[a-z0-9])?\.?$`)
+
+// Names of SRV records start with the service and the protocol, ex. _sip._tcp or _ldap._tcp.dc
+var srvNamePattern = regexp.MustCompile(`^_[a-z0-9]([a-z0-9\-]*[a-z0-9])?\._[a-z0-9]([a-z0-9\-]*[a-z0-9])?(\..+)?$`)
+
+// Fields of NAPTR value: order, preference, flags, service, regexp and replacement. Flags, service and regexp
+// are quoted strings in zone file format without quotes and control characters inside, false for another form.
+func naptrFields(value string) ([]string, bool) {
+	var fields []string
+
+	rest := strings.TrimSpace(value)
+	for i := 0; i < 6 && rest != ""; i++ {
+		quoted := i >= 2 && i <= 4
+		if quoted {
+			if rest[0] != '"' {
+				return nil, false
+			}
+			// Backslash escapes the next character, ex. \\1 in regexp
+			end := -1
+			for j := 1; j < len(rest); j++ {
+				if rest[j] == '\\' {
+					j++
+				} else if rest[j] == '"' {
+					end = j - 1
+					break
+				}
+			}
+			if end < 0 {
+				return nil, false
+			}
+			field := rest[1 : end+1]
+			if strings.IndexFunc(field, func(r rune) bool { return r < 0x20 || r == 0x7f || r == '"' }) >= 0 {
+				return nil, false
+			}
+			fields = append(fields, field)
+			rest = rest[end+2:]
+			if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+				return nil, false
+			}
+		} else {
+			parts, remaining := splitFields(rest, 1)
+			fields = append(fields, parts[0])
+			rest = remaining
+		}
+		rest = strings.TrimSpace(rest)
+	}
+
+	if len(fields) != 6 || rest != "" {
+		return nil, false
+	}
+	return fields, true
+}
+
+var naptrFlagsPattern = regexp.MustCompile(`^[A-Za-z0-9]*$`)
+
+// Services are protocols and resolution services separated by +, ex. E2U+sip or SIP+D2U (RFC 3403 section 4.1)
+var naptrServicePattern = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9\-]{0,31}(\+[A-Za-z0-9\-:]{1,32})*)?$`)
+
+// Domain names which aren't host names can have underscores, ex. _sip._udp.example.com
+var domainNamePattern = regexp.MustCompile(`^([a-z0-9_]([a-z0-9_\-]{0,61}[a-z0-9])?\.)*[a-z0-9_]([a-z0-9_\-]{0,61}[a-z0-9])?\.?$`)
+
+// Numbers of LOC records, seconds have at most 3 decimals and meters at most 2 (RFC 1876 section 3)
+var (
+	locSecondsPattern = regexp.MustCompile(`^[0-9]{1,2}(\.[0-9]{1,3})?$`)
+	locMetersPattern  = regexp.MustCompile(`^-?[0-9]+(\.[0-9]{1,2})?m?$`)
+)
+
+// Checks value of LOC record "d1 [m1 [s1]] N|S d2 [m2 [s2]] E|W alt[m] [siz[m] [hp[m] [vp[m]]]]" and returns
+// description of the first problem, empty if the value is valid
+func checkLOC(value string) string {
+	fields := strings.Fields(value)
+
+	// Coordinate is degrees, optional minutes and seconds and the hemisphere
+	coordinate := func(name string, maxDegrees int, hemispheres string) string {
+		if len(fields) == 0 {
+			return name + " is missing"
+		}
+		degrees, err := strconv.Atoi(fields[0])
+		if err != nil || degrees < 0 || degrees > maxDegrees {
+			return "degrees of " + name + " have to be number between 0 and " + strconv.Itoa(maxDegrees)
+		}
+		fields = fields[1:]
+		var minutes, seconds float64
+		if len(fields) > 0 && !strings.Contains(hemispheres, strings.ToUpper(fields[0])) {
+			number, err := strconv.Atoi(fields[0])
+			if err != nil || number < 0 || number > 59 {
+				return "minutes of " + name + " have to be number between 0 and 59"
+			}
+			minutes = float64(number)
+			fields = fields[1:]
+			if len(fields) > 0 && !strings.Contains(hemispheres, strings.ToUpper(fields[0])) {
+				if !locSecondsPattern.MatchString(fields[0]) {
+					return "seconds of " + name + " have to be number between 0 and 59.999"
+				}
+				seconds, _ = strconv.ParseFloat(fields[0], 64)
+				if seconds >= 60 {
+					return "seconds of " + name + " have to be number between 0 and 59.999"
+				}
+				fields = fields[1:]
+			}
+		}
+		if degrees == maxDegrees && (minutes > 0 || seconds > 0) {
+			return name + " can't be more than " + strconv.Itoa(maxDegrees) + " degrees"
+		}
+		if len(fields) == 0 || len(fields[0]) != 1 || !strings.Contains(hemispheres, strings.ToUpper(fields[0])) {
+			return name + " has to end with " + hemispheres[0:1] + " or " + hemispheres[1:2]
+		}
+		fields = fields[1:]
+		return ""
+	}
+
+	// Meters with optional m suffix
+	meters := func(name string, min float64, max float64) string {
+		message := name + " has to be number of meters between " + strconv.FormatFloat(min, 'f', 2, 64) +
+			" and " + strconv.FormatFloat(max, 'f', 2, 64)
+		if !locMetersPattern.MatchString(fields[0]) {
+			return message
+		}
+		number, _ := strconv.ParseFloat(strings.TrimSuffix(fields[0], "m"), 64)
+		if number < min || number > max {
+			return message
+		}
+		fields = fields[1:]
+		return ""
+	}
+
+	if problem := coordinate("latitude", 90, "NS"); problem != "" {
+		return problem
+	}
+	if problem := coordinate("longitude", 180, "EW"); problem != "" {
+		return problem
+	}
+	if len(fields) == 0 {
+		return "altitude is missing"
+	}
+	if problem := meters("altitude", -100000, 42849672.95); problem != "" {
+		return problem
+	}
+	for _, name := range []string{"size", "horizontal precision", "vertical precision"} {
+		if len(fields) == 0 {
+			break
+		}
+		if problem := meters(name, 0, 90000000); problem != "" {
+			return problem
+		}
+	}
+	if len(fields) > 0 {
+		return "value has unexpected " + strings.Join(fields, " ")
+	}
+
+	return ""
+}
+
+// JSON schema of record's body with given schema of the value
+func recordSchema(value map[string]interface{}, withPrio bool) map[string]interface{} {
+	properties := map[string]interface{}{
+		"name":  map[string]interface{}{"type": "string"},
+		"ttl":   map[string]interface{}{"type": "integer", "minimum": 60, "maximum": 2592000},
+		"value": value,
+	}
+	required := []string{"name", "value"}
+
+	if withPrio {
+		properties["prio"] = map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 100}
+		required = append(required, "prio")
+	}
+
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+func init() {
+	RegisterRecordType("A", &RecordType{
+		Validate: func(r *Record) error {
+			parsed := net.ParseIP(r.Value)
+
+			if parsed == nil || !strings.Contains(r.Value, ".") {
+				return errors.New(r.Type + " " + r.Name + ": IP address of A record is not valid")
+			}
+			return nil
+		},
+		Normalize: normalizeIP,
+		Schema:    recordSchema(map[string]interface{}{"type": "string", "format": "ipv4"}, false),
+		MaxLength: len("255.255.255.255"),
+		Reference: "RFC 1035 section 3.4.1",
+	})
+
+	RegisterRecordType("AAAA", &RecordType{
+		Validate: func(r *Record) error {
+			parsed := net.ParseIP(r.Value)
+
+			if parsed == nil || !strings.Contains(r.Value, ":") {
+				return errors.New(r.Type + " " + r.Name + ": IP address of AAAA record is not valid")
+			}
+			return nil
+		},
+		Normalize: normalizeIP,
+		Schema:    recordSchema(map[string]interface{}{"type": "string", "format": "ipv6"}, false),
+		MaxLength: len("ffff:ffff:ffff:ffff:ffff:ffff:255.255.255.255"),
+		Reference: "RFC 3596 section 2.2",
+	})
+
+	RegisterRecordType("CNAME", &RecordType{
+		Validate: func(r *Record) error {
+			if validateTarget(r.Value) != nil {
+				return errors.New(r.Type + " " + r.Name + ": CNAME has not a valid value")
+			}
+			return nil
+		},
+		Normalize:       normalizeTarget,
+		Target:          valueTarget,
+		Schema:          recordSchema(map[string]interface{}{"type": "string", "format": "hostname"}, false),
+		MaxLength:       MaxNameLength + 1,
+		Reference:       "RFC 1035 section 3.3.1",
+		UnderscoreNames: true,
+	})
+
+	RegisterRecordType("TXT", &RecordType{
+		Validate: func(r *Record) error {
+			if strings.Contains(r.Value, "\"") || strings.Contains(r.Value, "'") || strings.Contains(r.Value, "`") {
+				return errors.New(r.Type + " " + r.Name + ": characters \"' or ` are not allowed in TXT records")
+			}
+			if config.MaxTXTLength > 0 && len(r.Value) > config.MaxTXTLength {
+				return errors.New(r.Type + " " + r.Name + ": TXT value is longer than " + strconv.Itoa(config.MaxTXTLength) + " characters")
+			}
+			if isDMARCName(r.Name) {
+				if err := validateDMARC(r.Value); err != nil {
+					return errors.New(r.Type + " " + r.Name + ": " + err.Error())
+				}
+			}
+			return nil
+		},
+		Normalize: func(r *Record, domain string) {
+			r.Value = joinTXTStrings(r.Value)
+		},
+		// Large records have to be split into lines
+		RenderData: func(r *Record) string {
+			return "(\"" + strings.Join(splitTXT(r.Value), "\"\n        \"") + "\")"
+		},
+		Schema:          recordSchema(map[string]interface{}{"type": "string", "pattern": "^[^\"'`]*$"}, false),
+		MaxLength:       MaxTXTDataLength,
+		Reference:       "RFC 1035 section 3.3.14",
+		UnderscoreNames: true,
+	})
+
+	// Value is "priority weight port target", "weight port target" is completed by priority from Prio
+	RegisterRecordType("SRV", &RecordType{
+		Validate: func(r *Record) error {
+			if !srvNamePattern.MatchString(r.Name) {
+				return errors.New(r.Type + " " + r.Name + ": name of SRV record has to start with _service._proto, ex. _sip._tcp")
+			}
+			fields := strings.Fields(r.Value)
+			if len(fields) != 4 {
+				return errors.New(r.Type + " " + r.Name + ": value of SRV record has to be priority, weight, port and target")
+			}
+			for i, field := range []string{"priority", "weight", "port"} {
+				number, err := strconv.Atoi(fields[i])
+				if err != nil || number < 0 || number > 65535 {
+					return errors.New(r.Type + " " + r.Name + ": " + field + " of SRV record has to be number between 0 and 65535")
+				}
+			}
+			target := fields[3]
+			if target != "." && (net.ParseIP(strings.TrimSuffix(target, ".")) != nil || target == "@" || !hostnamePattern.MatchString(target)) {
+				return errors.New(r.Type + " " + r.Name + ": target of SRV record has to be a host name or . for no service")
+			}
+			return nil
+		},
+		Normalize: func(r *Record, domain string) {
+			fields := strings.Fields(r.Value)
+			if len(fields) == 3 {
+				fields = append([]string{strconv.Itoa(r.Prio)}, fields...)
+			}
+			if len(fields) != 4 {
+				return
+			}
+			if fields[3] != "." {
+				fields[3] = normalizeName(fields[3], domain)
+			}
+			if priority, err := strconv.Atoi(fields[0]); err == nil {
+				r.Prio = priority
+			}
+			r.Value = strings.Join(fields, " ")
+		},
+		// Target is the last part of the value
+		Target: func(r *Record) string {
+			fields := strings.Fields(r.Value)
+			if len(fields) == 0 {
+				return ""
+			}
+			return fields[len(fields)-1]
+		},
+		Schema: recordSchema(map[string]interface{}{
+			"type":    "string",
+			"pattern": `^([0-9]+ )?[0-9]+ [0-9]+ [^ ]+$`,
+		}, false),
+		MaxLength:       len("65535 65535 65535 ") + MaxNameLength + 1,
+		Reference:       "RFC 2782",
+		UnderscoreNames: true,
+	})
+
+	// Value is "priority weight "target"", "weight "target"" is completed by priority from Prio
+	RegisterRecordType("URI", &RecordType{
+		Validate: func(r *Record) error {
+			if !srvNamePattern.MatchString(r.Name) {
+				return errors.New(r.Type + " " + r.Name + ": name of URI record has to start with _service._proto, ex. _http._tcp")
+			}
+			fields := strings.Fields(r.Value)
+			if len(fields) != 3 {
+				return errors.New(r.Type + " " + r.Name + ": value of URI record has to be priority, weight and target")
+			}
+			for i, field := range []string{"priority", "weight"} {
+				number, err := strconv.Atoi(fields[i])
+				if err != nil || number < 0 || number > 65535 {
+					return errors.New(r.Type + " " + r.Name + ": " + field + " of URI record has to be number between 0 and 65535")
+				}
+			}
+			target := fields[2]
+			if len(target) < 3 || target[0] != '"' || target[len(target)-1] != '"' {
+				return errors.New(r.Type + " " + r.Name + ": target of URI record has to be in quotes")
+			}
+			target = target[1 : len(target)-1]
+			parsed, err := url.Parse(target)
+			if err != nil || parsed.Scheme == "" || strings.ContainsAny(target, "\"\\") ||
+				strings.IndexFunc(target, func(r rune) bool { return r < 0x20 || r == 0x7f }) >= 0 {
+				return errors.New(r.Type + " " + r.Name + ": target of URI record has to be an absolute URI, ex. https://www.example.com/")
+			}
+			return nil
+		},
+		Normalize: func(r *Record, domain string) {
+			fields := strings.Fields(r.Value)
+			if len(fields) == 2 {
+				fields = append([]string{strconv.Itoa(r.Prio)}, fields...)
+			}
+			if len(fields) != 3 {
+				return
+			}
+			if !strings.HasPrefix(fields[2], "\"") && !strings.HasSuffix(fields[2], "\"") {
+				fields[2] = "\"" + fields[2] + "\""
+			}
+			if priority, err := strconv.Atoi(fields[0]); err == nil {
+				r.Prio = priority
+			}
+			r.Value = strings.Join(fields, " ")
+		},
+		Schema: recordSchema(map[string]interface{}{
+			"type":    "string",
+			"pattern": `^([0-9]+ )?[0-9]+ "?[^ "]+"?$`,
+		}, false),
+		MaxLength:       len("65535 65535 \"\"") + MaxURILength,
+		Reference:       "RFC 7553",
+		UnderscoreNames: true,
+	})
+
+	RegisterRecordType("MX", &RecordType{
+		Validate: func(r *Record) error {
+			if r.Prio <= 0 || r.Prio > 65535 {
+				return errors.New(r.Type + " " + r.Name + ": Prio has to be number between 1 and 65535")
+			}
+			// Addresses of the target are checked by lint, they can be in another zone
+			if r.Value != "@" && (net.ParseIP(strings.TrimSuffix(r.Value, ".")) != nil || !hostnamePattern.MatchString(r.Value)) {
+				return errors.New(r.Type + " " + r.Name + ": value of MX record has to be a host name, not an IP address")
+			}
+			return nil
+		},
+		Normalize: normalizeTarget,
+		Target:    valueTarget,
+		RenderData: func(r *Record) string {
+			return strconv.Itoa(r.Prio) + "    " + r.Value
+		},
+		Schema:    recordSchema(map[string]interface{}{"type": "string", "format": "hostname"}, true),
+		MaxLength: MaxNameLength + 1,
+		Reference: "RFC 1035 section 3.3.9",
+	})
+
+	// Value is order, preference, flags, service, regexp and replacement, ex. 100 10 "S" "SIP+D2U" "" _sip._udp
+	RegisterRecordType("NAPTR", &RecordType{
+		Validate: func(r *Record) error {
+			fields, ok := naptrFields(r.Value)
+			if !ok {
+				return errors.New(r.Type + " " + r.Name + ": value of NAPTR record has to be order, preference, quoted flags, service and regexp and replacement")
+			}
+			for i, field := range []string{"order", "preference"} {
+				number, err := strconv.Atoi(fields[i])
+				if err != nil || number < 0 || number > 65535 {
+					return errors.New(r.Type + " " + r.Name + ": " + field + " of NAPTR record has to be number between 0 and 65535")
+				}
+			}
+			if !naptrFlagsPattern.MatchString(fields[2]) {
+				return errors.New(r.Type + " " + r.Name + ": flags of NAPTR record have to be letters or digits, ex. S, A, U or P")
+			}
+			if !naptrServicePattern.MatchString(fields[3]) {
+				return errors.New(r.Type + " " + r.Name + ": service of NAPTR record is not valid, ex. E2U+sip or SIP+D2U")
+			}
+			if fields[4] != "" {
+				// Delimiter, the pattern, delimiter, the replacement, delimiter and optional i flag
+				delimiter := fields[4][:1]
+				parts := strings.Split(fields[4], delimiter)
+				if len(parts) != 4 || parts[1] == "" || (parts[3] != "" && parts[3] != "i") || strings.ContainsAny(delimiter, "0123456789i") {
+					return errors.New(r.Type + " " + r.Name + ": regexp of NAPTR record has to be in form !pattern!replacement!")
+				}
+				if fields[5] != "." {
+					return errors.New(r.Type + " " + r.Name + ": NAPTR record can have either regexp or replacement, the other one has to be empty or .")
+				}
+			}
+			if fields[5] != "." && (net.ParseIP(strings.TrimSuffix(fields[5], ".")) != nil || (fields[5] != "@" && !domainNamePattern.MatchString(fields[5]))) {
+				return errors.New(r.Type + " " + r.Name + ": replacement of NAPTR record has to be a domain name or .")
+			}
+			return nil
+		},
+		// Canonical quoting, relative replacement inside the zone
+		Normalize: func(r *Record, domain string) {
+			fields, ok := naptrFields(r.Value)
+			if !ok {
+				return
+			}
+			replacement := fields[5]
+			if replacement != "." {
+				replacement = normalizeName(replacement, domain)
+			}
+			r.Value = fields[0] + " " + fields[1] + " \"" + strings.ToUpper(fields[2]) + "\" \"" + fields[3] + "\" \"" +
+				fields[4] + "\" " + replacement
+		},
+		Target: func(r *Record) string {
+			fields, ok := naptrFields(r.Value)
+			if !ok || fields[5] == "." {
+				return ""
+			}
+			return fields[5]
+		},
+		Schema:    recordSchema(map[string]interface{}{"type": "string", "pattern": `^[0-9]+ [0-9]+ "[^"]*" "[^"]*" "[^"]*" [^ ]+$`}, false),
+		MaxLength: len("65535 65535 ") + 3*(255+3) + MaxNameLength + 1,
+		Reference: "RFC 3403 section 4.1",
+	})
+
+	// Delegations of subzones, NS records of the apex are rendered from DNSAPI_NAME_SERVERS
+	RegisterRecordType("NS", &RecordType{
+		Validate: func(r *Record) error {
+			if r.Name == "@" {
+				return errors.New(r.Type + " " + r.Name + ": NS records of the apex are managed by the API, only subzones can be delegated")
+			}
+			if net.ParseIP(r.Value) != nil || r.Value == "@" || !hostnamePattern.MatchString(r.Value) {
+				return errors.New(r.Type + " " + r.Name + ": value of NS record has to be a host name of the name server")
+			}
+			return nil
+		},
+		Normalize:       normalizeTarget,
+		Target:          valueTarget,
+		Schema:          recordSchema(map[string]interface{}{"type": "string", "format": "hostname"}, false),
+		MaxLength:       MaxNameLength + 1,
+		Reference:       "RFC 1035 section 3.3.11",
+		UnderscoreNames: true,
+	})
+
+	// Geographical location, ex. 50 5 18.000 N 14 25 16.000 E 250m 10m
+	RegisterRecordType("LOC", &RecordType{
+		Validate: func(r *Record) error {
+			if problem := checkLOC(r.Value); problem != "" {
+				return errors.New(r.Type + " " + r.Name + ": " + problem)
+			}
+			return nil
+		},
+		// Hemispheres are uppercase and altitude and sizes always have the m suffix
+		Normalize: func(r *Record, domain string) {
+			fields := strings.Fields(r.Value)
+			hemispheres := 0
+			for i, field := range fields {
+				switch strings.ToUpper(field) {
+				case "N", "S", "E", "W":
+					fields[i] = strings.ToUpper(field)
+					hemispheres++
+					continue
+				}
+				if hemispheres == 2 && locMetersPattern.MatchString(field) && !strings.HasSuffix(field, "m") {
+					fields[i] = field + "m"
+				}
+			}
+			r.Value = strings.Join(fields, " ")
+		},
+		Schema: recordSchema(map[string]interface{}{
+			"type":    "string",
+			"pattern": `^[0-9]+( [0-9]+( [0-9.]+)?)? [NSns] [0-9]+( [0-9]+( [0-9.]+)?)? [EWew] -?[0-9.]+m?( [0-9.]+m?){0,3}$`,
+		}, false),
+		MaxLength: len("90 59 59.999 N 180 59 59.999 E -100000.00m 90000000.00m 90000000.00m 90000000.00m"),
+		Reference: "RFC 1876",
+	})
+
+	// Pseudo-record resolved by commits into A and AAAA records, ex. for the apex pointing at a CDN. ANAME is
+	// the same type.
+	RegisterRecordType("ALIAS", &RecordType{
+		Validate: func(r *Record) error {
+			if net.ParseIP(strings.TrimSuffix(r.Value, ".")) != nil || r.Value == "@" || !hostnamePattern.MatchString(r.Value) {
+				return errors.New(r.Type + " " + r.Name + ": value of ALIAS record has to be a host name")
+			}
+			return nil
+		},
+		Normalize: normalizeTarget,
+		Target:    valueTarget,
+		Schema:    recordSchema(map[string]interface{}{"type": "string", "format": "hostname"}, false),
+		MaxLength: MaxNameLength + 1,
+		Reference: "draft-ietf-dnsop-aname",
+	})
+
+	// Reverse DNS, the name can be given as IP address of the reverse zone
+	RegisterRecordType("PTR", &RecordType{
+		Validate: func(r *Record) error {
+			if net.ParseIP(r.Name) != nil {
+				return errors.New(r.Type + " " + r.Name + ": the address doesn't belong to the reverse zone")
+			}
+			if net.ParseIP(strings.TrimSuffix(r.Value, ".")) != nil || !strings.HasSuffix(r.Value, ".") || !hostnamePattern.MatchString(r.Value) {
+				return errors.New(r.Type + " " + r.Name + ": value of PTR record has to be a fully qualified host name ending with a dot")
+			}
+			return nil
+		},
+		Normalize: func(r *Record, domain string) {
+			if name, ok := reverseName(r.Name, domain); ok {
+				r.Name = name
+			}
+			r.Value = strings.ToLower(r.Value)
+		},
+		Target:    valueTarget,
+		Schema:    recordSchema(map[string]interface{}{"type": "string", "format": "hostname"}, false),
+		MaxLength: MaxNameLength + 1,
+		Reference: "RFC 1035 section 3.3.12",
+	})
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegisterRecordType(t *testing.T) {
+	RegisterRecordType("test", &RecordType{
+		Validate: func(r *Record) error {
+			if r.Value != "ok" {
+				return errors.New("value has to be ok")
+			}
+			return nil
+		},
+		RenderData: func(r *Record) string {
+			return "<" + r.Value + ">"
+		},
+	})
+	defer delete(recordTypes, "TEST")
+
+	record := Record{Name: "www", TTL: 300, Type: "TEST", Value: "ok"}
+	if err := record.Validate(); err != nil {
+		t.Error(err)
+	}
+	if rendered := record.Render(); rendered != "www    300s    TEST      <ok>" {
+		t.Error("Unexpected rendered record", rendered)
+	}
+
+	record.Value = "nok"
+	if err := record.Validate(); err == nil {
+		t.Error("Invalid value of custom type passed")
+	}
+
+	record.Type = "UNKNOWN"
+	if err := record.Validate(); err == nil || err.Error() != "Unknown record type" {
+		t.Error("Unknown type passed", err)
+	}
+}
+
+func TestRecordTypeNames(t *testing.T) {
+	for _, name := range RecordTypeNames() {
+		if GetRecordType(name).Schema == nil {
+			t.Error("Record type without schema", name)
+		}
+	}
+}
+
+func TestRecord_Normalize(t *testing.T) {
+	cases := []struct {
+		record   Record
+		expected Record
+	}{
+		{Record{Name: " WWW ", Type: "a", Value: " 1.2.3.4 "}, Record{Name: "www", Type: "A", Value: "1.2.3.4"}},
+		{Record{Name: "Example.com.", Type: "AAAA", Value: "2001:0DB8:0:0:0:0:0:1"}, Record{Name: "@", Type: "AAAA", Value: "2001:db8::1"}},
+		{Record{Name: "", Type: "AAAA", Value: "0:0:0:0:0:0:0:1"}, Record{Name: "@", Type: "AAAA", Value: "::1"}},
+		{Record{Name: "mail.example.com.", Type: "CNAME", Value: "Example.COM."}, Record{Name: "mail", Type: "CNAME", Value: "@"}},
+		{Record{Name: "@", Type: "MX", Value: "mx.example.com."}, Record{Name: "@", Type: "MX", Value: "mx"}},
+		{Record{Name: "@", Type: "MX", Value: "mail.rosti.cz."}, Record{Name: "@", Type: "MX", Value: "mail.rosti.cz."}},
+		{Record{Name: "www", Type: "CNAME", Value: ""}, Record{Name: "www", Type: "CNAME", Value: ""}},
+		{Record{Name: "@", Type: "TXT", Value: " Case Sensitive "}, Record{Name: "@", Type: "TXT", Value: "Case Sensitive"}},
+	}
+
+	for _, c := range cases {
+		record := c.record
+		record.Normalize("example.com")
+		if record.Name != c.expected.Name || record.Type != c.expected.Type || record.Value != c.expected.Value {
+			t.Error("Unexpected normalized record", c.record, record)
+		}
+	}
+}
+
+func TestRecord_ValidateLength(t *testing.T) {
+	config.MaxTXTLength = 1000
+	defer func() { config.MaxTXTLength = 0 }()
+
+	cases := []struct {
+		record Record
+		valid  bool
+	}{
+		{Record{Name: "@", TTL: 300, Type: "TXT", Value: strings.Repeat("a", 1000)}, true},
+		{Record{Name: "@", TTL: 300, Type: "TXT", Value: strings.Repeat("a", 1001)}, false},
+		{Record{Name: "www", TTL: 300, Type: "CNAME", Value: strings.Repeat("a.", 127) + "cz."}, false},
+		{Record{Name: "www", TTL: 300, Type: "A", Value: strings.Repeat("1", 100)}, false},
+	}
+
+	for _, c := range cases {
+		err := c.record.Validate()
+		if c.valid && err != nil {
+			t.Error("Valid record failed", err)
+		}
+		if !c.valid && err == nil {
+			t.Error("Too long record passed", len(c.record.Value), c.record.Type)
+		}
+	}
+
+	config.MaxTXTLength = 0
+	record := Record{Name: "@", TTL: 300, Type: "TXT", Value: strings.Repeat("a", MaxTXTDataLength+1)}
+	if record.Validate() == nil {
+		t.Error("TXT value longer than record data passed without configured limit")
+	}
+}
+
+func TestNSRecord(t *testing.T) {
+	cases := []struct {
+		record Record
+		valid  bool
+	}{
+		{Record{Name: "dev", TTL: 300, Type: "NS", Value: "ns1.example.net."}, true},
+		{Record{Name: "dev", TTL: 300, Type: "NS", Value: "ns1.dev"}, true},
+		{Record{Name: "@", TTL: 300, Type: "NS", Value: "ns1.example.net."}, false},
+		{Record{Name: "dev", TTL: 300, Type: "NS", Value: "192.0.2.1"}, false},
+		{Record{Name: "dev", TTL: 300, Type: "NS", Value: "ns_1..example.net."}, false},
+	}
+
+	for _, c := range cases {
+		err := c.record.Validate()
+		if c.valid && err != nil {
+			t.Error("Valid NS record failed", err)
+		}
+		if !c.valid && err == nil {
+			t.Error("Invalid NS record passed", c.record)
+		}
+	}
+
+	// Delegation is rendered after NS records of the apex and imported back
+	zone := Zone{Domain: "ay-" + TEST_DOMAIN, Serial: "2020010101"}
+	zone.Records = []Record{{Name: "dev", TTL: 300, Type: "NS", Value: "ns1.example.net."}}
+	rendered := zone.Render()
+	if !strings.Contains(rendered, "@    IN    NS    ns2.rosti.cz.\ndev    300s    NS      ns1.example.net.\n") {
+		t.Error("Unexpected rendered delegation", rendered)
+	}
+	records, err := ParseZoneFile(rendered, zone.Domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Name != "dev" || records[0].Value != "ns1.example.net." {
+		t.Error("Delegation wasn't parsed", records)
+	}
+}
+
+func TestTXTRecord_render(t *testing.T) {
+	value := strings.Repeat("a", 253) + "\\" + strings.Repeat("b", 300)
+	record := Record{Name: "@", TTL: 300, Type: "TXT", Value: value}
+
+	// Strings are split before escaping, the backslash is the last character of the first one
+	expected := "(\"" + strings.Repeat("a", 253) + "\\\\\"\n        \"" + strings.Repeat("b", 254) + "\"\n        \"" + strings.Repeat("b", 46) + "\")"
+	if data := record.RenderData(); data != expected {
+		t.Error("Unexpected rendered TXT record", data)
+	}
+
+	zone := Zone{Domain: "bj-" + TEST_DOMAIN, Serial: "2020010101", Records: []Record{record}}
+	records, err := ParseZoneFile(zone.Render(), zone.Domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Value != value {
+		t.Error("TXT record wasn't parsed back", records)
+	}
+}
+
+func TestPTRRecord(t *testing.T) {
+	domain := "2.0.192.in-addr.arpa"
+	cases := []struct {
+		record Record
+		valid  bool
+	}{
+		{Record{Name: "1", TTL: 300, Type: "PTR", Value: "www.example.com."}, true},
+		{Record{Name: "192.0.2.5", TTL: 300, Type: "PTR", Value: "Mail.Example.com."}, true},
+		{Record{Name: "1", TTL: 300, Type: "PTR", Value: "www.example.com"}, false},
+		{Record{Name: "1", TTL: 300, Type: "PTR", Value: "192.0.2.1."}, false},
+		{Record{Name: "198.51.100.1", TTL: 300, Type: "PTR", Value: "www.example.com."}, false},
+	}
+
+	for _, c := range cases {
+		c.record.Normalize(domain)
+		err := c.record.Validate()
+		if c.valid && err != nil {
+			t.Error("Valid PTR record failed", err)
+		}
+		if !c.valid && err == nil {
+			t.Error("Invalid PTR record passed", c.record)
+		}
+	}
+
+	record := Record{Name: "192.0.2.5", TTL: 300, Type: "PTR", Value: "Mail.Example.com."}
+	record.Normalize(domain)
+	if record.Name != "5" || record.Value != "mail.example.com." {
+		t.Error("Address wasn't converted to the name of PTR record", record)
+	}
+
+	record = Record{Name: "2001:db8::1", TTL: 300, Type: "PTR", Value: "www.example.com."}
+	record.Normalize("8.b.d.0.1.0.0.2.ip6.arpa")
+	if record.Name != "1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0" {
+		t.Error("IPv6 address wasn't converted to the name of PTR record", record.Name)
+	}
+}
+
+func TestValidateReverseZone(t *testing.T) {
+	cases := []struct {
+		domain string
+		valid  bool
+	}{
+		{"2.0.192.in-addr.arpa", true},
+		{"10.in-addr.arpa", true},
+		{"0-127.2.0.192.in-addr.arpa", true},
+		{"0/25.2.0.192.in-addr.arpa", false},
+		{"8.b.d.0.1.0.0.2.ip6.arpa.", true},
+		{"256.0.192.in-addr.arpa", false},
+		{"01.0.192.in-addr.arpa", false},
+		{"127-0.2.0.192.in-addr.arpa", false},
+		{"1.0-127.2.0.192.in-addr.arpa", false},
+		{"db8.0.1.0.0.2.ip6.arpa", false},
+	}
+
+	for _, c := range cases {
+		err := validateReverseZone(c.domain)
+		if c.valid && err != nil {
+			t.Error("Valid reverse zone failed", err)
+		}
+		if !c.valid && err == nil {
+			t.Error("Invalid reverse zone passed", c.domain)
+		}
+	}
+	if !isReverseZone("2.0.192.IN-ADDR.ARPA.") || isReverseZone("in-addr.arpa.example.com") {
+		t.Error("Reverse zones aren't recognized")
+	}
+}
+
+func TestSRVRecord(t *testing.T) {
+	cases := []struct {
+		record Record
+		valid  bool
+	}{
+		{Record{Name: "_sip._tcp", TTL: 300, Type: "SRV", Value: "10 5 5060 sip.example.com."}, true},
+		{Record{Name: "_ldap._tcp.dc", TTL: 300, Type: "SRV", Value: "0 0 389 ."}, true},
+		{Record{Name: "_sip._tcp", TTL: 300, Type: "SRV", Prio: 20, Value: "5 5060 sip"}, true},
+		{Record{Name: "sip", TTL: 300, Type: "SRV", Value: "10 5 5060 sip.example.com."}, false},
+		{Record{Name: "_sip", TTL: 300, Type: "SRV", Value: "10 5 5060 sip.example.com."}, false},
+		{Record{Name: "_sip._tcp", TTL: 300, Type: "SRV", Value: "10 5 70000 sip.example.com."}, false},
+		{Record{Name: "_sip._tcp", TTL: 300, Type: "SRV", Value: "5060 sip.example.com."}, false},
+		{Record{Name: "_sip._tcp", TTL: 300, Type: "SRV", Value: "10 5 5060 192.0.2.1"}, false},
+		{Record{Name: "_sip._tcp", TTL: 300, Type: "SRV", Value: "garbage"}, false},
+	}
+
+	for _, c := range cases {
+		c.record.Normalize("example.com")
+		err := c.record.Validate()
+		if c.valid && err != nil {
+			t.Error("Valid SRV record failed", err)
+		}
+		if !c.valid && err == nil {
+			t.Error("Invalid SRV record passed", c.record)
+		}
+	}
+
+	// Priority from Prio completes the value, targets inside the zone are relative
+	record := Record{Name: "_sip._tcp", TTL: 300, Type: "SRV", Prio: 20, Value: "5  5060 SIP.example.com."}
+	record.Normalize("example.com")
+	if record.Value != "20 5 5060 sip" || record.Prio != 20 {
+		t.Error("SRV record wasn't normalized", record)
+	}
+	if record.Render() != "_sip._tcp    300s    SRV      20 5 5060 sip" {
+		t.Error("Unexpected rendered SRV record", record.Render())
+	}
+}
+
+func TestURIRecord(t *testing.T) {
+	cases := []struct {
+		record Record
+		valid  bool
+	}{
+		{Record{Name: "_http._tcp", TTL: 300, Type: "URI", Value: `10 1 "https://www.example.com/"`}, true},
+		{Record{Name: "_ftp._tcp.files", TTL: 300, Type: "URI", Value: "1 0 ftp://ftp.example.com/public"}, true},
+		{Record{Name: "_http._tcp", TTL: 300, Type: "URI", Prio: 20, Value: `5 "https://www.example.com/"`}, true},
+		{Record{Name: "www", TTL: 300, Type: "URI", Value: `10 1 "https://www.example.com/"`}, false},
+		{Record{Name: "_http._tcp", TTL: 300, Type: "URI", Value: `10 70000 "https://www.example.com/"`}, false},
+		{Record{Name: "_http._tcp", TTL: 300, Type: "URI", Value: `10 1 "www.example.com"`}, false},
+		{Record{Name: "_http._tcp", TTL: 300, Type: "URI", Value: `10 1 ""`}, false},
+		{Record{Name: "_http._tcp", TTL: 300, Type: "URI", Value: `"https://www.example.com/"`}, false},
+	}
+
+	for _, c := range cases {
+		c.record.Normalize("example.com")
+		err := c.record.Validate()
+		if c.valid && err != nil {
+			t.Error("Valid URI record failed", err)
+		}
+		if !c.valid && err == nil {
+			t.Error("Invalid URI record passed", c.record)
+		}
+	}
+
+	// Priority from Prio completes the value, the target gets quotes
+	record := Record{Name: "_http._tcp", TTL: 300, Type: "URI", Prio: 20, Value: "5  https://www.example.com/"}
+	record.Normalize("example.com")
+	if record.Value != `20 5 "https://www.example.com/"` || record.Prio != 20 {
+		t.Error("URI record wasn't normalized", record)
+	}
+	if record.Render() != `_http._tcp    300s    URI      20 5 "https://www.example.com/"` {
+		t.Error("Unexpected rendered URI record", record.Render())
+	}
+}
+
+func TestLOCRecord(t *testing.T) {
+	cases := []struct {
+		record Record
+		valid  bool
+	}{
+		{Record{Name: "pop-prague", TTL: 300, Type: "LOC", Value: "50 5 18.000 N 14 25 16.000 E 250m 10m"}, true},
+		{Record{Name: "pop-ams", TTL: 300, Type: "LOC", Value: "52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m"}, true},
+		{Record{Name: "@", TTL: 300, Type: "LOC", Value: "42 21 s 71 6 w 24"}, true},
+		{Record{Name: "@", TTL: 300, Type: "LOC", Value: "90 N 180 E 0m"}, true},
+		{Record{Name: "@", TTL: 300, Type: "LOC", Value: "91 0 0 N 14 25 16 E 250m"}, false},
+		{Record{Name: "@", TTL: 300, Type: "LOC", Value: "90 1 N 14 25 16 E 250m"}, false},
+		{Record{Name: "@", TTL: 300, Type: "LOC", Value: "50 60 18 N 14 25 16 E 250m"}, false},
+		{Record{Name: "@", TTL: 300, Type: "LOC", Value: "50 5 18.0001 N 14 25 16 E 250m"}, false},
+		{Record{Name: "@", TTL: 300, Type: "LOC", Value: "50 5 18 X 14 25 16 E 250m"}, false},
+		{Record{Name: "@", TTL: 300, Type: "LOC", Value: "50 5 18 N 14 25 16 E"}, false},
+		{Record{Name: "@", TTL: 300, Type: "LOC", Value: "50 5 18 N 14 25 16 E -200000m"}, false},
+		{Record{Name: "@", TTL: 300, Type: "LOC", Value: "50 5 18 N 14 25 16 E 250m 1m 1m 1m 1m"}, false},
+	}
+
+	for _, c := range cases {
+		c.record.Normalize("example.com")
+		err := c.record.Validate()
+		if c.valid && err != nil {
+			t.Error("Valid LOC record failed", err)
+		}
+		if !c.valid && err == nil {
+			t.Error("Invalid LOC record passed", c.record)
+		}
+	}
+
+	record := Record{Name: "@", TTL: 300, Type: "LOC", Value: "42  21 54 n 71 6 18 w -24 30"}
+	record.Normalize("example.com")
+	if record.Value != "42 21 54 N 71 6 18 W -24m 30m" {
+		t.Error("LOC record wasn't normalized", record)
+	}
+}
+
+func TestNAPTRRecord(t *testing.T) {
+	cases := []struct {
+		record Record
+		valid  bool
+	}{
+		{Record{Name: "@", TTL: 300, Type: "NAPTR", Value: `100 10 "S" "SIP+D2U" "" _sip._udp.example.com.`}, true},
+		{Record{Name: "4.3.2.1", TTL: 300, Type: "NAPTR", Value: `100 10 "u" "E2U+sip" "!^.*$!sip:info@example.com!" .`}, true},
+		{Record{Name: "4.3.2.1", TTL: 300, Type: "NAPTR", Value: `100 10 "u" "E2U+sip" "!^\\+(.*)$!sip:\\1@example.com!i" .`}, true},
+		{Record{Name: "@", TTL: 300, Type: "NAPTR", Value: `100 10 "S" "SIP+D2U" "!^.*$!sip:info@example.com!" _sip._udp`}, false},
+		{Record{Name: "@", TTL: 300, Type: "NAPTR", Value: `70000 10 "S" "SIP+D2U" "" _sip._udp`}, false},
+		{Record{Name: "@", TTL: 300, Type: "NAPTR", Value: `100 10 S SIP+D2U "" _sip._udp`}, false},
+		{Record{Name: "@", TTL: 300, Type: "NAPTR", Value: `100 10 "S" "SIP D2U" "" _sip._udp`}, false},
+		{Record{Name: "@", TTL: 300, Type: "NAPTR", Value: `100 10 "S!" "SIP+D2U" "" _sip._udp`}, false},
+		{Record{Name: "@", TTL: 300, Type: "NAPTR", Value: `100 10 "u" "E2U+sip" "!^.*$" .`}, false},
+		{Record{Name: "@", TTL: 300, Type: "NAPTR", Value: `100 10 "S" "SIP+D2U" ""`}, false},
+	}
+
+	for _, c := range cases {
+		c.record.Normalize("example.com")
+		err := c.record.Validate()
+		if c.valid && err != nil {
+			t.Error("Valid NAPTR record failed", err)
+		}
+		if !c.valid && err == nil {
+			t.Error("Invalid NAPTR record passed", c.record)
+		}
+	}
+
+	// Rendered and parsed back in canonical form
+	zone := Zone{Domain: "example.com", Serial: "2020010101"}
+	zone.Records = []Record{{Name: "@", TTL: 300, Type: "NAPTR", Value: `100  10 "s" "SIP+D2U"  "" _sip._udp.example.com.`}}
+	zone.Records[0].Normalize(zone.Domain)
+	if zone.Records[0].Value != `100 10 "S" "SIP+D2U" "" _sip._udp` {
+		t.Error("NAPTR record wasn't normalized", zone.Records[0].Value)
+	}
+	records, err := ParseZoneFile(zone.Render(), zone.Domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Value != zone.Records[0].Value {
+		t.Error("NAPTR record wasn't parsed", records)
+	}
+}
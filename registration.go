@@ -0,0 +1,269 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Timeout of one RDAP request, the bootstrap file included
+const RDAPTimeout = 10 * time.Second
+
+// States of registrations of zones' domains
+const (
+	RegistrationStateExpiring = "expiring" // Expires within DNSAPI_EXPIRY_WARNING_DAYS
+	RegistrationStateExpired  = "expired"
+)
+
+var ErrNoRDAPServer = errors.New("top level domain has no RDAP server")
+var ErrNotRegistered = errors.New("domain is not registered")
+
+// Registration is the registered domain of a zone found by RDAP, the zone can be its subdomain
+type Registration struct {
+	Domain    string
+	Registrar string
+	ExpiresAt *time.Time
+}
+
+// Bootstrap file of RDAP servers, RFC 9224
+type rdapBootstrap struct {
+	Services [][][]string `json:"services"`
+}
+
+// Parts of RDAP domain response used here, RFC 9083
+type rdapDomain struct {
+	Events []struct {
+		Action string `json:"eventAction"`
+		Date   string `json:"eventDate"`
+	} `json:"events"`
+	Entities []rdapEntity `json:"entities"`
+}
+
+type rdapEntity struct {
+	Roles      []string        `json:"roles"`
+	VCardArray json.RawMessage `json:"vcardArray"`
+	Entities   []rdapEntity    `json:"entities"`
+}
+
+// Name of the entity from its jCard, ex. ["vcard", [["fn", {}, "text", "Registrar Inc."]]]
+func (e *rdapEntity) name() string {
+	var vcard []json.RawMessage
+	var properties [][]interface{}
+
+	if json.Unmarshal(e.VCardArray, &vcard) != nil || len(vcard) != 2 || json.Unmarshal(vcard[1], &properties) != nil {
+		return ""
+	}
+	for _, property := range properties {
+		if len(property) == 4 && property[0] == "fn" {
+			if name, ok := property[3].(string); ok {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// Finds the registrar entity, registries nest it under other entities sometimes
+func findRegistrar(entities []rdapEntity) string {
+	for _, entity := range entities {
+		for _, role := range entity.Roles {
+			if role == "registrar" {
+				return entity.name()
+			}
+		}
+		if name := findRegistrar(entity.Entities); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func rdapGet(url string, v interface{}) (int, error) {
+	client := http.Client{Timeout: RDAPTimeout}
+
+	request, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Accept", "application/rdap+json")
+
+	resp, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, errors.New("unexpected status code " + strconv.Itoa(resp.StatusCode) + " of " + url)
+	}
+	return resp.StatusCode, json.NewDecoder(resp.Body).Decode(v)
+}
+
+// LoadRDAPServers returns RDAP servers of top level domains from DNSAPI_RDAP_BOOTSTRAP_URL
+func LoadRDAPServers() (map[string][]string, error) {
+	var bootstrap rdapBootstrap
+
+	_, err := rdapGet(config.RDAPBootstrapURL, &bootstrap)
+	if err != nil {
+		return nil, errors.Wrap(err, "RDAP bootstrap")
+	}
+
+	servers := make(map[string][]string)
+	for _, service := range bootstrap.Services {
+		if len(service) != 2 {
+			continue
+		}
+		for _, tld := range service[0] {
+			servers[strings.ToLower(tld)] = service[1]
+		}
+	}
+	return servers, nil
+}
+
+// LookupRegistration finds registration of the domain. Zones can be subdomains of the registered domain,
+// parents are looked up until the registry knows one of them.
+func LookupRegistration(domain string, servers map[string][]string) (*Registration, error) {
+	labels := strings.Split(strings.ToLower(strings.TrimSuffix(domain, ".")), ".")
+	if len(labels) < 2 {
+		return nil, ErrNotRegistered
+	}
+	urls := servers[labels[len(labels)-1]]
+	if len(urls) == 0 {
+		return nil, ErrNoRDAPServer
+	}
+	base := urls[0]
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+
+	for i := 0; i < len(labels)-1; i++ {
+		var response rdapDomain
+
+		name := strings.Join(labels[i:], ".")
+		status, err := rdapGet(base+"domain/"+name, &response)
+		if status == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		registration := Registration{Domain: name, Registrar: findRegistrar(response.Entities)}
+		for _, event := range response.Events {
+			if event.Action != "expiration" {
+				continue
+			}
+			expiresAt, err := time.Parse(time.RFC3339, event.Date)
+			if err != nil {
+				return nil, errors.New("RDAP expiration " + event.Date + " of " + name + " is not a valid date")
+			}
+			expiresAt = expiresAt.UTC()
+			registration.ExpiresAt = &expiresAt
+		}
+		return &registration, nil
+	}
+
+	return nil, ErrNotRegistered
+}
+
+// Expiring, expired or empty state of the registration expiring at the time
+func registrationState(expiresAt *time.Time, now time.Time) string {
+	if expiresAt == nil {
+		return ""
+	}
+	if !expiresAt.After(now) {
+		return RegistrationStateExpired
+	}
+	if expiresAt.Before(now.AddDate(0, 0, config.ExpiryWarningDays)) {
+		return RegistrationStateExpiring
+	}
+	return ""
+}
+
+// CheckZoneRegistrations looks up registrations of domains of all zones and saves their registrar and
+// expiration. Failed lookups keep the last known registration and save the error. Zones which start to
+// expire or expire are sent as registration.expiring and registration.expired webhooks.
+func CheckZoneRegistrations(now time.Time) error {
+	var zones []Zone
+
+	servers, err := LoadRDAPServers()
+	if err != nil {
+		return err
+	}
+
+	db := GetDatabaseConnection()
+	err = activeZones(db).Where("domain NOT LIKE ?", "%.arpa").Order("id").Find(&zones).Error
+	if err != nil {
+		return err
+	}
+
+	for _, zone := range zones {
+		// State at the previous check, the registration could expire since then
+		previous := ""
+		if zone.RegistrationCheckedAt != nil {
+			previous = registrationState(zone.RegistrationExpiresAt, *zone.RegistrationCheckedAt)
+		}
+		checkedAt := now.UTC()
+		updates := map[string]interface{}{"registration_checked_at": &checkedAt, "registration_error": ""}
+
+		registration, err := LookupRegistration(zone.Domain, servers)
+		if err != nil {
+			updates["registration_error"] = err.Error()
+		} else {
+			updates["registrar"] = registration.Registrar
+			updates["registration_expires_at"] = registration.ExpiresAt
+			zone.Registrar = registration.Registrar
+			zone.RegistrationExpiresAt = registration.ExpiresAt
+		}
+
+		err = db.Model(&Zone{}).Where("id = ?", zone.ID).Updates(updates).Error
+		if err != nil {
+			return err
+		}
+		zone.RegistrationCheckedAt = &checkedAt
+		zone.RegistrationError, _ = updates["registration_error"].(string)
+
+		if zone.RegistrationExpiresAt != nil {
+			days := zone.RegistrationExpiresAt.Sub(now).Hours() / 24
+			MetricsGaugeSet("dnsapi_registration_expiry_days", "Days until the registration of the zone's domain expires", map[string]string{"zone": zone.Domain}, days)
+		}
+
+		state := registrationState(zone.RegistrationExpiresAt, now)
+		if state != "" && state != previous {
+			SendWebhook("registration."+state, zone)
+		}
+	}
+
+	return nil
+}
+
+// GetExpiringZones returns zones whose registration expires within the days or has expired, the soonest first
+func GetExpiringZones(days int, now time.Time) ([]Zone, error) {
+	zones := []Zone{}
+
+	db := GetReadDatabaseConnection()
+	err := activeZones(db).Where("registration_expires_at IS NOT NULL AND registration_expires_at < ?", now.AddDate(0, 0, days)).
+		Order("registration_expires_at").Find(&zones).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return zones, nil
+}
+
+// RunRegistrationScheduler checks registrations every DNSAPI_RDAP_INTERVAL seconds, it's supposed to run as goroutine
+func RunRegistrationScheduler() {
+	ticker := time.NewTicker(time.Duration(config.RDAPInterval) * time.Second)
+
+	for now := range ticker.C {
+		err := CheckZoneRegistrations(now)
+		if err != nil {
+			log.Errorf("registrations: " + err.Error())
+		}
+	}
+}
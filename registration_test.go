@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckZoneRegistrations(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := "2026-03-11T00:00:00Z"
+
+	var rdap *httptest.Server
+	rdap = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dns.json":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"services": [][][]string{{{"txt"}, {rdap.URL + "/rdap"}}},
+			})
+		case "/rdap/domain/bx-" + TEST_DOMAIN:
+			w.Write([]byte(`{
+				"events": [{"eventAction": "registration", "eventDate": "2020-03-11T00:00:00Z"},
+					{"eventAction": "expiration", "eventDate": "` + expiresAt + `"}],
+				"entities": [{"roles": ["registrar"], "vcardArray": ["vcard", [["version", {}, "text", "4.0"], ["fn", {}, "text", "Registrar s.r.o."]]]}]
+			}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer rdap.Close()
+
+	events := make(chan string, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event WebhookEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		events <- event.Event
+	}))
+	defer webhook.Close()
+
+	config.RDAPBootstrapURL = rdap.URL + "/dns.json"
+	config.ExpiryWarningDays = 30
+	config.WebhookURL = webhook.URL
+	defer func() {
+		config.RDAPBootstrapURL = ""
+		config.ExpiryWarningDays = 0
+		config.WebhookURL = ""
+	}()
+
+	zone, errs := NewZone("BX-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	subzone, errs := NewZone("shop.BX-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(subzone)
+	unregistered, errs := NewZone("unregistered-BX-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(unregistered)
+
+	assert.NoError(t, CheckZoneRegistrations(now))
+
+	checked, err := GetStore().GetZone(subzone.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Registrar s.r.o.", checked.Registrar, "Subzone of the registered domain")
+	if assert.NotNil(t, checked.RegistrationExpiresAt) {
+		assert.Equal(t, expiresAt, checked.RegistrationExpiresAt.UTC().Format(time.RFC3339))
+	}
+	assert.Equal(t, "", checked.RegistrationError)
+	checked, err = GetStore().GetZone(unregistered.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, ErrNotRegistered.Error(), checked.RegistrationError)
+	assert.NotNil(t, checked.RegistrationCheckedAt)
+
+	expiring, err := GetExpiringZones(30, now)
+	assert.NoError(t, err)
+	var domains []string
+	for _, zone := range expiring {
+		domains = append(domains, zone.Domain)
+	}
+	assert.Contains(t, domains, zone.Domain)
+	assert.Contains(t, domains, subzone.Domain)
+	assert.NotContains(t, domains, unregistered.Domain)
+	expiring, err = GetExpiringZones(5, now)
+	assert.NoError(t, err)
+	assert.Len(t, expiring, 0)
+
+	receive := func() string {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			return ""
+		}
+	}
+	assert.Equal(t, "registration.expiring", receive())
+	assert.Equal(t, "registration.expiring", receive())
+
+	// Nothing is sent again until the state changes
+	assert.NoError(t, CheckZoneRegistrations(now.Add(time.Hour)))
+	assert.NoError(t, CheckZoneRegistrations(now.AddDate(0, 0, 10)))
+	assert.Equal(t, "registration.expired", receive())
+	assert.Equal(t, "registration.expired", receive())
+	select {
+	case event := <-events:
+		t.Error("Unexpected event", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Lookups without RDAP server of the top level domain fail
+	_, err = LookupRegistration("example.invalid", map[string][]string{})
+	assert.Equal(t, ErrNoRDAPServer, err)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Limits of names and messages in the DNS wire format
+const (
+	MaxLabelLength     = 63    // RFC 1035 section 2.3.4
+	MaxWireNameLength  = 255   // RFC 1035 section 2.3.4, including the length bytes and the root label
+	MaxMessageSize     = 65535 // Messages over TCP have 16 bit length, RFC 1035 section 4.2.2
+	messageHeaderSize  = 12
+	UDPResponseSize    = 1232 // EDNS buffer size recommended by DNS flag day 2020, larger answers need TCP
+	questionFixedBytes = 4    // QTYPE and QCLASS
+)
+
+// Returns problems of the fully qualified name (without trailing dot), empty if it fits the limits
+func nameLengthProblem(fqdn string) string {
+	wireLength := 1
+	for _, label := range strings.Split(fqdn, ".") {
+		if len(label) > MaxLabelLength {
+			return "label " + label + " has " + strconv.Itoa(len(label)) + " bytes, labels can have at most " +
+				strconv.Itoa(MaxLabelLength) + " bytes; shorten it or split it by dots"
+		}
+		wireLength += len(label) + 1
+	}
+	if wireLength > MaxWireNameLength {
+		return "name " + fqdn + " has " + strconv.Itoa(wireLength) + " bytes in wire format, names can have at most " +
+			strconv.Itoa(MaxWireNameLength) + " bytes; use shorter labels or fewer of them"
+	}
+	return ""
+}
+
+// Names and targets have to fit into the label and name limits, RRsets have to fit into one message and
+// TXT RRsets larger than UDP answers are reported because answers over TCP fail with some resolvers.
+// BIND refuses to load zone files breaking the limits, so the errors block every commit.
+func lintRenderLimits(zone *Zone) []LintIssue {
+	var issues []LintIssue
+
+	for _, record := range zone.Records {
+		names := []string{fqdnInZone(record.Name, zone.Domain)}
+		recordType := GetRecordType(record.Type)
+		if recordType != nil && recordType.Target != nil {
+			target := recordType.Target(&record)
+			if target != "" && target != "." {
+				names = append(names, fqdnInZone(target, zone.Domain))
+			}
+		}
+
+		for i, name := range names {
+			problem := nameLengthProblem(name)
+			if problem == "" {
+				continue
+			}
+			if i > 0 {
+				problem = "target: " + problem
+			}
+			issues = append(issues, LintIssue{
+				Severity: LintSeverityError,
+				RecordId: record.ID,
+				Name:     record.Name,
+				Type:     record.Type,
+				Message:  problem,
+			})
+		}
+	}
+	// Zone which breaks name limits can't be parsed to count sizes
+	if len(issues) > 0 {
+		return issues
+	}
+
+	// Zones which were never committed have no serial yet
+	rendered := *zone
+	if rendered.Serial == "" {
+		rendered.SetNewSerial()
+	}
+
+	apex := strings.ToLower(dns.Fqdn(zone.Domain))
+	sizes := make(map[string]int)
+	var keys []string
+	parser := dns.NewZoneParser(strings.NewReader(rendered.Render()), apex, "")
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		header := rr.Header()
+		key := strings.ToLower(header.Name) + " " + dns.TypeToString[header.Rrtype]
+		if _, ok := sizes[key]; !ok {
+			keys = append(keys, key)
+		}
+		sizes[key] += dns.Len(rr)
+	}
+	if err := parser.Err(); err != nil {
+		return append(issues, LintIssue{
+			Severity: LintSeverityError,
+			Name:     "@",
+			Message:  "rendered zone file can't be loaded: " + err.Error(),
+		})
+	}
+
+	for _, key := range keys {
+		parts := strings.SplitN(key, " ", 2)
+		name := normalizeName(parts[0], zone.Domain)
+		available := MaxMessageSize - messageHeaderSize - (len(parts[0]) + 1) - questionFixedBytes
+		if sizes[key] > available {
+			issues = append(issues, LintIssue{
+				Severity: LintSeverityError,
+				Name:     name,
+				Type:     parts[1],
+				Message: "RRset has " + strconv.Itoa(sizes[key]) + " bytes in wire format, answers can have at most " +
+					strconv.Itoa(available) + " bytes for it; remove values or move some of them to another name",
+			})
+		} else if parts[1] == "TXT" && sizes[key] > UDPResponseSize {
+			issues = append(issues, LintIssue{
+				Severity: LintSeverityWarning,
+				Name:     name,
+				Type:     parts[1],
+				Message: "RRset has " + strconv.Itoa(sizes[key]) + " bytes in wire format, answers over " +
+					strconv.Itoa(UDPResponseSize) + " bytes need TCP which some resolvers and firewalls break",
+			})
+		}
+	}
+
+	return issues
+}
+
+// Checks the zone against limits of the DNS wire format before it's rendered for deployment
+func checkRenderLimits(zone *Zone) error {
+	report := &LintReport{ZoneId: zone.ID, Domain: zone.Domain, Issues: []LintIssue{}}
+	for _, issue := range lintRenderLimits(zone) {
+		if issue.Severity == LintSeverityError {
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+	if len(report.Issues) > 0 {
+		return &LintError{Report: report}
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLintRenderLimits(t *testing.T) {
+	domain := "ar-" + TEST_DOMAIN
+	zone := &Zone{Domain: domain, Records: []Record{
+		{ID: 1, Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"},
+		{ID: 2, Name: strings.Repeat("a", 64), TTL: 300, Type: "A", Value: "192.0.2.1"},
+		{ID: 3, Name: "alias", TTL: 300, Type: "CNAME", Value: strings.Repeat(strings.Repeat("b", 60)+".", 5)},
+	}}
+
+	issues := lintRenderLimits(zone)
+	assert.Len(t, issues, 2)
+	assert.Equal(t, uint(2), issues[0].RecordId)
+	assert.Contains(t, issues[0].Message, "64 bytes")
+	assert.Equal(t, uint(3), issues[1].RecordId)
+	assert.Contains(t, issues[1].Message, "target: name")
+
+	// TXT answers larger than UDP answers are only warned about
+	zone.Records = []Record{
+		{ID: 1, Name: "@", TTL: 300, Type: "TXT", Value: strings.Repeat("c", 1000)},
+		{ID: 2, Name: "@", TTL: 300, Type: "TXT", Value: strings.Repeat("d", 1000)},
+	}
+	issues = lintRenderLimits(zone)
+	assert.Len(t, issues, 1)
+	assert.Equal(t, LintSeverityWarning, issues[0].Severity)
+	assert.Equal(t, "@", issues[0].Name)
+	assert.Nil(t, checkRenderLimits(zone))
+
+	// RRset which can't fit into any message
+	zone.Records = nil
+	for i := 0; i < 70; i++ {
+		zone.Records = append(zone.Records, Record{Name: "big", TTL: 300, Type: "TXT", Value: strings.Repeat("e", 990) + strings.Repeat("f", i)})
+	}
+	issues = lintRenderLimits(zone)
+	assert.Len(t, issues, 1)
+	assert.Equal(t, LintSeverityError, issues[0].Severity)
+	assert.Equal(t, "big", issues[0].Name)
+	assert.Equal(t, "TXT", issues[0].Type)
+
+	err := checkRenderLimits(zone)
+	lintErr, ok := err.(*LintError)
+	assert.True(t, ok)
+	assert.Len(t, lintErr.Report.Issues, 1)
+}
+
+func TestCommitZone_renderLimits(t *testing.T) {
+	config.SkipDeploy = true
+	defer func() { config.SkipDeploy = false }()
+
+	zone, errs := NewZone("AR-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	// Too long label can't be parsed, the name is too long only with the domain of the zone
+	_, errs = NewRecord(zone.ID, strings.Repeat("a", 70), 300, "A", 0, "192.0.2.1")
+	assert.Len(t, errs, 1)
+	_, errs = NewRecord(zone.ID, strings.Repeat(strings.Repeat("a", 60)+".", 3)+strings.Repeat("a", 60), 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	err := CommitZone(zone.ID, false)
+	_, ok := err.(*LintError)
+	assert.True(t, ok)
+}
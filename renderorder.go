@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Orders of records in rendered zones
+const (
+	RenderOrderName = "name" // By name (apex first), then type
+	RenderOrderType = "type" // By type, then name (apex first)
+)
+
+// ValidateRenderOrder checks DNSAPI_RENDER_ORDER and DNSAPI_RENDER_TYPE_ORDER, empty order is order by name
+func ValidateRenderOrder(order string, types []string) error {
+	if order != "" && order != RenderOrderName && order != RenderOrderType {
+		return errors.New("order has to be " + RenderOrderName + " or " + RenderOrderType)
+	}
+	for _, recordType := range types {
+		if GetRecordType(strings.ToUpper(strings.TrimSpace(recordType))) == nil {
+			return errors.New("unsupported record type " + recordType)
+		}
+	}
+	return nil
+}
+
+// Position of the type in DNSAPI_RENDER_TYPE_ORDER, types which are not listed go after the listed ones
+func typeRank(recordType string) int {
+	for i, listed := range config.RenderTypeOrder {
+		if strings.EqualFold(strings.TrimSpace(listed), recordType) {
+			return i
+		}
+	}
+	return len(config.RenderTypeOrder)
+}
+
+// Orders sorted records by DNSAPI_RENDER_ORDER, records of the same RRset stay in the order of SortedRecords
+func renderOrder(records []Record) []Record {
+	if config.RenderOrder != RenderOrderType {
+		return records
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if rankA, rankB := typeRank(a.Type), typeRank(b.Type); rankA != rankB {
+			return rankA < rankB
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return compareNames(a.Name, b.Name) < 0
+	})
+	return records
+}
+
+// Key of the group the record belongs to, DNSAPI_RENDER_GROUPS separates groups by an empty line
+func renderGroup(record *Record) string {
+	if config.RenderOrder == RenderOrderType {
+		return record.Type
+	}
+	return record.Name
+}
+
+// Renders the records in aligned columns. With DNSAPI_RENDER_GROUPS groups are separated by an empty line
+// and the owner name is written only once for records of the same name in the group.
+func renderRecords(records []Record, defaultTTL int) string {
+	var zone string
+
+	var nameWidth, ttlWidth, typeWidth int
+	for _, record := range records {
+		if len(record.Name) > nameWidth {
+			nameWidth = len(record.Name)
+		}
+		if record.TTL != defaultTTL && len(strconv.Itoa(record.TTL)+"s") > ttlWidth {
+			ttlWidth = len(strconv.Itoa(record.TTL) + "s")
+		}
+		if len(record.Type) > typeWidth {
+			typeWidth = len(record.Type)
+		}
+	}
+
+	for i, record := range records {
+		if config.RenderGroups && i > 0 {
+			previous := records[i-1]
+			if renderGroup(&previous) != renderGroup(&record) {
+				zone += "\n"
+			} else if previous.Name == record.Name && record.Comment == "" {
+				// Empty owner is the owner of the previous record, RFC 1035 section 5.1
+				record.Name = ""
+			}
+		}
+		zone += renderComment(record.Comment)
+		zone += record.renderColumns(nameWidth, ttlWidth, typeWidth, defaultTTL)
+		zone += "\n"
+	}
+
+	return zone
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZone_RenderOrder(t *testing.T) {
+	config.RenderOrder = RenderOrderType
+	config.RenderTypeOrder = []string{"MX", "A"}
+	config.RenderGroups = true
+	defer func() {
+		config.RenderOrder = ""
+		config.RenderTypeOrder = nil
+		config.RenderGroups = false
+	}()
+
+	zone := Zone{ID: 1, Domain: "bn-" + TEST_DOMAIN, Serial: "2020010101", TTL: 300}
+	zone.AddRecord("www", 300, "A", 0, "1.2.3.5")
+	zone.AddRecord("@", 300, "TXT", 0, "v=spf1 -all")
+	zone.AddRecord("@", 300, "MX", 20, "mail2.rosti.cz.")
+	zone.AddRecord("@", 300, "A", 0, "1.2.3.4")
+	zone.AddRecord("@", 300, "MX", 10, "mail.rosti.cz.")
+	zone.AddRecord("www", 3600, "A", 0, "1.2.3.6")
+	zone.AddRecord("@", 300, "AAAA", 0, "2001:db8::1")
+
+	rendered := zone.Render()
+	assert.Contains(t, rendered, "NS    ns2.rosti.cz.\n\n"+
+		"@               MX        10    mail.rosti.cz.\n"+
+		"                MX        20    mail2.rosti.cz.\n"+
+		"\n"+
+		"@               A         1.2.3.4\n"+
+		"www             A         1.2.3.5\n"+
+		"       3600s    A         1.2.3.6\n"+
+		"\n"+
+		"@               AAAA      2001:db8::1\n"+
+		"\n"+
+		"@               TXT       (\"v=spf1 -all\")\n")
+
+	// Records without owner name belong to the previous owner
+	records, err := ParseZoneFile(rendered, zone.Domain)
+	assert.NoError(t, err)
+	assert.Equal(t, recordSet(zone.Records), recordSet(records))
+
+	parser := dns.NewZoneParser(strings.NewReader(rendered), dns.Fqdn(zone.Domain), "")
+	var owners []string
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		if rr.Header().Rrtype == dns.TypeA {
+			owners = append(owners, rr.Header().Name)
+		}
+	}
+	assert.NoError(t, parser.Err())
+	assert.Equal(t, []string{dns.Fqdn(zone.Domain), "www." + dns.Fqdn(zone.Domain), "www." + dns.Fqdn(zone.Domain)}, owners)
+
+	// Groups of names
+	config.RenderOrder = RenderOrderName
+	rendered = zone.Render()
+	assert.Contains(t, rendered, "                AAAA      2001:db8::1\n"+
+		"                MX        10    mail.rosti.cz.\n")
+	assert.Contains(t, rendered, "(\"v=spf1 -all\")\n\nwww             A         1.2.3.5\n")
+
+	assert.NoError(t, ValidateRenderOrder("", nil))
+	assert.Error(t, ValidateRenderOrder("value", nil))
+	assert.Error(t, ValidateRenderOrder(RenderOrderType, []string{"MX", "NOPE"}))
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Returned when request authenticated by the API token tries to change a record with reserved name
+var ErrReservedName = errors.New("name is reserved, its records can be changed only with the admin token")
+
+// IsReservedNameError returns true if the error refuses a change of records with reserved name
+func IsReservedNameError(err error) bool {
+	return errors.Cause(err) == ErrReservedName
+}
+
+// Returns normalized names reserved in the zone, global ones from the configuration included
+func (z *Zone) reservedNames() map[string]bool {
+	names := make(map[string]bool)
+
+	for _, name := range append(append([]string{}, config.ReservedNames...), strings.Split(z.ReservedNames, ",")...) {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			names[normalizeName(name, z.Domain)] = true
+		}
+	}
+
+	return names
+}
+
+// IsReservedName returns true if records of the name can be changed only with the admin token
+func (z *Zone) IsReservedName(name string) bool {
+	return z.reservedNames()[normalizeName(name, z.Domain)]
+}
+
+// Loads the zone, nil is returned if it doesn't exist and the operation itself reports it
+func reservedNamesZone(zoneId uint) *Zone {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		panic(err)
+	}
+
+	return &zone
+}
+
+// CheckReservedNewRecord checks whether a new record with the name can be added without the admin token
+func CheckReservedNewRecord(zoneId uint, name string) error {
+	zone := reservedNamesZone(zoneId)
+	if zone != nil && zone.IsReservedName(name) {
+		return errors.Wrap(ErrReservedName, name)
+	}
+	return nil
+}
+
+// CheckReservedRecord checks whether the record can be changed or deleted (empty newName) without the admin token
+func CheckReservedRecord(recordId uint, newName string) error {
+	var record Record
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", recordId).Find(&record).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		panic(err)
+	}
+
+	zone := reservedNamesZone(record.ZoneId)
+	if zone == nil {
+		return nil
+	}
+	if zone.IsReservedName(record.Name) {
+		return errors.Wrap(ErrReservedName, record.Name)
+	}
+	if newName != "" && zone.IsReservedName(newName) {
+		return errors.Wrap(ErrReservedName, newName)
+	}
+	return nil
+}
+
+// CheckReservedRecords checks whether records of the zone can be replaced by given records without
+// the admin token, records with reserved names have to stay as they are
+func CheckReservedRecords(zoneId uint, records []Record) error {
+	zone := reservedNamesZone(zoneId)
+	if zone == nil {
+		return nil
+	}
+
+	counts := make(map[string]int)
+	for _, record := range zone.Records {
+		if zone.IsReservedName(record.Name) {
+			counts[recordKey(&record)]++
+		}
+	}
+	for _, record := range records {
+		record.Normalize(zone.Domain)
+		if !zone.IsReservedName(record.Name) {
+			continue
+		}
+		if counts[recordKey(&record)] == 0 {
+			return errors.Wrap(ErrReservedName, record.Name)
+		}
+		counts[recordKey(&record)]--
+	}
+	for key, count := range counts {
+		if count > 0 {
+			return errors.Wrap(ErrReservedName, strings.Split(key, " ")[0])
+		}
+	}
+
+	return nil
+}
+
+// CheckReservedTemplate checks whether the template can be applied on the zone without the admin token
+func CheckReservedTemplate(zoneId uint, templateId uint) error {
+	var templateRecords []TemplateRecord
+
+	zone := reservedNamesZone(zoneId)
+	if zone == nil {
+		return nil
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("template_id = ?", templateId).Find(&templateRecords).Error
+	if err != nil {
+		panic(err)
+	}
+
+	for _, templateRecord := range templateRecords {
+		if zone.IsReservedName(templateRecord.Name) {
+			return errors.Wrap(ErrReservedName, templateRecord.Name)
+		}
+	}
+	return nil
+}
+
+// SetZoneReservedNames sets names reserved in the zone in addition to DNSAPI_RESERVED_NAMES
+func SetZoneReservedNames(zoneId uint, names []string) (*Zone, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var normalized []string
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		normalized = append(normalized, normalizeName(strings.TrimSpace(name), zone.Domain))
+	}
+	zone.ReservedNames = strings.Join(normalized, ",")
+
+	err = db.Model(&zone).Update("reserved_names", zone.ReservedNames).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
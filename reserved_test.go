@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo"
+)
+
+func TestReservedNames(t *testing.T) {
+	config.ReservedNames = []string{"@"}
+	defer func() { config.ReservedNames = nil }()
+
+	zone, errs := NewZone("AA-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	zone, errs = SetZoneReservedNames(zone.ID, []string{"Mail", "ns1.aa-" + TEST_DOMAIN + "."})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if zone.ReservedNames != "mail,ns1" {
+		t.Error("Unexpected reserved names", zone.ReservedNames)
+	}
+	if !zone.IsReservedName("@") || !zone.IsReservedName("MAIL") || zone.IsReservedName("www") {
+		t.Error("Unexpected reserved names", zone.reservedNames())
+	}
+
+	mail, errs := NewRecord(zone.ID, "mail", 300, "A", 0, "1.2.3.4")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	www, errs := NewRecord(zone.ID, "www", 300, "A", 0, "1.2.3.5")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	if err := CheckReservedNewRecord(zone.ID, "@"); err == nil {
+		t.Error("New record in reserved apex passed")
+	}
+	if err := CheckReservedNewRecord(zone.ID, "ftp"); err != nil {
+		t.Error(err)
+	}
+	if err := CheckReservedRecord(mail.ID, ""); err == nil {
+		t.Error("Deletion of reserved record passed")
+	}
+	if err := CheckReservedRecord(www.ID, "ns1"); err == nil {
+		t.Error("Rename to reserved name passed")
+	}
+	if err := CheckReservedRecord(www.ID, "www2"); err != nil {
+		t.Error(err)
+	}
+
+	// Import has to keep reserved records as they are
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zone.ID).Preload("Records").Find(zone).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := ParseZoneFile(strings.Replace(zone.Render(), "1.2.3.5", "1.2.3.6", 1), zone.Domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckReservedRecords(zone.ID, records); err != nil {
+		t.Error(err)
+	}
+	records, err = ParseZoneFile(strings.Replace(zone.Render(), "1.2.3.4", "1.2.3.6", 1), zone.Domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckReservedRecords(zone.ID, records); err == nil {
+		t.Error("Change of reserved record by import passed")
+	}
+
+	// Only admin can add records with reserved names
+	for _, admin := range []bool{false, true} {
+		e := echo.New()
+		request := httptest.NewRequest(echo.POST, "/", strings.NewReader(`{"name": "mail", "type": "A", "ttl": 300, "value": "1.2.3.7"}`))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(request, recorder)
+		context.SetParamNames("zone_id")
+		context.SetParamValues(strconv.Itoa(int(zone.ID)))
+		context.Set("admin", admin)
+
+		err = NewRecordHandler(context)
+		if admin && (err != nil || recorder.Code != http.StatusCreated) {
+			t.Error("Admin can't add reserved record", err, recorder.Body.String())
+		}
+		if httpErr, ok := err.(*echo.HTTPError); !admin && (!ok || httpErr.Code != http.StatusForbidden) {
+			t.Error("Reserved record was added without admin token", err)
+		}
+	}
+}
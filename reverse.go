@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// Suffixes of reverse zones of IPv4 and IPv6 addresses
+const (
+	ReverseZoneIPv4 = "in-addr.arpa"
+	ReverseZoneIPv6 = "ip6.arpa"
+)
+
+// IsReverse returns true for zones under in-addr.arpa or ip6.arpa
+func (z *Zone) IsReverse() bool {
+	return isReverseZone(z.Domain)
+}
+
+func isReverseZone(domain string) bool {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	return strings.HasSuffix(domain, "."+ReverseZoneIPv4) || strings.HasSuffix(domain, "."+ReverseZoneIPv6)
+}
+
+// Reverse zones are named by octets of IPv4 networks or nibbles of IPv6 networks in reversed order.
+// The first label of IPv4 zone can be a classless delegation (RFC 2317) in the form of the first and the last
+// octet, ex. 0-127. The form with slash isn't supported because the domain is a part of paths of zone files.
+func validateReverseZone(domain string) error {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+
+	if strings.HasSuffix(domain, "."+ReverseZoneIPv6) {
+		labels := strings.Split(strings.TrimSuffix(domain, "."+ReverseZoneIPv6), ".")
+		if len(labels) > 32 {
+			return errors.New(domain + " has more than 32 nibbles of IPv6 address")
+		}
+		for _, label := range labels {
+			if len(label) != 1 || !strings.Contains("0123456789abcdef", label) {
+				return errors.New(domain + ": labels of " + ReverseZoneIPv6 + " zone have to be single hexadecimal digits")
+			}
+		}
+		return nil
+	}
+
+	labels := strings.Split(strings.TrimSuffix(domain, "."+ReverseZoneIPv4), ".")
+	if len(labels) > 4 {
+		return errors.New(domain + " has more than 4 octets of IPv4 address")
+	}
+	for i, label := range labels {
+		if i == 0 && len(labels) == 4 && strings.Contains(label, "-") {
+			if !validClasslessLabel(label) {
+				return errors.New(domain + ": " + label + " is not a valid classless delegation, use the first and the last octet like 0-127")
+			}
+			continue
+		}
+		if !validOctet(label) {
+			return errors.New(domain + ": labels of " + ReverseZoneIPv4 + " zone have to be numbers between 0 and 255")
+		}
+	}
+	return nil
+}
+
+func validOctet(label string) bool {
+	octet, err := strconv.Atoi(label)
+	return err == nil && octet >= 0 && octet <= 255 && strconv.Itoa(octet) == label
+}
+
+func validClasslessLabel(label string) bool {
+	parts := strings.Split(label, "-")
+	if len(parts) != 2 || !validOctet(parts[0]) || !validOctet(parts[1]) {
+		return false
+	}
+	first, _ := strconv.Atoi(parts[0])
+	last, _ := strconv.Atoi(parts[1])
+	return first < last
+}
+
+// Name of the PTR record of the IP address in the reverse zone, false if the address doesn't belong to the zone
+func reverseName(ip string, domain string) (string, bool) {
+	if net.ParseIP(ip) == nil {
+		return "", false
+	}
+	arpa, err := dns.ReverseAddr(ip)
+	if err != nil {
+		return "", false
+	}
+	name := normalizeName(arpa, domain)
+	if strings.HasSuffix(name, ".") {
+		return "", false
+	}
+	return name, true
+}
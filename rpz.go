@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Timeout of one blocklist download
+const RPZFeedTimeout = 60 * time.Second
+
+// Blocklists bigger than this are refused
+const RPZMaxFeedSize = 64 << 20
+
+// Value of RPZ records which answer NXDOMAIN for the blocked name
+const RPZBlockValue = "."
+
+// Names allowed in blocklists, optionally with a wildcard label blocking all subdomains
+var rpzNameRegexp = regexp.MustCompile(`^(\*\.)?([a-z0-9_]([a-z0-9_\-]{0,61}[a-z0-9_])?\.)*[a-z0-9_]([a-z0-9_\-]{0,61}[a-z0-9_])?$`)
+
+// Names in hosts files which are not blocked
+var hostsIgnoredNames = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"0.0.0.0":               true,
+}
+
+// Sync runs one at a time, the scheduler and the admin endpoint can overlap
+var rpzSyncLock sync.Mutex
+
+// RPZSyncResult reports one synchronization of the blocklist zone
+type RPZSyncResult struct {
+	Zone      string `json:"zone"`
+	Feeds     int    `json:"feeds"`
+	Entries   int    `json:"entries"`   // Blocked names in the zone after the sync
+	Added     int    `json:"added"`     // Newly blocked names
+	Removed   int    `json:"removed"`   // Names which are not in any feed anymore
+	Skipped   int    `json:"skipped"`   // Invalid lines of the feeds
+	Truncated bool   `json:"truncated"` // Feeds had more names than DNSAPI_RPZ_MAX_ENTRIES
+	Committed bool   `json:"committed"` // False if nothing changed
+}
+
+// Parses a blocklist in hosts format (0.0.0.0 name), RPZ format (name CNAME .) or one name per line.
+// Returns lowercase names without the trailing dot and number of skipped lines.
+func parseBlocklist(content io.Reader) ([]string, int, error) {
+	var names []string
+	var origin string
+	skipped := 0
+
+	scanner := bufio.NewScanner(content)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(strings.ToLower(line))
+		if len(fields) == 0 {
+			continue
+		}
+
+		var name string
+		switch {
+		case fields[0] == "$origin" && len(fields) == 2:
+			origin = strings.TrimSuffix(fields[1], ".")
+			continue
+		case strings.HasPrefix(fields[0], "$"):
+			continue
+		case net.ParseIP(fields[0]) != nil:
+			// hosts format, one address can be followed by more names
+			for _, host := range fields[1:] {
+				if !hostsIgnoredNames[host] && rpzNameRegexp.MatchString(strings.TrimSuffix(host, ".")) {
+					names = append(names, strings.TrimSuffix(host, "."))
+				} else if !hostsIgnoredNames[host] {
+					skipped++
+				}
+			}
+			continue
+		case len(fields) == 1:
+			name = fields[0]
+		default:
+			// RPZ records, only blocking ones are taken; SOA, NS and passthru records are ignored
+			recordType := -1
+			for i, field := range fields {
+				if field == "cname" {
+					recordType = i
+					break
+				}
+			}
+			if recordType < 0 || recordType+1 >= len(fields) || fields[recordType+1] != "." {
+				continue
+			}
+			name = fields[0]
+		}
+
+		name = strings.TrimSuffix(name, ".")
+		if origin != "" {
+			if name == origin {
+				continue
+			}
+			name = strings.TrimSuffix(name, "."+origin)
+		}
+		if !rpzNameRegexp.MatchString(name) {
+			skipped++
+			continue
+		}
+		names = append(names, name)
+	}
+
+	return names, skipped, scanner.Err()
+}
+
+// Downloads and parses one blocklist
+func fetchBlocklist(url string) ([]string, int, error) {
+	client := http.Client{Timeout: RPZFeedTimeout}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, 0, errors.New("unexpected status code " + strconv.Itoa(resp.StatusCode))
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, RPZMaxFeedSize+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(content) > RPZMaxFeedSize {
+		return nil, 0, errors.New("blocklist is bigger than " + strconv.Itoa(RPZMaxFeedSize>>20) + " MB")
+	}
+
+	return parseBlocklist(strings.NewReader(string(content)))
+}
+
+// SyncRPZ downloads all DNSAPI_RPZ_FEEDS and replaces blocking records (CNAME .) of DNSAPI_RPZ_ZONE by
+// names from the feeds in one batch, other records of the zone (ex. passthru exceptions) are kept.
+// The zone is left untouched if any feed fails, so an outage of one feed doesn't unblock its names.
+func SyncRPZ() (*RPZSyncResult, error) {
+	var zone Zone
+
+	if config.RPZZone == "" || len(config.RPZFeeds) == 0 {
+		return nil, errors.New("RPZ sync is not configured, set DNSAPI_RPZ_ZONE and DNSAPI_RPZ_FEEDS")
+	}
+
+	rpzSyncLock.Lock()
+	defer rpzSyncLock.Unlock()
+
+	db := GetDatabaseConnection()
+	err := db.Where("domain = ?", config.RPZZone).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, errors.Wrap(err, "RPZ zone "+config.RPZZone)
+	}
+
+	result := &RPZSyncResult{Zone: zone.Domain, Feeds: len(config.RPZFeeds)}
+
+	// Longest name which still fits into the zone
+	maxNameLength := MaxNameLength - len(zone.Domain) - 1
+
+	blocked := make(map[string]bool)
+	for _, feed := range config.RPZFeeds {
+		names, skipped, err := fetchBlocklist(feed)
+		if err != nil {
+			return nil, errors.Wrap(err, "blocklist "+feed)
+		}
+		result.Skipped += skipped
+		for _, name := range names {
+			if len(name) > maxNameLength {
+				result.Skipped++
+				continue
+			}
+			blocked[name] = true
+		}
+	}
+
+	// Names with other records are exceptions managed by hand, they win over the feeds
+	var records []Record
+	existing := make(map[string]bool)
+	for _, record := range zone.Records {
+		if record.Type == "CNAME" && record.Value == RPZBlockValue {
+			existing[record.Name] = true
+			continue
+		}
+		delete(blocked, record.Name)
+		records = append(records, record)
+	}
+
+	var names []string
+	for name := range blocked {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if config.RPZMaxEntries > 0 && len(names) > config.RPZMaxEntries {
+		names = names[:config.RPZMaxEntries]
+		result.Truncated = true
+	}
+
+	for _, name := range names {
+		if existing[name] {
+			delete(existing, name)
+		} else {
+			result.Added++
+		}
+		records = append(records, Record{ZoneId: zone.ID, Name: name, TTL: zone.TypeTTL("CNAME"), Type: "CNAME", Value: RPZBlockValue})
+	}
+	result.Removed = len(existing)
+	result.Entries = len(names)
+
+	if result.Added == 0 && result.Removed == 0 {
+		return result, nil
+	}
+
+	_, errs := ReplaceRecords(zone.ID, records)
+	if len(errs) > 0 {
+		return nil, errors.Wrap(errs[0], "RPZ zone "+zone.Domain)
+	}
+
+	err = Commit(zone.ID)
+	if err != nil && err != ErrCommitQueued && err != ErrSerialBatched {
+		return nil, err
+	}
+	result.Committed = true
+
+	return result, nil
+}
+
+// RunRPZScheduler syncs the blocklist zone every DNSAPI_RPZ_INTERVAL seconds
+func RunRPZScheduler() {
+	ticker := time.NewTicker(time.Duration(config.RPZInterval) * time.Second)
+
+	for range ticker.C {
+		result, err := SyncRPZ()
+		if err != nil {
+			log.Errorf("RPZ sync: " + err.Error())
+			continue
+		}
+		if result.Committed {
+			log.Infof("RPZ sync of %s: %d entries, %d added, %d removed", result.Zone, result.Entries, result.Added, result.Removed)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBlocklist(t *testing.T) {
+	names, skipped, err := parseBlocklist(strings.NewReader(`# hosts
+127.0.0.1 localhost
+0.0.0.0 Ads.Example.com tracker.example.com
+0.0.0.0 bad..name
+plain.example.org
+$ORIGIN rpz.example.
+@ SOA ns.example. hostmaster.example. 1 3600 600 86400 60
+malware.example.net CNAME .
+*.malware.example.net.rpz.example. 300 IN CNAME . ; wildcard
+allowed.example.net CNAME rpz-passthru.
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, skipped)
+	assert.Equal(t, []string{"ads.example.com", "tracker.example.com", "plain.example.org", "malware.example.net", "*.malware.example.net"}, names)
+}
+
+func TestSyncRPZ(t *testing.T) {
+	feeds := map[string]string{
+		"/hosts": "0.0.0.0 ads.example.com\n0.0.0.0 tracker.example.com\n0.0.0.0 allowed.example.com\n",
+		"/rpz":   "malware.example.net CNAME .\nads.example.com CNAME .\n",
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := feeds[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	zone, errs := NewZone("AJ-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	_, errs = NewRecord(zone.ID, "allowed.example.com", 300, "CNAME", 0, "rpz-passthru.")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	config.SkipDeploy = true
+	config.TTL = 300
+	config.RPZZone = zone.Domain
+	config.RPZFeeds = []string{server.URL + "/hosts", server.URL + "/rpz"}
+	defer func() {
+		config.SkipDeploy = false
+		config.TTL = 0
+		config.RPZZone = ""
+		config.RPZFeeds = nil
+		config.RPZMaxEntries = 0
+	}()
+
+	result, err := SyncRPZ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, result.Entries)
+	assert.Equal(t, 3, result.Added)
+	assert.True(t, result.Committed)
+
+	sets, err := GetRRSets(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocked []string
+	for _, set := range sets {
+		if set.Records[0].Value == RPZBlockValue {
+			blocked = append(blocked, set.Name)
+		}
+	}
+	assert.ElementsMatch(t, []string{"ads.example.com", "tracker.example.com", "malware.example.net"}, blocked)
+
+	// Nothing changed, nothing is committed
+	result, err = SyncRPZ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, result.Committed)
+
+	feeds["/hosts"] = "0.0.0.0 ads.example.com\n"
+	config.RPZMaxEntries = 1
+	result, err = SyncRPZ()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, result.Entries)
+	assert.Equal(t, 2, result.Removed)
+	assert.True(t, result.Truncated)
+
+	// Failed feed keeps the zone untouched
+	config.RPZFeeds = append(config.RPZFeeds, server.URL+"/missing")
+	_, err = SyncRPZ()
+	assert.NotNil(t, err)
+	sets, err = GetRRSets(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, sets, 2)
+}
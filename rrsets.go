@@ -0,0 +1,212 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RRSetRecord is one value of the RRset, prio is used only by types with priority (MX)
+type RRSetRecord struct {
+	Prio  int    `json:"prio"`
+	Value string `json:"value"`
+}
+
+// RRSet is a set of records with the same name and type sharing one TTL, ex. round-robin A records
+type RRSet struct {
+	Name    string        `json:"name"`
+	Type    string        `json:"type"`
+	TTL     int           `json:"ttl"` // The lowest TTL if records of the set differ in TTL
+	Records []RRSetRecord `json:"records"`
+}
+
+// Groups records into RRsets, records have to be sorted by name and type
+func groupRRSets(records []Record) []RRSet {
+	var sets = []RRSet{}
+
+	for _, record := range records {
+		last := len(sets) - 1
+		if last < 0 || sets[last].Name != record.Name || sets[last].Type != record.Type {
+			sets = append(sets, RRSet{Name: record.Name, Type: record.Type, TTL: record.TTL, Records: []RRSetRecord{}})
+			last++
+		}
+		if record.TTL < sets[last].TTL {
+			sets[last].TTL = record.TTL
+		}
+		sets[last].Records = append(sets[last].Records, RRSetRecord{Prio: record.Prio, Value: record.Value})
+	}
+
+	return sets
+}
+
+// GetRRSets returns all RRsets of the zone
+func GetRRSets(zoneId uint) ([]RRSet, error) {
+	var zone Zone
+
+	db := GetReadDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return groupRRSets(zone.SortedRecords()), nil
+}
+
+// GetRRSet returns one RRset of the zone, error with RECORD_NOT_FOUND_MESSAGE is returned if it's empty
+func GetRRSet(zoneId uint, name string, recordType string) (*RRSet, error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	name = normalizeName(name, zone.Domain)
+	recordType = strings.ToUpper(recordType)
+	for _, set := range groupRRSets(zone.SortedRecords()) {
+		if set.Name == name && set.Type == recordType {
+			return &set, nil
+		}
+	}
+
+	return nil, errors.New(RECORD_NOT_FOUND_MESSAGE)
+}
+
+// RRSetZoneRecords returns all records of the zone after the RRset is replaced by given one,
+// RRset without records removes all records with its name and type
+func RRSetZoneRecords(zoneId uint, set RRSet) ([]Record, error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	set.Name = normalizeName(set.Name, zone.Domain)
+	set.Type = strings.ToUpper(set.Type)
+	if GetRecordType(set.Type) == nil {
+		return nil, errors.New("record type " + set.Type + " is not supported")
+	}
+	if len(set.Records) > 0 && set.TTL == 0 {
+		set.TTL = zone.TypeTTL(set.Type)
+	}
+
+	var records []Record
+	for _, record := range zone.Records {
+		if record.Name != set.Name || record.Type != set.Type {
+			records = append(records, record)
+		}
+	}
+	for _, value := range set.Records {
+		record := Record{
+			ZoneId: zone.ID,
+			Name:   set.Name,
+			TTL:    set.TTL,
+			Type:   set.Type,
+			Prio:   value.Prio,
+			Value:  value.Value,
+		}
+		record.Normalize(zone.Domain)
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// ReplaceRRSet replaces all records with name and type of the RRset by its records in one transaction,
+// records which stay the same keep their IDs. Returns the new RRset, nil if it was removed.
+func ReplaceRRSet(zoneId uint, set RRSet) (*RRSet, []error) {
+	records, err := RRSetZoneRecords(zoneId, set)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	_, errs := ReplaceRecords(zoneId, records)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	syncWWWAfterChange(zoneId, set.Name)
+
+	if len(set.Records) == 0 {
+		return nil, nil
+	}
+
+	replaced, err := GetRRSet(zoneId, set.Name, set.Type)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return replaced, nil
+}
+
+// Returns the RRset of the zone, empty one with the type's default TTL if the zone has no such records,
+// and the value normalized as records of the RRset are
+func rrsetWithValue(zoneId uint, name string, recordType string, value RRSetRecord) (*RRSet, RRSetRecord, error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, value, err
+	}
+
+	recordType = strings.ToUpper(recordType)
+	if GetRecordType(recordType) == nil {
+		return nil, value, errors.New("record type " + recordType + " is not supported")
+	}
+	record := Record{Name: name, Type: recordType, Prio: value.Prio, Value: value.Value}
+	record.Normalize(zone.Domain)
+	value = RRSetRecord{Prio: record.Prio, Value: record.Value}
+
+	set, err := GetRRSet(zoneId, name, recordType)
+	if err != nil && strings.Trim(err.Error(), "\n") != RECORD_NOT_FOUND_MESSAGE {
+		return nil, value, err
+	}
+	if set == nil {
+		set = &RRSet{Name: record.Name, Type: recordType, TTL: zone.TypeTTL(recordType), Records: []RRSetRecord{}}
+	}
+
+	return set, value, nil
+}
+
+// RRSetAddValue returns the RRset with one more value, ex. a verification token added to TXT records of
+// the apex. Records of the RRset keep their values and get its TTL.
+func RRSetAddValue(zoneId uint, name string, recordType string, value RRSetRecord) (*RRSet, error) {
+	set, value, err := rrsetWithValue(zoneId, name, recordType, value)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, record := range set.Records {
+		if record == value {
+			return nil, errors.New(set.Type + " " + set.Name + ": value " + value.Value + " is already in the RRset")
+		}
+	}
+	set.Records = append(set.Records, value)
+
+	return set, nil
+}
+
+// RRSetRemoveValue returns the RRset without the value, error with RECORD_NOT_FOUND_MESSAGE is returned if
+// the RRset doesn't have it. RRset without the last value is empty.
+func RRSetRemoveValue(zoneId uint, name string, recordType string, value RRSetRecord) (*RRSet, error) {
+	set, value, err := rrsetWithValue(zoneId, name, recordType, value)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []RRSetRecord{}
+	for _, record := range set.Records {
+		if record != value {
+			records = append(records, record)
+		}
+	}
+	if len(records) == len(set.Records) {
+		return nil, errors.New(RECORD_NOT_FOUND_MESSAGE)
+	}
+	set.Records = records
+
+	return set, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReplaceRRSet(t *testing.T) {
+	zone, errs := NewZone("AF-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	kept, errs := NewRecord(zone.ID, "www", 300, "A", 0, "1.2.3.4")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(zone.ID, "www", 600, "A", 0, "1.2.3.5")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(zone.ID, "www", 300, "AAAA", 0, "2001:db8::1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	sets, err := GetRRSets(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 2 || sets[0].Type != "A" || sets[0].TTL != 300 || len(sets[0].Records) != 2 {
+		t.Error("Unexpected RRsets", sets)
+	}
+
+	// Round-robin set is replaced as a whole, the unchanged record keeps its ID
+	set, errs := ReplaceRRSet(zone.ID, RRSet{Name: "WWW", Type: "a", TTL: 300, Records: []RRSetRecord{
+		{Value: "1.2.3.4"},
+		{Value: "1.2.3.6"},
+		{Value: "1.2.3.7"},
+	}})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if set.Name != "www" || set.TTL != 300 || len(set.Records) != 3 {
+		t.Error("Unexpected RRset", set)
+	}
+
+	var records []Record
+	err = GetDatabaseConnection().Where("zone_id = ? AND type = ?", zone.ID, "A").Find(&records).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	keptID := false
+	for _, record := range records {
+		keptID = keptID || (record.ID == kept.ID && record.Value == "1.2.3.4")
+	}
+	if len(records) != 3 || !keptID {
+		t.Error("Unexpected records", records)
+	}
+
+	// Invalid set changes nothing
+	_, errs = ReplaceRRSet(zone.ID, RRSet{Name: "www", Type: "A", TTL: 300, Records: []RRSetRecord{{Value: "1.2.3.8"}, {Value: "nonsense"}}})
+	if len(errs) == 0 {
+		t.Error("Invalid RRset was saved")
+	}
+	set, err = GetRRSet(zone.ID, "www", "A")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Records) != 3 {
+		t.Error("Invalid RRset changed records", set)
+	}
+
+	// Empty set is deleted
+	set, errs = ReplaceRRSet(zone.ID, RRSet{Name: "www", Type: "A"})
+	if len(errs) != 0 || set != nil {
+		t.Fatal("RRset wasn't deleted", errs, set)
+	}
+	if _, err := GetRRSet(zone.ID, "www", "A"); err == nil || err.Error() != RECORD_NOT_FOUND_MESSAGE {
+		t.Error("Deleted RRset still exists", err)
+	}
+	if set, err := GetRRSet(zone.ID, "www", "AAAA"); err != nil || len(set.Records) != 1 {
+		t.Error("Other RRset was changed", set, err)
+	}
+}
+
+func TestRRSetValues(t *testing.T) {
+	zone, errs := NewZone("CA-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	// Values quoted as multiple strings are joined
+	_, errs = NewRecord(zone.ID, "@", 3600, "TXT", 0, `"v=spf1 include:_spf.example.net" " -all"`)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	values := []string{"google-site-verification=token", strings.Repeat("k", 300)}
+	for _, value := range values {
+		set, err := RRSetAddValue(zone.ID, "@", "txt", RRSetRecord{Value: value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, errs := ReplaceRRSet(zone.ID, *set); len(errs) != 0 {
+			t.Fatal(errs)
+		}
+	}
+	set, err := GetRRSet(zone.ID, "@", "TXT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := false
+	for _, record := range set.Records {
+		joined = joined || record.Value == "v=spf1 include:_spf.example.net -all"
+	}
+	if len(set.Records) != 3 || set.TTL != 3600 || !joined {
+		t.Error("Unexpected RRset", set)
+	}
+	if _, err := RRSetAddValue(zone.ID, "@", "TXT", RRSetRecord{Value: values[0]}); err == nil {
+		t.Error("Duplicate value was added")
+	}
+
+	// Every value is one record, long values are split into strings
+	zone, _ = GetStore().GetZone(zone.ID)
+	rendered := zone.Render()
+	if !strings.Contains(rendered, `("google-site-verification=token")`) ||
+		!strings.Contains(rendered, `("`+strings.Repeat("k", 254)+`"`+"\n        "+`"`+strings.Repeat("k", 46)+`")`) {
+		t.Error("Unexpected rendering", rendered)
+	}
+
+	set, err = RRSetRemoveValue(zone.ID, "@", "TXT", RRSetRecord{Value: `"google-site-verification=token"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, errs := ReplaceRRSet(zone.ID, *set); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if set, err := GetRRSet(zone.ID, "@", "TXT"); err != nil || len(set.Records) != 2 {
+		t.Error("Value wasn't removed", set, err)
+	}
+	if _, err := RRSetRemoveValue(zone.ID, "@", "TXT", RRSetRecord{Value: "missing"}); err == nil || err.Error() != RECORD_NOT_FOUND_MESSAGE {
+		t.Error("Missing value was removed", err)
+	}
+
+	// New RRset gets the default TTL
+	set, err = RRSetAddValue(zone.ID, "_acme-challenge", "TXT", RRSetRecord{Value: "challenge"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.TTL != zone.TypeTTL("TXT") || len(set.Records) != 1 {
+		t.Error("Unexpected new RRset", set)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Number of generated hosts in the big seed zone
+const SeedBigZoneSize = 500
+
+// seedRecord is one record of a seed zone
+type seedRecord struct {
+	Name  string
+	TTL   int
+	Type  string
+	Prio  int
+	Value string
+}
+
+// seedZone describes a zone created by the seed command
+type seedZone struct {
+	Domain     string
+	Tags       []string
+	AbuseEmail string
+	DNSSEC     bool
+	Records    []seedRecord
+}
+
+// Returns zones used to populate development databases
+func seedZones() []seedZone {
+	zones := []seedZone{
+		{
+			Domain: "example-shop.test",
+			Tags:   []string{"seed", "shop"},
+			Records: []seedRecord{
+				{"@", 3600, "A", 0, "192.0.2.10"},
+				{"@", 3600, "AAAA", 0, "2001:db8::10"},
+				{"www", 3600, "CNAME", 0, "@"},
+				{"static", 300, "A", 0, "192.0.2.11"},
+				{"static", 300, "AAAA", 0, "2001:db8::11"},
+				{"@", 3600, "MX", 10, "mx1.example-shop.test."},
+				{"@", 3600, "MX", 20, "mx2.example-shop.test."},
+				{"mx1", 3600, "A", 0, "192.0.2.25"},
+				{"mx2", 3600, "A", 0, "192.0.2.26"},
+				{"@", 3600, "TXT", 0, "v=spf1 mx ip4:192.0.2.0/24 -all"},
+				{"_dmarc", 3600, "TXT", 0, "v=DMARC1; p=quarantine; rua=mailto:dmarc@example-shop.test"},
+				{"mail._domainkey", 3600, "TXT", 0, "v=DKIM1; k=rsa; p=MIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAu5aJbVKtGmBiaXmRKYBNvfF8vz7w4ctl3aq8GTGHh07+Mq4VykqEvT3INkdHRAaRaWWOyqjKJhU8Y4Zz2yvWqRkZJTWbRsLLTLVVJwI3Qg7Ld0D7VgW4BeQdpzvzyF3cC3iV3A9uPeSxCLBv3kvMDpxW8cVsPeCc2ae9PdsTBDWm5TpDA0Rcj2SECTwfKmrq1RkYf9Y0OuqjQhKzPJhEuIAaJcNXzUJfBBnd4AhkpEkbm0+L0ykR2tp6dAFfCYRbaiAFW6tUg7MJXZ2kgHwXjSnPTH3OWwrItbB/q3H7oZPMjG+uu/V7MbONsuGrk3+S2y9TxwuKfbXgYEtnsU1mwIDAQAB"},
+			},
+		},
+		{
+			Domain:     "dev-agency.test",
+			Tags:       []string{"seed"},
+			AbuseEmail: "hostmaster@dev-agency.test",
+			Records: []seedRecord{
+				{"@", 600, "A", 0, "198.51.100.1"},
+				{"api", 60, "A", 0, "198.51.100.2"},
+				{"api", 60, "A", 0, "198.51.100.3"},
+				{"ipv6only", 600, "AAAA", 0, "2001:db8:100::1"},
+				{"blog", 3600, "CNAME", 0, "hosting.example.net."},
+				{"docs", 3600, "CNAME", 0, "@"},
+				{"@", 3600, "MX", 10, "mail.example.net."},
+				{"@", 3600, "TXT", 0, "google-site-verification=seed-verification-token"},
+			},
+		},
+		{
+			Domain: "signed-bank.test",
+			Tags:   []string{"seed", "dnssec"},
+			DNSSEC: true,
+			Records: []seedRecord{
+				{"@", 3600, "A", 0, "203.0.113.5"},
+				{"@", 3600, "AAAA", 0, "2001:db8:200::5"},
+				{"www", 3600, "CNAME", 0, "@"},
+				{"@", 3600, "MX", 5, "mx.signed-bank.test."},
+				{"mx", 3600, "A", 0, "203.0.113.25"},
+				{"@", 3600, "TXT", 0, "v=spf1 mx -all"},
+			},
+		},
+	}
+
+	// Big zone for testing of pagination and rendering performance
+	bigZone := seedZone{
+		Domain: "big-hosting.test",
+		Tags:   []string{"seed", "big"},
+		Records: []seedRecord{
+			{"@", 3600, "A", 0, "192.0.2.100"},
+			{"@", 3600, "MX", 10, "mx.big-hosting.test."},
+			{"mx", 3600, "A", 0, "192.0.2.101"},
+		},
+	}
+	for i := 1; i <= SeedBigZoneSize; i++ {
+		name := fmt.Sprintf("host%03d", i)
+		bigZone.Records = append(bigZone.Records,
+			seedRecord{name, 300, "A", 0, "10.0." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256)},
+		)
+		if i%5 == 0 {
+			bigZone.Records = append(bigZone.Records,
+				seedRecord{"www." + name, 300, "CNAME", 0, name},
+			)
+		}
+	}
+	zones = append(zones, bigZone)
+
+	return zones
+}
+
+// Seed populates the database with realistic zones for development. Zones that already exist are skipped.
+func Seed() error {
+	db := GetDatabaseConnection()
+
+	for _, seed := range seedZones() {
+		var count int
+		err := db.Model(&Zone{}).Where("domain = ?", seed.Domain).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			log.Println("Zone " + seed.Domain + " already exists, skipping")
+			continue
+		}
+
+		zone, errs := NewZone(seed.Domain, seed.Tags, seed.AbuseEmail)
+		if len(errs) > 0 {
+			return errs[0]
+		}
+
+		if seed.DNSSEC {
+			err = db.Model(zone).Update("dnssec", true).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		err = seedRecords(db, zone, seed.Records)
+		if err != nil {
+			return err
+		}
+
+		log.Println("Zone " + seed.Domain + " created with " + strconv.Itoa(len(seed.Records)) + " records")
+	}
+
+	return nil
+}
+
+// Validates and saves all records of one seed zone in single transaction
+func seedRecords(db *gorm.DB, zone *Zone, records []seedRecord) error {
+	for _, record := range records {
+		zone.Records = append(zone.Records, Record{
+			ZoneId: zone.ID,
+			Name:   record.Name,
+			TTL:    record.TTL,
+			Type:   record.Type,
+			Prio:   record.Prio,
+			Value:  record.Value,
+		})
+	}
+
+	errs := zone.Validate()
+	if len(errs) > 0 {
+		return errs[0]
+	}
+
+	tx := db.Begin()
+	for _, record := range zone.Records {
+		err := tx.Create(&record).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
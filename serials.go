@@ -0,0 +1,207 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// Formats of new serials
+const (
+	SerialFormatDate     = "date"     // YYYYMMDDnn, nn counts serials of the day (UTC)
+	SerialFormatUnixTime = "unixtime" // Seconds since 1970-01-01 (UTC)
+)
+
+// Date serial is YYYYMMDDnn, so a zone can get at most 99 new serials in one day (UTC)
+const MaxDailySerialBumps = 99
+
+// What happens with commits of zones with too many serial bumps today
+const (
+	SerialLimitBatch  = "batch"  // Commits are queued and deployed together once per DNSAPI_SERIAL_BATCH_INTERVAL
+	SerialLimitReject = "reject" // Commits are refused until the next day
+)
+
+var ErrSerialBatched = errors.New("too many serial bumps today, commit is queued and deployed with the next batch")
+var ErrSerialLimit = errors.New("daily limit of serial bumps of the zone is reached, the zone can be committed again tomorrow (UTC)")
+
+// SerialBumpsToday returns how many serials the zone got today (UTC), unix time serials aren't counted
+func (z *Zone) SerialBumpsToday(now time.Time) int {
+	if config.SerialFormat == SerialFormatUnixTime || len(z.Serial) != 10 || z.Serial[0:8] != now.UTC().Format("20060102") {
+		return 0
+	}
+
+	number, err := strconv.Atoi(z.Serial[8:10])
+	if err != nil {
+		return 0
+	}
+	return number
+}
+
+// Checks whether the zone can get a new serial now. Above DNSAPI_SERIAL_SOFT_LIMIT bumps a day the commit
+// is queued until the batch interval since the last bump passes (override skips it) or rejected; the last
+// serial of the day is never exceeded.
+func checkSerialLimit(zone *Zone, now time.Time, override bool) error {
+	bumps := zone.SerialBumpsToday(now)
+	exhausted := bumps >= MaxDailySerialBumps
+	if !exhausted && (config.SerialSoftLimit <= 0 || bumps < config.SerialSoftLimit || override) {
+		return nil
+	}
+
+	if config.SerialLimitAction == SerialLimitReject {
+		return ErrSerialLimit
+	}
+
+	interval := time.Duration(config.SerialBatchInterval) * time.Second
+	if !exhausted && (zone.SerialBumpedAt == nil || now.Sub(*zone.SerialBumpedAt) >= interval) {
+		return nil
+	}
+
+	err := setZoneDeployState(zone.ID, DeployStateQueued, nil)
+	if err != nil {
+		return err
+	}
+	return ErrSerialBatched
+}
+
+// ValidateSerialLimitAction checks value of DNSAPI_SERIAL_LIMIT_ACTION, empty means batch
+func ValidateSerialLimitAction(action string) error {
+	if action != "" && action != SerialLimitBatch && action != SerialLimitReject {
+		return errors.New("has to be " + SerialLimitBatch + " or " + SerialLimitReject)
+	}
+	return nil
+}
+
+// ValidateSerialFormat checks value of DNSAPI_SERIAL_FORMAT, empty means date
+func ValidateSerialFormat(format string) error {
+	if format != "" && format != SerialFormatDate && format != SerialFormatUnixTime {
+		return errors.New("has to be " + SerialFormatDate + " or " + SerialFormatUnixTime)
+	}
+	return nil
+}
+
+// Unix time serial following the current one. Current serial which isn't older than the time, ex. a date
+// serial from before the switch of the format or a serial of a commit in the same second, is incremented.
+func unixTimeSerial(current string, now time.Time) string {
+	serial := uint32(now.Unix())
+	if number, err := strconv.ParseUint(current, 10, 32); err == nil && !serialNewer(serial, uint32(number)) {
+		serial = uint32(number) + 1
+	}
+	return strconv.FormatUint(uint64(serial), 10)
+}
+
+// Timeout of SOA query of one name server for its live serial
+const SerialQueryTimeout = 2 * time.Second
+
+// SerialResolver returns serial of the commit. It gets the serial computed from the zone's serial and
+// serials served by name servers by their address, unreachable servers are missing.
+type SerialResolver func(zone *Zone, next string, live map[string]uint32) (string, error)
+
+// Resolver used by commits when DNSAPI_SERIAL_CHECK is enabled, set by SetSerialResolver before the server starts
+var serialResolver SerialResolver = newerThanLiveSerial
+
+// SetSerialResolver replaces the default resolver, ex. by one keeping serials of another environment apart
+func SetSerialResolver(resolver SerialResolver) {
+	serialResolver = resolver
+}
+
+// True if serial a is newer than b in serial number arithmetic, RFC 1982
+func serialNewer(a uint32, b uint32) bool {
+	return a != b && int32(a-b) > 0
+}
+
+// The default resolver keeps the computed serial if it's newer than all live serials,
+// otherwise the newest live serial plus one is used
+func newerThanLiveSerial(zone *Zone, next string, live map[string]uint32) (string, error) {
+	serial, err := strconv.ParseUint(next, 10, 32)
+	if err != nil {
+		return "", errors.Wrap(err, "serial "+next)
+	}
+
+	newest := uint32(serial)
+	conflict := false
+	for server, liveSerial := range live {
+		if !serialNewer(newest, liveSerial) {
+			log.Warnf("serial %s of %s is not newer than live serial %d on %s", next, zone.Domain, liveSerial, server)
+			newest = liveSerial
+			conflict = true
+		}
+	}
+	if !conflict {
+		return next, nil
+	}
+
+	return strconv.FormatUint(uint64(newest+1), 10), nil
+}
+
+// LiveSerials asks the primary of zone's pool and all secondaries for the zone's SOA. Servers which don't
+// answer or don't have the zone are left out.
+func LiveSerials(zone *Zone) map[string]uint32 {
+	servers := []string{config.PrimaryNameServerIP}
+	if zone.Pool != "" {
+		servers = []string{PoolPrimaryNameServer(zone.Pool)}
+	}
+	servers = append(servers, SecondaryNameServerAddresses()...)
+
+	message := new(dns.Msg)
+	message.SetQuestion(dns.Fqdn(zone.Domain), dns.TypeSOA)
+	client := dns.Client{Timeout: SerialQueryTimeout}
+
+	live := make(map[string]uint32)
+	for _, server := range servers {
+		if server == "" {
+			continue
+		}
+		address := server
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			address = net.JoinHostPort(server, "53")
+		}
+
+		response, _, err := client.Exchange(message, address)
+		if err != nil || response.Rcode != dns.RcodeSuccess {
+			continue
+		}
+		for _, rr := range response.Answer {
+			if soa, ok := rr.(*dns.SOA); ok {
+				live[server] = soa.Serial
+			}
+		}
+	}
+
+	return live
+}
+
+// SetNextSerial sets the serial used by the next commit of the zone as it is, without the check of live serials.
+// It's the explicit way to move the serial back, secondaries ignore such zone until they are resynced.
+// Empty serial clears it.
+func SetNextSerial(zoneId uint, serial string) (*Zone, []error) {
+	var zone Zone
+
+	if serial != "" {
+		if _, err := strconv.ParseUint(serial, 10, 32); err != nil {
+			return nil, []error{errors.New("serial has to be number between 0 and 4294967295")}
+		}
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Model(&Zone{}).Where("id = ?", zone.ID).Update("next_serial", serial).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+	Audit("zone.next_serial_set", &zone, zone.Serial+" -> "+serial)
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
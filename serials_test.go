@@ -0,0 +1,193 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommitZone_serialLimit(t *testing.T) {
+	config.SkipDeploy = true
+	config.SerialSoftLimit = 80
+	config.SerialBatchInterval = 900
+	defer func() {
+		config.SkipDeploy = false
+		config.SerialSoftLimit = 0
+		config.SerialBatchInterval = 0
+		config.SerialLimitAction = ""
+	}()
+
+	zone, errs := NewZone("AL-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	db := GetDatabaseConnection()
+	today := time.Now().UTC().Format("20060102")
+	setSerial := func(serial string, bumpedAt time.Time) {
+		err := db.Model(zone).Updates(map[string]interface{}{"serial": serial, "serial_bumped_at": bumpedAt}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	reload := func() *Zone {
+		var reloaded Zone
+		err := db.Where("id = ?", zone.ID).Find(&reloaded).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &reloaded
+	}
+
+	assert.Equal(t, 0, (&Zone{Serial: "2018053005"}).SerialBumpsToday(time.Now()))
+	assert.Equal(t, 5, (&Zone{Serial: today + "05"}).SerialBumpsToday(time.Now()))
+
+	// Below the soft limit
+	setSerial(today+"79", time.Now())
+	assert.Nil(t, CommitZone(zone.ID, false))
+	assert.Equal(t, today+"80", reload().Serial)
+
+	// Above the soft limit the bump waits for the batch interval
+	assert.Equal(t, ErrSerialBatched, CommitZone(zone.ID, false))
+	assert.Equal(t, DeployStateQueued, reload().DeployState)
+	assert.Equal(t, today+"80", reload().Serial)
+
+	assert.Nil(t, CommitZone(zone.ID, true))
+	assert.Equal(t, today+"81", reload().Serial)
+
+	setSerial(today+"81", time.Now().Add(-time.Hour))
+	assert.Nil(t, CommitZone(zone.ID, false))
+	assert.Equal(t, today+"82", reload().Serial)
+
+	// The last serial of the day is never exceeded
+	setSerial(today+"99", time.Now().Add(-time.Hour))
+	assert.Equal(t, ErrSerialBatched, CommitZone(zone.ID, true))
+	assert.Equal(t, today+"99", reload().Serial)
+
+	config.SerialLimitAction = SerialLimitReject
+	assert.Equal(t, ErrSerialLimit, CommitZone(zone.ID, false))
+	setSerial(today+"85", time.Now().Add(-time.Hour))
+	assert.Equal(t, ErrSerialLimit, CommitZone(zone.ID, false))
+
+	config.SerialSoftLimit = 0
+	assert.Nil(t, CommitZone(zone.ID, false))
+	assert.Equal(t, today+"86", reload().Serial)
+}
+
+func TestNewerThanLiveSerial(t *testing.T) {
+	zone := &Zone{Domain: "bm-" + TEST_DOMAIN}
+
+	serial, err := newerThanLiveSerial(zone, "2020010102", map[string]uint32{"192.0.2.1": 2020010101})
+	assert.NoError(t, err)
+	assert.Equal(t, "2020010102", serial)
+
+	// Restored zone got older serial than the secondaries serve
+	serial, err = newerThanLiveSerial(zone, "2020010102", map[string]uint32{"192.0.2.1": 2020010101, "192.0.2.2": 2020060105})
+	assert.NoError(t, err)
+	assert.Equal(t, "2020060106", serial)
+	serial, err = newerThanLiveSerial(zone, "2020010102", map[string]uint32{"192.0.2.1": 2020010102})
+	assert.NoError(t, err)
+	assert.Equal(t, "2020010103", serial)
+
+	// Serial arithmetic wraps around
+	serial, err = newerThanLiveSerial(zone, "5", map[string]uint32{"192.0.2.1": 4294967290})
+	assert.NoError(t, err)
+	assert.Equal(t, "5", serial)
+
+	_, err = newerThanLiveSerial(zone, "not a serial", nil)
+	assert.Error(t, err)
+}
+
+func TestZone_SetNewSerialUnixTime(t *testing.T) {
+	config.SerialFormat = SerialFormatUnixTime
+	defer func() {
+		config.SerialFormat = ""
+	}()
+	now := time.Date(2026, 10, 14, 8, 30, 0, 0, time.UTC)
+
+	var zone Zone
+	zone.setSerialAt(now)
+	assert.Equal(t, "1791966600", zone.Serial)
+	zone.setSerialAt(now.Add(time.Minute))
+	assert.Equal(t, "1791966660", zone.Serial)
+
+	// Commit in the same second
+	zone.setSerialAt(now.Add(time.Minute))
+	assert.Equal(t, "1791966661", zone.Serial)
+
+	// Date serials are newer than unix time, they are incremented until the time catches up
+	zone.Serial = "2026101405"
+	zone.setSerialAt(now)
+	assert.Equal(t, "2026101406", zone.Serial)
+	assert.Equal(t, 0, zone.SerialBumpsToday(now))
+
+	assert.NoError(t, ValidateSerialFormat(SerialFormatDate))
+	assert.Error(t, ValidateSerialFormat("epoch"))
+}
+
+func TestLiveSerials(t *testing.T) {
+	domain := "bm-" + TEST_DOMAIN
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &dns.Server{
+		PacketConn: conn,
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, request *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetReply(request)
+			soa, _ := dns.NewRR(dns.Fqdn(domain) + " 300 IN SOA ns1.rosti.cz. cx.initd.cz. 2030010101 300 180 604800 60")
+			response.Answer = append(response.Answer, soa)
+			w.WriteMsg(response)
+		}),
+	}
+	go server.ActivateAndServe()
+	defer server.Shutdown()
+
+	primaryIP := config.PrimaryNameServerIP
+	secondaryIPs := config.SecondaryNameServerIPs
+	config.PrimaryNameServerIP = conn.LocalAddr().String()
+	config.SecondaryNameServerIPs = []string{"127.0.0.1:1"}
+	defer func() {
+		config.PrimaryNameServerIP = primaryIP
+		config.SecondaryNameServerIPs = secondaryIPs
+	}()
+
+	live := LiveSerials(&Zone{Domain: domain})
+	assert.Equal(t, map[string]uint32{conn.LocalAddr().String(): 2030010101}, live)
+}
+
+func TestSetNextSerial(t *testing.T) {
+	config.SkipDeploy = true
+	defer func() {
+		config.SkipDeploy = false
+	}()
+
+	zone, errs := NewZone("BM-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	_, errs = SetNextSerial(zone.ID, "-1")
+	assert.Len(t, errs, 1)
+
+	updated, errs := SetNextSerial(zone.ID, "2001010101")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "2001010101", updated.NextSerial)
+
+	// The next commit uses the serial as it is, the following one continues normally
+	assert.Nil(t, CommitZone(zone.ID, false))
+	updated, _ = GetStore().GetZone(zone.ID)
+	assert.Equal(t, "2001010101", updated.Serial)
+	assert.Equal(t, "", updated.NextSerial)
+	assert.Nil(t, CommitZone(zone.ID, false))
+	updated, _ = GetStore().GetZone(zone.ID)
+	assert.Equal(t, time.Now().UTC().Format("20060102")+"01", updated.Serial)
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Setting is one runtime setting saved in the database, its value is JSON encoded
+type Setting struct {
+	Key       string    `json:"key" gorm:"primary_key"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Value     string    `json:"value"`
+}
+
+// RuntimeSettings are parts of the configuration which can be changed through the admin API without restart.
+// Values saved in the database override the environment.
+type RuntimeSettings struct {
+	TimeToRefresh int      `json:"time_to_refresh" yaml:"time_to_refresh"`
+	TimeToRetry   int      `json:"time_to_retry" yaml:"time_to_retry"`
+	TimeToExpire  int      `json:"time_to_expire" yaml:"time_to_expire"`
+	MinimalTTL    int      `json:"minimal_ttl" yaml:"minimal_ttl"`
+	TTL           int      `json:"ttl" yaml:"ttl"`
+	AbuseEmail    string   `json:"abuse_email" yaml:"abuse_email"`
+	NameServers   []string `json:"name_servers" yaml:"name_servers"`
+	WebhookURL    string   `json:"webhook_url" yaml:"webhook_url"`
+	SMTPFrom      string   `json:"smtp_from" yaml:"smtp_from"`
+	ReservedNames []string `json:"reserved_names" yaml:"reserved_names"`
+}
+
+// Guards runtime settings in the configuration. Requests hold it for reading (SettingsMiddleware), updates of
+// the settings for writing.
+var settingsLock sync.RWMutex
+
+// Requests which update runtime settings, they take the lock for writing themselves
+var settingsWriters = map[string]bool{
+	"PUT /admin/settings":  true,
+	"PUT /admin/inventory": true,
+}
+
+// Settings whose values aren't written into the audit log, ex. webhook URL can contain credentials
+var secretSettings = map[string]bool{
+	"webhook_url": true,
+}
+
+// CurrentRuntimeSettings returns runtime settings as they are used right now
+func CurrentRuntimeSettings() RuntimeSettings {
+	return RuntimeSettings{
+		TimeToRefresh: config.TimeToRefresh,
+		TimeToRetry:   config.TimeToRetry,
+		TimeToExpire:  config.TimeToExpire,
+		MinimalTTL:    config.MinimalTTL,
+		TTL:           config.TTL,
+		AbuseEmail:    config.AbuseEmail,
+		NameServers:   append([]string{}, config.NameServers...),
+		WebhookURL:    config.WebhookURL,
+		SMTPFrom:      config.SMTPFrom,
+		ReservedNames: append([]string{}, config.ReservedNames...),
+	}
+}
+
+// Writes the settings into the configuration
+func (s *RuntimeSettings) apply(c *Config) {
+	c.TimeToRefresh = s.TimeToRefresh
+	c.TimeToRetry = s.TimeToRetry
+	c.TimeToExpire = s.TimeToExpire
+	c.MinimalTTL = s.MinimalTTL
+	c.TTL = s.TTL
+	c.AbuseEmail = s.AbuseEmail
+	c.NameServers = append([]string{}, s.NameServers...)
+	c.WebhookURL = s.WebhookURL
+	c.SMTPFrom = s.SMTPFrom
+	c.ReservedNames = append([]string{}, s.ReservedNames...)
+}
+
+// Validates the settings together with the rest of the configuration
+func (s *RuntimeSettings) Validate() []error {
+	var errorsMsgs []error
+
+	for name, value := range map[string]int{
+		"time_to_refresh": s.TimeToRefresh,
+		"time_to_retry":   s.TimeToRetry,
+		"time_to_expire":  s.TimeToExpire,
+	} {
+		if value <= 0 {
+			errorsMsgs = append(errorsMsgs, errors.New(name+" has to be bigger than 0"))
+		}
+	}
+	if s.TimeToExpire < s.TimeToRefresh+s.TimeToRetry {
+		errorsMsgs = append(errorsMsgs, errors.New("time_to_expire has to be longer than time_to_refresh and time_to_retry"))
+	}
+	if s.MinimalTTL < 0 || s.MinimalTTL > MaxNegativeTTL {
+		errorsMsgs = append(errorsMsgs, errors.New("minimal_ttl has to be between 0 and 86400"))
+	}
+	if s.TTL < 0 || s.TTL > 2592000 {
+		errorsMsgs = append(errorsMsgs, errors.New("ttl has to be between 0 and 2592000"))
+	}
+	if s.WebhookURL != "" && !strings.HasPrefix(s.WebhookURL, "http://") && !strings.HasPrefix(s.WebhookURL, "https://") {
+		errorsMsgs = append(errorsMsgs, errors.New("webhook_url has to be http or https URL"))
+	}
+
+	updated := config
+	s.apply(&updated)
+	err := updated.Validate()
+	if err != nil {
+		errorsMsgs = append(errorsMsgs, err)
+	}
+
+	return errorsMsgs
+}
+
+// Converts the settings into map of JSON encoded values by their keys
+func (s *RuntimeSettings) values() map[string]string {
+	var raw map[string]json.RawMessage
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		panic(err)
+	}
+
+	values := make(map[string]string)
+	for key, value := range raw {
+		values[key] = string(value)
+	}
+	return values
+}
+
+// Returns JSON encoded values of the settings which differ from the other settings
+func (s *RuntimeSettings) changedFrom(other RuntimeSettings) map[string]json.RawMessage {
+	changes := make(map[string]json.RawMessage)
+	otherValues := other.values()
+	for key, value := range s.values() {
+		if otherValues[key] != value {
+			changes[key] = json.RawMessage(value)
+		}
+	}
+	return changes
+}
+
+// Describes changes of the settings for the audit log, values of secret settings are masked
+func settingsChanges(old RuntimeSettings, updated RuntimeSettings, keys []string) string {
+	var changes []string
+	oldValues, updatedValues := old.values(), updated.values()
+	for _, key := range keys {
+		if secretSettings[key] {
+			changes = append(changes, key+": (secret) -> (secret)")
+			continue
+		}
+		changes = append(changes, key+": "+oldValues[key]+" -> "+updatedValues[key])
+	}
+	return strings.Join(changes, ", ")
+}
+
+// LoadRuntimeSettings applies settings saved in the database on the configuration, it's called on startup
+func LoadRuntimeSettings() error {
+	var settings []Setting
+
+	db := GetDatabaseConnection()
+	err := db.Find(&settings).Error
+	if err != nil {
+		return err
+	}
+	if len(settings) == 0 {
+		return nil
+	}
+
+	raw := make(map[string]json.RawMessage)
+	for _, setting := range settings {
+		raw[setting.Key] = json.RawMessage(setting.Value)
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return err
+	}
+
+	runtimeSettings := CurrentRuntimeSettings()
+	err = json.Unmarshal(data, &runtimeSettings)
+	if err != nil {
+		return errors.Wrap(err, "runtime settings")
+	}
+	settingsLock.Lock()
+	runtimeSettings.apply(&config)
+	settingsLock.Unlock()
+
+	return nil
+}
+
+// Returns active zones whose rendered files depend on the changed settings
+func zonesAffectedBySettings(old RuntimeSettings, updated RuntimeSettings) ([]Zone, error) {
+	var zones []Zone
+
+	db := GetDatabaseConnection()
+	query := activeZones(db)
+
+	allZones := old.TimeToRefresh != updated.TimeToRefresh ||
+		old.TimeToRetry != updated.TimeToRetry ||
+		old.TimeToExpire != updated.TimeToExpire ||
+		strings.Join(old.NameServers, ",") != strings.Join(updated.NameServers, ",") ||
+		old.TTL != updated.TTL
+
+	// Zones with their own values don't use the global ones
+	var conditions []string
+	if old.AbuseEmail != updated.AbuseEmail {
+		conditions = append(conditions, "abuse_email = ''")
+	}
+	if old.MinimalTTL != updated.MinimalTTL {
+		conditions = append(conditions, "minimum_ttl = 0")
+	}
+
+	if !allZones {
+		if len(conditions) == 0 {
+			return zones, nil
+		}
+		query = query.Where(strings.Join(conditions, " OR "))
+	}
+
+	err := query.Order("id").Find(&zones).Error
+	return zones, err
+}
+
+// UpdateRuntimeSettings changes the settings given by their keys, saves only them, applies them and commits all
+// affected zones so they are rendered with the new values. Other settings keep coming from the environment.
+// IDs of the affected zones are returned.
+func UpdateRuntimeSettings(changes map[string]json.RawMessage) (*RuntimeSettings, []uint, []error) {
+	settingsLock.Lock()
+	old := CurrentRuntimeSettings()
+
+	var keys []string
+	known := old.values()
+	for key := range changes {
+		if _, ok := known[key]; !ok {
+			settingsLock.Unlock()
+			return nil, nil, []error{errors.New("unknown setting " + key)}
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	settings := old
+	data, err := json.Marshal(changes)
+	if err == nil {
+		err = json.Unmarshal(data, &settings)
+	}
+	if err != nil {
+		settingsLock.Unlock()
+		return nil, nil, []error{errors.Wrap(err, "runtime settings")}
+	}
+
+	errs := settings.Validate()
+	if len(errs) > 0 {
+		settingsLock.Unlock()
+		return nil, nil, errs
+	}
+
+	zones, err := zonesAffectedBySettings(old, settings)
+	if err != nil {
+		settingsLock.Unlock()
+		return nil, nil, []error{err}
+	}
+
+	db := GetDatabaseConnection()
+	tx := db.Begin()
+	values := settings.values()
+	for _, key := range keys {
+		err = tx.Save(&Setting{Key: key, Value: values[key]}).Error
+		if err != nil {
+			tx.Rollback()
+			settingsLock.Unlock()
+			return nil, nil, []error{err}
+		}
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		settingsLock.Unlock()
+		return nil, nil, []error{err}
+	}
+
+	settings.apply(&config)
+	settingsLock.Unlock()
+	Audit("config.updated", nil, settingsChanges(old, settings, keys))
+
+	affected := []uint{}
+	for _, zone := range zones {
+		affected = append(affected, zone.ID)
+	}
+
+	// Deployment itself runs in background
+	settingsLock.RLock()
+	defer settingsLock.RUnlock()
+	for _, zone := range zones {
+		err := Commit(zone.ID)
+		if err != nil && err != ErrCommitQueued && err != ErrSerialBatched && err != ErrZoneFrozen {
+			log.Errorf("commit of " + zone.Domain + " after settings change: " + err.Error())
+		}
+	}
+
+	current := CurrentRuntimeSettings()
+	return &current, affected, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestUpdateRuntimeSettings(t *testing.T) {
+	config.SkipDeploy = true
+	config.DeployMode = DeployModeMonolithic
+	defer func() {
+		config.SkipDeploy = false
+		config.DeployMode = ""
+	}()
+
+	original := CurrentRuntimeSettings()
+	defer func() {
+		original.apply(&config)
+		GetDatabaseConnection().Delete(&Setting{})
+	}()
+
+	zone, errs := NewZone("X-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	_, _, errs = UpdateRuntimeSettings(map[string]json.RawMessage{"name_servers": json.RawMessage(`["ns1.rosti.cz"]`)})
+	if len(errs) == 0 {
+		t.Error("Settings with one name server passed")
+	}
+	_, _, errs = UpdateRuntimeSettings(map[string]json.RawMessage{"bogus": json.RawMessage(`1`)})
+	if len(errs) == 0 {
+		t.Error("Unknown setting passed")
+	}
+
+	config.TimeToRefresh = 300
+	updated, affected, errs := UpdateRuntimeSettings(map[string]json.RawMessage{
+		"time_to_refresh": json.RawMessage(`1200`),
+		"time_to_retry":   json.RawMessage(`180`),
+		"time_to_expire":  json.RawMessage(`604800`),
+	})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if updated.TimeToRefresh != 1200 || config.TimeToRefresh != 1200 {
+		t.Error("Settings were not applied", updated)
+	}
+
+	// Only the changed settings are saved, with their previous values in the audit log
+	var saved int
+	GetDatabaseConnection().Model(&Setting{}).Count(&saved)
+	if saved != 3 {
+		t.Error("Unexpected number of saved settings", saved)
+	}
+	var entry AuditEntry
+	GetDatabaseConnection().Where("action = ?", "config.updated").Order("id desc").First(&entry)
+	if !strings.Contains(entry.Message, "time_to_refresh: 300 -> 1200") {
+		t.Error("Change isn't in the audit log", entry.Message)
+	}
+
+	found := false
+	for _, zoneId := range affected {
+		found = found || zoneId == zone.ID
+	}
+	if !found {
+		t.Error("Zone is not affected by SOA change", affected)
+	}
+
+	err := GetDatabaseConnection().Where("id = ?", zone.ID).Find(zone).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zone.DeployState != DeployStateDeployed || !strings.Contains(zone.Render(), "\t\t1200\n") {
+		t.Error("Zone wasn't committed with the new settings", zone.DeployState, zone.Render())
+	}
+
+	// Webhook doesn't change any zone and its URL isn't logged
+	_, affected, errs = UpdateRuntimeSettings(map[string]json.RawMessage{"webhook_url": json.RawMessage(`"http://localhost:1/webhook"`)})
+	if len(errs) != 0 || len(affected) != 0 {
+		t.Error("Unexpected result", affected, errs)
+	}
+	entry = AuditEntry{}
+	GetDatabaseConnection().Where("action = ?", "config.updated").Order("id desc").First(&entry)
+	if strings.Contains(entry.Message, "localhost") || !strings.Contains(entry.Message, "webhook_url") {
+		t.Error("Secret setting isn't masked in the audit log", entry.Message)
+	}
+
+	// Saved settings override the environment
+	original.apply(&config)
+	err = LoadRuntimeSettings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.TimeToRefresh != 1200 || config.WebhookURL != "http://localhost:1/webhook" {
+		t.Error("Saved settings were not loaded", CurrentRuntimeSettings())
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Bounds of per-zone SOA refresh and retry (seconds)
+const (
+	MinSOATimer = 60
+	MaxSOATimer = 86400
+)
+
+// Bounds of per-zone SOA expire (seconds), RFC 1912 recommends two to four weeks
+const (
+	MinSOAExpire = 86400
+	MaxSOAExpire = 2419200
+)
+
+// RefreshTime returns SOA refresh of the zone, DNSAPI_TIME_TO_REFRESH if the zone has none
+func (z *Zone) RefreshTime() int {
+	if z.Refresh > 0 {
+		return z.Refresh
+	}
+	return config.TimeToRefresh
+}
+
+// RetryTime returns SOA retry of the zone, DNSAPI_TIME_TO_RETRY if the zone has none
+func (z *Zone) RetryTime() int {
+	if z.Retry > 0 {
+		return z.Retry
+	}
+	return config.TimeToRetry
+}
+
+// ExpireTime returns SOA expire of the zone, DNSAPI_TIME_TO_EXPIRE if the zone has none
+func (z *Zone) ExpireTime() int {
+	if z.Expire > 0 {
+		return z.Expire
+	}
+	return config.TimeToExpire
+}
+
+// Checks SOA timers of the zone, 0 means the configured one. Zones without own timers use the runtime
+// settings which are checked by themselves. Secondaries have to try to refresh at least once before
+// the zone expires.
+func validateSOATimers(z *Zone) error {
+	if z.Refresh == 0 && z.Retry == 0 && z.Expire == 0 {
+		return nil
+	}
+
+	for _, timer := range []int{z.Refresh, z.Retry} {
+		if timer != 0 && (timer < MinSOATimer || timer > MaxSOATimer) {
+			return errors.New("refresh and retry have to be 0 or number between " + strconv.Itoa(MinSOATimer) + " and " + strconv.Itoa(MaxSOATimer))
+		}
+	}
+	if z.Expire != 0 && (z.Expire < MinSOAExpire || z.Expire > MaxSOAExpire) {
+		return errors.New("expire has to be 0 or number between " + strconv.Itoa(MinSOAExpire) + " and " + strconv.Itoa(MaxSOAExpire))
+	}
+	if z.RefreshTime()+z.RetryTime() > z.ExpireTime() {
+		return errors.New("refresh and retry together (" + strconv.Itoa(z.RefreshTime()+z.RetryTime()) + ") can't be longer than expire (" + strconv.Itoa(z.ExpireTime()) + ")")
+	}
+	return nil
+}
+
+// SetZoneSOAExpire sets how long secondaries serve the zone without refreshing it, 0 for the configured one.
+// The zone has to be committed afterwards.
+func SetZoneSOAExpire(zoneId uint, expire int) (*Zone, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	zone.Expire = expire
+	err = validateSOATimers(&zone)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Model(&Zone{}).Where("id = ?", zoneId).Update("expire", expire).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	Audit("zone.soa_expire_changed", &zone, "expire "+strconv.Itoa(expire))
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetZoneSOATimers(t *testing.T) {
+	refresh, retry, expire, minimal := config.TimeToRefresh, config.TimeToRetry, config.TimeToExpire, config.MinimalTTL
+	config.TimeToRefresh = 300
+	config.TimeToRetry = 180
+	config.TimeToExpire = 604800
+	config.MinimalTTL = 600
+	defer func() {
+		config.TimeToRefresh = refresh
+		config.TimeToRetry = retry
+		config.TimeToExpire = expire
+		config.MinimalTTL = minimal
+	}()
+
+	zone, errs := NewZone("CB-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	_, errs = NewRecord(zone.ID, "short", 60, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	// Zone under migration is refreshed often and expires late
+	_, errs = SetZoneSOATimers(zone.ID, 120, 60)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	updated, errs := SetZoneSOAExpire(zone.ID, 1209600)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, 1209600, updated.ExpireTime())
+	updated, warnings, errs := SetZoneMinimumTTL(zone.ID, 120)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Contains(t, updated.Render(), "\n\t\t120\n\t\t60\n\t\t1209600\n\t\t120\n)")
+	assert.Len(t, warnings, 1, "Record with TTL lower than the minimum TTL")
+
+	// Unset timers fall back to the configuration
+	_, errs = SetZoneSOATimers(zone.ID, 0, 600)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = SetZoneSOAExpire(zone.ID, 0)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	updated, _, errs = SetZoneMinimumTTL(zone.ID, 0)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Contains(t, updated.Render(), "\n\t\t300\n\t\t600\n\t\t604800\n\t\t600\n)")
+
+	for _, expire := range []int{3600, 3000000} {
+		_, errs = SetZoneSOAExpire(zone.ID, expire)
+		assert.Len(t, errs, 1, expire)
+	}
+	_, errs = SetZoneSOAExpire(zone.ID, 86400)
+	assert.Len(t, errs, 0)
+	_, errs = SetZoneSOATimers(zone.ID, 86400, 3600)
+	assert.Len(t, errs, 1, "Refresh with retry longer than expire of the zone")
+	zone, _ = GetStore().GetZone(zone.ID)
+	assert.Equal(t, 600, zone.RetryTime(), "Invalid timers change nothing")
+	assert.Contains(t, zone.Render(), "\t\t300\n")
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// Days of commit statistics the SOA advisor looks at
+const SOAAdviceDays = 30
+
+// Operation of change requests proposed by the SOA advisor
+const ChangeOperationSOATimers = "soa_timers"
+
+// SOAAdvice is suggested SOA refresh and retry of the zone. Secondaries get NOTIFY after every commit, the
+// refresh is their fallback when NOTIFY is lost. Frequently changing zones should be refreshed soon,
+// static zones don't have to be asked that often.
+type SOAAdvice struct {
+	ZoneId             uint     `json:"zone_id"`
+	Domain             string   `json:"domain"`
+	CommitsPerDay      float64  `json:"commits_per_day"`     // Average of the last SOAAdviceDays days
+	LaggingSecondaries []string `json:"lagging_secondaries"` // Secondaries without the last serial
+	Refresh            int      `json:"refresh"`
+	Retry              int      `json:"retry"`
+	SuggestedRefresh   int      `json:"suggested_refresh"`
+	SuggestedRetry     int      `json:"suggested_retry"`
+	Reasons            []string `json:"reasons"`
+}
+
+// Changed tells whether the suggested timers differ from the current ones
+func (a *SOAAdvice) Changed() bool {
+	return a.Refresh != a.SuggestedRefresh || a.Retry != a.SuggestedRetry
+}
+
+// AdviseSOATimers suggests refresh and retry of the zone by its commits during the last SOAAdviceDays
+// days and secondaries which didn't get its last serial.
+func AdviseSOATimers(zoneId uint, now time.Time) (*SOAAdvice, error) {
+	var zone Zone
+	var stats []CommitStat
+	var deployments []ZoneDeployment
+
+	db := GetReadDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	since := now.UTC().AddDate(0, 0, -SOAAdviceDays+1).Format("2006-01-02")
+	err = db.Where("zone_id = ? AND day >= ?", zoneId, since).Find(&stats).Error
+	if err != nil {
+		return nil, err
+	}
+	commits := 0
+	for _, stat := range stats {
+		commits += stat.Commits
+	}
+
+	err = db.Where("zone_id = ? AND role = ? AND state <> ?", zoneId, DeploymentRoleSecondary, DeploymentStateDone).
+		Order("id").Find(&deployments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	advice := SOAAdvice{
+		ZoneId:             zone.ID,
+		Domain:             zone.Domain,
+		CommitsPerDay:      float64(commits) / SOAAdviceDays,
+		LaggingSecondaries: []string{},
+		Refresh:            zone.RefreshTime(),
+		Retry:              zone.RetryTime(),
+	}
+	for _, deployment := range deployments {
+		advice.LaggingSecondaries = append(advice.LaggingSecondaries, deployment.Host)
+	}
+
+	days := strconv.Itoa(SOAAdviceDays)
+	switch {
+	case commits == 0:
+		advice.SuggestedRefresh, advice.SuggestedRetry = 14400, 1800
+		advice.Reasons = append(advice.Reasons, "no commits during the last "+days+" days")
+	case advice.CommitsPerDay < 0.5:
+		advice.SuggestedRefresh, advice.SuggestedRetry = 3600, 600
+		advice.Reasons = append(advice.Reasons, strconv.Itoa(commits)+" commits during the last "+days+" days")
+	case advice.CommitsPerDay < 5:
+		advice.SuggestedRefresh, advice.SuggestedRetry = 900, 180
+		advice.Reasons = append(advice.Reasons, strconv.FormatFloat(advice.CommitsPerDay, 'f', 1, 64)+" commits a day")
+	default:
+		advice.SuggestedRefresh, advice.SuggestedRetry = 300, 60
+		advice.Reasons = append(advice.Reasons, strconv.FormatFloat(advice.CommitsPerDay, 'f', 1, 64)+" commits a day")
+	}
+
+	// NOTIFY didn't get through, secondaries should catch up soon
+	if len(advice.LaggingSecondaries) > 0 {
+		if advice.SuggestedRefresh > 900 {
+			advice.SuggestedRefresh = 900
+		}
+		advice.SuggestedRetry = MinSOATimer
+		advice.Reasons = append(advice.Reasons, "secondaries "+strings.Join(advice.LaggingSecondaries, ", ")+" don't have the last serial")
+	}
+
+	if advice.SuggestedRefresh+advice.SuggestedRetry > zone.ExpireTime() {
+		advice.SuggestedRefresh = zone.ExpireTime() - advice.SuggestedRetry
+		advice.Reasons = append(advice.Reasons, "refresh is shortened by expire of the zone")
+	}
+	if advice.SuggestedRefresh < MinSOATimer {
+		advice.SuggestedRefresh, advice.SuggestedRetry = advice.Refresh, advice.Retry
+		advice.Reasons = append(advice.Reasons, "expire of the zone is too short for other timers")
+	}
+
+	return &advice, nil
+}
+
+// SetZoneSOATimers sets refresh and retry of the zone, 0 for the configured ones.
+// The zone has to be committed afterwards.
+func SetZoneSOATimers(zoneId uint, refresh int, retry int) (*Zone, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	zone.Refresh = refresh
+	zone.Retry = retry
+	err = validateSOATimers(&zone)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Model(&Zone{}).Where("id = ?", zoneId).Updates(map[string]interface{}{"refresh": refresh, "retry": retry}).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	Audit("zone.soa_timers_changed", &zone, "refresh "+strconv.Itoa(refresh)+", retry "+strconv.Itoa(retry))
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
+
+// ProposeSOATimers holds changed advice of every zone as change request, it's applied once approved by
+// the admin token. Zones with a pending proposal get no other.
+func ProposeSOATimers(now time.Time) ([]ChangeRequest, error) {
+	var zones []Zone
+	requests := []ChangeRequest{}
+
+	db := GetDatabaseConnection()
+	err := activeZones(db).Order("id").Find(&zones).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, zone := range zones {
+		advice, err := AdviseSOATimers(zone.ID, now)
+		if err != nil {
+			return nil, err
+		}
+		if !advice.Changed() {
+			continue
+		}
+
+		pending := 0
+		err = db.Model(&ChangeRequest{}).Where("zone_id = ? AND operation = ? AND state = ?", zone.ID, ChangeOperationSOATimers, ChangeStatePending).
+			Count(&pending).Error
+		if err != nil {
+			return nil, err
+		}
+		if pending > 0 {
+			continue
+		}
+
+		request := ChangeRequest{
+			ZoneId:    zone.ID,
+			Operation: ChangeOperationSOATimers,
+			Payload:   changePayload(advice),
+			Anomalies: "[]",
+			State:     ChangeStatePending,
+		}
+		err = db.Create(&request).Error
+		if err != nil {
+			return nil, err
+		}
+
+		Audit("zone.soa_timers_proposed", &zone, "refresh "+strconv.Itoa(advice.SuggestedRefresh)+", retry "+strconv.Itoa(advice.SuggestedRetry)+": "+strings.Join(advice.Reasons, "; "))
+		SendWebhook("change.approval_required", map[string]interface{}{"zone_id": zone.ID, "domain": zone.Domain, "anomalies": []Anomaly{}, "change": request})
+		requests = append(requests, request)
+	}
+
+	return requests, nil
+}
+
+// Applies approved proposal of the SOA advisor
+func applySOAProposal(request *ChangeRequest) []error {
+	var advice SOAAdvice
+
+	err := json.Unmarshal([]byte(request.Payload), &advice)
+	if err != nil {
+		return []error{err}
+	}
+	_, errs := SetZoneSOATimers(request.ZoneId, advice.SuggestedRefresh, advice.SuggestedRetry)
+	return errs
+}
+
+// RunSOAAdvisorScheduler proposes SOA timers every DNSAPI_SOA_ADVISOR_INTERVAL seconds, it's supposed to run as goroutine
+func RunSOAAdvisorScheduler() {
+	ticker := time.NewTicker(time.Duration(config.SOAAdvisorInterval) * time.Second)
+
+	for now := range ticker.C {
+		_, err := ProposeSOATimers(now)
+		if err != nil {
+			log.Errorf("SOA advisor: " + err.Error())
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdviseSOATimers(t *testing.T) {
+	now := time.Date(2026, 5, 20, 12, 0, 0, 0, time.UTC)
+
+	refresh, retry, expire := config.TimeToRefresh, config.TimeToRetry, config.TimeToExpire
+	config.TimeToRefresh = 300
+	config.TimeToRetry = 180
+	config.TimeToExpire = 604800
+	defer func() {
+		config.TimeToRefresh = refresh
+		config.TimeToRetry = retry
+		config.TimeToExpire = expire
+	}()
+
+	zone, errs := NewZone("BZ-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	advice, err := AdviseSOATimers(zone.ID, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 300, advice.Refresh)
+	assert.Equal(t, 14400, advice.SuggestedRefresh, "Static zone")
+	assert.Equal(t, 1800, advice.SuggestedRetry)
+	assert.True(t, advice.Changed())
+
+	// 60 commits during the last 30 days, the older ones don't count
+	db := GetDatabaseConnection()
+	for _, stat := range []CommitStat{
+		{ZoneId: zone.ID, Day: "2026-05-20", Commits: 40},
+		{ZoneId: zone.ID, Day: "2026-04-21", Commits: 20},
+		{ZoneId: zone.ID, Day: "2026-04-20", Commits: 500},
+	} {
+		assert.NoError(t, db.Create(&stat).Error)
+	}
+	advice, err = AdviseSOATimers(zone.ID, now)
+	assert.NoError(t, err)
+	assert.Equal(t, 2.0, advice.CommitsPerDay)
+	assert.Equal(t, 900, advice.SuggestedRefresh)
+	assert.Equal(t, 180, advice.SuggestedRetry)
+
+	// Secondary without the last serial makes secondaries retry sooner
+	assert.NoError(t, db.Create(&ZoneDeployment{ZoneId: zone.ID, Serial: "2026052001", Host: "ns2.example.net", Role: DeploymentRoleSecondary, State: DeploymentStateFailed}).Error)
+	advice, err = AdviseSOATimers(zone.ID, now)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ns2.example.net"}, advice.LaggingSecondaries)
+	assert.Equal(t, 900, advice.SuggestedRefresh)
+	assert.Equal(t, MinSOATimer, advice.SuggestedRetry)
+	assert.Contains(t, strings.Join(advice.Reasons, "; "), "ns2.example.net")
+
+	// Changed advice waits for approval, only once
+	requests, err := ProposeSOATimers(now)
+	assert.NoError(t, err)
+	var proposal *ChangeRequest
+	for i := range requests {
+		if requests[i].ZoneId == zone.ID {
+			proposal = &requests[i]
+		}
+	}
+	if !assert.NotNil(t, proposal) {
+		return
+	}
+	assert.Equal(t, ChangeOperationSOATimers, proposal.Operation)
+	requests, err = ProposeSOATimers(now)
+	assert.NoError(t, err)
+	for _, request := range requests {
+		assert.NotEqual(t, zone.ID, request.ZoneId, "Zone with pending proposal")
+	}
+
+	_, errs = ApproveChange(proposal.ID)
+	assert.Len(t, errs, 0)
+	approved, err := GetStore().GetZone(zone.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, 900, approved.Refresh)
+	assert.Equal(t, MinSOATimer, approved.Retry)
+	assert.Contains(t, approved.Render(), "\n\t\t900\n\t\t60\n\t\t604800\n")
+	advice, err = AdviseSOATimers(zone.ID, now)
+	assert.NoError(t, err)
+	assert.False(t, advice.Changed())
+	for _, timers := range [][]int{{30, 0}, {0, 100000}, {604800, 60}} {
+		_, errs = SetZoneSOATimers(zone.ID, timers[0], timers[1])
+		assert.Len(t, errs, 1, timers)
+	}
+	updated, errs := SetZoneSOATimers(zone.ID, 0, 0)
+	assert.Len(t, errs, 0)
+	assert.Equal(t, 300, updated.RefreshTime(), "DNSAPI_TIME_TO_REFRESH")
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// States of the zone's mirror in the standby server
+const (
+	StandbyStateSynced = "synced" // The standby serves the last committed serial
+	StandbyStateFailed = "failed" // The last sync failed, see StandbyError
+)
+
+// Returns RRsets of the rendered zone by "name type" keys in the order of the zone file. Our NS records
+// of the apex are skipped, the standby has its own. SOA is returned separately.
+func standbyRRsets(zone *Zone) (map[string][]dns.RR, []string, dns.RR, error) {
+	rrsets := make(map[string][]dns.RR)
+	var keys []string
+	var soa dns.RR
+
+	apex := strings.ToLower(dns.Fqdn(zone.Domain))
+	parser := dns.NewZoneParser(strings.NewReader(zone.Render()), apex, "")
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		header := rr.Header()
+		header.Name = strings.ToLower(header.Name)
+		if header.Rrtype == dns.TypeSOA {
+			soa = rr
+			continue
+		}
+		if header.Rrtype == dns.TypeNS && header.Name == apex {
+			continue
+		}
+
+		key := header.Name + " " + dns.TypeToString[header.Rrtype]
+		if _, ok := rrsets[key]; !ok {
+			keys = append(keys, key)
+		}
+		rrsets[key] = append(rrsets[key], rr)
+	}
+	if err := parser.Err(); err != nil {
+		return nil, nil, nil, errors.Wrap(err, "rendered zone")
+	}
+	if soa == nil {
+		return nil, nil, nil, errors.New("rendered zone has no SOA record")
+	}
+
+	return rrsets, keys, soa, nil
+}
+
+// Sends the message to the standby server, signed if DNSAPI_STANDBY_TSIG_NAME is set
+func standbyExchange(message *dns.Msg) (*dns.Msg, error) {
+	server := config.StandbyServer
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	client := &dns.Client{Net: "tcp", Timeout: TransferTimeout}
+	if config.StandbyTSIGName != "" {
+		name := strings.ToLower(dns.Fqdn(config.StandbyTSIGName))
+		message.SetTsig(name, dns.Fqdn(config.StandbyTSIGAlgorithm), 300, time.Now().Unix())
+		client.TsigSecret = map[string]string{name: config.StandbyTSIGSecret}
+	}
+
+	response, _, err := client.Exchange(message, server)
+	if err != nil {
+		return nil, errors.Wrap(err, "standby "+server)
+	}
+	if response.Rcode != dns.RcodeSuccess {
+		return nil, errors.New("standby " + server + " answered " + dns.RcodeToString[response.Rcode])
+	}
+
+	return response, nil
+}
+
+// SyncStandby mirrors the committed zone into the standby server (DNSAPI_STANDBY_SERVER) by one RFC 2136
+// update. All RRsets are replaced, RRsets synced before which don't exist anymore are removed and SOA
+// gets our serial. The standby is asked for the SOA afterwards, its serial has to be ours.
+func SyncStandby(zone *Zone) error {
+	if config.StandbyServer == "" {
+		return errors.New("standby server is not configured")
+	}
+
+	err := syncStandby(zone)
+	if err != nil {
+		log.Errorf("standby sync of " + zone.Domain + ": " + err.Error())
+	}
+
+	return err
+}
+
+func syncStandby(zone *Zone) error {
+	rrsets, keys, soa, err := standbyRRsets(zone)
+	if err != nil {
+		return setStandbyState(zone, "", err)
+	}
+
+	var previous []string
+	if zone.StandbyRRsets != "" {
+		err = json.Unmarshal([]byte(zone.StandbyRRsets), &previous)
+		if err != nil {
+			return setStandbyState(zone, "", errors.Wrap(err, "synced RRsets"))
+		}
+	}
+
+	message := new(dns.Msg)
+	message.SetUpdate(dns.Fqdn(zone.Domain))
+	for _, key := range previous {
+		if _, ok := rrsets[key]; ok {
+			continue
+		}
+		parts := strings.SplitN(key, " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		message.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: parts[0], Rrtype: dns.StringToType[parts[1]]}}})
+	}
+	for _, key := range keys {
+		message.RemoveRRset(rrsets[key][:1])
+		message.Insert(rrsets[key])
+	}
+	message.Insert([]dns.RR{soa})
+
+	_, err = standbyExchange(message)
+	if err != nil {
+		return setStandbyState(zone, "", err)
+	}
+
+	// Serials in lockstep, the standby could refuse our SOA while accepting the rest
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn(zone.Domain), dns.TypeSOA)
+	response, err := standbyExchange(query)
+	if err != nil {
+		return setStandbyState(zone, "", err)
+	}
+	expected := soa.(*dns.SOA).Serial
+	for _, rr := range response.Answer {
+		if answer, ok := rr.(*dns.SOA); ok && answer.Serial != expected {
+			return setStandbyState(zone, "", errors.Errorf("standby serves serial %d instead of %d", answer.Serial, expected))
+		}
+	}
+
+	synced, err := json.Marshal(keys)
+	if err != nil {
+		panic(err)
+	}
+	return setStandbyState(zone, string(synced), nil)
+}
+
+// Saves the result of the sync, RRsets are kept from the last successful sync
+func setStandbyState(zone *Zone, rrsets string, syncErr error) error {
+	values := map[string]interface{}{
+		"standby_state":     StandbyStateSynced,
+		"standby_error":     "",
+		"standby_synced_at": time.Now().UTC(),
+		"standby_rrsets":    rrsets,
+	}
+	if syncErr != nil {
+		values = map[string]interface{}{
+			"standby_state": StandbyStateFailed,
+			"standby_error": syncErr.Error(),
+		}
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Model(&Zone{}).Where("id = ?", zone.ID).Updates(values).Error
+	if err != nil {
+		return err
+	}
+
+	return syncErr
+}
+
+// SetZoneStandby turns mirroring of the zone into the standby server on or off. Deployed zone is synced
+// right away, zones with changes which weren't committed yet are synced by the next commit. Records stay
+// in the standby when the mirroring is turned off.
+func SetZoneStandby(zoneId uint, standby bool) (*Zone, error) {
+	var zone Zone
+
+	if standby && config.StandbyServer == "" {
+		return nil, errors.New("standby server is not configured")
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Model(&zone).Update("standby", standby).Error
+	if err != nil {
+		return nil, err
+	}
+	if standby {
+		Audit("zone.standby_enabled", &zone, config.StandbyServer)
+	} else {
+		Audit("zone.standby_disabled", &zone, "")
+	}
+
+	// Sync failure is kept in the zone's standby state, the setting itself is done
+	if standby && zone.DeployState == DeployStateDeployed {
+		SyncStandby(&zone)
+	}
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &zone, nil
+}
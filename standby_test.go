@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 2136 server keeping RRsets by "name type", updates with SOA are ignored if keepSOA is set
+type standbyServer struct {
+	sync.Mutex
+	rrsets  map[string][]string
+	soa     *dns.SOA
+	keepSOA bool
+}
+
+func startStandbyServer(t *testing.T, standby *standbyServer) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &dns.Server{
+		Listener:   listener,
+		TsigSecret: map[string]string{"standby.": "c2VjcmV0IG9mIHRoZSBzdGFuZGJ5"},
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction {
+			return dns.MsgAccept
+		},
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, request *dns.Msg) {
+			standby.Lock()
+			defer standby.Unlock()
+
+			response := new(dns.Msg)
+			response.SetReply(request)
+			if request.IsTsig() == nil || w.TsigStatus() != nil {
+				response.Rcode = dns.RcodeNotAuth
+			} else if request.Opcode == dns.OpcodeUpdate {
+				for _, rr := range request.Ns {
+					header := rr.Header()
+					key := strings.ToLower(header.Name) + " " + dns.TypeToString[header.Rrtype]
+					if soa, ok := rr.(*dns.SOA); ok {
+						if !standby.keepSOA {
+							standby.soa = soa
+						}
+					} else if header.Class == dns.ClassANY {
+						delete(standby.rrsets, key)
+					} else {
+						standby.rrsets[key] = append(standby.rrsets[key], rr.String())
+					}
+				}
+			} else if standby.soa != nil {
+				response.Answer = []dns.RR{standby.soa}
+			}
+			if response.IsTsig() == nil && request.IsTsig() != nil {
+				response.SetTsig(request.IsTsig().Hdr.Name, request.IsTsig().Algorithm, 300, int64(request.IsTsig().TimeSigned))
+			}
+			w.WriteMsg(response)
+		}),
+	}
+	go server.ActivateAndServe()
+
+	return listener.Addr().String(), func() { server.Shutdown() }
+}
+
+func TestSyncStandby(t *testing.T) {
+	config.TTL = 300
+	standby := &standbyServer{rrsets: make(map[string][]string)}
+	address, stop := startStandbyServer(t, standby)
+	defer stop()
+
+	config.StandbyServer = address
+	config.StandbyTSIGName = "standby"
+	config.StandbyTSIGSecret = "c2VjcmV0IG9mIHRoZSBzdGFuZGJ5"
+	config.StandbyTSIGAlgorithm = "hmac-sha256"
+	defer func() {
+		config.TTL = 0
+		config.StandbyServer = ""
+		config.StandbyTSIGName = ""
+		config.StandbyTSIGSecret = ""
+		config.StandbyTSIGAlgorithm = ""
+	}()
+
+	domain := "ap-standby-" + TEST_DOMAIN
+	zone, errs := NewZone(domain, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	txt, errs := NewRecord(zone.ID, "@", 300, "TXT", 0, "v=spf1 -all")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	reload := func() *Zone {
+		var reloaded Zone
+		err := GetDatabaseConnection().Where("id = ?", zone.ID).Preload("Records").Find(&reloaded).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &reloaded
+	}
+
+	// Synced zones are committed, they have serial
+	err := GetDatabaseConnection().Model(zone).Update("serial", "2026101401").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = SyncStandby(reload())
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, StandbyStateSynced, reload().StandbyState)
+	assert.Len(t, standby.rrsets["www."+domain+". A"], 1)
+	assert.Len(t, standby.rrsets[domain+". TXT"], 1)
+	assert.Len(t, standby.rrsets[domain+". NS"], 0)
+	assert.Equal(t, reload().Serial, strings.Fields(standby.soa.String())[6])
+
+	// Removed RRsets are removed in the standby too
+	err = DeleteRecord(txt.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, SyncStandby(reload()))
+	assert.Len(t, standby.rrsets[domain+". TXT"], 0)
+	assert.Len(t, standby.rrsets["www."+domain+". A"], 1)
+
+	// Standby which doesn't take our serial is out of sync
+	standby.keepSOA = true
+	synced := reload()
+	synced.SetNewSerial()
+	assert.NotNil(t, SyncStandby(synced))
+	assert.Equal(t, StandbyStateFailed, reload().StandbyState)
+	assert.Contains(t, reload().StandbyError, "instead of")
+
+	config.StandbyTSIGSecret = "d3Jvbmcgc2VjcmV0"
+	assert.NotNil(t, SyncStandby(reload()))
+
+	zone, err = SetZoneStandby(zone.ID, true)
+	assert.Nil(t, err)
+	assert.True(t, zone.Standby)
+	config.StandbyServer = ""
+	_, err = SetZoneStandby(zone.ID, true)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,101 @@
+package main
+
+// ZoneFilter limits listed zones, nil and empty fields don't filter
+type ZoneFilter struct {
+	Pool   *string
+	State  string
+	DNSSEC *bool
+}
+
+// ZoneStore loads zones with their records. Missing zone is reported by error with RECORD_NOT_FOUND_MESSAGE.
+type ZoneStore interface {
+	GetZone(zoneId uint) (*Zone, error)
+	ListZones(filter ZoneFilter) ([]Zone, error)
+}
+
+// RecordStore loads records. Missing record is reported by error with RECORD_NOT_FOUND_MESSAGE.
+type RecordStore interface {
+	GetRecord(recordId uint) (*Record, error)
+	ListRecords(zoneId uint) ([]Record, error)
+}
+
+// Store is the persistence of zones and records used by the API
+type Store interface {
+	ZoneStore
+	RecordStore
+}
+
+// Store used by the API, set by SetStore before the server starts
+var store Store = &gormStore{}
+
+// SetStore replaces the default GORM store, ex. by a store reading an existing provisioning database
+func SetStore(s Store) {
+	store = s
+}
+
+// GetStore returns the store in use
+func GetStore() Store {
+	return store
+}
+
+// The default store in the database from DNSAPI_DATABASE_PATH, lists are read from replicas
+type gormStore struct{}
+
+func (s *gormStore) GetZone(zoneId uint) (*Zone, error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &zone, nil
+}
+
+func (s *gormStore) ListZones(filter ZoneFilter) ([]Zone, error) {
+	var zones []Zone
+
+	db := GetReadDatabaseConnection()
+	query := db.Model(&Zone{})
+	if filter.Pool != nil {
+		query = query.Where("pool = ?", *filter.Pool)
+	}
+	if filter.State != "" {
+		query = query.Where("deploy_state = ?", filter.State)
+	}
+	if filter.DNSSEC != nil {
+		query = query.Where("dnssec = ?", *filter.DNSSEC)
+	}
+
+	err := query.Preload("Records").Find(&zones).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return zones, nil
+}
+
+func (s *gormStore) GetRecord(recordId uint) (*Record, error) {
+	var record Record
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", recordId).Find(&record).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+func (s *gormStore) ListRecords(zoneId uint) ([]Record, error) {
+	var records []Record
+
+	db := GetReadDatabaseConnection()
+	err := db.Model(&Record{}).Where("zone_id = ?", zoneId).Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo"
+	"github.com/stretchr/testify/assert"
+)
+
+// Store with one zone kept in memory
+type memoryStore struct {
+	zone Zone
+}
+
+func (s *memoryStore) GetZone(zoneId uint) (*Zone, error) {
+	if zoneId != s.zone.ID {
+		return nil, errors.New(RECORD_NOT_FOUND_MESSAGE)
+	}
+	return &s.zone, nil
+}
+
+func (s *memoryStore) ListZones(filter ZoneFilter) ([]Zone, error) {
+	if filter.Pool != nil && *filter.Pool != s.zone.Pool {
+		return []Zone{}, nil
+	}
+	return []Zone{s.zone}, nil
+}
+
+func (s *memoryStore) GetRecord(recordId uint) (*Record, error) {
+	for _, record := range s.zone.Records {
+		if record.ID == recordId {
+			return &record, nil
+		}
+	}
+	return nil, errors.New(RECORD_NOT_FOUND_MESSAGE)
+}
+
+func (s *memoryStore) ListRecords(zoneId uint) ([]Record, error) {
+	if zoneId != s.zone.ID {
+		return []Record{}, nil
+	}
+	return s.zone.Records, nil
+}
+
+func TestSetStore(t *testing.T) {
+	defaultStore := GetStore()
+	SetStore(&memoryStore{zone: Zone{ID: 9001, Domain: "aw-" + TEST_DOMAIN, Records: []Record{
+		{ID: 9002, ZoneId: 9001, Name: "www", TTL: 300, Type: "A", Value: "192.0.2.1"},
+	}}})
+	defer SetStore(defaultStore)
+
+	e := echo.New()
+	get := func(handler echo.HandlerFunc, param string, value string) (*httptest.ResponseRecorder, error) {
+		recorder := httptest.NewRecorder()
+		context := e.NewContext(httptest.NewRequest(echo.GET, "/", nil), recorder)
+		context.SetParamNames(param)
+		context.SetParamValues(value)
+		return recorder, handler(context)
+	}
+
+	recorder, err := get(GetZoneHandler, "zone_id", "9001")
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		assert.Contains(t, recorder.Body.String(), "aw-"+TEST_DOMAIN)
+	}
+	recorder, err = get(GetRecordHandler, "record_id", "9002")
+	if assert.NoError(t, err) {
+		assert.Contains(t, recorder.Body.String(), "192.0.2.1")
+	}
+
+	_, err = get(GetZoneHandler, "zone_id", "9003")
+	httpErr, ok := err.(*echo.HTTPError)
+	if assert.True(t, ok) {
+		assert.Equal(t, http.StatusNotFound, httpErr.Code)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Template is a set of records which can be applied on a zone
+type Template struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name    string           `json:"name" sql:"index"`
+	Records []TemplateRecord `json:"records" gorm:"foreignkey:TemplateID"`
+}
+
+// TemplateRecord is one record of a template, TTL 0 means zone's default TTL
+type TemplateRecord struct {
+	ID uint `json:"id" gorm:"primary_key"`
+
+	TemplateId uint `json:"-" sql:"index"`
+
+	Name  string `json:"name"`
+	TTL   int    `json:"ttl"`
+	Type  string `json:"type"`
+	Prio  int    `json:"prio"`
+	Value string `json:"value"`
+}
+
+// Validates the template and its records
+func (t *Template) Validate() []error {
+	var errorsMsgs []error
+
+	if strings.TrimSpace(t.Name) == "" {
+		errorsMsgs = append(errorsMsgs, errors.New("name of the template can't be empty"))
+	}
+
+	for _, templateRecord := range t.Records {
+		// Records without TTL get zone's default TTL when applied, it's validated elsewhere.
+		// Built-in variables get sample values, records with custom variables are checked when the template is applied.
+		record := templateRecord.Record(3600)
+		value, err := expandVariables(record.Value, sampleVariables)
+		if err != nil {
+			continue
+		}
+		record.Value = value
+		err = record.Validate()
+		if err != nil {
+			errorsMsgs = append(errorsMsgs, err)
+		}
+	}
+
+	return errorsMsgs
+}
+
+// Returns record of the template for a zone with given default TTL
+func (tr *TemplateRecord) Record(defaultTTL int) Record {
+	ttl := tr.TTL
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+
+	return Record{
+		Name:  tr.Name,
+		TTL:   ttl,
+		Type:  tr.Type,
+		Prio:  tr.Prio,
+		Value: tr.Value,
+	}
+}
+
+// Create a new template
+func NewTemplate(name string, records []TemplateRecord) (*Template, []error) {
+	template := Template{
+		Name:    name,
+		Records: records,
+	}
+
+	errs := template.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Create(&template).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &template, nil
+}
+
+// Delete existing template
+func DeleteTemplate(templateId uint) error {
+	var template Template
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", templateId).Find(&template).Error
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = db.Model(&Tenant{}).Where("default_template_id = ?", templateId).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("template is used as default by " + strconv.Itoa(count) + " tenant(s)")
+	}
+
+	tx := db.Begin()
+
+	err = tx.Where("template_id = ?", templateId).Delete(&TemplateRecord{}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = tx.Where("id = ?", templateId).Delete(&Template{}).Error
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// Normalized records the template adds to the zone
+func templateRecords(zone *Zone, template *Template) []Record {
+	var records []Record
+	for _, templateRecord := range template.Records {
+		record := templateRecord.Record(zone.TypeTTL(templateRecord.Type))
+		record.ZoneId = zone.ID
+		record.Normalize(zone.Domain)
+		records = append(records, record)
+	}
+	return records
+}
+
+// ApplyTemplate adds all records of the template into the zone
+func ApplyTemplate(zoneId uint, templateId uint) (*Zone, []error) {
+	var zone Zone
+	var template Template
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Where("id = ?", templateId).Preload("Records").Find(&template).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	newRecords := templateRecords(&zone, &template)
+	zone.Records = append(zone.Records, newRecords...)
+
+	errs := zone.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	tx := db.Begin()
+	for _, record := range newRecords {
+		err = tx.Create(&record).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, []error{err}
+		}
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+// Tenant is an account owning zones. Its defaults are applied on every new zone of the tenant.
+type Tenant struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	Name string `json:"name"`
+
+	DefaultTTL        int    `json:"default_ttl"`         // Default TTL of new zones, 0 means DNSAPI_TTL
+	DefaultAbuseEmail string `json:"default_abuse_email"` // Used when new zone has no abuse email
+	DefaultTags       string `json:"default_tags"`        // Used when new zone has no tags, separated by comma
+	DefaultPool       string `json:"default_pool"`        // Name server pool of new zones
+	DefaultTemplateId uint   `json:"default_template_id"` // Template applied on new zones, 0 for none
+
+	// Record TTLs allowed in the tenant's zones, 0 keeps the global bound
+	MinTTL int `json:"min_ttl" gorm:"column:min_ttl"`
+	MaxTTL int `json:"max_ttl" gorm:"column:max_ttl"`
+
+	// White-label branding of all the tenant's zones, empty fields keep our name servers.
+	// DefaultAbuseEmail is also used in SOA of the tenant's zones without their own abuse email.
+	NameServers string `json:"name_servers"`                      // Host names separated by comma, rendered as NS records of the apex
+	SOAMName    string `json:"soa_mname" gorm:"column:soa_mname"` // Primary name server in SOA records
+
+	// Reads and exports of the tenant's zones are written into the zone access log, see ZoneAccess
+	AccessLog bool `json:"access_log"`
+}
+
+// NameServerList returns the tenant's name servers, empty if the tenant uses ours
+func (t *Tenant) NameServerList() []string {
+	var nameServers []string
+	for _, nameServer := range strings.Split(t.NameServers, ",") {
+		nameServer = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(nameServer)), ".")
+		if nameServer != "" {
+			nameServers = append(nameServers, nameServer)
+		}
+	}
+	return nameServers
+}
+
+// Validates the tenant's settings
+func (t *Tenant) Validate() []error {
+	var errorsMsgs []error
+
+	if strings.TrimSpace(t.Name) == "" {
+		errorsMsgs = append(errorsMsgs, errors.New("name of the tenant can't be empty"))
+	}
+
+	if t.DefaultTTL != 0 && (t.DefaultTTL < 60 || t.DefaultTTL > 2592000) {
+		errorsMsgs = append(errorsMsgs, errors.New("default TTL has to be 0 or number between 60 and 2592000"))
+	}
+
+	bounds := TTLBounds{Min: MinRecordTTL, Max: MaxRecordTTL}.tighten(t.MinTTL, t.MaxTTL)
+	if t.MinTTL < 0 || t.MaxTTL < 0 || bounds.Validate() != nil {
+		errorsMsgs = append(errorsMsgs, errors.New("minimum and maximum TTL have to be 0 or numbers between 60 and 2592000, minimum not above maximum"))
+	} else if t.DefaultTTL != 0 && (t.DefaultTTL < bounds.Min || t.DefaultTTL > bounds.Max) {
+		errorsMsgs = append(errorsMsgs, errors.New("default TTL has to be between the tenant's minimum and maximum TTL"))
+	}
+
+	if t.DefaultAbuseEmail != "" && !validEmail(t.DefaultAbuseEmail) {
+		errorsMsgs = append(errorsMsgs, errors.New("default abuse email is not a valid email address"))
+	}
+
+	for _, nameServer := range t.NameServerList() {
+		if !hostnamePattern.MatchString(nameServer) || !strings.Contains(nameServer, ".") {
+			errorsMsgs = append(errorsMsgs, errors.New(nameServer+" is not a valid host name of a name server"))
+		}
+	}
+	if len(t.NameServerList()) == 1 {
+		errorsMsgs = append(errorsMsgs, errors.New("at least two name servers are needed (RFC 1034 section 4.1)"))
+	}
+	if t.SOAMName != "" && (!hostnamePattern.MatchString(t.SOAMName) || !strings.Contains(t.SOAMName, ".")) {
+		errorsMsgs = append(errorsMsgs, errors.New(t.SOAMName+" is not a valid host name of the primary name server"))
+	}
+
+	if t.DefaultTemplateId != 0 {
+		var count int
+		db := GetDatabaseConnection()
+		err := db.Model(&Template{}).Where("id = ?", t.DefaultTemplateId).Count(&count).Error
+		if err != nil {
+			panic(err)
+		}
+		if count == 0 {
+			errorsMsgs = append(errorsMsgs, errors.New("default template "+strconv.Itoa(int(t.DefaultTemplateId))+" doesn't exist"))
+		}
+	}
+
+	return errorsMsgs
+}
+
+// Create a new tenant
+func NewTenant(tenant Tenant) (*Tenant, []error) {
+	tenant.ID = 0
+	tenant.normalizeBranding()
+
+	errs := tenant.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Create(&tenant).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &tenant, nil
+}
+
+// CheckTenantLimits returns error when the settings change limits of the tenant's zones which only the admin
+// token can change: TTL bounds and the name server pool, pools have TTL bounds too. Tenant 0 is a new tenant.
+func CheckTenantLimits(tenantId uint, settings *Tenant) error {
+	var tenant Tenant
+
+	if tenantId != 0 {
+		err := GetDatabaseConnection().Where("id = ?", tenantId).Find(&tenant).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	var changed []string
+	if settings.MinTTL != tenant.MinTTL {
+		changed = append(changed, "min_ttl")
+	}
+	if settings.MaxTTL != tenant.MaxTTL {
+		changed = append(changed, "max_ttl")
+	}
+	if strings.TrimSpace(settings.DefaultPool) != strings.TrimSpace(tenant.DefaultPool) {
+		changed = append(changed, "default_pool")
+	}
+	if len(changed) > 0 {
+		return errors.New(strings.Join(changed, ", ") + " can be changed only with the admin token")
+	}
+	return nil
+}
+
+// UpdateTenant updates name and default settings of the tenant
+func UpdateTenant(tenantId uint, settings Tenant) (*Tenant, []error) {
+	var tenant Tenant
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", tenantId).Find(&tenant).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	if settings.Name != "" {
+		tenant.Name = settings.Name
+	}
+	tenant.DefaultTTL = settings.DefaultTTL
+	tenant.DefaultAbuseEmail = settings.DefaultAbuseEmail
+	tenant.DefaultTags = settings.DefaultTags
+	tenant.DefaultPool = settings.DefaultPool
+	tenant.DefaultTemplateId = settings.DefaultTemplateId
+	tenant.MinTTL = settings.MinTTL
+	tenant.MaxTTL = settings.MaxTTL
+	tenant.AccessLog = settings.AccessLog
+
+	previous := tenant
+	tenant.NameServers = settings.NameServers
+	tenant.SOAMName = settings.SOAMName
+	tenant.normalizeBranding()
+
+	errs := tenant.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	err = db.Save(&tenant).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	// Zones render the branding, so they have to be committed again
+	if tenant.NameServers != previous.NameServers || tenant.SOAMName != previous.SOAMName ||
+		tenant.DefaultAbuseEmail != previous.DefaultAbuseEmail {
+		err = markTenantZonesPending(tenant.ID)
+		if err != nil {
+			return nil, []error{err}
+		}
+	}
+
+	return &tenant, nil
+}
+
+// Stores name servers in the same form as they are listed
+func (t *Tenant) normalizeBranding() {
+	t.NameServers = strings.Join(t.NameServerList(), ",")
+	t.SOAMName = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(t.SOAMName)), ".")
+}
+
+func markTenantZonesPending(tenantId uint) error {
+	var zones []Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("tenant_id = ?", tenantId).Find(&zones).Error
+	if err != nil {
+		return err
+	}
+	for _, zone := range zones {
+		err = markZonePending(zone.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete existing tenant, it can't own any zones
+func DeleteTenant(tenantId uint) error {
+	var tenant Tenant
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", tenantId).Find(&tenant).Error
+	if err != nil {
+		return err
+	}
+
+	var count int
+	err = db.Model(&Zone{}).Where("tenant_id = ?", tenantId).Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return errors.New("tenant still owns " + strconv.Itoa(count) + " zone(s)")
+	}
+
+	return db.Where("id = ?", tenantId).Delete(&Tenant{}).Error
+}
+
+// Tenant owning the zone, nil for zones without tenant
+func (z *Zone) tenant() *Tenant {
+	var tenant Tenant
+
+	if z.TenantId == 0 {
+		return nil
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", z.TenantId).Find(&tenant).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		panic(err)
+	}
+
+	return &tenant
+}
+
+// ApexNameServers returns name servers rendered as NS records of the apex, the tenant's ones or DNSAPI_NAME_SERVERS
+func (z *Zone) ApexNameServers() []string {
+	if tenant := z.tenant(); tenant != nil && len(tenant.NameServerList()) > 0 {
+		return tenant.NameServerList()
+	}
+	return config.NameServers
+}
+
+// SOAMName returns the primary name server in SOA, the tenant's one or the primary of the zone's pool
+func (z *Zone) SOAMName() string {
+	if tenant := z.tenant(); tenant != nil && tenant.SOAMName != "" {
+		return tenant.SOAMName
+	}
+	return PoolPrimaryNameServer(z.Pool)
+}
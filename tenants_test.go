@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTenantBranding(t *testing.T) {
+	_, errs := NewTenant(Tenant{Name: "Broken", NameServers: "ns1.reseller.example"})
+	assert.Len(t, errs, 1)
+	_, errs = NewTenant(Tenant{Name: "Broken", SOAMName: "not a host"})
+	assert.Len(t, errs, 1)
+
+	tenant, errs := NewTenant(Tenant{Name: "White label", NameServers: "NS1.reseller.example., ns2.reseller.example"})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteTenant(tenant.ID)
+	assert.Equal(t, "ns1.reseller.example,ns2.reseller.example", tenant.NameServers)
+
+	zone, errs := NewTenantZone(tenant.ID, "BB-"+TEST_DOMAIN, []string{}, "")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	rendered := zone.Render()
+	assert.Contains(t, rendered, "@    IN    NS    ns1.reseller.example.\n@    IN    NS    ns2.reseller.example.\n")
+	for _, nameServer := range config.NameServers {
+		assert.NotContains(t, rendered, "NS    "+nameServer)
+	}
+
+	// Branding set later applies to existing zones
+	tenant, errs = UpdateTenant(tenant.ID, Tenant{
+		NameServers:       tenant.NameServers,
+		SOAMName:          "ns1.reseller.example",
+		DefaultAbuseEmail: "hostmaster@reseller.example",
+	})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	rendered = zone.Render()
+	assert.True(t, strings.Contains(rendered, "SOA     ns1.reseller.example. hostmaster.reseller.example."), rendered)
+
+	// Branded NS records of the apex aren't imported as records
+	records, err := ParseZoneFile(rendered, zone.Domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, records, 0)
+}
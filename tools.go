@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 
 	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
 	"github.com/pkg/sftp"
 	"golang.org/x/crypto/ssh"
 )
@@ -87,6 +89,30 @@ func SendFileViaSSH(server string, filename string, content string) error {
 	return err
 }
 
+// SendDeployFileViaSSH saves deployed file and applies owner, mode and SELinux label configured for the server in the inventory
+func SendDeployFileViaSSH(server string, filename string, content string) error {
+	err := SendFileViaSSH(server, filename, content)
+	if err != nil {
+		return err
+	}
+
+	nameServer := nameServerByAddress(server)
+	if nameServer == nil {
+		return nil
+	}
+
+	command := nameServer.FileSettingsCommand(filename)
+	if command == "" {
+		return nil
+	}
+
+	output, err := SendCommandViaSSH(server, command)
+	if err != nil && output != nil {
+		return errors.Wrap(err, output.String())
+	}
+	return err
+}
+
 func SendCommandViaSSH(server string, command string) (*bytes.Buffer, error) {
 	client, err := sshClient(server)
 	if err != nil {
@@ -119,23 +145,12 @@ func SetSlavesBindConfig() {
 		}
 	}()
 
-	var zones []Zone // all zones
-
-	db := GetDatabaseConnection()
-
-	err := db.Find(&zones).Error
+	bindConfig, err := renderSecondaryBindConfig()
 	if err != nil {
 		panic(err)
 	}
 
-	// Generate all config files for bind
-	var allZonesSecondaryConfig string
-	for _, zone := range zones {
-		allZonesSecondaryConfig += zone.RenderSecondary()
-		allZonesSecondaryConfig += "\n"
-	}
-
-	for _, server := range config.SecondaryNameServerIPs {
+	for _, server := range SecondaryNameServerAddresses() {
 		go func(server string, bindConfig string) {
 			// This is called as goroutine so we need to recover from panicing
 			defer func() {
@@ -145,16 +160,34 @@ func SetSlavesBindConfig() {
 				}
 			}()
 
-			err := SendFileViaSSH(server, SecondaryBindConfigPath, bindConfig)
+			err := RunOnHost(server, 0, func() error {
+				return deploySecondaryBindConfig(server, bindConfig)
+			})
 			if err != nil {
 				panic(err)
 			}
-			_, err = SendCommandViaSSH(server, "systemctl reload bind9")
-			if err != nil {
-				panic(err)
-			}
-		}(server, allZonesSecondaryConfig)
+		}(server, bindConfig)
+	}
+}
+
+// Generates secondary's config for all zones, empty in fragments mode where zones are added by rndc
+func renderSecondaryBindConfig() (string, error) {
+	if fragmentsMode() {
+		return "", nil
 	}
+
+	bindConfig, _, err := RenderSecondaryIncludes()
+	return bindConfig, err
+}
+
+// Saves secondary's config on the server and reloads bind
+func deploySecondaryBindConfig(server string, bindConfig string) error {
+	err := SendDeployFileViaSSH(server, SecondaryBindConfigPath, bindConfig)
+	if err != nil {
+		return err
+	}
+	_, err = SendCommandViaSSH(server, bindReconfigCommand())
+	return err
 }
 
 func SetMasterBindConfig() {
@@ -166,29 +199,36 @@ func SetMasterBindConfig() {
 		}
 	}()
 
-	var zones []Zone // all zones
-
-	db := GetDatabaseConnection()
-
-	err := db.Find(&zones).Error
+	err := RunOnHost(config.PrimaryNameServer, 0, deployMasterBindConfig)
 	if err != nil {
 		panic(err)
 	}
+}
 
-	// Generate all config files for bind
+// Generates master's config for all zones, saves it and reloads bind. In fragments mode only TSIG keys are in the config.
+func deployMasterBindConfig() error {
 	var allZonesPrimaryConfig string
-	for _, zone := range zones {
-		allZonesPrimaryConfig += zone.RenderPrimary()
-		allZonesPrimaryConfig += "\n"
-	}
+	var err error
 
-	// Save master's main config
-	err = SendFileViaSSH(config.PrimaryNameServer, PrimaryBindConfigPath, allZonesPrimaryConfig)
+	if fragmentsMode() {
+		allZonesPrimaryConfig, _, err = renderIncludes(func(zone *Zone) string { return primaryKeyConfig(zone.RenderPrimary()) })
+	} else {
+		allZonesPrimaryConfig, _, err = RenderPrimaryIncludes()
+	}
 	if err != nil {
-		panic(err)
+		return err
 	}
-	_, err = SendCommandViaSSH(config.PrimaryNameServer, "systemctl reload bind9")
+
+	// Save master's main config
+	err = SendDeployFileViaSSH(config.PrimaryNameServer, PrimaryBindConfigPath, allZonesPrimaryConfig)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	_, err = SendCommandViaSSH(config.PrimaryNameServer, bindReconfigCommand())
+	return err
+}
+
+// Saves zone file of the zone on the primary server
+func deployZoneFile(zone *Zone) error {
+	return SendDeployFileViaSSH(config.PrimaryNameServer, path.Join(PrimaryZonePath, zone.Domain+".zone"), zone.Render())
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Phrases of host -l output and types of records they stand for, ex. "www.example.com has address 192.0.2.1"
+var hostOutputTypes = []struct {
+	Phrase string
+	Type   string
+}{
+	{" has address ", "A"},
+	{" has IPv6 address ", "AAAA"},
+	{" is an alias for ", "CNAME"},
+	{" mail is handled by ", "MX"},
+	{" name server ", "NS"},
+	{" descriptive text ", "TXT"},
+	{" has SRV record ", "SRV"},
+	{" domain name pointer ", "PTR"},
+}
+
+// Header lines of host output naming the queried server
+var hostOutputHeaders = []string{"Using domain server:", "Name:", "Address:", "Aliases:"}
+
+// Records of signed zones transferred by dig, the primary signs our zones itself
+var dnssecTypes = map[uint16]bool{
+	dns.TypeRRSIG:      true,
+	dns.TypeNSEC:       true,
+	dns.TypeNSEC3:      true,
+	dns.TypeNSEC3PARAM: true,
+	dns.TypeDNSKEY:     true,
+	dns.TypeCDS:        true,
+	dns.TypeCDNSKEY:    true,
+}
+
+// ImportLinesError lists lines of the import which can't be imported, nothing is imported then
+type ImportLinesError struct {
+	Lines []ImportLineError `json:"lines"`
+}
+
+// ImportLineError is one line which can't be imported and the reason
+type ImportLineError struct {
+	Line  int    `json:"line"` // Counted from 1
+	Text  string `json:"text"`
+	Error string `json:"error"`
+}
+
+func (e *ImportLinesError) Error() string {
+	var messages []string
+	for _, line := range e.Lines {
+		messages = append(messages, "line "+strconv.Itoa(line.Line)+": "+line.Error+": "+line.Text)
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Tells the host output type of the line, the name and the data
+func hostOutputLine(line string) (string, string, string, bool) {
+	for _, output := range hostOutputTypes {
+		index := strings.Index(line, output.Phrase)
+		if index > 0 {
+			return output.Type, strings.TrimSpace(line[:index]), strings.TrimSpace(line[index+len(output.Phrase):]), true
+		}
+	}
+	return "", "", "", false
+}
+
+func isHostHeader(line string) bool {
+	for _, header := range hostOutputHeaders {
+		if strings.HasPrefix(line, header) {
+			return true
+		}
+	}
+	return false
+}
+
+// Presentation format with TTL and class, ex. "www.example.com. 300 IN A 192.0.2.1"
+func isDigLine(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || !strings.HasSuffix(fields[0], ".") || !strings.EqualFold(fields[2], "IN") {
+		return false
+	}
+	_, err := strconv.Atoi(fields[1])
+	return err == nil
+}
+
+// IsTransferOutput tells whether the content is output of dig axfr or host -l rather than a zone file. Content
+// without the banner of dig is output only if every line is a dig or host line, zone files have directives
+// and lines with relative names, without TTL or class.
+func IsTransferOutput(content string) bool {
+	if strings.Contains(content, "; <<>> DiG") {
+		return true
+	}
+	lines := 0
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") || isHostHeader(line) {
+			continue
+		}
+		if strings.HasPrefix(line, "$") {
+			return false
+		}
+		if _, _, _, ok := hostOutputLine(line); !ok && !isDigLine(line) {
+			return false
+		}
+		lines++
+	}
+	return lines > 0
+}
+
+// ParseTransferOutput parses records of the zone from pasted output of dig axfr (or dig with +answer) and
+// host -l. Every line is parsed on its own, lines which can't be imported are returned together as
+// ImportLinesError. Records of host output have no TTL, they get default TTLs of their types.
+func ParseTransferOutput(content string, zone *Zone) ([]Record, error) {
+	var records []Record
+	var failed []ImportLineError
+
+	domain := dns.Fqdn(strings.ToLower(zone.Domain))
+	for number, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		fail := func(reason string) {
+			failed = append(failed, ImportLineError{Line: number + 1, Text: line, Error: reason})
+		}
+
+		if isHostHeader(line) {
+			continue
+		}
+
+		presentation := line
+		hostType, name, data, fromHost := hostOutputLine(line)
+		if fromHost {
+			presentation = dns.Fqdn(name) + " 0 IN " + hostType + " " + data
+		}
+
+		rr, err := dns.NewRR(presentation)
+		if err != nil {
+			fail(err.Error())
+			continue
+		}
+		if rr == nil {
+			continue
+		}
+		header := rr.Header()
+		if !dns.IsSubDomain(domain, strings.ToLower(header.Name)) {
+			fail(header.Name + " is outside of the zone " + domain)
+			continue
+		}
+		if dnssecTypes[header.Rrtype] {
+			continue
+		}
+
+		record, ok := recordFromRR(rr, zone.Domain)
+		if !ok {
+			// SOA and NS records of the apex are ours
+			if header.Rrtype == dns.TypeSOA || (header.Rrtype == dns.TypeNS && strings.EqualFold(header.Name, domain)) {
+				continue
+			}
+			fail("record type " + dns.TypeToString[header.Rrtype] + " is not supported")
+			continue
+		}
+		if fromHost {
+			record.TTL = zone.TypeTTL(record.Type)
+		}
+
+		err = record.Validate()
+		if err != nil {
+			fail(err.Error())
+			continue
+		}
+		records = append(records, record)
+	}
+
+	if len(failed) > 0 {
+		return nil, &ImportLinesError{Lines: failed}
+	}
+	return records, nil
+}
+
+// ParseImport parses records of the imported content, output of dig and host is recognized, anything
+// else is parsed as a zone file
+func ParseImport(content string, zone *Zone) ([]Record, error) {
+	if IsTransferOutput(content) {
+		return ParseTransferOutput(content, zone)
+	}
+	return ParseZoneFile(content, zone.Domain)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportTransferOutput(t *testing.T) {
+	config.TTL = 3600
+	defer func() {
+		config.TTL = 0
+	}()
+
+	zone, errs := NewZone("CC-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+	domain := strings.ToLower(zone.Domain) + "."
+
+	dig := `
+; <<>> DiG 9.18.28 <<>> axfr ` + domain + ` @192.0.2.53
+;; global options: +cmd
+` + domain + `		3600	IN	SOA	ns1.example.net. hostmaster.example.net. 2024010101 7200 3600 1209600 3600
+` + domain + `		3600	IN	NS	ns1.example.net.
+` + domain + `		3600	IN	MX	10 mail.` + domain + `
+` + domain + `		3600	IN	TXT	"v=spf1 include:_spf.example.net" " -all"
+` + domain + `		3600	IN	RRSIG	A 13 2 3600 20240201000000 20240101000000 12345 ` + domain + ` dGVzdA==
+www.` + domain + `	300	IN	A	192.0.2.10
+shop.` + domain + `	300	IN	CNAME	www.` + domain + `
+` + domain + `		3600	IN	SOA	ns1.example.net. hostmaster.example.net. 2024010101 7200 3600 1209600 3600
+;; Query time: 12 msec
+;; XFR size: 8 records (messages 1, bytes 412)
+`
+	assert.True(t, IsTransferOutput(dig))
+	imported, errs := ImportZoneFile(zone.ID, dig)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	var records []string
+	for _, record := range imported.SortedRecords() {
+		records = append(records, record.Name+" "+record.Type+" "+record.Value)
+	}
+	assert.ElementsMatch(t, []string{"@ MX mail", "@ TXT v=spf1 include:_spf.example.net -all", "www A 192.0.2.10", "shop CNAME www"}, records)
+	assert.False(t, IsTransferOutput(imported.Render()), "Zone file")
+	zoneFile := `$TTL 3600
+` + domain + `	3600	IN	MX	10 mail.` + domain + `
+www.` + domain + `	300	IN	A	192.0.2.10
+`
+	assert.False(t, IsTransferOutput(zoneFile), "Zone file with a directive")
+	assert.False(t, IsTransferOutput(`www.`+domain+`	300	IN	A	192.0.2.10
+mail	300	IN	A	192.0.2.11
+`), "Zone file with a relative name")
+
+	host := `Using domain server:
+Name: 192.0.2.53
+Address: 192.0.2.53#53
+Aliases:
+
+` + strings.TrimSuffix(domain, ".") + ` name server ns1.example.net.
+` + strings.TrimSuffix(domain, ".") + ` has address 192.0.2.1
+` + strings.TrimSuffix(domain, ".") + ` mail is handled by 20 mx.example.net.
+www.` + strings.TrimSuffix(domain, ".") + ` has IPv6 address 2001:db8::10
+`
+	imported, errs = ImportZoneFile(zone.ID, host)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if assert.Len(t, imported.Records, 3) {
+		for _, record := range imported.Records {
+			assert.Equal(t, zone.TypeTTL(record.Type), record.TTL, "Default TTL of records without TTL")
+		}
+	}
+
+	// Every line which can't be imported is reported, nothing is imported then
+	invalid := `www.` + domain + `	300	IN	A	192.0.2.11
+www.example.org.	300	IN	A	192.0.2.12
+` + domain + `	300	IN	HINFO	"PC" "Linux"
+bad.` + domain + `	300	IN	A	192.0.2
+`
+	_, errs = ImportZoneFile(zone.ID, invalid)
+	if assert.Len(t, errs, 1) {
+		linesErr, ok := errs[0].(*ImportLinesError)
+		if assert.True(t, ok, errs[0]) && assert.Len(t, linesErr.Lines, 3) {
+			assert.Equal(t, 2, linesErr.Lines[0].Line)
+			assert.Contains(t, linesErr.Lines[0].Error, "outside of the zone")
+			assert.Equal(t, 3, linesErr.Lines[1].Line)
+			assert.Contains(t, linesErr.Lines[1].Error, "HINFO is not supported")
+			assert.Equal(t, 4, linesErr.Lines[2].Line)
+		}
+	}
+	unchanged, _ := GetStore().GetZone(zone.ID)
+	assert.Len(t, unchanged.Records, 3)
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Previous TTL above which the advisory recommends a two-phase migration (seconds)
+const MigrationAdvisoryTTL = 300
+
+// States of record migrations
+const (
+	MigrationStateScheduled = "scheduled" // Lowered TTL is deployed or waits for deployment, value is changed later
+	MigrationStateDone      = "done"
+	MigrationStateFailed    = "failed"
+	MigrationStateCancelled = "cancelled"
+)
+
+// ChangeAdvisory tells how long resolvers may still answer with the data before the change
+type ChangeAdvisory struct {
+	PreviousValue string `json:"previous_value"`
+	PreviousPrio  int    `json:"previous_prio"`
+	PreviousTTL   int    `json:"previous_ttl"` // Old data may stay in caches this long after the zone is deployed
+	Message       string `json:"message"`
+}
+
+// RecordMigrationRequest is the final record of the migration and TTL of the record meanwhile
+type RecordMigrationRequest struct {
+	TTL        int    `json:"ttl"`
+	Prio       int    `json:"prio"`
+	Value      string `json:"value"`
+	LoweredTTL int    `json:"lowered_ttl"`
+}
+
+// RecordMigration is a two-phase change of the record value. TTL of the record is lowered and committed first,
+// the value is changed and committed when the previous TTL expires after the lowered record was deployed.
+type RecordMigration struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	ZoneId   uint `json:"zone_id" sql:"index"`
+	RecordId uint `json:"record_id" sql:"index"`
+
+	// The final state of the record
+	TTL   int    `json:"ttl"`
+	Prio  int    `json:"prio"`
+	Value string `json:"value"`
+
+	PreviousTTL int        `json:"previous_ttl"`
+	LoweredTTL  int        `json:"lowered_ttl"`
+	LoweredAt   *time.Time `json:"lowered_at"` // When the record with lowered TTL was deployed
+	ChangeAt    *time.Time `json:"change_at"`  // When the value is changed, known after the lowered TTL is deployed
+	State       string     `json:"state"`
+	Error       string     `json:"error"`
+}
+
+// Advisory about the change of the record's data, nil if only the name or TTL changed
+func adviseChange(previous *Record, updated *Record) *ChangeAdvisory {
+	if previous.Value == updated.Value && previous.Prio == updated.Prio {
+		return nil
+	}
+
+	advisory := &ChangeAdvisory{
+		PreviousValue: previous.Value,
+		PreviousPrio:  previous.Prio,
+		PreviousTTL:   previous.TTL,
+		Message: "resolvers may answer with the previous value for up to " + strconv.Itoa(previous.TTL) +
+			" seconds after the zone is deployed",
+	}
+	if previous.TTL > MigrationAdvisoryTTL {
+		advisory.Message += "; use the migration endpoint to lower the TTL before changes of this record"
+	}
+	return advisory
+}
+
+// StartRecordMigration lowers TTL of the record and commits the zone, the record gets given TTL, prio and value
+// by RunDueRecordMigrations once the previous TTL expires. Lowered TTL 0 is the lowest TTL allowed in the zone.
+func StartRecordMigration(recordId uint, ttl int, prio int, value string, loweredTTL int) (*RecordMigration, []error) {
+	var record Record
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", recordId).Find(&record).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+	err = db.Where("id = ?", record.ZoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	var running int
+	err = db.Model(&RecordMigration{}).Where("record_id = ? AND state = ?", recordId, MigrationStateScheduled).Count(&running).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+	if running > 0 {
+		return nil, []error{errors.New("record has a scheduled migration already")}
+	}
+
+	if ttl == 0 {
+		ttl = zone.TypeTTL(record.Type)
+	}
+	if loweredTTL == 0 {
+		loweredTTL = zone.RecordTTLBounds().Min
+	}
+	if loweredTTL >= record.TTL {
+		return nil, []error{errors.New("TTL of the record is " + strconv.Itoa(record.TTL) + " already, lowered TTL has to be lower")}
+	}
+
+	// Both the lowered and the final record have to be valid now
+	for _, candidate := range []Record{
+		{Name: record.Name, TTL: loweredTTL, Type: record.Type, Prio: record.Prio, Value: record.Value},
+		{Name: record.Name, TTL: ttl, Type: record.Type, Prio: prio, Value: value},
+	} {
+		candidate.ID = record.ID
+		candidate.Normalize(zone.Domain)
+		validated := zone
+		validated.Records = nil
+		for _, existing := range zone.Records {
+			if existing.ID == record.ID {
+				existing = candidate
+			}
+			validated.Records = append(validated.Records, existing)
+		}
+		errs := validated.Validate()
+		if len(errs) > 0 {
+			return nil, errs
+		}
+	}
+
+	// Deployment of the lowered record is recognized by being newer than the migration
+	started := time.Now()
+	_, errs := UpdateRecord(record.ID, record.Name, loweredTTL, record.Prio, record.Value)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	err = Commit(zone.ID)
+	if err != nil && err != ErrCommitQueued && err != ErrSerialBatched {
+		return nil, []error{err}
+	}
+
+	migration := RecordMigration{
+		CreatedAt:   started,
+		ZoneId:      zone.ID,
+		RecordId:    record.ID,
+		TTL:         ttl,
+		Prio:        prio,
+		Value:       value,
+		PreviousTTL: record.TTL,
+		LoweredTTL:  loweredTTL,
+		State:       MigrationStateScheduled,
+	}
+	err = db.Create(&migration).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+	Audit("record.migration_scheduled", &zone, "record "+strconv.Itoa(int(record.ID))+" TTL lowered from "+
+		strconv.Itoa(record.TTL)+" to "+strconv.Itoa(loweredTTL))
+	setZoneMonitorPaused(zone.ID, true)
+
+	return &migration, nil
+}
+
+// GetRecordMigration returns the latest migration of the record
+func GetRecordMigration(recordId uint) (*RecordMigration, error) {
+	var migration RecordMigration
+
+	db := GetReadDatabaseConnection()
+	err := db.Where("record_id = ?", recordId).Order("id desc").First(&migration).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &migration, nil
+}
+
+// CancelRecordMigration stops the scheduled migration, the record keeps the lowered TTL
+func CancelRecordMigration(recordId uint) (*RecordMigration, error) {
+	migration, err := GetRecordMigration(recordId)
+	if err != nil {
+		return nil, err
+	}
+	if migration.State != MigrationStateScheduled {
+		return nil, errors.New("migration is " + migration.State + " already")
+	}
+
+	err = setMigrationState(migration, MigrationStateCancelled, nil)
+	if err != nil {
+		return nil, err
+	}
+	return migration, nil
+}
+
+func setMigrationState(migration *RecordMigration, state string, migrationErr error) error {
+	migration.State = state
+	if migrationErr != nil {
+		migration.Error = migrationErr.Error()
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Model(&RecordMigration{}).Where("id = ?", migration.ID).
+		Updates(map[string]interface{}{"state": migration.State, "error": migration.Error}).Error
+	if err != nil {
+		return err
+	}
+
+	zone := Zone{ID: migration.ZoneId}
+	message := "record " + strconv.Itoa(int(migration.RecordId))
+	if migrationErr != nil {
+		message += ": " + migrationErr.Error()
+	}
+	Audit("record.migration_"+state, &zone, message)
+	if state != MigrationStateScheduled {
+		resumeZoneMonitorIfIdle(migration.ZoneId)
+	}
+
+	return nil
+}
+
+// RunDueRecordMigrations notes when lowered TTLs got deployed and changes values of records whose previous
+// TTL expired since then
+func RunDueRecordMigrations(now time.Time) {
+	var migrations []RecordMigration
+
+	db := GetDatabaseConnection()
+	err := db.Where("state = ?", MigrationStateScheduled).Order("id").Find(&migrations).Error
+	if err != nil {
+		log.Errorf("loading of record migrations: " + err.Error())
+		return
+	}
+
+	for _, migration := range migrations {
+		if migration.LoweredAt == nil {
+			var zone Zone
+			err = db.Where("id = ?", migration.ZoneId).Find(&zone).Error
+			if gorm.IsRecordNotFoundError(err) {
+				setMigrationState(&migration, MigrationStateFailed, errors.New("zone doesn't exist"))
+				continue
+			}
+			if err != nil || zone.DeployState != DeployStateDeployed || zone.DeployedAt == nil || zone.DeployedAt.Before(migration.CreatedAt.Truncate(time.Second)) {
+				continue
+			}
+
+			changeAt := zone.DeployedAt.Add(time.Duration(migration.PreviousTTL) * time.Second)
+			migration.LoweredAt = zone.DeployedAt
+			migration.ChangeAt = &changeAt
+			err = db.Model(&RecordMigration{}).Where("id = ?", migration.ID).
+				Updates(map[string]interface{}{"lowered_at": migration.LoweredAt, "change_at": migration.ChangeAt}).Error
+			if err != nil {
+				log.Errorf("record migration " + strconv.Itoa(int(migration.ID)) + ": " + err.Error())
+				continue
+			}
+		}
+		if now.Before(*migration.ChangeAt) {
+			continue
+		}
+
+		var record Record
+		err = db.Where("id = ?", migration.RecordId).Find(&record).Error
+		if err != nil {
+			setMigrationState(&migration, MigrationStateFailed, err)
+			continue
+		}
+		_, errs := UpdateRecord(record.ID, record.Name, migration.TTL, migration.Prio, migration.Value)
+		if len(errs) > 0 {
+			setMigrationState(&migration, MigrationStateFailed, errs[0])
+			continue
+		}
+		err = Commit(migration.ZoneId)
+		if err != nil && err != ErrCommitQueued && err != ErrSerialBatched {
+			setMigrationState(&migration, MigrationStateFailed, err)
+			continue
+		}
+		setMigrationState(&migration, MigrationStateDone, nil)
+	}
+}
+
+// RunRecordMigrationsScheduler checks scheduled migrations every minute, it's supposed to run as goroutine
+func RunRecordMigrationsScheduler() {
+	ticker := time.NewTicker(time.Minute)
+
+	for now := range ticker.C {
+		RunDueRecordMigrations(now)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateRecord_advisory(t *testing.T) {
+	zone, errs := NewZone("AU-advisory-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	record, errs := NewRecord(zone.ID, "www", 3600, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	updated, errs := UpdateRecord(record.ID, "www", 3600, 0, "192.0.2.2")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "192.0.2.1", updated.Advisory.PreviousValue)
+	assert.Equal(t, 3600, updated.Advisory.PreviousTTL)
+	assert.Contains(t, updated.Advisory.Message, "migration endpoint")
+
+	// Only TTL changes
+	updated, errs = UpdateRecord(record.ID, "www", 300, 0, "192.0.2.2")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Nil(t, updated.Advisory)
+}
+
+func TestRecordMigration(t *testing.T) {
+	config.TTL = 300
+	config.SkipDeploy = true
+	defer func() {
+		config.TTL = 0
+		config.SkipDeploy = false
+	}()
+
+	zone, errs := NewZone("AU-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	record, errs := NewRecord(zone.ID, "www", 3600, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	_, errs = StartRecordMigration(record.ID, 3600, 0, "192.0.2.2", 7200)
+	assert.Len(t, errs, 1)
+	_, errs = StartRecordMigration(record.ID, 3600, 0, "not an address", 0)
+	assert.Len(t, errs, 1)
+
+	migration, errs := StartRecordMigration(record.ID, 3600, 0, "192.0.2.2", 0)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, MinRecordTTL, migration.LoweredTTL)
+	assert.Equal(t, 3600, migration.PreviousTTL)
+	_, errs = StartRecordMigration(record.ID, 3600, 0, "192.0.2.3", 0)
+	assert.Len(t, errs, 1)
+
+	var stored Record
+	GetDatabaseConnection().Where("id = ?", record.ID).Find(&stored)
+	assert.Equal(t, MinRecordTTL, stored.TTL)
+	assert.Equal(t, "192.0.2.1", stored.Value)
+
+	// The lowered record is deployed, the value waits for the previous TTL
+	now := time.Now()
+	RunDueRecordMigrations(now)
+	migration, err := GetRecordMigration(record.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, MigrationStateScheduled, migration.State)
+	assert.NotNil(t, migration.ChangeAt)
+	GetDatabaseConnection().Where("id = ?", record.ID).Find(&stored)
+	assert.Equal(t, "192.0.2.1", stored.Value)
+
+	RunDueRecordMigrations(now.Add(3601 * time.Second))
+	migration, err = GetRecordMigration(record.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, MigrationStateDone, migration.State)
+	GetDatabaseConnection().Where("id = ?", record.ID).Find(&stored)
+	assert.Equal(t, "192.0.2.2", stored.Value)
+	assert.Equal(t, 3600, stored.TTL)
+
+	_, err = CancelRecordMigration(record.ID)
+	assert.Error(t, err)
+
+	migration, errs = StartRecordMigration(record.ID, 0, 0, "192.0.2.3", 120)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	migration, err = CancelRecordMigration(record.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, MigrationStateCancelled, migration.State)
+}
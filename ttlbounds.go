@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Bounds of record TTLs allowed everywhere, tenants and pools can only tighten them
+const (
+	MinRecordTTL = 60
+	MaxRecordTTL = 2592000
+)
+
+// TTLBounds is the allowed range of record TTLs
+type TTLBounds struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// Parses bounds in MIN-MAX format, one side can be empty (300- or -86400) for the global bound
+func parseTTLBounds(value string) (TTLBounds, error) {
+	bounds := TTLBounds{Min: MinRecordTTL, Max: MaxRecordTTL}
+
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 2 {
+		return bounds, errors.New(value + " has to be in MIN-MAX format, ex. 300-86400")
+	}
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		ttl, err := strconv.Atoi(part)
+		if err != nil {
+			return bounds, errors.New(value + ": " + part + " is not a number")
+		}
+		if i == 0 {
+			bounds.Min = ttl
+		} else {
+			bounds.Max = ttl
+		}
+	}
+
+	return bounds, bounds.Validate()
+}
+
+// Validate checks the bounds are inside the global ones
+func (b TTLBounds) Validate() error {
+	if b.Min < MinRecordTTL || b.Max > MaxRecordTTL || b.Min > b.Max {
+		return errors.New("TTL bounds have to be between " + strconv.Itoa(MinRecordTTL) + " and " + strconv.Itoa(MaxRecordTTL) + " with minimum not above maximum")
+	}
+	return nil
+}
+
+// ValidatePoolTTLBounds checks DNSAPI_POOL_TTL_BOUNDS entries in pool:MIN-MAX format
+func ValidatePoolTTLBounds(entries []string) error {
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return errors.New(entry + " has to be in pool:MIN-MAX format, ex. free:300-86400")
+		}
+		_, err := parseTTLBounds(parts[1])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tightens the bounds by other bounds, 0 on either side leaves the bound as it is
+func (b TTLBounds) tighten(min int, max int) TTLBounds {
+	if min > b.Min {
+		b.Min = min
+	}
+	if max != 0 && max < b.Max {
+		b.Max = max
+	}
+	return b
+}
+
+// RecordTTLBounds returns TTLs allowed in the zone, the global bounds tightened by the zone's pool
+// (DNSAPI_POOL_TTL_BOUNDS) and the zone's tenant
+func (z *Zone) RecordTTLBounds() TTLBounds {
+	bounds := TTLBounds{Min: MinRecordTTL, Max: MaxRecordTTL}
+
+	for _, entry := range config.PoolTTLBounds {
+		parts := strings.SplitN(entry, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) != z.Pool || z.Pool == "" {
+			continue
+		}
+		pool, err := parseTTLBounds(parts[1])
+		if err == nil {
+			bounds = bounds.tighten(pool.Min, pool.Max)
+		}
+	}
+
+	if z.TenantId != 0 {
+		var tenants []Tenant
+		db := GetDatabaseConnection()
+		err := db.Where("id = ?", z.TenantId).Find(&tenants).Error
+		if err != nil {
+			panic(err)
+		}
+		for _, tenant := range tenants {
+			bounds = bounds.tighten(tenant.MinTTL, tenant.MaxTTL)
+		}
+	}
+
+	return bounds
+}
+
+// Check returns error if TTL of the record is out of the bounds
+func (b TTLBounds) Check(r *Record) error {
+	if r.TTL < b.Min || r.TTL > b.Max {
+		return errors.New(r.Type + " " + r.Name + ": TTL has to be number between " + strconv.Itoa(b.Min) + " and " + strconv.Itoa(b.Max) + " in this zone")
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTTLBounds(t *testing.T) {
+	bounds, err := parseTTLBounds("300-86400")
+	assert.Nil(t, err)
+	assert.Equal(t, TTLBounds{Min: 300, Max: 86400}, bounds)
+
+	bounds, err = parseTTLBounds("300-")
+	assert.Nil(t, err)
+	assert.Equal(t, TTLBounds{Min: 300, Max: MaxRecordTTL}, bounds)
+
+	for _, value := range []string{"300", "30-86400", "400-300", "a-300", "300-3000000"} {
+		_, err = parseTTLBounds(value)
+		assert.NotNil(t, err, value)
+	}
+
+	assert.Nil(t, ValidatePoolTTLBounds([]string{"free:300-86400", "premium:-3600"}))
+	assert.NotNil(t, ValidatePoolTTLBounds([]string{"300-86400"}))
+}
+
+func TestZone_RecordTTLBounds(t *testing.T) {
+	config.PoolTTLBounds = []string{"free:120-86400"}
+	defer func() { config.PoolTTLBounds = nil }()
+
+	_, errs := NewTenant(Tenant{Name: "AP invalid", MinTTL: 600, MaxTTL: 300})
+	assert.Len(t, errs, 1)
+	_, errs = NewTenant(Tenant{Name: "AP invalid", MinTTL: 600, DefaultTTL: 300})
+	assert.Len(t, errs, 1)
+
+	tenant, errs := NewTenant(Tenant{Name: "AP free tier", MinTTL: 300})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteTenant(tenant.ID)
+
+	zone, errs := NewZone("AP-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	_, errs = NewRecord(zone.ID, "low", 60, "A", 0, "192.0.2.1")
+	assert.Len(t, errs, 0)
+
+	db := GetDatabaseConnection()
+	err := db.Model(zone).Update("pool", "free").Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, TTLBounds{Min: 120, Max: 86400}, zone.RecordTTLBounds())
+
+	// Existing records have to fit too
+	_, errs = NewRecord(zone.ID, "www", 3600, "A", 0, "192.0.2.2")
+	assert.Len(t, errs, 1)
+	err = db.Model(&Record{}).Where("zone_id = ?", zone.ID).Update("ttl", 120).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errs = NewRecord(zone.ID, "www", 3600, "A", 0, "192.0.2.2")
+	assert.Len(t, errs, 0)
+
+	err = db.Model(zone).Update("tenant_id", tenant.ID).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	zone.TenantId = tenant.ID
+	assert.Equal(t, TTLBounds{Min: 300, Max: 86400}, zone.RecordTTLBounds())
+
+	_, errs = NewRecord(zone.ID, "mail", 100000, "A", 0, "192.0.2.3")
+	assert.Len(t, errs, 2)
+	assert.Contains(t, errs[0].Error(), "between 300 and 86400 in this zone")
+
+	explanation, err := ExplainNewRecord(zone.ID, "mail", 200, "A", 0, "192.0.2.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.False(t, explanation.Valid)
+	assert.Equal(t, "ttl_bounds", explanation.Records[0].Checks[6].Check)
+	assert.Equal(t, CheckFailed, explanation.Records[0].Checks[6].Result)
+}
@@ -1,15 +1,16 @@
 package main
 
 import (
-	"bytes"
+	"encoding/base64"
 	"fmt"
 	"net"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
-	"text/template"
 	"time"
 
+	"github.com/miekg/dns"
 	"github.com/pkg/errors"
 )
 
@@ -24,100 +25,232 @@ type Record struct {
 
 	Name  string `json:"name"`
 	TTL   int    `json:"ttl"`
-	Type  string `json:"type"` // A, AAAA, CNAME, TXT, SRV
+	Type  string `json:"type"` // A, AAAA, CNAME, TXT, SRV, MX, NS, PTR, NAPTR, URI, LOC, ALIAS
 	Prio  int    `json:"prio"`
 	Value string `json:"value"`
+
+	// Label of the controller managing the record through the apply endpoint, empty for manual records
+	Owner string `json:"owner" sql:"index"`
+
+	// Rendered as a comment on the line before the record in the zone file
+	Comment string `json:"comment"`
+
+	// Addresses of the ALIAS target separated by comma, resolved by commits and DNSAPI_ALIAS_INTERVAL refreshes
+	Resolved   string     `json:"resolved,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+
+	// Returned by updates changing the value, not stored
+	Advisory *ChangeAdvisory `json:"advisory,omitempty" sql:"-"`
 }
 
-// Validates the record
-func (r *Record) Validate() error {
-	// Test name
-	matched, err := regexp.MatchString(`[a-z\.0-9@\-]{1,254}`, r.Value)
-	if err != nil {
-		panic(err)
-	}
-	if !matched {
-		return errors.New(r.Type + " " + r.Name + ": name of the record is not in valid format")
+// Check of a record done by Record.Validate. Reference is the specification or the policy behind the check,
+// empty for checks belonging to the record type which use its Reference.
+type recordCheck struct {
+	Name      string
+	Reference string
+	Check     func(r *Record, recordType *RecordType) error
+}
+
+// Checks of Record.Validate in the order they run, the record type is known in checks after "type"
+var recordChecks = []recordCheck{
+	{Name: "name", Reference: "RFC 1035 section 2.3.1, RFC 4592, RFC 8552", Check: func(r *Record, recordType *RecordType) error {
+		err := validateRecordName(r.Name)
+		if err != nil {
+			return errors.New(r.Type + " " + r.Name + ": " + err.Error())
+		}
+		if recordType != nil && !recordType.UnderscoreNames && strings.Contains(r.Name, "_") {
+			return errors.New(r.Type + " " + r.Name + ": underscores are allowed only in names of " + strings.Join(UnderscoreRecordTypes(), ", ") + " records")
+		}
+		if r.Type == "NS" && isWildcardName(r.Name) {
+			return errors.New(r.Type + " " + r.Name + ": NS records can't have wildcard names")
+		}
+		return nil
+	}},
+	{Name: "ttl", Reference: "RFC 2181 section 8", Check: func(r *Record, recordType *RecordType) error {
+		if r.TTL < MinRecordTTL || r.TTL > MaxRecordTTL {
+			return errors.New(r.Type + " " + r.Name + ": TTL has to be number between " + strconv.Itoa(MinRecordTTL) + " and " + strconv.Itoa(MaxRecordTTL))
+		}
+		return nil
+	}},
+	{Name: "type", Reference: "RFC 1035 section 3.2.2", Check: func(r *Record, recordType *RecordType) error {
+		if recordType == nil {
+			return errors.New("Unknown record type")
+		}
+		return nil
+	}},
+	{Name: "length", Check: func(r *Record, recordType *RecordType) error {
+		if recordType.MaxLength > 0 && len(r.Value) > recordType.MaxLength {
+			return errors.New(r.Type + " " + r.Name + ": value is longer than " + strconv.Itoa(recordType.MaxLength) + " characters")
+		}
+		return nil
+	}},
+	{Name: "value", Check: func(r *Record, recordType *RecordType) error {
+		if recordType.Validate != nil {
+			return recordType.Validate(r)
+		}
+		return nil
+	}},
+	{Name: "syntax", Reference: "RFC 1035 section 5.1", Check: func(r *Record, recordType *RecordType) error {
+		return parseRecordLine(r)
+	}},
+}
+
+// Parses the rendered line of the record as a resource record of the zone file, so nothing BIND would refuse
+// gets into the zone. Names are relative to the root here, lengths of names in the zone are checked by
+// lintRenderLimits. Types unknown to the DNS library, ex. ALIAS, are skipped and so is LOC, the library
+// refuses positions without seconds which RFC 1876 allows and checkLOC checks all of its value.
+func parseRecordLine(r *Record) error {
+	rrType, ok := dns.StringToType[r.Type]
+	if !ok || r.Type == "LOC" {
+		return nil
 	}
 
-	// Test TTL
-	if r.TTL < 60 || r.TTL > 2592000 {
-		return errors.New(r.Type + " " + r.Name + ": TTL has to be number between 60 and 2592000")
+	parser := dns.NewZoneParser(strings.NewReader(r.Render()+"\n"), ".", "")
+	var parsed []dns.RR
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		parsed = append(parsed, rr)
+	}
+	if err := parser.Err(); err != nil {
+		return errors.New(r.Type + " " + r.Name + ": record is not valid in zone file, " + strings.TrimPrefix(err.Error(), "dns: "))
+	}
+	if len(parsed) != 1 || parsed[0].Header().Rrtype != rrType {
+		return errors.New(r.Type + " " + r.Name + ": record is not valid in zone file")
 	}
 
-	// Test the rest
-	if r.Type == "A" {
-		parsed := net.ParseIP(r.Value)
+	return nil
+}
 
-		if parsed == nil || !strings.Contains(r.Value, ".") {
-			return errors.New(r.Type + " " + r.Name + ": IP address of A record is not valid")
-		}
-	} else if r.Type == "AAAA" {
-		parsed := net.ParseIP(r.Value)
+// Labels of record names: letters, digits, hyphens, underscores and / of RFC 2317 delegations. Underscores
+// are allowed only by some record types, see RecordType.UnderscoreNames.
+// Lengths of labels and names are checked with the rendered zone, see checkRenderLimits.
+var recordLabelPattern = regexp.MustCompile(`^[a-z0-9_/\-]+$`)
+
+// Checks name of the record, @ is the apex and names outside the zone end with dot. Only the whole leftmost
+// label can be * (RFC 4592 section 2.1.1): *.www is a wildcard, www.* and *www are not valid names.
+func validateRecordName(name string) error {
+	if name == "@" {
+		return nil
+	}
 
-		if parsed == nil || !strings.Contains(r.Value, ":") {
-			return errors.New(r.Type + " " + r.Name + ": IP address of AAAA record is not valid")
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(name), "."), ".")
+	for i, label := range labels {
+		if label == "*" && i == 0 {
+			continue
 		}
-	} else if r.Type == "CNAME" {
-		matched, err := regexp.MatchString(`[a-z\.0-9@\-]{1,254}`, r.Value)
-		if err != nil {
-			panic(err)
+		if strings.Contains(label, "*") {
+			return errors.New("* can be only the whole leftmost label of the name")
 		}
-		if !matched {
-			return errors.New(r.Type + " " + r.Name + ": CNAME has not a valid value")
+		if !recordLabelPattern.MatchString(label) {
+			return errors.New("name of the record is not in valid format")
 		}
-	} else if r.Type == "TXT" {
-		if strings.Contains(r.Value, "\"") || strings.Contains(r.Value, "'") || strings.Contains(r.Value, "`") {
-			return errors.New(r.Type + " " + r.Name + ": characters \"' or ` are not allowed in TXT records")
+	}
+
+	return nil
+}
+
+// Checks the target of CNAME record, it can have underscores (ex. s1._domainkey.example.net.) and / of
+// RFC 2317 delegations but it can't be a wildcard or an IP address. The root is the blocking target of
+// RPZ zones.
+func validateTarget(target string) error {
+	if target == "@" || target == RPZBlockValue {
+		return nil
+	}
+	if target == "" || net.ParseIP(strings.TrimSuffix(target, ".")) != nil {
+		return errors.New("target has to be a domain name")
+	}
+
+	for _, label := range strings.Split(strings.TrimSuffix(target, "."), ".") {
+		if !recordLabelPattern.MatchString(label) {
+			return errors.New("target has to be a domain name")
 		}
-	} else if r.Type == "SRV" {
-	} else if r.Type == "MX" {
-		if r.Prio <= 0 && r.Prio <= 100 {
-			return errors.New(r.Type + " " + r.Name + ": Prio has to be bigger than 0 and smaller than 100")
+	}
+
+	return nil
+}
+
+// True if the name is a wildcard, the apex of the zone has to be written as *
+func isWildcardName(name string) bool {
+	return name == "*" || strings.HasPrefix(name, "*.")
+}
+
+// Validates the record
+func (r *Record) Validate() error {
+	recordType := GetRecordType(r.Type)
+	for _, check := range recordChecks {
+		err := check.Check(r, recordType)
+		if err != nil {
+			return err
 		}
-		//TODO: Has to be domain and valid A/AAAA record (even in different location)
-	} else {
-		return errors.New("Unknown record type")
 	}
 
 	return nil
 }
 
+// Normalize converts the record into its canonical form so equal records look the same, domain is the zone's domain
+func (r *Record) Normalize(domain string) {
+	r.Name = normalizeName(r.Name, domain)
+	r.Type = strings.ToUpper(strings.TrimSpace(r.Type))
+	if r.Type == "ANAME" {
+		r.Type = "ALIAS"
+	}
+	r.Value = strings.TrimSpace(r.Value)
+
+	recordType := GetRecordType(r.Type)
+	if recordType != nil && recordType.Normalize != nil {
+		recordType.Normalize(r, domain)
+	}
+}
+
+// Lowercases the name, converts Unicode labels to punycode and makes names inside the zone relative, the apex is always @.
+// Names without trailing dot are already relative and they are not changed.
+func normalizeName(name string, domain string) string {
+	name = asciiName(strings.ToLower(strings.TrimSpace(name)))
+	domain = asciiName(strings.ToLower(strings.TrimSuffix(domain, ".")))
+
+	if name == "" || name == "@" || name == domain+"." {
+		return "@"
+	}
+	if strings.HasSuffix(name, "."+domain+".") {
+		return strings.TrimSuffix(name, "."+domain+".")
+	}
+
+	return name
+}
+
 // Render renders one record
 func (r *Record) Render() string {
-	var value = r.Value
-
-	// In case of TXT, we have to split large records into lines
-	if r.Type == "TXT" {
-		var part = 254
-		var length = len(r.Value)
-		var last = length % part
-		var parts []string
-
-		for current := 0; current < length; current += part {
-			if current+part > length {
-				parts = append(parts, r.Value[current:current+last])
-			} else {
-				parts = append(parts, r.Value[current:current+part])
-			}
-		}
+	return r.renderColumns(0, 0, 0, 0)
+}
 
-		value = "(\"" + strings.Join(parts, "\"\n        \"") + "\")"
+// RenderData renders data part of the record, everything after its type
+func (r *Record) RenderData() string {
+	recordType := GetRecordType(r.Type)
+	if recordType != nil && recordType.RenderData != nil {
+		return recordType.RenderData(r)
 	}
 
-	// If the record is MX, add prio
-	if r.Type == "MX" {
-		return r.Name + "    " +
-			strconv.Itoa(r.TTL) + "s    " +
-			r.Type + "  " +
-			strconv.Itoa(r.Prio) + "    " +
-			value
-	} else {
-		return r.Name + "    " +
-			strconv.Itoa(r.TTL) + "s    " +
-			r.Type + "      " +
-			value
+	return r.Value
+}
+
+// Renders the record with name, TTL and type padded to given widths so records of a zone are aligned.
+// TTL equal to the zone's $TTL (defaultTTL, 0 for none) is left out.
+func (r *Record) renderColumns(nameWidth int, ttlWidth int, typeWidth int, defaultTTL int) string {
+	pad := func(value string, width int) string {
+		if len(value) < width {
+			return value + strings.Repeat(" ", width-len(value))
+		}
+		return value
+	}
+
+	ttl := strconv.Itoa(r.TTL) + "s"
+	if defaultTTL > 0 && r.TTL == defaultTTL {
+		ttl = ""
 	}
+
+	return pad(r.Name, nameWidth) + "    " +
+		pad(ttl, ttlWidth) + "    " +
+		pad(r.Type, typeWidth) + "      " +
+		r.RenderData()
 }
 
 // Zone struct
@@ -128,44 +261,206 @@ type Zone struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Delete    bool      `json:"delete" gorm:"DEFAULT:0"`
 
+	// Active, suspended, pending-delete or purged, see SetZoneLifecycle
+	Lifecycle string `json:"lifecycle" gorm:"DEFAULT:'active'" sql:"index"`
+
+	DeployState   string     `json:"deploy_state" gorm:"DEFAULT:'pending'" sql:"index"`
+	DeployError   string     `json:"deploy_error"` // Error of the last failed deployment
+	DeployedAt    *time.Time `json:"deployed_at"`
+	DeployWindows string     `json:"deploy_windows"` // Comma separated HH:MM-HH:MM in local time, empty for no restriction
+
+	TenantId uint   `json:"tenant_id" sql:"index"` // 0 for zones without tenant
+	Pool     string `json:"pool"`                  // Name server pool serving the zone
+	TTL      int    `json:"ttl"`                   // Default TTL of the zone's records, 0 means DNSAPI_TTL
+
+	TypeTTLs string `json:"type_ttls" gorm:"column:type_ttls"` // Default TTLs of new records by type, ex. A:300,MX:3600, before DNSAPI_TYPE_TTLS
+
+	MinimumTTL int `json:"minimum_ttl" gorm:"column:minimum_ttl"` // SOA minimum (negative caching TTL), 0 means DNSAPI_MINIMAL_TTL
+
+	// SOA timers of secondaries, 0 means DNSAPI_TIME_TO_REFRESH, DNSAPI_TIME_TO_RETRY and DNSAPI_TIME_TO_EXPIRE
+	Refresh int `json:"refresh"`
+	Retry   int `json:"retry"`
+	Expire  int `json:"expire"`
+
+	ReservedNames string `json:"reserved_names"` // Names separated by comma, their records can be changed only with the admin token
+
+	// Custom variables of record values, comma separated name=value pairs, ex. cdn=shop.cdn.example.net.
+	Variables string `json:"variables"`
+
+	// Parking replaces records of the zone, the previous ones are archived for restore
+	Parked        bool       `json:"parked" gorm:"DEFAULT:0"`
+	ParkedAt      *time.Time `json:"parked_at"`
+	ParkedRecords string     `json:"-"` // JSON of archived records
+
+	// Bumps of the serial are limited above DNSAPI_SERIAL_SOFT_LIMIT a day
+	SerialBumpedAt *time.Time `json:"serial_bumped_at"` // When the serial was changed the last time
+	NextSerial     string     `json:"next_serial"`      // Serial used by the next commit as it is, live serials aren't checked
+
+	// Mirror in the standby server (DNSAPI_STANDBY_SERVER) updated after every commit
+	Standby         bool       `json:"standby" gorm:"DEFAULT:0"`
+	StandbyState    string     `json:"standby_state"` // synced or failed, empty before the first sync
+	StandbyError    string     `json:"standby_error"`
+	StandbySyncedAt *time.Time `json:"standby_synced_at"`
+	StandbyRRsets   string     `json:"-" gorm:"column:standby_rrsets"` // JSON of RRsets synced the last time
+
+	WWWSync string `json:"www_sync" gorm:"column:www_sync"` // apex (www follows the apex), www (the apex follows www) or empty
+
+	// External monitoring of the zone's service, alerting is paused during scheduled record migrations
+	MonitorURL       string     `json:"monitor_url"`    // Status check URL called every DNSAPI_MONITOR_INTERVAL seconds
+	MonitorID        string     `json:"monitor_id"`     // ID of the check in the monitoring system, see DNSAPI_MONITORING_PAUSE_URL
+	MonitorStatus    string     `json:"monitor_status"` // up or down, empty before the first check
+	MonitorCheckedAt *time.Time `json:"monitor_checked_at"`
+	MonitorPaused    bool       `json:"monitor_paused" gorm:"DEFAULT:0"`
+
+	// Registration of the domain looked up through RDAP every DNSAPI_RDAP_INTERVAL seconds
+	Registrar             string     `json:"registrar"`
+	RegistrationExpiresAt *time.Time `json:"registration_expires_at"`
+	RegistrationCheckedAt *time.Time `json:"registration_checked_at"`
+	RegistrationError     string     `json:"registration_error"` // Error of the last lookup, the last known registration is kept
+
+	// Context for operators, rendered as comments at the start of the zone file
+	Notes string `json:"notes"`
+
 	Domain     string   `json:"domain" sql:"index"`
 	Serial     string   `json:"serial"`
 	Records    []Record `json:"records" gorm:"foreignkey:ZoneID"`
 	Tags       string   `json:"tags"` // Tags separated by comma
 	AbuseEmail string   `json:"abuse_email"`
+	DNSSEC     bool     `json:"dnssec" gorm:"column:dnssec;DEFAULT:0"` // Sign the zone on the primary server
+
+	// Verification of the abuse email
+	AbuseEmailVerified   bool       `json:"abuse_email_verified" gorm:"DEFAULT:0"`
+	AbuseEmailVerifiedAt *time.Time `json:"abuse_email_verified_at"`
+	AbuseEmailToken      string     `json:"-" sql:"index"`
+
+	// Customer's own secondary servers allowed to transfer the zone
+	TransferIPs   string `json:"transfer_ips" gorm:"column:transfer_ips"`     // IPs separated by comma
+	TSIGAlgorithm string `json:"tsig_algorithm" gorm:"column:tsig_algorithm"` // ex. hmac-sha256
+	TSIGSecret    string `json:"tsig_secret" gorm:"column:tsig_secret"`       // Base64 encoded secret
+
+	// Options of the zone's stanza, empty ones are taken from the name server
+	BindOptions
 }
 
+// Deployment states of zones
+const (
+	DeployStatePending  = "pending"  // There are changes which were not deployed yet
+	DeployStateDeployed = "deployed" // Last commit was deployed successfully
+	DeployStateFailed   = "failed"   // Last deployment failed, see DeployError
+	DeployStateFrozen   = "frozen"   // Deployments are stopped by operator
+	DeployStateQueued   = "queued"   // Committed outside of deployment window, deployed when it opens
+)
+
+var ErrZoneFrozen = errors.New("zone is frozen, unfreeze it before commit")
+var ErrZoneDeleted = errors.New("zone is being deleted")
+var ErrCommitInProgress = errors.New("zone is being committed, try it again later")
+
+// Supported TSIG algorithms
+var TSIGAlgorithms = []string{"hmac-sha1", "hmac-sha224", "hmac-sha256", "hmac-sha384", "hmac-sha512"}
+
+// SetNewSerial sets the next serial of the zone in DNSAPI_SERIAL_FORMAT
 func (z *Zone) SetNewSerial() {
-	today := time.Now().UTC().Format("20060102")
+	z.setSerialAt(time.Now())
+}
 
-	if z.Serial == "" || len(z.Serial) != 10 {
-		z.Serial = today + "01"
-	} else {
-		if today == z.Serial[0:8] {
-			number, err := strconv.Atoi(z.Serial[8:10])
-			if err != nil {
-				panic(err)
-			}
-			z.Serial = today + fmt.Sprintf("%02d", number+1)
-		} else {
-			z.Serial = today + "01"
+func (z *Zone) setSerialAt(now time.Time) {
+	if config.SerialFormat == SerialFormatUnixTime {
+		z.Serial = unixTimeSerial(z.Serial, now)
+		return
+	}
+
+	today := now.UTC().Format("20060102")
+	next := today + "01"
+	if len(z.Serial) == 10 && z.Serial[0:8] == today {
+		number, err := strconv.Atoi(z.Serial[8:10])
+		if err == nil && number < MaxDailySerialBumps {
+			next = today + fmt.Sprintf("%02d", number+1)
 		}
 	}
+
+	// The 100th serial of the day and serials of later days (ex. bumped over live serials) continue by one,
+	// the serial can't overflow into 11 digits or get older (RFC 1982)
+	current, err := strconv.ParseUint(z.Serial, 10, 32)
+	candidate, _ := strconv.ParseUint(next, 10, 32)
+	if err == nil && !serialNewer(uint32(candidate), uint32(current)) {
+		next = strconv.FormatUint(uint64(uint32(current)+1), 10)
+	}
+	z.Serial = next
+}
+
+// Returns IPs of customer's secondary servers
+func (z *Zone) TransferIPList() []string {
+	var ips []string
+
+	for _, ip := range strings.Split(z.TransferIPs, ",") {
+		ip = strings.TrimSpace(ip)
+		if ip != "" {
+			ips = append(ips, ip)
+		}
+	}
+
+	return ips
+}
+
+// Name of the TSIG key used by customer's secondaries. It's derived from the domain so it's unique in Bind's config.
+func (z *Zone) TSIGKeyName() string {
+	if z.TSIGSecret == "" {
+		return ""
+	}
+	return "transfer-" + z.Domain
+}
+
+// Returns TTL of the zone file ($TTL), TTL of records created without TTL unless their type has its own, see TypeTTL
+func (z *Zone) DefaultTTL() int {
+	if z.TTL > 0 {
+		return z.TTL
+	}
+	return config.TTL
+}
+
+// Bounds of zone's negative caching TTL
+const (
+	MinNegativeTTL = 60
+	MaxNegativeTTL = 86400
+)
+
+// NegativeTTL returns SOA minimum of the zone, how long resolvers cache non-existence of names
+func (z *Zone) NegativeTTL() int {
+	if z.MinimumTTL > 0 {
+		return z.MinimumTTL
+	}
+	return config.MinimalTTL
 }
 
 func (z *Zone) RenderAbuseEmail() string {
 	if z.AbuseEmail == "" {
+		if tenant := z.tenant(); tenant != nil && tenant.DefaultAbuseEmail != "" {
+			return renderRName(tenant.DefaultAbuseEmail)
+		}
 		return config.RenderEmail()
 	} else {
-		return strings.Replace(z.AbuseEmail, "@", ".", -1)
+		return renderRName(z.AbuseEmail)
 	}
 }
 
+// Converts email into SOA RNAME format, dots in the local part have to be escaped
+func renderRName(email string) string {
+	parts := strings.SplitN(email, "@", 2)
+	if len(parts) != 2 {
+		return email
+	}
+	return strings.Replace(parts[0], ".", "\\.", -1) + "." + parts[1]
+}
+
 func (z *Zone) AddRecord(name string, ttl int, recordType string, prio int, value string) (*Record, []error) {
 	if z.ID == 0 {
 		return nil, []error{errors.New("zone is not saved")}
 	}
 
+	if ttl == 0 {
+		ttl = z.TypeTTL(recordType)
+	}
+
 	var record = Record{
 		ZoneId: z.ID,
 		Name:   name,
@@ -174,16 +469,34 @@ func (z *Zone) AddRecord(name string, ttl int, recordType string, prio int, valu
 		Prio:   prio,
 		Value:  value,
 	}
+	record.Normalize(z.Domain)
 
 	z.Records = append(z.Records, record)
 
 	return &record, z.Validate()
 }
 
+// Maximal length of zone's domain in presentation format without the trailing dot (RFC 1035 section 2.3.4)
+const MaxDomainLength = 253
+
+// Domain of the zone is part of zone files, BIND configs, file paths and commands run on name servers, so only
+// letters, digits and hyphens (punycode for IDN) in labels up to 63 characters are allowed
+func validateZoneDomain(domain string) error {
+	if _, ok := dns.IsDomainName(domain); !ok {
+		return errors.New(strconv.Quote(domain) + " is not a valid domain name")
+	}
+	if len(strings.TrimSuffix(domain, ".")) > MaxDomainLength {
+		return errors.New("domain name can't be longer than " + strconv.Itoa(MaxDomainLength) + " characters")
+	}
+	if !hostnamePattern.MatchString(strings.ToLower(domain)) {
+		return errors.New("domain name " + strconv.Quote(domain) + " can contain only letters, digits and hyphens in labels up to 63 characters")
+	}
+	return nil
+}
+
 // Validates records in the zone
 func (z *Zone) Validate() []error {
-	var errorsMsgs []error
-	var usedNames []string
+	errorsMsgs := runValidateHooks(z)
 
 	var numberOfExistingDomains int
 	db := GetDatabaseConnection()
@@ -196,21 +509,32 @@ func (z *Zone) Validate() []error {
 		errorsMsgs = append(errorsMsgs, errors.New("domain already exists"))
 	}
 
-	for _, record := range z.Records {
-		err := record.Validate()
+	err = ValidateVariables(z.Variables)
+	if err != nil {
+		errorsMsgs = append(errorsMsgs, err)
+	}
+
+	// Records are validated with values of their variables
+	// Tenant or pool can allow only part of the TTLs
+	records, undefined := z.expandRecords(z.Records)
+	bounds := z.RecordTTLBounds()
+	for i, record := range records {
+		err := undefined[i]
+		if err == nil {
+			err = record.Validate()
+		}
+		if err == nil {
+			err = bounds.Check(&record)
+		}
 		if err != nil {
 			errorsMsgs = append(errorsMsgs, err)
 		}
-
-		if record.Type == "A" || record.Type == "AAAA" || record.Type == "CNAME" {
-			usedNames = append(usedNames, record.Name)
-		}
 	}
+	errorsMsgs = append(errorsMsgs, validateForbiddenValues(z)...)
 
 	// Additional checks
 
 	// Domain name has to exist
-	// TODO: make this better
 	if len(z.Domain) < 3 {
 		errorsMsgs = append(errorsMsgs, errors.New("domain name has to be longer than three characters"))
 	}
@@ -219,24 +543,187 @@ func (z *Zone) Validate() []error {
 		errorsMsgs = append(errorsMsgs, errors.New("domain name has to contain at least one dot"))
 	}
 
-	// CNAME record can't have same name as another AAAA record, A record or CNAME record
-	for _, record := range z.Records {
-		if record.Type == "CNAME" {
-			count := 0
-			for _, usedName := range usedNames {
-				if usedName == record.Name {
-					count += 1
-				}
-			}
-			if count > 1 {
-				errorsMsgs = append(errorsMsgs, errors.New(record.Type+" "+record.Name+" is already used in another A/AAAA/CNAME record"))
+	err = validateZoneDomain(z.Domain)
+	if err != nil {
+		errorsMsgs = append(errorsMsgs, err)
+	}
+
+	if z.IsReverse() {
+		err := validateReverseZone(z.Domain)
+		if err != nil {
+			errorsMsgs = append(errorsMsgs, err)
+		}
+	}
+
+	if z.AbuseEmail != "" && !validEmail(z.AbuseEmail) {
+		errorsMsgs = append(errorsMsgs, errors.New(z.AbuseEmail+" is not a valid abuse email address"))
+	}
+
+	if z.MinimumTTL != 0 && (z.MinimumTTL < MinNegativeTTL || z.MinimumTTL > MaxNegativeTTL) {
+		errorsMsgs = append(errorsMsgs, errors.New("minimum TTL has to be number between "+strconv.Itoa(MinNegativeTTL)+" and "+strconv.Itoa(MaxNegativeTTL)))
+	}
+
+	err = validateSOATimers(z)
+	if err != nil {
+		errorsMsgs = append(errorsMsgs, err)
+	}
+
+	err = ValidateDeployWindows(z.DeployWindows)
+	if err != nil {
+		errorsMsgs = append(errorsMsgs, err)
+	}
+
+	// Customer's secondaries
+	for _, ip := range z.TransferIPList() {
+		if net.ParseIP(ip) == nil {
+			errorsMsgs = append(errorsMsgs, errors.New(ip+" is not a valid IP address of a secondary server"))
+		}
+	}
+	if z.TSIGSecret != "" {
+		_, err := base64.StdEncoding.DecodeString(z.TSIGSecret)
+		if err != nil {
+			errorsMsgs = append(errorsMsgs, errors.New("TSIG secret has to be base64 encoded"))
+		}
+
+		validAlgorithm := false
+		for _, algorithm := range TSIGAlgorithms {
+			if z.TSIGAlgorithm == algorithm {
+				validAlgorithm = true
 			}
 		}
+		if !validAlgorithm {
+			errorsMsgs = append(errorsMsgs, errors.New("TSIG algorithm has to be one of "+strings.Join(TSIGAlgorithms, ", ")))
+		}
+	}
+
+	conflicts := cnameConflicts(z.Records)
+	for i := range z.Records {
+		if conflicts[i] != nil {
+			errorsMsgs = append(errorsMsgs, conflicts[i])
+		}
+	}
+	duplicates := duplicateRecords(records)
+	for i := range z.Records {
+		if duplicates[i] != nil {
+			errorsMsgs = append(errorsMsgs, duplicates[i])
+		}
 	}
 
 	return errorsMsgs
 }
 
+// CNAME record can't share its name with any other record and can't be at the apex where SOA and NS records of
+// the zone are, RFC 1034 section 3.6.2. ALIAS is rendered as A and AAAA records so it can't share the name with
+// A, AAAA, CNAME or another ALIAS record. Returns errors by indexes of the conflicting CNAME and ALIAS records.
+func cnameConflicts(records []Record) map[int]error {
+	conflicts := make(map[int]error)
+	usedNames := make(map[string]int)
+	addressNames := make(map[string]int)
+	for _, record := range records {
+		name := strings.ToLower(record.Name)
+		usedNames[name]++
+		if record.Type == "A" || record.Type == "AAAA" || record.Type == "CNAME" || record.Type == "ALIAS" {
+			addressNames[name]++
+		}
+	}
+
+	for i, record := range records {
+		switch {
+		case record.Type == "CNAME" && record.Name == "@":
+			conflicts[i] = errors.New("CNAME @ can't be at the apex of the zone, it would conflict with SOA and NS records")
+		case record.Type == "CNAME" && usedNames[strings.ToLower(record.Name)] > 1:
+			conflicts[i] = errors.New("CNAME " + record.Name + " is already used in another record, CNAME can't share its name with any other record")
+		case record.Type == "ALIAS" && addressNames[strings.ToLower(record.Name)] > 1:
+			conflicts[i] = errors.New(record.Type + " " + record.Name + " is already used in another A/AAAA/CNAME/ALIAS record")
+		}
+	}
+
+	return conflicts
+}
+
+// Records with the same name, type, prio and value are duplicates whatever their TTL is. Names differ only
+// in case and addresses written differently (2001:db8::1 and 2001:DB8:0::1) are the same record too. Returns
+// errors by indexes of the records repeating an earlier record.
+func duplicateRecords(records []Record) map[int]error {
+	duplicates := make(map[int]error)
+	usedRecords := make(map[string]bool)
+	for i, record := range records {
+		value := record.Value
+		if record.Type == "A" || record.Type == "AAAA" {
+			if parsed := net.ParseIP(record.Value); parsed != nil {
+				value = parsed.String()
+			}
+		}
+
+		key := record.Type + " " + strings.ToLower(record.Name) + " " + strconv.Itoa(record.Prio) + " " + value
+		if usedRecords[key] {
+			if record.Type == "A" || record.Type == "AAAA" {
+				duplicates[i] = errors.New(record.Type + " " + record.Name + ": record with address " + value + " already exists")
+			} else {
+				duplicates[i] = errors.New(record.Type + " " + record.Name + ": the same record with value " + value + " already exists")
+			}
+		}
+		usedRecords[key] = true
+	}
+
+	return duplicates
+}
+
+// Labels of the name from the top level down, "@" has no labels, used for ordering of records
+func reversedLabels(name string) []string {
+	var labels []string
+	if name == "@" || name == "" {
+		return labels
+	}
+
+	parts := strings.Split(strings.ToLower(strings.TrimSuffix(name, ".")), ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		labels = append(labels, parts[i])
+	}
+	return labels
+}
+
+// Compares names in DNS canonical order, names closer to the apex go first
+func compareNames(a string, b string) int {
+	labelsA := reversedLabels(a)
+	labelsB := reversedLabels(b)
+
+	for i := 0; i < len(labelsA) && i < len(labelsB); i++ {
+		if labelsA[i] != labelsB[i] {
+			return strings.Compare(labelsA[i], labelsB[i])
+		}
+	}
+	return len(labelsA) - len(labelsB)
+}
+
+// SortedRecords returns copy of zone's records in stable order: by name (apex first), type, prio and value
+func (z *Zone) SortedRecords() []Record {
+	records := make([]Record, len(z.Records))
+	copy(records, z.Records)
+
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if c := compareNames(a.Name, b.Name); c != 0 {
+			return c < 0
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Prio != b.Prio {
+			return a.Prio < b.Prio
+		}
+		if a.Value != b.Value {
+			return a.Value < b.Value
+		}
+		if a.TTL != b.TTL {
+			return a.TTL < b.TTL
+		}
+		return a.ID < b.ID
+	})
+
+	return records
+}
+
 // Renders whole zone
 func (z *Zone) Render() string {
 	var zone string
@@ -250,85 +737,145 @@ func (z *Zone) Render() string {
 		<minimum-TTL> )
 	*/
 
-	zone = `$TTL ` + strconv.Itoa(config.TTL) + `s
-@       IN      SOA     ` + config.PrimaryNameServer + `. ` + z.RenderAbuseEmail() + `.  (
+	zone = renderComment(z.Notes) + `$TTL ` + strconv.Itoa(z.DefaultTTL()) + `s
+@       IN      SOA     ` + z.SOAMName() + `. ` + z.RenderAbuseEmail() + `.  (
 		` + z.Serial + `
-		` + strconv.Itoa(config.TimeToRefresh) + `
-		` + strconv.Itoa(config.TimeToRetry) + `
-		` + strconv.Itoa(config.TimeToExpire) + `
-		` + strconv.Itoa(config.MinimalTTL) + `
+		` + strconv.Itoa(z.RefreshTime()) + `
+		` + strconv.Itoa(z.RetryTime()) + `
+		` + strconv.Itoa(z.ExpireTime()) + `
+		` + strconv.Itoa(z.NegativeTTL()) + `
 )
 `
-	for _, nameserver := range config.NameServers {
+	for _, nameserver := range z.ApexNameServers() {
 		zone += "@    IN    NS    " + nameserver + ".\n"
 	}
-	//zone += "\n"
-
-	for _, record := range z.Records {
-		zone += record.Render()
+	if config.RenderGroups {
 		zone += "\n"
 	}
 
+	// Stable order and aligned columns so the output can be diffed, TTLs equal to $TTL are left out.
+	// ALIAS records are rendered as A and AAAA records of their resolved addresses, variables by their values.
+	expanded, _ := z.expandRecords(z.Records)
+	flattened := Zone{Records: flattenAliases(expanded)}
+	zone += renderRecords(renderOrder(flattened.SortedRecords()), z.DefaultTTL())
+
 	return zone
 }
 
-func (z *Zone) RenderPrimary() string {
-	primaryTemplate := `zone "{{ .Domain }}" IN {
+// Built-in stanza of the primary, replaced by DNSAPI_PRIMARY_STANZA
+const primaryStanzaTemplate = `
+{{- if .TSIGKeyName -}}
+key "{{ .TSIGKeyName }}" {
+        algorithm {{ .TSIGAlgorithm }};
+        secret "{{ .TSIGSecret }}";
+};
+{{ end -}}
+zone "{{ .Domain }}" IN {
         type master;
         masterfile-format text;
         file "{{ .Domain }}.zone";
+{{- if .Journal }}
+        journal "{{ .Journal }}";
+{{- end }}
+{{- if .MaxJournalSize }}
+        max-journal-size {{ .MaxJournalSize }};
+{{- end }}
         allow-query { any; };
         allow-transfer { {{ .AllowTransfer}}; };
         notify yes;
+{{- if .AlsoNotify }}
+        also-notify { {{ .AlsoNotify }}; };
+{{- end }}
+{{- if .KeyDirectory }}
+        key-directory "{{ .KeyDirectory }}";
+{{- end }}
+{{- if .DNSSEC }}
+        dnssec-policy default;
+        inline-signing yes;
+{{- end }}
 };
 `
 
-	tmpl, err := template.New("").Parse(primaryTemplate)
-	if err != nil {
-		panic(err)
-	}
-
-	var buf bytes.Buffer
-	err = tmpl.Execute(&buf, struct {
-		Domain        string
-		AllowTransfer string
-	}{
-		Domain:        z.Domain,
-		AllowTransfer: strings.Join(config.SecondaryNameServerIPs, "; "),
-	})
-
-	if err != nil {
-		panic(err)
-	}
-
-	return string(buf.Bytes())
-}
-
-func (z *Zone) RenderSecondary() string {
-	secondaryTemplate := `zone "{{ .Domain }}" IN {
+// Built-in stanza of secondaries, replaced by DNSAPI_SECONDARY_STANZA
+const secondaryStanzaTemplate = `zone "{{ .Domain }}" IN {
     type slave;
     masterfile-format text;
     file "{{ .Domain }}.zone";
+{{- if .Journal }}
+    journal "{{ .Journal }}";
+{{- end }}
+{{- if .MaxJournalSize }}
+    max-journal-size {{ .MaxJournalSize }};
+{{- end }}
     allow-query { any; };
     masters { {{ .Masters }}; };
 };`
-	tmpl, err := template.New("").Parse(secondaryTemplate)
-	if err != nil {
-		panic(err)
-	}
 
-	var buf bytes.Buffer
-	err = tmpl.Execute(&buf, struct {
-		Domain  string
-		Masters string
-	}{
-		Domain:  z.Domain,
-		Masters: config.PrimaryNameServerIP,
-	})
+// Variables available in stanza templates
+type stanzaVariables struct {
+	Domain         string
+	Pool           string
+	AllowTransfer  string
+	AlsoNotify     string
+	Masters        string
+	DNSSEC         bool
+	TSIGKeyName    string
+	TSIGAlgorithm  string
+	TSIGSecret     string
+	KeyDirectory   string
+	Journal        string
+	MaxJournalSize string
+	LogChannel     string
+}
 
-	if err != nil {
-		panic(err)
+func (z *Zone) stanzaVariables(options BindOptions) stanzaVariables {
+	return stanzaVariables{
+		Domain:         z.Domain,
+		Pool:           z.Pool,
+		DNSSEC:         z.DNSSEC,
+		TSIGKeyName:    z.TSIGKeyName(),
+		TSIGAlgorithm:  z.TSIGAlgorithm,
+		TSIGSecret:     z.TSIGSecret,
+		KeyDirectory:   options.KeyDirectory,
+		Journal:        z.journalPath(options),
+		MaxJournalSize: options.MaxJournalSize,
+		LogChannel:     options.LogChannel,
+	}
+}
+
+// RenderPrimary renders the stanza for the primary of zone's pool
+func (z *Zone) RenderPrimary() string {
+	// Customer's secondaries are allowed to transfer the zone by their IP or with their TSIG key
+	allowTransfer := SecondaryNameServerAddresses()
+	var alsoNotify []string
+	for _, ip := range z.TransferIPList() {
+		if z.TSIGKeyName() != "" {
+			alsoNotify = append(alsoNotify, ip+" key \""+z.TSIGKeyName()+"\"")
+		} else {
+			allowTransfer = append(allowTransfer, ip)
+			alsoNotify = append(alsoNotify, ip)
+		}
+	}
+	if z.TSIGKeyName() != "" {
+		allowTransfer = append(allowTransfer, "key \""+z.TSIGKeyName()+"\"")
 	}
 
-	return string(buf.Bytes())
+	variables := z.stanzaVariables(z.bindOptionsOn(PoolPrimaryNameServer(z.Pool)))
+	variables.AllowTransfer = strings.Join(allowTransfer, "; ")
+	variables.AlsoNotify = strings.Join(alsoNotify, "; ")
+
+	return renderStanza(config.PrimaryStanza, primaryStanzaTemplate, variables)
+}
+
+// RenderSecondary renders the stanza for secondaries with zone's own options only
+func (z *Zone) RenderSecondary() string {
+	return z.RenderSecondaryOn("")
+}
+
+// RenderSecondaryOn renders the stanza for the secondary server, options it has in the inventory are used as defaults
+func (z *Zone) RenderSecondaryOn(server string) string {
+	variables := z.stanzaVariables(z.bindOptionsOn(server))
+	variables.Masters = config.PrimaryNameServerIP
+
+	return renderStanza(config.SecondaryStanza, secondaryStanzaTemplate, variables)
 }
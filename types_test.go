@@ -3,6 +3,8 @@ package main
 import (
 	"crypto/sha256"
 	"fmt"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -26,7 +28,7 @@ func ExampleZone() {
 	h := sha256.New()
 	h.Write([]byte(renderedZone))
 	fmt.Printf("%x", h.Sum(nil))
-	// Output: 635d2be2a44773e301a0938357b868dbfe5282b2e516e28d21c4b0e41d642333
+	// Output: 8adbcfeda30f2032e9fa10103f34ae9710ac7b5973329912f6bf10226bad549d
 }
 
 func ExampleZone_RenderPrimary() {
@@ -70,6 +72,34 @@ func ExampleZone_RenderSecondary() {
 	// };
 }
 
+func ExampleZone_RenderPrimary_transfer() {
+	zone, errs := NewZone("J-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		panic(errs)
+	}
+
+	zone, errs = SetZoneTransfer(zone.ID, []string{"10.9.8.7"}, "", "c2VjcmV0")
+	if len(errs) != 0 {
+		panic(errs)
+	}
+
+	fmt.Println(zone.RenderPrimary())
+	// Output:
+	// key "transfer-j-ohphiuhi.txt" {
+	//         algorithm hmac-sha256;
+	//         secret "c2VjcmV0";
+	// };
+	// zone "j-ohphiuhi.txt" IN {
+	//         type master;
+	//         masterfile-format text;
+	//         file "j-ohphiuhi.txt.zone";
+	//         allow-query { any; };
+	//         allow-transfer { 5.6.7.8; key "transfer-j-ohphiuhi.txt"; };
+	//         notify yes;
+	//         also-notify { 10.9.8.7 key "transfer-j-ohphiuhi.txt"; };
+	// };
+}
+
 func TestZone_SetNewSerial(t *testing.T) {
 	var zone Zone
 
@@ -96,6 +126,42 @@ func TestZone_SetNewSerial(t *testing.T) {
 	}
 }
 
+func TestZone_SetNewSerialRollover(t *testing.T) {
+	day := time.Date(2026, 10, 14, 23, 0, 0, 0, time.UTC)
+
+	// The 100th serial of the day takes the first one of the next day
+	zone := Zone{Serial: "2026101498"}
+	for _, expected := range []string{"2026101499", "2026101500", "2026101501"} {
+		zone.setSerialAt(day)
+		if zone.Serial != expected {
+			t.Error("Got " + zone.Serial + ", expected " + expected)
+		}
+	}
+	zone.setSerialAt(day.Add(2 * time.Hour))
+	if zone.Serial != "2026101502" {
+		t.Error("Got " + zone.Serial + ", expected 2026101502 on the next day")
+	}
+	zone.setSerialAt(day.AddDate(0, 0, 2))
+	if zone.Serial != "2026101601" {
+		t.Error("Got " + zone.Serial + ", expected 2026101601")
+	}
+
+	// Serials never get older, also serials of later days bumped over live serials
+	zone = Zone{Serial: "2026102003"}
+	zone.setSerialAt(day)
+	if zone.Serial != "2026102004" {
+		t.Error("Got " + zone.Serial + ", expected 2026102004")
+	}
+
+	for _, serial := range []string{"", "1", "20261014xx", "1791966600"} {
+		zone = Zone{Serial: serial}
+		zone.setSerialAt(day)
+		if zone.Serial != "2026101401" {
+			t.Error("Got " + zone.Serial + " after " + serial + ", expected 2026101401")
+		}
+	}
+}
+
 func TestValidZone(t *testing.T) {
 	// A valid zone with config's email
 	var zone = Zone{
@@ -149,11 +215,257 @@ func TestInvalidZone(t *testing.T) {
 	zone.AddRecord("@", 300, "MX", 0, "mail.rosti.cz.")      // invalid prio
 	zone.AddRecord("@", 1, "MX", 10, "mail.rosti.cz.")       // invalid TTL
 	zone.AddRecord("@", 300, "UNKNOWN", 0, "mail.rosti.cz.") // invalid record type
+	zone.TransferIPs = "1.2.3.256"                           // invalid IP of customer's secondary
+	zone.TSIGSecret = "+++"                                  // invalid secret and missing algorithm
 	zone.AddRecord("@", 300, "TXT", 0, "\"igeeweofeiroomoogokieghaithohthaechoocherohveehiebawuyeixeecoveegoeyohfachainauquaeceetipheivubohmoegheizeelaiquanaokooquiedokaidurahveehoshazaseveitheiyitachudiishaeghaexoovachacaijuyiedeochojingafeexusuquaingeiboovachahlaechahcashoophairohthaghobahjaixieboteixameimohmaedahriebaekoshohpeecueyaoseeveibavaithohquaevoalohreingewiesaijiojiehielahzaelohpechuohiefaeyaetiegengahgatheefaipeimeeviedimibohmoyajefahghaaraehieyiepameegheathaechielixahbeidohyaitionahjaenoshikahbahyaebeachahxalaeghuloochaekuthaiquaedoo")
 
 	errs = zone.Validate()
 	// TODO: check exact errors
-	if len(errs) != 8 {
+	if len(errs) != 11 {
 		t.Error("Not right amount of errors were generated", errs)
 	}
 }
+
+func TestInvalidZoneDomain(t *testing.T) {
+	for _, domain := range []string{
+		"x.com' || id; echo '",
+		"a b.com",
+		"a;b.com",
+		`a"b.com`,
+		"a/b.com",
+		"-a.com",
+		strings.Repeat("a", 64) + ".com",
+		strings.Repeat(strings.Repeat("a", 62)+".", 4) + "com",
+	} {
+		zone := Zone{Domain: domain}
+		if validateZoneDomain(domain) == nil || len(zone.Validate()) == 0 {
+			t.Error("Invalid domain is accepted", domain)
+		}
+	}
+
+	for _, domain := range []string{"example.com", "E-" + TEST_DOMAIN, "xn--bcher-kva.example", "0-127.2.0.192.in-addr.arpa"} {
+		if err := validateZoneDomain(domain); err != nil {
+			t.Error(domain, err)
+		}
+	}
+}
+
+func TestRecord_ValidateName(t *testing.T) {
+	cases := []struct {
+		name  string
+		valid bool
+	}{
+		{"@", true},
+		{"www", true},
+		{"a.www", true},
+		{"_dmarc.shop", false}, // host names of A records can't have underscores
+		{"64/26", true},
+		{"*", true},
+		{"*.www", true},
+		{"*.www.other.example.com.", true},
+		{"www.*", false},
+		{"a.*.www", false},
+		{"*www", false},
+		{"**", false},
+		{"www..a", false},
+		{".www", false},
+		{"ww w", false},
+		{"www@", false},
+	}
+
+	for _, c := range cases {
+		record := Record{Name: c.name, TTL: 300, Type: "A", Value: "192.0.2.1"}
+		err := record.Validate()
+		if c.valid && err != nil {
+			t.Error(c.name+" should be valid", err)
+		}
+		if !c.valid && err == nil {
+			t.Error(c.name + " should be invalid")
+		}
+	}
+
+	record := Record{Name: "*.www", TTL: 300, Type: "A", Value: "192.0.2.1"}
+	if err := record.Validate(); err != nil {
+		t.Error(err)
+	}
+	record = Record{Name: "a.*", TTL: 300, Type: "A", Value: "192.0.2.1"}
+	if err := record.Validate(); err == nil || err.Error() != "A a.*: * can be only the whole leftmost label of the name" {
+		t.Error("Unexpected error", err)
+	}
+	record = Record{Name: "*", TTL: 300, Type: "NS", Value: "ns1.example.com."}
+	if err := record.Validate(); err == nil {
+		t.Error("NS record with wildcard name passed")
+	}
+}
+
+func TestZone_RenderWildcard(t *testing.T) {
+	zone := Zone{ID: 1, Domain: "bp-" + TEST_DOMAIN, Serial: "2020010101"}
+	zone.AddRecord("*."+zone.Domain+".", 300, "A", 0, "192.0.2.1")
+	zone.AddRecord("*.shop", 300, "CNAME", 0, "shop")
+	zone.AddRecord("shop", 300, "A", 0, "192.0.2.2")
+
+	if zone.Records[0].Name != "*" {
+		t.Error("Wildcard of the apex is not normalized", zone.Records[0].Name)
+	}
+	rendered := zone.Render()
+	if !strings.Contains(rendered, "\n*         300s    A          192.0.2.1\n") || !strings.Contains(rendered, "\n*.shop    300s    CNAME      shop\n") {
+		t.Error("Wildcards are not rendered", rendered)
+	}
+
+	records, err := ParseZoneFile(rendered, zone.Domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(recordSet(records), ",") != strings.Join(recordSet(zone.Records), ",") {
+		t.Error("Wildcards changed by the round trip", records)
+	}
+}
+
+func TestCNAMEConflicts(t *testing.T) {
+	records := []Record{
+		{Name: "@", Type: "CNAME", Value: "example.com."},    // SOA and NS are at the apex
+		{Name: "mail", Type: "CNAME", Value: "example.com."}, // shares the name with MX
+		{Name: "mail", Type: "MX", Prio: 10, Value: "mx"},    //
+		{Name: "spf", Type: "CNAME", Value: "example.com."},  // shares the name with TXT
+		{Name: "spf", Type: "TXT", Value: "v=spf1 -all"},     //
+		{Name: "www", Type: "CNAME", Value: "example.com."},  // valid
+		{Name: "api", Type: "ALIAS", Value: "example.com."},  // ALIAS can share the name with MX and TXT
+		{Name: "api", Type: "TXT", Value: "v=spf1 -all"},     //
+		{Name: "shop", Type: "ALIAS", Value: "example.com."}, // but not with A
+		{Name: "shop", Type: "A", Value: "192.0.2.1"},        //
+	}
+
+	conflicts := cnameConflicts(records)
+	if len(conflicts) != 4 || conflicts[0] == nil || conflicts[1] == nil || conflicts[3] == nil || conflicts[8] == nil {
+		t.Error("Unexpected conflicts", conflicts)
+	}
+	if conflicts[0] != nil && conflicts[0].Error() != "CNAME @ can't be at the apex of the zone, it would conflict with SOA and NS records" {
+		t.Error("Unexpected error of CNAME at the apex", conflicts[0])
+	}
+}
+
+func TestRecord_ValidateUnderscoreNames(t *testing.T) {
+	cases := []struct {
+		record Record
+		valid  bool
+	}{
+		{Record{Name: "_dmarc", TTL: 300, Type: "TXT", Value: "v=DMARC1; p=none"}, true},
+		{Record{Name: "selector._domainkey.shop", TTL: 300, Type: "TXT", Value: "v=DKIM1; p=key"}, true},
+		{Record{Name: "_acme-challenge.www", TTL: 300, Type: "CNAME", Value: "auth.example.com."}, true},
+		{Record{Name: "_sip._tcp", TTL: 300, Type: "SRV", Value: "10 5 5060 sip.example.com."}, true},
+		{Record{Name: "_domainkey", TTL: 300, Type: "NS", Value: "ns.example.com."}, true},
+		{Record{Name: "_dmarc", TTL: 300, Type: "A", Value: "192.0.2.1"}, false},
+		{Record{Name: "my_host", TTL: 300, Type: "AAAA", Value: "2001:db8::1"}, false},
+		{Record{Name: "_mail", TTL: 300, Type: "MX", Prio: 10, Value: "mx.example.com."}, false},
+		{Record{Name: "_shop", TTL: 300, Type: "ALIAS", Value: "shop.example.com."}, false},
+	}
+
+	for _, c := range cases {
+		err := c.record.Validate()
+		if c.valid && err != nil {
+			t.Error(c.record.Type+" "+c.record.Name+" should be valid", err)
+		}
+		if !c.valid && err == nil {
+			t.Error(c.record.Type + " " + c.record.Name + " should be invalid")
+		}
+	}
+
+	record := Record{Name: "_dmarc", TTL: 300, Type: "A", Value: "192.0.2.1"}
+	if err := record.Validate(); err == nil || err.Error() != "A _dmarc: underscores are allowed only in names of CNAME, NS, SRV, TXT, URI records" {
+		t.Error("Unexpected error", err)
+	}
+}
+
+func TestRecord_ValidateSyntax(t *testing.T) {
+	cases := []struct {
+		record Record
+		valid  bool
+	}{
+		{Record{Name: "www", TTL: 300, Type: "CNAME", Value: "s1._domainkey.example.net."}, true},
+		{Record{Name: "5", TTL: 300, Type: "CNAME", Value: "5.0/26.2.0.192.in-addr.arpa."}, true},
+		{Record{Name: "blocked", TTL: 300, Type: "CNAME", Value: "."}, true},
+		{Record{Name: "shop", TTL: 300, Type: "ALIAS", Value: "shop.example.net."}, true},
+		{Record{Name: "www", TTL: 300, Type: "CNAME", Value: "www example.net."}, false},
+		{Record{Name: "www", TTL: 300, Type: "CNAME", Value: "192.0.2.1"}, false},
+		{Record{Name: "www", TTL: 300, Type: "CNAME", Value: "*.example.net."}, false},
+		{Record{Name: strings.Repeat("a", 64), TTL: 300, Type: "A", Value: "192.0.2.1"}, false},
+		{Record{Name: "mail", TTL: 300, Type: "CNAME", Value: strings.Repeat("b", 64) + ".example.net."}, false},
+	}
+
+	for _, c := range cases {
+		err := c.record.Validate()
+		if c.valid && err != nil {
+			t.Error(c.record.Type+" "+c.record.Value+" should be valid", err)
+		}
+		if !c.valid && err == nil {
+			t.Error(c.record.Type + " " + c.record.Name + " " + c.record.Value + " should be invalid")
+		}
+	}
+}
+
+func TestRecord_ValidateMX(t *testing.T) {
+	cases := []struct {
+		record Record
+		valid  bool
+	}{
+		{Record{Name: "@", TTL: 300, Type: "MX", Prio: 10, Value: "mail"}, true},
+		{Record{Name: "@", TTL: 300, Type: "MX", Prio: 1, Value: "mx.example.net."}, true},
+		{Record{Name: "@", TTL: 300, Type: "MX", Prio: 100, Value: "mx.example.net."}, true},
+		{Record{Name: "@", TTL: 300, Type: "MX", Prio: 65535, Value: "@"}, true},
+		{Record{Name: "@", TTL: 300, Type: "MX", Prio: 0, Value: "mx.example.net."}, false},
+		{Record{Name: "@", TTL: 300, Type: "MX", Prio: 65536, Value: "mx.example.net."}, false},
+		{Record{Name: "@", TTL: 300, Type: "MX", Prio: 10, Value: "192.0.2.25"}, false},
+		{Record{Name: "@", TTL: 300, Type: "MX", Prio: 10, Value: "2001:db8::25."}, false},
+		{Record{Name: "@", TTL: 300, Type: "MX", Prio: 10, Value: "mail_server.example.net."}, false},
+	}
+
+	for _, c := range cases {
+		err := c.record.Validate()
+		if c.valid && err != nil {
+			t.Error(c.record.Type+" "+strconv.Itoa(c.record.Prio)+" "+c.record.Value+" should be valid", err)
+		}
+		if !c.valid && err == nil {
+			t.Error(c.record.Type + " " + strconv.Itoa(c.record.Prio) + " " + c.record.Value + " should be invalid")
+		}
+	}
+}
+
+func TestDuplicateRecords(t *testing.T) {
+	records := []Record{
+		{Name: "www", Type: "A", TTL: 300, Value: "192.0.2.1"},
+		{Name: "WWW", Type: "A", TTL: 60, Value: "192.0.2.1"}, // the same record with another TTL
+		{Name: "@", Type: "MX", Prio: 10, Value: "mx"},
+		{Name: "@", Type: "MX", Prio: 20, Value: "mx"}, // another prio
+		{Name: "@", Type: "TXT", Value: "v=spf1 -all"},
+		{Name: "@", Type: "TXT", Value: "v=spf1 -all"},
+		{Name: "@", Type: "TXT", Value: "V=spf1 -all"}, // TXT values are case sensitive
+	}
+
+	duplicates := duplicateRecords(records)
+	if len(duplicates) != 2 || duplicates[1] == nil || duplicates[5] == nil {
+		t.Error("Unexpected duplicates", duplicates)
+	}
+	if duplicates[5] != nil && duplicates[5].Error() != "TXT @: the same record with value v=spf1 -all already exists" {
+		t.Error("Unexpected error of duplicate TXT", duplicates[5])
+	}
+}
+
+func TestValidEmail(t *testing.T) {
+	for _, email := range []string{"cx@initd.cz", "first.last@rosti.cz", "abuse+dns@sub.rosti.cz"} {
+		if !validEmail(email) {
+			t.Error(email + " should be valid")
+		}
+	}
+	for _, email := range []string{"", "cx", "cx@initd", "cx@@initd.cz", "Cx <cx@initd.cz>", "cx@initd..cz", "cx@initd.cz.", "c x@initd.cz"} {
+		if validEmail(email) {
+			t.Error(email + " should be invalid")
+		}
+	}
+}
+
+func TestZone_RenderAbuseEmail(t *testing.T) {
+	zone := Zone{AbuseEmail: "first.last@rosti.cz"}
+	if zone.RenderAbuseEmail() != "first\\.last.rosti.cz" {
+		t.Error("Got " + zone.RenderAbuseEmail())
+	}
+}
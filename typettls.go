@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Parses default TTLs of record types in TYPE:TTL format, ex. A:300 or MX:3600
+func parseTypeTTLs(entries []string) (map[string]int, error) {
+	ttls := make(map[string]int)
+
+	for _, entry := range entries {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 2)
+		recordType := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if len(parts) != 2 || recordType == "" {
+			return nil, errors.New(entry + " has to be in TYPE:TTL format, ex. A:300")
+		}
+		if GetRecordType(recordType) == nil {
+			return nil, errors.New("record type " + recordType + " is not supported")
+		}
+		if _, ok := ttls[recordType]; ok {
+			return nil, errors.New("TTL of " + recordType + " is set more than once")
+		}
+		ttl, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil || ttl < MinRecordTTL || ttl > MaxRecordTTL {
+			return nil, errors.New("TTL of " + recordType + " has to be number between " + strconv.Itoa(MinRecordTTL) + " and " + strconv.Itoa(MaxRecordTTL))
+		}
+		ttls[recordType] = ttl
+	}
+
+	return ttls, nil
+}
+
+// ValidateTypeTTLs checks DNSAPI_TYPE_TTLS entries in TYPE:TTL format
+func ValidateTypeTTLs(entries []string) error {
+	_, err := parseTypeTTLs(entries)
+	return err
+}
+
+// TypeTTL returns TTL used for records of the type created without TTL: the zone's TTL of the type,
+// DNSAPI_TYPE_TTLS and the zone's default TTL in this order
+func (z *Zone) TypeTTL(recordType string) int {
+	recordType = strings.ToUpper(recordType)
+
+	if z.TypeTTLs != "" {
+		ttls, err := parseTypeTTLs(strings.Split(z.TypeTTLs, ","))
+		if err == nil && ttls[recordType] > 0 {
+			return ttls[recordType]
+		}
+	}
+	ttls, err := parseTypeTTLs(config.TypeTTLs)
+	if err == nil && ttls[recordType] > 0 {
+		return ttls[recordType]
+	}
+
+	return z.DefaultTTL()
+}
+
+// SetZoneTypeTTLs sets default TTLs of record types in the zone, comma separated TYPE:TTL pairs, empty to
+// use only DNSAPI_TYPE_TTLS. Existing records keep their TTLs.
+func SetZoneTypeTTLs(zoneId uint, typeTTLs string) (*Zone, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	ttls, err := parseTypeTTLs(strings.Split(typeTTLs, ","))
+	if err != nil {
+		return nil, []error{err}
+	}
+	bounds := zone.RecordTTLBounds()
+	var pairs []string
+	for recordType, ttl := range ttls {
+		if ttl < bounds.Min || ttl > bounds.Max {
+			return nil, []error{errors.New("TTL of " + recordType + " has to be number between " + strconv.Itoa(bounds.Min) + " and " + strconv.Itoa(bounds.Max) + " in this zone")}
+		}
+		pairs = append(pairs, recordType+":"+strconv.Itoa(ttl))
+	}
+	sort.Strings(pairs)
+	zone.TypeTTLs = strings.Join(pairs, ",")
+
+	err = db.Model(&Zone{}).Where("id = ?", zoneId).Update("type_ttls", zone.TypeTTLs).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	Audit("zone.type_ttls_changed", &zone, zone.TypeTTLs)
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
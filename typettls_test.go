@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZoneTypeTTLs(t *testing.T) {
+	config.TTL = 600
+	config.TypeTTLs = []string{"A:300", "mx:3600"}
+	defer func() {
+		config.TTL = 0
+		config.TypeTTLs = nil
+	}()
+
+	zone, errs := NewZone("BY-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	ttl := func(name string, recordType string, prio int, value string) int {
+		record, errs := NewRecord(zone.ID, name, 0, recordType, prio, value)
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		return record.TTL
+	}
+	assert.Equal(t, 300, ttl("www", "A", 0, "192.0.2.1"))
+	assert.Equal(t, 3600, ttl("@", "MX", 10, "mail"))
+	assert.Equal(t, 600, ttl("@", "TXT", 0, "v=spf1 -all"), "Type without its own TTL")
+
+	// The zone's TTLs go before the configured ones
+	updated, errs := SetZoneTypeTTLs(zone.ID, "txt:900, A:120")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "A:120,TXT:900", updated.TypeTTLs)
+	assert.Equal(t, 120, ttl("mail", "A", 0, "192.0.2.25"))
+	assert.Equal(t, 900, ttl("www", "TXT", 0, "hello"))
+	assert.Equal(t, 3600, ttl("@", "MX", 20, "mail"))
+	assert.Equal(t, 600, ttl("www", "AAAA", 0, "2001:db8::1"), "DNSAPI_TTL without TTL of the type")
+
+	// Existing records keep their TTLs and the zone file's $TTL is the default TTL
+	zone, _ = GetStore().GetZone(zone.ID)
+	assert.Contains(t, zone.Render(), "$TTL 600s")
+	for _, record := range zone.Records {
+		if record.Name == "www" && record.Type == "A" {
+			assert.Equal(t, 300, record.TTL)
+		}
+	}
+
+	for _, invalid := range []string{"A", "A:10", "BOGUS:300", "A:300,a:600"} {
+		_, errs = SetZoneTypeTTLs(zone.ID, invalid)
+		assert.Len(t, errs, 1, invalid)
+	}
+	assert.Error(t, ValidateTypeTTLs([]string{"TXT:forever"}))
+	assert.NoError(t, ValidateTypeTTLs([]string{"A:300", "AAAA:300"}))
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// CommitStat is number of commits of one zone during one day (UTC)
+type CommitStat struct {
+	ID     uint   `json:"-" gorm:"primary_key"`
+	ZoneId uint   `json:"zone_id" sql:"index"`
+	Day    string `json:"day" sql:"index"` // 2006-01-02
+
+	Commits int `json:"commits"`
+}
+
+// TenantUsage is usage of one tenant during one billing period
+type TenantUsage struct {
+	TenantId uint   `json:"tenant_id"` // 0 for zones without tenant
+	Tenant   string `json:"tenant"`
+	Period   string `json:"period"` // 2006-01
+
+	Zones   int `json:"zones"`   // Zones hosted at the end of the period
+	Records int `json:"records"` // Records of these zones now
+	Queries int `json:"queries"` // Queries from ingested query logs, 0 without query log ingestion
+	Commits int `json:"commits"`
+}
+
+// Header of the CSV export, the same order as in TenantUsage
+var usageCSVHeader = []string{"tenant_id", "tenant", "period", "zones", "records", "queries", "commits"}
+
+// Adds one commit of the zone into the daily statistics. Failure is only logged, the commit is already done.
+func countCommit(zoneId uint, now time.Time) {
+	var stat CommitStat
+
+	db := GetDatabaseConnection()
+	day := now.UTC().Format("2006-01-02")
+	err := db.Where("zone_id = ? AND day = ?", zoneId, day).First(&stat).Error
+	if err == nil {
+		err = db.Model(&stat).Update("commits", gorm.Expr("commits + ?", 1)).Error
+	} else if err == gorm.ErrRecordNotFound {
+		err = db.Create(&CommitStat{ZoneId: zoneId, Day: day, Commits: 1}).Error
+	}
+	if err != nil {
+		log.Errorf("commit statistics of zone " + strconv.Itoa(int(zoneId)) + ": " + err.Error())
+	}
+}
+
+// Parses billing period in 2006-01 format, the current month if empty. Returns its first and last day.
+func parseBillingPeriod(period string, now time.Time) (string, time.Time, time.Time, error) {
+	if period == "" {
+		period = now.UTC().Format("2006-01")
+	}
+
+	start, err := time.Parse("2006-01", period)
+	if err != nil {
+		return "", time.Time{}, time.Time{}, errors.New("period has to be a month in YYYY-MM format")
+	}
+
+	return period, start, start.AddDate(0, 1, -1), nil
+}
+
+// Sums column of daily statistics table in the period by zones
+func sumDailyStats(table string, column string, first time.Time, last time.Time) (map[uint]int, error) {
+	sums := make(map[uint]int)
+
+	db := GetReadDatabaseConnection()
+	rows, err := db.Table(table).
+		Select("zone_id, sum("+column+")").
+		Where("day >= ? AND day <= ?", first.Format("2006-01-02"), last.Format("2006-01-02")).
+		Group("zone_id").
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var zoneId uint
+		var sum int
+		err = rows.Scan(&zoneId, &sum)
+		if err != nil {
+			return nil, err
+		}
+		sums[zoneId] = sum
+	}
+
+	return sums, rows.Err()
+}
+
+// GetUsage returns usage of all tenants (tenantId 0) or one tenant in the billing period (2006-01, the current
+// month if empty). Zones created after the period are not counted, deleted zones are not known anymore.
+func GetUsage(tenantId uint, period string, now time.Time) ([]TenantUsage, error) {
+	var tenants []Tenant
+	var zones []Zone
+
+	period, first, last, err := parseBillingPeriod(period, now)
+	if err != nil {
+		return nil, err
+	}
+
+	db := GetReadDatabaseConnection()
+	tenantsQuery := db.Order("id")
+	if tenantId != 0 {
+		tenantsQuery = tenantsQuery.Where("id = ?", tenantId)
+	}
+	err = tenantsQuery.Find(&tenants).Error
+	if err != nil {
+		return nil, err
+	}
+	if tenantId != 0 && len(tenants) == 0 {
+		return nil, errors.New(RECORD_NOT_FOUND_MESSAGE)
+	}
+
+	zonesQuery := activeZones(db).Where("created_at < ?", last.AddDate(0, 0, 1))
+	if tenantId != 0 {
+		zonesQuery = zonesQuery.Where("tenant_id = ?", tenantId)
+	}
+	err = zonesQuery.Preload("Records").Find(&zones).Error
+	if err != nil {
+		return nil, err
+	}
+
+	queries, err := sumDailyStats("query_stats", "queries", first, last)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := sumDailyStats("commit_stats", "commits", first, last)
+	if err != nil {
+		return nil, err
+	}
+
+	usages := make(map[uint]*TenantUsage)
+	var order []uint
+	for _, tenant := range tenants {
+		usages[tenant.ID] = &TenantUsage{TenantId: tenant.ID, Tenant: tenant.Name, Period: period}
+		order = append(order, tenant.ID)
+	}
+	for _, zone := range zones {
+		usage, ok := usages[zone.TenantId]
+		if !ok {
+			// Zones without tenant or of deleted tenants
+			usage = &TenantUsage{TenantId: zone.TenantId, Period: period}
+			usages[zone.TenantId] = usage
+			order = append(order, zone.TenantId)
+		}
+		usage.Zones++
+		usage.Records += len(zone.Records)
+		usage.Queries += queries[zone.ID]
+		usage.Commits += commits[zone.ID]
+	}
+
+	result := []TenantUsage{}
+	for _, id := range order {
+		result = append(result, *usages[id])
+	}
+
+	return result, nil
+}
+
+// RenderUsageCSV renders usage as CSV with a header
+func RenderUsageCSV(usages []TenantUsage) (string, error) {
+	var buffer bytes.Buffer
+
+	writer := csv.NewWriter(&buffer)
+	err := writer.Write(usageCSVHeader)
+	if err != nil {
+		return "", err
+	}
+	for _, usage := range usages {
+		err = writer.Write([]string{
+			strconv.Itoa(int(usage.TenantId)),
+			usage.Tenant,
+			usage.Period,
+			strconv.Itoa(usage.Zones),
+			strconv.Itoa(usage.Records),
+			strconv.Itoa(usage.Queries),
+			strconv.Itoa(usage.Commits),
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+	writer.Flush()
+
+	return buffer.String(), writer.Error()
+}
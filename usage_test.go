@@ -0,0 +1,82 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetUsage(t *testing.T) {
+	config.SkipDeploy = true
+	defer func() { config.SkipDeploy = false }()
+
+	tenant, errs := NewTenant(Tenant{Name: "AK tenant"})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer DeleteTenant(tenant.ID)
+
+	var zones []*Zone
+	for _, prefix := range []string{"ak-1.", "ak-2."} {
+		zone, errs := NewTenantZone(tenant.ID, prefix+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+		defer purgeZone(zone)
+		zones = append(zones, zone)
+	}
+
+	_, errs = NewRecord(zones[0].ID, "www", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	for i := 0; i < 2; i++ {
+		err := Commit(zones[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now().UTC()
+	_, err := IngestQueryLog(`{"name": "www.ak-1.`+TEST_DOMAIN+`", "type": "A", "count": 5}`, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usages, err := GetUsage(tenant.ID, "", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []TenantUsage{{
+		TenantId: tenant.ID,
+		Tenant:   "AK tenant",
+		Period:   now.Format("2006-01"),
+		Zones:    2,
+		Records:  1,
+		Queries:  5,
+		Commits:  2,
+	}}, usages)
+
+	// Zones didn't exist in the previous month
+	usages, err = GetUsage(tenant.ID, now.AddDate(0, -1, 0).Format("2006-01"), now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, usages[0].Zones)
+	assert.Equal(t, 0, usages[0].Commits)
+
+	content, err := RenderUsageCSV(usages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(content), "\n")
+	assert.Equal(t, "tenant_id,tenant,period,zones,records,queries,commits", lines[0])
+	assert.Len(t, lines, 2)
+
+	_, err = GetUsage(tenant.ID, "2026-13", now)
+	assert.NotNil(t, err)
+	_, err = GetUsage(tenant.ID+1000, "", now)
+	assert.EqualError(t, err, RECORD_NOT_FOUND_MESSAGE)
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Built-in variables of record values, custom variables of the zone can't use these names
+const (
+	VariableDomain   = "domain"    // Domain of the zone without trailing dot
+	VariableApexIP   = "apex_ip"   // First A address of the apex, ALIAS records included
+	VariableApexIPv6 = "apex_ipv6" // First AAAA address of the apex, ALIAS records included
+)
+
+var variablePattern = regexp.MustCompile(`\{\{\s*([^{}\s]*)\s*\}\}`)
+var variableNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Values used when templates are validated, there is no zone yet
+var sampleVariables = map[string]string{
+	VariableDomain:   "example.com",
+	VariableApexIP:   "192.0.2.1",
+	VariableApexIPv6: "2001:db8::1",
+}
+
+func builtinVariable(name string) bool {
+	return name == VariableDomain || name == VariableApexIP || name == VariableApexIPv6
+}
+
+// Parses comma separated name=value pairs of custom variables
+func parseVariables(variables string) (map[string]string, error) {
+	parsed := make(map[string]string)
+
+	for _, pair := range strings.Split(variables, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 {
+			return nil, errors.New("variable " + name + " has to be in format name=value")
+		}
+		if !variableNamePattern.MatchString(name) {
+			return nil, errors.New(name + " is not a valid variable name, use lowercase letters, digits and _")
+		}
+		if builtinVariable(name) {
+			return nil, errors.New("variable " + name + " is built-in, it can't be set")
+		}
+		if _, ok := parsed[name]; ok {
+			return nil, errors.New("variable " + name + " is set more than once")
+		}
+		value := strings.TrimSpace(parts[1])
+		if strings.Contains(value, "{{") || strings.Contains(value, "}}") {
+			return nil, errors.New("value of variable " + name + " can't contain other variables")
+		}
+		parsed[name] = value
+	}
+
+	return parsed, nil
+}
+
+// ValidateVariables checks custom variables of a zone
+func ValidateVariables(variables string) error {
+	_, err := parseVariables(variables)
+	return err
+}
+
+// True if the value refers to any variable
+func hasVariables(value string) bool {
+	return variablePattern.MatchString(value)
+}
+
+// Values of built-in and custom variables of the zone. Apex addresses come from records without variables,
+// they are missing when the apex has no such record.
+func (z *Zone) variableValues() map[string]string {
+	values, err := parseVariables(z.Variables)
+	if err != nil {
+		values = make(map[string]string)
+	}
+	values[VariableDomain] = z.Domain
+
+	sorted := Zone{Records: flattenAliases(z.Records)}
+	for _, record := range sorted.SortedRecords() {
+		if record.Name != "@" || hasVariables(record.Value) || net.ParseIP(record.Value) == nil {
+			continue
+		}
+		if _, ok := values[VariableApexIP]; !ok && record.Type == "A" {
+			values[VariableApexIP] = net.ParseIP(record.Value).String()
+		}
+		if _, ok := values[VariableApexIPv6]; !ok && record.Type == "AAAA" {
+			values[VariableApexIPv6] = net.ParseIP(record.Value).String()
+		}
+	}
+
+	return values
+}
+
+// Replaces {{name}} in the value by values of the variables, unknown variables are errors
+func expandVariables(value string, values map[string]string) (string, error) {
+	var err error
+
+	expanded := variablePattern.ReplaceAllStringFunc(value, func(match string) string {
+		name := variablePattern.FindStringSubmatch(match)[1]
+		variable, ok := values[name]
+		if !ok {
+			if err == nil {
+				err = errors.New("variable " + name + " is not defined")
+			}
+			return match
+		}
+		return variable
+	})
+
+	return expanded, err
+}
+
+// Returns copy of the records with values of variables, records which refer to undefined variables are
+// kept as they are and their errors are returned by indexes.
+func (z *Zone) expandRecords(records []Record) ([]Record, map[int]error) {
+	expanded := make([]Record, len(records))
+	copy(expanded, records)
+	errs := make(map[int]error)
+
+	var values map[string]string
+	for i, record := range expanded {
+		if !hasVariables(record.Value) {
+			continue
+		}
+		if values == nil {
+			values = z.variableValues()
+		}
+		value, err := expandVariables(record.Value, values)
+		if err != nil {
+			errs[i] = errors.New(record.Type + " " + record.Name + ": " + err.Error())
+			continue
+		}
+		expanded[i].Value = value
+	}
+
+	return expanded, errs
+}
+
+// Error of the first record referring to an undefined variable, variables used by records can disappear
+// with the records they come from, ex. apex_ip with the A record of the apex
+func (z *Zone) checkVariables() error {
+	_, undefined := z.expandRecords(z.Records)
+	for i := range z.Records {
+		if undefined[i] != nil {
+			return undefined[i]
+		}
+	}
+	return nil
+}
+
+// Records referring to undefined variables are rendered with {{name}} and name servers would refuse them
+func lintVariables(zone *Zone) []LintIssue {
+	var issues []LintIssue
+
+	values := zone.variableValues()
+	for _, record := range zone.Records {
+		if _, err := expandVariables(record.Value, values); err != nil {
+			issues = append(issues, LintIssue{Severity: LintSeverityError, RecordId: record.ID, Name: record.Name, Type: record.Type, Message: err.Error()})
+		}
+	}
+
+	return issues
+}
+
+// Joins parsed variables into sorted name=value pairs as they are saved
+func joinVariables(parsed map[string]string) string {
+	var pairs []string
+	for name, value := range parsed {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Describes rendered records whose values change with the variables, nil is returned if the zone doesn't
+// exist or the variables are invalid and setting them reports it
+func variablesChange(zoneId uint, variables string) *RecordChange {
+	zone := reservedNamesZone(zoneId)
+	if zone == nil {
+		return nil
+	}
+	parsed, err := parseVariables(variables)
+	if err != nil {
+		return nil
+	}
+
+	current, _ := zone.expandRecords(zone.Records)
+	zone.Variables = joinVariables(parsed)
+	rendered, _ := zone.expandRecords(zone.Records)
+
+	return replaceChange(ChangeOperationVariables, &Zone{ID: zone.ID, Records: current}, rendered)
+}
+
+// CheckReservedVariables checks whether the variables can be set without the admin token, they can't change
+// rendered values of records with reserved names
+func CheckReservedVariables(zoneId uint, variables string) error {
+	change := variablesChange(zoneId, variables)
+	if change == nil {
+		return nil
+	}
+
+	zone := reservedNamesZone(zoneId)
+	for _, record := range append(append([]Record{}, change.Removed...), change.Added...) {
+		if zone.IsReservedName(record.Name) {
+			return errors.Wrap(ErrReservedName, record.Name)
+		}
+	}
+	return nil
+}
+
+// SetZoneVariables sets custom variables of the zone, comma separated name=value pairs. Records of the zone
+// have to keep referring only to defined variables.
+func SetZoneVariables(zoneId uint, variables string) (*Zone, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	parsed, err := parseVariables(variables)
+	if err != nil {
+		return nil, []error{err}
+	}
+	zone.Variables = joinVariables(parsed)
+
+	errs := zone.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	err = db.Model(&Zone{}).Where("id = ?", zoneId).Update("variables", zone.Variables).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = markZonePending(zone.ID)
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	Audit("zone.variables_changed", &zone, zone.Variables)
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandVariables(t *testing.T) {
+	values := map[string]string{VariableDomain: "example.com", VariableApexIP: "192.0.2.1"}
+
+	value, err := expandVariables("v=spf1 ip4:{{apex_ip}} include:_spf.{{ domain }} -all", values)
+	assert.NoError(t, err)
+	assert.Equal(t, "v=spf1 ip4:192.0.2.1 include:_spf.example.com -all", value)
+
+	value, err = expandVariables("v=spf1 ip6:{{apex_ipv6}} -all", values)
+	assert.EqualError(t, err, "variable apex_ipv6 is not defined")
+	assert.Equal(t, "v=spf1 ip6:{{apex_ipv6}} -all", value)
+
+	for _, variables := range []string{"cdn", "CDN=x", "apex_ip=192.0.2.1", "cdn=a,cdn=b", "cdn={{domain}}"} {
+		assert.Error(t, ValidateVariables(variables), variables)
+	}
+	parsed, err := parseVariables(" cdn = shop.cdn.example.net. ,office=192.0.2.10")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"cdn": "shop.cdn.example.net.", "office": "192.0.2.10"}, parsed)
+}
+
+func TestZoneVariables(t *testing.T) {
+	config.TTL = 300
+	config.SkipDeploy = true
+	defer func() {
+		config.TTL = 0
+		config.SkipDeploy = false
+	}()
+
+	zone, errs := NewZone("BO-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	apex, errs := NewRecord(zone.ID, "@", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(zone.ID, "@", 300, "TXT", 0, "v=spf1 ip4:{{apex_ip}} -all")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(zone.ID, "office", 300, "A", 0, "{{office}}")
+	assert.Len(t, errs, 1)
+
+	_, errs = SetZoneVariables(zone.ID, "office=192.0.2.300")
+	assert.Len(t, errs, 0)
+	_, errs = NewRecord(zone.ID, "office", 300, "A", 0, "{{office}}")
+	assert.Len(t, errs, 1, "Invalid value of the variable")
+
+	updated, errs := SetZoneVariables(zone.ID, "office=192.0.2.10")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, "office=192.0.2.10", updated.Variables)
+	_, errs = NewRecord(zone.ID, "office", 300, "A", 0, "{{office}}")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	zone, _ = GetStore().GetZone(zone.ID)
+	rendered := zone.Render()
+	assert.Contains(t, rendered, "\"v=spf1 ip4:192.0.2.1 -all\"")
+	assert.Contains(t, rendered, "192.0.2.10\n")
+	assert.NotContains(t, rendered, "{{")
+
+	// The variable is used by a record
+	_, errs = SetZoneVariables(zone.ID, "")
+	assert.Len(t, errs, 1)
+
+	// apex_ip disappears with the A record of the apex
+	assert.NoError(t, DeleteRecord(apex.ID))
+	zone, _ = GetStore().GetZone(zone.ID)
+	assert.EqualError(t, Commit(zone.ID), "TXT @: variable apex_ip is not defined")
+	var messages []string
+	for _, issue := range LintZone(zone).Issues {
+		messages = append(messages, issue.Severity+" "+issue.Name+": "+issue.Message)
+	}
+	assert.Contains(t, messages, "error @: variable apex_ip is not defined")
+
+	_, errs = NewTemplate("BO-template", []TemplateRecord{
+		{Name: "@", Type: "TXT", Value: "v=spf1 ip4:{{apex_ip}} -all"},
+		{Name: "www", Type: "CNAME", Value: "{{cdn}}"},
+		{Name: "mail", Type: "A", Value: "{{apex_ipv6}}"},
+	})
+	assert.Len(t, errs, 1, "AAAA address in A record")
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/pkg/errors"
+)
+
+var ErrNoZoneVersion = errors.New("zone wasn't committed before that time")
+
+// ZoneVersion is the record set of the zone saved by every commit, so it's known what was served at any time
+type ZoneVersion struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at" sql:"index"`
+
+	ZoneId  uint   `json:"zone_id" sql:"index"`
+	Serial  string `json:"serial"`
+	Records string `json:"-"` // JSON of the committed records
+}
+
+// Saves the committed records of the zone as its new version
+func saveZoneVersion(zone *Zone) error {
+	records, err := json.Marshal(zone.Records)
+	if err != nil {
+		return err
+	}
+
+	db := GetDatabaseConnection()
+	return db.Create(&ZoneVersion{ZoneId: zone.ID, Serial: zone.Serial, Records: string(records)}).Error
+}
+
+// GetZoneAsOf returns the zone with serial and records of the last version committed at or before asOf
+func GetZoneAsOf(zoneId uint, asOf time.Time) (*Zone, error) {
+	var zone Zone
+	var version ZoneVersion
+
+	db := GetReadDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Times are stored in local time zone and compared as text by SQLite
+	err = db.Where("zone_id = ? AND created_at <= ?", zoneId, asOf.Local()).Order("created_at desc, id desc").First(&version).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ErrNoZoneVersion
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	zone.Serial = version.Serial
+	zone.Records = []Record{}
+	err = json.Unmarshal([]byte(version.Records), &zone.Records)
+	if err != nil {
+		return nil, err
+	}
+
+	return &zone, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetZoneAsOf(t *testing.T) {
+	config.TTL = 300
+	config.SkipDeploy = true
+	defer func() {
+		config.TTL = 0
+		config.SkipDeploy = false
+	}()
+
+	zone, errs := NewZone("BA-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	record, errs := NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	beforeCommit := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	err := Commit(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	firstCommit := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	_, errs = UpdateRecord(record.ID, "www", 300, 0, "192.0.2.2")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	err = Commit(zone.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = GetZoneAsOf(zone.ID, beforeCommit)
+	assert.Equal(t, ErrNoZoneVersion, err)
+
+	past, err := GetZoneAsOf(zone.ID, firstCommit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, past.Records, 1) {
+		assert.Equal(t, "192.0.2.1", past.Records[0].Value)
+	}
+
+	current, err := GetZoneAsOf(zone.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if assert.Len(t, current.Records, 1) {
+		assert.Equal(t, "192.0.2.2", current.Records[0].Value)
+	}
+	assert.NotEqual(t, past.Serial, current.Serial)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// Timeout of one webhook call
+const WebhookTimeout = 10 * time.Second
+
+// Body of the webhook request
+type WebhookEvent struct {
+	Event string      `json:"event"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data"`
+}
+
+// SendWebhook sends the event to config.WebhookURL in background. Does nothing if the URL is not set.
+func SendWebhook(event string, data interface{}) {
+	if config.WebhookURL == "" {
+		return
+	}
+
+	body, err := json.Marshal(WebhookEvent{
+		Event: event,
+		Time:  time.Now().UTC(),
+		Data:  data,
+	})
+	if err != nil {
+		log.Errorf("webhook " + event + ": " + err.Error())
+		return
+	}
+
+	go func(url string, body []byte) {
+		client := http.Client{Timeout: WebhookTimeout}
+
+		resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Errorf("webhook " + event + ": " + err.Error())
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			log.Errorf("webhook " + event + ": unexpected status code " + strconv.Itoa(resp.StatusCode))
+		}
+	}(config.WebhookURL, body)
+}
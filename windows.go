@@ -0,0 +1,211 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Returned by Commit when the zone is outside of its deployment window, the commit is done when the window opens
+var ErrCommitQueued = errors.New("outside of deployment window, commit is queued until the window opens")
+
+// DeployFreeze is declared period when no commits are deployed, commits made during it are queued
+type DeployFreeze struct {
+	ID        uint      `json:"id" gorm:"primary_key"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	Reason string    `json:"reason"`
+}
+
+// Validates the freeze
+func (d *DeployFreeze) Validate() []error {
+	var errorsMsgs []error
+
+	if d.From.IsZero() || d.To.IsZero() {
+		errorsMsgs = append(errorsMsgs, errors.New("from and to of the freeze have to be set"))
+	} else if !d.To.After(d.From) {
+		errorsMsgs = append(errorsMsgs, errors.New("end of the freeze has to be after its start"))
+	}
+
+	return errorsMsgs
+}
+
+// Parses one window in HH:MM-HH:MM format and returns its start and end in minutes from midnight
+func parseDeployWindow(window string) (int, int, error) {
+	parts := strings.Split(strings.TrimSpace(window), "-")
+	if len(parts) != 2 {
+		return 0, 0, errors.New("deployment window " + window + " has to be in HH:MM-HH:MM format")
+	}
+
+	var minutes []int
+	for _, part := range parts {
+		parsed, err := time.Parse("15:04", strings.TrimSpace(part))
+		if err != nil {
+			return 0, 0, errors.New("deployment window " + window + " has to be in HH:MM-HH:MM format")
+		}
+		minutes = append(minutes, parsed.Hour()*60+parsed.Minute())
+	}
+
+	return minutes[0], minutes[1], nil
+}
+
+// ValidateDeployWindows checks comma separated list of windows, empty list means no restriction
+func ValidateDeployWindows(windows string) error {
+	if strings.TrimSpace(windows) == "" {
+		return nil
+	}
+
+	for _, window := range strings.Split(windows, ",") {
+		_, _, err := parseDeployWindow(window)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Returns true if the time in local time zone is inside one of the windows, windows can go over midnight (22:00-06:00)
+func inDeployWindows(windows string, now time.Time) bool {
+	if strings.TrimSpace(windows) == "" {
+		return true
+	}
+
+	now = now.In(time.Local)
+	current := now.Hour()*60 + now.Minute()
+
+	for _, window := range strings.Split(windows, ",") {
+		start, end, err := parseDeployWindow(window)
+		if err != nil {
+			continue
+		}
+
+		if start <= end && current >= start && current < end {
+			return true
+		}
+		if start > end && (current >= start || current < end) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// DeployWindowOpen returns true if the zone can be deployed now: it's inside global and zone's windows and no freeze is declared
+func DeployWindowOpen(zone *Zone, now time.Time) bool {
+	if !inDeployWindows(config.DeployWindows, now) || !inDeployWindows(zone.DeployWindows, now) {
+		return false
+	}
+
+	var count int
+	db := GetDatabaseConnection()
+	err := db.Model(&DeployFreeze{}).Where("`from` <= ? AND `to` > ?", now.UTC(), now.UTC()).Count(&count).Error
+	if err != nil {
+		panic(err)
+	}
+
+	return count == 0
+}
+
+// Declare a new deployment freeze
+func NewDeployFreeze(from time.Time, to time.Time, reason string) (*DeployFreeze, []error) {
+	freeze := DeployFreeze{
+		From:   from.UTC(),
+		To:     to.UTC(),
+		Reason: reason,
+	}
+
+	errs := freeze.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Create(&freeze).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &freeze, nil
+}
+
+// Remove the freeze, queued commits are deployed with the next flush if the windows are open
+func DeleteDeployFreeze(freezeId uint) error {
+	var freeze DeployFreeze
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", freezeId).Find(&freeze).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Where("id = ?", freezeId).Delete(&DeployFreeze{}).Error
+}
+
+// Set deployment windows of the zone, comma separated list of HH:MM-HH:MM in local time, empty for no restriction
+func SetZoneDeployWindows(zoneId uint, windows string) (*Zone, []error) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	zone.DeployWindows = strings.Replace(windows, " ", "", -1)
+
+	errs := zone.Validate()
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	err = db.Model(&zone).Update("deploy_windows", zone.DeployWindows).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
+
+// FlushQueuedCommits commits queued zones whose deployment windows are open
+func FlushQueuedCommits() {
+	var zones []Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("deploy_state = ?", DeployStateQueued).Find(&zones).Error
+	if err != nil {
+		log.Errorf("loading of queued commits: " + err.Error())
+		return
+	}
+
+	now := time.Now()
+	for _, zone := range zones {
+		if !DeployWindowOpen(&zone, now) {
+			continue
+		}
+
+		err = Commit(zone.ID)
+		if err != nil && err != ErrSerialBatched {
+			log.Errorf("queued commit of " + zone.Domain + ": " + err.Error())
+		}
+	}
+}
+
+// RunDeployWindowsScheduler flushes queued commits every minute, it's supposed to run as goroutine
+func RunDeployWindowsScheduler() {
+	ticker := time.NewTicker(time.Minute)
+
+	for range ticker.C {
+		FlushQueuedCommits()
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInDeployWindows(t *testing.T) {
+	at := func(hour int, minute int) time.Time {
+		return time.Date(2020, 1, 1, hour, minute, 0, 0, time.Local)
+	}
+
+	if !inDeployWindows("", at(3, 0)) {
+		t.Error("Empty windows are not open")
+	}
+	if !inDeployWindows("06:00-22:00", at(6, 0)) || inDeployWindows("06:00-22:00", at(22, 0)) {
+		t.Error("Unexpected bounds of the window")
+	}
+	if !inDeployWindows("22:00-06:00", at(23, 30)) || !inDeployWindows("22:00-06:00", at(1, 0)) || inDeployWindows("22:00-06:00", at(12, 0)) {
+		t.Error("Window over midnight doesn't work")
+	}
+	if !inDeployWindows("01:00-02:00,12:00-13:00", at(12, 30)) {
+		t.Error("Second window is not used")
+	}
+
+	for _, windows := range []string{"06:00", "6-22", "06:00-25:00", "06:00-22:00,"} {
+		if ValidateDeployWindows(windows) == nil {
+			t.Error("Invalid windows passed", windows)
+		}
+	}
+}
+
+func TestDeployWindows(t *testing.T) {
+	db := GetDatabaseConnection()
+
+	config.SkipDeploy = true
+	defer func() { config.SkipDeploy = false }()
+
+	zone, errs := NewZone("Q-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	state := func() string {
+		var current Zone
+		err := db.Where("id = ?", zone.ID).Find(&current).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		return current.DeployState
+	}
+
+	// Window which is closed right now
+	now := time.Now()
+	closed := now.Add(time.Hour).Format("15:04") + "-" + now.Add(2*time.Hour).Format("15:04")
+	_, errs = SetZoneDeployWindows(zone.ID, closed)
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	if Commit(zone.ID) != ErrCommitQueued || state() != DeployStateQueued {
+		t.Error("Commit outside of the window was not queued", state())
+	}
+
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "1.2.3.4")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if state() != DeployStateQueued {
+		t.Error("Change removed the zone from the queue", state())
+	}
+
+	err := CommitZone(zone.ID, true)
+	if err != nil || state() != DeployStateDeployed {
+		t.Error("Override didn't deploy the zone", err, state())
+	}
+
+	_, errs = SetZoneDeployWindows(zone.ID, "")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	freeze, errs := NewDeployFreeze(now.Add(-time.Hour), now.Add(time.Hour), "test")
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if Commit(zone.ID) != ErrCommitQueued {
+		t.Error("Commit during freeze was not queued")
+	}
+
+	err = DeleteDeployFreeze(freeze.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	FlushQueuedCommits()
+	if state() != DeployStateDeployed {
+		t.Error("Queued commit was not flushed", state())
+	}
+}
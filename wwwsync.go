@@ -0,0 +1,236 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+	"github.com/pkg/errors"
+)
+
+// Rules keeping A/AAAA records of www and the apex the same, Zone.WWWSync
+const (
+	WWWSyncOff  = ""     // Names are independent
+	WWWSyncApex = "apex" // www follows the apex
+	WWWSyncWWW  = "www"  // The apex follows www
+)
+
+// Returns source and target name of the zone's rule, empty for zones without the rule
+func wwwSyncNames(zone *Zone) (string, string) {
+	switch zone.WWWSync {
+	case WWWSyncApex:
+		return "@", "www"
+	case WWWSyncWWW:
+		return "www", "@"
+	}
+	return "", ""
+}
+
+// Returns records of the zone with A/AAAA records of the rule's target replaced by copies of the source's.
+// Target with CNAME already follows another name and source without addresses would leave the target
+// empty, records are returned unchanged in both cases.
+func wwwSyncRecords(zone *Zone, records []Record) []Record {
+	source, target := wwwSyncNames(zone)
+	if source == "" {
+		return records
+	}
+
+	var copies []Record
+	for _, record := range records {
+		if record.Name == target && record.Type == "CNAME" {
+			return records
+		}
+		if record.Name == source && (record.Type == "A" || record.Type == "AAAA") {
+			record.ID = 0
+			record.Name = target
+			copies = append(copies, record)
+		}
+	}
+	if len(copies) == 0 {
+		return records
+	}
+
+	var synced []Record
+	for _, record := range records {
+		if record.Name != target || (record.Type != "A" && record.Type != "AAAA") {
+			synced = append(synced, record)
+		}
+	}
+
+	return append(synced, copies...)
+}
+
+// Says whether both lists have the same records regardless of their IDs and order
+func sameRecords(a []Record, b []Record) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	counts := make(map[string]int)
+	for _, record := range a {
+		counts[recordKey(&record)]++
+	}
+	for _, record := range b {
+		counts[recordKey(&record)]--
+		if counts[recordKey(&record)] < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// SyncWWW applies the zone's www/apex rule, records are saved only if the target differs from the source
+func SyncWWW(zoneId uint) []error {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return []error{err}
+	}
+
+	synced := wwwSyncRecords(&zone, zone.Records)
+	if sameRecords(zone.Records, synced) {
+		return nil
+	}
+
+	_, errs := ReplaceRecords(zoneId, synced)
+	return errs
+}
+
+// Applies the zone's www/apex rule after records with given names were changed. The change is done
+// already, so failures are only logged.
+func syncWWWAfterChange(zoneId uint, names ...string) {
+	var zone Zone
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Find(&zone).Error
+	if err != nil {
+		log.Errorf("www/apex sync of zone " + strconv.Itoa(int(zoneId)) + ": " + err.Error())
+		return
+	}
+
+	source, _ := wwwSyncNames(&zone)
+	for _, name := range names {
+		if source != "" && normalizeName(name, zone.Domain) == source {
+			for _, err := range SyncWWW(zoneId) {
+				log.Errorf("www/apex sync of zone " + zone.Domain + ": " + err.Error())
+			}
+			return
+		}
+	}
+}
+
+// Returns records of the zone after the change
+func changedRecords(records []Record, change *RecordChange) []Record {
+	removed := make(map[string]int)
+	for _, record := range change.Removed {
+		removed[recordKey(&record)]++
+	}
+
+	var changed []Record
+	for _, record := range records {
+		if removed[recordKey(&record)] > 0 {
+			removed[recordKey(&record)]--
+			continue
+		}
+		changed = append(changed, record)
+	}
+	return append(changed, change.Added...)
+}
+
+// Adds records of the rule's target which the www/apex sync rewrites after the change, so they are reviewed
+// with it. Records of a reserved target can't be rewritten by the change without the admin token then.
+func addWWWSync(change *RecordChange) error {
+	zone := reservedNamesZone(change.ZoneId)
+	if zone == nil {
+		return nil
+	}
+	source, target := wwwSyncNames(zone)
+	if source == "" {
+		return nil
+	}
+
+	touched := false
+	for _, record := range append(append([]Record{}, change.Removed...), change.Added...) {
+		touched = touched || normalizeName(record.Name, zone.Domain) == source
+	}
+	if !touched {
+		return nil
+	}
+
+	after := changedRecords(zone.Records, change)
+	synced := replaceChange(change.Operation, &Zone{ID: zone.ID, Records: after}, wwwSyncRecords(zone, after))
+	if len(synced.Added) == 0 && len(synced.Removed) == 0 {
+		return nil
+	}
+	if zone.IsReservedName(target) {
+		return errors.Wrap(ErrReservedName, target)
+	}
+
+	change.Removed = append(change.Removed, synced.Removed...)
+	change.Added = append(change.Added, synced.Added...)
+	return nil
+}
+
+// Describes records which the rule rewrites when it's set, nil is returned if the zone doesn't exist and
+// setting the rule reports it
+func wwwSyncChange(zoneId uint, rule string) *RecordChange {
+	zone := reservedNamesZone(zoneId)
+	if zone == nil {
+		return nil
+	}
+
+	zone.WWWSync = strings.ToLower(strings.TrimSpace(rule))
+	return replaceChange(ChangeOperationWWWSync, zone, wwwSyncRecords(zone, zone.Records))
+}
+
+// CheckReservedWWWSync checks whether the rule can be set without the admin token, it can't rewrite records
+// of a reserved target
+func CheckReservedWWWSync(zoneId uint, rule string) error {
+	zone := reservedNamesZone(zoneId)
+	if zone == nil {
+		return nil
+	}
+
+	zone.WWWSync = strings.ToLower(strings.TrimSpace(rule))
+	return CheckReservedRecords(zoneId, wwwSyncRecords(zone, zone.Records))
+}
+
+// SetZoneWWWSync sets the www/apex rule of the zone and applies it right away, the rule isn't set if
+// the synced records are invalid
+func SetZoneWWWSync(zoneId uint, rule string) (*Zone, []error) {
+	var zone Zone
+
+	rule = strings.ToLower(strings.TrimSpace(rule))
+	if rule != WWWSyncOff && rule != WWWSyncApex && rule != WWWSyncWWW {
+		return nil, []error{errors.New("www_sync has to be empty, " + WWWSyncApex + " (www follows the apex) or " + WWWSyncWWW + " (the apex follows www)")}
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	zone.WWWSync = rule
+	synced := wwwSyncRecords(&zone, zone.Records)
+	if !sameRecords(zone.Records, synced) {
+		_, errs := ReplaceRecords(zoneId, synced)
+		if len(errs) > 0 {
+			return nil, errs
+		}
+	}
+
+	// Loaded records are stale after the sync, they can't be saved with the zone
+	err = db.Model(&Zone{}).Where("id = ?", zoneId).Update("www_sync", rule).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	err = db.Where("id = ?", zoneId).Preload("Records").Find(&zone).Error
+	if err != nil {
+		return nil, []error{err}
+	}
+
+	return &zone, nil
+}
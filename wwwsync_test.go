@@ -0,0 +1,108 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetZoneWWWSync(t *testing.T) {
+	config.TTL = 300
+	defer func() { config.TTL = 0 }()
+
+	zone, errs := NewZone("AQ-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	addresses := func(name string) []string {
+		var records []Record
+		GetDatabaseConnection().Where("zone_id = ? AND name = ? AND type IN (?)", zone.ID, name, []string{"A", "AAAA"}).Find(&records)
+		values := []string{}
+		for _, record := range records {
+			values = append(values, record.Value)
+		}
+		sort.Strings(values)
+		return values
+	}
+
+	apex, errs := NewRecord(zone.ID, "@", 300, "A", 0, "192.0.2.1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	_, errs = NewRecord(zone.ID, "www", 300, "A", 0, "192.0.2.9")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+
+	_, errs = SetZoneWWWSync(zone.ID, "both")
+	assert.Len(t, errs, 1)
+
+	// Enabling the rule syncs the target right away
+	synced, errs := SetZoneWWWSync(zone.ID, "apex")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, WWWSyncApex, synced.WWWSync)
+	assert.Equal(t, []string{"192.0.2.1"}, addresses("www"))
+
+	_, errs = NewRecord(zone.ID, "@", 300, "AAAA", 0, "2001:db8::1")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, []string{"192.0.2.1", "2001:db8::1"}, addresses("www"))
+
+	_, errs = UpdateRecord(apex.ID, "@", 300, 0, "192.0.2.2")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, []string{"192.0.2.2", "2001:db8::1"}, addresses("www"))
+
+	_, errs = ReplaceRRSet(zone.ID, RRSet{Name: "AQ-" + TEST_DOMAIN + ".", Type: "AAAA"})
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, []string{"192.0.2.2"}, addresses("www"))
+
+	// Changes of other names don't touch the target
+	_, errs = NewRecord(zone.ID, "www", 300, "AAAA", 0, "2001:db8::9")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, []string{"192.0.2.2", "2001:db8::9"}, addresses("www"))
+
+	// The apex follows www in the other direction
+	_, errs = SetZoneWWWSync(zone.ID, "www")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, []string{"192.0.2.2", "2001:db8::9"}, addresses("@"))
+
+	// Source without addresses doesn't empty the target
+	err := DeleteRecord(apex.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, errs = SetZoneWWWSync(zone.ID, "apex")
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	assert.Equal(t, []string{"2001:db8::9"}, addresses("www"))
+
+	var last Record
+	GetDatabaseConnection().Where("zone_id = ? AND name = ?", zone.ID, "@").First(&last)
+	err = DeleteRecord(last.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{}, addresses("@"))
+	assert.Equal(t, []string{"2001:db8::9"}, addresses("www"))
+
+	records := wwwSyncRecords(&Zone{WWWSync: WWWSyncApex}, []Record{
+		{Name: "@", Type: "A", Value: "192.0.2.1"},
+		{Name: "www", Type: "CNAME", Value: "@"},
+	})
+	assert.Len(t, records, 2)
+}
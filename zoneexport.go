@@ -0,0 +1,110 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/pkg/errors"
+)
+
+// Version of the JSON zone export. Fields are only added within the version, anything else changes it.
+const ZoneExportFormat = "dnsapi.zone.v1"
+
+// ZoneExport is the zone as served by our name servers, for resolvers and caches which don't read zone files
+type ZoneExport struct {
+	Format string            `json:"format"`
+	Zone   string            `json:"zone"` // Fully qualified with trailing dot
+	Serial uint32            `json:"serial"`
+	SOA    ZoneExportSOA     `json:"soa"`
+	DNSSEC ZoneExportDNSSEC  `json:"dnssec"`
+	RRsets []ZoneExportRRset `json:"rrsets"` // In the order of the zone file, NS of the apex first
+}
+
+type ZoneExportSOA struct {
+	TTL     uint32 `json:"ttl"`
+	MName   string `json:"mname"`
+	RName   string `json:"rname"`
+	Refresh uint32 `json:"refresh"`
+	Retry   uint32 `json:"retry"`
+	Expire  uint32 `json:"expire"`
+	Minimum uint32 `json:"minimum"`
+}
+
+// ZoneExportDNSSEC says whether the primary signs the zone, keys and signatures are created there
+type ZoneExportDNSSEC struct {
+	Signed bool   `json:"signed"`
+	Policy string `json:"policy,omitempty"` // BIND's dnssec-policy
+}
+
+// ZoneExportRRset is one RRset, data are in presentation format with fully qualified names
+type ZoneExportRRset struct {
+	Name string   `json:"name"`
+	Type string   `json:"type"`
+	TTL  uint32   `json:"ttl"` // The lowest TTL if records of the set differ in TTL
+	Data []string `json:"data"`
+}
+
+// ExportZone returns the zone in the JSON export format. It's made from the rendered zone file, so both
+// always contain the same data.
+func ExportZone(zone *Zone) (*ZoneExport, error) {
+	apex := strings.ToLower(dns.Fqdn(zone.Domain))
+	export := &ZoneExport{
+		Format: ZoneExportFormat,
+		Zone:   apex,
+		DNSSEC: ZoneExportDNSSEC{Signed: zone.DNSSEC},
+		RRsets: []ZoneExportRRset{},
+	}
+	if zone.DNSSEC {
+		export.DNSSEC.Policy = "default"
+	}
+
+	// Zones which were never committed have no serial yet
+	rendered := *zone
+	if rendered.Serial == "" {
+		rendered.SetNewSerial()
+	}
+
+	indexes := make(map[string]int)
+	parser := dns.NewZoneParser(strings.NewReader(rendered.Render()), apex, "")
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		header := rr.Header()
+		header.Name = strings.ToLower(header.Name)
+
+		if soa, ok := rr.(*dns.SOA); ok {
+			export.Serial = soa.Serial
+			export.SOA = ZoneExportSOA{
+				TTL:     header.Ttl,
+				MName:   soa.Ns,
+				RName:   soa.Mbox,
+				Refresh: soa.Refresh,
+				Retry:   soa.Retry,
+				Expire:  soa.Expire,
+				Minimum: soa.Minttl,
+			}
+			continue
+		}
+
+		key := header.Name + " " + dns.TypeToString[header.Rrtype]
+		index, ok := indexes[key]
+		if !ok {
+			index = len(export.RRsets)
+			indexes[key] = index
+			export.RRsets = append(export.RRsets, ZoneExportRRset{
+				Name: header.Name,
+				Type: dns.TypeToString[header.Rrtype],
+				TTL:  header.Ttl,
+				Data: []string{},
+			})
+		}
+		if header.Ttl < export.RRsets[index].TTL {
+			export.RRsets[index].TTL = header.Ttl
+		}
+		data := strings.TrimPrefix(rr.String(), header.String())
+		export.RRsets[index].Data = append(export.RRsets[index].Data, data)
+	}
+	if err := parser.Err(); err != nil {
+		return nil, errors.Wrap(err, "rendered zone")
+	}
+
+	return export, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportZone(t *testing.T) {
+	domain := "as-" + TEST_DOMAIN
+	zone := &Zone{Domain: domain, Serial: "2026101403", DNSSEC: true, Records: []Record{
+		{Name: "www", TTL: 600, Type: "A", Value: "192.0.2.1"},
+		{Name: "www", TTL: 300, Type: "A", Value: "192.0.2.2"},
+		{Name: "@", TTL: 300, Type: "MX", Prio: 10, Value: "mail"},
+		{Name: "@", TTL: 300, Type: "TXT", Value: "v=spf1 -all"},
+	}}
+
+	export, err := ExportZone(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, ZoneExportFormat, export.Format)
+	assert.Equal(t, domain+".", export.Zone)
+	assert.Equal(t, uint32(2026101403), export.Serial)
+	assert.Equal(t, ZoneExportDNSSEC{Signed: true, Policy: "default"}, export.DNSSEC)
+
+	sets := make(map[string]ZoneExportRRset)
+	for _, set := range export.RRsets {
+		sets[set.Name+" "+set.Type] = set
+	}
+	assert.Equal(t, ZoneExportRRset{
+		Name: "www." + domain + ".",
+		Type: "A",
+		TTL:  300,
+		Data: []string{"192.0.2.1", "192.0.2.2"},
+	}, sets["www."+domain+". A"])
+	assert.Equal(t, []string{"10 mail." + domain + "."}, sets[domain+". MX"].Data)
+	assert.Equal(t, []string{`"v=spf1 -all"`}, sets[domain+". TXT"].Data)
+
+	// Zone which wasn't committed yet gets today's first serial like its first commit
+	zone.Serial = ""
+	export, err = ExportZone(zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotZero(t, export.Serial)
+	assert.Equal(t, "", zone.Serial)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Splits off first n fields of the line and returns them with the rest of the line
+func splitFields(line string, n int) ([]string, string) {
+	var fields []string
+
+	rest := strings.TrimSpace(line)
+	for i := 0; i < n && rest != ""; i++ {
+		end := strings.IndexAny(rest, " \t")
+		if end < 0 {
+			fields = append(fields, rest)
+			rest = ""
+			break
+		}
+		fields = append(fields, rest[:end])
+		rest = strings.TrimSpace(rest[end:])
+	}
+
+	return fields, rest
+}
+
+// Removes the comment from the line and tells how many parentheses it opens, parentheses and semicolons
+// in quoted strings are data
+func stripComment(line string) (string, int) {
+	depth := 0
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case quoted && line[i] == '\\':
+			i++
+		case line[i] == '"':
+			quoted = !quoted
+		case quoted:
+		case line[i] == ';':
+			return strings.TrimRight(line[:i], " \t"), depth
+		case line[i] == '(':
+			depth++
+		case line[i] == ')':
+			depth--
+		}
+	}
+	return line, depth
+}
+
+// Joins content of quoted strings, ("part1" "part2") is one value, escaped backslashes are unescaped
+func unquoteParts(data string) string {
+	var value string
+
+	parts := strings.Split(data, "\"")
+	for i := 1; i < len(parts); i += 2 {
+		value += parts[i]
+	}
+	return strings.ReplaceAll(value, "\\\\", "\\")
+}
+
+// ParseZoneFile parses records from zone file rendered by Zone.Render. $TTL, SOA and NS records
+// of our name servers are managed by us and they are skipped. Records without TTL get the $TTL.
+func ParseZoneFile(content string, domain string) ([]Record, error) {
+	var records []Record
+	var lines []string
+
+	// Parenthesized data can be split over more lines
+	var current string
+	depth := 0
+	for _, line := range strings.Split(content, "\n") {
+		line, opened := stripComment(strings.TrimRight(line, "\r"))
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if current != "" {
+			current += " " + strings.TrimSpace(line)
+		} else {
+			current = line
+		}
+		depth += opened
+		if depth > 0 {
+			continue
+		}
+		depth = 0
+		lines = append(lines, current)
+		current = ""
+	}
+	if current != "" {
+		return nil, errors.New("unterminated parentheses: " + current)
+	}
+
+	nameServers := make(map[string]bool)
+	for _, nameServer := range config.NameServers {
+		nameServers[strings.ToLower(nameServer)+"."] = true
+	}
+
+	var defaultTTL int
+	var owner string
+	for _, line := range lines {
+		if strings.HasPrefix(line, "$TTL") {
+			fields, _ := splitFields(line, 2)
+			if len(fields) < 2 {
+				return nil, errors.New("invalid line: " + line)
+			}
+			ttl, err := strconv.Atoi(strings.TrimSuffix(fields[1], "s"))
+			if err != nil {
+				return nil, errors.New("invalid TTL: " + line)
+			}
+			defaultTTL = ttl
+			continue
+		}
+
+		// Line starting with whitespace belongs to the owner of the previous record
+		if line[0] == ' ' || line[0] == '\t' {
+			if owner == "" {
+				return nil, errors.New("record without owner name: " + line)
+			}
+			line = owner + " " + strings.TrimSpace(line)
+		}
+
+		fields, rest := splitFields(line, 3)
+		if len(fields) < 3 {
+			return nil, errors.New("invalid line: " + line)
+		}
+		owner = fields[0]
+
+		// NS records of the apex are rendered from DNSAPI_NAME_SERVERS or tenant's branding
+		apexNS := fields[2] == "NS" && (nameServers[strings.ToLower(rest)] || normalizeName(fields[0], domain) == "@")
+		if fields[1] == "IN" && (fields[2] == "SOA" || apexNS) {
+			continue
+		}
+
+		ttl, err := strconv.Atoi(strings.TrimSuffix(fields[1], "s"))
+		if err != nil && GetRecordType(strings.ToUpper(fields[1])) != nil {
+			// Record without TTL, the second field is its type
+			ttl, err = defaultTTL, nil
+			fields, rest = splitFields(line, 2)
+			fields = []string{fields[0], "", fields[1]}
+		}
+		if err != nil {
+			return nil, errors.New("invalid TTL: " + line)
+		}
+
+		record := Record{
+			Name:  fields[0],
+			TTL:   ttl,
+			Type:  strings.ToUpper(fields[2]),
+			Value: rest,
+		}
+
+		switch record.Type {
+		case "MX":
+			prio, value := splitFields(rest, 1)
+			if len(prio) != 1 {
+				return nil, errors.New("invalid MX record: " + line)
+			}
+			record.Prio, err = strconv.Atoi(prio[0])
+			if err != nil {
+				return nil, errors.New("invalid prio of MX record: " + line)
+			}
+			record.Value = value
+		case "TXT":
+			record.Value = unquoteParts(rest)
+		}
+
+		record.Normalize(domain)
+		records = append(records, record)
+	}
+
+	return records, nil
+}
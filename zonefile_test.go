@@ -0,0 +1,159 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestZone_RenderDeterministic(t *testing.T) {
+	zone := Zone{ID: 1, Domain: "V-" + TEST_DOMAIN, Serial: "2020010101"}
+	zone.AddRecord("www", 300, "A", 0, "1.2.3.5")
+	zone.AddRecord("@", 300, "MX", 20, "mail2.rosti.cz.")
+	zone.AddRecord("a.www", 300, "A", 0, "1.2.3.6")
+	zone.AddRecord("@", 300, "A", 0, "1.2.3.4")
+	zone.AddRecord("@", 300, "MX", 10, "mail.rosti.cz.")
+
+	reordered := Zone{ID: 1, Domain: zone.Domain, Serial: zone.Serial}
+	for i := len(zone.Records) - 1; i >= 0; i-- {
+		reordered.Records = append(reordered.Records, zone.Records[i])
+	}
+
+	rendered := zone.Render()
+	if rendered != reordered.Render() {
+		t.Error("Order of records changes the output")
+	}
+
+	var names []string
+	for _, record := range zone.SortedRecords() {
+		names = append(names, record.Name+" "+record.Type+" "+record.Value)
+	}
+	expected := []string{"@ A 1.2.3.4", "@ MX mail.rosti.cz.", "@ MX mail2.rosti.cz.", "www A 1.2.3.5", "a.www A 1.2.3.6"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Error("Unexpected order of records", names)
+	}
+	if zone.Records[0].Name != "www" {
+		t.Error("Render changed order of zone's records")
+	}
+
+	if !strings.Contains(rendered, "\n@        300s    A       1.2.3.4\n") || !strings.Contains(rendered, "\na.www    300s    A       1.2.3.6\n") {
+		t.Error("Columns are not aligned", rendered)
+	}
+}
+
+// Sorted keys of the records for comparison of record sets
+func recordSet(records []Record) []string {
+	var keys []string
+	for _, record := range records {
+		keys = append(keys, recordKey(&record))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestZoneFileRoundTrip(t *testing.T) {
+	zone, errs := NewZone("V-"+TEST_DOMAIN, []string{}, TEST_ABUSE_EMAIL)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	defer purgeZone(zone)
+
+	for _, record := range []Record{
+		{Name: "@", TTL: 300, Type: "A", Value: "1.2.3.4"},
+		{Name: "@", TTL: 300, Type: "AAAA", Value: "2001:db8::1"},
+		{Name: "www", TTL: 600, Type: "CNAME", Value: "@"},
+		{Name: "@", TTL: 300, Type: "MX", Prio: 10, Value: "mail.rosti.cz."},
+		{Name: "_sip._tcp", TTL: 300, Type: "SRV", Value: "10 5 5060 sip.rosti.cz."},
+		{Name: "@", TTL: 300, Type: "TXT", Value: "v=spf1 mx ~all"},
+		{Name: "long", TTL: 300, Type: "TXT", Value: strings.Repeat("abcdefghij", 60)},
+		{Name: "paren", TTL: 300, Type: "TXT", Value: "v=foo (bar; baz"},
+	} {
+		_, errs := NewRecord(zone.ID, record.Name, record.TTL, record.Type, record.Prio, record.Value)
+		if len(errs) != 0 {
+			t.Fatal(errs)
+		}
+	}
+
+	db := GetDatabaseConnection()
+	err := db.Where("id = ?", zone.ID).Preload("Records").Find(zone).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ParseZoneFile(zone.Render(), zone.Domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(recordSet(records), "\n") != strings.Join(recordSet(zone.Records), "\n") {
+		t.Error("Parsed records differ", recordSet(records), recordSet(zone.Records))
+	}
+
+	// Import of the exported zone keeps everything as it is
+	imported, errs := ImportZoneFile(zone.ID, zone.Render())
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if imported.Render() != zone.Render() {
+		t.Error("Re-imported zone renders differently")
+	}
+	var ids []uint
+	for _, record := range imported.Records {
+		ids = append(ids, record.ID)
+	}
+	for _, record := range zone.Records {
+		found := false
+		for _, id := range ids {
+			found = found || id == record.ID
+		}
+		if !found {
+			t.Error("Unchanged record was recreated", record)
+		}
+	}
+
+	// Changed zone file
+	content := strings.Replace(zone.Render(), "1.2.3.4", "1.2.3.9", 1)
+	imported, errs = ImportZoneFile(zone.ID, content)
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	if len(imported.Records) != len(zone.Records) || !strings.Contains(imported.Render(), "1.2.3.9") || strings.Contains(imported.Render(), "1.2.3.4\n") {
+		t.Error("Change wasn't imported", imported.Render())
+	}
+
+	// Invalid zone file doesn't change anything
+	_, errs = ImportZoneFile(zone.ID, "www 300s A not-an-ip\n")
+	if len(errs) == 0 {
+		t.Error("Invalid record was imported")
+	}
+	records, err = ParseZoneFile("www 300s TXT ( \"first ) part\" ; comment (\n \"second\" )\n", zone.Domain)
+	if err != nil || len(records) != 1 || records[0].Value != "first ) partsecond" {
+		t.Error("Parentheses in quotes and comments were counted", records, err)
+	}
+	_, err = ParseZoneFile("www 300s TXT (\"unterminated\"\n", zone.Domain)
+	if err == nil {
+		t.Error("Unterminated parentheses passed")
+	}
+}
+
+func TestZone_RenderDefaultTTL(t *testing.T) {
+	zone := Zone{ID: 1, Domain: "AV-" + TEST_DOMAIN, Serial: "2020010101", TTL: 600}
+	zone.AddRecord("@", 600, "A", 0, "1.2.3.4")
+	zone.AddRecord("www", 3600, "A", 0, "1.2.3.5")
+	zone.AddRecord("@", 600, "TXT", 0, "v=spf1 -all")
+
+	rendered := zone.Render()
+	if !strings.HasPrefix(rendered, "$TTL 600s\n") {
+		t.Error("$TTL isn't zone's default TTL", rendered)
+	}
+	if !strings.Contains(rendered, "\n@               A        1.2.3.4\n") || !strings.Contains(rendered, "\nwww    3600s    A        1.2.3.5\n") {
+		t.Error("TTLs equal to $TTL aren't left out", rendered)
+	}
+
+	records, err := ParseZoneFile(rendered, zone.Domain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(recordSet(records), ",") != strings.Join(recordSet(zone.Records), ",") {
+		t.Error("Records without TTL weren't parsed with $TTL", records)
+	}
+}